@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -22,6 +23,75 @@ type ObjectServiceSpec struct {
 	DataPath         string `json:"dataPath,omitempty"`
 	EnableVersioning bool   `json:"enableVersioning,omitempty"`
 	ForcePathStyle   bool   `json:"forcePathStyle,omitempty"`
+
+	CustomDomainSecrets []string `json:"customDomainSecrets,omitempty"`
+
+	MaxObjectSizeBytes int64 `json:"maxObjectSizeBytes,omitempty"`
+	MaxMetadataBytes   int32 `json:"maxMetadataBytes,omitempty"`
+	MaxHeaderBytes     int32 `json:"maxHeaderBytes,omitempty"`
+	MaxParts           int32 `json:"maxParts,omitempty"`
+
+	ExtraEnv     []corev1.EnvVar `json:"extraEnv,omitempty"`
+	COSIExtraEnv []corev1.EnvVar `json:"cosiExtraEnv,omitempty"`
+
+	// Resources and COSIResources are the requests and limits of the
+	// objectd and COSI driver containers.
+	Resources     corev1.ResourceRequirements `json:"resources,omitempty"`
+	COSIResources corev1.ResourceRequirements `json:"cosiResources,omitempty"`
+
+	// NodeSelector, Tolerations and Affinity place both the objectd and
+	// the COSI driver pods.
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+	Affinity     *corev1.Affinity    `json:"affinity,omitempty"`
+	// TopologySpreadConstraints spread the objectd pods. ZoneSpread adds
+	// one over zones and makes objectd keep the copies of each object in
+	// different zones where it can.
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	ZoneSpread                bool                              `json:"zoneSpread,omitempty"`
+
+	Standby          *StandbySpec          `json:"standby,omitempty"`
+	Outbound         *OutboundSpec         `json:"outbound,omitempty"`
+	AdminClientCerts *AdminClientCertsSpec `json:"adminClientCerts,omitempty"`
+	Probes           *ProbesSpec           `json:"probes,omitempty"`
+}
+
+// ProbesSpec overrides the probes of the objectd container. Only the fields
+// that are set replace those of the default probe; a probe without a
+// handler keeps the default one.
+type ProbesSpec struct {
+	Readiness *corev1.Probe `json:"readiness,omitempty"`
+	Startup   *corev1.Probe `json:"startup,omitempty"`
+	Liveness  *corev1.Probe `json:"liveness,omitempty"`
+}
+
+// AdminClientCertsSpec lets clients authenticate to the admin API with a
+// certificate signed by the CA of the TLS secret instead of the admin
+// token. Identities are subject alternative names, each optionally
+// followed by =role; without one it is cluster-admin. COSISecretName is a
+// TLS secret, such as one issued by cert-manager, that the COSI driver
+// presents instead of the token; its identity must be listed.
+type AdminClientCertsSpec struct {
+	Identities     []string `json:"identities,omitempty"`
+	COSISecretName string   `json:"cosiSecretName,omitempty"`
+}
+
+// OutboundSpec configures connections from objectd to endpoints outside the
+// cluster. The CA bundle secret must contain a ca.crt key.
+type OutboundSpec struct {
+	HTTPProxy          string `json:"httpProxy,omitempty"`
+	HTTPSProxy         string `json:"httpsProxy,omitempty"`
+	NoProxy            string `json:"noProxy,omitempty"`
+	CABundleSecretName string `json:"caBundleSecretName,omitempty"`
+}
+
+// StandbySpec makes the service an asynchronous disaster recovery copy of
+// another ObjectService. Setting Promote turns it into a primary for good.
+type StandbySpec struct {
+	PrimaryURL      string `json:"primaryURL"`
+	TokenSecretName string `json:"tokenSecretName"`
+	CASecretName    string `json:"caSecretName,omitempty"`
+	Promote         bool   `json:"promote,omitempty"`
 }
 
 type ObjectServiceStatus struct {
@@ -29,8 +99,17 @@ type ObjectServiceStatus struct {
 	ReadyReplicas      int32  `json:"readyReplicas,omitempty"`
 	ServiceEndpoint    string `json:"serviceEndpoint,omitempty"`
 	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+const (
+	ConditionReplicationPaused = "ReplicationPaused"
+	ConditionExtraEnvValid     = "ExtraEnvValid"
+	ConditionStandby           = "Standby"
+	ConditionDiskReadOnly      = "DiskReadOnly"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 
@@ -58,6 +137,8 @@ func (in *ObjectService) DeepCopyObject() runtime.Object {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+	in.Spec.deepCopyInto(&out.Spec)
+	in.Status.deepCopyInto(&out.Status)
 	return out
 }
 
@@ -72,6 +153,76 @@ func (in *ObjectServiceList) DeepCopyObject() runtime.Object {
 	if in.Items != nil {
 		out.Items = make([]ObjectService, len(in.Items))
 		copy(out.Items, in.Items)
+		for i := range in.Items {
+			in.Items[i].Spec.deepCopyInto(&out.Items[i].Spec)
+			in.Items[i].Status.deepCopyInto(&out.Items[i].Status)
+		}
 	}
 	return out
 }
+
+func (in *ObjectServiceSpec) deepCopyInto(out *ObjectServiceSpec) {
+	in.Resources.DeepCopyInto(&out.Resources)
+	in.COSIResources.DeepCopyInto(&out.COSIResources)
+	if in.CustomDomainSecrets != nil {
+		out.CustomDomainSecrets = append([]string(nil), in.CustomDomainSecrets...)
+	}
+	if in.ExtraEnv != nil {
+		out.ExtraEnv = make([]corev1.EnvVar, len(in.ExtraEnv))
+		for i := range in.ExtraEnv {
+			in.ExtraEnv[i].DeepCopyInto(&out.ExtraEnv[i])
+		}
+	}
+	if in.COSIExtraEnv != nil {
+		out.COSIExtraEnv = make([]corev1.EnvVar, len(in.COSIExtraEnv))
+		for i := range in.COSIExtraEnv {
+			in.COSIExtraEnv[i].DeepCopyInto(&out.COSIExtraEnv[i])
+		}
+	}
+	if in.NodeSelector != nil {
+		out.NodeSelector = make(map[string]string, len(in.NodeSelector))
+		for k, v := range in.NodeSelector {
+			out.NodeSelector[k] = v
+		}
+	}
+	if in.Tolerations != nil {
+		out.Tolerations = make([]corev1.Toleration, len(in.Tolerations))
+		for i := range in.Tolerations {
+			in.Tolerations[i].DeepCopyInto(&out.Tolerations[i])
+		}
+	}
+	if in.Affinity != nil {
+		out.Affinity = in.Affinity.DeepCopy()
+	}
+	if in.TopologySpreadConstraints != nil {
+		out.TopologySpreadConstraints = make([]corev1.TopologySpreadConstraint, len(in.TopologySpreadConstraints))
+		for i := range in.TopologySpreadConstraints {
+			in.TopologySpreadConstraints[i].DeepCopyInto(&out.TopologySpreadConstraints[i])
+		}
+	}
+	if in.Standby != nil {
+		s := *in.Standby
+		out.Standby = &s
+	}
+	if in.Outbound != nil {
+		o := *in.Outbound
+		out.Outbound = &o
+	}
+	if in.AdminClientCerts != nil {
+		c := *in.AdminClientCerts
+		c.Identities = append([]string(nil), in.AdminClientCerts.Identities...)
+		out.AdminClientCerts = &c
+	}
+	if in.Probes != nil {
+		out.Probes = &ProbesSpec{Readiness: in.Probes.Readiness.DeepCopy(), Startup: in.Probes.Startup.DeepCopy(), Liveness: in.Probes.Liveness.DeepCopy()}
+	}
+}
+
+func (in *ObjectServiceStatus) deepCopyInto(out *ObjectServiceStatus) {
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
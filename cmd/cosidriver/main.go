@@ -4,11 +4,16 @@ import (
 	"context"
 	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/mchenetz/entity/internal/cosi"
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/pkg/adminclient"
 	cosictrl "sigs.k8s.io/container-object-storage-interface-api/controller"
 )
 
@@ -28,11 +33,20 @@ func main() {
 	adminURL := env("ENTITY_ADMIN_URL", "https://entity.default.svc.cluster.local:19000")
 	adminCAPEM := os.Getenv("ENTITY_ADMIN_CA_PEM")
 	adminToken := os.Getenv("ENTITY_ADMIN_TOKEN")
-	if adminToken == "" {
-		log.Fatal("ENTITY_ADMIN_TOKEN is required")
+	adminCertFile := os.Getenv("ENTITY_ADMIN_TLS_CERT_FILE")
+	adminKeyFile := os.Getenv("ENTITY_ADMIN_TLS_KEY_FILE")
+	gcInterval := durationDefault(os.Getenv("ENTITY_COSI_GC_INTERVAL"), 10*time.Minute)
+	metricsAddr := os.Getenv("ENTITY_COSI_METRICS_ADDR")
+	if adminToken == "" && adminCertFile == "" {
+		log.Fatal("ENTITY_ADMIN_TOKEN or ENTITY_ADMIN_TLS_CERT_FILE is required")
 	}
 
-	admin := cosi.NewAdminClient(adminURL, adminToken, adminCAPEM)
+	admin := adminclient.New(adminURL, adminToken, adminCAPEM)
+	if adminCertFile != "" {
+		if err := admin.UseClientCertificate(adminCertFile, adminKeyFile); err != nil {
+			log.Fatalf("failed to load the admin client certificate: %v", err)
+		}
+	}
 	listener := cosi.NewListener(driverName, endpoint, region, s3CAPEM, admin)
 
 	ctrl, err := cosictrl.NewDefaultObjectStorageController(identity, lockName, threads)
@@ -54,6 +68,16 @@ func main() {
 		<-sigCh
 		cancel()
 	}()
+	go cosi.NewJanitor(listener, gcInterval).Run(ctx)
+	if metricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Default)
+			if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+				log.Printf("metrics listener: %v", err)
+			}
+		}()
+	}
 	if err := ctrl.Run(ctx); err != nil {
 		log.Fatalf("controller error: %v", err)
 	}
@@ -65,3 +89,11 @@ func env(k, d string) string {
 	}
 	return d
 }
+
+func durationDefault(v string, d time.Duration) time.Duration {
+	dur, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil {
+		return d
+	}
+	return dur
+}
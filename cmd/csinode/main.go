@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+
+	csispec "github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/mchenetz/entity/internal/csi"
+)
+
+const version = "0.1.0"
+
+func main() {
+	endpoint := env("CSI_ENDPOINT", "unix:///csi/csi.sock")
+	driverName := env("ENTITY_CSI_DRIVER_NAME", "fs.entity.io")
+	nodeID := os.Getenv("NODE_NAME")
+	spoolDir := env("ENTITY_CSI_SPOOL_DIR", os.TempDir())
+	if nodeID == "" {
+		log.Fatal("NODE_NAME is required")
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "unix" {
+		log.Fatalf("CSI_ENDPOINT must be a unix socket, got %q", endpoint)
+	}
+	sock := u.Path
+	if sock == "" {
+		sock = u.Opaque
+	}
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		log.Fatalf("failed to load the in-cluster config: %v", err)
+	}
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		log.Fatalf("failed to create the kubernetes client: %v", err)
+	}
+	if err := os.MkdirAll(spoolDir, 0o700); err != nil {
+		log.Fatalf("failed to create the spool directory: %v", err)
+	}
+
+	if err := os.Remove(sock); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("failed to remove the stale socket: %v", err)
+	}
+	lis, err := net.Listen("unix", sock)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", sock, err)
+	}
+	driver := csi.NewDriver(driverName, version, nodeID, kube, spoolDir)
+	srv := grpc.NewServer()
+	csispec.RegisterIdentityServer(srv, driver)
+	csispec.RegisterNodeServer(srv, driver)
+
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCh
+		srv.GracefulStop()
+	}()
+	log.Printf("csi node plugin %s serving on %s for node %s", driverName, sock, nodeID)
+	if err := srv.Serve(lis); err != nil {
+		log.Fatalf("csi server: %v", err)
+	}
+}
+
+func env(k, d string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return d
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// runFsck implements "entity-objectd fsck". It opens the store configured by
+// the usual environment, which must not be in use by a running server, and
+// prints what it finds. The exit status is 0 when no issue is left, 1 when
+// some are and 2 when the check could not run.
+func runFsck(args []string) int {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "fix the issues that can be fixed")
+	verify := flags.Bool("verify", false, "read every object and compare it with its checksum")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	store, err := openStore(getEnv("ENTITY_DATA_DIR", "/data"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fsck: open store: %v\n", err)
+		return 2
+	}
+	defer store.Close()
+	cl := cluster.New(cluster.Config{PodName: os.Getenv("POD_NAME"), Replicas: atoiDefault(os.Getenv("ENTITY_REPLICAS"), 1)})
+	report, err := store.Fsck(context.Background(), fsckOptions(cl, *repair, *verify))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fsck: %v\n", err)
+		return 2
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	} else {
+		printFsckReport(os.Stdout, report)
+	}
+	if report.Unresolved() > 0 {
+		return 1
+	}
+	return 0
+}
+
+// fsckOnStart checks the store before the server starts. mode is "check",
+// which only logs the issues, or "repair".
+func fsckOnStart(store *objectd.Store, mode string, cl *cluster.Cluster) error {
+	if mode != "check" && mode != "repair" {
+		return fmt.Errorf("invalid ENTITY_FSCK_ON_START %q", mode)
+	}
+	report, err := store.Fsck(context.Background(), fsckOptions(cl, mode == "repair", false))
+	if err != nil {
+		return err
+	}
+	for _, i := range report.Issues {
+		log.Printf("fsck: %s", fsckIssueLine(i))
+	}
+	log.Printf("fsck: %d objects, %d files, %d issues, %d unresolved", report.Objects, report.Files, len(report.Issues), report.Unresolved())
+	return nil
+}
+
+// fsckOptions refetches damaged objects from the next replica when there
+// are peers to fetch from.
+func fsckOptions(cl *cluster.Cluster, repair, verify bool) objectd.FsckOptions {
+	opts := objectd.FsckOptions{Repair: repair, VerifyChecksums: verify}
+	if cl.Enabled() {
+		opts.Refetch = true
+		opts.Origin = cl.NextOrdinal()
+	}
+	return opts
+}
+
+func printFsckReport(w io.Writer, r objectd.FsckReport) {
+	for _, i := range r.Issues {
+		fmt.Fprintln(w, fsckIssueLine(i))
+	}
+	fmt.Fprintf(w, "%d objects, %d files checked: %d issues, %d unresolved\n", r.Objects, r.Files, len(r.Issues), r.Unresolved())
+	if r.Unverified > 0 {
+		fmt.Fprintf(w, "%d encrypted objects were not verified: ENTITY_SSE_MASTER_KEY is not set\n", r.Unverified)
+	}
+}
+
+func fsckIssueLine(i objectd.FsckIssue) string {
+	line := i.Kind
+	if i.Bucket != "" {
+		line += " " + i.Bucket + "/" + i.Key
+	}
+	if i.Path != "" {
+		line += " " + i.Path
+	}
+	if i.Detail != "" {
+		line += ": " + i.Detail
+	}
+	if i.Action != "" {
+		line += " [" + i.Action + "]"
+	}
+	return line
+}
@@ -1,35 +1,75 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/mchenetz/entity/internal/admin"
+	"github.com/mchenetz/entity/internal/audit"
 	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/config"
+	"github.com/mchenetz/entity/internal/federation"
+	"github.com/mchenetz/entity/internal/heat"
+	"github.com/mchenetz/entity/internal/logbuf"
+	"github.com/mchenetz/entity/internal/metering"
 	"github.com/mchenetz/entity/internal/objectd"
+	"github.com/mchenetz/entity/internal/outbound"
+	"github.com/mchenetz/entity/internal/ratelimit"
 	"github.com/mchenetz/entity/internal/s3"
+	"github.com/mchenetz/entity/internal/scrub"
+	"github.com/mchenetz/entity/internal/sni"
+	"github.com/mchenetz/entity/internal/standby"
+	"github.com/mchenetz/entity/internal/tier"
+	"github.com/mchenetz/entity/internal/tokens"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fsck" {
+		os.Exit(runFsck(os.Args[2:]))
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, logbuf.Default))
+	var reloader *config.Reloader
+	if file := os.Getenv("ENTITY_CONFIG_FILE"); file != "" {
+		var err error
+		if reloader, err = config.Open(file, hotSettings); err != nil {
+			log.Fatalf("failed to read the configuration file: %v", err)
+		}
+	}
 	dataDir := getEnv("ENTITY_DATA_DIR", "/data")
 	s3Port := getEnv("ENTITY_S3_PORT", "9000")
 	adminPort := getEnv("ENTITY_ADMIN_PORT", "19000")
-	adminToken := os.Getenv("ENTITY_ADMIN_TOKEN")
-	if adminToken == "" {
-		log.Fatal("ENTITY_ADMIN_TOKEN must be set")
+	adminTokens := tokens.New(os.Getenv("ENTITY_ADMIN_TOKEN"), os.Getenv("ENTITY_ADMIN_TOKEN_FILE"))
+	if adminTokens.Empty() {
+		log.Fatal("ENTITY_ADMIN_TOKEN or ENTITY_ADMIN_TOKEN_FILE must be set")
 	}
 	tlsEnabled := strings.EqualFold(getEnv("ENTITY_TLS_ENABLED", "false"), "true")
 	certFile := os.Getenv("ENTITY_TLS_CERT_FILE")
 	keyFile := os.Getenv("ENTITY_TLS_KEY_FILE")
 	caFile := os.Getenv("ENTITY_TLS_CA_FILE")
+	if certs := os.Getenv("ENTITY_ADMIN_CLIENT_CERTS"); certs != "" {
+		// Without a CA, client certificates would be verified against the
+		// system roots.
+		if !tlsEnabled || caFile == "" {
+			log.Fatal("ENTITY_ADMIN_CLIENT_CERTS requires ENTITY_TLS_ENABLED and ENTITY_TLS_CA_FILE")
+		}
+		if err := adminTokens.AllowCertificates(certs); err != nil {
+			log.Fatalf("invalid ENTITY_ADMIN_CLIENT_CERTS: %v", err)
+		}
+	}
 
 	clusterCfg := cluster.Config{
 		PodName:      os.Getenv("POD_NAME"),
@@ -39,33 +79,271 @@ func main() {
 		Replicas:     atoiDefault(os.Getenv("ENTITY_REPLICAS"), 1),
 		S3Port:       atoiDefault(s3Port, 9000),
 		AdminPort:    atoiDefault(adminPort, 19000),
-		Token:        adminToken,
+		Tokens:       adminTokens,
 		TLSEnabled:   tlsEnabled,
 		CAFile:       caFile,
 		CertFile:     certFile,
 		KeyFile:      keyFile,
+		MaxClockSkew: durationDefault(os.Getenv("ENTITY_MAX_CLOCK_SKEW"), 2*time.Second),
+		HintMaxBytes: int64Default(os.Getenv("ENTITY_HINT_MAX_BYTES"), cluster.DefaultHintMaxBytes),
+		Copies:       atoiDefault(os.Getenv("ENTITY_PLACEMENT_COPIES"), 0),
+		PeerTimeout:  durationDefault(os.Getenv("ENTITY_REPLICATION_PEER_TIMEOUT"), cluster.DefaultPeerTimeout),
+
+		ReplicationBandwidth: int64Default(os.Getenv("ENTITY_REPLICATION_BANDWIDTH"), 0),
+		MaxBacklog:           int64Default(os.Getenv("ENTITY_REPLICATION_MAX_BACKLOG"), 0),
+
+		AdvertiseURL:      strings.TrimRight(os.Getenv("ENTITY_ADVERTISE_URL"), "/"),
+		NodeID:            os.Getenv("ENTITY_NODE_ID"),
+		MemberRemoveAfter: durationDefault(os.Getenv("ENTITY_MEMBER_REMOVE_AFTER"), cluster.DefaultMemberRemoveAfter),
+
+		LeaderLease:         os.Getenv("ENTITY_LEADER_LEASE"),
+		LeaderLeaseDuration: durationDefault(os.Getenv("ENTITY_LEADER_LEASE_DURATION"), cluster.DefaultLeaderLeaseDuration),
+
+		ZonesFile: os.Getenv("ENTITY_ZONES_FILE"),
 	}
+	for _, seed := range strings.Split(os.Getenv("ENTITY_GOSSIP_SEEDS"), ",") {
+		if seed = strings.TrimRight(strings.TrimSpace(seed), "/"); seed != "" {
+			clusterCfg.Seeds = append(clusterCfg.Seeds, seed)
+		}
+	}
+	consistency, err := cluster.ParseConsistency(getEnv("ENTITY_WRITE_CONSISTENCY", "quorum"))
+	if err != nil {
+		log.Fatalf("invalid ENTITY_WRITE_CONSISTENCY: %v", err)
+	}
+	clusterCfg.Consistency = consistency
 	if clusterCfg.PodName == "" {
 		clusterCfg.PodName = clusterCfg.Name + "-0"
 	}
 	cl := cluster.New(clusterCfg)
+	// The zones decide placement, so they are read before any object is.
+	if err := cl.LoadZones(); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to read the zones: %v", err)
+	}
+	if err := cl.OpenEpoch(filepath.Join(dataDir, "leadership-epoch")); err != nil {
+		log.Fatalf("failed to load the leadership epoch: %v", err)
+	}
+	switch mode := getEnv("ENTITY_REPLICATION_MODE", "sync"); mode {
+	case "sync":
+	case "async":
+		if err := cl.OpenReplicationQueue(filepath.Join(dataDir, "replication-queue")); err != nil {
+			log.Fatalf("failed to open the replication queue: %v", err)
+		}
+	default:
+		log.Fatalf("invalid ENTITY_REPLICATION_MODE %q", mode)
+	}
 
-	store, err := objectd.OpenStore(dataDir)
+	store, err := openStore(dataDir)
 	if err != nil {
 		log.Fatalf("failed to open store: %v", err)
 	}
 	defer store.Close()
+	cl.UseBucketCopies(store.BucketCopies)
+	store.SetClockNode(cl.SelfOrdinal())
+	if mode := getEnv("ENTITY_FSCK_ON_START", "off"); mode != "off" {
+		if err := fsckOnStart(store, mode, cl); err != nil {
+			log.Fatalf("fsck: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go adminTokens.Watch(30*time.Second, ctx.Done())
+
+	tracker := heat.New(atoiDefault(os.Getenv("ENTITY_HEAT_TRACKED_KEYS"), 128))
+	heatPath := filepath.Join(dataDir, "heat.json")
+	if err := tracker.Load(heatPath); err != nil {
+		log.Printf("failed to load heat data: %v", err)
+	}
+	if strings.EqualFold(getEnv("ENTITY_HEAT_PREWARM", "false"), "true") {
+		go prewarm(ctx, store, tracker.Hot(atoiDefault(os.Getenv("ENTITY_HEAT_PREWARM_KEYS"), 32)))
+	}
+	store.UseForget(tracker.Forget)
+	go tracker.Run(ctx, time.Minute, heatPath)
+	var meter *metering.Meter
+	meterPath := filepath.Join(dataDir, "metering.json")
+	if retention := durationDefault(os.Getenv("ENTITY_METERING_RETENTION"), metering.DefaultRetention); retention > 0 {
+		meter = metering.New(retention)
+		if err := meter.Load(meterPath); err != nil {
+			log.Printf("failed to load metering data: %v", err)
+		}
+		go meter.Run(ctx, 5*time.Minute, meterPath, func() map[string]int64 {
+			out := map[string]int64{}
+			for name, u := range store.Usage(ctx) {
+				out[name] = u.Bytes
+			}
+			return out
+		})
+	}
+	if interval := durationDefault(os.Getenv("ENTITY_GC_INTERVAL"), 24*time.Hour); interval > 0 {
+		go store.RunGC(ctx, interval, objectd.GCOptions{
+			MinAge:     durationDefault(os.Getenv("ENTITY_GC_MIN_AGE"), objectd.DefaultGCMinAge),
+			Quarantine: strings.EqualFold(getEnv("ENTITY_GC_QUARANTINE", "false"), "true"),
+		})
+	}
+	go store.RunTrashPurge(ctx, time.Hour)
+	go store.RunLastUsedSave(ctx, time.Minute)
+	go store.RunTombstonePurge(ctx, time.Hour, durationDefault(os.Getenv("ENTITY_TOMBSTONE_RETENTION"), objectd.DefaultTombstoneRetention))
+	if interval := durationDefault(os.Getenv("ENTITY_EXPIRY_INTERVAL"), time.Minute); interval > 0 {
+		go store.RunExpirySweep(ctx, interval)
+	}
+	if interval := durationDefault(os.Getenv("ENTITY_DISK_CHECK_INTERVAL"), 10*time.Second); interval > 0 {
+		high := float64Default(os.Getenv("ENTITY_DISK_HIGH_WATERMARK"), 95)
+		low := math.Min(float64Default(os.Getenv("ENTITY_DISK_LOW_WATERMARK"), 90), high)
+		go store.RunDiskWatch(ctx, interval, high, low)
+	}
+
+	s3Handler := s3.NewHandler(store, cl)
+	s3Handler.Access = tracker
+	s3Handler.Meter = meter
+	s3Handler.RateLimiter = ratelimit.New()
+	trusted, err := s3.ParseTrustedProxies(os.Getenv("ENTITY_TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("invalid ENTITY_TRUSTED_PROXIES: %v", err)
+	}
+	s3Handler.TrustedProxies = trusted
+	s3Handler.Auth.MaxSkew = durationDefault(os.Getenv("ENTITY_MAX_REQUEST_SKEW"), s3.DefaultMaxRequestSkew)
+	s3Handler.SetLimits(s3.Limits{
+		MaxObjectSize:   int64Default(os.Getenv("ENTITY_MAX_OBJECT_SIZE"), s3.DefaultMaxObjectSize),
+		MaxMetadataSize: atoiDefault(os.Getenv("ENTITY_MAX_METADATA_SIZE"), s3.DefaultMaxMetadataSize),
+		MaxParts:        atoiDefault(os.Getenv("ENTITY_MAX_PARTS"), s3.DefaultMaxParts),
+	})
+	s3Handler.LocalWriteThreshold = int64Default(os.Getenv("ENTITY_LOCAL_WRITE_THRESHOLD"), s3.DefaultLocalWriteThreshold)
+	s3Handler.RedirectToLeader = strings.EqualFold(getEnv("ENTITY_LEADER_REDIRECT", "false"), "true")
+	s3Handler.LeaderRedirectURL = os.Getenv("ENTITY_LEADER_REDIRECT_URL")
+	if s3Handler.ListConsistency, err = s3.ParseListConsistency(getEnv("ENTITY_LIST_CONSISTENCY", s3.ListConsistencyLocal)); err != nil {
+		log.Fatalf("invalid ENTITY_LIST_CONSISTENCY: %v", err)
+	}
+	if strings.EqualFold(getEnv("ENTITY_BOOTSTRAP", "true"), "true") {
+		cl.Bootstrap(ctx, store, durationDefault(os.Getenv("ENTITY_BOOTSTRAP_WAIT"), cluster.DefaultBootstrapWait))
+	}
+	go cl.RunGossip(ctx, durationDefault(os.Getenv("ENTITY_GOSSIP_INTERVAL"), cluster.DefaultGossipInterval))
+	go cl.RunZones(ctx, cluster.DefaultZonesInterval)
+	go cl.RunLeaderElection(ctx)
+	go cl.RunHealthView(ctx, durationDefault(os.Getenv("ENTITY_HEALTH_CHECK_INTERVAL"), cluster.DefaultHealthCheckInterval))
+	quorumInterval := durationDefault(os.Getenv("ENTITY_QUORUM_CHECK_INTERVAL"), cluster.DefaultQuorumCheckInterval)
+	go cl.RunQuorumMonitor(ctx, quorumInterval)
+	go cl.RunLeadershipEpochs(ctx, quorumInterval)
+	go cl.RunFetcher(ctx, store, 2*time.Second)
+	go cl.RunHintedHandoff(ctx, 5*time.Second)
+	if cl.Async() {
+		go cl.RunAsyncReplication(ctx)
+	}
+	if interval := durationDefault(os.Getenv("ENTITY_ANTI_ENTROPY_INTERVAL"), 10*time.Minute); interval > 0 {
+		go cl.RunAntiEntropy(ctx, store, interval)
+	}
+	if strings.EqualFold(getEnv("ENTITY_SIGV4_REPLAY_CACHE", "false"), "true") {
+		window := s3Handler.Auth.MaxSkew
+		if window <= 0 {
+			window = s3.DefaultMaxRequestSkew
+		}
+		s3Handler.Auth.Replay = s3.NewReplayCache(window)
+	}
+	adminHandler := admin.New(store, adminTokens, cl)
+	adminHandler.Heat = tracker
+	adminHandler.Meter = meter
+	auditLog, err := audit.Open(filepath.Join(dataDir, "audit.log"), int64Default(os.Getenv("ENTITY_AUDIT_LOG_MAX_BYTES"), audit.DefaultMaxBytes))
+	if err != nil {
+		log.Fatalf("failed to open audit log: %v", err)
+	}
+	if strings.EqualFold(getEnv("ENTITY_AUDIT_STDOUT", "false"), "true") {
+		auditLog.Stdout = os.Stdout
+	}
+	adminHandler.Audit = auditLog
+	var scrubber *scrub.Scrubber
+	if interval := durationDefault(os.Getenv("ENTITY_SCRUB_INTERVAL"), 24*time.Hour); interval > 0 {
+		scrubber = scrub.New(scrub.Config{
+			Interval:       interval,
+			BytesPerSecond: int64Default(os.Getenv("ENTITY_SCRUB_BYTES_PER_SECOND"), 10<<20),
+		}, store, cl)
+		adminHandler.Scrub = scrubber
+		go scrubber.Run(ctx)
+	}
+	if endpoint := os.Getenv("ENTITY_TIER_ENDPOINT"); endpoint != "" {
+		tr, err := outbound.NewTransport(os.Getenv("ENTITY_TIER_CA_FILE"))
+		if err != nil {
+			log.Fatalf("tier: %v", err)
+		}
+		cfg := tier.Config{
+			Target: tier.Target{
+				Endpoint:  endpoint,
+				Bucket:    os.Getenv("ENTITY_TIER_BUCKET"),
+				Region:    os.Getenv("ENTITY_TIER_REGION"),
+				AccessKey: os.Getenv("ENTITY_TIER_ACCESS_KEY"),
+				SecretKey: os.Getenv("ENTITY_TIER_SECRET_KEY"),
+			},
+			Prefix:         os.Getenv("ENTITY_TIER_PREFIX"),
+			MinAge:         durationDefault(os.Getenv("ENTITY_TIER_MIN_AGE"), 30*24*time.Hour),
+			MinSize:        int64Default(os.Getenv("ENTITY_TIER_MIN_SIZE"), 1<<20),
+			Interval:       durationDefault(os.Getenv("ENTITY_TIER_INTERVAL"), time.Hour),
+			RequireRestore: strings.EqualFold(getEnv("ENTITY_TIER_REQUIRE_RESTORE", "false"), "true"),
+		}
+		for _, b := range strings.Split(os.Getenv("ENTITY_TIER_BUCKETS"), ",") {
+			if b = strings.TrimSpace(b); b != "" {
+				cfg.Buckets = append(cfg.Buckets, b)
+			}
+		}
+		tierer, err := tier.New(cfg, store, tr)
+		if err != nil {
+			log.Fatalf("tier: %v", err)
+		}
+		s3Handler.Tier = tierer
+		go tierer.Run(ctx)
+	}
+	if primary := os.Getenv("ENTITY_STANDBY_PRIMARY_URL"); primary != "" {
+		store.SetStandby(true)
+		follower, err := standby.New(standby.Config{
+			PrimaryURL: strings.TrimRight(primary, "/"),
+			Token:      os.Getenv("ENTITY_STANDBY_PRIMARY_TOKEN"),
+			CAFile:     os.Getenv("ENTITY_STANDBY_PRIMARY_CA_FILE"),
+			Interval:   durationDefault(os.Getenv("ENTITY_STANDBY_INTERVAL"), 10*time.Second),
+		}, store, cl)
+		if err != nil {
+			log.Fatalf("invalid standby configuration: %v", err)
+		}
+		adminHandler.Standby = follower
+		if store.Standby() {
+			go follower.Run(ctx)
+		}
+	}
+	if remote := os.Getenv("ENTITY_FEDERATION_URL"); remote != "" {
+		replicator, err := federation.New(federation.Config{
+			RemoteURL: strings.TrimRight(remote, "/"),
+			Token:     os.Getenv("ENTITY_FEDERATION_TOKEN"),
+			CAFile:    os.Getenv("ENTITY_FEDERATION_CA_FILE"),
+			CertFile:  os.Getenv("ENTITY_FEDERATION_CERT_FILE"),
+			KeyFile:   os.Getenv("ENTITY_FEDERATION_KEY_FILE"),
+			Interval:  durationDefault(os.Getenv("ENTITY_FEDERATION_INTERVAL"), 10*time.Second),
+		}, store, cl)
+		if err != nil {
+			log.Fatalf("invalid federation configuration: %v", err)
+		}
+		adminHandler.Federation = replicator
+		go replicator.Run(ctx)
+	}
+
+	if reloader != nil {
+		reloader.Apply = hotApplier(s3Handler, cl, scrubber, s3Handler.Tier)
+		adminHandler.Config = reloader
+		go reloader.Watch(durationDefault(os.Getenv("ENTITY_CONFIG_WATCH_INTERVAL"), 30*time.Second), ctx.Done())
+	}
 
 	s3Mux := http.NewServeMux()
-	s3Mux.Handle("/", s3.NewHandler(store, cl))
+	s3Mux.Handle("/", s3Handler)
 	adminMux := http.NewServeMux()
-	adminMux.Handle("/_cluster/", cluster.NewReplicationHandler(store, adminToken))
-	adminMux.Handle("/admin/", admin.New(store, adminToken, cl))
+	replHandler := cluster.NewReplicationHandler(store, adminTokens)
+	replHandler.Cluster = cl
+	replHandler.Meter = meter
+	adminMux.Handle("/_cluster/", replHandler)
+	adminMux.Handle("/"+cluster.ReplicationService+"/", replHandler)
+	adminMux.Handle("/admin/", adminHandler)
+	adminMux.HandleFunc("/healthz", adminHandler.ServeHealth)
+	adminMux.HandleFunc("/readyz", adminHandler.ServeReady)
 
 	s3Srv := &http.Server{
 		Addr:              ":" + s3Port,
 		Handler:           s3Mux,
 		ReadHeaderTimeout: 10 * time.Second,
+		MaxHeaderBytes:    atoiDefault(os.Getenv("ENTITY_MAX_HEADER_BYTES"), http.DefaultMaxHeaderBytes),
 	}
 	adminSrv := &http.Server{
 		Addr:              ":" + adminPort,
@@ -79,6 +357,9 @@ func main() {
 			log.Fatalf("failed to build TLS config: %v", err)
 		}
 		s3Srv.TLSConfig = tlsCfg.Clone()
+		domainCerts := sni.New(getEnv("ENTITY_DOMAIN_CERT_DIR", "/etc/entity/domains"))
+		go domainCerts.Watch(time.Minute, ctx.Done())
+		s3Srv.TLSConfig.GetCertificate = domainCerts.GetCertificate
 		adminTLS := tlsCfg.Clone()
 		adminTLS.ClientAuth = tls.VerifyClientCertIfGiven
 		adminSrv.TLSConfig = adminTLS
@@ -110,10 +391,116 @@ func main() {
 	}()
 
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigCh {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if reloader == nil {
+			log.Printf("SIGHUP ignored: ENTITY_CONFIG_FILE is not set")
+		} else if _, err := reloader.Reload(); err != nil {
+			log.Printf("configuration reload failed: %v", err)
+		}
+	}
 	_ = s3Srv.Close()
 	_ = adminSrv.Close()
+	if err := tracker.Save(heatPath); err != nil {
+		log.Printf("failed to save heat data: %v", err)
+	}
+	if meter != nil {
+		if err := meter.Save(meterPath); err != nil {
+			log.Printf("failed to save metering data: %v", err)
+		}
+	}
+	_ = auditLog.Close()
+}
+
+// openStore opens the store in dataDir with the options and SSE master key
+// from the environment.
+func openStore(dataDir string) (*objectd.Store, error) {
+	storeOpts := objectd.StoreOptions{
+		MetaBackend:          getEnv("ENTITY_META_BACKEND", objectd.MetaBackendBolt),
+		Compression:          os.Getenv("ENTITY_COMPRESSION"),
+		CompressionSkipTypes: objectd.DefaultCompressionSkipTypes,
+		InlineThreshold:      int64Default(os.Getenv("ENTITY_INLINE_THRESHOLD"), 0),
+		CacheSize:            int64Default(os.Getenv("ENTITY_CACHE_SIZE"), 0),
+		CacheMaxObject:       int64Default(os.Getenv("ENTITY_CACHE_MAX_OBJECT"), 1<<20),
+		ChunkSize:            int64Default(os.Getenv("ENTITY_CHUNK_SIZE"), 0),
+		PurgeWorkers:         atoiDefault(os.Getenv("ENTITY_PURGE_WORKERS"), objectd.DefaultPurgeWorkers),
+	}
+	if storeOpts.Compression == "off" {
+		storeOpts.Compression = objectd.CompressionNone
+	}
+	if v, ok := os.LookupEnv("ENTITY_COMPRESSION_SKIP_TYPES"); ok {
+		storeOpts.CompressionSkipTypes = nil
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				storeOpts.CompressionSkipTypes = append(storeOpts.CompressionSkipTypes, t)
+			}
+		}
+	}
+	if v := os.Getenv("ENTITY_EC_DIRS"); v != "" {
+		for _, d := range strings.Split(v, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				storeOpts.ErasureDirs = append(storeOpts.ErasureDirs, d)
+			}
+		}
+		storeOpts.ErasureParityShards = atoiDefault(os.Getenv("ENTITY_EC_PARITY_SHARDS"), 2)
+		storeOpts.ErasureDataShards = atoiDefault(os.Getenv("ENTITY_EC_DATA_SHARDS"), len(storeOpts.ErasureDirs)-storeOpts.ErasureParityShards)
+	}
+	if endpoint := os.Getenv("ENTITY_BACKEND_S3_ENDPOINT"); endpoint != "" {
+		tr, err := outbound.NewTransport(os.Getenv("ENTITY_BACKEND_S3_CA_FILE"))
+		if err != nil {
+			return nil, fmt.Errorf("storage backend: %w", err)
+		}
+		backend, err := tier.NewBackend(tier.Target{
+			Endpoint:  endpoint,
+			Bucket:    os.Getenv("ENTITY_BACKEND_S3_BUCKET"),
+			Region:    os.Getenv("ENTITY_BACKEND_S3_REGION"),
+			AccessKey: os.Getenv("ENTITY_BACKEND_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("ENTITY_BACKEND_S3_SECRET_KEY"),
+		}, os.Getenv("ENTITY_BACKEND_S3_PREFIX"), dataDir, tr)
+		if err != nil {
+			return nil, fmt.Errorf("storage backend: %w", err)
+		}
+		storeOpts.Backend = backend
+	}
+	store, err := objectd.OpenStoreWithOptions(dataDir, storeOpts)
+	if err != nil {
+		return nil, err
+	}
+	if v := os.Getenv("ENTITY_SSE_MASTER_KEY"); v != "" {
+		key, err := hex.DecodeString(strings.TrimSpace(v))
+		if err == nil {
+			err = store.SetMasterKey(key)
+		}
+		if err != nil {
+			_ = store.Close()
+			return nil, fmt.Errorf("invalid ENTITY_SSE_MASTER_KEY: %w", err)
+		}
+	}
+	return store, nil
+}
+
+// prewarm reads the hottest objects of the previous run so their payloads
+// are in the page cache before clients ask for them.
+func prewarm(ctx context.Context, store *objectd.Store, entries []heat.Entry) {
+	warmed := 0
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		_, f, err := store.OpenObject(ctx, e.Bucket, e.Key)
+		if err != nil {
+			continue
+		}
+		_, err = io.Copy(io.Discard, f)
+		_ = f.Close()
+		if err == nil {
+			warmed++
+		}
+	}
+	log.Printf("pre-warmed %d hot objects", warmed)
 }
 
 func makeServerTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
@@ -146,6 +533,30 @@ func getEnv(k, d string) string {
 	return d
 }
 
+func durationDefault(v string, d time.Duration) time.Duration {
+	dur, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil {
+		return d
+	}
+	return dur
+}
+
+func int64Default(v string, d int64) int64 {
+	i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		return d
+	}
+	return i
+}
+
+func float64Default(v string, d float64) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return d
+	}
+	return f
+}
+
 func atoiDefault(v string, d int) int {
 	i, err := strconv.Atoi(strings.TrimSpace(v))
 	if err != nil {
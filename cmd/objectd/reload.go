@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/s3"
+	"github.com/mchenetz/entity/internal/scrub"
+	"github.com/mchenetz/entity/internal/tier"
+)
+
+// hotSettings are the settings a configuration reload applies without a
+// restart.
+var hotSettings = []string{
+	"ENTITY_MAX_OBJECT_SIZE",
+	"ENTITY_MAX_METADATA_SIZE",
+	"ENTITY_MAX_PARTS",
+	"ENTITY_REPLICATION_BANDWIDTH",
+	"ENTITY_REPLICATION_MAX_BACKLOG",
+	"ENTITY_SCRUB_BYTES_PER_SECOND",
+	"ENTITY_TIER_MIN_AGE",
+	"ENTITY_TIER_MIN_SIZE",
+	"ENTITY_TIER_BUCKETS",
+}
+
+// hotApplier returns the function that applies hotSettings to the running
+// components. Every value is parsed before any is applied; unlike at start,
+// an invalid value is an error rather than falling back to the default.
+func hotApplier(h *s3.Handler, cl *cluster.Cluster, scrubber *scrub.Scrubber, tierer *tier.Tierer) func(get func(string) string) error {
+	return func(get func(string) string) error {
+		p := settingParser{get: get}
+		limits := s3.Limits{
+			MaxObjectSize:   p.int64("ENTITY_MAX_OBJECT_SIZE", s3.DefaultMaxObjectSize),
+			MaxMetadataSize: int(p.int64("ENTITY_MAX_METADATA_SIZE", s3.DefaultMaxMetadataSize)),
+			MaxParts:        int(p.int64("ENTITY_MAX_PARTS", s3.DefaultMaxParts)),
+		}
+		bandwidth := p.int64("ENTITY_REPLICATION_BANDWIDTH", 0)
+		maxBacklog := p.int64("ENTITY_REPLICATION_MAX_BACKLOG", 0)
+		scrubRate := p.int64("ENTITY_SCRUB_BYTES_PER_SECOND", 10<<20)
+		tierMinAge := p.duration("ENTITY_TIER_MIN_AGE", 30*24*time.Hour)
+		tierMinSize := p.int64("ENTITY_TIER_MIN_SIZE", 1<<20)
+		var tierBuckets []string
+		for _, b := range strings.Split(get("ENTITY_TIER_BUCKETS"), ",") {
+			if b = strings.TrimSpace(b); b != "" {
+				tierBuckets = append(tierBuckets, b)
+			}
+		}
+		if p.err != nil {
+			return p.err
+		}
+		h.SetLimits(limits)
+		cl.SetReplicationLimits(bandwidth, maxBacklog)
+		if scrubber != nil {
+			scrubber.SetBytesPerSecond(scrubRate)
+		}
+		if tierer != nil {
+			tierer.SetRules(tierMinAge, tierMinSize, tierBuckets)
+		}
+		return nil
+	}
+}
+
+// settingParser parses settings strictly, keeping the first error.
+type settingParser struct {
+	get func(string) string
+	err error
+}
+
+func (p *settingParser) int64(key string, d int64) int64 {
+	v := strings.TrimSpace(p.get(key))
+	if v == "" {
+		return d
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("invalid %s: %q is not an integer", key, v)
+	}
+	return n
+}
+
+func (p *settingParser) duration(key string, d time.Duration) time.Duration {
+	v := strings.TrimSpace(p.get(key))
+	if v == "" {
+		return d
+	}
+	dur, err := time.ParseDuration(v)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("invalid %s: %q is not a duration", key, v)
+	}
+	return dur
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"strings"
+
+	pxv1 "github.com/mchenetz/entity/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const cosiAdminCertDir = "/etc/entity/admin-client"
+
+// adminClientCertsEnv lists the client certificate identities objectd
+// accepts on its admin port from spec.adminClientCerts.
+func adminClientCertsEnv(obj *pxv1.ObjectService) []corev1.EnvVar {
+	c := obj.Spec.AdminClientCerts
+	if c == nil || len(c.Identities) == 0 {
+		return nil
+	}
+	return []corev1.EnvVar{{Name: "ENTITY_ADMIN_CLIENT_CERTS", Value: strings.Join(c.Identities, ",")}}
+}
+
+// cosiAdminCertSecret returns the TLS secret the COSI driver authenticates
+// with instead of the admin token, if any.
+func cosiAdminCertSecret(obj *pxv1.ObjectService) string {
+	if c := obj.Spec.AdminClientCerts; c != nil {
+		return c.COSISecretName
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	pxv1 "github.com/mchenetz/entity/api/v1alpha1"
+	"github.com/mchenetz/entity/internal/admin"
+	"github.com/mchenetz/entity/pkg/adminclient"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const statusRefreshInterval = time.Minute
+
+func replicationCondition(obj *pxv1.ObjectService, status admin.ClusterStatus, err error) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               pxv1.ConditionReplicationPaused,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "StatusUnavailable",
+		ObservedGeneration: obj.Generation,
+	}
+	if err != nil {
+		cond.Message = err.Error()
+		return cond
+	}
+	paused := []string{}
+	for _, b := range status.Replication {
+		if b.Paused {
+			paused = append(paused, b.Bucket)
+		}
+	}
+	if len(paused) == 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "ReplicationActive"
+		return cond
+	}
+	cond.Status = metav1.ConditionTrue
+	cond.Reason = "BucketsPaused"
+	cond.Message = "replication paused for buckets: " + strings.Join(paused, ", ")
+	return cond
+}
+
+// diskCondition is true while the replica that answered, or any peer it
+// polled, refuses writes because its disk is above the high watermark.
+func diskCondition(obj *pxv1.ObjectService, status admin.ClusterStatus, err error) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               pxv1.ConditionDiskReadOnly,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "StatusUnavailable",
+		ObservedGeneration: obj.Generation,
+	}
+	if err != nil {
+		cond.Message = err.Error()
+		return cond
+	}
+	full := []string{}
+	if status.Disk.ReadOnly {
+		full = append(full, strconv.Itoa(status.Ordinal))
+	}
+	for _, p := range status.Peers {
+		if p.ReadOnly {
+			full = append(full, strconv.Itoa(p.Ordinal))
+		}
+	}
+	if len(full) == 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "DiskSpaceAvailable"
+		return cond
+	}
+	cond.Status = metav1.ConditionTrue
+	cond.Reason = "DiskFull"
+	cond.Message = "replicas refusing writes: " + strings.Join(full, ", ")
+	return cond
+}
+
+func (r *ObjectServiceReconciler) fetchClusterStatus(ctx context.Context, obj *pxv1.ObjectService) (admin.ClusterStatus, error) {
+	client, err := r.adminClient(ctx, obj)
+	if err != nil {
+		return admin.ClusterStatus{}, err
+	}
+	return client.ClusterStatus(ctx)
+}
+
+// adminClient returns a client for the objectd admin API of obj through its
+// service, using the admin token and the CA of the service certificate.
+func (r *ObjectServiceReconciler) adminClient(ctx context.Context, obj *pxv1.ObjectService) (*adminclient.Client, error) {
+	adminSecret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: obj.Spec.AdminSecretName, Namespace: obj.Namespace}, adminSecret); err != nil {
+		return nil, err
+	}
+	tlsSecret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: obj.Spec.TLSSecretName, Namespace: obj.Namespace}, tlsSecret); err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("https://%s.%s.svc.cluster.local:19000", obj.Name, obj.Namespace)
+	client := adminclient.New(url, string(adminSecret.Data["adminToken"]), string(tlsSecret.Data["ca.crt"]))
+	client.HTTPClient.Timeout = 10 * time.Second
+	return client, nil
+}
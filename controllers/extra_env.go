@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	pxv1 "github.com/mchenetz/entity/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// objectdTunables lists the objectd settings that may be passed through
+// spec.extraEnv before they have first-class CRD fields.
+var objectdTunables = map[string]bool{
+	"ENTITY_HEAT_TRACKED_KEYS":        true,
+	"ENTITY_METERING_RETENTION":       true,
+	"ENTITY_AUDIT_LOG_MAX_BYTES":      true,
+	"ENTITY_AUDIT_STDOUT":             true,
+	"ENTITY_HEAT_PREWARM":             true,
+	"ENTITY_HEAT_PREWARM_KEYS":        true,
+	"ENTITY_MAX_CLOCK_SKEW":           true,
+	"ENTITY_LOCAL_WRITE_THRESHOLD":    true,
+	"ENTITY_MAX_REQUEST_SKEW":         true,
+	"ENTITY_TRUSTED_PROXIES":          true,
+	"ENTITY_STANDBY_INTERVAL":         true,
+	"ENTITY_SIGV4_REPLAY_CACHE":       true,
+	"ENTITY_META_BACKEND":             true,
+	"ENTITY_COMPRESSION":              true,
+	"ENTITY_COMPRESSION_SKIP_TYPES":   true,
+	"ENTITY_EC_DIRS":                  true,
+	"ENTITY_EC_DATA_SHARDS":           true,
+	"ENTITY_EC_PARITY_SHARDS":         true,
+	"ENTITY_GC_INTERVAL":              true,
+	"ENTITY_GC_MIN_AGE":               true,
+	"ENTITY_GC_QUARANTINE":            true,
+	"ENTITY_SCRUB_INTERVAL":           true,
+	"ENTITY_SCRUB_BYTES_PER_SECOND":   true,
+	"ENTITY_FSCK_ON_START":            true,
+	"ENTITY_TIER_ENDPOINT":            true,
+	"ENTITY_TIER_BUCKET":              true,
+	"ENTITY_TIER_REGION":              true,
+	"ENTITY_TIER_PREFIX":              true,
+	"ENTITY_TIER_ACCESS_KEY":          true,
+	"ENTITY_TIER_SECRET_KEY":          true,
+	"ENTITY_TIER_CA_FILE":             true,
+	"ENTITY_TIER_MIN_AGE":             true,
+	"ENTITY_TIER_MIN_SIZE":            true,
+	"ENTITY_TIER_BUCKETS":             true,
+	"ENTITY_TIER_INTERVAL":            true,
+	"ENTITY_TIER_REQUIRE_RESTORE":     true,
+	"ENTITY_BACKEND_S3_ENDPOINT":      true,
+	"ENTITY_BACKEND_S3_BUCKET":        true,
+	"ENTITY_BACKEND_S3_REGION":        true,
+	"ENTITY_BACKEND_S3_PREFIX":        true,
+	"ENTITY_BACKEND_S3_ACCESS_KEY":    true,
+	"ENTITY_BACKEND_S3_SECRET_KEY":    true,
+	"ENTITY_BACKEND_S3_CA_FILE":       true,
+	"ENTITY_INLINE_THRESHOLD":         true,
+	"ENTITY_CACHE_SIZE":               true,
+	"ENTITY_CACHE_MAX_OBJECT":         true,
+	"ENTITY_CHUNK_SIZE":               true,
+	"ENTITY_DISK_CHECK_INTERVAL":      true,
+	"ENTITY_DISK_HIGH_WATERMARK":      true,
+	"ENTITY_DISK_LOW_WATERMARK":       true,
+	"ENTITY_PURGE_WORKERS":            true,
+	"ENTITY_EXPIRY_INTERVAL":          true,
+	"ENTITY_ANTI_ENTROPY_INTERVAL":    true,
+	"ENTITY_HINT_MAX_BYTES":           true,
+	"ENTITY_PLACEMENT_COPIES":         true,
+	"ENTITY_REPLICATION_MODE":         true,
+	"ENTITY_REPLICATION_PEER_TIMEOUT": true,
+	"ENTITY_WRITE_CONSISTENCY":        true,
+	"ENTITY_REPLICATION_BANDWIDTH":    true,
+	"ENTITY_REPLICATION_MAX_BACKLOG":  true,
+	"ENTITY_QUORUM_CHECK_INTERVAL":    true,
+	"ENTITY_HEALTH_CHECK_INTERVAL":    true,
+	"ENTITY_LIST_CONSISTENCY":         true,
+	"ENTITY_TOMBSTONE_RETENTION":      true,
+	"ENTITY_BOOTSTRAP":                true,
+	"ENTITY_BOOTSTRAP_WAIT":           true,
+	"ENTITY_FEDERATION_URL":           true,
+	"ENTITY_FEDERATION_TOKEN":         true,
+	"ENTITY_FEDERATION_CA_FILE":       true,
+	"ENTITY_FEDERATION_CERT_FILE":     true,
+	"ENTITY_FEDERATION_KEY_FILE":      true,
+	"ENTITY_FEDERATION_INTERVAL":      true,
+	"ENTITY_GOSSIP_SEEDS":             true,
+	"ENTITY_GOSSIP_INTERVAL":          true,
+	"ENTITY_ADVERTISE_URL":            true,
+	"ENTITY_NODE_ID":                  true,
+	"ENTITY_MEMBER_REMOVE_AFTER":      true,
+	"ENTITY_LEADER_LEASE_DURATION":    true,
+	"ENTITY_LEADER_REDIRECT":          true,
+	"ENTITY_LEADER_REDIRECT_URL":      true,
+	"ENTITY_CONFIG_FILE":              true,
+	"ENTITY_CONFIG_WATCH_INTERVAL":    true,
+}
+
+var cosiTunables = map[string]bool{
+	"ENTITY_COSI_GC_INTERVAL":  true,
+	"ENTITY_COSI_METRICS_ADDR": true,
+}
+
+var runtimeTunables = map[string]bool{
+	"GOMAXPROCS":  true,
+	"GOMEMLIMIT":  true,
+	"GOGC":        true,
+	"GODEBUG":     true,
+	"HTTP_PROXY":  true,
+	"HTTPS_PROXY": true,
+	"NO_PROXY":    true,
+}
+
+// mergeExtraEnv appends user supplied variables to the operator managed ones.
+// Variables that would override a managed name are dropped; names that are
+// neither tunables nor runtime settings are kept but reported as unknown.
+func mergeExtraEnv(managed, extra []corev1.EnvVar, tunables map[string]bool) (env []corev1.EnvVar, unknown, ignored []string) {
+	names := map[string]bool{}
+	for _, e := range managed {
+		names[e.Name] = true
+	}
+	env = append(env, managed...)
+	for _, e := range extra {
+		if names[e.Name] {
+			ignored = append(ignored, e.Name)
+			continue
+		}
+		if !tunables[e.Name] && !runtimeTunables[e.Name] {
+			unknown = append(unknown, e.Name)
+		}
+		names[e.Name] = true
+		env = append(env, e)
+	}
+	return env, unknown, ignored
+}
+
+func (r *ObjectServiceReconciler) extraEnvCondition(obj *pxv1.ObjectService, objectdEnv, cosiEnv []corev1.EnvVar) metav1.Condition {
+	_, unknown, ignored := mergeExtraEnv(objectdEnv, obj.Spec.ExtraEnv, objectdTunables)
+	_, cosiUnknown, cosiIgnored := mergeExtraEnv(cosiEnv, obj.Spec.COSIExtraEnv, cosiTunables)
+	unknown = append(unknown, cosiUnknown...)
+	ignored = append(ignored, cosiIgnored...)
+
+	cond := metav1.Condition{
+		Type:               pxv1.ConditionExtraEnvValid,
+		Status:             metav1.ConditionTrue,
+		Reason:             "AllKeysKnown",
+		ObservedGeneration: obj.Generation,
+	}
+	msgs := []string{}
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		cond.Reason = "ManagedKeysIgnored"
+		msgs = append(msgs, fmt.Sprintf("operator managed variables cannot be overridden: %s", strings.Join(ignored, ", ")))
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		if len(ignored) == 0 {
+			cond.Reason = "UnknownKeys"
+		}
+		msgs = append(msgs, fmt.Sprintf("unknown variables passed through: %s", strings.Join(unknown, ", ")))
+	}
+	if len(msgs) > 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Message = strings.Join(msgs, "; ")
+	}
+	return cond
+}
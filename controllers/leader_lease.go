@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+
+	pxv1 "github.com/mchenetz/entity/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// The objectd pods elect their leader with a Lease named after the
+// ObjectService. They run under a service account of their own that may
+// only read and write leases in the namespace.
+
+func objectdServiceAccount(obj *pxv1.ObjectService) string { return obj.Name + "-objectd" }
+
+func leaderLeaseName(obj *pxv1.ObjectService) string { return obj.Name + "-leader" }
+
+func (r *ObjectServiceReconciler) ensureObjectdRBAC(ctx context.Context, obj *pxv1.ObjectService) error {
+	name := objectdServiceAccount(obj)
+	meta := metav1.ObjectMeta{Name: name, Namespace: obj.Namespace, Labels: map[string]string{"app": obj.Name}}
+	rules := []rbacv1.PolicyRule{{
+		APIGroups: []string{"coordination.k8s.io"},
+		Resources: []string{"leases"},
+		Verbs:     []string{"get", "create", "update"},
+	}}
+	roleRef := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name}
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: obj.Namespace}}
+
+	if err := r.ensureOwned(ctx, obj, &corev1.ServiceAccount{ObjectMeta: meta}, nil); err != nil {
+		return err
+	}
+	role := &rbacv1.Role{ObjectMeta: meta, Rules: rules}
+	if err := r.ensureOwned(ctx, obj, role, func(cur client.Object) { cur.(*rbacv1.Role).Rules = rules }); err != nil {
+		return err
+	}
+	binding := &rbacv1.RoleBinding{ObjectMeta: meta, RoleRef: roleRef, Subjects: subjects}
+	return r.ensureOwned(ctx, obj, binding, func(cur client.Object) { cur.(*rbacv1.RoleBinding).Subjects = subjects })
+}
+
+// ensureOwned creates want if it does not exist, and otherwise applies
+// update to the existing object, if given, and saves it.
+func (r *ObjectServiceReconciler) ensureOwned(ctx context.Context, obj *pxv1.ObjectService, want client.Object, update func(client.Object)) error {
+	cur := want.DeepCopyObject().(client.Object)
+	err := r.Get(ctx, types.NamespacedName{Name: want.GetName(), Namespace: want.GetNamespace()}, cur)
+	if errors.IsNotFound(err) {
+		if err := controllerutil.SetControllerReference(obj, want, r.Scheme); err != nil {
+			return err
+		}
+		return r.Create(ctx, want)
+	}
+	if err != nil || update == nil {
+		return err
+	}
+	update(cur)
+	return r.Update(ctx, cur)
+}
@@ -16,6 +16,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -25,6 +26,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 type ObjectServiceReconciler struct {
@@ -76,9 +78,15 @@ func (r *ObjectServiceReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	if err := r.ensureService(ctx, obj); err != nil {
 		return ctrl.Result{}, err
 	}
+	if err := r.ensureObjectdRBAC(ctx, obj); err != nil {
+		return ctrl.Result{}, err
+	}
 	if err := r.ensureStatefulSet(ctx, obj); err != nil {
 		return ctrl.Result{}, err
 	}
+	if err := r.ensureZones(ctx, obj); err != nil {
+		return ctrl.Result{}, err
+	}
 	if err := r.ensureCOSIDeployment(ctx, obj); err != nil {
 		return ctrl.Result{}, err
 	}
@@ -91,10 +99,23 @@ func (r *ObjectServiceReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	obj.Status.Phase = "Ready"
 	obj.Status.ServiceEndpoint = endpoint
 	obj.Status.ObservedGeneration = obj.Generation
+	status, statusErr := r.fetchClusterStatus(ctx, obj)
+	meta.SetStatusCondition(&obj.Status.Conditions, replicationCondition(obj, status, statusErr))
+	meta.SetStatusCondition(&obj.Status.Conditions, diskCondition(obj, status, statusErr))
+	envCond := r.extraEnvCondition(obj, r.objectdEnv(obj), r.cosiEnv(obj))
+	if envCond.Status != metav1.ConditionTrue {
+		log.FromContext(ctx).Info("extraEnv warning", "message", envCond.Message)
+	}
+	meta.SetStatusCondition(&obj.Status.Conditions, envCond)
+	if obj.Spec.Standby != nil {
+		meta.SetStatusCondition(&obj.Status.Conditions, r.standbyCondition(ctx, obj))
+	} else {
+		meta.RemoveStatusCondition(&obj.Status.Conditions, pxv1.ConditionStandby)
+	}
 	if err := r.Status().Update(ctx, obj); err != nil {
 		return ctrl.Result{}, err
 	}
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: statusRefreshInterval}, nil
 }
 
 func (r *ObjectServiceReconciler) ensureTLS(ctx context.Context, obj *pxv1.ObjectService) error {
@@ -311,7 +332,15 @@ func (r *ObjectServiceReconciler) ensureAdminSecret(ctx context.Context, obj *px
 	s := &corev1.Secret{}
 	nn := types.NamespacedName{Name: obj.Spec.AdminSecretName, Namespace: obj.Namespace}
 	if err := r.Get(ctx, nn, s); err == nil {
-		return nil
+		if _, ok := s.Data["sseMasterKey"]; ok {
+			return nil
+		}
+		key, err := randomHex(32)
+		if err != nil {
+			return err
+		}
+		s.StringData = map[string]string{"sseMasterKey": key}
+		return r.Update(ctx, s)
 	} else if !errors.IsNotFound(err) {
 		return err
 	}
@@ -320,9 +349,13 @@ func (r *ObjectServiceReconciler) ensureAdminSecret(ctx context.Context, obj *px
 	if err != nil {
 		return err
 	}
+	key, err := randomHex(32)
+	if err != nil {
+		return err
+	}
 	s = &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{Name: obj.Spec.AdminSecretName, Namespace: obj.Namespace},
-		StringData: map[string]string{"adminToken": tok},
+		StringData: map[string]string{"adminToken": tok, "sseMasterKey": key},
 	}
 	if err := controllerutil.SetControllerReference(obj, s, r.Scheme); err != nil {
 		return err
@@ -346,6 +379,8 @@ func (r *ObjectServiceReconciler) ensureHeadlessService(ctx context.Context, obj
 				ClusterIP: "None",
 				Ports:     ports,
 				Selector:  map[string]string{"app": obj.Name},
+				// Peers must reach a pod that is still copying its data.
+				PublishNotReadyAddresses: true,
 			},
 		}
 		if err := controllerutil.SetControllerReference(obj, svc, r.Scheme); err != nil {
@@ -358,6 +393,7 @@ func (r *ObjectServiceReconciler) ensureHeadlessService(ctx context.Context, obj
 	}
 	svc.Spec.ClusterIP = "None"
 	svc.Spec.Ports = ports
+	svc.Spec.PublishNotReadyAddresses = true
 	svc.Spec.Selector = map[string]string{"app": obj.Name}
 	return r.Update(ctx, svc)
 }
@@ -408,7 +444,11 @@ func (r *ObjectServiceReconciler) ensureStatefulSet(ctx context.Context, obj *px
 	replicas := obj.Spec.Replicas
 	mountPath := obj.Spec.DataPath
 	headless := obj.Name + "-headless"
-	tlsDir := "/etc/entity/tls"
+	tlsDir := objectdTLSDir
+	domainsDir := objectdDomainsDir
+	optional := true
+	objectdEnv, _, _ := mergeExtraEnv(r.objectdEnv(obj), obj.Spec.ExtraEnv, objectdTunables)
+	readiness, startup, liveness := objectdProbes(obj)
 
 	template := appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{Name: obj.Name, Namespace: obj.Namespace},
@@ -419,34 +459,40 @@ func (r *ObjectServiceReconciler) ensureStatefulSet(ctx context.Context, obj *px
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{Labels: labels},
 				Spec: corev1.PodSpec{
+					ServiceAccountName:        objectdServiceAccount(obj),
+					NodeSelector:              obj.Spec.NodeSelector,
+					Tolerations:               obj.Spec.Tolerations,
+					Affinity:                  obj.Spec.Affinity,
+					TopologySpreadConstraints: topologySpread(obj, labels),
 					Containers: []corev1.Container{{
-						Name:    "objectd",
-						Image:   r.OperatorImage,
-						Command: []string{"/entity-objectd"},
-						Ports:   []corev1.ContainerPort{{ContainerPort: obj.Spec.Port, Name: "s3"}, {ContainerPort: 19000, Name: "admin"}},
-						Env: []corev1.EnvVar{
-							{Name: "ENTITY_DATA_DIR", Value: mountPath},
-							{Name: "ENTITY_S3_PORT", Value: fmt.Sprintf("%d", obj.Spec.Port)},
-							{Name: "ENTITY_ADMIN_PORT", Value: "19000"},
-							{Name: "ENTITY_SERVICE_NAME", Value: obj.Name},
-							{Name: "ENTITY_HEADLESS_SERVICE_NAME", Value: headless},
-							{Name: "ENTITY_REPLICAS", Value: fmt.Sprintf("%d", obj.Spec.Replicas)},
-							{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
-							{Name: "POD_NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
-							{Name: "ENTITY_TLS_ENABLED", Value: "true"},
-							{Name: "ENTITY_TLS_CERT_FILE", Value: tlsDir + "/tls.crt"},
-							{Name: "ENTITY_TLS_KEY_FILE", Value: tlsDir + "/tls.key"},
-							{Name: "ENTITY_TLS_CA_FILE", Value: tlsDir + "/ca.crt"},
-							{Name: "ENTITY_ADMIN_TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: obj.Spec.AdminSecretName}, Key: "adminToken"}}},
-						},
+						Name:           "objectd",
+						Image:          r.OperatorImage,
+						Command:        []string{"/entity-objectd"},
+						Resources:      obj.Spec.Resources,
+						Ports:          []corev1.ContainerPort{{ContainerPort: obj.Spec.Port, Name: "s3"}, {ContainerPort: 19000, Name: "admin"}},
+						Env:            objectdEnv,
+						ReadinessProbe: readiness,
+						StartupProbe:   startup,
+						LivenessProbe:  liveness,
 						VolumeMounts: []corev1.VolumeMount{
 							{Name: "data", MountPath: mountPath},
 							{Name: "tls", MountPath: tlsDir, ReadOnly: true},
+							{Name: "admin-tokens", MountPath: objectdAdminDir, ReadOnly: true},
 						},
 					}},
 					Volumes: []corev1.Volume{{
 						Name:         "tls",
 						VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: obj.Spec.TLSSecretName}},
+					}, {
+						// adminTokens lists further accepted tokens; mounted
+						// rather than set in the environment so that it can
+						// change without a restart.
+						Name: "admin-tokens",
+						VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+							SecretName: obj.Spec.AdminSecretName,
+							Items:      []corev1.KeyToPath{{Key: "adminTokens", Path: "tokens"}},
+							Optional:   &optional,
+						}},
 					}},
 				},
 			},
@@ -461,6 +507,44 @@ func (r *ObjectServiceReconciler) ensureStatefulSet(ctx context.Context, obj *px
 		},
 	}
 
+	pod := &template.Spec.Template.Spec
+	for i, secret := range obj.Spec.CustomDomainSecrets {
+		// Secret names may hold dots and run to 253 characters, which a
+		// volume name may not; the mount path keeps the secret's name.
+		name := fmt.Sprintf("domain-%d", i)
+		pod.Volumes = append(pod.Volumes, corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: secret}},
+		})
+		pod.Containers[0].VolumeMounts = append(pod.Containers[0].VolumeMounts, corev1.VolumeMount{Name: name, MountPath: domainsDir + "/" + secret, ReadOnly: true})
+	}
+	if o := obj.Spec.Outbound; o != nil && o.CABundleSecretName != "" {
+		pod.Volumes = append(pod.Volumes, corev1.Volume{
+			Name:         "outbound-ca",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: o.CABundleSecretName}},
+		})
+		pod.Containers[0].VolumeMounts = append(pod.Containers[0].VolumeMounts, corev1.VolumeMount{Name: "outbound-ca", MountPath: outboundCADir, ReadOnly: true})
+	}
+	if sb := obj.Spec.Standby; sb != nil && sb.CASecretName != "" {
+		pod.Volumes = append(pod.Volumes, corev1.Volume{
+			Name:         "standby-ca",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: sb.CASecretName}},
+		})
+		pod.Containers[0].VolumeMounts = append(pod.Containers[0].VolumeMounts, corev1.VolumeMount{Name: "standby-ca", MountPath: standbyCADir, ReadOnly: true})
+	}
+	if obj.Spec.ZoneSpread {
+		// Mounted rather than set in the environment so that zones learned
+		// after the pods were scheduled reach them without a restart.
+		pod.Volumes = append(pod.Volumes, corev1.Volume{
+			Name: "zones",
+			VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: zonesConfigMap(obj)},
+				Optional:             &optional,
+			}},
+		})
+		pod.Containers[0].VolumeMounts = append(pod.Containers[0].VolumeMounts, corev1.VolumeMount{Name: "zones", MountPath: objectdZonesDir, ReadOnly: true})
+	}
+
 	if errors.IsNotFound(err) {
 		if err := controllerutil.SetControllerReference(obj, &template, r.Scheme); err != nil {
 			return err
@@ -478,6 +562,76 @@ func (r *ObjectServiceReconciler) ensureStatefulSet(ctx context.Context, obj *px
 	return r.Update(ctx, sts)
 }
 
+const (
+	objectdTLSDir     = "/etc/entity/tls"
+	objectdDomainsDir = "/etc/entity/domains"
+	objectdAdminDir   = "/etc/entity/admin"
+)
+
+func (r *ObjectServiceReconciler) objectdEnv(obj *pxv1.ObjectService) []corev1.EnvVar {
+	headless := obj.Name + "-headless"
+	mountPath := obj.Spec.DataPath
+	tlsDir := objectdTLSDir
+	domainsDir := objectdDomainsDir
+	optional := true
+	env := []corev1.EnvVar{
+		{Name: "ENTITY_DATA_DIR", Value: mountPath},
+		{Name: "ENTITY_S3_PORT", Value: fmt.Sprintf("%d", obj.Spec.Port)},
+		{Name: "ENTITY_ADMIN_PORT", Value: "19000"},
+		{Name: "ENTITY_SERVICE_NAME", Value: obj.Name},
+		{Name: "ENTITY_HEADLESS_SERVICE_NAME", Value: headless},
+		{Name: "ENTITY_REPLICAS", Value: fmt.Sprintf("%d", obj.Spec.Replicas)},
+		{Name: "ENTITY_LEADER_LEASE", Value: leaderLeaseName(obj)},
+		{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
+		{Name: "POD_NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
+		{Name: "ENTITY_TLS_ENABLED", Value: "true"},
+		{Name: "ENTITY_TLS_CERT_FILE", Value: tlsDir + "/tls.crt"},
+		{Name: "ENTITY_TLS_KEY_FILE", Value: tlsDir + "/tls.key"},
+		{Name: "ENTITY_TLS_CA_FILE", Value: tlsDir + "/ca.crt"},
+		{Name: "ENTITY_DOMAIN_CERT_DIR", Value: domainsDir},
+		{Name: "ENTITY_ADMIN_TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: obj.Spec.AdminSecretName}, Key: "adminToken"}}},
+		{Name: "ENTITY_ADMIN_TOKEN_FILE", Value: objectdAdminDir + "/tokens"},
+		{Name: "ENTITY_SSE_MASTER_KEY", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: obj.Spec.AdminSecretName}, Key: "sseMasterKey", Optional: &optional}}},
+	}
+	if obj.Spec.MaxObjectSizeBytes > 0 {
+		env = append(env, corev1.EnvVar{Name: "ENTITY_MAX_OBJECT_SIZE", Value: fmt.Sprintf("%d", obj.Spec.MaxObjectSizeBytes)})
+	}
+	if obj.Spec.MaxMetadataBytes > 0 {
+		env = append(env, corev1.EnvVar{Name: "ENTITY_MAX_METADATA_SIZE", Value: fmt.Sprintf("%d", obj.Spec.MaxMetadataBytes)})
+	}
+	if obj.Spec.MaxHeaderBytes > 0 {
+		env = append(env, corev1.EnvVar{Name: "ENTITY_MAX_HEADER_BYTES", Value: fmt.Sprintf("%d", obj.Spec.MaxHeaderBytes)})
+	}
+	if obj.Spec.MaxParts > 0 {
+		env = append(env, corev1.EnvVar{Name: "ENTITY_MAX_PARTS", Value: fmt.Sprintf("%d", obj.Spec.MaxParts)})
+	}
+	env = append(env, standbyEnv(obj)...)
+	env = append(env, adminClientCertsEnv(obj)...)
+	env = append(env, zonesEnv(obj)...)
+	return append(env, outboundEnv(obj)...)
+}
+
+func (r *ObjectServiceReconciler) cosiEnv(obj *pxv1.ObjectService) []corev1.EnvVar {
+	endpoint := fmt.Sprintf("%s.%s.svc.cluster.local:%d", obj.Name, obj.Namespace, obj.Spec.Port)
+	adminURL := fmt.Sprintf("https://%s.%s.svc.cluster.local:19000", obj.Name, obj.Namespace)
+	env := []corev1.EnvVar{
+		{Name: "ENTITY_DRIVER_NAME", Value: "entity.io/s3"},
+		{Name: "ENTITY_S3_ENDPOINT", Value: endpoint},
+		{Name: "ENTITY_S3_REGION", Value: "us-east-1"},
+		{Name: "ENTITY_S3_CA_PEM", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: obj.Spec.TLSSecretName}, Key: "ca.crt"}}},
+		{Name: "ENTITY_ADMIN_URL", Value: adminURL},
+		{Name: "ENTITY_ADMIN_CA_PEM", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: obj.Spec.TLSSecretName}, Key: "ca.crt"}}},
+		{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
+		{Name: "POD_NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
+	}
+	if cosiAdminCertSecret(obj) != "" {
+		return append(env,
+			corev1.EnvVar{Name: "ENTITY_ADMIN_TLS_CERT_FILE", Value: cosiAdminCertDir + "/tls.crt"},
+			corev1.EnvVar{Name: "ENTITY_ADMIN_TLS_KEY_FILE", Value: cosiAdminCertDir + "/tls.key"})
+	}
+	return append(env, corev1.EnvVar{Name: "ENTITY_ADMIN_TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: obj.Spec.AdminSecretName}, Key: "adminToken"}}})
+}
+
 func (r *ObjectServiceReconciler) ensureCOSIDeployment(ctx context.Context, obj *pxv1.ObjectService) error {
 	name := obj.Name + "-cosi"
 	dep := &appsv1.Deployment{}
@@ -486,8 +640,7 @@ func (r *ObjectServiceReconciler) ensureCOSIDeployment(ctx context.Context, obj
 
 	replicas := int32(1)
 	labels := map[string]string{"app": name}
-	endpoint := fmt.Sprintf("%s.%s.svc.cluster.local:%d", obj.Name, obj.Namespace, obj.Spec.Port)
-	adminURL := fmt.Sprintf("https://%s.%s.svc.cluster.local:19000", obj.Name, obj.Namespace)
+	cosiEnv, _, _ := mergeExtraEnv(r.cosiEnv(obj), obj.Spec.COSIExtraEnv, cosiTunables)
 	template := appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: obj.Namespace},
 		Spec: appsv1.DeploymentSpec{
@@ -497,26 +650,28 @@ func (r *ObjectServiceReconciler) ensureCOSIDeployment(ctx context.Context, obj
 				ObjectMeta: metav1.ObjectMeta{Labels: labels},
 				Spec: corev1.PodSpec{
 					ServiceAccountName: "entity-cosi-driver",
+					NodeSelector:       obj.Spec.NodeSelector,
+					Tolerations:        obj.Spec.Tolerations,
+					Affinity:           obj.Spec.Affinity,
 					Containers: []corev1.Container{{
-						Name:    "cosidriver",
-						Image:   r.OperatorImage,
-						Command: []string{"/entity-cosidriver"},
-						Env: []corev1.EnvVar{
-							{Name: "ENTITY_DRIVER_NAME", Value: "entity.io/s3"},
-							{Name: "ENTITY_S3_ENDPOINT", Value: endpoint},
-							{Name: "ENTITY_S3_REGION", Value: "us-east-1"},
-							{Name: "ENTITY_S3_CA_PEM", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: obj.Spec.TLSSecretName}, Key: "ca.crt"}}},
-							{Name: "ENTITY_ADMIN_URL", Value: adminURL},
-							{Name: "ENTITY_ADMIN_CA_PEM", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: obj.Spec.TLSSecretName}, Key: "ca.crt"}}},
-							{Name: "ENTITY_ADMIN_TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: obj.Spec.AdminSecretName}, Key: "adminToken"}}},
-							{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
-							{Name: "POD_NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
-						},
+						Name:      "cosidriver",
+						Image:     r.OperatorImage,
+						Command:   []string{"/entity-cosidriver"},
+						Env:       cosiEnv,
+						Resources: obj.Spec.COSIResources,
 					}},
 				},
 			},
 		},
 	}
+	if secret := cosiAdminCertSecret(obj); secret != "" {
+		pod := &template.Spec.Template.Spec
+		pod.Volumes = append(pod.Volumes, corev1.Volume{
+			Name:         "admin-client-cert",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: secret}},
+		})
+		pod.Containers[0].VolumeMounts = append(pod.Containers[0].VolumeMounts, corev1.VolumeMount{Name: "admin-client-cert", MountPath: cosiAdminCertDir, ReadOnly: true})
+	}
 	if errors.IsNotFound(err) {
 		if err := controllerutil.SetControllerReference(obj, &template, r.Scheme); err != nil {
 			return err
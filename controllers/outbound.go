@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	pxv1 "github.com/mchenetz/entity/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const outboundCADir = "/etc/entity/outbound-ca"
+
+// outboundEnv translates spec.outbound into the standard proxy variables.
+// In-cluster service names are always appended to NO_PROXY so peer and
+// operator traffic never goes through the proxy.
+func outboundEnv(obj *pxv1.ObjectService) []corev1.EnvVar {
+	o := obj.Spec.Outbound
+	if o == nil {
+		return nil
+	}
+	env := []corev1.EnvVar{}
+	if o.HTTPProxy != "" {
+		env = append(env, corev1.EnvVar{Name: "HTTP_PROXY", Value: o.HTTPProxy})
+	}
+	if o.HTTPSProxy != "" {
+		env = append(env, corev1.EnvVar{Name: "HTTPS_PROXY", Value: o.HTTPSProxy})
+	}
+	if o.HTTPProxy != "" || o.HTTPSProxy != "" {
+		noProxy := []string{".svc", ".cluster.local", fmt.Sprintf("%s.%s", obj.Name, obj.Namespace)}
+		if o.NoProxy != "" {
+			noProxy = append([]string{o.NoProxy}, noProxy...)
+		}
+		env = append(env, corev1.EnvVar{Name: "NO_PROXY", Value: strings.Join(noProxy, ",")})
+	}
+	if o.CABundleSecretName != "" {
+		env = append(env, corev1.EnvVar{Name: "ENTITY_OUTBOUND_CA_FILE", Value: outboundCADir + "/ca.crt"})
+	}
+	return env
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	pxv1 "github.com/mchenetz/entity/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// objectdProbes returns the readiness, startup and liveness probes of the
+// objectd container with the overrides of spec.probes applied.
+func objectdProbes(obj *pxv1.ObjectService) (readiness, startup, liveness *corev1.Probe) {
+	get := func(path string) corev1.ProbeHandler {
+		return corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+			Path:   path,
+			Port:   intstr.FromString("admin"),
+			Scheme: corev1.URISchemeHTTPS,
+		}}
+	}
+	readiness = &corev1.Probe{ProbeHandler: get("/readyz"), PeriodSeconds: 5}
+	// Opening the store replays its journal, which can take a while on
+	// large volumes, so liveness only starts once /healthz first answered.
+	startup = &corev1.Probe{ProbeHandler: get("/healthz"), PeriodSeconds: 10, FailureThreshold: 60}
+	liveness = &corev1.Probe{ProbeHandler: get("/healthz"), PeriodSeconds: 10, TimeoutSeconds: 5, FailureThreshold: 3}
+	if p := obj.Spec.Probes; p != nil {
+		overrideProbe(readiness, p.Readiness)
+		overrideProbe(startup, p.Startup)
+		overrideProbe(liveness, p.Liveness)
+	}
+	return readiness, startup, liveness
+}
+
+// overrideProbe sets the fields of p that are set on o, leaving the others,
+// including the handler when o has none, as they are.
+func overrideProbe(p, o *corev1.Probe) {
+	if o == nil {
+		return
+	}
+	if o.ProbeHandler != (corev1.ProbeHandler{}) {
+		p.ProbeHandler = *o.ProbeHandler.DeepCopy()
+	}
+	for _, f := range []struct{ dst, src *int32 }{
+		{&p.InitialDelaySeconds, &o.InitialDelaySeconds},
+		{&p.TimeoutSeconds, &o.TimeoutSeconds},
+		{&p.PeriodSeconds, &o.PeriodSeconds},
+		{&p.SuccessThreshold, &o.SuccessThreshold},
+		{&p.FailureThreshold, &o.FailureThreshold},
+	} {
+		if *f.src != 0 {
+			*f.dst = *f.src
+		}
+	}
+	if o.TerminationGracePeriodSeconds != nil {
+		v := *o.TerminationGracePeriodSeconds
+		p.TerminationGracePeriodSeconds = &v
+	}
+}
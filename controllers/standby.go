@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	pxv1 "github.com/mchenetz/entity/api/v1alpha1"
+	"github.com/mchenetz/entity/internal/standby"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const standbyCADir = "/etc/entity/standby"
+
+func standbyEnv(obj *pxv1.ObjectService) []corev1.EnvVar {
+	sb := obj.Spec.Standby
+	if sb == nil {
+		return nil
+	}
+	env := []corev1.EnvVar{
+		{Name: "ENTITY_STANDBY_PRIMARY_URL", Value: sb.PrimaryURL},
+		{Name: "ENTITY_STANDBY_PRIMARY_TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: sb.TokenSecretName}, Key: "adminToken"}}},
+	}
+	if sb.CASecretName != "" {
+		env = append(env, corev1.EnvVar{Name: "ENTITY_STANDBY_PRIMARY_CA_FILE", Value: standbyCADir + "/ca.crt"})
+	}
+	return env
+}
+
+// standbyCondition reports the standby state and promotes the service once
+// spec.standby.promote is set.
+func (r *ObjectServiceReconciler) standbyCondition(ctx context.Context, obj *pxv1.ObjectService) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               pxv1.ConditionStandby,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "StatusUnavailable",
+		ObservedGeneration: obj.Generation,
+	}
+	st, err := r.fetchStandbyStatus(ctx, obj)
+	if err != nil {
+		cond.Message = err.Error()
+		return cond
+	}
+	if st.Standby && obj.Spec.Standby.Promote {
+		if err := r.promoteStandby(ctx, obj); err != nil {
+			cond.Message = "promotion failed: " + err.Error()
+			return cond
+		}
+		st.Standby, st.Promoted = false, true
+	}
+	if st.Promoted {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "Promoted"
+		cond.Message = "promoted to primary"
+		return cond
+	}
+	cond.Status = metav1.ConditionTrue
+	cond.Reason = "Following"
+	cond.Message = fmt.Sprintf("following %s, %d changes behind", st.PrimaryURL, st.LagSeq)
+	if st.LastError != "" {
+		cond.Reason = "SyncFailing"
+		cond.Message = st.LastError
+	}
+	return cond
+}
+
+func (r *ObjectServiceReconciler) fetchStandbyStatus(ctx context.Context, obj *pxv1.ObjectService) (standby.Status, error) {
+	client, err := r.adminClient(ctx, obj)
+	if err != nil {
+		return standby.Status{}, err
+	}
+	return client.StandbyStatus(ctx)
+}
+
+func (r *ObjectServiceReconciler) promoteStandby(ctx context.Context, obj *pxv1.ObjectService) error {
+	client, err := r.adminClient(ctx, obj)
+	if err != nil {
+		return err
+	}
+	return client.PromoteStandby(ctx)
+}
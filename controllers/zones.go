@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	pxv1 "github.com/mchenetz/entity/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// With spec.zoneSpread the objectd pods are spread over the zones of the
+// cluster, and the zone of each pod, read from the label of its node, is
+// kept in a ConfigMap that objectd rereads to spread the copies of each
+// object over zones as well.
+
+const objectdZonesDir = "/etc/entity/zones"
+
+func zonesConfigMap(obj *pxv1.ObjectService) string { return obj.Name + "-zones" }
+
+// topologySpread returns the spread constraints of the objectd pods: those
+// of the spec, and with zoneSpread one over zones unless the spec has one.
+func topologySpread(obj *pxv1.ObjectService, labels map[string]string) []corev1.TopologySpreadConstraint {
+	out := append([]corev1.TopologySpreadConstraint(nil), obj.Spec.TopologySpreadConstraints...)
+	if !obj.Spec.ZoneSpread {
+		return out
+	}
+	for _, c := range out {
+		if c.TopologyKey == corev1.LabelTopologyZone {
+			return out
+		}
+	}
+	// Pods whose volumes are bound to a zone can only start there, so an
+	// uneven spread is allowed rather than leaving them pending.
+	return append(out, corev1.TopologySpreadConstraint{
+		MaxSkew:           1,
+		TopologyKey:       corev1.LabelTopologyZone,
+		WhenUnsatisfiable: corev1.ScheduleAnyway,
+		LabelSelector:     &metav1.LabelSelector{MatchLabels: labels},
+	})
+}
+
+// zonesEnv points objectd at the zones file when zoneSpread is set.
+func zonesEnv(obj *pxv1.ObjectService) []corev1.EnvVar {
+	if !obj.Spec.ZoneSpread {
+		return nil
+	}
+	return []corev1.EnvVar{{Name: "ENTITY_ZONES_FILE", Value: objectdZonesDir + "/zones"}}
+}
+
+// ensureZones writes the zone of every scheduled objectd pod, by ordinal,
+// to the zones ConfigMap. Pods on nodes without a zone label are left out.
+func (r *ObjectServiceReconciler) ensureZones(ctx context.Context, obj *pxv1.ObjectService) error {
+	if !obj.Spec.ZoneSpread {
+		return nil
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(obj.Namespace), client.MatchingLabels{"app": obj.Name}); err != nil {
+		return err
+	}
+	var lines []string
+	for _, pod := range pods.Items {
+		ordinal, err := strconv.Atoi(strings.TrimPrefix(pod.Name, obj.Name+"-"))
+		if err != nil || pod.Spec.NodeName == "" {
+			continue
+		}
+		node := &corev1.Node{}
+		if err := client.IgnoreNotFound(r.Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, node)); err != nil {
+			return err
+		}
+		if zone := node.Labels[corev1.LabelTopologyZone]; zone != "" {
+			lines = append(lines, fmt.Sprintf("%d=%s", ordinal, zone))
+		}
+	}
+	sort.Strings(lines)
+	data := map[string]string{"zones": strings.Join(lines, "\n")}
+	meta := metav1.ObjectMeta{Name: zonesConfigMap(obj), Namespace: obj.Namespace, Labels: map[string]string{"app": obj.Name}}
+	return r.ensureOwned(ctx, obj, &corev1.ConfigMap{ObjectMeta: meta, Data: data}, func(cur client.Object) { cur.(*corev1.ConfigMap).Data = data })
+}
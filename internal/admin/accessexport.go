@@ -0,0 +1,172 @@
+package admin
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// accessExportVersion is the format of AccessExport.
+const accessExportVersion = 1
+
+// AccessExport holds access keys to be imported into another cluster. The
+// secrets are sealed with AES-256-GCM under a key the operator provides,
+// which is not part of the export.
+type AccessExport struct {
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exportedAt"`
+	Keys       []ExportedAccess `json:"keys"`
+}
+
+// ExportedAccess is an access key whose secret is sealed.
+type ExportedAccess struct {
+	AccessKey string `json:"accessKey"`
+	// EncryptedSecret is the base64 of the nonce followed by the sealed
+	// secret, authenticated together with AccessKey.
+	EncryptedSecret string          `json:"encryptedSecret"`
+	Bucket          string          `json:"bucket"`
+	ReadOnly        bool            `json:"readOnly"`
+	AllowedCIDRs    []string        `json:"allowedCIDRs,omitempty"`
+	Owner           string          `json:"owner,omitempty"`
+	CreatedAt       time.Time       `json:"createdAt,omitempty"`
+	ExpiresAt       time.Time       `json:"expiresAt,omitempty"`
+	Policy          *objectd.Policy `json:"policy,omitempty"`
+	objectd.RateLimit
+}
+
+// exportCipher returns the AEAD for an operator key of 64 hex characters.
+func exportCipher(key string) (cipher.AEAD, error) {
+	k, err := hex.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(k) != 32 {
+		return nil, errors.New("key must be 32 bytes in hex")
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// exportAccess returns every access key, or those of one bucket, with the
+// secrets sealed under the key in the body.
+func (h *Handler) exportAccess(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key    string `json:"key"`
+		Bucket string `json:"bucket"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	aead, err := exportCipher(req.Key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out := AccessExport{Version: accessExportVersion, ExportedAt: time.Now().UTC(), Keys: []ExportedAccess{}}
+	for _, k := range h.Store.ListAccess(r.Context()) {
+		if req.Bucket != "" && k.Bucket != req.Bucket {
+			continue
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sealed := aead.Seal(nonce, nonce, []byte(k.SecretKey), []byte(k.AccessKey))
+		out.Keys = append(out.Keys, ExportedAccess{AccessKey: k.AccessKey, EncryptedSecret: base64.StdEncoding.EncodeToString(sealed), Bucket: k.Bucket, ReadOnly: k.ReadOnly,
+			AllowedCIDRs: k.AllowedCIDRs, Owner: k.Owner, CreatedAt: k.CreatedAt, ExpiresAt: k.ExpiresAt, Policy: k.Policy, RateLimit: k.RateLimit})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// AccessImportResult is the outcome of an access key import.
+type AccessImportResult struct {
+	Imported int `json:"imported"`
+	// Skipped are the keys that already exist here; they are left as they
+	// are.
+	Skipped []string `json:"skipped,omitempty"`
+	// Failed are the keys that could not be imported, such as those whose
+	// bucket does not exist here, by access key.
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// importAccess adds the keys of an export made with exportAccess, with the
+// same IDs and secrets, and replicates them. Every secret is unsealed
+// before any key is added, so a wrong key imports nothing.
+func (h *Handler) importAccess(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key    string       `json:"key"`
+		Export AccessExport `json:"export"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if req.Export.Version != accessExportVersion {
+		http.Error(w, fmt.Sprintf("unsupported export version %d", req.Export.Version), http.StatusBadRequest)
+		return
+	}
+	aead, err := exportCipher(req.Key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	keys := make([]objectd.AccessKey, 0, len(req.Export.Keys))
+	for _, e := range req.Export.Keys {
+		sealed, err := base64.StdEncoding.DecodeString(e.EncryptedSecret)
+		if err != nil || len(sealed) < aead.NonceSize() || e.AccessKey == "" {
+			http.Error(w, "invalid export entry "+e.AccessKey, http.StatusBadRequest)
+			return
+		}
+		secret, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(e.AccessKey))
+		if err != nil {
+			http.Error(w, "cannot decrypt the secret of "+e.AccessKey+"; wrong key or altered export", http.StatusBadRequest)
+			return
+		}
+		keys = append(keys, objectd.AccessKey{AccessKey: e.AccessKey, SecretKey: string(secret), Bucket: e.Bucket, ReadOnly: e.ReadOnly, AllowedCIDRs: e.AllowedCIDRs,
+			Owner: e.Owner, CreatedAt: e.CreatedAt, ExpiresAt: e.ExpiresAt, Policy: e.Policy, RateLimit: e.RateLimit})
+	}
+	var res AccessImportResult
+	fail := func(ak string, err error) {
+		if res.Failed == nil {
+			res.Failed = map[string]string{}
+		}
+		res.Failed[ak] = err.Error()
+	}
+	for _, k := range keys {
+		if _, err := h.Store.LookupAccessKey(r.Context(), k.AccessKey); err == nil {
+			res.Skipped = append(res.Skipped, k.AccessKey)
+			continue
+		}
+		if err := h.Store.PutAccess(r.Context(), k); err != nil {
+			if errors.Is(err, objectd.ErrNotFound) {
+				err = fmt.Errorf("bucket %s not found", k.Bucket)
+			}
+			fail(k.AccessKey, err)
+			continue
+		}
+		if h.Cluster != nil && h.Cluster.Enabled() {
+			payload, _ := json.Marshal(k)
+			if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/access", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+				fail(k.AccessKey, err)
+				continue
+			}
+		}
+		res.Imported++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,127 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/audit"
+)
+
+// statusRecorder remembers the status written to the client.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// audited reports whether r is a change recorded in the audit log. Objects
+// pushed by a federated cluster are data, not administration, and are left
+// out.
+func audited(r *http.Request) bool {
+	return r.Method != http.MethodGet && r.Method != http.MethodHead && !strings.HasPrefix(r.URL.Path, "/admin/federation/objects/")
+}
+
+// recordAudit logs r with the status it was answered with.
+func (h *Handler) recordAudit(r *http.Request, w *statusRecorder) {
+	e := audit.Entry{Time: time.Now().UTC(), Method: r.Method, Path: r.URL.Path, Remote: r.RemoteAddr, Status: w.status}
+	e.Action, e.Target = auditAction(r)
+	actor, role, ok := h.Tokens.Identify(r)
+	e.Actor = actor
+	if ok {
+		e.Role = string(role)
+	}
+	switch {
+	case w.status == http.StatusUnauthorized || w.status == http.StatusForbidden:
+		e.Outcome = audit.OutcomeDenied
+	case w.status >= 400 || w.status == 0:
+		e.Outcome = audit.OutcomeFailure
+	default:
+		e.Outcome = audit.OutcomeSuccess
+	}
+	if err := h.Audit.Record(e); err != nil {
+		log.Printf("audit: failed to record %s %s: %v", r.Method, r.URL.Path, err)
+	}
+}
+
+// auditAction names the change r makes, such as bucket.delete or
+// cluster.decommission, and the bucket, access key or domain it targets.
+func auditAction(r *http.Request) (action, target string) {
+	segs := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/"), "/"), "/")
+	nouns := map[string]string{"buckets": "bucket", "access": "access", "domains": "domain", "uploads": "upload"}
+	noun, ok := nouns[segs[0]]
+	if !ok {
+		return strings.Join(segs, "."), ""
+	}
+	switch {
+	case noun == "bucket" && len(segs) > 3 && segs[2] == "objects":
+		return "object.delete", segs[1] + "/" + strings.Join(segs[3:], "/")
+	case noun == "access" && len(segs) == 2 && (segs[1] == "export" || segs[1] == "import"):
+		return noun + "." + segs[1], ""
+	case r.Method == http.MethodDelete && len(segs) == 1:
+		return noun + ".delete", r.URL.Query().Get("bucket")
+	case len(segs) == 1:
+		return noun + ".create", ""
+	case r.Method == http.MethodDelete:
+		return noun + ".delete", strings.Join(segs[1:], "/")
+	case len(segs) == 2:
+		return noun + ".update", segs[1]
+	default:
+		return noun + "." + strings.Join(segs[2:], "."), segs[1]
+	}
+}
+
+// auditLog returns a page of the newest audit entries, oldest first,
+// filtered by the since, action and actor query parameters. Pages go back
+// in time: the marker is the time of the oldest entry of the previous one.
+func (h *Handler) auditLog(w http.ResponseWriter, r *http.Request) {
+	if h.Audit == nil {
+		http.Error(w, "audit log disabled", http.StatusNotFound)
+		return
+	}
+	q := audit.Query{Action: r.URL.Query().Get("action"), Actor: r.URL.Query().Get("actor")}
+	if v := r.URL.Query().Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		q.Since = since
+	}
+	if v := r.URL.Query().Get("marker"); v != "" {
+		before, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, "invalid marker", http.StatusBadRequest)
+			return
+		}
+		q.Before = before
+	}
+	limit := pageLimit(r, 100)
+	// One more entry than asked tells whether older ones remain.
+	q.Limit = limit + 1
+	entries, err := h.Audit.Entries(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	next := ""
+	if len(entries) > limit {
+		entries = entries[1:]
+		next = entries[0].Time.Format(time.RFC3339Nano)
+	}
+	writePage(w, "entries", entries, next)
+}
@@ -0,0 +1,189 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// maxBatchOperations bounds the operations of one batch.
+const maxBatchOperations = 1000
+
+// Operations of a batch.
+const (
+	batchCreateBucket = "createBucket"
+	batchDeleteBucket = "deleteBucket"
+	batchCreateAccess = "createAccess"
+	batchDeleteAccess = "deleteAccess"
+)
+
+// batchOperation is one change of a batch. Name is the bucket of
+// createBucket and deleteBucket; the access request fields describe the key
+// of createAccess.
+type batchOperation struct {
+	Op                string `json:"op"`
+	Name              string `json:"name,omitempty"`
+	ReplicationFactor int    `json:"replicationFactor,omitempty"`
+	Force             bool   `json:"force,omitempty"`
+	AccessKey         string `json:"accessKey,omitempty"`
+	accessRequest
+}
+
+// validate checks op without applying it.
+func (op batchOperation) validate(atomic bool) error {
+	switch op.Op {
+	case batchCreateBucket:
+		if op.Name == "" || op.ReplicationFactor < 0 {
+			return errors.New("createBucket needs a name and a replicationFactor of at least 0")
+		}
+	case batchCreateAccess:
+		if _, err := op.options(); err != nil {
+			return err
+		}
+	case batchDeleteBucket, batchDeleteAccess:
+		if atomic {
+			return fmt.Errorf("%s cannot be undone and is not allowed in an atomic batch", op.Op)
+		}
+		if op.Op == batchDeleteBucket && op.Name == "" {
+			return errors.New("deleteBucket needs a name")
+		}
+		if op.Op == batchDeleteAccess && op.AccessKey == "" {
+			return errors.New("deleteAccess needs an accessKey")
+		}
+	default:
+		return fmt.Errorf("unknown op %q; use createBucket, deleteBucket, createAccess or deleteAccess", op.Op)
+	}
+	return nil
+}
+
+// batchResult is the outcome of one operation, in the order they were sent.
+type batchResult struct {
+	Op     string `json:"op"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Access is the key created by createAccess, with its secret.
+	Access *objectd.AccessKey `json:"access,omitempty"`
+	// RolledBack is set on operations undone because a later one of an
+	// atomic batch failed.
+	RolledBack bool `json:"rolledBack,omitempty"`
+
+	// existed is set by createBucket on a bucket that already existed,
+	// which a rollback must keep.
+	existed bool
+}
+
+// batch applies a list of bucket and access key changes in order. Every
+// operation is validated before any is applied. Without atomic, each is
+// applied on its own and reported with its status. With atomic, the first
+// failure undoes the operations applied before it and skips the rest; only
+// creations are allowed then, since deletions cannot be undone.
+func (h *Handler) batch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Atomic     bool             `json:"atomic"`
+		Operations []batchOperation `json:"operations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Operations) == 0 {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Operations) > maxBatchOperations {
+		http.Error(w, fmt.Sprintf("a batch holds at most %d operations", maxBatchOperations), http.StatusBadRequest)
+		return
+	}
+	results := make([]batchResult, len(req.Operations))
+	invalid := false
+	for i, op := range req.Operations {
+		results[i].Op = op.Op
+		if err := op.validate(req.Atomic); err != nil {
+			results[i].Status, results[i].Error = http.StatusBadRequest, err.Error()
+			invalid = true
+		}
+	}
+	if invalid {
+		writeBatch(w, http.StatusBadRequest, results)
+		return
+	}
+	for i, op := range req.Operations {
+		res := &results[i]
+		err := h.applyBatchOperation(r.Context(), op, res)
+		if err == nil {
+			continue
+		}
+		res.Status, res.Error = statusOf(err), err.Error()
+		if req.Atomic {
+			// The rollback must reach the peers even if the client is
+			// gone, or the batch stays half applied there.
+			h.rollBackBatch(context.WithoutCancel(r.Context()), req.Operations[:i], results[:i])
+			for j := i + 1; j < len(results); j++ {
+				results[j].Error = "skipped"
+			}
+			writeBatch(w, res.Status, results)
+			return
+		}
+	}
+	writeBatch(w, http.StatusOK, results)
+}
+
+func (h *Handler) applyBatchOperation(ctx context.Context, op batchOperation, res *batchResult) error {
+	switch op.Op {
+	case batchCreateBucket:
+		_, err := h.Store.GetBucket(ctx, op.Name)
+		res.existed = err == nil
+		if err := h.addBucket(ctx, op.Name, op.ReplicationFactor); err != nil {
+			return err
+		}
+		res.Status = http.StatusCreated
+	case batchDeleteBucket:
+		if err := h.removeBucket(ctx, op.Name, op.Force); err != nil {
+			return err
+		}
+		res.Status = http.StatusNoContent
+	case batchCreateAccess:
+		ak, err := h.addAccess(ctx, op.accessRequest)
+		if err != nil {
+			return err
+		}
+		res.Status, res.Access = http.StatusOK, &ak
+	case batchDeleteAccess:
+		if err := h.removeAccess(ctx, op.AccessKey); err != nil {
+			return err
+		}
+		res.Status = http.StatusNoContent
+	}
+	return nil
+}
+
+// rollBackBatch undoes the applied creations of an atomic batch, newest
+// first.
+func (h *Handler) rollBackBatch(ctx context.Context, ops []batchOperation, results []batchResult) {
+	for i := len(ops) - 1; i >= 0; i-- {
+		var err error
+		switch ops[i].Op {
+		case batchCreateBucket:
+			if results[i].existed {
+				continue
+			}
+			err = h.removeBucket(ctx, ops[i].Name, false)
+		case batchCreateAccess:
+			err = h.removeAccess(ctx, results[i].Access.AccessKey)
+		}
+		if err != nil {
+			log.Printf("batch: failed to roll back %s: %v", ops[i].Op, err)
+			results[i].Error = "rollback failed: " + err.Error()
+			continue
+		}
+		results[i].RolledBack = true
+		results[i].Access = nil
+	}
+}
+
+func writeBatch(w http.ResponseWriter, status int, results []batchResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"results": results})
+}
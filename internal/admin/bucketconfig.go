@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// bucketConfigPath reports whether p is /admin/buckets/{bucket}/config and
+// returns the bucket.
+func bucketConfigPath(p string) (string, bool) {
+	rest, ok := strings.CutPrefix(p, "/admin/buckets/")
+	if !ok {
+		return "", false
+	}
+	bucket, ok := strings.CutSuffix(rest, "/config")
+	return bucket, ok && bucket != "" && !strings.Contains(bucket, "/")
+}
+
+func (h *Handler) getBucketConfig(w http.ResponseWriter, r *http.Request) {
+	bucket, _ := bucketConfigPath(r.URL.Path)
+	cfg, err := h.Store.GetBucketConfig(r.Context(), bucket)
+	if errors.Is(err, objectd.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(cfg)
+}
+
+// putBucketConfig replaces a bucket's versioning, quota, public read and
+// default encryption settings and replicates them. Settings left out of the
+// body are reset, so clients send the whole configuration; only versioning
+// stays as it is when left out.
+func (h *Handler) putBucketConfig(w http.ResponseWriter, r *http.Request) {
+	bucket, _ := bucketConfigPath(r.URL.Path)
+	var cfg objectd.BucketConfig
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.PutBucketConfig(r.Context(), bucket, cfg); err != nil {
+		switch {
+		case errors.Is(err, objectd.ErrNotFound):
+			http.Error(w, "not found", http.StatusNotFound)
+		case errors.Is(err, objectd.ErrEncryptionNotConfigured):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		payload, _ := json.Marshal(cfg)
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/buckets/"+bucket+"/config", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	h.getBucketConfig(w, r)
+}
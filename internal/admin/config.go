@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (h *Handler) configStatus(w http.ResponseWriter, _ *http.Request) {
+	if h.Config == nil {
+		http.Error(w, "no configuration file; set ENTITY_CONFIG_FILE", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Config.Status())
+}
+
+// reloadConfig rereads the configuration file of this pod and applies the
+// settings that change without a restart. Each pod reads its own file, so
+// this is never proxied.
+func (h *Handler) reloadConfig(w http.ResponseWriter, _ *http.Request) {
+	if h.Config == nil {
+		http.Error(w, "no configuration file; set ENTITY_CONFIG_FILE", http.StatusNotFound)
+		return
+	}
+	st, err := h.Config.Reload()
+	if err != nil {
+		http.Error(w, "configuration not reloaded: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st)
+}
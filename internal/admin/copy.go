@@ -0,0 +1,155 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// maxCopyObjects bounds the objects one copy request copies.
+const maxCopyObjects = 1000
+
+// copyRequest copies SourceKey, or every key under SourcePrefix after
+// Marker, from SourceBucket to DestBucket. DestKey renames a single key;
+// DestPrefix replaces SourcePrefix in the copied keys, which keep their
+// names when it is not set.
+type copyRequest struct {
+	SourceBucket string  `json:"sourceBucket"`
+	SourceKey    string  `json:"sourceKey,omitempty"`
+	SourcePrefix string  `json:"sourcePrefix,omitempty"`
+	DestBucket   string  `json:"destBucket"`
+	DestKey      string  `json:"destKey,omitempty"`
+	DestPrefix   *string `json:"destPrefix,omitempty"`
+	Marker       string  `json:"marker,omitempty"`
+}
+
+// CopyFailure is a key a copy could not copy.
+type CopyFailure struct {
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// CopyResult is the outcome of a copy. When Truncated is set, the copy is
+// resumed by sending the same request with NextMarker as the marker.
+type CopyResult struct {
+	Copied     int           `json:"copied"`
+	Bytes      int64         `json:"bytes"`
+	Failed     []CopyFailure `json:"failed,omitempty"`
+	Truncated  bool          `json:"truncated"`
+	NextMarker string        `json:"nextMarker,omitempty"`
+}
+
+// copyObjects copies objects between buckets on the server. Copies share
+// the source bodies like an S3 copy does and are replicated like uploads.
+func (h *Handler) copyObjects(w http.ResponseWriter, r *http.Request) {
+	var req copyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SourceBucket == "" || req.DestBucket == "" {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if (req.SourceKey == "") == (req.SourcePrefix == "") {
+		http.Error(w, "set exactly one of sourceKey and sourcePrefix", http.StatusBadRequest)
+		return
+	}
+	if req.SourceKey != "" && (req.DestPrefix != nil || req.Marker != "") || req.SourcePrefix != "" && req.DestKey != "" {
+		http.Error(w, "destKey goes with sourceKey; destPrefix and marker go with sourcePrefix", http.StatusBadRequest)
+		return
+	}
+	for _, b := range []string{req.SourceBucket, req.DestBucket} {
+		if _, err := h.Store.GetBucket(r.Context(), b); err != nil {
+			http.Error(w, "bucket "+b+" not found", http.StatusNotFound)
+			return
+		}
+	}
+	destKey := func(key string) string {
+		switch {
+		case req.DestKey != "":
+			return req.DestKey
+		case req.DestPrefix != nil:
+			return *req.DestPrefix + strings.TrimPrefix(key, req.SourcePrefix)
+		}
+		return key
+	}
+	if req.SourceBucket == req.DestBucket {
+		// A destination inside the source prefix would be copied again on
+		// a later page.
+		if req.SourceKey != "" && destKey(req.SourceKey) == req.SourceKey || req.SourcePrefix != "" && strings.HasPrefix(destKey(req.SourcePrefix), req.SourcePrefix) {
+			http.Error(w, "the destination overlaps the source", http.StatusBadRequest)
+			return
+		}
+	}
+
+	result := CopyResult{}
+	if req.SourceKey != "" {
+		if _, err := h.Store.GetObjectMeta(r.Context(), req.SourceBucket, req.SourceKey); errors.Is(err, objectd.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		h.copyObject(r.Context(), req.SourceBucket, req.SourceKey, req.DestBucket, destKey(req.SourceKey), &result)
+		writeCopyResult(w, result)
+		return
+	}
+	metas, _, more, err := h.Store.ListObjectsV2(r.Context(), req.SourceBucket, req.SourcePrefix, req.Marker, maxCopyObjects)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, m := range metas {
+		h.copyObject(r.Context(), req.SourceBucket, m.Key, req.DestBucket, destKey(m.Key), &result)
+	}
+	if more && len(metas) > 0 {
+		result.Truncated, result.NextMarker = true, metas[len(metas)-1].Key
+	}
+	writeCopyResult(w, result)
+}
+
+// copyObject copies one object and replicates the copy, adding the outcome
+// to result.
+func (h *Handler) copyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, result *CopyResult) {
+	fail := func(err error) {
+		result.Failed = append(result.Failed, CopyFailure{Key: srcKey, Error: err.Error()})
+	}
+	src, err := h.Store.GetObjectMeta(ctx, srcBucket, srcKey)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if !src.Readable(time.Now()) {
+		fail(objectd.ErrInvalidObjectState)
+		return
+	}
+	obj, err := h.Store.CopyObject(ctx, srcBucket, srcKey, dstBucket, dstKey, objectd.PutOptions{})
+	if errors.Is(err, objectd.ErrObjectPending) && h.Cluster != nil {
+		// The source body is still held by a peer; pull it and copy again.
+		if h.Cluster.FetchObject(ctx, h.Store, srcBucket, srcKey) == nil {
+			obj, err = h.Store.CopyObject(ctx, srcBucket, srcKey, dstBucket, dstKey, objectd.PutOptions{})
+		}
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		deferred, err := h.Store.DeferReplication(ctx, dstBucket, objectd.ChangePutObject, dstKey)
+		if err == nil && !deferred {
+			err = h.Cluster.ReplicatePayload(ctx, http.MethodPut, "/_cluster/replicate/objects/"+dstBucket+"/"+dstKey, cluster.ObjectHeaders(obj), cluster.ObjectPayload(ctx, h.Store, obj))
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+	}
+	result.Copied++
+	result.Bytes += obj.Size
+}
+
+func writeCopyResult(w http.ResponseWriter, result CopyResult) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// listDomains returns a page of the custom domains in host order.
+func (h *Handler) listDomains(w http.ResponseWriter, r *http.Request) {
+	marker := r.URL.Query().Get("marker")
+	page, next := paginate(h.Store.ListDomains(r.Context()), pageLimit(r, maxPage), func(d objectd.Domain) bool { return d.Host > marker }, func(d objectd.Domain) string { return d.Host })
+	writePage(w, "domains", page, next)
+}
+
+func (h *Handler) putDomain(w http.ResponseWriter, r *http.Request) {
+	var req objectd.Domain
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Host == "" || req.Bucket == "" {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.PutDomain(r.Context(), req.Host, req.Bucket); err != nil {
+		if errors.Is(err, objectd.ErrNotFound) {
+			http.Error(w, "bucket not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		payload, _ := json.Marshal(req)
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/domains", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handler) deleteDomain(w http.ResponseWriter, r *http.Request) {
+	host := strings.TrimPrefix(r.URL.Path, "/admin/domains/")
+	if host == "" {
+		http.Error(w, "missing host", http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.DeleteDomain(r.Context(), host); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		if err := h.Cluster.Replicate(r.Context(), http.MethodDelete, "/_cluster/replicate/domains/"+host, nil, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// setObjectExpiry handles POST /admin/buckets/<bucket>/expiry. The body
+// names the key and either an absolute expiresAt or a duration after which
+// the object expires from now; neither clears the expiry.
+func (h *Handler) setObjectExpiry(w http.ResponseWriter, r *http.Request) {
+	bucket := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/buckets/"), "/expiry")
+	var req struct {
+		Key       string    `json:"key"`
+		ExpiresAt time.Time `json:"expiresAt"`
+		After     string    `json:"after"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Key == "" {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if req.After != "" {
+		d, err := time.ParseDuration(req.After)
+		if err != nil || d <= 0 || !req.ExpiresAt.IsZero() {
+			http.Error(w, "invalid after", http.StatusBadRequest)
+			return
+		}
+		req.ExpiresAt = time.Now().Add(d)
+	}
+	m, err := h.Store.SetObjectExpiry(r.Context(), bucket, req.Key, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, objectd.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		path := "/_cluster/replicate/expiry/" + bucket + "/" + req.Key
+		if !m.ExpiresAt.IsZero() {
+			path += "?at=" + url.QueryEscape(m.ExpiresAt.Format(time.RFC3339Nano))
+		}
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, path, nil, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	out := map[string]any{"bucket": bucket, "key": req.Key}
+	if !m.ExpiresAt.IsZero() {
+		out["expiresAt"] = m.ExpiresAt
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// exportBucket streams GET /admin/buckets/<bucket>/export as a tar archive,
+// compressed when compression=gzip or compression=zstd is given. Once the
+// archive has started, errors can only be logged and show up as a truncated
+// archive without export.json.
+func (h *Handler) exportBucket(w http.ResponseWriter, r *http.Request) {
+	bucket := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/buckets/"), "/export")
+	compression := r.URL.Query().Get("compression")
+	name, contentType := bucket+".tar", "application/x-tar"
+	switch compression {
+	case objectd.CompressionNone:
+	case objectd.CompressionGzip:
+		name, contentType = name+".gz", "application/gzip"
+	case objectd.CompressionZstd:
+		name, contentType = name+".zst", "application/zstd"
+	default:
+		http.Error(w, "invalid compression", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	sw := &startedWriter{w: w}
+	summary, err := h.Store.ExportBucket(r.Context(), bucket, sw, compression)
+	if err == nil {
+		return
+	}
+	if !sw.started {
+		w.Header().Del("Content-Disposition")
+		if errors.Is(err, objectd.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("export of bucket %s failed after %d objects: %v", bucket, summary.Objects, err)
+}
+
+// startedWriter records whether anything was written, and with it the
+// response status.
+type startedWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (s *startedWriter) Write(p []byte) (int, error) {
+	s.started = true
+	return s.w.Write(p)
+}
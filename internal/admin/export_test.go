@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// checkExportType exports a bucket with the given compression and checks the
+// archive's Content-Type and file name.
+func checkExportType(t *testing.T, compression, wantType, wantName string) {
+	t.Helper()
+	store := openStore(t)
+	ctx := context.Background()
+	if err := store.CreateBucket(ctx, "photos"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.PutObject(ctx, "photos", "a.txt", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	New(store, nil, nil).exportBucket(rec, httptest.NewRequest(http.MethodGet, "/admin/buckets/photos/export?compression="+compression, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("compression %q: status %d: %s", compression, rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != wantType {
+		t.Fatalf("compression %q: Content-Type %q, want %q", compression, got, wantType)
+	}
+	if got := rec.Header().Get("Content-Disposition"); !strings.Contains(got, `filename="`+wantName+`"`) {
+		t.Fatalf("compression %q: Content-Disposition %q, want %s", compression, got, wantName)
+	}
+}
+
+func TestExportContentType(t *testing.T) {
+	checkExportType(t, "", "application/x-tar", "photos.tar")
+	checkExportType(t, "gzip", "application/gzip", "photos.tar.gz")
+}
@@ -0,0 +1,9 @@
+//go:build zstd
+
+package admin
+
+import "testing"
+
+func TestExportContentTypeZstd(t *testing.T) {
+	checkExportType(t, "zstd", "application/zstd", "photos.tar.zst")
+}
@@ -0,0 +1,140 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// setFederation enables or disables replication of a bucket to the remote
+// cluster.
+func (h *Handler) setFederation(w http.ResponseWriter, r *http.Request, enabled bool) {
+	rest := strings.TrimPrefix(r.URL.Path, "/admin/buckets/")
+	name := rest[:strings.Index(rest, "/")]
+	if name == "" {
+		http.Error(w, "missing bucket", http.StatusBadRequest)
+		return
+	}
+	if enabled && h.Federation == nil {
+		http.Error(w, "no remote cluster is configured", http.StatusConflict)
+		return
+	}
+	if err := h.Store.SetFederation(r.Context(), name, enabled); err != nil {
+		if errors.Is(err, objectd.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		payload, _ := json.Marshal(map[string]bool{"enabled": enabled})
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/buckets/"+name+"/federation", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) federationStatus(w http.ResponseWriter, r *http.Request) {
+	if h.Federation == nil {
+		http.Error(w, "no remote cluster is configured", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Federation.Status(r.Context()))
+}
+
+// The handlers below run on the remote cluster and apply what a federated
+// source pushes. Over TLS the source has to present a client certificate
+// signed by the admin CA.
+
+func federatedClient(r *http.Request) bool {
+	return r.TLS == nil || len(r.TLS.VerifiedChains) > 0
+}
+
+func (h *Handler) receiveFederatedBucket(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/admin/federation/buckets/")
+	if name == "" {
+		http.Error(w, "missing bucket", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.Store.GetBucket(r.Context(), name); err == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := h.Store.CreateBucket(r.Context(), name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/buckets/"+name, nil, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) receiveFederatedObject(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/admin/federation/objects/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	bucket, key := parts[0], parts[1]
+	if r.Method == http.MethodDelete {
+		seq, err := h.Store.DeleteObject(r.Context(), bucket, key)
+		if err != nil && !errors.Is(err, objectd.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if h.Cluster != nil && h.Cluster.Enabled() {
+			if err := h.replicateFederated(r, bucket, key, objectd.ChangeDeleteObject, nil, seq); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	expires, _ := time.Parse(time.RFC3339Nano, r.Header.Get(cluster.ExpiresHeader))
+	opts := objectd.PutOptions{StorageClass: r.Header.Get("X-Amz-Storage-Class"), ContentType: r.Header.Get(cluster.ContentTypeHeader), ExpiresAt: expires}
+	m, err := h.Store.PutObjectWithOptions(r.Context(), bucket, key, r.Body, opts)
+	if err != nil {
+		if errors.Is(err, objectd.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		if err := h.replicateFederated(r, bucket, key, objectd.ChangePutObject, &m, 0); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// replicateFederated passes a pushed change on to the peers of the remote
+// cluster, or defers it while replication of the bucket is paused. A
+// delete, with m nil, is sent with the sequence number of the local one.
+func (h *Handler) replicateFederated(r *http.Request, bucket, key, op string, m *objectd.ObjectMeta, seq uint64) error {
+	ctx := r.Context()
+	if deferred, err := h.Store.DeferReplication(ctx, bucket, op, key); err != nil || deferred {
+		return err
+	}
+	path := "/_cluster/replicate/objects/" + bucket + "/" + key
+	if m == nil {
+		return h.Cluster.Replicate(ctx, http.MethodDelete, path, cluster.DeleteHeaders(seq), nil)
+	}
+	return h.Cluster.ReplicatePayload(ctx, http.MethodPut, path, cluster.ObjectHeaders(*m), cluster.ObjectPayload(ctx, h.Store, *m))
+}
@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// collectGarbage runs a garbage collection pass over this pod's data
+// directory. dryRun=true only reports orphans, quarantine=true moves them
+// aside instead of removing them and minAge overrides the default age below
+// which files are left alone.
+func (h *Handler) collectGarbage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var opts objectd.GCOptions
+	opts.DryRun, _ = strconv.ParseBool(q.Get("dryRun"))
+	opts.Quarantine, _ = strconv.ParseBool(q.Get("quarantine"))
+	if v := q.Get("minAge"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid minAge", http.StatusBadRequest)
+			return
+		}
+		opts.MinAge = d
+	}
+	report, err := h.Store.CollectGarbage(r.Context(), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// collectDanglingAccess removes the access keys of this pod that are bound
+// to a deleted bucket, or only reports them with dryRun=true. Keys that
+// still resolved are deleted on the peers as well.
+func (h *Handler) collectDanglingAccess(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	dangling, err := h.Store.CollectDanglingAccess(r.Context(), dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !dryRun && h.Cluster != nil && h.Cluster.Enabled() {
+		for _, d := range dangling {
+			if d.Reason != objectd.DanglingDeleted {
+				continue
+			}
+			if err := h.Cluster.Replicate(r.Context(), http.MethodDelete, "/_cluster/replicate/access/"+d.AccessKey, nil, nil); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+	}
+	if dangling == nil {
+		dangling = []objectd.DanglingAccess{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Dangling []objectd.DanglingAccess `json:"dangling"`
+		Removed  bool                     `json:"removed"`
+	}{dangling, !dryRun && len(dangling) > 0})
+}
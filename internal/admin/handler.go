@@ -1,37 +1,184 @@
 package admin
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mchenetz/entity/internal/audit"
 	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/config"
+	"github.com/mchenetz/entity/internal/federation"
+	"github.com/mchenetz/entity/internal/heat"
+	"github.com/mchenetz/entity/internal/metering"
+	"github.com/mchenetz/entity/internal/metrics"
 	"github.com/mchenetz/entity/internal/objectd"
+	"github.com/mchenetz/entity/internal/scrub"
+	"github.com/mchenetz/entity/internal/standby"
+	"github.com/mchenetz/entity/internal/tokens"
 )
 
 type Handler struct {
 	Store   *objectd.Store
-	Token   string
+	Tokens  *tokens.Set
 	Cluster *cluster.Cluster
+	Heat    *heat.Tracker
+	Meter   *metering.Meter
+	Standby *standby.Follower
+	Scrub   *scrub.Scrubber
+	// Federation is set when buckets can be replicated to a remote cluster.
+	Federation *federation.Replicator
+	// Audit, when set, records every change made through this replica.
+	Audit *audit.Log
+	// Config is set when settings are read from a configuration file.
+	Config *config.Reloader
 }
 
-func New(store *objectd.Store, token string, c *cluster.Cluster) *Handler {
-	return &Handler{Store: store, Token: token, Cluster: c}
+func New(store *objectd.Store, t *tokens.Set, c *cluster.Cluster) *Handler {
+	return &Handler{Store: store, Tokens: t, Cluster: c}
+}
+
+// statusError is a failed change with the status it is answered with.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+
+func failed(status int, err error) error { return &statusError{status: status, err: err} }
+
+// statusOf returns the status err is answered with.
+func statusOf(err error) int {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.status
+	}
+	return http.StatusInternalServerError
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Authorization") != "Bearer "+h.Token {
+	proxied := false
+	if h.Audit != nil && audited(r) {
+		rec := &statusRecorder{ResponseWriter: w}
+		w = rec
+		defer func() {
+			// The leader records changes proxied to it.
+			if !proxied {
+				h.recordAudit(r, rec)
+			}
+		}()
+	}
+	role, ok := h.Tokens.RequestRole(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if need := requiredRole(r); !role.Allows(need) {
+		http.Error(w, "token role "+string(role)+" may not do this; "+string(need)+" is required", http.StatusForbidden)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/admin/federation/") && r.URL.Path != "/admin/federation/status" && !federatedClient(r) {
+		http.Error(w, "client certificate required", http.StatusForbidden)
+		return
+	}
+	if h.replicatedMutation(r) && !h.Cluster.Writable(r.Context()) {
+		http.Error(w, cluster.ErrNoQuorum.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	if h.shouldProxyToLeader(r) {
+		proxied = true
+		if r.Header.Get("Authorization") == "" {
+			// Authenticated by its client certificate, which the leader
+			// does not see.
+			actor, _, _ := h.Tokens.Identify(r)
+			r.Header.Set("Authorization", "Bearer "+h.Tokens.Primary())
+			r.Header.Set(tokens.IdentityHeader, actor)
+		}
 		if err := h.Cluster.ProxyToLeader(w, r, "admin"); err != nil {
 			http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		}
 		return
 	}
+	if _, bucketConfig := bucketConfigPath(r.URL.Path); h.Store.Standby() && (r.Method == http.MethodPost || r.Method == http.MethodDelete || r.Method == http.MethodPut && bucketConfig) && r.URL.Path != "/admin/standby/promote" && r.URL.Path != "/admin/gc" && r.URL.Path != "/admin/config/reload" && r.URL.Path != "/admin/access/export" {
+		http.Error(w, "cluster is a standby; promote it before making changes", http.StatusConflict)
+		return
+	}
 
+	if _, rest, ok := trashPath(r.URL.Path); ok {
+		switch {
+		case r.Method == http.MethodGet && rest == "":
+			h.listTrash(w, r)
+		case r.Method == http.MethodPost && rest == "":
+			h.setBucketTrash(w, r)
+		case r.Method == http.MethodPost && strings.HasSuffix(rest, "/restore"):
+			h.restoreTrashed(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+	if _, key, ok := objectsPath(r.URL.Path); ok {
+		switch {
+		case r.Method == http.MethodGet && key == "":
+			h.listObjects(w, r)
+		case r.Method == http.MethodGet:
+			h.headObject(w, r)
+		case r.Method == http.MethodDelete && key != "":
+			h.deleteObject(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/admin/federation/buckets/") {
+		h.receiveFederatedBucket(w, r)
+		return
+	}
+	if (r.Method == http.MethodPut || r.Method == http.MethodDelete) && strings.HasPrefix(r.URL.Path, "/admin/federation/objects/") {
+		h.receiveFederatedObject(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/federation/status" {
+		h.federationStatus(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/admin/batch" {
+		h.batch(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/admin/copy" {
+		h.copyObjects(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/openapi.json" {
+		h.openAPI(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/uploads" {
+		h.listUploads(w, r)
+		return
+	}
+	if r.Method == http.MethodDelete && r.URL.Path == "/admin/uploads" {
+		h.abortUploads(w, r)
+		return
+	}
+	if r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/admin/uploads/") {
+		h.abortUpload(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/audit" {
+		h.auditLog(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/buckets" {
+		h.listBuckets(w, r)
+		return
+	}
 	if r.Method == http.MethodPost && r.URL.Path == "/admin/buckets" {
 		h.createBucket(w, r)
 		return
@@ -40,46 +187,278 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.deleteBucket(w, r)
 		return
 	}
+	if _, ok := bucketConfigPath(r.URL.Path); ok {
+		switch r.Method {
+		case http.MethodGet:
+			h.getBucketConfig(w, r)
+		case http.MethodPut:
+			h.putBucketConfig(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/admin/buckets/") && strings.HasSuffix(r.URL.Path, "/export") {
+		h.exportBucket(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/admin/buckets/") && strings.HasSuffix(r.URL.Path, "/stats") {
+		h.bucketStats(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/admin/buckets/") {
+		h.getBucket(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/access" {
+		h.listAccess(w, r)
+		return
+	}
 	if r.Method == http.MethodPost && r.URL.Path == "/admin/access" {
 		h.createAccess(w, r)
 		return
 	}
+	if r.Method == http.MethodPost && r.URL.Path == "/admin/access/export" {
+		h.exportAccess(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/admin/access/import" {
+		h.importAccess(w, r)
+		return
+	}
 	if r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/admin/access/") {
 		h.deleteAccess(w, r)
 		return
 	}
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/admin/buckets/") && strings.HasSuffix(r.URL.Path, "/rename") {
+		h.renameBucket(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/admin/buckets/") && strings.HasSuffix(r.URL.Path, "/expiry") {
+		h.setObjectExpiry(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/admin/buckets/") && strings.HasSuffix(r.URL.Path, "/federation/enable") {
+		h.setFederation(w, r, true)
+		return
+	}
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/admin/buckets/") && strings.HasSuffix(r.URL.Path, "/federation/disable") {
+		h.setFederation(w, r, false)
+		return
+	}
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/admin/buckets/") && strings.HasSuffix(r.URL.Path, "/replication-factor") {
+		h.setReplicationFactor(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/admin/buckets/") && strings.HasSuffix(r.URL.Path, "/write-consistency") {
+		h.setWriteConsistency(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/admin/buckets/") && strings.HasSuffix(r.URL.Path, "/replication/pause") {
+		h.setReplicationPaused(w, r, true)
+		return
+	}
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/admin/buckets/") && strings.HasSuffix(r.URL.Path, "/replication/resume") {
+		h.setReplicationPaused(w, r, false)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/conflicts" {
+		h.listConflicts(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/cluster/status" {
+		h.clusterStatus(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/info" {
+		h.info(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/config" {
+		h.configStatus(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/admin/config/reload" {
+		h.reloadConfig(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/maintenance" {
+		h.getMaintenance(w, r)
+		return
+	}
+	if r.Method == http.MethodPut && r.URL.Path == "/admin/maintenance" {
+		h.setMaintenance(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/admin/cluster/resync" {
+		h.resync(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/cluster/resync" {
+		h.listResyncs(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/admin/cluster/resync/") {
+		h.resyncStatus(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/admin/cluster/decommission" {
+		h.decommission(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/cluster/decommission" {
+		h.decommissionStatus(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/domains" {
+		h.listDomains(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/admin/domains" {
+		h.putDomain(w, r)
+		return
+	}
+	if r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/admin/domains/") {
+		h.deleteDomain(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/metrics" {
+		h.publishUsage(r)
+		metrics.Default.ServeHTTP(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/stats" {
+		h.stats(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/usage" {
+		h.usage(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/heat" {
+		h.hotObjects(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/logs/tail" {
+		h.tailLogs(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/errors" {
+		h.recentErrors(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/standby/changes" {
+		h.changeFeed(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/admin/standby/objects/") {
+		h.standbyObject(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/standby/status" {
+		h.standbyStatus(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/admin/standby/promote" {
+		h.promote(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/admin/scrub" {
+		h.scrubStatus(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/admin/gc" {
+		h.collectGarbage(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/admin/gc/access" {
+		h.collectDanglingAccess(w, r)
+		return
+	}
 	http.NotFound(w, r)
 }
 
+// requiredRole returns the role a token needs for r. Reads need read-only,
+// except those that return object data; changes to buckets, access keys and
+// domains need bucket-admin, except moving every access key between
+// clusters; everything else needs cluster-admin.
+func requiredRole(r *http.Request) tokens.Role {
+	p := r.URL.Path
+	switch {
+	case p == "/admin/audit" || p == "/admin/access/export" || p == "/admin/access/import" || p == "/admin/standby/changes" || strings.HasPrefix(p, "/admin/standby/objects/") || strings.HasPrefix(p, "/admin/federation/") && p != "/admin/federation/status":
+		return tokens.RoleClusterAdmin
+	case strings.HasPrefix(p, "/admin/buckets/") && strings.HasSuffix(p, "/export"):
+		return tokens.RoleBucketAdmin
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return tokens.RoleReadOnly
+	case p == "/admin/buckets" || strings.HasPrefix(p, "/admin/buckets/") || p == "/admin/access" || strings.HasPrefix(p, "/admin/access/") || p == "/admin/domains" || strings.HasPrefix(p, "/admin/domains/") || p == "/admin/uploads" || strings.HasPrefix(p, "/admin/uploads/") || p == "/admin/batch" || p == "/admin/copy":
+		return tokens.RoleBucketAdmin
+	}
+	return tokens.RoleClusterAdmin
+}
+
 func (h *Handler) shouldProxyToLeader(r *http.Request) bool {
+	return (h.replicatedMutation(r) || h.uploadsLeaderOnly(r)) && !h.Cluster.IsLeader(r.Context())
+}
+
+// replicatedMutation reports whether r changes state that the leader
+// replicates to the other pods.
+func (h *Handler) replicatedMutation(r *http.Request) bool {
 	if h.Cluster == nil || !h.Cluster.Enabled() || h.Cluster.IsInternalReplication(r) {
 		return false
 	}
-	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+	// Objects pushed by a federated cluster and bucket configurations are
+	// written with PUT.
+	_, bucketConfig := bucketConfigPath(r.URL.Path)
+	put := r.Method == http.MethodPut && (strings.HasPrefix(r.URL.Path, "/admin/federation/objects/") || bucketConfig)
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete && !put {
 		return false
 	}
-	return !h.Cluster.IsLeader(r.Context())
+	// Garbage collection cleans the local disk and metadata of whichever
+	// pod is asked, decommissioning drains it, a resync brings it up to date
+	// and a configuration reload rereads its own file.
+	switch r.URL.Path {
+	case "/admin/gc", "/admin/gc/access", "/admin/cluster/decommission", "/admin/cluster/resync", "/admin/config/reload":
+		return false
+	}
+	return !h.uploadsLeaderOnly(r)
 }
 
 func (h *Handler) createBucket(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name string `json:"name"`
+		Name              string `json:"name"`
+		ReplicationFactor int    `json:"replicationFactor"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || req.ReplicationFactor < 0 {
 		http.Error(w, "invalid body", http.StatusBadRequest)
 		return
 	}
-	if err := h.Store.CreateBucket(r.Context(), req.Name); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := h.addBucket(r.Context(), req.Name, req.ReplicationFactor); err != nil {
+		http.Error(w, err.Error(), statusOf(err))
 		return
 	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// addBucket creates a bucket and replicates it to the peers.
+func (h *Handler) addBucket(ctx context.Context, name string, copies int) error {
+	if err := h.Store.CreateBucket(ctx, name); err != nil {
+		return failed(http.StatusBadRequest, err)
+	}
+	if err := h.Store.SetBucketCopies(ctx, name, copies); err != nil {
+		return failed(http.StatusInternalServerError, err)
+	}
 	if h.Cluster != nil && h.Cluster.Enabled() {
-		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/buckets/"+req.Name, nil, nil); err != nil {
-			http.Error(w, err.Error(), http.StatusServiceUnavailable)
-			return
+		if err := h.Cluster.Replicate(ctx, http.MethodPost, "/_cluster/replicate/buckets/"+name, nil, nil); err != nil {
+			return failed(http.StatusServiceUnavailable, err)
+		}
+		if copies > 0 {
+			if err := h.replicateCopies(ctx, name, copies); err != nil {
+				return failed(http.StatusServiceUnavailable, err)
+			}
 		}
 	}
-	w.WriteHeader(http.StatusCreated)
+	return nil
 }
 
 func (h *Handler) deleteBucket(w http.ResponseWriter, r *http.Request) {
@@ -88,16 +467,68 @@ func (h *Handler) deleteBucket(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing bucket", http.StatusBadRequest)
 		return
 	}
-	if err := h.Store.DeleteBucket(r.Context(), name); err != nil {
+	// force=true purges the objects of the bucket first.
+	if err := h.removeBucket(r.Context(), name, r.URL.Query().Get("force") == "true"); err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeBucket deletes a bucket, purging its objects first if force is set,
+// and replicates the deletion to the peers.
+func (h *Handler) removeBucket(ctx context.Context, name string, force bool) error {
+	if force {
+		if _, err := h.Store.PurgeBucket(ctx, name); err != nil {
+			if errors.Is(err, objectd.ErrNotFound) {
+				return failed(http.StatusNotFound, errors.New("not found"))
+			}
+			return failed(http.StatusConflict, err)
+		}
+	}
+	if err := h.Store.DeleteBucket(ctx, name); err != nil {
 		if errors.Is(err, objectd.ErrNotFound) {
+			return failed(http.StatusNotFound, errors.New("not found"))
+		}
+		return failed(http.StatusConflict, err)
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		path := "/_cluster/replicate/buckets/" + name
+		if force {
+			path += "?force=true"
+		}
+		if err := h.Cluster.Replicate(ctx, http.MethodDelete, path, nil, nil); err != nil {
+			return failed(http.StatusServiceUnavailable, err)
+		}
+	}
+	return nil
+}
+
+// renameBucket gives a bucket a new name on every replica. Objects are not
+// copied; see objectd.Store.RenameBucket.
+func (h *Handler) renameBucket(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/buckets/"), "/rename")
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.RenameBucket(r.Context(), name, req.Name); err != nil {
+		switch {
+		case errors.Is(err, objectd.ErrNotFound):
 			http.Error(w, "not found", http.StatusNotFound)
-			return
+		case errors.Is(err, objectd.ErrBucketExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
 		}
-		http.Error(w, err.Error(), http.StatusConflict)
 		return
 	}
 	if h.Cluster != nil && h.Cluster.Enabled() {
-		if err := h.Cluster.Replicate(r.Context(), http.MethodDelete, "/_cluster/replicate/buckets/"+name, nil, nil); err != nil {
+		payload, _ := json.Marshal(map[string]string{"name": req.Name})
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/buckets/"+name+"/rename", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
 			http.Error(w, err.Error(), http.StatusServiceUnavailable)
 			return
 		}
@@ -105,29 +536,173 @@ func (h *Handler) deleteBucket(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handler) createAccess(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Bucket   string `json:"bucket"`
-		ReadOnly bool   `json:"readOnly"`
+func (h *Handler) getBucket(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/admin/buckets/")
+	if name == "" {
+		http.Error(w, "missing bucket", http.StatusBadRequest)
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Bucket == "" {
+	b, err := h.Store.GetBucket(r.Context(), name)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(b)
+}
+
+// listBuckets returns a page of the bucket summaries in name order.
+func (h *Handler) listBuckets(w http.ResponseWriter, r *http.Request) {
+	marker := r.URL.Query().Get("marker")
+	buckets, err := h.Store.ListBuckets(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page, next := paginate(buckets, pageLimit(r, maxPage), func(b objectd.Bucket) bool { return b.Name > marker }, func(b objectd.Bucket) string { return b.Name })
+	writePage(w, "buckets", page, next)
+}
+
+// accessRequest is the body of a request to create an access key.
+type accessRequest struct {
+	Bucket       string   `json:"bucket"`
+	ReadOnly     bool     `json:"readOnly"`
+	AllowedCIDRs []string `json:"allowedCIDRs"`
+	Owner        string   `json:"owner"`
+	// ExpiresAt is an RFC 3339 time.
+	ExpiresAt time.Time       `json:"expiresAt"`
+	Policy    json.RawMessage `json:"policy"`
+	objectd.RateLimit
+}
+
+// options validates req and returns the options it asks for.
+func (req accessRequest) options() (objectd.AccessOptions, error) {
+	if req.Bucket == "" {
+		return objectd.AccessOptions{}, errors.New("invalid body")
+	}
+	if req.RequestsPerSecond < 0 || req.BytesPerSecond < 0 {
+		return objectd.AccessOptions{}, errors.New("rate limits must not be negative")
+	}
+	var policy *objectd.Policy
+	if len(req.Policy) > 0 && string(req.Policy) != "null" {
+		p, err := objectd.ParsePolicy(req.Policy)
+		if err != nil {
+			return objectd.AccessOptions{}, err
+		}
+		policy = p
+	}
+	return objectd.AccessOptions{ReadOnly: req.ReadOnly, AllowedCIDRs: req.AllowedCIDRs, RateLimit: req.RateLimit, Owner: req.Owner, ExpiresAt: req.ExpiresAt, Policy: policy}, nil
+}
+
+func (h *Handler) createAccess(w http.ResponseWriter, r *http.Request) {
+	var req accessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid body", http.StatusBadRequest)
 		return
 	}
-	ak, err := h.Store.CreateAccess(r.Context(), req.Bucket, req.ReadOnly)
+	ak, err := h.addAccess(r.Context(), req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), statusOf(err))
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ak)
+}
+
+// addAccess creates an access key and replicates it to the peers.
+func (h *Handler) addAccess(ctx context.Context, req accessRequest) (objectd.AccessKey, error) {
+	opts, err := req.options()
+	if err != nil {
+		return objectd.AccessKey{}, failed(http.StatusBadRequest, err)
+	}
+	ak, err := h.Store.CreateAccessWithOptions(ctx, req.Bucket, opts)
+	if err != nil {
+		return objectd.AccessKey{}, failed(http.StatusBadRequest, err)
+	}
 	if h.Cluster != nil && h.Cluster.Enabled() {
 		payload, _ := json.Marshal(ak)
-		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/access", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
-			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		if err := h.Cluster.Replicate(ctx, http.MethodPost, "/_cluster/replicate/access", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+			return objectd.AccessKey{}, failed(http.StatusServiceUnavailable, err)
+		}
+	}
+	return ak, nil
+}
+
+// listAccess returns a page of the access keys without their secrets, in
+// access key order, only those of the bucket query parameter if it is set.
+// With unusedFor, only keys not used for that long, and created before
+// that if never used, are listed. Their last use is merged from every
+// replica unless local is true.
+func (h *Handler) listAccess(w http.ResponseWriter, r *http.Request) {
+	keys := h.Store.ListAccess(r.Context())
+	bucket := r.URL.Query().Get("bucket")
+	now := time.Now()
+	var unusedSince time.Time
+	if v := r.URL.Query().Get("unusedFor"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, "unusedFor must be a duration such as 720h", http.StatusBadRequest)
 			return
 		}
+		unusedSince = now.Add(-d)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(ak)
+	used := h.Store.AccessLastUsed()
+	if h.Cluster != nil && r.URL.Query().Get("local") != "true" {
+		var missing []int
+		used, missing = h.Cluster.AccessLastUsed(r.Context(), h.Store)
+		// Keys used only through peers that did not answer may look
+		// unused; the header names those peers.
+		ords := make([]string, len(missing))
+		for i, o := range missing {
+			ords[i] = strconv.Itoa(o)
+		}
+		if len(ords) > 0 {
+			w.Header().Set("X-ENTITY-Missing-Peers", strings.Join(ords, ","))
+		}
+	}
+	type accessEntry struct {
+		AccessKey    string          `json:"accessKey"`
+		Bucket       string          `json:"bucket"`
+		ReadOnly     bool            `json:"readOnly"`
+		AllowedCIDRs []string        `json:"allowedCIDRs,omitempty"`
+		Owner        string          `json:"owner,omitempty"`
+		CreatedAt    *time.Time      `json:"createdAt,omitempty"`
+		ExpiresAt    *time.Time      `json:"expiresAt,omitempty"`
+		Expired      bool            `json:"expired,omitempty"`
+		Policy       *objectd.Policy `json:"policy,omitempty"`
+		objectd.RateLimit
+		LastUsed *objectd.LastUsed `json:"lastUsed,omitempty"`
+	}
+	out := make([]accessEntry, 0, len(keys))
+	for _, k := range keys {
+		if bucket != "" && k.Bucket != bucket {
+			continue
+		}
+		k.LastUsed = nil
+		if u, ok := used[k.AccessKey]; ok {
+			k.LastUsed = &u
+		}
+		if !unusedSince.IsZero() {
+			last := k.CreatedAt
+			if k.LastUsed != nil {
+				last = k.LastUsed.Time
+			}
+			if !last.Before(unusedSince) {
+				continue
+			}
+		}
+		e := accessEntry{AccessKey: k.AccessKey, Bucket: k.Bucket, ReadOnly: k.ReadOnly, AllowedCIDRs: k.AllowedCIDRs, Owner: k.Owner, Expired: k.Expired(now), Policy: k.Policy, RateLimit: k.RateLimit, LastUsed: k.LastUsed}
+		if created := k.CreatedAt; !created.IsZero() {
+			e.CreatedAt = &created
+		}
+		if expires := k.ExpiresAt; !expires.IsZero() {
+			e.ExpiresAt = &expires
+		}
+		out = append(out, e)
+	}
+	marker := r.URL.Query().Get("marker")
+	page, next := paginate(out, pageLimit(r, maxPage), func(e accessEntry) bool { return e.AccessKey > marker }, func(e accessEntry) string { return e.AccessKey })
+	writePage(w, "accessKeys", page, next)
 }
 
 func (h *Handler) deleteAccess(w http.ResponseWriter, r *http.Request) {
@@ -136,15 +711,54 @@ func (h *Handler) deleteAccess(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing access key", http.StatusBadRequest)
 		return
 	}
-	if err := h.Store.DeleteAccess(r.Context(), accessKey); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := h.removeAccess(r.Context(), accessKey); err != nil {
+		http.Error(w, err.Error(), statusOf(err))
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeAccess deletes an access key and replicates the deletion.
+func (h *Handler) removeAccess(ctx context.Context, accessKey string) error {
+	if err := h.Store.DeleteAccess(ctx, accessKey); err != nil {
+		return failed(http.StatusInternalServerError, err)
+	}
 	if h.Cluster != nil && h.Cluster.Enabled() {
-		if err := h.Cluster.Replicate(r.Context(), http.MethodDelete, "/_cluster/replicate/access/"+accessKey, nil, nil); err != nil {
-			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		if err := h.Cluster.Replicate(ctx, http.MethodDelete, "/_cluster/replicate/access/"+accessKey, nil, nil); err != nil {
+			return failed(http.StatusServiceUnavailable, err)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) scrubStatus(w http.ResponseWriter, _ *http.Request) {
+	if h.Scrub == nil {
+		http.Error(w, "scrubbing disabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Scrub.Status())
+}
+
+func (h *Handler) hotObjects(w http.ResponseWriter, r *http.Request) {
+	if h.Heat == nil {
+		http.Error(w, "heat tracking disabled", http.StatusNotFound)
+		return
+	}
+	// The ranking has no stable key to resume after, so the marker is the
+	// rank the next page starts at.
+	start := 0
+	if v := r.URL.Query().Get("marker"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid marker", http.StatusBadRequest)
 			return
 		}
+		start = n
 	}
-	w.WriteHeader(http.StatusNoContent)
+	hot := h.Heat.Hot(0)
+	start = min(start, len(hot))
+	limit := pageLimit(r, 100)
+	page, next := paginate(hot[start:], limit, func(heat.Entry) bool { return true }, func(heat.Entry) string { return strconv.Itoa(start + limit) })
+	writePage(w, "objects", page, next)
 }
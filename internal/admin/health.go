@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// The probes answer without a token, so that the kubelet can call them.
+// They report states only, never bucket names, keys or counts.
+
+// probeStatus is the body of /healthz and /readyz.
+type probeStatus struct {
+	OK            bool   `json:"ok"`
+	Store         string `json:"store"`
+	Disk          string `json:"disk"`
+	Quorum        string `json:"quorum"`
+	Bootstrapping bool   `json:"bootstrapping,omitempty"`
+	Maintenance   bool   `json:"maintenance,omitempty"`
+}
+
+func (h *Handler) probe(ctx context.Context) probeStatus {
+	st := probeStatus{Store: "ok", Disk: "ok", Quorum: "disabled", Maintenance: h.Store.InMaintenance()}
+	if err := h.Store.Healthy(); err != nil {
+		log.Printf("health check: %v", err)
+		st.Store = "unavailable"
+	}
+	if h.Store.ReadOnly() {
+		st.Disk = "read-only"
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		st.Quorum = "ok"
+		if !h.Cluster.Writable(ctx) {
+			st.Quorum = "lost"
+		}
+		st.Bootstrapping = h.Cluster.Bootstrapping()
+	}
+	return st
+}
+
+// ServeHealth answers liveness probes: 503 once the store can no longer be
+// read, which a restart may fix.
+func (h *Handler) ServeHealth(w http.ResponseWriter, r *http.Request) {
+	st := h.probe(r.Context())
+	st.OK = st.Store == "ok"
+	writeProbe(w, st)
+}
+
+// ServeReady answers readiness probes: 503 while the store cannot be read
+// or the replica is still copying a peer. A full disk, lost quorum or
+// maintenance is reported but keeps the replica ready, since it still
+// serves reads; the S3 handler refuses the writes.
+func (h *Handler) ServeReady(w http.ResponseWriter, r *http.Request) {
+	st := h.probe(r.Context())
+	st.OK = st.Store == "ok" && !st.Bootstrapping
+	writeProbe(w, st)
+}
+
+func writeProbe(w http.ResponseWriter, st probeStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !st.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(st)
+}
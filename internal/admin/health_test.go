@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+func openStore(t *testing.T) *objectd.Store {
+	t.Helper()
+	store, err := objectd.OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+// A pod in maintenance still serves reads, so it stays in the S3 service
+// and only reports the mode.
+func TestReadyInMaintenance(t *testing.T) {
+	store := openStore(t)
+	if _, err := store.SetMaintenance(true, "kernel upgrade"); err != nil {
+		t.Fatal(err)
+	}
+	h := New(store, nil, nil)
+	for path, serve := range map[string]http.HandlerFunc{"/healthz": h.ServeHealth, "/readyz": h.ServeReady} {
+		rec := httptest.NewRecorder()
+		serve(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, want 200", path, rec.Code)
+		}
+		var st probeStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+			t.Fatal(err)
+		}
+		if !st.OK || !st.Maintenance {
+			t.Fatalf("%s: got %+v, want ok and maintenance", path, st)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// startedAt approximates when the process started.
+var startedAt = time.Now().UTC()
+
+// Info describes the objectd build and the pod that answers.
+type Info struct {
+	// Version is the module version stamped by go build, such as v1.4.0,
+	// or "(devel)" for a build outside a tagged checkout.
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	CommitTime string `json:"commitTime,omitempty"`
+	// Modified is set when the checkout had uncommitted changes.
+	Modified  bool     `json:"modified,omitempty"`
+	GoVersion string   `json:"goVersion"`
+	BuildTags []string `json:"buildTags,omitempty"`
+
+	Hostname      string    `json:"hostname,omitempty"`
+	Ordinal       int       `json:"ordinal"`
+	Replicas      int       `json:"replicas"`
+	Leader        int       `json:"leader"`
+	StartedAt     time.Time `json:"startedAt"`
+	UptimeSeconds int64     `json:"uptimeSeconds"`
+
+	Store objectd.StoreInfo `json:"store"`
+	// Features reports which optional features are built in and turned
+	// on, by name.
+	Features map[string]bool `json:"features"`
+}
+
+// info answers with the build, the cluster position and the enabled
+// features of this pod, for support tooling.
+func (h *Handler) info(w http.ResponseWriter, r *http.Request) {
+	st, err := h.Store.Info()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := Info{Version: "(devel)", Replicas: 1, StartedAt: startedAt, UptimeSeconds: int64(time.Since(startedAt).Seconds()), Store: st}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		out.Version, out.GoVersion = bi.Main.Version, bi.GoVersion
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				out.Commit = s.Value
+			case "vcs.time":
+				out.CommitTime = s.Value
+			case "vcs.modified":
+				out.Modified = s.Value == "true"
+			case "-tags":
+				out.BuildTags = strings.Split(s.Value, ",")
+				sort.Strings(out.BuildTags)
+			}
+		}
+	}
+	out.Hostname, _ = os.Hostname()
+	if h.Cluster != nil {
+		cs := h.Cluster.Status(r.Context())
+		out.Ordinal, out.Replicas, out.Leader = cs.Ordinal, cs.Replicas, cs.Leader
+	}
+	out.Features = h.features(r, st)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func (h *Handler) features(r *http.Request, st objectd.StoreInfo) map[string]bool {
+	clustered := h.Cluster != nil && h.Cluster.Enabled()
+	return map[string]bool{
+		"tls":              r.TLS != nil,
+		"clustering":       clustered,
+		"gossip":           clustered && h.Cluster.Gossip(),
+		"asyncReplication": clustered && h.Cluster.Async(),
+		"encryption":       st.Encryption,
+		"compression":      st.Compression != objectd.CompressionNone,
+		"erasureCoding":    st.Erasure != "",
+		"chunking":         st.ChunkSize > 0,
+		"readCache":        st.CacheBytes > 0,
+		"sqliteMetadata":   st.MetaBackend == objectd.MetaBackendSQLite,
+		"standby":          h.Store.Standby(),
+		"federation":       h.Federation != nil,
+		"scrubbing":        h.Scrub != nil,
+		"metering":         h.Meter != nil,
+		"heatTracking":     h.Heat != nil,
+		"audit":            h.Audit != nil,
+		"configReload":     h.Config != nil,
+	}
+}
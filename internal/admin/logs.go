@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mchenetz/entity/internal/logbuf"
+)
+
+// tailLogs streams log entries of this pod as server-sent events, starting
+// with the last ?backlog= lines.
+func (h *Handler) tailLogs(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	backlog, err := strconv.Atoi(r.URL.Query().Get("backlog"))
+	if err != nil || backlog < 0 {
+		backlog = 100
+	}
+	entries, cancel := logbuf.Default.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if backlog > 0 {
+		for _, e := range logbuf.Default.Tail(backlog) {
+			writeEvent(w, e)
+		}
+	}
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-entries:
+			writeEvent(w, e)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e logbuf.Entry) {
+	b, _ := json.Marshal(e)
+	_, _ = fmt.Fprintf(w, "data: %s\n\n", b)
+}
+
+// recentErrors returns the newest errors logged by this pod, oldest first,
+// like the audit log: passing the marker, the time of the first entry
+// returned, gets the errors before them.
+func (h *Handler) recentErrors(w http.ResponseWriter, r *http.Request) {
+	var before time.Time
+	if v := r.URL.Query().Get("marker"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, "invalid marker", http.StatusBadRequest)
+			return
+		}
+		before = t
+	}
+	entries := logbuf.Default.Errors(0)
+	if !before.IsZero() {
+		entries = entries[:sort.Search(len(entries), func(i int) bool { return !entries[i].Time.Before(before) })]
+	}
+	limit := pageLimit(r, 100)
+	next := ""
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+		next = entries[0].Time.Format(time.RFC3339Nano)
+	}
+	if entries == nil {
+		entries = []logbuf.Entry{}
+	}
+	writePage(w, "errors", entries, next)
+}
@@ -0,0 +1,37 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+func (h *Handler) getMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Store.Maintenance())
+}
+
+// setMaintenance turns maintenance mode of this pod on or off. Like the
+// probes, it concerns the pod that answers and is never proxied.
+func (h *Handler) setMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled *bool  `json:"enabled"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		http.Error(w, "invalid body; want {\"enabled\":true|false}", http.StatusBadRequest)
+		return
+	}
+	m, err := h.Store.SetMaintenance(*req.Enabled, req.Reason)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if *req.Enabled {
+		log.Printf("maintenance mode on: %s", req.Reason)
+	} else {
+		log.Printf("maintenance mode off")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(m)
+}
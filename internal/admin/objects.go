@@ -0,0 +1,161 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// ObjectInfo describes an object to operators browsing a bucket without its
+// credentials.
+type ObjectInfo struct {
+	Key          string     `json:"key"`
+	Size         int64      `json:"size"`
+	ETag         string     `json:"etag"`
+	LastModified time.Time  `json:"lastModified"`
+	ContentType  string     `json:"contentType,omitempty"`
+	StorageClass string     `json:"storageClass,omitempty"`
+	Encryption   string     `json:"encryption,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	// Offloaded is set when the body only lives in the cold tier.
+	Offloaded bool `json:"offloaded,omitempty"`
+	// Pending is set while the body still lives only on the peer that
+	// received it.
+	Pending bool   `json:"pending,omitempty"`
+	Seq     uint64 `json:"seq"`
+}
+
+func objectInfo(m objectd.ObjectMeta) ObjectInfo {
+	o := ObjectInfo{Key: m.Key, Size: m.Size, ETag: m.ETag, LastModified: m.ModTime, ContentType: m.ContentType, StorageClass: m.StorageClass,
+		Encryption: m.Encryption, Offloaded: m.Offloaded(), Pending: m.Pending, Seq: m.Seq}
+	if !m.ExpiresAt.IsZero() {
+		o.ExpiresAt = &m.ExpiresAt
+	}
+	return o
+}
+
+// ObjectPage is a page of a bucket listing. With a delimiter, the keys
+// sharing a prefix up to it are rolled up into CommonPrefixes.
+type ObjectPage struct {
+	Objects        []ObjectInfo `json:"objects"`
+	CommonPrefixes []string     `json:"commonPrefixes,omitempty"`
+	Truncated      bool         `json:"truncated"`
+	NextMarker     string       `json:"nextMarker,omitempty"`
+}
+
+// objectsPath splits /admin/buckets/{bucket}/objects[/{key}].
+func objectsPath(p string) (bucket, key string, ok bool) {
+	rest, ok := strings.CutPrefix(p, "/admin/buckets/")
+	if !ok {
+		return "", "", false
+	}
+	bucket, rest, ok = strings.Cut(rest, "/objects")
+	if !ok || bucket == "" || strings.Contains(bucket, "/") || rest != "" && !strings.HasPrefix(rest, "/") {
+		return "", "", false
+	}
+	return bucket, strings.TrimPrefix(rest, "/"), true
+}
+
+// listObjects returns up to limit objects and common prefixes of a bucket
+// after marker, in key order, filtered by prefix and rolled up at
+// delimiter. It reads the metadata of the pod that answers.
+func (h *Handler) listObjects(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := objectsPath(r.URL.Path)
+	q := r.URL.Query()
+	prefix, delimiter, marker := q.Get("prefix"), q.Get("delimiter"), q.Get("marker")
+	limit := pageLimit(r, maxPage)
+	// A marker that is a common prefix resumes after all of its keys.
+	skip := ""
+	if delimiter != "" && strings.HasSuffix(marker, delimiter) && strings.HasPrefix(marker, prefix) {
+		skip = marker
+	}
+	page := ObjectPage{Objects: []ObjectInfo{}}
+	token := marker
+	for n := 0; ; {
+		metas, _, more, err := h.Store.ListObjectsV2(r.Context(), bucket, prefix, token, maxPage)
+		if errors.Is(err, objectd.ErrNotFound) {
+			http.Error(w, "bucket not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, m := range metas {
+			token = m.Key
+			if skip != "" && strings.HasPrefix(m.Key, skip) {
+				continue
+			}
+			if n == limit {
+				page.Truncated = true
+				writeObjectPage(w, page)
+				return
+			}
+			n++
+			if i := strings.Index(m.Key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+				cp := m.Key[:len(prefix)+i+len(delimiter)]
+				page.CommonPrefixes = append(page.CommonPrefixes, cp)
+				page.NextMarker, skip = cp, cp
+				continue
+			}
+			page.Objects = append(page.Objects, objectInfo(m))
+			page.NextMarker, skip = m.Key, ""
+		}
+		if !more {
+			page.NextMarker = ""
+			writeObjectPage(w, page)
+			return
+		}
+	}
+}
+
+func writeObjectPage(w http.ResponseWriter, page ObjectPage) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+func (h *Handler) headObject(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := objectsPath(r.URL.Path)
+	m, err := h.Store.GetObjectMeta(r.Context(), bucket, key)
+	if errors.Is(err, objectd.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(objectInfo(m))
+}
+
+// deleteObject deletes an object the way an S3 DELETE would, through the
+// bucket's trash if it has one, and replicates the deletion.
+func (h *Handler) deleteObject(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := objectsPath(r.URL.Path)
+	if _, err := h.Store.GetObjectMeta(r.Context(), bucket, key); errors.Is(err, objectd.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	seq, err := h.Store.DeleteObject(r.Context(), bucket, key)
+	if err != nil && !errors.Is(err, objectd.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		deferred, err := h.Store.DeferReplication(r.Context(), bucket, objectd.ChangeDeleteObject, key)
+		if err == nil && !deferred {
+			err = h.Cluster.Replicate(r.Context(), http.MethodDelete, "/_cluster/replicate/objects/"+bucket+"/"+key, cluster.DeleteHeaders(seq), nil)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
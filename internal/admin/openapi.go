@@ -0,0 +1,17 @@
+package admin
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec describes the admin API. Keep it in step with the routes in
+// ServeHTTP and with pkg/adminclient.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func (h *Handler) openAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
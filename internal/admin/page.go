@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Listings that grow with the deployment are returned a page at a time: at
+// most limit entries after marker, with truncated set and nextMarker
+// naming the last entry when more follow. Passing nextMarker as marker
+// returns the next page.
+
+// maxPage bounds the entries returned by one page of a listing.
+const maxPage = 1000
+
+// pageLimit returns the limit query parameter of r, or def if it is not a
+// positive number. It is never more than maxPage.
+func pageLimit(r *http.Request, def int) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		return def
+	}
+	return min(limit, maxPage)
+}
+
+// paginate returns up to limit entries of s starting at the first one that
+// follows the marker, and the marker of the next page if more follow. s is
+// in listing order, so that follows is false up to some entry and true
+// from there on.
+func paginate[T any](s []T, limit int, follows func(T) bool, marker func(T) string) ([]T, string) {
+	s = s[sort.Search(len(s), func(i int) bool { return follows(s[i]) }):]
+	if len(s) <= limit {
+		if s == nil {
+			s = []T{}
+		}
+		return s, ""
+	}
+	return s[:limit], marker(s[limit-1])
+}
+
+// writePage writes a page of a listing with its entries under field.
+func writePage(w http.ResponseWriter, field string, entries any, next string) {
+	page := map[string]any{field: entries, "truncated": next != ""}
+	if next != "" {
+		page["nextMarker"] = next
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,277 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+type ClusterStatus struct {
+	cluster.Status
+	Replication []objectd.ReplicationStatus `json:"replication"`
+	Disk        objectd.DiskStatus          `json:"disk"`
+}
+
+func (h *Handler) setReplicationPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	rest := strings.TrimPrefix(r.URL.Path, "/admin/buckets/")
+	name := rest[:strings.Index(rest, "/")]
+	if name == "" {
+		http.Error(w, "missing bucket", http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.SetReplicationPaused(r.Context(), name, paused); err != nil {
+		if errors.Is(err, objectd.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		payload, _ := json.Marshal(map[string]bool{"paused": paused})
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/buckets/"+name+"/replication", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if !paused {
+			if err := h.catchUpReplication(r.Context(), name); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setReplicationFactor sets how many replicas keep the bodies of a bucket's
+// objects. Zero goes back to the cluster default. Objects already stored
+// move to their new owners in the background.
+func (h *Handler) setReplicationFactor(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/buckets/"), "/replication-factor")
+	var req struct {
+		ReplicationFactor int `json:"replicationFactor"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ReplicationFactor < 0 {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.SetBucketCopies(r.Context(), name, req.ReplicationFactor); err != nil {
+		if errors.Is(err, objectd.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.replicateCopies(r.Context(), name, req.ReplicationFactor); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setWriteConsistency sets the default write consistency of requests to a
+// bucket. An empty level goes back to the cluster default.
+func (h *Handler) setWriteConsistency(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/buckets/"), "/write-consistency")
+	var req struct {
+		WriteConsistency string `json:"writeConsistency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	var level cluster.Consistency
+	if req.WriteConsistency != "" {
+		var err error
+		if level, err = cluster.ParseConsistency(req.WriteConsistency); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := h.Store.SetBucketConsistency(r.Context(), name, string(level)); err != nil {
+		if errors.Is(err, objectd.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		payload, _ := json.Marshal(map[string]string{"consistency": string(level)})
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/buckets/"+name+"/consistency", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) replicateCopies(ctx context.Context, bucket string, copies int) error {
+	if h.Cluster == nil || !h.Cluster.Enabled() {
+		return nil
+	}
+	payload, _ := json.Marshal(map[string]int{"copies": copies})
+	return h.Cluster.Replicate(ctx, http.MethodPost, "/_cluster/replicate/buckets/"+bucket+"/copies", map[string]string{"Content-Type": "application/json"}, payload)
+}
+
+// catchUpReplication replays the changes deferred while a bucket was paused,
+// sending each touched key's current state to the peers.
+func (h *Handler) catchUpReplication(ctx context.Context, bucket string) error {
+	n := h.Store.PendingChangeCount(ctx, bucket)
+	changes, err := h.Store.PendingChanges(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		path := "/_cluster/replicate/objects/" + bucket + "/" + c.Key
+		meta, seq, err := h.Store.GetObjectMetaOrClock(ctx, bucket, c.Key)
+		if errors.Is(err, objectd.ErrNotFound) {
+			if err := h.Cluster.Replicate(ctx, http.MethodDelete, path, cluster.DeleteHeaders(seq), nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := h.Cluster.ReplicatePayload(ctx, http.MethodPut, path, cluster.ObjectHeaders(meta), cluster.ObjectPayload(ctx, h.Store, meta)); err != nil {
+			return err
+		}
+	}
+	return h.Store.AckPendingChanges(ctx, bucket, n)
+}
+
+// listConflicts returns a page of the replicated changes this replica
+// discarded in favour of a later write, newest first. The marker is the time
+// of the last conflict returned.
+func (h *Handler) listConflicts(w http.ResponseWriter, r *http.Request) {
+	var before time.Time
+	if v := r.URL.Query().Get("marker"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, "invalid marker", http.StatusBadRequest)
+			return
+		}
+		before = t
+	}
+	page, next := paginate(h.Store.Conflicts(r.Context()), pageLimit(r, maxPage), func(c objectd.Conflict) bool { return before.IsZero() || c.At.Before(before) },
+		func(c objectd.Conflict) string { return c.At.Format(time.RFC3339Nano) })
+	writePage(w, "conflicts", page, next)
+}
+
+func (h *Handler) clusterStatus(w http.ResponseWriter, r *http.Request) {
+	out := ClusterStatus{Replication: h.Store.ReplicationStatuses(r.Context()), Disk: h.Store.DiskStatus()}
+	if h.Cluster != nil {
+		out.Status = h.Cluster.Status(r.Context())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// decommission starts draining this pod ahead of a scale-down. It is served
+// by the pod being removed, never proxied to the leader.
+func (h *Handler) decommission(w http.ResponseWriter, r *http.Request) {
+	if h.Cluster == nil {
+		http.Error(w, "clustering is not enabled", http.StatusBadRequest)
+		return
+	}
+	if err := h.Cluster.Decommission(r.Context(), h.Store); err != nil {
+		if errors.Is(err, cluster.ErrDecommissioning) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(h.Cluster.Decommissioning())
+}
+
+// resync starts an anti-entropy pass of this pod against its peers, only
+// for the bucket query parameter if it is set. Like decommissioning, it is
+// never proxied to the leader.
+func (h *Handler) resync(w http.ResponseWriter, r *http.Request) {
+	if h.Cluster == nil {
+		http.Error(w, "clustering is not enabled", http.StatusBadRequest)
+		return
+	}
+	job, err := h.Cluster.Resync(r.Context(), h.Store, r.URL.Query().Get("bucket"))
+	if err != nil {
+		switch {
+		case errors.Is(err, cluster.ErrResyncing):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, objectd.ErrNotFound):
+			http.Error(w, "bucket not found", http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/admin/cluster/resync/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// listResyncs returns a page of the resyncs this pod remembers, oldest
+// first. Like for uploads, the marker holds the request time and ID of a
+// job.
+func (h *Handler) listResyncs(w http.ResponseWriter, r *http.Request) {
+	var after cluster.ResyncJob
+	if v := r.URL.Query().Get("marker"); v != "" {
+		nanos, id, _ := strings.Cut(v, "/")
+		n, err := strconv.ParseInt(nanos, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid marker", http.StatusBadRequest)
+			return
+		}
+		after = cluster.ResyncJob{RequestedAt: time.Unix(0, n), ID: id}
+	}
+	var jobs []cluster.ResyncJob
+	if h.Cluster != nil {
+		jobs = h.Cluster.ResyncJobs()
+	}
+	follows := func(j cluster.ResyncJob) bool {
+		return j.RequestedAt.After(after.RequestedAt) || j.RequestedAt.Equal(after.RequestedAt) && j.ID > after.ID
+	}
+	page, next := paginate(jobs, pageLimit(r, maxPage), follows, func(j cluster.ResyncJob) string {
+		return strconv.FormatInt(j.RequestedAt.UnixNano(), 10) + "/" + j.ID
+	})
+	writePage(w, "jobs", page, next)
+}
+
+func (h *Handler) resyncStatus(w http.ResponseWriter, r *http.Request) {
+	var job cluster.ResyncJob
+	ok := false
+	if h.Cluster != nil {
+		job, ok = h.Cluster.ResyncJob(strings.TrimPrefix(r.URL.Path, "/admin/cluster/resync/"))
+	}
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+func (h *Handler) decommissionStatus(w http.ResponseWriter, r *http.Request) {
+	var st *cluster.DecommissionStatus
+	if h.Cluster != nil {
+		st = h.Cluster.Decommissioning()
+	}
+	if st == nil {
+		http.Error(w, "no decommission was started", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st)
+}
@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/objectd"
+	"github.com/mchenetz/entity/internal/standby"
+)
+
+// changeFeed serves the object changelog to a standby cluster.
+func (h *Handler) changeFeed(w http.ResponseWriter, r *http.Request) {
+	since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Store.ChangesSince(r.Context(), since, limit))
+}
+
+func (h *Handler) standbyObject(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/admin/standby/objects/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	m, f, err := h.Store.OpenObject(r.Context(), parts[0], parts[1])
+	if err != nil {
+		if errors.Is(err, objectd.ErrNotFound) || errors.Is(err, objectd.ErrObjectPending) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set(cluster.SeqHeader, strconv.FormatUint(m.Seq, 10))
+	w.Header().Set("Content-Length", strconv.FormatInt(m.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, f)
+}
+
+func (h *Handler) standbyStatus(w http.ResponseWriter, r *http.Request) {
+	st := standby.Status{Standby: h.Store.Standby(), Promoted: h.Store.Promoted(), Cursor: h.Store.StandbyCursor()}
+	if h.Standby != nil {
+		st = h.Standby.Status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+// promote turns a standby cluster into a primary. Tailing stops and writes
+// are accepted from then on; the promotion cannot be undone.
+func (h *Handler) promote(w http.ResponseWriter, r *http.Request) {
+	if !h.Store.Standby() {
+		http.Error(w, "cluster is not a standby", http.StatusConflict)
+		return
+	}
+	if err := h.Store.Promote(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/standby/promote", nil, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
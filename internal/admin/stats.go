@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/metering"
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// stats reports the object count and size of every bucket and their total.
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	buckets := h.Store.Usage(r.Context())
+	var total objectd.Usage
+	for _, u := range buckets {
+		total.Objects += u.Objects
+		total.Bytes += u.Bytes
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Buckets map[string]objectd.Usage `json:"buckets"`
+		Total   objectd.Usage            `json:"total"`
+	}{buckets, total})
+}
+
+// bucketStats reports the usage, newest object, access key count and
+// replication state of one bucket.
+func (h *Handler) bucketStats(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/buckets/"), "/stats")
+	st, err := h.Store.BucketStats(r.Context(), name)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+// usage reports the requests, traffic and storage of every bucket and
+// access key between the from and to query parameters, merged across the
+// replicas unless local is true.
+func (h *Handler) usage(w http.ResponseWriter, r *http.Request) {
+	if h.Meter == nil {
+		http.Error(w, "metering disabled", http.StatusNotFound)
+		return
+	}
+	from, to, err := cluster.ParseUsageWindow(r)
+	if err != nil || !from.Before(to) {
+		http.Error(w, "from and to must be RFC 3339 times, from before to", http.StatusBadRequest)
+		return
+	}
+	report := h.Meter.Report(from, to)
+	var missing []int
+	if h.Cluster != nil && r.URL.Query().Get("local") != "true" {
+		report, missing = h.Cluster.Usage(r.Context(), h.Meter, from, to)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		metering.Report
+		// MissingPeers did not answer; their traffic is not included.
+		MissingPeers []int `json:"missingPeers,omitempty"`
+	}{report, missing})
+}
+
+// publishUsage refreshes the per-bucket usage gauges before a scrape.
+// Dropping the old series first removes buckets that were deleted.
+func (h *Handler) publishUsage(r *http.Request) {
+	metrics.DeleteGauge("entity_bucket_objects")
+	metrics.DeleteGauge("entity_bucket_bytes")
+	for name, u := range h.Store.Usage(r.Context()) {
+		labels := map[string]string{"bucket": name}
+		metrics.SetGauge("entity_bucket_objects", labels, float64(u.Objects))
+		metrics.SetGauge("entity_bucket_bytes", labels, float64(u.Bytes))
+	}
+}
@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// trashPath splits /admin/buckets/<bucket>/trash[/<rest>].
+func trashPath(p string) (bucket, rest string, ok bool) {
+	if !strings.HasPrefix(p, "/admin/buckets/") {
+		return "", "", false
+	}
+	bucket, rest, ok = strings.Cut(strings.TrimPrefix(p, "/admin/buckets/"), "/trash")
+	if !ok || bucket == "" || strings.Contains(bucket, "/") || rest != "" && !strings.HasPrefix(rest, "/") {
+		return "", "", false
+	}
+	return bucket, strings.TrimPrefix(rest, "/"), true
+}
+
+func (h *Handler) setBucketTrash(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := trashPath(r.URL.Path)
+	var req struct {
+		Days int `json:"days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Days < 0 {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.SetBucketTrash(r.Context(), bucket, req.Days); err != nil {
+		if errors.Is(err, objectd.ErrNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		payload, _ := json.Marshal(req)
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/buckets/"+bucket+"/trash", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listTrash returns a page of the trashed objects of a bucket, most
+// recently deleted first. The marker is a trash ID.
+func (h *Handler) listTrash(w http.ResponseWriter, r *http.Request) {
+	bucket, _, _ := trashPath(r.URL.Path)
+	var marker uint64
+	if v := r.URL.Query().Get("marker"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid marker", http.StatusBadRequest)
+			return
+		}
+		marker = id
+	}
+	trashed, err := h.Store.ListTrash(r.Context(), bucket)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	page, next := paginate(trashed, pageLimit(r, maxPage), func(t objectd.TrashedObject) bool { return marker == 0 || t.ID < marker },
+		func(t objectd.TrashedObject) string { return strconv.FormatUint(t.ID, 10) })
+	writePage(w, "objects", page, next)
+}
+
+// restoreTrashed puts a trashed object back. Replicas restore it under the
+// same sequence number.
+func (h *Handler) restoreTrashed(w http.ResponseWriter, r *http.Request) {
+	bucket, rest, _ := trashPath(r.URL.Path)
+	id, err := strconv.ParseUint(strings.TrimSuffix(rest, "/restore"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid trash id", http.StatusBadRequest)
+		return
+	}
+	m, err := h.Store.RestoreTrashed(r.Context(), bucket, id, 0)
+	if err != nil {
+		switch {
+		case errors.Is(err, objectd.ErrNotFound):
+			http.Error(w, "not found", http.StatusNotFound)
+		case errors.Is(err, objectd.ErrObjectExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		path := "/_cluster/replicate/trash/" + bucket + "/" + strconv.FormatUint(id, 10)
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, path, map[string]string{cluster.SeqHeader: strconv.FormatUint(m.Seq, 10)}, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"bucket": bucket, "key": m.Key, "etag": m.ETag, "size": m.Size})
+}
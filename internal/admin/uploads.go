@@ -0,0 +1,143 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// Multipart uploads are kept on the leader until they complete, so these
+// endpoints are always served by the leader.
+
+// uploadsLeaderOnly reports whether r reads or aborts multipart uploads on
+// a replica that has a leader to send it to.
+func (h *Handler) uploadsLeaderOnly(r *http.Request) bool {
+	if h.Cluster == nil || !h.Cluster.Enabled() || h.Cluster.IsInternalReplication(r) {
+		return false
+	}
+	return r.URL.Path == "/admin/uploads" || strings.HasPrefix(r.URL.Path, "/admin/uploads/")
+}
+
+// matchingUploads returns the uploads selected by the bucket and olderThan
+// query parameters.
+func (h *Handler) matchingUploads(w http.ResponseWriter, r *http.Request) ([]objectd.Upload, bool) {
+	var olderThan time.Duration
+	if v := r.URL.Query().Get("olderThan"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, "olderThan must be a duration such as 24h", http.StatusBadRequest)
+			return nil, false
+		}
+		olderThan = d
+	}
+	uploads, err := h.Store.ListUploads(r.Context(), r.URL.Query().Get("bucket"))
+	if errors.Is(err, objectd.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	cutoff := time.Now().Add(-olderThan)
+	out := uploads[:0]
+	for _, u := range uploads {
+		if !u.Initiated.After(cutoff) {
+			out = append(out, u)
+		}
+	}
+	return out, true
+}
+
+// listUploads returns a page of the multipart uploads in progress, oldest
+// first. The marker holds the start time and ID of an upload, so that
+// listing resumes after it even once it has completed.
+func (h *Handler) listUploads(w http.ResponseWriter, r *http.Request) {
+	var after objectd.Upload
+	if v := r.URL.Query().Get("marker"); v != "" {
+		nanos, id, _ := strings.Cut(v, "/")
+		n, err := strconv.ParseInt(nanos, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid marker", http.StatusBadRequest)
+			return
+		}
+		after = objectd.Upload{Initiated: time.Unix(0, n), UploadID: id}
+	}
+	uploads, ok := h.matchingUploads(w, r)
+	if !ok {
+		return
+	}
+	follows := func(u objectd.Upload) bool {
+		return u.Initiated.After(after.Initiated) || u.Initiated.Equal(after.Initiated) && u.UploadID > after.UploadID
+	}
+	page, next := paginate(uploads, pageLimit(r, maxPage), follows, func(u objectd.Upload) string {
+		return strconv.FormatInt(u.Initiated.UnixNano(), 10) + "/" + u.UploadID
+	})
+	writePage(w, "uploads", page, next)
+}
+
+// abortUploads aborts every upload selected by the query parameters.
+// olderThan is required, so that uploads still being written are not
+// aborted by accident.
+func (h *Handler) abortUploads(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("olderThan") == "" {
+		http.Error(w, "olderThan is required", http.StatusBadRequest)
+		return
+	}
+	uploads, ok := h.matchingUploads(w, r)
+	if !ok {
+		return
+	}
+	result := struct {
+		Aborted    []objectd.Upload `json:"aborted"`
+		FreedBytes int64            `json:"freedBytes"`
+	}{Aborted: []objectd.Upload{}}
+	for _, u := range uploads {
+		if err := h.Store.AbortMultipartUpload(r.Context(), u.Bucket, u.Key, u.UploadID); err != nil {
+			// Completed or aborted by a client in the meantime.
+			if !errors.Is(err, objectd.ErrNoSuchUpload) {
+				log.Printf("failed to abort upload %s of %s/%s: %v", u.UploadID, u.Bucket, u.Key, err)
+			}
+			continue
+		}
+		result.Aborted = append(result.Aborted, u)
+		result.FreedBytes += u.Size
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// abortUpload aborts the upload named by /admin/uploads/{bucket}/{uploadId}.
+func (h *Handler) abortUpload(w http.ResponseWriter, r *http.Request) {
+	bucket, id, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/uploads/"), "/")
+	if !ok || bucket == "" || id == "" {
+		http.Error(w, "want /admin/uploads/{bucket}/{uploadId}", http.StatusBadRequest)
+		return
+	}
+	uploads, err := h.Store.ListUploads(r.Context(), bucket)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	for _, u := range uploads {
+		if u.UploadID != id {
+			continue
+		}
+		if err := h.Store.AbortMultipartUpload(r.Context(), bucket, u.Key, id); err != nil {
+			if errors.Is(err, objectd.ErrNoSuchUpload) {
+				break
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Error(w, "no such upload", http.StatusNotFound)
+}
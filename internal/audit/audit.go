@@ -0,0 +1,172 @@
+// Package audit keeps an append-only record of the changes made through the
+// admin API.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultMaxBytes is the size at which the log is rotated.
+const DefaultMaxBytes = 64 << 20
+
+// Outcomes of an audited request.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+// Entry is one audited request.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Actor is the fingerprint of the admin token used, or the client
+	// certificate identity of a request without one; the token itself is
+	// never logged.
+	Actor   string `json:"actor,omitempty"`
+	Role    string `json:"role,omitempty"`
+	Action  string `json:"action"`
+	Target  string `json:"target,omitempty"`
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Remote  string `json:"remote,omitempty"`
+	Status  int    `json:"status"`
+	Outcome string `json:"outcome"`
+}
+
+// Log appends entries to a file as JSON lines. When the file grows past
+// MaxBytes it is renamed with a .1 suffix, replacing the previous one, so
+// that the current and the previous file are kept.
+type Log struct {
+	Path     string
+	MaxBytes int64
+	// Stdout, when set, also receives every entry as a JSON line.
+	Stdout io.Writer
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func Open(path string, maxBytes int64) (*Log, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	l := &Log{Path: path, MaxBytes: maxBytes}
+	if err := l.openLocked(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) openLocked() error {
+	f, err := os.OpenFile(l.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size = f, fi.Size()
+	return nil
+}
+
+// Record appends e and syncs it to disk.
+func (l *Log) Record(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Stdout != nil {
+		_, _ = l.Stdout.Write(b)
+	}
+	if l.size+int64(len(b)) > l.MaxBytes && l.size > 0 {
+		if err := l.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	n, err := l.f.Write(b)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+func (l *Log) rotateLocked() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(l.Path, l.Path+".1"); err != nil {
+		return err
+	}
+	return l.openLocked()
+}
+
+// Query filters entries.
+type Query struct {
+	Since time.Time
+	// Before, if set, selects the entries recorded before it, to page back
+	// from the oldest entry of a previous query.
+	Before time.Time
+	Action string
+	Actor  string
+	Limit  int
+}
+
+func (q Query) match(e Entry) bool {
+	return !e.Time.Before(q.Since) && (q.Before.IsZero() || e.Time.Before(q.Before)) && (q.Action == "" || e.Action == q.Action) && (q.Actor == "" || e.Actor == q.Actor)
+}
+
+// Entries returns the newest entries matching q, oldest first, from the
+// current and the previous file.
+func (l *Log) Entries(q Query) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := []Entry{}
+	for _, path := range []string{l.Path + ".1", l.Path} {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			var e Entry
+			if json.Unmarshal(sc.Bytes(), &e) != nil || !q.match(e) {
+				continue
+			}
+			out = append(out, e)
+			if q.Limit > 0 && len(out) > 2*q.Limit {
+				out = append(out[:0], out[len(out)-q.Limit:]...)
+			}
+		}
+		err = sc.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out, nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
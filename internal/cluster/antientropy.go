@@ -0,0 +1,201 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// AntiEntropyStatus reports the progress of the background comparison with
+// the peers. Converged is set when the last pass found no divergence with
+// any peer it reached.
+type AntiEntropyStatus struct {
+	Running        bool      `json:"running"`
+	StartedAt      time.Time `json:"startedAt,omitempty"`
+	CompletedAt    time.Time `json:"completedAt,omitempty"`
+	Peers          int       `json:"peers"`
+	RangesDiverged int       `json:"rangesDiverged"`
+	Pulled         int       `json:"pulled"`
+	Deleted        int       `json:"deleted"`
+	// Buckets and AccessKeys count what was added from the leader's
+	// catalog in the last pass, CatalogDeleted what was removed.
+	Buckets        int    `json:"buckets"`
+	AccessKeys     int    `json:"accessKeys"`
+	CatalogDeleted int    `json:"catalogDeleted"`
+	PendingBodies  int    `json:"pendingBodies"`
+	Converged      bool   `json:"converged"`
+	LastError      string `json:"lastError,omitempty"`
+	// Unreachable lists the peers that were skipped because they did not
+	// answer a health check.
+	Unreachable []int `json:"unreachable,omitempty"`
+}
+
+// RunAntiEntropy compares the store with every healthy peer each interval
+// and pulls what it is missing, until ctx is cancelled. It covers writes a
+// replica missed while it was down or unreachable.
+func (c *Cluster) RunAntiEntropy(ctx context.Context, store *objectd.Store, interval time.Duration) {
+	if !c.Enabled() {
+		return
+	}
+	if _, err := c.syncCatalog(ctx, store); err != nil {
+		log.Printf("anti-entropy: catalog: %v", err)
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		c.antiEntropyPass(ctx, store, "", c.setAntiEntropy)
+	}
+}
+
+// syncCatalog adds the buckets and access keys the leader has and this
+// replica lacks, such as those created before it joined, and removes those
+// the leader holds tombstones for. Only the leader is asked, so that a
+// replica that missed a delete cannot hand a deleted bucket or revoked key
+// back to the others.
+func (c *Cluster) syncCatalog(ctx context.Context, store *objectd.Store) (objectd.CatalogResult, error) {
+	var res objectd.CatalogResult
+	l, _ := c.Leader(ctx)
+	if l == c.ordinal {
+		return res, nil
+	}
+	snap, err := c.peerSnapshot(ctx, l)
+	if err != nil {
+		return res, fmt.Errorf("leader %d: %w", l, err)
+	}
+	res, err = store.MergeCatalog(ctx, snap)
+	if res.Buckets > 0 || res.AccessKeys > 0 || res.Deleted > 0 {
+		log.Printf("anti-entropy: added %d buckets and %d access keys from leader %d and removed %d deleted there", res.Buckets, res.AccessKeys, l, res.Deleted)
+	}
+	return res, err
+}
+
+// antiEntropyPass compares the store with every healthy peer, only bucket
+// if it is not empty, and reports its progress to report. Passes run one at
+// a time.
+func (c *Cluster) antiEntropyPass(ctx context.Context, store *objectd.Store, bucket string, report func(AntiEntropyStatus)) AntiEntropyStatus {
+	c.passMu.Lock()
+	defer c.passMu.Unlock()
+	st := AntiEntropyStatus{Running: true, StartedAt: time.Now().UTC()}
+	report(st)
+	var lastErr error
+	cat, err := c.syncCatalog(ctx, store)
+	st.Buckets, st.AccessKeys, st.CatalogDeleted = cat.Buckets, cat.AccessKeys, cat.Deleted
+	if err != nil {
+		lastErr = err
+		log.Printf("anti-entropy: catalog: %v", err)
+	}
+	for _, i := range c.ordinals() {
+		if i == c.ordinal {
+			continue
+		}
+		if !c.health(ctx, i) {
+			st.Unreachable = append(st.Unreachable, i)
+			continue
+		}
+		diverged, res, err := c.reconcile(ctx, store, i, bucket)
+		st.Peers++
+		st.RangesDiverged += diverged
+		st.Pulled += res.Pulled
+		st.Deleted += res.Deleted
+		if err != nil {
+			lastErr = fmt.Errorf("peer %d: %w", i, err)
+			log.Printf("anti-entropy: %v", lastErr)
+		}
+		report(st)
+	}
+	st.Running = false
+	st.CompletedAt = time.Now().UTC()
+	for _, p := range store.PendingFetches(ctx) {
+		if c.Owns(p.Bucket, p.Key) && (bucket == "" || p.Bucket == bucket) {
+			st.PendingBodies++
+		}
+	}
+	st.Converged = lastErr == nil && st.RangesDiverged == 0
+	if lastErr != nil {
+		st.LastError = lastErr.Error()
+	}
+	report(st)
+	metrics.SetGauge("entity_cluster_anti_entropy_diverged_ranges", nil, float64(st.RangesDiverged))
+	metrics.AddCounter("entity_cluster_anti_entropy_pulled_total", nil, float64(st.Pulled))
+	metrics.AddCounter("entity_cluster_anti_entropy_deleted_total", nil, float64(st.Deleted))
+	if st.Pulled > 0 || st.Deleted > 0 {
+		log.Printf("anti-entropy: pulled %d objects and applied %d deletes from %d peers", st.Pulled, st.Deleted, st.Peers)
+	}
+	return st
+}
+
+// reconcile compares the store with one peer, only bucket if it is not
+// empty, and applies what the peer has that is newer. It returns the number
+// of ranges that differed.
+func (c *Cluster) reconcile(ctx context.Context, store *objectd.Store, ordinal int, bucket string) (int, objectd.ReconcileResult, error) {
+	var total objectd.ReconcileResult
+	remote, err := c.peerManifest(ctx, ordinal)
+	if err != nil {
+		return 0, total, err
+	}
+	local := map[string]objectd.BucketManifest{}
+	for _, b := range store.Manifest(ctx).Buckets {
+		local[b.Name] = b
+	}
+	diverged := 0
+	for _, rb := range remote.Buckets {
+		// Buckets missing here, and buckets paused on either side, are not
+		// compared. Missing and deleted buckets are reconciled with the
+		// leader's catalog.
+		lb, ok := local[rb.Name]
+		if !ok || bucket != "" && rb.Name != bucket || lb.Root == rb.Root || len(rb.Ranges) != objectd.ManifestRanges {
+			continue
+		}
+		for i, d := range rb.Ranges {
+			if lb.Ranges[i] == d {
+				continue
+			}
+			diverged++
+			changes, err := c.peerManifestRange(ctx, ordinal, rb.Name, i)
+			if err != nil {
+				return diverged, total, err
+			}
+			res, err := store.ReconcileObjects(ctx, rb.Name, ordinal, changes)
+			total.Pulled += res.Pulled
+			total.Deleted += res.Deleted
+			if err != nil {
+				return diverged, total, err
+			}
+		}
+	}
+	return diverged, total, nil
+}
+
+func (c *Cluster) getJSON(ctx context.Context, ordinal int, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.adminURL(ordinal)+path, nil)
+	if err != nil {
+		return err
+	}
+	c.setInternalHeaders(req)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Cluster) setAntiEntropy(st AntiEntropyStatus) {
+	c.mu.Lock()
+	c.antiEntropy = &st
+	c.mu.Unlock()
+}
@@ -0,0 +1,155 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// A replica that starts with an empty store, such as one scheduled on a new
+// volume, copies the metadata and object bodies of a peer before it serves
+// traffic. Until it is done its health check fails, so that peers neither
+// count nor elect it, and its S3 API and readiness check turn requests away.
+
+// DefaultBootstrapWait is how long an empty replica looks for a peer to
+// copy before it starts empty.
+const DefaultBootstrapWait = 10 * time.Second
+
+// BootstrapStatus reports the progress of copying a peer.
+type BootstrapStatus struct {
+	Running     bool      `json:"running"`
+	Source      int       `json:"source"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt,omitempty"`
+	Buckets     int       `json:"buckets"`
+	Objects     int       `json:"objects"`
+	Fetched     int       `json:"fetched"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// Bootstrap starts copying a peer into store if the cluster is enabled and
+// store is empty. It returns at once; Bootstrapping reports true until the
+// copy is done or has failed.
+func (c *Cluster) Bootstrap(ctx context.Context, store *objectd.Store, wait time.Duration) {
+	if !c.Enabled() || len(c.ordinals()) < 2 || !store.Empty() {
+		return
+	}
+	st := BootstrapStatus{Running: true, Source: -1, StartedAt: time.Now().UTC()}
+	c.setBootstrap(st)
+	go c.bootstrap(ctx, store, wait, st)
+}
+
+// Bootstrapping reports whether the replica is still copying a peer.
+func (c *Cluster) Bootstrapping() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bootstrapStatus != nil && c.bootstrapStatus.Running
+}
+
+func (c *Cluster) bootstrap(ctx context.Context, store *objectd.Store, wait time.Duration, st BootstrapStatus) {
+	metrics.SetGauge("entity_cluster_bootstrapping", nil, 1)
+	defer metrics.SetGauge("entity_cluster_bootstrapping", nil, 0)
+	err := c.copyPeer(ctx, store, wait, &st)
+	st.Running = false
+	st.CompletedAt = time.Now().UTC()
+	switch {
+	case err != nil:
+		st.LastError = err.Error()
+		log.Printf("bootstrap: %v; serving with what was copied, anti-entropy pulls the rest", err)
+	case st.Source < 0:
+		log.Printf("bootstrap: no peer answered within %s; starting empty", wait)
+	default:
+		log.Printf("bootstrap: copied %d buckets and %d objects from peer %d", st.Buckets, st.Objects, st.Source)
+	}
+	c.setBootstrap(st)
+}
+
+func (c *Cluster) copyPeer(ctx context.Context, store *objectd.Store, wait time.Duration, st *BootstrapStatus) error {
+	source, ok := c.bootstrapSource(ctx, wait)
+	if !ok {
+		return ctx.Err()
+	}
+	st.Source = source
+	c.setBootstrap(*st)
+
+	snap, err := c.peerSnapshot(ctx, source)
+	if err != nil {
+		return fmt.Errorf("peer %d: %w", source, err)
+	}
+	if err := store.ApplySnapshot(ctx, snap); err != nil {
+		return err
+	}
+	st.Buckets = len(snap.Buckets)
+	c.setBootstrap(*st)
+	for _, b := range snap.Buckets {
+		for i := 0; i < objectd.ManifestRanges; i++ {
+			changes, err := c.peerManifestRange(ctx, source, b.Name, i)
+			if err != nil {
+				return fmt.Errorf("peer %d: %w", source, err)
+			}
+			res, err := store.ReconcileObjects(ctx, b.Name, source, changes)
+			st.Objects += res.Pulled
+			if err != nil {
+				return err
+			}
+		}
+		c.setBootstrap(*st)
+	}
+	for _, p := range store.PendingFetches(ctx) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !c.Owns(p.Bucket, p.Key) {
+			continue
+		}
+		if err := c.fetch(ctx, store, p); err != nil {
+			log.Printf("bootstrap: fetch %s/%s seq=%d: %v", p.Bucket, p.Key, p.Seq, err)
+			continue
+		}
+		st.Fetched++
+		c.setBootstrap(*st)
+	}
+	for _, b := range snap.Buckets {
+		if b.ReplicationPaused {
+			if err := store.SetReplicationPaused(ctx, b.Name, true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// bootstrapSource returns the peer to copy: the lease holder if there is
+// one, and otherwise the healthy peer with the lowest ordinal. It retries
+// until wait has passed.
+func (c *Cluster) bootstrapSource(ctx context.Context, wait time.Duration) (int, bool) {
+	deadline := time.Now().Add(wait)
+	for {
+		if l, ok := c.leaseLeader(); ok && l != c.ordinal && c.health(ctx, l) {
+			return l, true
+		}
+		for _, i := range c.ordinals() {
+			if i != c.ordinal && c.health(ctx, i) {
+				return i, true
+			}
+		}
+		if time.Now().After(deadline) {
+			return -1, false
+		}
+		select {
+		case <-ctx.Done():
+			return -1, false
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (c *Cluster) setBootstrap(st BootstrapStatus) {
+	c.mu.Lock()
+	c.bootstrapStatus = &st
+	c.mu.Unlock()
+}
@@ -0,0 +1,285 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/mchenetz/entity/internal/cluster/pb"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// The reads below go over the replication service to peers that serve it
+// and to the HTTP endpoints otherwise.
+
+// call runs a unary call on ordinal within the client timeout, or returns
+// errNoRPC if the peer is reached over HTTP.
+func call[T any](c *Cluster, ctx context.Context, ordinal int, fn func(context.Context, pb.ReplicationClient) (T, error)) (T, error) {
+	var zero T
+	client := c.rpcClient(ordinal)
+	if client == nil {
+		return zero, errNoRPC
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.httpClient.Timeout)
+	defer cancel()
+	resp, err := fn(c.rpcContext(ctx), client)
+	if err != nil {
+		return zero, c.rpcErr(ordinal, err)
+	}
+	return resp, nil
+}
+
+// peerManifest returns the manifest of ordinal.
+func (c *Cluster) peerManifest(ctx context.Context, ordinal int) (objectd.Manifest, error) {
+	resp, err := call(c, ctx, ordinal, func(ctx context.Context, client pb.ReplicationClient) (*pb.Manifest, error) {
+		return client.GetManifest(ctx, &pb.GetManifestRequest{})
+	})
+	if errors.Is(err, errNoRPC) {
+		var m objectd.Manifest
+		err := c.getJSON(ctx, ordinal, "/_cluster/manifest", &m)
+		return m, err
+	}
+	if err != nil {
+		return objectd.Manifest{}, err
+	}
+	m := objectd.Manifest{Clock: resp.Clock, Buckets: []objectd.BucketManifest{}}
+	for _, b := range resp.Buckets {
+		m.Buckets = append(m.Buckets, objectd.BucketManifest{Name: b.Name, Root: b.Root, Ranges: b.Ranges})
+	}
+	return m, nil
+}
+
+// peerManifestRange returns the objects in range rng of bucket on ordinal.
+func (c *Cluster) peerManifestRange(ctx context.Context, ordinal int, bucket string, rng int) ([]objectd.ObjectChange, error) {
+	resp, err := call(c, ctx, ordinal, func(ctx context.Context, client pb.ReplicationClient) (*pb.ManifestRange, error) {
+		return client.GetManifestRange(ctx, &pb.GetManifestRangeRequest{Bucket: bucket, Range: int32(rng)})
+	})
+	if errors.Is(err, errNoRPC) {
+		var changes []objectd.ObjectChange
+		err := c.getJSON(ctx, ordinal, "/_cluster/manifest/"+bucket+"?range="+strconv.Itoa(rng), &changes)
+		return changes, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	var changes []objectd.ObjectChange
+	for _, ch := range resp.Changes {
+		changes = append(changes, objectd.ObjectChange{
+			Bucket: ch.Bucket, Key: ch.Key, Seq: ch.Seq, Deleted: ch.Deleted, ETag: ch.Etag, Size: ch.Size,
+			StorageClass: ch.StorageClass, ContentType: ch.ContentType, ExpiresAt: ch.ExpiresAt,
+		})
+	}
+	return changes, nil
+}
+
+// peerChunkMap returns the chunk map of bucket/key on ordinal.
+func (c *Cluster) peerChunkMap(ctx context.Context, ordinal int, bucket, key string) (objectd.ChunkMap, error) {
+	resp, err := call(c, ctx, ordinal, func(ctx context.Context, client pb.ReplicationClient) (*pb.ChunkMap, error) {
+		return client.GetChunkMap(ctx, &pb.GetChunkMapRequest{Bucket: bucket, Key: key})
+	})
+	if errors.Is(err, errNoRPC) {
+		var m objectd.ChunkMap
+		err := c.getJSON(ctx, ordinal, "/_cluster/chunks/"+bucket+"/"+key, &m)
+		return m, err
+	}
+	if err != nil {
+		return objectd.ChunkMap{}, err
+	}
+	m := objectd.ChunkMap{Seq: resp.Seq, ETag: resp.Etag, Compression: resp.Compression, Chunks: []objectd.ChunkSum{}}
+	for _, ch := range resp.Chunks {
+		m.Chunks = append(m.Chunks, objectd.ChunkSum{Size: ch.Size, SHA256: ch.Sha256})
+	}
+	return m, nil
+}
+
+// peerChunk opens chunk i of version seq of bucket/key on ordinal.
+func (c *Cluster) peerChunk(ctx context.Context, ordinal int, bucket, key string, seq uint64, i int) (io.ReadCloser, error) {
+	if client := c.rpcClient(ordinal); client != nil {
+		ctx, cancel := context.WithCancel(ctx)
+		stream, err := client.GetChunk(c.rpcContext(ctx), &pb.GetChunkRequest{Bucket: bucket, Key: key, Seq: seq, Index: int32(i)})
+		if err == nil {
+			return &chunkReader{recv: func() ([]byte, error) {
+				ch, err := stream.Recv()
+				if err != nil {
+					return nil, err
+				}
+				return ch.Data, nil
+			}, cancel: cancel}, nil
+		}
+		cancel()
+		if err := c.rpcErr(ordinal, err); !errors.Is(err, errNoRPC) {
+			return nil, err
+		}
+	}
+	path := "/_cluster/chunks/" + bucket + "/" + key + "?seq=" + strconv.FormatUint(seq, 10) + "&index=" + strconv.Itoa(i)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.adminURL(ordinal)+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setInternalHeaders(req)
+	resp, err := c.bulkClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("peer %d: status %d", ordinal, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// peerObject returns the sequence number of the version of bucket/key that
+// ordinal holds and, unless head is set, opens its body. It fails with
+// objectd.ErrNotFound if the peer does not hold the object.
+func (c *Cluster) peerObject(ctx context.Context, ordinal int, bucket, key string, head bool) (uint64, io.ReadCloser, error) {
+	if client := c.rpcClient(ordinal); client != nil {
+		seq, body, err := c.peerObjectRPC(ctx, client, bucket, key, head)
+		if status.Code(err) == codes.NotFound {
+			return 0, nil, objectd.ErrNotFound
+		}
+		if err := c.rpcErr(ordinal, err); !errors.Is(err, errNoRPC) {
+			return seq, body, err
+		}
+	}
+	method, client := http.MethodGet, c.bulkClient
+	if head {
+		method, client = http.MethodHead, c.httpClient
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.adminURL(ordinal)+"/_cluster/objects/"+bucket+"/"+key, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	c.setInternalHeaders(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return 0, nil, objectd.ErrNotFound
+		}
+		return 0, nil, fmt.Errorf("peer %d: status %d", ordinal, resp.StatusCode)
+	}
+	seq, _ := requestSeqHeader(resp.Header)
+	if head {
+		_ = resp.Body.Close()
+		return seq, nil, nil
+	}
+	return seq, resp.Body, nil
+}
+
+func (c *Cluster) peerObjectRPC(ctx context.Context, client pb.ReplicationClient, bucket, key string, head bool) (uint64, io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := client.GetObject(c.rpcContext(ctx), &pb.GetObjectRequest{Bucket: bucket, Key: key, Head: head})
+	if err != nil {
+		cancel()
+		return 0, nil, err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		cancel()
+		return 0, nil, err
+	}
+	seq := first.GetHeader().GetSeq()
+	if head {
+		cancel()
+		return seq, nil, nil
+	}
+	return seq, &chunkReader{recv: func() ([]byte, error) {
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return resp.GetData(), nil
+	}, cancel: cancel}, nil
+}
+
+// peerSnapshot returns the metadata of ordinal for a bootstrap.
+func (c *Cluster) peerSnapshot(ctx context.Context, ordinal int) (objectd.Snapshot, error) {
+	resp, err := call(c, ctx, ordinal, func(ctx context.Context, client pb.ReplicationClient) (*pb.Snapshot, error) {
+		return client.GetSnapshot(ctx, &pb.GetSnapshotRequest{})
+	})
+	if errors.Is(err, errNoRPC) {
+		var snap objectd.Snapshot
+		err := c.getJSON(ctx, ordinal, "/_cluster/snapshot", &snap)
+		return snap, err
+	}
+	if err != nil {
+		return objectd.Snapshot{}, err
+	}
+	return snapshotFromPB(resp)
+}
+
+func snapshotToPB(snap objectd.Snapshot) *pb.Snapshot {
+	out := &pb.Snapshot{Clock: snap.Clock}
+	for _, b := range snap.Buckets {
+		out.Buckets = append(out.Buckets, &pb.BucketSnapshot{
+			Name: b.Name, CreatedAt: b.CreatedAt, Encryption: b.Encryption, TrashDays: int32(b.TrashDays), Copies: int32(b.Copies),
+			Consistency: b.Consistency, Federation: b.Federation, ReplicationPaused: b.ReplicationPaused, RenamedFrom: b.RenamedFrom,
+			QuotaBytes: b.QuotaBytes, PublicRead: b.PublicRead, Versioning: b.Versioning,
+		})
+	}
+	for _, a := range snap.Access {
+		out.Access = append(out.Access, accessKeyToPB(a))
+	}
+	for _, d := range snap.Domains {
+		out.Domains = append(out.Domains, &pb.Domain{Host: d.Host, Bucket: d.Bucket})
+	}
+	out.DeletedBuckets = tombstonesToPB(snap.DeletedBuckets)
+	out.DeletedAccess = tombstonesToPB(snap.DeletedAccess)
+	return out
+}
+
+func snapshotFromPB(snap *pb.Snapshot) (objectd.Snapshot, error) {
+	out := objectd.Snapshot{Clock: snap.GetClock(), Buckets: []objectd.BucketSnapshot{}, Access: []objectd.AccessKey{}}
+	for _, b := range snap.GetBuckets() {
+		out.Buckets = append(out.Buckets, objectd.BucketSnapshot{
+			Name: b.GetName(), CreatedAt: b.GetCreatedAt(), Encryption: b.GetEncryption(), TrashDays: int(b.GetTrashDays()), Copies: int(b.GetCopies()),
+			Consistency: b.GetConsistency(), Federation: b.GetFederation(), ReplicationPaused: b.GetReplicationPaused(), RenamedFrom: b.GetRenamedFrom(),
+			QuotaBytes: b.GetQuotaBytes(), PublicRead: b.GetPublicRead(), Versioning: b.GetVersioning(),
+		})
+	}
+	for _, a := range snap.GetAccess() {
+		key, err := accessKeyFromPB(a)
+		if err != nil {
+			return objectd.Snapshot{}, err
+		}
+		out.Access = append(out.Access, key)
+	}
+	for _, d := range snap.GetDomains() {
+		out.Domains = append(out.Domains, objectd.Domain{Host: d.GetHost(), Bucket: d.GetBucket()})
+	}
+	out.DeletedBuckets = tombstonesFromPB(snap.GetDeletedBuckets())
+	out.DeletedAccess = tombstonesFromPB(snap.GetDeletedAccess())
+	return out, nil
+}
+
+// tombstonesToPB turns a map of names to deletion times into messages,
+// sorted by name.
+func tombstonesToPB(m map[string]string) []*pb.Tombstone {
+	var out []*pb.Tombstone
+	for _, name := range slices.Sorted(maps.Keys(m)) {
+		out = append(out, &pb.Tombstone{Name: name, DeletedAt: m[name]})
+	}
+	return out
+}
+
+func tombstonesFromPB(ts []*pb.Tombstone) map[string]string {
+	if len(ts) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(ts))
+	for _, t := range ts {
+		out[t.GetName()] = t.GetDeletedAt()
+	}
+	return out
+}
@@ -1,19 +1,39 @@
 package cluster
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/mchenetz/entity/internal/cluster/pb"
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/internal/ratelimit"
+	"github.com/mchenetz/entity/internal/tokens"
 )
 
+const (
+	TimeHeader     = "X-ENTITY-Time"
+	SeqHeader      = "X-ENTITY-Seq"
+	ReadOnlyHeader = "X-ENTITY-Read-Only"
+)
+
+// DefaultPeerTimeout bounds a replication request to one peer.
+const DefaultPeerTimeout = 10 * time.Second
+
 type Config struct {
 	PodName      string
 	Namespace    string
@@ -22,18 +42,147 @@ type Config struct {
 	Replicas     int
 	S3Port       int
 	AdminPort    int
-	Token        string
+	// Tokens are the admin tokens peers accept; the primary one is sent.
+	Tokens *tokens.Set
 
 	TLSEnabled bool
 	CAFile     string
 	CertFile   string
 	KeyFile    string
+
+	MaxClockSkew time.Duration
+	// HintMaxBytes bounds the mutations queued for an unreachable peer;
+	// zero disables hinted handoff.
+	HintMaxBytes int64
+	// Copies is how many replicas keep each object body in partitioned
+	// mode; zero, or at least Replicas, keeps every body on every replica.
+	Copies int
+	// PeerTimeout bounds each replication request that carries no object
+	// body; requests streaming an object body have no deadline.
+	PeerTimeout time.Duration
+	// Consistency is how many replicas must acknowledge a synchronous
+	// write; the default is a quorum.
+	Consistency Consistency
+	// ReplicationBandwidth caps the bytes per second of object bodies sent
+	// to and pulled from peers; zero is unlimited.
+	ReplicationBandwidth int64
+	// MaxBacklog is how many bytes of undelivered object data make the
+	// replica refuse new writes; zero never refuses them.
+	MaxBacklog int64
+
+	// Seeds are admin URLs of members to gossip with; when set, membership
+	// is learned by gossip instead of from Replicas.
+	Seeds []string
+	// AdvertiseURL is the admin URL other members reach this one at; it
+	// defaults to the pod's headless-service name.
+	AdvertiseURL string
+	// NodeID is this replica's ordinal outside a StatefulSet. It must be
+	// unique within the cluster; empty derives it from PodName.
+	NodeID string
+	// MemberRemoveAfter is how long a silent member is kept.
+	MemberRemoveAfter time.Duration
+
+	// LeaderLease names the coordination.k8s.io Lease the replicas elect
+	// a leader with; empty finds the leader by probing health instead.
+	LeaderLease         string
+	LeaderLeaseDuration time.Duration
+
+	// ZonesFile lists the zone of every member, for zone-aware placement.
+	ZonesFile string
+}
+
+type Status struct {
+	Enabled  bool `json:"enabled"`
+	Replicas int  `json:"replicas"`
+	Ordinal  int  `json:"ordinal"`
+	Leader   int  `json:"leader"`
+	// LeaderLease is the holder of the leader lease, when one is used.
+	LeaderLease string       `json:"leaderLease,omitempty"`
+	Peers       []PeerStatus `json:"peers,omitempty"`
+	// Members is the gossip view of the cluster.
+	Members []Member `json:"members,omitempty"`
+	// BacklogBytes is the object data waiting to be delivered to peers.
+	BacklogBytes int64 `json:"backlogBytes,omitempty"`
+	// Degraded is set while too few replicas are reachable for writes.
+	Degraded bool `json:"degraded,omitempty"`
+	// Epoch is the highest leadership epoch this replica has seen.
+	Epoch uint64 `json:"epoch,omitempty"`
+	// Zones are the zones of the members, by ordinal, when known.
+	Zones map[int]string `json:"zones,omitempty"`
+
+	AntiEntropy  *AntiEntropyStatus  `json:"antiEntropy,omitempty"`
+	Decommission *DecommissionStatus `json:"decommission,omitempty"`
+	Bootstrap    *BootstrapStatus    `json:"bootstrap,omitempty"`
+}
+
+type PeerStatus struct {
+	Ordinal       int       `json:"ordinal"`
+	ClockSkewMs   int64     `json:"clockSkewMs"`
+	LastHealthyAt time.Time `json:"lastHealthyAt"`
+	ReadOnly      bool      `json:"readOnly,omitempty"`
+	Hints         int       `json:"hints,omitempty"`
+	HintBytes     int64     `json:"hintBytes,omitempty"`
+	HintsDropped  int       `json:"hintsDropped,omitempty"`
+	// GRPC is set while the peer is reached over the replication service.
+	GRPC bool `json:"grpc,omitempty"`
+
+	// Queued mutations in asynchronous mode.
+	Queued         int       `json:"queued,omitempty"`
+	QueuedBytes    int64     `json:"queuedBytes,omitempty"`
+	OldestQueuedAt time.Time `json:"oldestQueuedAt,omitempty"`
+	QueueError     string    `json:"queueError,omitempty"`
 }
 
 type Cluster struct {
 	cfg        Config
 	ordinal    int
 	httpClient *http.Client
+	// bulkClient carries object bodies and therefore has no overall timeout.
+	bulkClient *http.Client
+	// tlsConfig is the peer mTLS configuration, which the replication
+	// service requires.
+	tlsConfig *tls.Config
+
+	mu    sync.Mutex
+	peers map[int]PeerStatus
+	hints map[int]*hintQueue
+	ring  []ringPoint
+	// members is set when membership is learned by gossip.
+	members map[int]*Member
+	// queues is set in asynchronous mode.
+	queues       map[int]*peerQueue
+	antiEntropy  *AntiEntropyStatus
+	decommission *DecommissionStatus
+	resyncs      []*ResyncJob
+	// passMu keeps anti-entropy passes from overlapping.
+	passMu sync.Mutex
+	// bucketCopies looks up per-bucket replication factors.
+	bucketCopies func(bucket string) int
+	lease        leaseView
+	throttle     *ratelimit.Limiter
+	// conns are the gRPC connections to peers, by admin URL.
+	conns map[string]*grpc.ClientConn
+	// bandwidth and maxBacklog start as ReplicationBandwidth and
+	// MaxBacklog and follow SetReplicationLimits.
+	bandwidth  atomic.Int64
+	maxBacklog atomic.Int64
+	// reachable is how many replicas answered the last quorum check.
+	reachable     int
+	quorumChecked bool
+	degraded      bool
+	// epoch is the highest leadership epoch seen; epochOwned is set while
+	// this replica leads in it.
+	epoch      uint64
+	epochOwned bool
+	epochPath  string
+	// bootstrapStatus is set once an empty replica starts copying a peer.
+	bootstrapStatus *BootstrapStatus
+	// zones maps ordinals to zones; it is replaced, never modified.
+	zones map[int]string
+	// view holds the last health probe of every replica; entries younger
+	// than viewTTL are used for routing without probing again.
+	view    map[int]viewEntry
+	viewTTL time.Duration
 }
 
 func New(cfg Config) *Cluster {
@@ -46,6 +195,21 @@ func New(cfg Config) *Cluster {
 	if cfg.AdminPort == 0 {
 		cfg.AdminPort = 19000
 	}
+	if cfg.MaxClockSkew == 0 {
+		cfg.MaxClockSkew = 2 * time.Second
+	}
+	if cfg.PeerTimeout == 0 {
+		cfg.PeerTimeout = DefaultPeerTimeout
+	}
+	if cfg.Consistency == "" {
+		cfg.Consistency = ConsistencyQuorum
+	}
+	if cfg.MemberRemoveAfter == 0 {
+		cfg.MemberRemoveAfter = DefaultMemberRemoveAfter
+	}
+	if cfg.LeaderLeaseDuration == 0 {
+		cfg.LeaderLeaseDuration = DefaultLeaderLeaseDuration
+	}
 	tr := &http.Transport{}
 	if cfg.TLSEnabled {
 		tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
@@ -63,15 +227,35 @@ func New(cfg Config) *Cluster {
 		}
 		tr.TLSClientConfig = tlsCfg
 	}
-	return &Cluster{
+	var tlsCfg *tls.Config
+	if tr.TLSClientConfig != nil {
+		tlsCfg = tr.TLSClientConfig.Clone()
+	}
+	ordinal := parseOrdinal(cfg.PodName)
+	if cfg.NodeID != "" {
+		ordinal, _ = strconv.Atoi(cfg.NodeID)
+	}
+	c := &Cluster{
 		cfg:        cfg,
-		ordinal:    parseOrdinal(cfg.PodName),
+		ordinal:    ordinal,
 		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: tr},
+		bulkClient: &http.Client{Transport: tr},
+		tlsConfig:  tlsCfg,
+		peers:      map[int]PeerStatus{},
+		hints:      map[int]*hintQueue{},
+		view:       map[int]viewEntry{},
+		throttle:   ratelimit.New(),
+		conns:      map[string]*grpc.ClientConn{},
 	}
+	c.bandwidth.Store(cfg.ReplicationBandwidth)
+	c.maxBacklog.Store(cfg.MaxBacklog)
+	c.initMembers()
+	return c
 }
 
-func (c *Cluster) Enabled() bool    { return c.cfg.Replicas > 1 }
+func (c *Cluster) Enabled() bool    { return c.cfg.Replicas > 1 || c.Gossip() }
 func (c *Cluster) SelfOrdinal() int { return c.ordinal }
+func (c *Cluster) Replicas() int    { return len(c.ordinals()) }
 
 func (c *Cluster) IsInternalReplication(r *http.Request) bool {
 	return r.Header.Get("X-ENTITY-Internal-Replication") == "true"
@@ -81,8 +265,11 @@ func (c *Cluster) Leader(ctx context.Context) (int, string) {
 	if !c.Enabled() {
 		return 0, c.adminURL(0)
 	}
-	for i := 0; i < c.cfg.Replicas; i++ {
-		if c.health(ctx, i) {
+	if l, ok := c.leaseLeader(); ok {
+		return l, c.adminURL(l)
+	}
+	for _, i := range c.ordinals() {
+		if c.up(ctx, i) {
 			return i, c.adminURL(i)
 		}
 	}
@@ -94,11 +281,51 @@ func (c *Cluster) IsLeader(ctx context.Context) bool {
 	return l == c.ordinal
 }
 
+func (c *Cluster) Status(ctx context.Context) Status {
+	l, _ := c.Leader(ctx)
+	ordinals := c.ordinals()
+	st := Status{Enabled: c.Enabled(), Replicas: len(ordinals), Ordinal: c.ordinal, Leader: l, Members: c.Members(), BacklogBytes: c.Backlog()}
+	c.mu.Lock()
+	for _, i := range ordinals {
+		p, ok := c.peers[i]
+		q := c.hints[i]
+		pq := c.queues[i]
+		if i == c.ordinal || !ok && q == nil && pq == nil {
+			continue
+		}
+		p.Ordinal = i
+		if q != nil {
+			p.Hints, p.HintBytes, p.HintsDropped = len(q.hints), q.bytes, q.dropped
+		}
+		if pq != nil {
+			pq.status(&p)
+		}
+		st.Peers = append(st.Peers, p)
+	}
+	st.AntiEntropy = c.antiEntropy
+	st.Decommission = c.decommission
+	st.Bootstrap = c.bootstrapStatus
+	if c.cfg.LeaderLease != "" {
+		st.LeaderLease = c.lease.holder
+	}
+	st.Degraded = c.degraded
+	st.Epoch = c.epoch
+	st.Zones = c.zones
+	c.mu.Unlock()
+	return st
+}
+
+// LeaderS3URL returns the leader's ordinal and the base URL of its S3
+// endpoint.
+func (c *Cluster) LeaderS3URL(ctx context.Context) (int, string) {
+	l, admin := c.Leader(ctx)
+	return l, strings.Replace(admin, fmt.Sprintf(":%d", c.cfg.AdminPort), fmt.Sprintf(":%d", c.cfg.S3Port), 1)
+}
+
 func (c *Cluster) ProxyToLeader(w http.ResponseWriter, r *http.Request, service string) error {
-	_, admin := c.Leader(r.Context())
-	base := admin
+	_, base := c.Leader(r.Context())
 	if service == "s3" {
-		base = strings.Replace(admin, fmt.Sprintf(":%d", c.cfg.AdminPort), fmt.Sprintf(":%d", c.cfg.S3Port), 1)
+		_, base = c.LeaderS3URL(r.Context())
 	}
 	url := base + r.URL.RequestURI()
 	req, err := http.NewRequestWithContext(r.Context(), r.Method, url, r.Body)
@@ -107,7 +334,13 @@ func (c *Cluster) ProxyToLeader(w http.ResponseWriter, r *http.Request, service
 	}
 	req.Header = r.Header.Clone()
 	req.Host = r.Host
-	resp, err := c.httpClient.Do(req)
+	// A request with a body, such as a federated object upload, may take
+	// longer to forward than the client timeout allows.
+	client := c.httpClient
+	if r.ContentLength != 0 {
+		client = c.bulkClient
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -119,56 +352,167 @@ func (c *Cluster) ProxyToLeader(w http.ResponseWriter, r *http.Request, service
 }
 
 func (c *Cluster) Replicate(ctx context.Context, method, path string, headers map[string]string, body []byte) error {
+	return c.ReplicatePayload(ctx, method, path, headers, BytesPayload(body))
+}
+
+// ReplicatePayload replicates a mutation whose body is opened once per peer.
+// The peers are contacted concurrently and it returns as soon as enough of
+// them for the consistency level have acknowledged, or can no longer; the
+// remaining requests complete in the background and fall back to hints like
+// any other failure.
+func (c *Cluster) ReplicatePayload(ctx context.Context, method, path string, headers map[string]string, body Payload) error {
 	if !c.Enabled() {
 		return nil
 	}
+	h := hint{method: method, path: path, headers: c.stampEpoch(headers), payload: body}
+	if c.Async() && c.consistency(ctx) == ConsistencyAsync {
+		return c.enqueue(h)
+	}
+	ordinals := c.ordinals()
 	acks := 1
-	required := (c.cfg.Replicas / 2) + 1
-	for i := 0; i < c.cfg.Replicas; i++ {
+	required := c.required(ctx, len(ordinals))
+	results := make(chan bool, len(ordinals))
+	bg := context.WithoutCancel(ctx)
+	pending := 0
+	for _, i := range ordinals {
 		if i == c.ordinal {
 			continue
 		}
-		url := c.adminURL(i) + path
-		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
-		if err != nil {
-			continue
-		}
-		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
-		req.Header.Set("X-ENTITY-Internal-Replication", "true")
-		for k, v := range headers {
-			req.Header.Set(k, v)
-		}
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
+		if c.queueBehindHints(i, h) {
 			continue
 		}
-		_ = resp.Body.Close()
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			acks++
+		pending++
+		go func() { results <- c.replicateTo(bg, i, h) }()
+	}
+	for ; pending > 0 && acks < required && acks+pending >= required; pending-- {
+		select {
+		case ok := <-results:
+			if ok {
+				acks++
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("replication interrupted: got=%d required=%d: %w", acks, required, ctx.Err())
 		}
 	}
 	if acks < required {
-		return fmt.Errorf("replication quorum not reached: got=%d required=%d", acks, required)
+		return fmt.Errorf("replication %s not reached: got=%d required=%d", c.consistency(ctx), acks, required)
 	}
 	return nil
 }
 
+// replicateTo sends a mutation to one peer within the peer timeout, queueing
+// it as a hint if the peer cannot take it, and reports whether it was
+// acknowledged.
+func (c *Cluster) replicateTo(ctx context.Context, ordinal int, h hint) bool {
+	if !h.payload.streamed() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.PeerTimeout)
+		defer cancel()
+	}
+	status, err := c.send(ctx, ordinal, h)
+	switch {
+	case errors.Is(err, ErrSuperseded):
+		return true
+	case err != nil || status >= 500:
+		c.queueHint(ordinal, h)
+	case status >= 200 && status < 300:
+		return true
+	}
+	return false
+}
+
+// health probes ordinal and records the answer in the health view.
 func (c *Cluster) health(ctx context.Context, ordinal int) bool {
+	up := c.probeHealth(ctx, ordinal)
+	if ctx.Err() == nil {
+		c.recordHealth(ordinal, up)
+	}
+	return up
+}
+
+// probeHealth asks ordinal for its health over the replication service if
+// the peer serves it, and over HTTP otherwise.
+func (c *Cluster) probeHealth(ctx context.Context, ordinal int) bool {
+	if ok, err := c.healthRPC(ctx, ordinal); !errors.Is(err, errNoRPC) {
+		return ok
+	}
 	url := c.adminURL(ordinal) + "/_cluster/health"
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return false
 	}
-	req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	req.Header.Set("Authorization", "Bearer "+c.token())
+	sent := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return false
 	}
 	_ = resp.Body.Close()
-	return resp.StatusCode == http.StatusOK
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	if ordinal != c.ordinal {
+		t, err := time.Parse(time.RFC3339Nano, resp.Header.Get(TimeHeader))
+		if err != nil {
+			return true
+		}
+		rpc := slices.Contains(strings.Split(resp.Header.Get(ProtocolsHeader), ","), ReplicationService)
+		c.observePeer(ordinal, sent, time.Now(), t, resp.Header.Get(ReadOnlyHeader) == "true", rpc)
+	}
+	return true
+}
+
+// healthRPC probes ordinal over the replication service, or returns
+// errNoRPC if the peer is reached over HTTP.
+func (c *Cluster) healthRPC(ctx context.Context, ordinal int) (bool, error) {
+	client := c.rpcClient(ordinal)
+	if client == nil {
+		return false, errNoRPC
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.httpClient.Timeout)
+	defer cancel()
+	sent := time.Now()
+	resp, err := client.Health(c.rpcContext(ctx), &pb.HealthRequest{})
+	if err != nil {
+		if err := c.rpcErr(ordinal, err); errors.Is(err, errNoRPC) {
+			return false, err
+		}
+		return false, nil
+	}
+	c.observePeer(ordinal, sent, time.Now(), time.Unix(0, resp.TimeUnixNano), resp.ReadOnly, true)
+	return true, nil
+}
+
+// observePeer records a peer's health response: its clock offset, estimated
+// assuming the response was produced halfway through the RTT, whether it
+// refuses writes for lack of disk space, and whether it serves the
+// replication service.
+func (c *Cluster) observePeer(ordinal int, sent, received, t time.Time, readOnly, rpc bool) {
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := t.Sub(local)
+	c.mu.Lock()
+	c.peers[ordinal] = PeerStatus{Ordinal: ordinal, ClockSkewMs: skew.Milliseconds(), LastHealthyAt: received.UTC(), ReadOnly: readOnly, GRPC: rpc}
+	c.mu.Unlock()
+	metrics.SetGauge("entity_cluster_peer_clock_skew_seconds", map[string]string{"peer": strconv.Itoa(ordinal)}, skew.Seconds())
+	if skew > c.cfg.MaxClockSkew || skew < -c.cfg.MaxClockSkew {
+		log.Printf("clock skew with peer %d is %s (threshold %s)", ordinal, skew, c.cfg.MaxClockSkew)
+	}
 }
 
 func (c *Cluster) adminURL(ordinal int) string {
+	if c.Gossip() {
+		c.mu.Lock()
+		m, ok := c.members[ordinal]
+		c.mu.Unlock()
+		if ok {
+			return m.URL
+		}
+	}
+	return c.serviceURL(ordinal)
+}
+
+// serviceURL returns the admin URL of ordinal under the headless service.
+func (c *Cluster) serviceURL(ordinal int) string {
 	host := fmt.Sprintf("%s-%d.%s.%s.svc.cluster.local", c.cfg.Name, ordinal, c.cfg.HeadlessName, c.cfg.Namespace)
 	scheme := "http"
 	if c.cfg.TLSEnabled {
@@ -197,3 +541,11 @@ func copyHeader(dst, src http.Header) {
 		}
 	}
 }
+
+// token returns the admin token sent to peers.
+func (c *Cluster) token() string {
+	if c.cfg.Tokens == nil {
+		return ""
+	}
+	return c.cfg.Tokens.Primary()
+}
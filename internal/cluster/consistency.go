@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// A synchronous write is acknowledged once enough replicas, this one
+// included, have applied it. The level is set for the whole cluster and can
+// be overridden per bucket, and per request with ConsistencyHeader; the
+// leader applies the level of the request that caused the write. An async
+// write is acknowledged once it is applied here: in asynchronous mode it
+// goes through the replication queues, and in synchronous mode it is sent
+// to the peers in the background like a write at level one. Other levels
+// are replicated synchronously in either mode.
+
+type Consistency string
+
+const (
+	ConsistencyOne    Consistency = "one"
+	ConsistencyQuorum Consistency = "quorum"
+	ConsistencyAll    Consistency = "all"
+	ConsistencyAsync  Consistency = "async"
+
+	// ConsistencyHeader selects the consistency level of a write.
+	ConsistencyHeader = "X-ENTITY-Write-Consistency"
+)
+
+// ParseConsistency parses a consistency level, ignoring case.
+func ParseConsistency(s string) (Consistency, error) {
+	switch l := Consistency(strings.ToLower(strings.TrimSpace(s))); l {
+	case ConsistencyOne, ConsistencyQuorum, ConsistencyAll, ConsistencyAsync:
+		return l, nil
+	}
+	return "", fmt.Errorf("invalid write consistency %q; use one, quorum, all or async", s)
+}
+
+// RequestConsistency returns the level requested by r, or "" if r does not
+// set one.
+func RequestConsistency(r *http.Request) (Consistency, error) {
+	v := r.Header.Get(ConsistencyHeader)
+	if v == "" {
+		return "", nil
+	}
+	return ParseConsistency(v)
+}
+
+type consistencyKey struct{}
+
+// WithConsistency returns a context whose writes are replicated at level
+// instead of the configured one. An empty level changes nothing.
+func WithConsistency(ctx context.Context, level Consistency) context.Context {
+	if level == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, consistencyKey{}, level)
+}
+
+func (c *Cluster) consistency(ctx context.Context) Consistency {
+	if l, ok := ctx.Value(consistencyKey{}).(Consistency); ok {
+		return l
+	}
+	if c.Async() {
+		return ConsistencyAsync
+	}
+	return c.cfg.Consistency
+}
+
+// required returns how many of n replicas must acknowledge a write made
+// with ctx.
+func (c *Cluster) required(ctx context.Context, n int) int {
+	switch c.consistency(ctx) {
+	case ConsistencyOne, ConsistencyAsync:
+		return 1
+	case ConsistencyAll:
+		return n
+	}
+	return n/2 + 1
+}
@@ -0,0 +1,207 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// A scale-down of the StatefulSet removes the highest ordinal, so that is
+// the only replica that can be decommissioned unless membership is learned
+// by gossip, where any member can be and leaves once drained. Draining it
+// pushes every body it holds to the
+// replicas that own it once it is gone, then checks that the remaining
+// replicas have caught up: no hints or queued mutations are left for them
+// and their manifests match this replica's. Writes that land here during the
+// drain are picked up by another pass; if they keep coming the drain gives
+// up. The ordinal is reported removable only when every check passes.
+
+// ErrDecommissioning is returned while a drain is already running.
+var ErrDecommissioning = errors.New("decommission already running")
+
+const decommissionPasses = 3
+
+// DecommissionStatus reports the progress of a drain.
+type DecommissionStatus struct {
+	Running     bool      `json:"running"`
+	StartedAt   time.Time `json:"startedAt,omitempty"`
+	CompletedAt time.Time `json:"completedAt,omitempty"`
+	Checked     int       `json:"checked"`
+	Pushed      int       `json:"pushed"`
+	Removable   bool      `json:"removable"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// Decommission starts draining this replica in the background.
+func (c *Cluster) Decommission(ctx context.Context, store *objectd.Store) error {
+	if !c.Enabled() {
+		return fmt.Errorf("clustering is not enabled")
+	}
+	if last := c.cfg.Replicas - 1; !c.Gossip() && c.ordinal != last {
+		return fmt.Errorf("only the highest ordinal, %d, can be decommissioned", last)
+	}
+	st := DecommissionStatus{Running: true, StartedAt: time.Now().UTC()}
+	c.mu.Lock()
+	if c.decommission != nil && c.decommission.Running {
+		c.mu.Unlock()
+		return ErrDecommissioning
+	}
+	c.decommission = &st
+	c.mu.Unlock()
+	go c.drain(context.WithoutCancel(ctx), store, st)
+	return nil
+}
+
+// Decommissioning returns the state of the last drain, or nil if none
+// was started.
+func (c *Cluster) Decommissioning() *DecommissionStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.decommission == nil {
+		return nil
+	}
+	st := *c.decommission
+	return &st
+}
+
+func (c *Cluster) drain(ctx context.Context, store *objectd.Store, st DecommissionStatus) {
+	var rest []int
+	for _, o := range c.ordinals() {
+		if o != c.ordinal {
+			rest = append(rest, o)
+		}
+	}
+	ring := newRing(rest)
+	err := func() error {
+		for pass := 1; ; pass++ {
+			pushed, err := c.drainPass(ctx, store, ring, rest, &st)
+			if err != nil {
+				return err
+			}
+			if pushed == 0 {
+				break
+			}
+			if pass == decommissionPasses {
+				return fmt.Errorf("objects were still being written after %d passes; stop writing to this replica and retry", pass)
+			}
+		}
+		return c.verifyDrained(ctx, store, rest)
+	}()
+	st.Running = false
+	st.CompletedAt = time.Now().UTC()
+	st.Removable = err == nil
+	if err != nil {
+		st.LastError = err.Error()
+		log.Printf("decommission: %v", err)
+	} else {
+		log.Printf("decommission: ordinal %d is removable after pushing %d bodies", c.ordinal, st.Pushed)
+		if c.Gossip() {
+			c.leave(ctx)
+		}
+	}
+	c.setDecommission(st)
+	removable := 0.0
+	if st.Removable {
+		removable = 1
+	}
+	metrics.SetGauge("entity_cluster_decommission_removable", nil, removable)
+}
+
+// drainPass pushes every body held here to its owners among rest, placed
+// on ring, that do not have it yet, and returns how many it pushed.
+func (c *Cluster) drainPass(ctx context.Context, store *objectd.Store, ring []ringPoint, rest []int, st *DecommissionStatus) (int, error) {
+	pushed := 0
+	for _, m := range store.HeldObjects(ctx) {
+		for _, o := range c.ownersOn(ring, rest, m.Bucket, m.Key) {
+			held, err := c.holds(ctx, o, m)
+			if err != nil {
+				return pushed, fmt.Errorf("peer %d: %w", o, err)
+			}
+			if held {
+				continue
+			}
+			h := hint{method: http.MethodPut, path: "/_cluster/replicate/objects/" + m.Bucket + "/" + m.Key, headers: ObjectHeaders(m), payload: ObjectPayload(ctx, store, m)}
+			status, err := c.send(ctx, o, h)
+			if errors.Is(err, ErrSuperseded) {
+				break
+			}
+			if err != nil {
+				return pushed, fmt.Errorf("push %s/%s to peer %d: %w", m.Bucket, m.Key, o, err)
+			}
+			if status < 200 || status >= 300 {
+				return pushed, fmt.Errorf("push %s/%s to peer %d: status %d", m.Bucket, m.Key, o, status)
+			}
+			pushed++
+			st.Pushed++
+		}
+		st.Checked++
+		if st.Checked%1000 == 0 {
+			c.setDecommission(*st)
+		}
+	}
+	c.setDecommission(*st)
+	return pushed, nil
+}
+
+// holds reports whether ordinal has the body of m, or a newer version.
+func (c *Cluster) holds(ctx context.Context, ordinal int, m objectd.ObjectMeta) (bool, error) {
+	seq, _, err := c.peerObject(ctx, ordinal, m.Bucket, m.Key, true)
+	if errors.Is(err, objectd.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return seq >= m.Seq, nil
+}
+
+// verifyDrained checks that nothing is left to deliver to the remaining
+// replicas and that they list the same objects as this one.
+func (c *Cluster) verifyDrained(ctx context.Context, store *objectd.Store, rest []int) error {
+	local := map[string]uint64{}
+	for _, b := range store.Manifest(ctx).Buckets {
+		local[b.Name] = b.Root
+	}
+	for _, i := range rest {
+		if c.hintCount(i) > 0 {
+			c.deliverHints(ctx, i)
+		}
+		if n := c.hintCount(i); n > 0 {
+			return fmt.Errorf("peer %d still has %d undelivered hints", i, n)
+		}
+		if q := c.queues[i]; q != nil {
+			q.mu.Lock()
+			n := q.count
+			q.mu.Unlock()
+			if n > 0 {
+				return fmt.Errorf("peer %d still has %d queued mutations", i, n)
+			}
+		}
+		remote, err := c.peerManifest(ctx, i)
+		if err != nil {
+			return fmt.Errorf("peer %d: %w", i, err)
+		}
+		roots := map[string]uint64{}
+		for _, b := range remote.Buckets {
+			roots[b.Name] = b.Root
+		}
+		for name, root := range local {
+			if r, ok := roots[name]; !ok || r != root {
+				return fmt.Errorf("peer %d has not caught up with bucket %s", i, name)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) setDecommission(st DecommissionStatus) {
+	c.mu.Lock()
+	c.decommission = &st
+	c.mu.Unlock()
+}
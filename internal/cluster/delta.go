@@ -0,0 +1,87 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// fetchDelta pulls the body of a pending object from ordinal, transferring
+// only the chunks that the body it replaced does not hold.
+func (c *Cluster) fetchDelta(ctx context.Context, store *objectd.Store, p objectd.PendingFetch, ordinal int) error {
+	remote, err := c.peerChunkMap(ctx, ordinal, p.Bucket, p.Key)
+	if err != nil {
+		return err
+	}
+	if remote.Seq != p.Seq {
+		return fmt.Errorf("peer %d holds seq %d", ordinal, remote.Seq)
+	}
+	res, err := store.CompleteFetchDelta(ctx, p.Bucket, p.Key, remote, func(i int) (io.ReadCloser, error) {
+		body, err := c.peerChunk(ctx, ordinal, p.Bucket, p.Key, p.Seq, i)
+		if err != nil {
+			return nil, err
+		}
+		return c.throttled(ctx, body), nil
+	})
+	metrics.AddCounter("entity_cluster_delta_fetch_bytes_total", map[string]string{"source": "local"}, float64(res.Reused))
+	metrics.AddCounter("entity_cluster_delta_fetch_bytes_total", map[string]string{"source": "peer"}, float64(res.Fetched))
+	return err
+}
+
+// serveChunks hands a peer the chunk map of a body, or with index set one
+// of its chunks, for a delta fetch.
+func (h *ReplicationHandler) serveChunks(w http.ResponseWriter, r *http.Request, rest string) {
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	if !q.Has("index") {
+		m, err := h.Store.ObjectChunkMap(r.Context(), parts[0], parts[1])
+		if err != nil {
+			chunkError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(m)
+		return
+	}
+	seq, err := strconv.ParseUint(q.Get("seq"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid seq", http.StatusBadRequest)
+		return
+	}
+	i, err := strconv.Atoi(q.Get("index"))
+	if err != nil {
+		http.Error(w, "invalid index", http.StatusBadRequest)
+		return
+	}
+	f, err := h.Store.OpenChunk(r.Context(), parts[0], parts[1], seq, i)
+	if err != nil {
+		chunkError(w, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = io.Copy(w, f)
+}
+
+func chunkError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, objectd.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, objectd.ErrNoChunkMap), errors.Is(err, objectd.ErrObjectPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,196 @@
+package cluster
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// Every replica keeps the highest leadership epoch it has seen and stamps
+// it on the requests it sends to peers. A replica that becomes leader
+// claims a new epoch, and a replica refuses mutations stamped with an epoch
+// older than its own, so a leader cut off from the others cannot apply its
+// writes on replicas that have since followed a newer leader; it learns the
+// newer epoch from the refusal. With a leader lease the epoch is derived
+// from the lease's transition count, which only the API server increments.
+// Without one, leadership comes from each replica's own health probes and
+// two replicas can briefly claim the same epoch.
+
+const EpochHeader = "X-ENTITY-Epoch"
+
+// epochKey carries a refusing replica's epoch in a gRPC trailer.
+const epochKey = "x-entity-epoch"
+
+// OpenEpoch loads the epoch saved at path and saves it there on every
+// change.
+func (c *Cluster) OpenEpoch(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epochPath = path
+	if len(data) > 0 {
+		if c.epoch, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+			return err
+		}
+	}
+	metrics.SetGauge("entity_cluster_epoch", nil, float64(c.epoch))
+	return nil
+}
+
+// Epoch returns the highest leadership epoch seen.
+func (c *Cluster) Epoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch
+}
+
+// AcceptEpoch reports whether a mutation stamped with epoch may be applied,
+// and adopts epoch if it is newer than this replica's.
+func (c *Cluster) AcceptEpoch(epoch uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if epoch < c.epoch {
+		metrics.AddCounter("entity_cluster_stale_epoch_rejections_total", nil, 1)
+		return false
+	}
+	if epoch > c.epoch {
+		c.setEpochLocked(epoch, false)
+	}
+	return true
+}
+
+// claimEpoch makes this replica the owner of epoch, or of the epoch after
+// the newest one seen if epoch is zero.
+func (c *Cluster) claimEpoch(epoch uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case epoch == 0 && !c.epochOwned:
+		c.setEpochLocked(c.epoch+1, true)
+		log.Printf("leadership epoch %d claimed by ordinal %d", c.epoch, c.ordinal)
+	case epoch > c.epoch:
+		c.setEpochLocked(epoch, true)
+	}
+}
+
+// RunLeadershipEpochs claims a new epoch whenever this replica becomes the
+// leader by probing, checking every interval until ctx is cancelled. With a
+// lease, epochs follow the lease instead.
+func (c *Cluster) RunLeadershipEpochs(ctx context.Context, interval time.Duration) {
+	if !c.Enabled() || c.cfg.LeaderLease != "" {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		c.checkLeadership(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Cluster) checkLeadership(ctx context.Context) {
+	if c.IsLeader(ctx) {
+		c.claimEpoch(0)
+		return
+	}
+	c.mu.Lock()
+	c.epochOwned = false
+	c.mu.Unlock()
+}
+
+func (c *Cluster) setEpochLocked(epoch uint64, owned bool) {
+	c.epoch, c.epochOwned = epoch, owned
+	metrics.SetGauge("entity_cluster_epoch", nil, float64(epoch))
+	if c.epochPath == "" {
+		return
+	}
+	tmp := c.epochPath + ".tmp"
+	err := os.WriteFile(tmp, []byte(strconv.FormatUint(epoch, 10)), 0o644)
+	if err == nil {
+		err = os.Rename(tmp, c.epochPath)
+	}
+	if err != nil {
+		log.Printf("save leadership epoch %d: %v", epoch, err)
+	}
+}
+
+// stampEpoch returns headers with the current epoch added, so that a
+// mutation delivered late from a hint or queue still carries the epoch it
+// was made in.
+func (c *Cluster) stampEpoch(headers map[string]string) map[string]string {
+	epoch := c.Epoch()
+	if epoch == 0 {
+		return headers
+	}
+	out := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		out[k] = v
+	}
+	out[EpochHeader] = strconv.FormatUint(epoch, 10)
+	return out
+}
+
+// observeRefusal adopts the epoch of a peer that refused a request as
+// stale, so that this replica stops acting on an old leadership.
+func (c *Cluster) observeRefusal(ordinal int, resp *http.Response) {
+	if resp.StatusCode == http.StatusConflict {
+		c.adoptPeerEpoch(ordinal, resp.Header.Get(EpochHeader))
+	}
+}
+
+// adoptPeerEpoch adopts the epoch a peer sent along with a refusal.
+func (c *Cluster) adoptPeerEpoch(ordinal int, value string) {
+	epoch, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if epoch > c.epoch {
+		log.Printf("peer %d is at leadership epoch %d, ahead of %d; its writes from this replica are refused", ordinal, epoch, c.epoch)
+		c.setEpochLocked(epoch, false)
+	}
+}
+
+// checkEpoch refuses a replicated mutation stamped with a stale epoch and
+// reports whether it may be applied.
+func (h *ReplicationHandler) checkEpoch(w http.ResponseWriter, r *http.Request) bool {
+	if h.Cluster == nil || r.Method == http.MethodGet || r.Method == http.MethodHead || r.URL.Path == "/_cluster/gossip" {
+		return true
+	}
+	epoch, err := strconv.ParseUint(r.Header.Get(EpochHeader), 10, 64)
+	if err != nil || h.Cluster.AcceptEpoch(epoch) {
+		return true
+	}
+	w.Header().Set(EpochHeader, strconv.FormatUint(h.Cluster.Epoch(), 10))
+	http.Error(w, "stale leadership epoch "+strconv.FormatUint(epoch, 10), http.StatusConflict)
+	return false
+}
+
+// checkEpochRPC is checkEpoch for the replication service. A refusal
+// carries this replica's epoch in the trailer.
+func (h *ReplicationHandler) checkEpochRPC(ctx context.Context, epoch uint64) error {
+	if h.Cluster == nil || epoch == 0 || h.Cluster.AcceptEpoch(epoch) {
+		return nil
+	}
+	_ = grpc.SetTrailer(ctx, metadata.Pairs(epochKey, strconv.FormatUint(h.Cluster.Epoch(), 10)))
+	return status.Errorf(codes.FailedPrecondition, "stale leadership epoch %d", epoch)
+}
@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	ClientAddrHeader    = "X-ENTITY-Client-Addr"
+	clientAddrSigHeader = "X-ENTITY-Client-Addr-Sig"
+)
+
+// SetClientAddr records the client address resolved by this node on a
+// request before it is forwarded to a peer. The address is signed with the
+// primary admin token and bound to the request signature, so clients cannot
+// supply it themselves.
+func (c *Cluster) SetClientAddr(r *http.Request, addr string) {
+	r.Header.Set(ClientAddrHeader, addr)
+	r.Header.Set(clientAddrSigHeader, clientAddrSig(c.token(), addr, r.Header.Get("Authorization")))
+}
+
+// ClientAddr returns the client address set by the peer that forwarded r.
+func (c *Cluster) ClientAddr(r *http.Request) (string, bool) {
+	addr := r.Header.Get(ClientAddrHeader)
+	sig := r.Header.Get(clientAddrSigHeader)
+	if addr == "" || sig == "" {
+		return "", false
+	}
+	if c.cfg.Tokens == nil {
+		return "", false
+	}
+	// The forwarding peer may sign with a token that is not yet, or no
+	// longer, this replica's primary one.
+	for _, token := range c.cfg.Tokens.Peer() {
+		if hmac.Equal([]byte(sig), []byte(clientAddrSig(token, addr, r.Header.Get("Authorization")))) {
+			return addr, true
+		}
+	}
+	return "", false
+}
+
+func clientAddrSig(token, addr, authorization string) string {
+	m := hmac.New(sha256.New, []byte(token))
+	m.Write([]byte(addr + "\n" + authorization))
+	return hex.EncodeToString(m.Sum(nil))
+}
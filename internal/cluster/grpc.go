@@ -0,0 +1,235 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/mchenetz/entity/internal/cluster/pb"
+)
+
+// Replicas serve the gRPC service entity.cluster.v1.Replication, defined in
+// pb/replication.proto, on the admin port next to the HTTP endpoints and
+// over the same mTLS. A replica advertises it in its health response, and
+// its peers use it from then on: every mutation is a typed message that the
+// receiver applies to its store, object bodies are streamed in chunks, and
+// health, commits and aborts, manifests, chunk maps and snapshots are typed
+// calls. Gossip stays on HTTP, since seeds are reached before anything is
+// known about them, and so do usage reports and last-used lookups, which
+// are not replication.
+//
+// The HTTP endpoints remain for one release, so that pods of the previous
+// release, which only speak HTTP, keep replicating with upgraded pods during
+// a rolling upgrade, and so that a rollback works. They are removed in the
+// release after; entity_cluster_http_replication_requests_total counts the
+// requests they still serve. Hints and the asynchronous replication queues
+// keep recording mutations as the HTTP requests they were sent as, so that
+// queues written by the previous release are delivered too; parseMutation
+// turns them into messages when they are sent over gRPC.
+
+const (
+	// ReplicationService is the name of the gRPC service.
+	ReplicationService = "entity.cluster.v1.Replication"
+	// ProtocolsHeader lists the gRPC services in a health response.
+	ProtocolsHeader = "X-ENTITY-Protocols"
+
+	// chunkSize is how much of a body one message carries.
+	chunkSize = 256 << 10
+)
+
+// errNoRPC is returned for a peer that is reached over HTTP instead.
+var errNoRPC = errors.New("peer does not serve " + ReplicationService)
+
+// rpcClient returns a client of ordinal's replication service, or nil if
+// the peer has not advertised it.
+func (c *Cluster) rpcClient(ordinal int) pb.ReplicationClient {
+	admin := c.adminURL(ordinal)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.peers[ordinal].GRPC || c.tlsConfig == nil {
+		return nil
+	}
+	conn := c.conns[admin]
+	if conn == nil {
+		u, err := url.Parse(admin)
+		if err != nil {
+			return nil
+		}
+		conn, err = grpc.NewClient(u.Host, grpc.WithTransportCredentials(credentials.NewTLS(c.tlsConfig)))
+		if err != nil {
+			log.Printf("peer %d: %v", ordinal, err)
+			return nil
+		}
+		c.conns[admin] = conn
+	}
+	return pb.NewReplicationClient(conn)
+}
+
+// rpcContext adds the credentials HTTP requests carry in headers.
+func (c *Cluster) rpcContext(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token(), "x-entity-internal-replication", "true")
+}
+
+// rpcErr returns errNoRPC, and reaches ordinal over HTTP from then on, if
+// err shows that the peer does not serve the service any more.
+func (c *Cluster) rpcErr(ordinal int, err error) error {
+	if status.Code(err) != codes.Unimplemented {
+		return err
+	}
+	c.mu.Lock()
+	if p, ok := c.peers[ordinal]; ok {
+		p.GRPC = false
+		c.peers[ordinal] = p
+	}
+	c.mu.Unlock()
+	log.Printf("peer %d no longer serves %s; using HTTP", ordinal, ReplicationService)
+	return errNoRPC
+}
+
+// sendRPC applies h on ordinal through Mutate and returns the HTTP status
+// the peer's endpoint would have answered with. A mutation that cannot be
+// parsed is answered the way the endpoint would answer it.
+func (c *Cluster) sendRPC(ctx context.Context, ordinal int, h hint) (int, error) {
+	client := c.rpcClient(ordinal)
+	if client == nil {
+		return 0, errNoRPC
+	}
+	u, err := url.Parse(h.path)
+	if err != nil {
+		return http.StatusBadRequest, nil
+	}
+	header := http.Header{}
+	for k, v := range h.headers {
+		header.Set(k, v)
+	}
+	body, err := c.openPayload(ctx, h)
+	if err != nil {
+		return 0, err
+	}
+	if rc, ok := body.(io.Closer); ok {
+		defer rc.Close()
+	}
+	m, data, err := parseMutation(h.method, u, header, body)
+	if err != nil {
+		log.Printf("peer %d: cannot send %s %s: %v", ordinal, h.method, h.path, err)
+		return httpStatus(status.Code(err)), nil
+	}
+	// As over HTTP, a change recorded before any epoch was known is sent
+	// with the current one.
+	if m.Epoch == 0 {
+		m.Epoch = c.Epoch()
+	}
+	// As over HTTP, only streamed payloads go without an overall timeout.
+	var cancel context.CancelFunc
+	if h.payload.streamed() {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, c.httpClient.Timeout)
+	}
+	defer cancel()
+	stream, err := client.Mutate(c.rpcContext(ctx))
+	if err != nil {
+		return 0, c.rpcErr(ordinal, err)
+	}
+	err = stream.Send(&pb.MutateRequest{Part: &pb.MutateRequest_Mutation{Mutation: m}})
+	if err == nil && data != nil {
+		err = sendChunks(data, func(b []byte) error {
+			return stream.Send(&pb.MutateRequest{Part: &pb.MutateRequest_Data{Data: b}})
+		})
+	}
+	// io.EOF means the peer ended the stream; CloseAndRecv returns why.
+	if err != nil && err != io.EOF {
+		return 0, c.rpcErr(ordinal, err)
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		if err := c.rpcErr(ordinal, err); errors.Is(err, errNoRPC) {
+			return 0, err
+		}
+		if status.Code(err) == codes.FailedPrecondition {
+			if v := stream.Trailer().Get(epochKey); len(v) > 0 {
+				c.adoptPeerEpoch(ordinal, v[0])
+			}
+		}
+		return httpStatus(status.Code(err)), nil
+	}
+	return http.StatusNoContent, nil
+}
+
+// sendChunks passes the rest of r to send in pieces of chunkSize. Each
+// piece is a new slice, since a sent message must not change afterwards.
+func sendChunks(r io.Reader, send func([]byte) error) error {
+	for {
+		buf := make([]byte, chunkSize)
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := send(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// chunkReader reads a body from the data of a stream's messages.
+type chunkReader struct {
+	recv func() ([]byte, error)
+	buf  []byte
+	// cancel ends a client stream on Close.
+	cancel context.CancelFunc
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		b, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = b
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	return nil
+}
+
+// httpStatus returns the HTTP status the endpoints answer with for a gRPC
+// status code.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusNoContent
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.FailedPrecondition:
+		return http.StatusConflict
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,153 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/mchenetz/entity/internal/cluster/pb"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// rpcServer serves the replication service for a ReplicationHandler, which
+// has checked the caller's credentials already.
+type rpcServer struct {
+	pb.UnimplementedReplicationServer
+	h *ReplicationHandler
+}
+
+func (s *rpcServer) Health(ctx context.Context, _ *pb.HealthRequest) (*pb.HealthResponse, error) {
+	if s.h.Cluster != nil && s.h.Cluster.Bootstrapping() {
+		return nil, status.Error(codes.Unavailable, "bootstrapping")
+	}
+	return &pb.HealthResponse{TimeUnixNano: time.Now().UnixNano(), ReadOnly: s.h.Store.ReadOnly()}, nil
+}
+
+func (s *rpcServer) Mutate(stream pb.Replication_MutateServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	m := req.GetMutation()
+	if m == nil {
+		return status.Error(codes.InvalidArgument, "the first message carries no mutation")
+	}
+	if err := s.h.checkEpochRPC(stream.Context(), m.Epoch); err != nil {
+		return err
+	}
+	body := &chunkReader{recv: func() ([]byte, error) {
+		req, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return req.GetData(), nil
+	}}
+	if err := s.h.applyMutation(stream.Context(), m, body); err != nil {
+		return err
+	}
+	return stream.SendAndClose(&pb.MutateResponse{})
+}
+
+func (s *rpcServer) Commit(ctx context.Context, req *pb.CommitRequest) (*pb.CommitResponse, error) {
+	if err := s.h.checkEpochRPC(ctx, req.Epoch); err != nil {
+		return nil, err
+	}
+	seq, err := s.h.commit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CommitResponse{Seq: seq}, nil
+}
+
+func (s *rpcServer) Abort(ctx context.Context, req *pb.AbortRequest) (*pb.AbortResponse, error) {
+	if err := s.h.checkEpochRPC(ctx, req.Epoch); err != nil {
+		return nil, err
+	}
+	if err := s.h.abort(ctx, req); err != nil {
+		return nil, err
+	}
+	return &pb.AbortResponse{}, nil
+}
+
+func (s *rpcServer) GetObject(req *pb.GetObjectRequest, stream pb.Replication_GetObjectServer) error {
+	m, f, err := s.h.Store.OpenObject(stream.Context(), req.Bucket, req.Key)
+	if err != nil {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	defer f.Close()
+	header := &pb.ObjectHeader{Seq: m.Seq, Size: m.Size}
+	if err := stream.Send(&pb.GetObjectResponse{Part: &pb.GetObjectResponse_Header{Header: header}}); err != nil || req.Head {
+		return err
+	}
+	return sendChunks(f, func(b []byte) error {
+		return stream.Send(&pb.GetObjectResponse{Part: &pb.GetObjectResponse_Data{Data: b}})
+	})
+}
+
+func (s *rpcServer) GetChunkMap(ctx context.Context, req *pb.GetChunkMapRequest) (*pb.ChunkMap, error) {
+	m, err := s.h.Store.ObjectChunkMap(ctx, req.Bucket, req.Key)
+	if err != nil {
+		return nil, chunkStatus(err)
+	}
+	out := &pb.ChunkMap{Seq: m.Seq, Etag: m.ETag, Compression: m.Compression}
+	for _, c := range m.Chunks {
+		out.Chunks = append(out.Chunks, &pb.ChunkSum{Size: c.Size, Sha256: c.SHA256})
+	}
+	return out, nil
+}
+
+func (s *rpcServer) GetChunk(req *pb.GetChunkRequest, stream pb.Replication_GetChunkServer) error {
+	f, err := s.h.Store.OpenChunk(stream.Context(), req.Bucket, req.Key, req.Seq, int(req.Index))
+	if err != nil {
+		return chunkStatus(err)
+	}
+	defer f.Close()
+	return sendChunks(f, func(b []byte) error {
+		return stream.Send(&pb.Chunk{Data: b})
+	})
+}
+
+func (s *rpcServer) GetManifest(ctx context.Context, _ *pb.GetManifestRequest) (*pb.Manifest, error) {
+	m := s.h.Store.Manifest(ctx)
+	out := &pb.Manifest{Clock: m.Clock}
+	for _, b := range m.Buckets {
+		out.Buckets = append(out.Buckets, &pb.BucketManifest{Name: b.Name, Root: b.Root, Ranges: b.Ranges})
+	}
+	return out, nil
+}
+
+func (s *rpcServer) GetManifestRange(ctx context.Context, req *pb.GetManifestRangeRequest) (*pb.ManifestRange, error) {
+	if req.Range < 0 || req.Range >= objectd.ManifestRanges {
+		return nil, status.Error(codes.InvalidArgument, "invalid range")
+	}
+	changes, err := s.h.Store.ManifestRange(ctx, req.Bucket, int(req.Range))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	out := &pb.ManifestRange{}
+	for _, c := range changes {
+		out.Changes = append(out.Changes, &pb.ObjectChange{
+			Bucket: c.Bucket, Key: c.Key, Seq: c.Seq, Deleted: c.Deleted, Etag: c.ETag, Size: c.Size,
+			StorageClass: c.StorageClass, ContentType: c.ContentType, ExpiresAt: c.ExpiresAt,
+		})
+	}
+	return out, nil
+}
+
+func (s *rpcServer) GetSnapshot(ctx context.Context, _ *pb.GetSnapshotRequest) (*pb.Snapshot, error) {
+	return snapshotToPB(s.h.Store.Snapshot(ctx)), nil
+}
+
+// chunkStatus is the gRPC counterpart of chunkError.
+func chunkStatus(err error) error {
+	switch {
+	case errors.Is(err, objectd.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, objectd.ErrNoChunkMap), errors.Is(err, objectd.ErrObjectPending):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
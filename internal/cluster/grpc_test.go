@@ -0,0 +1,323 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mchenetz/entity/internal/cluster/pb"
+	"github.com/mchenetz/entity/internal/objectd"
+	"github.com/mchenetz/entity/internal/tokens"
+)
+
+// writePKI writes a CA and a certificate for 127.0.0.1 signed by it, usable
+// by both ends of an mTLS connection, and returns their paths.
+func writePKI(t *testing.T) (caFile, certFile, keyFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "entity-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "entity-0"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	return write("ca.pem", "CERTIFICATE", caDER), write("tls.crt", "CERTIFICATE", leafDER), write("tls.key", "EC PRIVATE KEY", keyDER)
+}
+
+// startPeer serves a replication handler for a fresh store as peer 1 of a
+// new cluster and returns both. Without rpc the peer answers like a release
+// that does not route the gRPC service.
+func startPeer(t *testing.T, rpc bool) (*Cluster, *objectd.Store) {
+	t.Helper()
+	caFile, certFile, keyFile := writePKI(t)
+	store, err := objectd.OpenStoreWithOptions(t.TempDir(), objectd.StoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	mux := http.NewServeMux()
+	secret := tokens.New("secret", "")
+	h := NewReplicationHandler(store, secret)
+	mux.Handle("/_cluster/", h)
+	if rpc {
+		mux.Handle("/"+ReplicationService+"/", h)
+	}
+	srv := httptest.NewUnstartedServer(mux)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(b)
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	c := New(Config{NodeID: "0", Seeds: []string{srv.URL}, Tokens: secret, TLSEnabled: true, CAFile: caFile, CertFile: certFile, KeyFile: keyFile})
+	c.members[1] = &Member{Ordinal: 1, URL: srv.URL}
+	t.Cleanup(func() {
+		for _, conn := range c.conns {
+			_ = conn.Close()
+		}
+	})
+	return c, store
+}
+
+func TestReplicationOverGRPC(t *testing.T) {
+	ctx := context.Background()
+	c, store := startPeer(t, true)
+	if !c.health(ctx, 1) {
+		t.Fatal("peer is not healthy")
+	}
+	if !c.peers[1].GRPC {
+		t.Fatal("peer does not advertise gRPC")
+	}
+
+	status, err := c.send(ctx, 1, hint{method: http.MethodPost, path: "/_cluster/replicate/buckets/photos"})
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("create bucket: %d %v", status, err)
+	}
+	// Larger than a chunk, so that it is streamed in several.
+	data := bytes.Repeat([]byte("entity"), chunkSize/3)
+	headers := map[string]string{SeqHeader: "7", SizeHeader: strconv.Itoa(len(data))}
+	status, err = c.send(ctx, 1, hint{method: http.MethodPut, path: "/_cluster/replicate/objects/photos/a.jpg", headers: headers, payload: BytesPayload(data)})
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("put object: %d %v", status, err)
+	}
+	m, err := store.GetObjectMeta(ctx, "photos", "a.jpg")
+	if err != nil || m.Seq != 7 || m.Size != int64(len(data)) {
+		t.Fatalf("stored %+v, %v", m, err)
+	}
+
+	seq, body, err := c.peerObject(ctx, 1, "photos", "a.jpg", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(body)
+	_ = body.Close()
+	if err != nil || seq != 7 || !bytes.Equal(got, data) {
+		t.Fatalf("pulled seq %d, %d bytes, %v", seq, len(got), err)
+	}
+	if _, _, err := c.peerObject(ctx, 1, "photos", "missing", true); !errors.Is(err, objectd.ErrNotFound) {
+		t.Fatalf("missing object: %v", err)
+	}
+
+	var changes int
+	for i := 0; i < objectd.ManifestRanges; i++ {
+		cs, err := c.peerManifestRange(ctx, 1, "photos", i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes += len(cs)
+	}
+	if changes != 1 {
+		t.Fatalf("manifest lists %d changes", changes)
+	}
+
+	// A mutation refused by the peer comes back with its status.
+	status, err = c.send(ctx, 1, hint{method: http.MethodPut, path: "/_cluster/replicate/objects/missing/a.jpg", payload: BytesPayload(data)})
+	if err != nil || status != http.StatusBadRequest {
+		t.Fatalf("invalid mutation: %d %v", status, err)
+	}
+	if !c.peers[1].GRPC {
+		t.Fatal("peer was reached over HTTP")
+	}
+}
+
+func TestReplicationFallsBackToHTTP(t *testing.T) {
+	ctx := context.Background()
+	c, store := startPeer(t, false)
+	if !c.health(ctx, 1) {
+		t.Fatal("peer is not healthy")
+	}
+	status, err := c.send(ctx, 1, hint{method: http.MethodPost, path: "/_cluster/replicate/buckets/photos"})
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("create bucket: %d %v", status, err)
+	}
+	if c.peers[1].GRPC {
+		t.Fatal("peer is still reached over gRPC")
+	}
+	if _, err := store.GetBucket(ctx, "photos"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := c.peerManifest(ctx, 1)
+	if err != nil || len(m.Buckets) != 1 {
+		t.Fatalf("manifest %+v, %v", m, err)
+	}
+}
+
+func TestParseMutation(t *testing.T) {
+	seq := map[string]string{SeqHeader: "7"}
+	remote := map[string]string{SeqHeader: "7", OriginHeader: "2", SizeHeader: "5", ETagHeader: "abc"}
+	for _, tc := range []struct {
+		method, path string
+		headers      map[string]string
+		body         string
+		want         any
+	}{
+		{http.MethodPost, "/_cluster/replicate/buckets/photos", nil, "", &pb.Mutation_CreateBucket{}},
+		{http.MethodDelete, "/_cluster/replicate/buckets/photos?force=true", nil, "", &pb.Mutation_DeleteBucket{}},
+		{http.MethodPost, "/_cluster/replicate/buckets/photos/replication", nil, `{"paused":true}`, &pb.Mutation_SetReplicationPaused{}},
+		{http.MethodPost, "/_cluster/replicate/buckets/photos/trash", nil, `{"days":3}`, &pb.Mutation_SetBucketTrash{}},
+		{http.MethodPost, "/_cluster/replicate/buckets/photos/copies", nil, `{"copies":2}`, &pb.Mutation_SetBucketCopies{}},
+		{http.MethodPost, "/_cluster/replicate/buckets/photos/consistency", nil, `{"consistency":"all"}`, &pb.Mutation_SetBucketConsistency{}},
+		{http.MethodPost, "/_cluster/replicate/buckets/photos/config", nil, `{"versioning":"Enabled"}`, &pb.Mutation_SetBucketConfig{}},
+		{http.MethodPost, "/_cluster/replicate/buckets/photos/rename", nil, `{"name":"pictures"}`, &pb.Mutation_RenameBucket{}},
+		{http.MethodPost, "/_cluster/replicate/buckets/photos/federation", nil, `{"enabled":true}`, &pb.Mutation_SetFederation{}},
+		{http.MethodPost, "/_cluster/replicate/buckets/photos/federation", nil, `{"cursor":9}`, &pb.Mutation_SetFederationCursor{}},
+		{http.MethodPost, "/_cluster/replicate/buckets/photos/encryption", nil, `{"algorithm":"AES256"}`, &pb.Mutation_SetBucketEncryption{}},
+		{http.MethodPut, "/_cluster/replicate/objects/photos/a.jpg", seq, "hello", &pb.Mutation_PutObject{}},
+		{http.MethodDelete, "/_cluster/replicate/objects/photos/a.jpg", seq, "", &pb.Mutation_DeleteObject{}},
+		{http.MethodDelete, "/_cluster/replicate/versions/photos/v1/a.jpg", seq, "", &pb.Mutation_DeleteObjectVersion{}},
+		{http.MethodPut, "/_cluster/replicate/refs/photos/a.jpg", remote, "", &pb.Mutation_PutRemoteObject{}},
+		{http.MethodPost, "/_cluster/replicate/trash/photos/3", seq, "", &pb.Mutation_RestoreTrashed{}},
+		{http.MethodPost, "/_cluster/replicate/restore/photos/a.jpg?days=2", nil, "", &pb.Mutation_RestoreObject{}},
+		{http.MethodPost, "/_cluster/replicate/expiry/photos/a.jpg?at=2030-01-01T00:00:00Z", nil, "", &pb.Mutation_SetObjectExpiry{}},
+		{http.MethodPost, "/_cluster/replicate/access", nil, `{"accessKey":"AK","bucket":"photos"}`, &pb.Mutation_PutAccess{}},
+		{http.MethodDelete, "/_cluster/replicate/access/AK", nil, "", &pb.Mutation_DeleteAccess{}},
+		{http.MethodPost, "/_cluster/replicate/domains", nil, `{"host":"a.example.com","bucket":"photos"}`, &pb.Mutation_PutDomain{}},
+		{http.MethodDelete, "/_cluster/replicate/domains/a.example.com", nil, "", &pb.Mutation_DeleteDomain{}},
+		{http.MethodPost, "/_cluster/replicate/standby/promote", nil, "", &pb.Mutation_Promote{}},
+	} {
+		u, err := url.Parse(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := http.Header{}
+		for k, v := range tc.headers {
+			header.Set(k, v)
+		}
+		m, _, err := parseMutation(tc.method, u, header, strings.NewReader(tc.body))
+		if err != nil {
+			t.Errorf("%s %s: %v", tc.method, tc.path, err)
+			continue
+		}
+		if got, want := reflect.TypeOf(m.Op), reflect.TypeOf(tc.want); got != want {
+			t.Errorf("%s %s: got %v, want %v", tc.method, tc.path, got, want)
+		}
+	}
+	u, _ := url.Parse("/_cluster/replicate/unknown")
+	if _, _, err := parseMutation(http.MethodPost, u, http.Header{}, nil); !errors.Is(err, errNoMutation) {
+		t.Fatalf("unknown path: %v", err)
+	}
+}
+
+// fill sets every field of v, which must be settable, to a value that is
+// not its zero value.
+func fill(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("v")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		v.SetInt(7)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		v.SetUint(7)
+	case reflect.Float64:
+		v.SetFloat(1.5)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		k, e := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fill(k)
+		fill(e)
+		v.SetMapIndex(k, e)
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem())
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2030, 1, 2, 3, 4, 5, 6, time.UTC)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			fill(v.Field(i))
+		}
+	}
+}
+
+// TestMessagesRoundTrip checks that the messages carry every field of the
+// values they are converted from. The last use of an access key is kept by
+// each replica and not replicated.
+func TestMessagesRoundTrip(t *testing.T) {
+	var a objectd.AccessKey
+	fill(reflect.ValueOf(&a).Elem())
+	a.LastUsed = nil
+	if got, err := accessKeyFromPB(accessKeyToPB(a)); err != nil || !reflect.DeepEqual(got, a) {
+		t.Errorf("access key: got %+v, %v, want %+v", got, err, a)
+	}
+	var snap objectd.Snapshot
+	fill(reflect.ValueOf(&snap).Elem())
+	snap.Access[0].LastUsed = nil
+	if got, err := snapshotFromPB(snapshotToPB(snap)); err != nil || !reflect.DeepEqual(got, snap) {
+		t.Errorf("snapshot: got %+v, %v, want %+v", got, err, snap)
+	}
+}
@@ -0,0 +1,215 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// A mutation that could not be delivered to a peer is kept as a hint and
+// replayed in order once the peer answers its health check again, so a
+// restart does not leave the peer behind until anti-entropy notices. While a
+// peer has hints queued, new mutations for it are queued behind them rather
+// than sent out of order. Hints live in memory and are bounded per peer;
+// whatever is lost to a restart of this pod or to the bound is left to
+// anti-entropy.
+
+// DefaultHintMaxBytes bounds the payload queued for one peer.
+const DefaultHintMaxBytes = 256 << 20
+
+type hint struct {
+	method  string
+	path    string
+	headers map[string]string
+	payload Payload
+}
+
+type hintQueue struct {
+	hints   []hint
+	bytes   int64
+	dropped int
+}
+
+// queueHint appends a mutation for ordinal, dropping the oldest hints when
+// the queue would exceed its bound. Streamed payloads are read into memory,
+// since the stored body may be gone by the time the hint is delivered.
+func (c *Cluster) queueHint(ordinal int, h hint) {
+	if c.cfg.HintMaxBytes <= 0 {
+		return
+	}
+	p, fits, err := h.payload.load(c.cfg.HintMaxBytes)
+	if errors.Is(err, ErrSuperseded) {
+		return
+	}
+	if err != nil {
+		log.Printf("cannot keep a hint for peer %d: %v", ordinal, err)
+		fits = false
+	}
+	h.payload = p
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	q := c.hints[ordinal]
+	if q == nil {
+		q = &hintQueue{}
+		c.hints[ordinal] = q
+	}
+	size := h.payload.Size
+	dropped := 1
+	if fits {
+		dropped = 0
+		for q.bytes+size > c.cfg.HintMaxBytes {
+			q.bytes -= q.hints[0].payload.Size
+			q.hints = q.hints[1:]
+			dropped++
+		}
+		q.hints = append(q.hints, h)
+		q.bytes += size
+	}
+	if dropped > 0 {
+		q.dropped += dropped
+		metrics.AddCounter("entity_cluster_hints_dropped_total", map[string]string{"peer": strconv.Itoa(ordinal)}, float64(dropped))
+	}
+	c.hintMetricsLocked(ordinal, q)
+}
+
+// queueBehindHints queues h if ordinal already has hints waiting, and
+// reports whether it did.
+func (c *Cluster) queueBehindHints(ordinal int, h hint) bool {
+	c.mu.Lock()
+	q := c.hints[ordinal]
+	waiting := q != nil && len(q.hints) > 0
+	c.mu.Unlock()
+	if waiting {
+		c.queueHint(ordinal, h)
+	}
+	return waiting
+}
+
+// RunHintedHandoff delivers queued hints to peers whose health check
+// succeeds, every interval until ctx is cancelled.
+func (c *Cluster) RunHintedHandoff(ctx context.Context, interval time.Duration) {
+	if !c.Enabled() {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		for _, i := range c.ordinals() {
+			if i == c.ordinal || c.hintCount(i) == 0 || !c.health(ctx, i) {
+				continue
+			}
+			if n := c.deliverHints(ctx, i); n > 0 {
+				log.Printf("delivered %d hints to peer %d", n, i)
+			}
+		}
+	}
+}
+
+// deliverHints replays the hints of ordinal oldest first until one fails to
+// arrive. A hint the peer rejects outright is dropped, since sending it
+// again would not change the answer.
+func (c *Cluster) deliverHints(ctx context.Context, ordinal int) int {
+	n := 0
+	for {
+		c.mu.Lock()
+		q := c.hints[ordinal]
+		if q == nil || len(q.hints) == 0 {
+			c.mu.Unlock()
+			return n
+		}
+		h := q.hints[0]
+		c.mu.Unlock()
+		status, err := c.send(ctx, ordinal, h)
+		if err != nil || status >= 500 {
+			return n
+		}
+		if status < 200 || status >= 300 {
+			log.Printf("peer %d rejected hinted %s %s: status %d", ordinal, h.method, h.path, status)
+		}
+		c.mu.Lock()
+		q.hints[0] = hint{}
+		q.hints = q.hints[1:]
+		q.bytes -= h.payload.Size
+		c.hintMetricsLocked(ordinal, q)
+		c.mu.Unlock()
+		n++
+	}
+}
+
+// send delivers one mutation to ordinal and returns the response status,
+// over the replication service if the peer serves it.
+func (c *Cluster) send(ctx context.Context, ordinal int, h hint) (int, error) {
+	if status, err := c.sendRPC(ctx, ordinal, h); !errors.Is(err, errNoRPC) {
+		return status, err
+	}
+	return c.sendHTTP(ctx, ordinal, h)
+}
+
+// openPayload opens the body of h, throttled if it is streamed.
+func (c *Cluster) openPayload(ctx context.Context, h hint) (io.Reader, error) {
+	body, err := h.payload.reader()
+	if err != nil {
+		return nil, err
+	}
+	if rc, ok := body.(io.ReadCloser); ok && h.payload.streamed() {
+		body = c.throttled(ctx, rc)
+	}
+	return body, nil
+}
+
+// sendHTTP delivers h to the peer's HTTP endpoint. Streamed payloads go
+// through the client without an overall timeout.
+func (c *Cluster) sendHTTP(ctx context.Context, ordinal int, h hint) (int, error) {
+	body, err := c.openPayload(ctx, h)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, h.method, c.adminURL(ordinal)+h.path, body)
+	if err != nil {
+		if rc, ok := body.(io.Closer); ok {
+			_ = rc.Close()
+		}
+		return 0, err
+	}
+	c.setInternalHeaders(req)
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	client := c.httpClient
+	if h.payload.streamed() {
+		client = c.bulkClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	c.observeRefusal(ordinal, resp)
+	return resp.StatusCode, nil
+}
+
+func (c *Cluster) hintCount(ordinal int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if q := c.hints[ordinal]; q != nil {
+		return len(q.hints)
+	}
+	return 0
+}
+
+func (c *Cluster) hintMetricsLocked(ordinal int, q *hintQueue) {
+	labels := map[string]string{"peer": strconv.Itoa(ordinal)}
+	metrics.SetGauge("entity_cluster_hints", labels, float64(len(q.hints)))
+	metrics.SetGauge("entity_cluster_hint_bytes", labels, float64(q.bytes))
+}
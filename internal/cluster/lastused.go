@@ -0,0 +1,38 @@
+package cluster
+
+import (
+	"context"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// AccessLastUsed returns the last use of every access key on this replica
+// merged with that of every peer, the latest winning, and the ordinals of
+// the peers that did not answer. Each replica records the requests it
+// authenticated itself.
+func (c *Cluster) AccessLastUsed(ctx context.Context, store *objectd.Store) (map[string]objectd.LastUsed, []int) {
+	used := store.AccessLastUsed()
+	if !c.Enabled() {
+		return used, nil
+	}
+	var missing []int
+	for _, i := range c.ordinals() {
+		if i == c.ordinal {
+			continue
+		}
+		pctx, cancel := context.WithTimeout(ctx, c.cfg.PeerTimeout)
+		var peer map[string]objectd.LastUsed
+		err := c.getJSON(pctx, i, "/_cluster/access/last-used", &peer)
+		cancel()
+		if err != nil {
+			missing = append(missing, i)
+			continue
+		}
+		for k, u := range peer {
+			if u.Time.After(used[k].Time) {
+				used[k] = u
+			}
+		}
+	}
+	return used, missing
+}
@@ -0,0 +1,286 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// Without a lease, the leader is the lowest ordinal that answers its health
+// endpoint, which every mutation has to find out by probing. With
+// LeaderLease set, the pods instead compete for a coordination.k8s.io Lease
+// of that name in their namespace: the holder renews it every third of
+// LeaderLeaseDuration, and the others read it on the same schedule and
+// treat its holder as the leader. A lease that has not been renewed for
+// LeaderLeaseDuration, as measured on the local clock since its record last
+// changed, is taken over. While no valid lease is known, for example before
+// the first read or while the API server is unreachable, leader discovery
+// falls back to probing.
+//
+// The Kubernetes API is reached with the pod's service account, which needs
+// get, create and update on leases.
+
+const (
+	DefaultLeaderLeaseDuration = 15 * time.Second
+
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	leaseTimeLayout   = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+var errLeaseNotFound = errors.New("lease not found")
+
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// leaseView is the last lease record read, and when it last changed.
+type leaseView struct {
+	holder     string
+	renewTime  string
+	observedAt time.Time
+}
+
+// kubeClient is the little of a Kubernetes client that leader election
+// needs.
+type kubeClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newKubeClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in Kubernetes")
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	tr := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}
+	return &kubeClient{baseURL: "https://" + net.JoinHostPort(host, port), client: &http.Client{Timeout: 10 * time.Second, Transport: tr}}, nil
+}
+
+// do sends a request with the service account token, which is read every
+// time since the kubelet rotates it.
+func (k *kubeClient) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, k.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errLeaseNotFound
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	case out != nil:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+func (c *Cluster) leasePath(name bool) string {
+	p := "/apis/coordination.k8s.io/v1/namespaces/" + c.cfg.Namespace + "/leases"
+	if name {
+		p += "/" + c.cfg.LeaderLease
+	}
+	return p
+}
+
+// leaseIdentity is how this replica appears as the lease holder.
+func (c *Cluster) leaseIdentity() string {
+	if c.cfg.NodeID != "" {
+		return c.cfg.NodeID
+	}
+	return c.cfg.PodName
+}
+
+// leaseLeader returns the holder of the lease if it is known and valid.
+func (c *Cluster) leaseLeader() (int, bool) {
+	if c.cfg.LeaderLease == "" {
+		return 0, false
+	}
+	c.mu.Lock()
+	v := c.lease
+	c.mu.Unlock()
+	if v.holder == "" || time.Since(v.observedAt) >= c.cfg.LeaderLeaseDuration {
+		return 0, false
+	}
+	return parseOrdinal(v.holder), true
+}
+
+// RunLeaderElection competes for the leader lease until ctx is cancelled,
+// then hands the lease back if this replica holds it.
+func (c *Cluster) RunLeaderElection(ctx context.Context) {
+	if c.cfg.LeaderLease == "" || !c.Enabled() {
+		return
+	}
+	kube, err := newKubeClient()
+	if err != nil {
+		log.Printf("leader lease %s: %v; falling back to probing for the leader", c.cfg.LeaderLease, err)
+		return
+	}
+	t := time.NewTicker(c.cfg.LeaderLeaseDuration / 3)
+	defer t.Stop()
+	for {
+		if err := c.acquireOrRenew(ctx, kube); err != nil && ctx.Err() == nil {
+			log.Printf("leader lease %s: %v", c.cfg.LeaderLease, err)
+		}
+		leader := 0.0
+		if l, ok := c.leaseLeader(); ok && l == c.ordinal {
+			leader = 1
+		}
+		metrics.SetGauge("entity_cluster_leader", nil, leader)
+		select {
+		case <-ctx.Done():
+			c.releaseLease(kube)
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// acquireOrRenew reads the lease and takes it if it is free, expired or
+// already held here. A concurrent update by another replica makes the
+// write fail with a conflict, and the lease is read again next round.
+func (c *Cluster) acquireOrRenew(ctx context.Context, kube *kubeClient) error {
+	self := c.leaseIdentity()
+	now := time.Now()
+	var l lease
+	err := kube.do(ctx, http.MethodGet, c.leasePath(true), nil, &l)
+	if errors.Is(err, errLeaseNotFound) {
+		l = lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   leaseMetadata{Name: c.cfg.LeaderLease, Namespace: c.cfg.Namespace},
+			Spec:       c.leaseSpec(self, now, 0),
+		}
+		if err := kube.do(ctx, http.MethodPost, c.leasePath(false), l, &l); err != nil {
+			return err
+		}
+		log.Printf("leader lease %s: acquired by %s", c.cfg.LeaderLease, self)
+		c.observeLease(l, now)
+		c.claimEpoch(uint64(l.Spec.LeaseTransitions) + 1)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.observeLease(l, now)
+	if l.Spec.HolderIdentity != self && l.Spec.HolderIdentity != "" {
+		if _, ok := c.leaseLeader(); ok {
+			return nil
+		}
+		log.Printf("leader lease %s: taking over from %s", c.cfg.LeaderLease, l.Spec.HolderIdentity)
+	}
+	spec := c.leaseSpec(self, now, l.Spec.LeaseTransitions)
+	if l.Spec.HolderIdentity == self {
+		spec.AcquireTime = l.Spec.AcquireTime
+	} else {
+		spec.LeaseTransitions++
+	}
+	l.Spec = spec
+	if err := kube.do(ctx, http.MethodPut, c.leasePath(true), l, &l); err != nil {
+		return err
+	}
+	c.observeLease(l, now)
+	c.claimEpoch(uint64(l.Spec.LeaseTransitions) + 1)
+	return nil
+}
+
+func (c *Cluster) leaseSpec(holder string, now time.Time, transitions int) leaseSpec {
+	ts := now.UTC().Format(leaseTimeLayout)
+	return leaseSpec{
+		HolderIdentity:       holder,
+		LeaseDurationSeconds: int(c.cfg.LeaderLeaseDuration / time.Second),
+		AcquireTime:          ts,
+		RenewTime:            ts,
+		LeaseTransitions:     transitions,
+	}
+}
+
+// observeLease records a lease read at now. Expiry is measured from when
+// the record last changed here, so it does not depend on the holder's
+// clock.
+func (c *Cluster) observeLease(l lease, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l.Spec.HolderIdentity == c.lease.holder && l.Spec.RenewTime == c.lease.renewTime {
+		return
+	}
+	c.lease = leaseView{holder: l.Spec.HolderIdentity, renewTime: l.Spec.RenewTime, observedAt: now}
+}
+
+// releaseLease clears the holder so that another replica can take over
+// without waiting for the lease to expire.
+func (c *Cluster) releaseLease(kube *kubeClient) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var l lease
+	if err := kube.do(ctx, http.MethodGet, c.leasePath(true), nil, &l); err != nil || l.Spec.HolderIdentity != c.leaseIdentity() {
+		return
+	}
+	l.Spec.HolderIdentity = ""
+	l.Spec.LeaseDurationSeconds = 1
+	if err := kube.do(ctx, http.MethodPut, c.leasePath(true), l, nil); err != nil {
+		log.Printf("leader lease %s: release: %v", c.cfg.LeaderLease, err)
+		return
+	}
+	c.mu.Lock()
+	c.lease = leaseView{}
+	c.mu.Unlock()
+}
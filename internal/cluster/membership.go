@@ -0,0 +1,271 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// By default the replicas are the ordinals 0..Replicas-1 of the StatefulSet
+// and are reached through its headless service. With seeds configured,
+// membership is learned by gossip instead: every member announces its
+// ordinal and admin URL, and each interval exchanges its view with one
+// random member and one seed. A member's heartbeat only grows, so the
+// newest view of each member wins. A member that stops gossiping still
+// counts for quorums and placement, since it may only be restarting; it is
+// forgotten once it leaves or has been silent for MemberRemoveAfter.
+
+const (
+	DefaultGossipInterval    = time.Second
+	DefaultMemberRemoveAfter = time.Hour
+)
+
+// Member is one replica as seen through gossip. LastSeen is when this
+// replica last learned of a newer heartbeat.
+type Member struct {
+	Ordinal   int       `json:"ordinal"`
+	URL       string    `json:"url"`
+	Heartbeat uint64    `json:"heartbeat"`
+	Left      bool      `json:"left,omitempty"`
+	LastSeen  time.Time `json:"lastSeen,omitempty"`
+}
+
+// Gossip reports whether membership is learned by gossip.
+func (c *Cluster) Gossip() bool { return len(c.cfg.Seeds) > 0 }
+
+// initMembers starts the gossip view with this replica alone. The heartbeat
+// starts from the clock so that it keeps growing across restarts.
+func (c *Cluster) initMembers() {
+	if !c.Gossip() {
+		c.ring = newRing(c.ordinals())
+		return
+	}
+	url := c.cfg.AdvertiseURL
+	if url == "" {
+		url = c.serviceURL(c.ordinal)
+	}
+	c.members = map[int]*Member{c.ordinal: {Ordinal: c.ordinal, URL: url, Heartbeat: uint64(time.Now().UnixMilli()), LastSeen: time.Now().UTC()}}
+	c.ring = newRing([]int{c.ordinal})
+}
+
+// ordinals returns the ordinals of the current members in ascending order.
+func (c *Cluster) ordinals() []int {
+	if !c.Gossip() {
+		out := make([]int, c.cfg.Replicas)
+		for i := range out {
+			out[i] = i
+		}
+		return out
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ordinalsLocked()
+}
+
+func (c *Cluster) ordinalsLocked() []int {
+	out := make([]int, 0, len(c.members))
+	for o, m := range c.members {
+		if !m.Left {
+			out = append(out, o)
+		}
+	}
+	sort.Ints(out)
+	return out
+}
+
+// NextOrdinal returns the member after this one, wrapping around.
+func (c *Cluster) NextOrdinal() int {
+	members := c.ordinals()
+	for _, o := range members {
+		if o > c.ordinal {
+			return o
+		}
+	}
+	return members[0]
+}
+
+// Members returns the gossip view, or nil with static membership.
+func (c *Cluster) Members() []Member {
+	if !c.Gossip() {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.memberListLocked()
+}
+
+func (c *Cluster) memberListLocked() []Member {
+	out := make([]Member, 0, len(c.members))
+	for _, m := range c.members {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Ordinal < out[j].Ordinal })
+	return out
+}
+
+// MergeMembers folds a peer's view into this one and returns the result.
+func (c *Cluster) MergeMembers(in []Member) []Member {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now().UTC()
+	changed := false
+	for _, m := range in {
+		if m.Ordinal == c.ordinal {
+			if m.URL != c.members[c.ordinal].URL && m.Heartbeat > c.members[c.ordinal].Heartbeat {
+				log.Printf("gossip: ordinal %d is also claimed by %s", m.Ordinal, m.URL)
+			}
+			continue
+		}
+		cur, ok := c.members[m.Ordinal]
+		if ok && m.Heartbeat <= cur.Heartbeat {
+			continue
+		}
+		switch {
+		case !ok && !m.Left:
+			log.Printf("gossip: member %d joined at %s", m.Ordinal, m.URL)
+			changed = true
+		case ok && m.Left && !cur.Left:
+			log.Printf("gossip: member %d left", m.Ordinal)
+			changed = true
+		case ok && !m.Left && cur.Left:
+			log.Printf("gossip: member %d rejoined at %s", m.Ordinal, m.URL)
+			changed = true
+		}
+		m.LastSeen = now
+		c.members[m.Ordinal] = &m
+	}
+	if changed {
+		c.membersChangedLocked()
+	}
+	return c.memberListLocked()
+}
+
+// expireMembers forgets members that left or have been silent for too long.
+func (c *Cluster) expireMembers() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed := false
+	for o, m := range c.members {
+		if o != c.ordinal && time.Since(m.LastSeen) > c.cfg.MemberRemoveAfter {
+			if !m.Left {
+				log.Printf("gossip: forgetting member %d, silent since %s", o, m.LastSeen.Format(time.RFC3339))
+				changed = true
+			}
+			delete(c.members, o)
+		}
+	}
+	if changed {
+		c.membersChangedLocked()
+	}
+}
+
+func (c *Cluster) membersChangedLocked() {
+	ordinals := c.ordinalsLocked()
+	c.ring = newRing(ordinals)
+	metrics.SetGauge("entity_cluster_members", nil, float64(len(ordinals)))
+}
+
+// RunGossip exchanges membership with the other members every interval
+// until ctx is cancelled.
+func (c *Cluster) RunGossip(ctx context.Context, interval time.Duration) {
+	if !c.Gossip() {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		c.gossipRound(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Cluster) gossipRound(ctx context.Context) {
+	c.expireMembers()
+	c.mu.Lock()
+	self := c.members[c.ordinal]
+	self.Heartbeat++
+	self.LastSeen = time.Now().UTC()
+	var peers []string
+	for o, m := range c.members {
+		if o != c.ordinal && !m.Left {
+			peers = append(peers, m.URL)
+		}
+	}
+	selfURL := self.URL
+	c.mu.Unlock()
+	var targets []string
+	if len(peers) > 0 {
+		targets = append(targets, peers[rand.Intn(len(peers))])
+	}
+	if seed := c.cfg.Seeds[rand.Intn(len(c.cfg.Seeds))]; seed != selfURL && (len(targets) == 0 || seed != targets[0]) {
+		targets = append(targets, seed)
+	}
+	for _, url := range targets {
+		if err := c.exchange(ctx, url); err != nil && ctx.Err() == nil {
+			log.Printf("gossip with %s: %v", url, err)
+		}
+	}
+}
+
+// exchange sends this replica's view to url and merges the answer.
+func (c *Cluster) exchange(ctx context.Context, url string) error {
+	c.mu.Lock()
+	payload, err := json.Marshal(c.memberListLocked())
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"/_cluster/gossip", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	c.setInternalHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var members []Member
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		return err
+	}
+	c.MergeMembers(members)
+	return nil
+}
+
+// leave announces that this replica has left the cluster, so the others
+// stop counting it before it is shut down.
+func (c *Cluster) leave(ctx context.Context) {
+	c.mu.Lock()
+	self := c.members[c.ordinal]
+	self.Left = true
+	self.Heartbeat++
+	var peers []string
+	for o, m := range c.members {
+		if o != c.ordinal && !m.Left {
+			peers = append(peers, m.URL)
+		}
+	}
+	c.mu.Unlock()
+	for _, url := range peers {
+		if err := c.exchange(ctx, url); err != nil {
+			log.Printf("gossip: announcing departure to %s: %v", url, err)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/mchenetz/entity/internal/cluster/pb"
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// errNoMutation is returned by parseMutation for a request that is not a
+// replicated mutation.
+var errNoMutation = status.Error(codes.NotFound, "not a replicated mutation")
+
+const (
+	replicatePath = "/_cluster/replicate/"
+	bucketsPath   = replicatePath + "buckets/"
+)
+
+// parseMutation returns the mutation an HTTP replication request makes,
+// with the object body to write, if any. Errors are gRPC statuses.
+func parseMutation(method string, u *url.URL, header http.Header, body io.Reader) (*pb.Mutation, io.Reader, error) {
+	path := u.Path
+	rest, ok := strings.CutPrefix(path, replicatePath)
+	if !ok {
+		return nil, nil, errNoMutation
+	}
+	invalid := status.Error(codes.InvalidArgument, "invalid request")
+	decode := func(v any) error {
+		if body == nil || json.NewDecoder(body).Decode(v) != nil {
+			return status.Error(codes.InvalidArgument, "invalid body")
+		}
+		return nil
+	}
+	m := &pb.Mutation{}
+	var data io.Reader
+	switch {
+	case method == http.MethodPost && strings.HasPrefix(path, bucketsPath) && strings.HasSuffix(path, "/replication"):
+		var req struct {
+			Paused bool `json:"paused"`
+		}
+		if err := decode(&req); err != nil {
+			return nil, nil, err
+		}
+		m.Op = &pb.Mutation_SetReplicationPaused{SetReplicationPaused: &pb.SetReplicationPaused{Bucket: bucketOf(path, "/replication"), Paused: req.Paused}}
+	case method == http.MethodPost && strings.HasPrefix(path, bucketsPath) && strings.HasSuffix(path, "/trash"):
+		var req struct {
+			Days int32 `json:"days"`
+		}
+		if err := decode(&req); err != nil {
+			return nil, nil, err
+		}
+		m.Op = &pb.Mutation_SetBucketTrash{SetBucketTrash: &pb.SetBucketTrash{Bucket: bucketOf(path, "/trash"), Days: req.Days}}
+	case method == http.MethodPost && strings.HasPrefix(path, bucketsPath) && strings.HasSuffix(path, "/copies"):
+		var req struct {
+			Copies int32 `json:"copies"`
+		}
+		if err := decode(&req); err != nil {
+			return nil, nil, err
+		}
+		m.Op = &pb.Mutation_SetBucketCopies{SetBucketCopies: &pb.SetBucketCopies{Bucket: bucketOf(path, "/copies"), Copies: req.Copies}}
+	case method == http.MethodPost && strings.HasPrefix(path, bucketsPath) && strings.HasSuffix(path, "/consistency"):
+		var req struct {
+			Consistency string `json:"consistency"`
+		}
+		if err := decode(&req); err != nil {
+			return nil, nil, err
+		}
+		m.Op = &pb.Mutation_SetBucketConsistency{SetBucketConsistency: &pb.SetBucketConsistency{Bucket: bucketOf(path, "/consistency"), Consistency: req.Consistency}}
+	case method == http.MethodPost && strings.HasPrefix(path, bucketsPath) && strings.HasSuffix(path, "/config"):
+		var cfg objectd.BucketConfig
+		if err := decode(&cfg); err != nil {
+			return nil, nil, err
+		}
+		m.Op = &pb.Mutation_SetBucketConfig{SetBucketConfig: &pb.SetBucketConfig{
+			Bucket: bucketOf(path, "/config"), Versioning: cfg.Versioning, QuotaBytes: cfg.QuotaBytes, PublicRead: cfg.PublicRead, Encryption: cfg.Encryption,
+		}}
+	case method == http.MethodPost && strings.HasPrefix(path, bucketsPath) && strings.HasSuffix(path, "/rename"):
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := decode(&req); err != nil {
+			return nil, nil, err
+		}
+		m.Op = &pb.Mutation_RenameBucket{RenameBucket: &pb.RenameBucket{Bucket: bucketOf(path, "/rename"), Name: req.Name}}
+	case method == http.MethodPost && strings.HasPrefix(path, bucketsPath) && strings.HasSuffix(path, "/federation"):
+		var req struct {
+			Enabled *bool  `json:"enabled"`
+			Cursor  uint64 `json:"cursor"`
+		}
+		if err := decode(&req); err != nil {
+			return nil, nil, err
+		}
+		bucket := bucketOf(path, "/federation")
+		if req.Enabled != nil {
+			m.Op = &pb.Mutation_SetFederation{SetFederation: &pb.SetFederation{Bucket: bucket, Enabled: *req.Enabled, Cursor: req.Cursor}}
+		} else {
+			m.Op = &pb.Mutation_SetFederationCursor{SetFederationCursor: &pb.SetFederationCursor{Bucket: bucket, Cursor: req.Cursor}}
+		}
+	case method == http.MethodPost && strings.HasPrefix(path, bucketsPath) && strings.HasSuffix(path, "/encryption"):
+		var cfg objectd.EncryptionConfig
+		if err := decode(&cfg); err != nil {
+			return nil, nil, err
+		}
+		m.Op = &pb.Mutation_SetBucketEncryption{SetBucketEncryption: &pb.SetBucketEncryption{Bucket: bucketOf(path, "/encryption"), Algorithm: cfg.Algorithm}}
+	case method == http.MethodPost && strings.HasPrefix(path, bucketsPath):
+		m.Op = &pb.Mutation_CreateBucket{CreateBucket: &pb.CreateBucket{Bucket: bucketOf(path, "")}}
+	case method == http.MethodDelete && strings.HasPrefix(path, bucketsPath):
+		m.Op = &pb.Mutation_DeleteBucket{DeleteBucket: &pb.DeleteBucket{Bucket: bucketOf(path, ""), Force: u.Query().Get("force") == "true"}}
+	case method == http.MethodPost && strings.HasPrefix(rest, "trash/"):
+		bucket, id, ok := splitObject(strings.TrimPrefix(rest, "trash/"))
+		seq, hasSeq := requestSeqHeader(header)
+		n, err := strconv.ParseUint(id, 10, 64)
+		if !ok || !hasSeq || err != nil {
+			return nil, nil, invalid
+		}
+		m.Op = &pb.Mutation_RestoreTrashed{RestoreTrashed: &pb.RestoreTrashed{Bucket: bucket, Id: n, Seq: seq}}
+	case method == http.MethodPut && strings.HasPrefix(rest, "objects/"):
+		bucket, key, ok := splitObject(strings.TrimPrefix(rest, "objects/"))
+		if !ok {
+			return nil, nil, invalid
+		}
+		put := &pb.PutObject{Bucket: bucket, Key: key, Options: objectOptions(header)}
+		put.Seq, _ = requestSeqHeader(header)
+		if size, err := strconv.ParseInt(header.Get(SizeHeader), 10, 64); err == nil {
+			put.Size, put.Etag = size, header.Get(ETagHeader)
+		}
+		m.Op = &pb.Mutation_PutObject{PutObject: put}
+		data = body
+	case method == http.MethodDelete && strings.HasPrefix(rest, "objects/"):
+		bucket, key, ok := splitObject(strings.TrimPrefix(rest, "objects/"))
+		if !ok {
+			return nil, nil, invalid
+		}
+		seq, _ := requestSeqHeader(header)
+		m.Op = &pb.Mutation_DeleteObject{DeleteObject: &pb.DeleteObject{Bucket: bucket, Key: key, Seq: seq}}
+	case method == http.MethodDelete && strings.HasPrefix(rest, "versions/"):
+		bucket, rest, ok := splitObject(strings.TrimPrefix(rest, "versions/"))
+		id, key, ok2 := splitObject(rest)
+		if !ok || !ok2 {
+			return nil, nil, invalid
+		}
+		seq, _ := requestSeqHeader(header)
+		m.Op = &pb.Mutation_DeleteObjectVersion{DeleteObjectVersion: &pb.DeleteObjectVersion{Bucket: bucket, Key: key, VersionId: id, Seq: seq}}
+	case method == http.MethodPut && strings.HasPrefix(rest, "refs/"):
+		bucket, key, ok := splitObject(strings.TrimPrefix(rest, "refs/"))
+		blob, origin, hasBlob := remoteBlob(header)
+		seq, hasSeq := requestSeqHeader(header)
+		if !ok || !hasBlob || !hasSeq {
+			return nil, nil, invalid
+		}
+		m.Op = &pb.Mutation_PutRemoteObject{PutRemoteObject: &pb.PutRemoteObject{
+			Bucket: bucket, Key: key, Seq: seq, Origin: int32(origin), Size: blob.Size, Etag: blob.ETag, Options: objectOptions(header),
+		}}
+	case method == http.MethodPost && rest == "standby/promote":
+		m.Op = &pb.Mutation_Promote{Promote: &pb.Promote{}}
+	case method == http.MethodPost && rest == "access":
+		var a objectd.AccessKey
+		if err := decode(&a); err != nil {
+			return nil, nil, err
+		}
+		m.Op = &pb.Mutation_PutAccess{PutAccess: &pb.PutAccess{Access: accessKeyToPB(a)}}
+	case method == http.MethodDelete && strings.HasPrefix(rest, "access/"):
+		m.Op = &pb.Mutation_DeleteAccess{DeleteAccess: &pb.DeleteAccess{AccessKey: strings.TrimPrefix(rest, "access/")}}
+	case method == http.MethodPost && strings.HasPrefix(rest, "restore/"):
+		bucket, key, ok := splitObject(strings.TrimPrefix(rest, "restore/"))
+		days, err := strconv.Atoi(u.Query().Get("days"))
+		if !ok || err != nil {
+			return nil, nil, invalid
+		}
+		m.Op = &pb.Mutation_RestoreObject{RestoreObject: &pb.RestoreObject{Bucket: bucket, Key: key, Days: int32(days)}}
+	case method == http.MethodPost && strings.HasPrefix(rest, "expiry/"):
+		bucket, key, ok := splitObject(strings.TrimPrefix(rest, "expiry/"))
+		var at time.Time
+		if v := u.Query().Get("at"); v != "" {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, nil, status.Error(codes.InvalidArgument, "invalid expiry")
+			}
+			at = t
+		}
+		if !ok {
+			return nil, nil, invalid
+		}
+		m.Op = &pb.Mutation_SetObjectExpiry{SetObjectExpiry: &pb.SetObjectExpiry{Bucket: bucket, Key: key, ExpiresAtUnixNano: unixNano(at)}}
+	case method == http.MethodPost && rest == "domains":
+		var d objectd.Domain
+		if err := decode(&d); err != nil {
+			return nil, nil, err
+		}
+		m.Op = &pb.Mutation_PutDomain{PutDomain: &pb.PutDomain{Host: d.Host, Bucket: d.Bucket}}
+	case method == http.MethodDelete && strings.HasPrefix(rest, "domains/"):
+		m.Op = &pb.Mutation_DeleteDomain{DeleteDomain: &pb.DeleteDomain{Host: strings.TrimPrefix(rest, "domains/")}}
+	default:
+		return nil, nil, errNoMutation
+	}
+	m.Epoch, _ = strconv.ParseUint(header.Get(EpochHeader), 10, 64)
+	return m, data, nil
+}
+
+// applyMutation applies a replicated mutation to the store, reading the
+// body of an object write from body. Errors are gRPC statuses.
+func (h *ReplicationHandler) applyMutation(ctx context.Context, m *pb.Mutation, body io.Reader) error {
+	var err error
+	switch op := m.Op.(type) {
+	case *pb.Mutation_CreateBucket:
+		err = h.Store.CreateBucket(ctx, op.CreateBucket.Bucket)
+	case *pb.Mutation_DeleteBucket:
+		name := op.DeleteBucket.Bucket
+		if op.DeleteBucket.Force {
+			// The purge finishes even if the leader gives up waiting; a retried
+			// delete picks up what is left.
+			if _, err := h.Store.PurgeBucket(context.WithoutCancel(ctx), name); err != nil && err != objectd.ErrNotFound {
+				return status.Error(codes.FailedPrecondition, err.Error())
+			}
+		}
+		if err := h.Store.DeleteBucket(ctx, name); err != nil && err != objectd.ErrNotFound {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+	case *pb.Mutation_SetReplicationPaused:
+		err = h.Store.SetReplicationPaused(ctx, op.SetReplicationPaused.Bucket, op.SetReplicationPaused.Paused)
+	case *pb.Mutation_SetBucketTrash:
+		err = h.Store.SetBucketTrash(ctx, op.SetBucketTrash.Bucket, int(op.SetBucketTrash.Days))
+	case *pb.Mutation_SetBucketCopies:
+		err = h.Store.SetBucketCopies(ctx, op.SetBucketCopies.Bucket, int(op.SetBucketCopies.Copies))
+	case *pb.Mutation_SetBucketConsistency:
+		err = h.Store.SetBucketConsistency(ctx, op.SetBucketConsistency.Bucket, op.SetBucketConsistency.Consistency)
+	case *pb.Mutation_SetBucketConfig:
+		c := op.SetBucketConfig
+		err = h.Store.PutBucketConfig(ctx, c.Bucket, objectd.BucketConfig{Versioning: c.Versioning, QuotaBytes: c.QuotaBytes, PublicRead: c.PublicRead, Encryption: c.Encryption})
+	case *pb.Mutation_RenameBucket:
+		if err := h.Store.RenameBucket(ctx, op.RenameBucket.Bucket, op.RenameBucket.Name); err != nil {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+	case *pb.Mutation_SetFederation:
+		err = h.Store.SetFederation(ctx, op.SetFederation.Bucket, op.SetFederation.Enabled)
+		if err == nil {
+			err = h.Store.SetFederationCursor(ctx, op.SetFederation.Bucket, op.SetFederation.Cursor)
+		}
+	case *pb.Mutation_SetFederationCursor:
+		err = h.Store.SetFederationCursor(ctx, op.SetFederationCursor.Bucket, op.SetFederationCursor.Cursor)
+	case *pb.Mutation_SetBucketEncryption:
+		err = h.Store.PutBucketEncryption(ctx, op.SetBucketEncryption.Bucket, objectd.EncryptionConfig{Algorithm: op.SetBucketEncryption.Algorithm})
+	case *pb.Mutation_PutObject:
+		return h.putObject(ctx, op.PutObject, body)
+	case *pb.Mutation_DeleteObject:
+		d := op.DeleteObject
+		if d.Seq != 0 {
+			_, err = h.Store.ApplyReplicatedDelete(ctx, d.Bucket, d.Key, d.Seq)
+		} else {
+			_, err = h.Store.DeleteObject(ctx, d.Bucket, d.Key)
+		}
+		if err == objectd.ErrNotFound {
+			err = nil
+		}
+	case *pb.Mutation_DeleteObjectVersion:
+		d := op.DeleteObjectVersion
+		if _, _, err = h.Store.DeleteObjectVersion(ctx, d.Bucket, d.Key, d.VersionId, d.Seq); errors.Is(err, objectd.ErrNotFound) {
+			err = nil
+		}
+	case *pb.Mutation_PutRemoteObject:
+		p := op.PutRemoteObject
+		// The origin commits its staged body itself once the leader answers.
+		if h.Cluster != nil && int(p.Origin) == h.Cluster.SelfOrdinal() {
+			return nil
+		}
+		_, _, err = h.Store.RecordRemoteObject(ctx, p.Bucket, p.Key, objectd.Blob{Size: p.Size, ETag: p.Etag}, int(p.Origin), p.Seq, putOptionsFromPB(p.Options))
+	case *pb.Mutation_RestoreTrashed:
+		_, err = h.Store.RestoreTrashed(ctx, op.RestoreTrashed.Bucket, op.RestoreTrashed.Id, op.RestoreTrashed.Seq)
+	case *pb.Mutation_RestoreObject:
+		_, err = h.Store.RestoreObject(ctx, op.RestoreObject.Bucket, op.RestoreObject.Key, int(op.RestoreObject.Days))
+	case *pb.Mutation_SetObjectExpiry:
+		e := op.SetObjectExpiry
+		if _, err = h.Store.SetObjectExpiry(ctx, e.Bucket, e.Key, fromUnixNano(e.ExpiresAtUnixNano)); err == objectd.ErrNotFound {
+			err = nil
+		}
+	case *pb.Mutation_PutAccess:
+		var a objectd.AccessKey
+		if a, err = accessKeyFromPB(op.PutAccess.Access); err == nil {
+			err = h.Store.PutAccess(ctx, a)
+		}
+	case *pb.Mutation_DeleteAccess:
+		if err := h.Store.DeleteAccess(ctx, op.DeleteAccess.AccessKey); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	case *pb.Mutation_PutDomain:
+		err = h.Store.PutDomain(ctx, op.PutDomain.Host, op.PutDomain.Bucket)
+	case *pb.Mutation_DeleteDomain:
+		if err := h.Store.DeleteDomain(ctx, op.DeleteDomain.Host); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	case *pb.Mutation_Promote:
+		if err := h.Store.Promote(ctx); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	default:
+		// A mutation added by a newer release.
+		return status.Error(codes.InvalidArgument, "unknown mutation")
+	}
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+// putObject writes a replicated object. A body cut short on the way is
+// refused with an internal error, so the sender keeps it as a hint and
+// sends it again.
+func (h *ReplicationHandler) putObject(ctx context.Context, p *pb.PutObject, body io.Reader) error {
+	opts := putOptionsFromPB(p.Options)
+	if p.Etag != "" {
+		opts.ExpectETag, opts.ExpectSize = p.Etag, p.Size
+	}
+	var err error
+	if p.Seq != 0 {
+		_, _, err = h.Store.ApplyReplicatedObject(ctx, p.Bucket, p.Key, body, p.Seq, opts)
+	} else {
+		_, err = h.Store.PutObjectWithOptions(ctx, p.Bucket, p.Key, body, opts)
+	}
+	if errors.Is(err, objectd.ErrChecksumMismatch) {
+		log.Printf("replicated %s/%s: %v", p.Bucket, p.Key, err)
+		metrics.AddCounter("entity_replication_checksum_mismatches_total", map[string]string{"bucket": p.Bucket}, 1)
+		return status.Error(codes.Internal, err.Error())
+	}
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+// serveMutation applies a mutation received over HTTP.
+func (h *ReplicationHandler) serveMutation(w http.ResponseWriter, r *http.Request, m *pb.Mutation, body io.Reader) {
+	metrics.AddCounter("entity_cluster_http_replication_requests_total", nil, 1)
+	if err := h.applyMutation(r.Context(), m, body); err != nil {
+		st := status.Convert(err)
+		http.Error(w, st.Message(), httpStatus(st.Code()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// bucketOf returns the bucket named by a path under bucketsPath.
+func bucketOf(path, suffix string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(path, bucketsPath), suffix)
+}
+
+// splitObject splits "bucket/key".
+func splitObject(rest string) (string, string, bool) {
+	bucket, key, ok := strings.Cut(rest, "/")
+	return bucket, key, ok
+}
+
+// objectOptions reads the object attributes sent along with a replicated
+// write.
+func objectOptions(header http.Header) *pb.ObjectOptions {
+	expires, _ := time.Parse(time.RFC3339Nano, header.Get(ExpiresHeader))
+	return &pb.ObjectOptions{StorageClass: header.Get("X-Amz-Storage-Class"), ContentType: header.Get(ContentTypeHeader), ExpiresAtUnixNano: unixNano(expires)}
+}
+
+func putOptionsFromPB(o *pb.ObjectOptions) objectd.PutOptions {
+	return objectd.PutOptions{StorageClass: o.GetStorageClass(), ContentType: o.GetContentType(), ExpiresAt: fromUnixNano(o.GetExpiresAtUnixNano())}
+}
+
+func accessKeyToPB(a objectd.AccessKey) *pb.AccessKey {
+	out := &pb.AccessKey{
+		AccessKey: a.AccessKey, SecretKey: a.SecretKey, Bucket: a.Bucket, ReadOnly: a.ReadOnly, AllowedCidrs: a.AllowedCIDRs, Owner: a.Owner,
+		RequestsPerSecond: a.RequestsPerSecond, BytesPerSecond: a.BytesPerSecond,
+		CreatedAtUnixNano: unixNano(a.CreatedAt), ExpiresAtUnixNano: unixNano(a.ExpiresAt),
+	}
+	if a.Policy != nil {
+		b, _ := json.Marshal(a.Policy)
+		out.PolicyJson = string(b)
+	}
+	return out
+}
+
+// accessKeyFromPB fails if the policy cannot be read, rather than store the
+// key without it and so allow more than the policy does.
+func accessKeyFromPB(a *pb.AccessKey) (objectd.AccessKey, error) {
+	out := objectd.AccessKey{
+		AccessKey: a.GetAccessKey(), SecretKey: a.GetSecretKey(), Bucket: a.GetBucket(), ReadOnly: a.GetReadOnly(), AllowedCIDRs: a.GetAllowedCidrs(), Owner: a.GetOwner(),
+		CreatedAt: fromUnixNano(a.GetCreatedAtUnixNano()), ExpiresAt: fromUnixNano(a.GetExpiresAtUnixNano()),
+		RateLimit: objectd.RateLimit{RequestsPerSecond: a.GetRequestsPerSecond(), BytesPerSecond: a.GetBytesPerSecond()},
+	}
+	if p := a.GetPolicyJson(); p != "" {
+		out.Policy = &objectd.Policy{}
+		if err := json.Unmarshal([]byte(p), out.Policy); err != nil {
+			return objectd.AccessKey{}, fmt.Errorf("access key %s: policy: %w", out.AccessKey, err)
+		}
+	}
+	return out, nil
+}
+
+// unixNano returns t in nanoseconds since the Unix epoch, and zero for the
+// zero time.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
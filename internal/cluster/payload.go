@@ -0,0 +1,88 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// ErrSuperseded is returned by a payload whose object has been overwritten
+// or deleted since it was replicated. The newer change is replicated on its
+// own, so the peer does not need the old one.
+var ErrSuperseded = errors.New("object was superseded")
+
+// Payload is the body of a replicated mutation. Small bodies are held in
+// memory; object bodies are opened once per peer and streamed from the
+// store with chunked transfer encoding, so a large object is never held in
+// memory as a whole.
+type Payload struct {
+	Size int64
+	Open func() (io.ReadCloser, error)
+	data []byte
+}
+
+// BytesPayload returns a payload held in memory.
+func BytesPayload(b []byte) Payload {
+	return Payload{Size: int64(len(b)), data: b}
+}
+
+// ObjectPayload returns a payload that streams the stored body of m. It
+// fails with ErrSuperseded once key holds a different version.
+func ObjectPayload(ctx context.Context, store *objectd.Store, m objectd.ObjectMeta) Payload {
+	return Payload{Size: m.Size, Open: func() (io.ReadCloser, error) {
+		cur, f, err := store.OpenObject(ctx, m.Bucket, m.Key)
+		if errors.Is(err, objectd.ErrNotFound) {
+			return nil, ErrSuperseded
+		}
+		if err != nil {
+			return nil, err
+		}
+		if cur.Seq != m.Seq {
+			_ = f.Close()
+			return nil, ErrSuperseded
+		}
+		return f, nil
+	}}
+}
+
+// streamed reports whether the payload is read from the store rather than
+// from memory.
+func (p Payload) streamed() bool { return p.Open != nil }
+
+// reader opens the payload; nil means no body.
+func (p Payload) reader() (io.Reader, error) {
+	if p.Open != nil {
+		return p.Open()
+	}
+	if p.data == nil {
+		return nil, nil
+	}
+	return bytes.NewReader(p.data), nil
+}
+
+// load returns a copy of the payload held in memory, reading at most max
+// bytes; ok is false if the payload is larger.
+func (p Payload) load(max int64) (Payload, bool, error) {
+	if !p.streamed() {
+		return p, p.Size <= max, nil
+	}
+	if p.Size > max {
+		return Payload{}, false, nil
+	}
+	r, err := p.Open()
+	if err != nil {
+		return Payload{}, false, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return Payload{}, false, err
+	}
+	if int64(len(data)) > max {
+		return Payload{}, false, nil
+	}
+	return BytesPayload(data), true, nil
+}
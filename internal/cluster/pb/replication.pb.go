@@ -0,0 +1,4089 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: internal/cluster/pb/replication.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type HealthRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HealthRequest) Reset() {
+	*x = HealthRequest{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthRequest) ProtoMessage() {}
+
+func (x *HealthRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthRequest.ProtoReflect.Descriptor instead.
+func (*HealthRequest) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{0}
+}
+
+type HealthResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The replica's clock, in nanoseconds since the Unix epoch.
+	TimeUnixNano int64 `protobuf:"varint,1,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	// Set while the replica refuses writes for lack of disk space.
+	ReadOnly      bool `protobuf:"varint,2,opt,name=read_only,json=readOnly,proto3" json:"read_only,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HealthResponse) Reset() {
+	*x = HealthResponse{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthResponse) ProtoMessage() {}
+
+func (x *HealthResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthResponse.ProtoReflect.Descriptor instead.
+func (*HealthResponse) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *HealthResponse) GetTimeUnixNano() int64 {
+	if x != nil {
+		return x.TimeUnixNano
+	}
+	return 0
+}
+
+func (x *HealthResponse) GetReadOnly() bool {
+	if x != nil {
+		return x.ReadOnly
+	}
+	return false
+}
+
+type MutateRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Part:
+	//
+	//	*MutateRequest_Mutation
+	//	*MutateRequest_Data
+	Part          isMutateRequest_Part `protobuf_oneof:"part"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MutateRequest) Reset() {
+	*x = MutateRequest{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MutateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MutateRequest) ProtoMessage() {}
+
+func (x *MutateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MutateRequest.ProtoReflect.Descriptor instead.
+func (*MutateRequest) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *MutateRequest) GetPart() isMutateRequest_Part {
+	if x != nil {
+		return x.Part
+	}
+	return nil
+}
+
+func (x *MutateRequest) GetMutation() *Mutation {
+	if x != nil {
+		if x, ok := x.Part.(*MutateRequest_Mutation); ok {
+			return x.Mutation
+		}
+	}
+	return nil
+}
+
+func (x *MutateRequest) GetData() []byte {
+	if x != nil {
+		if x, ok := x.Part.(*MutateRequest_Data); ok {
+			return x.Data
+		}
+	}
+	return nil
+}
+
+type isMutateRequest_Part interface {
+	isMutateRequest_Part()
+}
+
+type MutateRequest_Mutation struct {
+	Mutation *Mutation `protobuf:"bytes,1,opt,name=mutation,proto3,oneof"`
+}
+
+type MutateRequest_Data struct {
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3,oneof"`
+}
+
+func (*MutateRequest_Mutation) isMutateRequest_Part() {}
+
+func (*MutateRequest_Data) isMutateRequest_Part() {}
+
+type MutateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MutateResponse) Reset() {
+	*x = MutateResponse{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MutateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MutateResponse) ProtoMessage() {}
+
+func (x *MutateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MutateResponse.ProtoReflect.Descriptor instead.
+func (*MutateResponse) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{3}
+}
+
+// Mutation is one change replicated from the replica that made it.
+type Mutation struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Op:
+	//
+	//	*Mutation_CreateBucket
+	//	*Mutation_DeleteBucket
+	//	*Mutation_SetReplicationPaused
+	//	*Mutation_SetBucketTrash
+	//	*Mutation_SetBucketCopies
+	//	*Mutation_SetFederation
+	//	*Mutation_SetFederationCursor
+	//	*Mutation_SetBucketEncryption
+	//	*Mutation_PutObject
+	//	*Mutation_DeleteObject
+	//	*Mutation_PutRemoteObject
+	//	*Mutation_RestoreTrashed
+	//	*Mutation_RestoreObject
+	//	*Mutation_SetObjectExpiry
+	//	*Mutation_PutAccess
+	//	*Mutation_DeleteAccess
+	//	*Mutation_PutDomain
+	//	*Mutation_DeleteDomain
+	//	*Mutation_Promote
+	//	*Mutation_SetBucketConsistency
+	//	*Mutation_RenameBucket
+	//	*Mutation_SetBucketConfig
+	//	*Mutation_DeleteObjectVersion
+	Op isMutation_Op `protobuf_oneof:"op"`
+	// The leadership epoch the change was made in; zero if none was known.
+	// A replica refuses a change from an older epoch than its own.
+	Epoch         uint64 `protobuf:"varint,20,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Mutation) Reset() {
+	*x = Mutation{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Mutation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Mutation) ProtoMessage() {}
+
+func (x *Mutation) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Mutation.ProtoReflect.Descriptor instead.
+func (*Mutation) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Mutation) GetOp() isMutation_Op {
+	if x != nil {
+		return x.Op
+	}
+	return nil
+}
+
+func (x *Mutation) GetCreateBucket() *CreateBucket {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_CreateBucket); ok {
+			return x.CreateBucket
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetDeleteBucket() *DeleteBucket {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_DeleteBucket); ok {
+			return x.DeleteBucket
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetSetReplicationPaused() *SetReplicationPaused {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_SetReplicationPaused); ok {
+			return x.SetReplicationPaused
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetSetBucketTrash() *SetBucketTrash {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_SetBucketTrash); ok {
+			return x.SetBucketTrash
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetSetBucketCopies() *SetBucketCopies {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_SetBucketCopies); ok {
+			return x.SetBucketCopies
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetSetFederation() *SetFederation {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_SetFederation); ok {
+			return x.SetFederation
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetSetFederationCursor() *SetFederationCursor {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_SetFederationCursor); ok {
+			return x.SetFederationCursor
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetSetBucketEncryption() *SetBucketEncryption {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_SetBucketEncryption); ok {
+			return x.SetBucketEncryption
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetPutObject() *PutObject {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_PutObject); ok {
+			return x.PutObject
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetDeleteObject() *DeleteObject {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_DeleteObject); ok {
+			return x.DeleteObject
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetPutRemoteObject() *PutRemoteObject {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_PutRemoteObject); ok {
+			return x.PutRemoteObject
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetRestoreTrashed() *RestoreTrashed {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_RestoreTrashed); ok {
+			return x.RestoreTrashed
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetRestoreObject() *RestoreObject {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_RestoreObject); ok {
+			return x.RestoreObject
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetSetObjectExpiry() *SetObjectExpiry {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_SetObjectExpiry); ok {
+			return x.SetObjectExpiry
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetPutAccess() *PutAccess {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_PutAccess); ok {
+			return x.PutAccess
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetDeleteAccess() *DeleteAccess {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_DeleteAccess); ok {
+			return x.DeleteAccess
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetPutDomain() *PutDomain {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_PutDomain); ok {
+			return x.PutDomain
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetDeleteDomain() *DeleteDomain {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_DeleteDomain); ok {
+			return x.DeleteDomain
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetPromote() *Promote {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_Promote); ok {
+			return x.Promote
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetSetBucketConsistency() *SetBucketConsistency {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_SetBucketConsistency); ok {
+			return x.SetBucketConsistency
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetRenameBucket() *RenameBucket {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_RenameBucket); ok {
+			return x.RenameBucket
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetSetBucketConfig() *SetBucketConfig {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_SetBucketConfig); ok {
+			return x.SetBucketConfig
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetDeleteObjectVersion() *DeleteObjectVersion {
+	if x != nil {
+		if x, ok := x.Op.(*Mutation_DeleteObjectVersion); ok {
+			return x.DeleteObjectVersion
+		}
+	}
+	return nil
+}
+
+func (x *Mutation) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+type isMutation_Op interface {
+	isMutation_Op()
+}
+
+type Mutation_CreateBucket struct {
+	CreateBucket *CreateBucket `protobuf:"bytes,1,opt,name=create_bucket,json=createBucket,proto3,oneof"`
+}
+
+type Mutation_DeleteBucket struct {
+	DeleteBucket *DeleteBucket `protobuf:"bytes,2,opt,name=delete_bucket,json=deleteBucket,proto3,oneof"`
+}
+
+type Mutation_SetReplicationPaused struct {
+	SetReplicationPaused *SetReplicationPaused `protobuf:"bytes,3,opt,name=set_replication_paused,json=setReplicationPaused,proto3,oneof"`
+}
+
+type Mutation_SetBucketTrash struct {
+	SetBucketTrash *SetBucketTrash `protobuf:"bytes,4,opt,name=set_bucket_trash,json=setBucketTrash,proto3,oneof"`
+}
+
+type Mutation_SetBucketCopies struct {
+	SetBucketCopies *SetBucketCopies `protobuf:"bytes,5,opt,name=set_bucket_copies,json=setBucketCopies,proto3,oneof"`
+}
+
+type Mutation_SetFederation struct {
+	SetFederation *SetFederation `protobuf:"bytes,6,opt,name=set_federation,json=setFederation,proto3,oneof"`
+}
+
+type Mutation_SetFederationCursor struct {
+	SetFederationCursor *SetFederationCursor `protobuf:"bytes,7,opt,name=set_federation_cursor,json=setFederationCursor,proto3,oneof"`
+}
+
+type Mutation_SetBucketEncryption struct {
+	SetBucketEncryption *SetBucketEncryption `protobuf:"bytes,8,opt,name=set_bucket_encryption,json=setBucketEncryption,proto3,oneof"`
+}
+
+type Mutation_PutObject struct {
+	PutObject *PutObject `protobuf:"bytes,9,opt,name=put_object,json=putObject,proto3,oneof"`
+}
+
+type Mutation_DeleteObject struct {
+	DeleteObject *DeleteObject `protobuf:"bytes,10,opt,name=delete_object,json=deleteObject,proto3,oneof"`
+}
+
+type Mutation_PutRemoteObject struct {
+	PutRemoteObject *PutRemoteObject `protobuf:"bytes,11,opt,name=put_remote_object,json=putRemoteObject,proto3,oneof"`
+}
+
+type Mutation_RestoreTrashed struct {
+	RestoreTrashed *RestoreTrashed `protobuf:"bytes,12,opt,name=restore_trashed,json=restoreTrashed,proto3,oneof"`
+}
+
+type Mutation_RestoreObject struct {
+	RestoreObject *RestoreObject `protobuf:"bytes,13,opt,name=restore_object,json=restoreObject,proto3,oneof"`
+}
+
+type Mutation_SetObjectExpiry struct {
+	SetObjectExpiry *SetObjectExpiry `protobuf:"bytes,14,opt,name=set_object_expiry,json=setObjectExpiry,proto3,oneof"`
+}
+
+type Mutation_PutAccess struct {
+	PutAccess *PutAccess `protobuf:"bytes,15,opt,name=put_access,json=putAccess,proto3,oneof"`
+}
+
+type Mutation_DeleteAccess struct {
+	DeleteAccess *DeleteAccess `protobuf:"bytes,16,opt,name=delete_access,json=deleteAccess,proto3,oneof"`
+}
+
+type Mutation_PutDomain struct {
+	PutDomain *PutDomain `protobuf:"bytes,17,opt,name=put_domain,json=putDomain,proto3,oneof"`
+}
+
+type Mutation_DeleteDomain struct {
+	DeleteDomain *DeleteDomain `protobuf:"bytes,18,opt,name=delete_domain,json=deleteDomain,proto3,oneof"`
+}
+
+type Mutation_Promote struct {
+	Promote *Promote `protobuf:"bytes,19,opt,name=promote,proto3,oneof"`
+}
+
+type Mutation_SetBucketConsistency struct {
+	SetBucketConsistency *SetBucketConsistency `protobuf:"bytes,21,opt,name=set_bucket_consistency,json=setBucketConsistency,proto3,oneof"`
+}
+
+type Mutation_RenameBucket struct {
+	RenameBucket *RenameBucket `protobuf:"bytes,22,opt,name=rename_bucket,json=renameBucket,proto3,oneof"`
+}
+
+type Mutation_SetBucketConfig struct {
+	SetBucketConfig *SetBucketConfig `protobuf:"bytes,23,opt,name=set_bucket_config,json=setBucketConfig,proto3,oneof"`
+}
+
+type Mutation_DeleteObjectVersion struct {
+	DeleteObjectVersion *DeleteObjectVersion `protobuf:"bytes,24,opt,name=delete_object_version,json=deleteObjectVersion,proto3,oneof"`
+}
+
+func (*Mutation_CreateBucket) isMutation_Op() {}
+
+func (*Mutation_DeleteBucket) isMutation_Op() {}
+
+func (*Mutation_SetReplicationPaused) isMutation_Op() {}
+
+func (*Mutation_SetBucketTrash) isMutation_Op() {}
+
+func (*Mutation_SetBucketCopies) isMutation_Op() {}
+
+func (*Mutation_SetFederation) isMutation_Op() {}
+
+func (*Mutation_SetFederationCursor) isMutation_Op() {}
+
+func (*Mutation_SetBucketEncryption) isMutation_Op() {}
+
+func (*Mutation_PutObject) isMutation_Op() {}
+
+func (*Mutation_DeleteObject) isMutation_Op() {}
+
+func (*Mutation_PutRemoteObject) isMutation_Op() {}
+
+func (*Mutation_RestoreTrashed) isMutation_Op() {}
+
+func (*Mutation_RestoreObject) isMutation_Op() {}
+
+func (*Mutation_SetObjectExpiry) isMutation_Op() {}
+
+func (*Mutation_PutAccess) isMutation_Op() {}
+
+func (*Mutation_DeleteAccess) isMutation_Op() {}
+
+func (*Mutation_PutDomain) isMutation_Op() {}
+
+func (*Mutation_DeleteDomain) isMutation_Op() {}
+
+func (*Mutation_Promote) isMutation_Op() {}
+
+func (*Mutation_SetBucketConsistency) isMutation_Op() {}
+
+func (*Mutation_RenameBucket) isMutation_Op() {}
+
+func (*Mutation_SetBucketConfig) isMutation_Op() {}
+
+func (*Mutation_DeleteObjectVersion) isMutation_Op() {}
+
+type CreateBucket struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateBucket) Reset() {
+	*x = CreateBucket{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateBucket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateBucket) ProtoMessage() {}
+
+func (x *CreateBucket) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateBucket.ProtoReflect.Descriptor instead.
+func (*CreateBucket) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CreateBucket) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+type DeleteBucket struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Bucket string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	// Purge the objects first instead of refusing a bucket that is not
+	// empty.
+	Force         bool `protobuf:"varint,2,opt,name=force,proto3" json:"force,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteBucket) Reset() {
+	*x = DeleteBucket{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteBucket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteBucket) ProtoMessage() {}
+
+func (x *DeleteBucket) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteBucket.ProtoReflect.Descriptor instead.
+func (*DeleteBucket) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteBucket) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *DeleteBucket) GetForce() bool {
+	if x != nil {
+		return x.Force
+	}
+	return false
+}
+
+type SetReplicationPaused struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Paused        bool                   `protobuf:"varint,2,opt,name=paused,proto3" json:"paused,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetReplicationPaused) Reset() {
+	*x = SetReplicationPaused{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetReplicationPaused) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetReplicationPaused) ProtoMessage() {}
+
+func (x *SetReplicationPaused) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetReplicationPaused.ProtoReflect.Descriptor instead.
+func (*SetReplicationPaused) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SetReplicationPaused) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *SetReplicationPaused) GetPaused() bool {
+	if x != nil {
+		return x.Paused
+	}
+	return false
+}
+
+type SetBucketTrash struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Days          int32                  `protobuf:"varint,2,opt,name=days,proto3" json:"days,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetBucketTrash) Reset() {
+	*x = SetBucketTrash{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetBucketTrash) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetBucketTrash) ProtoMessage() {}
+
+func (x *SetBucketTrash) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetBucketTrash.ProtoReflect.Descriptor instead.
+func (*SetBucketTrash) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SetBucketTrash) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *SetBucketTrash) GetDays() int32 {
+	if x != nil {
+		return x.Days
+	}
+	return 0
+}
+
+type SetBucketCopies struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Copies        int32                  `protobuf:"varint,2,opt,name=copies,proto3" json:"copies,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetBucketCopies) Reset() {
+	*x = SetBucketCopies{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetBucketCopies) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetBucketCopies) ProtoMessage() {}
+
+func (x *SetBucketCopies) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetBucketCopies.ProtoReflect.Descriptor instead.
+func (*SetBucketCopies) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SetBucketCopies) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *SetBucketCopies) GetCopies() int32 {
+	if x != nil {
+		return x.Copies
+	}
+	return 0
+}
+
+// SetFederation turns federation of a bucket on or off and resets its
+// cursor.
+type SetFederation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Enabled       bool                   `protobuf:"varint,2,opt,name=enabled,proto3" json:"enabled,omitempty"`
+	Cursor        uint64                 `protobuf:"varint,3,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetFederation) Reset() {
+	*x = SetFederation{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetFederation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetFederation) ProtoMessage() {}
+
+func (x *SetFederation) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetFederation.ProtoReflect.Descriptor instead.
+func (*SetFederation) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SetFederation) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *SetFederation) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+func (x *SetFederation) GetCursor() uint64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+// SetFederationCursor records the progress of federating a bucket. It is
+// sent alone so that it cannot re-enable a bucket disabled in the meantime.
+type SetFederationCursor struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Cursor        uint64                 `protobuf:"varint,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetFederationCursor) Reset() {
+	*x = SetFederationCursor{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetFederationCursor) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetFederationCursor) ProtoMessage() {}
+
+func (x *SetFederationCursor) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetFederationCursor.ProtoReflect.Descriptor instead.
+func (*SetFederationCursor) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *SetFederationCursor) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *SetFederationCursor) GetCursor() uint64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+type SetBucketEncryption struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Algorithm     string                 `protobuf:"bytes,2,opt,name=algorithm,proto3" json:"algorithm,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetBucketEncryption) Reset() {
+	*x = SetBucketEncryption{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetBucketEncryption) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetBucketEncryption) ProtoMessage() {}
+
+func (x *SetBucketEncryption) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetBucketEncryption.ProtoReflect.Descriptor instead.
+func (*SetBucketEncryption) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SetBucketEncryption) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *SetBucketEncryption) GetAlgorithm() string {
+	if x != nil {
+		return x.Algorithm
+	}
+	return ""
+}
+
+// SetBucketConfig replaces the configuration of a bucket. An empty
+// versioning leaves it as it is.
+type SetBucketConfig struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Versioning    string                 `protobuf:"bytes,2,opt,name=versioning,proto3" json:"versioning,omitempty"`
+	QuotaBytes    int64                  `protobuf:"varint,3,opt,name=quota_bytes,json=quotaBytes,proto3" json:"quota_bytes,omitempty"`
+	PublicRead    bool                   `protobuf:"varint,4,opt,name=public_read,json=publicRead,proto3" json:"public_read,omitempty"`
+	Encryption    string                 `protobuf:"bytes,5,opt,name=encryption,proto3" json:"encryption,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetBucketConfig) Reset() {
+	*x = SetBucketConfig{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetBucketConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetBucketConfig) ProtoMessage() {}
+
+func (x *SetBucketConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetBucketConfig.ProtoReflect.Descriptor instead.
+func (*SetBucketConfig) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *SetBucketConfig) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *SetBucketConfig) GetVersioning() string {
+	if x != nil {
+		return x.Versioning
+	}
+	return ""
+}
+
+func (x *SetBucketConfig) GetQuotaBytes() int64 {
+	if x != nil {
+		return x.QuotaBytes
+	}
+	return 0
+}
+
+func (x *SetBucketConfig) GetPublicRead() bool {
+	if x != nil {
+		return x.PublicRead
+	}
+	return false
+}
+
+func (x *SetBucketConfig) GetEncryption() string {
+	if x != nil {
+		return x.Encryption
+	}
+	return ""
+}
+
+// RenameBucket gives a bucket a new name, keeping its objects and keys.
+type RenameBucket struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RenameBucket) Reset() {
+	*x = RenameBucket{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenameBucket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenameBucket) ProtoMessage() {}
+
+func (x *RenameBucket) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenameBucket.ProtoReflect.Descriptor instead.
+func (*RenameBucket) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *RenameBucket) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *RenameBucket) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// SetBucketConsistency sets the write consistency of a bucket; empty uses
+// the cluster's.
+type SetBucketConsistency struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Consistency   string                 `protobuf:"bytes,2,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetBucketConsistency) Reset() {
+	*x = SetBucketConsistency{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetBucketConsistency) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetBucketConsistency) ProtoMessage() {}
+
+func (x *SetBucketConsistency) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetBucketConsistency.ProtoReflect.Descriptor instead.
+func (*SetBucketConsistency) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *SetBucketConsistency) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *SetBucketConsistency) GetConsistency() string {
+	if x != nil {
+		return x.Consistency
+	}
+	return ""
+}
+
+// ObjectOptions are the attributes stored with an object.
+type ObjectOptions struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	StorageClass string                 `protobuf:"bytes,1,opt,name=storage_class,json=storageClass,proto3" json:"storage_class,omitempty"`
+	ContentType  string                 `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	// Zero means the object does not expire.
+	ExpiresAtUnixNano int64 `protobuf:"varint,3,opt,name=expires_at_unix_nano,json=expiresAtUnixNano,proto3" json:"expires_at_unix_nano,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *ObjectOptions) Reset() {
+	*x = ObjectOptions{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ObjectOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ObjectOptions) ProtoMessage() {}
+
+func (x *ObjectOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ObjectOptions.ProtoReflect.Descriptor instead.
+func (*ObjectOptions) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ObjectOptions) GetStorageClass() string {
+	if x != nil {
+		return x.StorageClass
+	}
+	return ""
+}
+
+func (x *ObjectOptions) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *ObjectOptions) GetExpiresAtUnixNano() int64 {
+	if x != nil {
+		return x.ExpiresAtUnixNano
+	}
+	return 0
+}
+
+// PutObject writes an object whose body follows in the data messages.
+type PutObject struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Bucket string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Key    string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	// The sequence number the leader assigned; zero writes the object as a
+	// new local change.
+	Seq     uint64         `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+	Options *ObjectOptions `protobuf:"bytes,4,opt,name=options,proto3" json:"options,omitempty"`
+	// When etag is set, a body without this size and ETag is refused, so
+	// that the sender delivers it again.
+	Size          int64  `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	Etag          string `protobuf:"bytes,6,opt,name=etag,proto3" json:"etag,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutObject) Reset() {
+	*x = PutObject{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutObject) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutObject) ProtoMessage() {}
+
+func (x *PutObject) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutObject.ProtoReflect.Descriptor instead.
+func (*PutObject) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *PutObject) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *PutObject) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *PutObject) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *PutObject) GetOptions() *ObjectOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+func (x *PutObject) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *PutObject) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+type DeleteObject struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Bucket string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Key    string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	// As in PutObject.
+	Seq           uint64 `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteObject) Reset() {
+	*x = DeleteObject{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteObject) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteObject) ProtoMessage() {}
+
+func (x *DeleteObject) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteObject.ProtoReflect.Descriptor instead.
+func (*DeleteObject) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *DeleteObject) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *DeleteObject) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *DeleteObject) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+// DeleteObjectVersion removes one version of an object. Without a sequence
+// number the version was noncurrent.
+type DeleteObjectVersion struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	VersionId     string                 `protobuf:"bytes,3,opt,name=version_id,json=versionId,proto3" json:"version_id,omitempty"`
+	Seq           uint64                 `protobuf:"varint,4,opt,name=seq,proto3" json:"seq,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteObjectVersion) Reset() {
+	*x = DeleteObjectVersion{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteObjectVersion) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteObjectVersion) ProtoMessage() {}
+
+func (x *DeleteObjectVersion) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteObjectVersion.ProtoReflect.Descriptor instead.
+func (*DeleteObjectVersion) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *DeleteObjectVersion) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *DeleteObjectVersion) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *DeleteObjectVersion) GetVersionId() string {
+	if x != nil {
+		return x.VersionId
+	}
+	return ""
+}
+
+func (x *DeleteObjectVersion) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+// PutRemoteObject records the metadata of an object whose body stays on
+// its origin until this replica pulls it.
+type PutRemoteObject struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Seq           uint64                 `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+	Origin        int32                  `protobuf:"varint,4,opt,name=origin,proto3" json:"origin,omitempty"`
+	Size          int64                  `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	Etag          string                 `protobuf:"bytes,6,opt,name=etag,proto3" json:"etag,omitempty"`
+	Options       *ObjectOptions         `protobuf:"bytes,7,opt,name=options,proto3" json:"options,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutRemoteObject) Reset() {
+	*x = PutRemoteObject{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutRemoteObject) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutRemoteObject) ProtoMessage() {}
+
+func (x *PutRemoteObject) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutRemoteObject.ProtoReflect.Descriptor instead.
+func (*PutRemoteObject) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *PutRemoteObject) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *PutRemoteObject) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *PutRemoteObject) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *PutRemoteObject) GetOrigin() int32 {
+	if x != nil {
+		return x.Origin
+	}
+	return 0
+}
+
+func (x *PutRemoteObject) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *PutRemoteObject) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+func (x *PutRemoteObject) GetOptions() *ObjectOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type RestoreTrashed struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Id            uint64                 `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	Seq           uint64                 `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RestoreTrashed) Reset() {
+	*x = RestoreTrashed{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RestoreTrashed) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RestoreTrashed) ProtoMessage() {}
+
+func (x *RestoreTrashed) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RestoreTrashed.ProtoReflect.Descriptor instead.
+func (*RestoreTrashed) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *RestoreTrashed) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *RestoreTrashed) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *RestoreTrashed) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+type RestoreObject struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Days          int32                  `protobuf:"varint,3,opt,name=days,proto3" json:"days,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RestoreObject) Reset() {
+	*x = RestoreObject{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RestoreObject) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RestoreObject) ProtoMessage() {}
+
+func (x *RestoreObject) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RestoreObject.ProtoReflect.Descriptor instead.
+func (*RestoreObject) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *RestoreObject) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *RestoreObject) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *RestoreObject) GetDays() int32 {
+	if x != nil {
+		return x.Days
+	}
+	return 0
+}
+
+type SetObjectExpiry struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Bucket string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Key    string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	// Zero removes the expiry.
+	ExpiresAtUnixNano int64 `protobuf:"varint,3,opt,name=expires_at_unix_nano,json=expiresAtUnixNano,proto3" json:"expires_at_unix_nano,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *SetObjectExpiry) Reset() {
+	*x = SetObjectExpiry{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetObjectExpiry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetObjectExpiry) ProtoMessage() {}
+
+func (x *SetObjectExpiry) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetObjectExpiry.ProtoReflect.Descriptor instead.
+func (*SetObjectExpiry) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *SetObjectExpiry) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *SetObjectExpiry) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *SetObjectExpiry) GetExpiresAtUnixNano() int64 {
+	if x != nil {
+		return x.ExpiresAtUnixNano
+	}
+	return 0
+}
+
+type AccessKey struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	AccessKey         string                 `protobuf:"bytes,1,opt,name=access_key,json=accessKey,proto3" json:"access_key,omitempty"`
+	SecretKey         string                 `protobuf:"bytes,2,opt,name=secret_key,json=secretKey,proto3" json:"secret_key,omitempty"`
+	Bucket            string                 `protobuf:"bytes,3,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	ReadOnly          bool                   `protobuf:"varint,4,opt,name=read_only,json=readOnly,proto3" json:"read_only,omitempty"`
+	AllowedCidrs      []string               `protobuf:"bytes,5,rep,name=allowed_cidrs,json=allowedCidrs,proto3" json:"allowed_cidrs,omitempty"`
+	Owner             string                 `protobuf:"bytes,6,opt,name=owner,proto3" json:"owner,omitempty"`
+	RequestsPerSecond float64                `protobuf:"fixed64,7,opt,name=requests_per_second,json=requestsPerSecond,proto3" json:"requests_per_second,omitempty"`
+	BytesPerSecond    int64                  `protobuf:"varint,8,opt,name=bytes_per_second,json=bytesPerSecond,proto3" json:"bytes_per_second,omitempty"`
+	CreatedAtUnixNano int64                  `protobuf:"varint,9,opt,name=created_at_unix_nano,json=createdAtUnixNano,proto3" json:"created_at_unix_nano,omitempty"`
+	// Zero if the key does not expire.
+	ExpiresAtUnixNano int64 `protobuf:"varint,10,opt,name=expires_at_unix_nano,json=expiresAtUnixNano,proto3" json:"expires_at_unix_nano,omitempty"`
+	// The key's IAM-style policy as a JSON document; empty if it has none.
+	PolicyJson    string `protobuf:"bytes,11,opt,name=policy_json,json=policyJson,proto3" json:"policy_json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AccessKey) Reset() {
+	*x = AccessKey{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccessKey) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccessKey) ProtoMessage() {}
+
+func (x *AccessKey) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccessKey.ProtoReflect.Descriptor instead.
+func (*AccessKey) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *AccessKey) GetAccessKey() string {
+	if x != nil {
+		return x.AccessKey
+	}
+	return ""
+}
+
+func (x *AccessKey) GetSecretKey() string {
+	if x != nil {
+		return x.SecretKey
+	}
+	return ""
+}
+
+func (x *AccessKey) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *AccessKey) GetReadOnly() bool {
+	if x != nil {
+		return x.ReadOnly
+	}
+	return false
+}
+
+func (x *AccessKey) GetAllowedCidrs() []string {
+	if x != nil {
+		return x.AllowedCidrs
+	}
+	return nil
+}
+
+func (x *AccessKey) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *AccessKey) GetRequestsPerSecond() float64 {
+	if x != nil {
+		return x.RequestsPerSecond
+	}
+	return 0
+}
+
+func (x *AccessKey) GetBytesPerSecond() int64 {
+	if x != nil {
+		return x.BytesPerSecond
+	}
+	return 0
+}
+
+func (x *AccessKey) GetCreatedAtUnixNano() int64 {
+	if x != nil {
+		return x.CreatedAtUnixNano
+	}
+	return 0
+}
+
+func (x *AccessKey) GetExpiresAtUnixNano() int64 {
+	if x != nil {
+		return x.ExpiresAtUnixNano
+	}
+	return 0
+}
+
+func (x *AccessKey) GetPolicyJson() string {
+	if x != nil {
+		return x.PolicyJson
+	}
+	return ""
+}
+
+type PutAccess struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Access        *AccessKey             `protobuf:"bytes,1,opt,name=access,proto3" json:"access,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutAccess) Reset() {
+	*x = PutAccess{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutAccess) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutAccess) ProtoMessage() {}
+
+func (x *PutAccess) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutAccess.ProtoReflect.Descriptor instead.
+func (*PutAccess) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *PutAccess) GetAccess() *AccessKey {
+	if x != nil {
+		return x.Access
+	}
+	return nil
+}
+
+type DeleteAccess struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AccessKey     string                 `protobuf:"bytes,1,opt,name=access_key,json=accessKey,proto3" json:"access_key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteAccess) Reset() {
+	*x = DeleteAccess{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteAccess) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteAccess) ProtoMessage() {}
+
+func (x *DeleteAccess) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteAccess.ProtoReflect.Descriptor instead.
+func (*DeleteAccess) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *DeleteAccess) GetAccessKey() string {
+	if x != nil {
+		return x.AccessKey
+	}
+	return ""
+}
+
+type PutDomain struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Host          string                 `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	Bucket        string                 `protobuf:"bytes,2,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutDomain) Reset() {
+	*x = PutDomain{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutDomain) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutDomain) ProtoMessage() {}
+
+func (x *PutDomain) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutDomain.ProtoReflect.Descriptor instead.
+func (*PutDomain) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *PutDomain) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *PutDomain) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+type DeleteDomain struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Host          string                 `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteDomain) Reset() {
+	*x = DeleteDomain{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteDomain) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteDomain) ProtoMessage() {}
+
+func (x *DeleteDomain) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteDomain.ProtoReflect.Descriptor instead.
+func (*DeleteDomain) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *DeleteDomain) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+// Promote turns a standby cluster into a primary.
+type Promote struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Promote) Reset() {
+	*x = Promote{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Promote) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Promote) ProtoMessage() {}
+
+func (x *Promote) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Promote.ProtoReflect.Descriptor instead.
+func (*Promote) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{29}
+}
+
+type CommitRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Bucket  string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Key     string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Origin  int32                  `protobuf:"varint,3,opt,name=origin,proto3" json:"origin,omitempty"`
+	Size    int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	Etag    string                 `protobuf:"bytes,5,opt,name=etag,proto3" json:"etag,omitempty"`
+	Options *ObjectOptions         `protobuf:"bytes,6,opt,name=options,proto3" json:"options,omitempty"`
+	// The write consistency of the request that staged the body; empty
+	// uses the leader's.
+	Consistency string `protobuf:"bytes,7,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	// The caller's leadership epoch, as in Mutation.
+	Epoch         uint64 `protobuf:"varint,8,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitRequest) Reset() {
+	*x = CommitRequest{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitRequest) ProtoMessage() {}
+
+func (x *CommitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitRequest.ProtoReflect.Descriptor instead.
+func (*CommitRequest) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *CommitRequest) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *CommitRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *CommitRequest) GetOrigin() int32 {
+	if x != nil {
+		return x.Origin
+	}
+	return 0
+}
+
+func (x *CommitRequest) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *CommitRequest) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+func (x *CommitRequest) GetOptions() *ObjectOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+func (x *CommitRequest) GetConsistency() string {
+	if x != nil {
+		return x.Consistency
+	}
+	return ""
+}
+
+func (x *CommitRequest) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+type CommitResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitResponse) Reset() {
+	*x = CommitResponse{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitResponse) ProtoMessage() {}
+
+func (x *CommitResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitResponse.ProtoReflect.Descriptor instead.
+func (*CommitResponse) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *CommitResponse) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+type AbortRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Bucket string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Key    string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Origin int32                  `protobuf:"varint,3,opt,name=origin,proto3" json:"origin,omitempty"`
+	// The sequence number the leader assigned in Commit.
+	Seq uint64 `protobuf:"varint,4,opt,name=seq,proto3" json:"seq,omitempty"`
+	// The caller's leadership epoch, as in Mutation.
+	Epoch         uint64 `protobuf:"varint,5,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AbortRequest) Reset() {
+	*x = AbortRequest{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AbortRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AbortRequest) ProtoMessage() {}
+
+func (x *AbortRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AbortRequest.ProtoReflect.Descriptor instead.
+func (*AbortRequest) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *AbortRequest) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *AbortRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *AbortRequest) GetOrigin() int32 {
+	if x != nil {
+		return x.Origin
+	}
+	return 0
+}
+
+func (x *AbortRequest) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *AbortRequest) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+type AbortResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AbortResponse) Reset() {
+	*x = AbortResponse{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AbortResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AbortResponse) ProtoMessage() {}
+
+func (x *AbortResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AbortResponse.ProtoReflect.Descriptor instead.
+func (*AbortResponse) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{33}
+}
+
+type GetObjectRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Bucket string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Key    string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	// Send the header alone.
+	Head          bool `protobuf:"varint,3,opt,name=head,proto3" json:"head,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetObjectRequest) Reset() {
+	*x = GetObjectRequest{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetObjectRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetObjectRequest) ProtoMessage() {}
+
+func (x *GetObjectRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetObjectRequest.ProtoReflect.Descriptor instead.
+func (*GetObjectRequest) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{34}
+}
+
+func (x *GetObjectRequest) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *GetObjectRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *GetObjectRequest) GetHead() bool {
+	if x != nil {
+		return x.Head
+	}
+	return false
+}
+
+type GetObjectResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Part:
+	//
+	//	*GetObjectResponse_Header
+	//	*GetObjectResponse_Data
+	Part          isGetObjectResponse_Part `protobuf_oneof:"part"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetObjectResponse) Reset() {
+	*x = GetObjectResponse{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetObjectResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetObjectResponse) ProtoMessage() {}
+
+func (x *GetObjectResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetObjectResponse.ProtoReflect.Descriptor instead.
+func (*GetObjectResponse) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *GetObjectResponse) GetPart() isGetObjectResponse_Part {
+	if x != nil {
+		return x.Part
+	}
+	return nil
+}
+
+func (x *GetObjectResponse) GetHeader() *ObjectHeader {
+	if x != nil {
+		if x, ok := x.Part.(*GetObjectResponse_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *GetObjectResponse) GetData() []byte {
+	if x != nil {
+		if x, ok := x.Part.(*GetObjectResponse_Data); ok {
+			return x.Data
+		}
+	}
+	return nil
+}
+
+type isGetObjectResponse_Part interface {
+	isGetObjectResponse_Part()
+}
+
+type GetObjectResponse_Header struct {
+	Header *ObjectHeader `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type GetObjectResponse_Data struct {
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3,oneof"`
+}
+
+func (*GetObjectResponse_Header) isGetObjectResponse_Part() {}
+
+func (*GetObjectResponse_Data) isGetObjectResponse_Part() {}
+
+type ObjectHeader struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Size          int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ObjectHeader) Reset() {
+	*x = ObjectHeader{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[36]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ObjectHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ObjectHeader) ProtoMessage() {}
+
+func (x *ObjectHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[36]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ObjectHeader.ProtoReflect.Descriptor instead.
+func (*ObjectHeader) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{36}
+}
+
+func (x *ObjectHeader) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *ObjectHeader) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type GetChunkMapRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetChunkMapRequest) Reset() {
+	*x = GetChunkMapRequest{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[37]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetChunkMapRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetChunkMapRequest) ProtoMessage() {}
+
+func (x *GetChunkMapRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[37]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetChunkMapRequest.ProtoReflect.Descriptor instead.
+func (*GetChunkMapRequest) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{37}
+}
+
+func (x *GetChunkMapRequest) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *GetChunkMapRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type ChunkMap struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Etag          string                 `protobuf:"bytes,2,opt,name=etag,proto3" json:"etag,omitempty"`
+	Compression   string                 `protobuf:"bytes,3,opt,name=compression,proto3" json:"compression,omitempty"`
+	Chunks        []*ChunkSum            `protobuf:"bytes,4,rep,name=chunks,proto3" json:"chunks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChunkMap) Reset() {
+	*x = ChunkMap{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[38]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChunkMap) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChunkMap) ProtoMessage() {}
+
+func (x *ChunkMap) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[38]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChunkMap.ProtoReflect.Descriptor instead.
+func (*ChunkMap) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{38}
+}
+
+func (x *ChunkMap) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *ChunkMap) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+func (x *ChunkMap) GetCompression() string {
+	if x != nil {
+		return x.Compression
+	}
+	return ""
+}
+
+func (x *ChunkMap) GetChunks() []*ChunkSum {
+	if x != nil {
+		return x.Chunks
+	}
+	return nil
+}
+
+type ChunkSum struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Size          int64                  `protobuf:"varint,1,opt,name=size,proto3" json:"size,omitempty"`
+	Sha256        string                 `protobuf:"bytes,2,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChunkSum) Reset() {
+	*x = ChunkSum{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[39]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChunkSum) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChunkSum) ProtoMessage() {}
+
+func (x *ChunkSum) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[39]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChunkSum.ProtoReflect.Descriptor instead.
+func (*ChunkSum) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{39}
+}
+
+func (x *ChunkSum) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *ChunkSum) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+type GetChunkRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Seq           uint64                 `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+	Index         int32                  `protobuf:"varint,4,opt,name=index,proto3" json:"index,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetChunkRequest) Reset() {
+	*x = GetChunkRequest{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[40]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetChunkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetChunkRequest) ProtoMessage() {}
+
+func (x *GetChunkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[40]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetChunkRequest.ProtoReflect.Descriptor instead.
+func (*GetChunkRequest) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{40}
+}
+
+func (x *GetChunkRequest) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *GetChunkRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *GetChunkRequest) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *GetChunkRequest) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+type Chunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Chunk) Reset() {
+	*x = Chunk{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[41]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Chunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Chunk) ProtoMessage() {}
+
+func (x *Chunk) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[41]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Chunk.ProtoReflect.Descriptor instead.
+func (*Chunk) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{41}
+}
+
+func (x *Chunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type GetManifestRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetManifestRequest) Reset() {
+	*x = GetManifestRequest{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[42]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetManifestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetManifestRequest) ProtoMessage() {}
+
+func (x *GetManifestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[42]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetManifestRequest.ProtoReflect.Descriptor instead.
+func (*GetManifestRequest) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{42}
+}
+
+type Manifest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Clock         uint64                 `protobuf:"varint,1,opt,name=clock,proto3" json:"clock,omitempty"`
+	Buckets       []*BucketManifest      `protobuf:"bytes,2,rep,name=buckets,proto3" json:"buckets,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Manifest) Reset() {
+	*x = Manifest{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[43]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Manifest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Manifest) ProtoMessage() {}
+
+func (x *Manifest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[43]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Manifest.ProtoReflect.Descriptor instead.
+func (*Manifest) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{43}
+}
+
+func (x *Manifest) GetClock() uint64 {
+	if x != nil {
+		return x.Clock
+	}
+	return 0
+}
+
+func (x *Manifest) GetBuckets() []*BucketManifest {
+	if x != nil {
+		return x.Buckets
+	}
+	return nil
+}
+
+type BucketManifest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Root          uint64                 `protobuf:"varint,2,opt,name=root,proto3" json:"root,omitempty"`
+	Ranges        []uint64               `protobuf:"varint,3,rep,packed,name=ranges,proto3" json:"ranges,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BucketManifest) Reset() {
+	*x = BucketManifest{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[44]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BucketManifest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BucketManifest) ProtoMessage() {}
+
+func (x *BucketManifest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[44]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BucketManifest.ProtoReflect.Descriptor instead.
+func (*BucketManifest) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{44}
+}
+
+func (x *BucketManifest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *BucketManifest) GetRoot() uint64 {
+	if x != nil {
+		return x.Root
+	}
+	return 0
+}
+
+func (x *BucketManifest) GetRanges() []uint64 {
+	if x != nil {
+		return x.Ranges
+	}
+	return nil
+}
+
+type GetManifestRangeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bucket        string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Range         int32                  `protobuf:"varint,2,opt,name=range,proto3" json:"range,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetManifestRangeRequest) Reset() {
+	*x = GetManifestRangeRequest{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[45]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetManifestRangeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetManifestRangeRequest) ProtoMessage() {}
+
+func (x *GetManifestRangeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[45]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetManifestRangeRequest.ProtoReflect.Descriptor instead.
+func (*GetManifestRangeRequest) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{45}
+}
+
+func (x *GetManifestRangeRequest) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *GetManifestRangeRequest) GetRange() int32 {
+	if x != nil {
+		return x.Range
+	}
+	return 0
+}
+
+type ManifestRange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Changes       []*ObjectChange        `protobuf:"bytes,1,rep,name=changes,proto3" json:"changes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ManifestRange) Reset() {
+	*x = ManifestRange{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[46]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ManifestRange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ManifestRange) ProtoMessage() {}
+
+func (x *ManifestRange) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[46]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ManifestRange.ProtoReflect.Descriptor instead.
+func (*ManifestRange) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{46}
+}
+
+func (x *ManifestRange) GetChanges() []*ObjectChange {
+	if x != nil {
+		return x.Changes
+	}
+	return nil
+}
+
+type ObjectChange struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Bucket       string                 `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Key          string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Seq          uint64                 `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+	Deleted      bool                   `protobuf:"varint,4,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	Etag         string                 `protobuf:"bytes,5,opt,name=etag,proto3" json:"etag,omitempty"`
+	Size         int64                  `protobuf:"varint,6,opt,name=size,proto3" json:"size,omitempty"`
+	StorageClass string                 `protobuf:"bytes,7,opt,name=storage_class,json=storageClass,proto3" json:"storage_class,omitempty"`
+	ContentType  string                 `protobuf:"bytes,8,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	// RFC 3339, as the store keeps it.
+	ExpiresAt     string `protobuf:"bytes,9,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ObjectChange) Reset() {
+	*x = ObjectChange{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[47]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ObjectChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ObjectChange) ProtoMessage() {}
+
+func (x *ObjectChange) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[47]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ObjectChange.ProtoReflect.Descriptor instead.
+func (*ObjectChange) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{47}
+}
+
+func (x *ObjectChange) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *ObjectChange) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *ObjectChange) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *ObjectChange) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+func (x *ObjectChange) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+func (x *ObjectChange) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *ObjectChange) GetStorageClass() string {
+	if x != nil {
+		return x.StorageClass
+	}
+	return ""
+}
+
+func (x *ObjectChange) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *ObjectChange) GetExpiresAt() string {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return ""
+}
+
+type GetSnapshotRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSnapshotRequest) Reset() {
+	*x = GetSnapshotRequest{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[48]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSnapshotRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSnapshotRequest) ProtoMessage() {}
+
+func (x *GetSnapshotRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[48]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSnapshotRequest.ProtoReflect.Descriptor instead.
+func (*GetSnapshotRequest) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{48}
+}
+
+type Snapshot struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Clock          uint64                 `protobuf:"varint,1,opt,name=clock,proto3" json:"clock,omitempty"`
+	Buckets        []*BucketSnapshot      `protobuf:"bytes,2,rep,name=buckets,proto3" json:"buckets,omitempty"`
+	Access         []*AccessKey           `protobuf:"bytes,3,rep,name=access,proto3" json:"access,omitempty"`
+	Domains        []*Domain              `protobuf:"bytes,4,rep,name=domains,proto3" json:"domains,omitempty"`
+	DeletedBuckets []*Tombstone           `protobuf:"bytes,5,rep,name=deleted_buckets,json=deletedBuckets,proto3" json:"deleted_buckets,omitempty"`
+	DeletedAccess  []*Tombstone           `protobuf:"bytes,6,rep,name=deleted_access,json=deletedAccess,proto3" json:"deleted_access,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Snapshot) Reset() {
+	*x = Snapshot{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[49]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Snapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Snapshot) ProtoMessage() {}
+
+func (x *Snapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[49]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Snapshot.ProtoReflect.Descriptor instead.
+func (*Snapshot) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{49}
+}
+
+func (x *Snapshot) GetClock() uint64 {
+	if x != nil {
+		return x.Clock
+	}
+	return 0
+}
+
+func (x *Snapshot) GetBuckets() []*BucketSnapshot {
+	if x != nil {
+		return x.Buckets
+	}
+	return nil
+}
+
+func (x *Snapshot) GetAccess() []*AccessKey {
+	if x != nil {
+		return x.Access
+	}
+	return nil
+}
+
+func (x *Snapshot) GetDomains() []*Domain {
+	if x != nil {
+		return x.Domains
+	}
+	return nil
+}
+
+func (x *Snapshot) GetDeletedBuckets() []*Tombstone {
+	if x != nil {
+		return x.DeletedBuckets
+	}
+	return nil
+}
+
+func (x *Snapshot) GetDeletedAccess() []*Tombstone {
+	if x != nil {
+		return x.DeletedAccess
+	}
+	return nil
+}
+
+type BucketSnapshot struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Name              string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Encryption        string                 `protobuf:"bytes,2,opt,name=encryption,proto3" json:"encryption,omitempty"`
+	TrashDays         int32                  `protobuf:"varint,3,opt,name=trash_days,json=trashDays,proto3" json:"trash_days,omitempty"`
+	Copies            int32                  `protobuf:"varint,4,opt,name=copies,proto3" json:"copies,omitempty"`
+	Federation        bool                   `protobuf:"varint,5,opt,name=federation,proto3" json:"federation,omitempty"`
+	ReplicationPaused bool                   `protobuf:"varint,6,opt,name=replication_paused,json=replicationPaused,proto3" json:"replication_paused,omitempty"`
+	// RFC 3339, as the store keeps it.
+	CreatedAt   string `protobuf:"bytes,7,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Consistency string `protobuf:"bytes,8,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	// The bucket's previous name, if it was renamed.
+	RenamedFrom   string `protobuf:"bytes,9,opt,name=renamed_from,json=renamedFrom,proto3" json:"renamed_from,omitempty"`
+	QuotaBytes    int64  `protobuf:"varint,10,opt,name=quota_bytes,json=quotaBytes,proto3" json:"quota_bytes,omitempty"`
+	PublicRead    bool   `protobuf:"varint,11,opt,name=public_read,json=publicRead,proto3" json:"public_read,omitempty"`
+	Versioning    string `protobuf:"bytes,12,opt,name=versioning,proto3" json:"versioning,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BucketSnapshot) Reset() {
+	*x = BucketSnapshot{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[50]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BucketSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BucketSnapshot) ProtoMessage() {}
+
+func (x *BucketSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[50]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BucketSnapshot.ProtoReflect.Descriptor instead.
+func (*BucketSnapshot) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{50}
+}
+
+func (x *BucketSnapshot) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *BucketSnapshot) GetEncryption() string {
+	if x != nil {
+		return x.Encryption
+	}
+	return ""
+}
+
+func (x *BucketSnapshot) GetTrashDays() int32 {
+	if x != nil {
+		return x.TrashDays
+	}
+	return 0
+}
+
+func (x *BucketSnapshot) GetCopies() int32 {
+	if x != nil {
+		return x.Copies
+	}
+	return 0
+}
+
+func (x *BucketSnapshot) GetFederation() bool {
+	if x != nil {
+		return x.Federation
+	}
+	return false
+}
+
+func (x *BucketSnapshot) GetReplicationPaused() bool {
+	if x != nil {
+		return x.ReplicationPaused
+	}
+	return false
+}
+
+func (x *BucketSnapshot) GetCreatedAt() string {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return ""
+}
+
+func (x *BucketSnapshot) GetConsistency() string {
+	if x != nil {
+		return x.Consistency
+	}
+	return ""
+}
+
+func (x *BucketSnapshot) GetRenamedFrom() string {
+	if x != nil {
+		return x.RenamedFrom
+	}
+	return ""
+}
+
+func (x *BucketSnapshot) GetQuotaBytes() int64 {
+	if x != nil {
+		return x.QuotaBytes
+	}
+	return 0
+}
+
+func (x *BucketSnapshot) GetPublicRead() bool {
+	if x != nil {
+		return x.PublicRead
+	}
+	return false
+}
+
+func (x *BucketSnapshot) GetVersioning() string {
+	if x != nil {
+		return x.Versioning
+	}
+	return ""
+}
+
+type Domain struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Host          string                 `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	Bucket        string                 `protobuf:"bytes,2,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Domain) Reset() {
+	*x = Domain{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[51]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Domain) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Domain) ProtoMessage() {}
+
+func (x *Domain) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[51]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Domain.ProtoReflect.Descriptor instead.
+func (*Domain) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{51}
+}
+
+func (x *Domain) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *Domain) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+// Tombstone records when a bucket or access key was deleted.
+type Tombstone struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// RFC 3339, as the store keeps it.
+	DeletedAt     string `protobuf:"bytes,2,opt,name=deleted_at,json=deletedAt,proto3" json:"deleted_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Tombstone) Reset() {
+	*x = Tombstone{}
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[52]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Tombstone) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tombstone) ProtoMessage() {}
+
+func (x *Tombstone) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cluster_pb_replication_proto_msgTypes[52]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tombstone.ProtoReflect.Descriptor instead.
+func (*Tombstone) Descriptor() ([]byte, []int) {
+	return file_internal_cluster_pb_replication_proto_rawDescGZIP(), []int{52}
+}
+
+func (x *Tombstone) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Tombstone) GetDeletedAt() string {
+	if x != nil {
+		return x.DeletedAt
+	}
+	return ""
+}
+
+var File_internal_cluster_pb_replication_proto protoreflect.FileDescriptor
+
+const file_internal_cluster_pb_replication_proto_rawDesc = "" +
+	"\n" +
+	"%internal/cluster/pb/replication.proto\x12\x11entity.cluster.v1\"\x0f\n" +
+	"\rHealthRequest\"S\n" +
+	"\x0eHealthResponse\x12$\n" +
+	"\x0etime_unix_nano\x18\x01 \x01(\x03R\ftimeUnixNano\x12\x1b\n" +
+	"\tread_only\x18\x02 \x01(\bR\breadOnly\"h\n" +
+	"\rMutateRequest\x129\n" +
+	"\bmutation\x18\x01 \x01(\v2\x1b.entity.cluster.v1.MutationH\x00R\bmutation\x12\x14\n" +
+	"\x04data\x18\x02 \x01(\fH\x00R\x04dataB\x06\n" +
+	"\x04part\"\x10\n" +
+	"\x0eMutateResponse\"\xa2\x0e\n" +
+	"\bMutation\x12F\n" +
+	"\rcreate_bucket\x18\x01 \x01(\v2\x1f.entity.cluster.v1.CreateBucketH\x00R\fcreateBucket\x12F\n" +
+	"\rdelete_bucket\x18\x02 \x01(\v2\x1f.entity.cluster.v1.DeleteBucketH\x00R\fdeleteBucket\x12_\n" +
+	"\x16set_replication_paused\x18\x03 \x01(\v2'.entity.cluster.v1.SetReplicationPausedH\x00R\x14setReplicationPaused\x12M\n" +
+	"\x10set_bucket_trash\x18\x04 \x01(\v2!.entity.cluster.v1.SetBucketTrashH\x00R\x0esetBucketTrash\x12P\n" +
+	"\x11set_bucket_copies\x18\x05 \x01(\v2\".entity.cluster.v1.SetBucketCopiesH\x00R\x0fsetBucketCopies\x12I\n" +
+	"\x0eset_federation\x18\x06 \x01(\v2 .entity.cluster.v1.SetFederationH\x00R\rsetFederation\x12\\\n" +
+	"\x15set_federation_cursor\x18\a \x01(\v2&.entity.cluster.v1.SetFederationCursorH\x00R\x13setFederationCursor\x12\\\n" +
+	"\x15set_bucket_encryption\x18\b \x01(\v2&.entity.cluster.v1.SetBucketEncryptionH\x00R\x13setBucketEncryption\x12=\n" +
+	"\n" +
+	"put_object\x18\t \x01(\v2\x1c.entity.cluster.v1.PutObjectH\x00R\tputObject\x12F\n" +
+	"\rdelete_object\x18\n" +
+	" \x01(\v2\x1f.entity.cluster.v1.DeleteObjectH\x00R\fdeleteObject\x12P\n" +
+	"\x11put_remote_object\x18\v \x01(\v2\".entity.cluster.v1.PutRemoteObjectH\x00R\x0fputRemoteObject\x12L\n" +
+	"\x0frestore_trashed\x18\f \x01(\v2!.entity.cluster.v1.RestoreTrashedH\x00R\x0erestoreTrashed\x12I\n" +
+	"\x0erestore_object\x18\r \x01(\v2 .entity.cluster.v1.RestoreObjectH\x00R\rrestoreObject\x12P\n" +
+	"\x11set_object_expiry\x18\x0e \x01(\v2\".entity.cluster.v1.SetObjectExpiryH\x00R\x0fsetObjectExpiry\x12=\n" +
+	"\n" +
+	"put_access\x18\x0f \x01(\v2\x1c.entity.cluster.v1.PutAccessH\x00R\tputAccess\x12F\n" +
+	"\rdelete_access\x18\x10 \x01(\v2\x1f.entity.cluster.v1.DeleteAccessH\x00R\fdeleteAccess\x12=\n" +
+	"\n" +
+	"put_domain\x18\x11 \x01(\v2\x1c.entity.cluster.v1.PutDomainH\x00R\tputDomain\x12F\n" +
+	"\rdelete_domain\x18\x12 \x01(\v2\x1f.entity.cluster.v1.DeleteDomainH\x00R\fdeleteDomain\x126\n" +
+	"\apromote\x18\x13 \x01(\v2\x1a.entity.cluster.v1.PromoteH\x00R\apromote\x12_\n" +
+	"\x16set_bucket_consistency\x18\x15 \x01(\v2'.entity.cluster.v1.SetBucketConsistencyH\x00R\x14setBucketConsistency\x12F\n" +
+	"\rrename_bucket\x18\x16 \x01(\v2\x1f.entity.cluster.v1.RenameBucketH\x00R\frenameBucket\x12P\n" +
+	"\x11set_bucket_config\x18\x17 \x01(\v2\".entity.cluster.v1.SetBucketConfigH\x00R\x0fsetBucketConfig\x12\\\n" +
+	"\x15delete_object_version\x18\x18 \x01(\v2&.entity.cluster.v1.DeleteObjectVersionH\x00R\x13deleteObjectVersion\x12\x14\n" +
+	"\x05epoch\x18\x14 \x01(\x04R\x05epochB\x04\n" +
+	"\x02op\"&\n" +
+	"\fCreateBucket\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\"<\n" +
+	"\fDeleteBucket\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x14\n" +
+	"\x05force\x18\x02 \x01(\bR\x05force\"F\n" +
+	"\x14SetReplicationPaused\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x16\n" +
+	"\x06paused\x18\x02 \x01(\bR\x06paused\"<\n" +
+	"\x0eSetBucketTrash\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x12\n" +
+	"\x04days\x18\x02 \x01(\x05R\x04days\"A\n" +
+	"\x0fSetBucketCopies\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x16\n" +
+	"\x06copies\x18\x02 \x01(\x05R\x06copies\"Y\n" +
+	"\rSetFederation\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x18\n" +
+	"\aenabled\x18\x02 \x01(\bR\aenabled\x12\x16\n" +
+	"\x06cursor\x18\x03 \x01(\x04R\x06cursor\"E\n" +
+	"\x13SetFederationCursor\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x16\n" +
+	"\x06cursor\x18\x02 \x01(\x04R\x06cursor\"K\n" +
+	"\x13SetBucketEncryption\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x1c\n" +
+	"\talgorithm\x18\x02 \x01(\tR\talgorithm\"\xab\x01\n" +
+	"\x0fSetBucketConfig\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x1e\n" +
+	"\n" +
+	"versioning\x18\x02 \x01(\tR\n" +
+	"versioning\x12\x1f\n" +
+	"\vquota_bytes\x18\x03 \x01(\x03R\n" +
+	"quotaBytes\x12\x1f\n" +
+	"\vpublic_read\x18\x04 \x01(\bR\n" +
+	"publicRead\x12\x1e\n" +
+	"\n" +
+	"encryption\x18\x05 \x01(\tR\n" +
+	"encryption\":\n" +
+	"\fRenameBucket\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"P\n" +
+	"\x14SetBucketConsistency\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12 \n" +
+	"\vconsistency\x18\x02 \x01(\tR\vconsistency\"\x88\x01\n" +
+	"\rObjectOptions\x12#\n" +
+	"\rstorage_class\x18\x01 \x01(\tR\fstorageClass\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\x12/\n" +
+	"\x14expires_at_unix_nano\x18\x03 \x01(\x03R\x11expiresAtUnixNano\"\xab\x01\n" +
+	"\tPutObject\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x10\n" +
+	"\x03seq\x18\x03 \x01(\x04R\x03seq\x12:\n" +
+	"\aoptions\x18\x04 \x01(\v2 .entity.cluster.v1.ObjectOptionsR\aoptions\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\x03R\x04size\x12\x12\n" +
+	"\x04etag\x18\x06 \x01(\tR\x04etag\"J\n" +
+	"\fDeleteObject\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x10\n" +
+	"\x03seq\x18\x03 \x01(\x04R\x03seq\"p\n" +
+	"\x13DeleteObjectVersion\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x1d\n" +
+	"\n" +
+	"version_id\x18\x03 \x01(\tR\tversionId\x12\x10\n" +
+	"\x03seq\x18\x04 \x01(\x04R\x03seq\"\xc9\x01\n" +
+	"\x0fPutRemoteObject\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x10\n" +
+	"\x03seq\x18\x03 \x01(\x04R\x03seq\x12\x16\n" +
+	"\x06origin\x18\x04 \x01(\x05R\x06origin\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\x03R\x04size\x12\x12\n" +
+	"\x04etag\x18\x06 \x01(\tR\x04etag\x12:\n" +
+	"\aoptions\x18\a \x01(\v2 .entity.cluster.v1.ObjectOptionsR\aoptions\"J\n" +
+	"\x0eRestoreTrashed\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x04R\x02id\x12\x10\n" +
+	"\x03seq\x18\x03 \x01(\x04R\x03seq\"M\n" +
+	"\rRestoreObject\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x12\n" +
+	"\x04days\x18\x03 \x01(\x05R\x04days\"l\n" +
+	"\x0fSetObjectExpiry\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12/\n" +
+	"\x14expires_at_unix_nano\x18\x03 \x01(\x03R\x11expiresAtUnixNano\"\x96\x03\n" +
+	"\tAccessKey\x12\x1d\n" +
+	"\n" +
+	"access_key\x18\x01 \x01(\tR\taccessKey\x12\x1d\n" +
+	"\n" +
+	"secret_key\x18\x02 \x01(\tR\tsecretKey\x12\x16\n" +
+	"\x06bucket\x18\x03 \x01(\tR\x06bucket\x12\x1b\n" +
+	"\tread_only\x18\x04 \x01(\bR\breadOnly\x12#\n" +
+	"\rallowed_cidrs\x18\x05 \x03(\tR\fallowedCidrs\x12\x14\n" +
+	"\x05owner\x18\x06 \x01(\tR\x05owner\x12.\n" +
+	"\x13requests_per_second\x18\a \x01(\x01R\x11requestsPerSecond\x12(\n" +
+	"\x10bytes_per_second\x18\b \x01(\x03R\x0ebytesPerSecond\x12/\n" +
+	"\x14created_at_unix_nano\x18\t \x01(\x03R\x11createdAtUnixNano\x12/\n" +
+	"\x14expires_at_unix_nano\x18\n" +
+	" \x01(\x03R\x11expiresAtUnixNano\x12\x1f\n" +
+	"\vpolicy_json\x18\v \x01(\tR\n" +
+	"policyJson\"A\n" +
+	"\tPutAccess\x124\n" +
+	"\x06access\x18\x01 \x01(\v2\x1c.entity.cluster.v1.AccessKeyR\x06access\"-\n" +
+	"\fDeleteAccess\x12\x1d\n" +
+	"\n" +
+	"access_key\x18\x01 \x01(\tR\taccessKey\"7\n" +
+	"\tPutDomain\x12\x12\n" +
+	"\x04host\x18\x01 \x01(\tR\x04host\x12\x16\n" +
+	"\x06bucket\x18\x02 \x01(\tR\x06bucket\"\"\n" +
+	"\fDeleteDomain\x12\x12\n" +
+	"\x04host\x18\x01 \x01(\tR\x04host\"\t\n" +
+	"\aPromote\"\xed\x01\n" +
+	"\rCommitRequest\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x16\n" +
+	"\x06origin\x18\x03 \x01(\x05R\x06origin\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\x12\x12\n" +
+	"\x04etag\x18\x05 \x01(\tR\x04etag\x12:\n" +
+	"\aoptions\x18\x06 \x01(\v2 .entity.cluster.v1.ObjectOptionsR\aoptions\x12 \n" +
+	"\vconsistency\x18\a \x01(\tR\vconsistency\x12\x14\n" +
+	"\x05epoch\x18\b \x01(\x04R\x05epoch\"\"\n" +
+	"\x0eCommitResponse\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\"x\n" +
+	"\fAbortRequest\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x16\n" +
+	"\x06origin\x18\x03 \x01(\x05R\x06origin\x12\x10\n" +
+	"\x03seq\x18\x04 \x01(\x04R\x03seq\x12\x14\n" +
+	"\x05epoch\x18\x05 \x01(\x04R\x05epoch\"\x0f\n" +
+	"\rAbortResponse\"P\n" +
+	"\x10GetObjectRequest\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x12\n" +
+	"\x04head\x18\x03 \x01(\bR\x04head\"l\n" +
+	"\x11GetObjectResponse\x129\n" +
+	"\x06header\x18\x01 \x01(\v2\x1f.entity.cluster.v1.ObjectHeaderH\x00R\x06header\x12\x14\n" +
+	"\x04data\x18\x02 \x01(\fH\x00R\x04dataB\x06\n" +
+	"\x04part\"4\n" +
+	"\fObjectHeader\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\">\n" +
+	"\x12GetChunkMapRequest\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\"\x87\x01\n" +
+	"\bChunkMap\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12\x12\n" +
+	"\x04etag\x18\x02 \x01(\tR\x04etag\x12 \n" +
+	"\vcompression\x18\x03 \x01(\tR\vcompression\x123\n" +
+	"\x06chunks\x18\x04 \x03(\v2\x1b.entity.cluster.v1.ChunkSumR\x06chunks\"6\n" +
+	"\bChunkSum\x12\x12\n" +
+	"\x04size\x18\x01 \x01(\x03R\x04size\x12\x16\n" +
+	"\x06sha256\x18\x02 \x01(\tR\x06sha256\"c\n" +
+	"\x0fGetChunkRequest\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x10\n" +
+	"\x03seq\x18\x03 \x01(\x04R\x03seq\x12\x14\n" +
+	"\x05index\x18\x04 \x01(\x05R\x05index\"\x1b\n" +
+	"\x05Chunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"\x14\n" +
+	"\x12GetManifestRequest\"]\n" +
+	"\bManifest\x12\x14\n" +
+	"\x05clock\x18\x01 \x01(\x04R\x05clock\x12;\n" +
+	"\abuckets\x18\x02 \x03(\v2!.entity.cluster.v1.BucketManifestR\abuckets\"P\n" +
+	"\x0eBucketManifest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04root\x18\x02 \x01(\x04R\x04root\x12\x16\n" +
+	"\x06ranges\x18\x03 \x03(\x04R\x06ranges\"G\n" +
+	"\x17GetManifestRangeRequest\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x14\n" +
+	"\x05range\x18\x02 \x01(\x05R\x05range\"J\n" +
+	"\rManifestRange\x129\n" +
+	"\achanges\x18\x01 \x03(\v2\x1f.entity.cluster.v1.ObjectChangeR\achanges\"\xf3\x01\n" +
+	"\fObjectChange\x12\x16\n" +
+	"\x06bucket\x18\x01 \x01(\tR\x06bucket\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x10\n" +
+	"\x03seq\x18\x03 \x01(\x04R\x03seq\x12\x18\n" +
+	"\adeleted\x18\x04 \x01(\bR\adeleted\x12\x12\n" +
+	"\x04etag\x18\x05 \x01(\tR\x04etag\x12\x12\n" +
+	"\x04size\x18\x06 \x01(\x03R\x04size\x12#\n" +
+	"\rstorage_class\x18\a \x01(\tR\fstorageClass\x12!\n" +
+	"\fcontent_type\x18\b \x01(\tR\vcontentType\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\t \x01(\tR\texpiresAt\"\x14\n" +
+	"\x12GetSnapshotRequest\"\xd4\x02\n" +
+	"\bSnapshot\x12\x14\n" +
+	"\x05clock\x18\x01 \x01(\x04R\x05clock\x12;\n" +
+	"\abuckets\x18\x02 \x03(\v2!.entity.cluster.v1.BucketSnapshotR\abuckets\x124\n" +
+	"\x06access\x18\x03 \x03(\v2\x1c.entity.cluster.v1.AccessKeyR\x06access\x123\n" +
+	"\adomains\x18\x04 \x03(\v2\x19.entity.cluster.v1.DomainR\adomains\x12E\n" +
+	"\x0fdeleted_buckets\x18\x05 \x03(\v2\x1c.entity.cluster.v1.TombstoneR\x0edeletedBuckets\x12C\n" +
+	"\x0edeleted_access\x18\x06 \x03(\v2\x1c.entity.cluster.v1.TombstoneR\rdeletedAccess\"\x90\x03\n" +
+	"\x0eBucketSnapshot\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1e\n" +
+	"\n" +
+	"encryption\x18\x02 \x01(\tR\n" +
+	"encryption\x12\x1d\n" +
+	"\n" +
+	"trash_days\x18\x03 \x01(\x05R\ttrashDays\x12\x16\n" +
+	"\x06copies\x18\x04 \x01(\x05R\x06copies\x12\x1e\n" +
+	"\n" +
+	"federation\x18\x05 \x01(\bR\n" +
+	"federation\x12-\n" +
+	"\x12replication_paused\x18\x06 \x01(\bR\x11replicationPaused\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\a \x01(\tR\tcreatedAt\x12 \n" +
+	"\vconsistency\x18\b \x01(\tR\vconsistency\x12!\n" +
+	"\frenamed_from\x18\t \x01(\tR\vrenamedFrom\x12\x1f\n" +
+	"\vquota_bytes\x18\n" +
+	" \x01(\x03R\n" +
+	"quotaBytes\x12\x1f\n" +
+	"\vpublic_read\x18\v \x01(\bR\n" +
+	"publicRead\x12\x1e\n" +
+	"\n" +
+	"versioning\x18\f \x01(\tR\n" +
+	"versioning\"4\n" +
+	"\x06Domain\x12\x12\n" +
+	"\x04host\x18\x01 \x01(\tR\x04host\x12\x16\n" +
+	"\x06bucket\x18\x02 \x01(\tR\x06bucket\">\n" +
+	"\tTombstone\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1d\n" +
+	"\n" +
+	"deleted_at\x18\x02 \x01(\tR\tdeletedAt2\xc9\x06\n" +
+	"\vReplication\x12M\n" +
+	"\x06Health\x12 .entity.cluster.v1.HealthRequest\x1a!.entity.cluster.v1.HealthResponse\x12O\n" +
+	"\x06Mutate\x12 .entity.cluster.v1.MutateRequest\x1a!.entity.cluster.v1.MutateResponse(\x01\x12M\n" +
+	"\x06Commit\x12 .entity.cluster.v1.CommitRequest\x1a!.entity.cluster.v1.CommitResponse\x12J\n" +
+	"\x05Abort\x12\x1f.entity.cluster.v1.AbortRequest\x1a .entity.cluster.v1.AbortResponse\x12X\n" +
+	"\tGetObject\x12#.entity.cluster.v1.GetObjectRequest\x1a$.entity.cluster.v1.GetObjectResponse0\x01\x12Q\n" +
+	"\vGetChunkMap\x12%.entity.cluster.v1.GetChunkMapRequest\x1a\x1b.entity.cluster.v1.ChunkMap\x12J\n" +
+	"\bGetChunk\x12\".entity.cluster.v1.GetChunkRequest\x1a\x18.entity.cluster.v1.Chunk0\x01\x12Q\n" +
+	"\vGetManifest\x12%.entity.cluster.v1.GetManifestRequest\x1a\x1b.entity.cluster.v1.Manifest\x12`\n" +
+	"\x10GetManifestRange\x12*.entity.cluster.v1.GetManifestRangeRequest\x1a .entity.cluster.v1.ManifestRange\x12Q\n" +
+	"\vGetSnapshot\x12%.entity.cluster.v1.GetSnapshotRequest\x1a\x1b.entity.cluster.v1.SnapshotB0Z.github.com/mchenetz/entity/internal/cluster/pbb\x06proto3"
+
+var (
+	file_internal_cluster_pb_replication_proto_rawDescOnce sync.Once
+	file_internal_cluster_pb_replication_proto_rawDescData []byte
+)
+
+func file_internal_cluster_pb_replication_proto_rawDescGZIP() []byte {
+	file_internal_cluster_pb_replication_proto_rawDescOnce.Do(func() {
+		file_internal_cluster_pb_replication_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_internal_cluster_pb_replication_proto_rawDesc), len(file_internal_cluster_pb_replication_proto_rawDesc)))
+	})
+	return file_internal_cluster_pb_replication_proto_rawDescData
+}
+
+var file_internal_cluster_pb_replication_proto_msgTypes = make([]protoimpl.MessageInfo, 53)
+var file_internal_cluster_pb_replication_proto_goTypes = []any{
+	(*HealthRequest)(nil),           // 0: entity.cluster.v1.HealthRequest
+	(*HealthResponse)(nil),          // 1: entity.cluster.v1.HealthResponse
+	(*MutateRequest)(nil),           // 2: entity.cluster.v1.MutateRequest
+	(*MutateResponse)(nil),          // 3: entity.cluster.v1.MutateResponse
+	(*Mutation)(nil),                // 4: entity.cluster.v1.Mutation
+	(*CreateBucket)(nil),            // 5: entity.cluster.v1.CreateBucket
+	(*DeleteBucket)(nil),            // 6: entity.cluster.v1.DeleteBucket
+	(*SetReplicationPaused)(nil),    // 7: entity.cluster.v1.SetReplicationPaused
+	(*SetBucketTrash)(nil),          // 8: entity.cluster.v1.SetBucketTrash
+	(*SetBucketCopies)(nil),         // 9: entity.cluster.v1.SetBucketCopies
+	(*SetFederation)(nil),           // 10: entity.cluster.v1.SetFederation
+	(*SetFederationCursor)(nil),     // 11: entity.cluster.v1.SetFederationCursor
+	(*SetBucketEncryption)(nil),     // 12: entity.cluster.v1.SetBucketEncryption
+	(*SetBucketConfig)(nil),         // 13: entity.cluster.v1.SetBucketConfig
+	(*RenameBucket)(nil),            // 14: entity.cluster.v1.RenameBucket
+	(*SetBucketConsistency)(nil),    // 15: entity.cluster.v1.SetBucketConsistency
+	(*ObjectOptions)(nil),           // 16: entity.cluster.v1.ObjectOptions
+	(*PutObject)(nil),               // 17: entity.cluster.v1.PutObject
+	(*DeleteObject)(nil),            // 18: entity.cluster.v1.DeleteObject
+	(*DeleteObjectVersion)(nil),     // 19: entity.cluster.v1.DeleteObjectVersion
+	(*PutRemoteObject)(nil),         // 20: entity.cluster.v1.PutRemoteObject
+	(*RestoreTrashed)(nil),          // 21: entity.cluster.v1.RestoreTrashed
+	(*RestoreObject)(nil),           // 22: entity.cluster.v1.RestoreObject
+	(*SetObjectExpiry)(nil),         // 23: entity.cluster.v1.SetObjectExpiry
+	(*AccessKey)(nil),               // 24: entity.cluster.v1.AccessKey
+	(*PutAccess)(nil),               // 25: entity.cluster.v1.PutAccess
+	(*DeleteAccess)(nil),            // 26: entity.cluster.v1.DeleteAccess
+	(*PutDomain)(nil),               // 27: entity.cluster.v1.PutDomain
+	(*DeleteDomain)(nil),            // 28: entity.cluster.v1.DeleteDomain
+	(*Promote)(nil),                 // 29: entity.cluster.v1.Promote
+	(*CommitRequest)(nil),           // 30: entity.cluster.v1.CommitRequest
+	(*CommitResponse)(nil),          // 31: entity.cluster.v1.CommitResponse
+	(*AbortRequest)(nil),            // 32: entity.cluster.v1.AbortRequest
+	(*AbortResponse)(nil),           // 33: entity.cluster.v1.AbortResponse
+	(*GetObjectRequest)(nil),        // 34: entity.cluster.v1.GetObjectRequest
+	(*GetObjectResponse)(nil),       // 35: entity.cluster.v1.GetObjectResponse
+	(*ObjectHeader)(nil),            // 36: entity.cluster.v1.ObjectHeader
+	(*GetChunkMapRequest)(nil),      // 37: entity.cluster.v1.GetChunkMapRequest
+	(*ChunkMap)(nil),                // 38: entity.cluster.v1.ChunkMap
+	(*ChunkSum)(nil),                // 39: entity.cluster.v1.ChunkSum
+	(*GetChunkRequest)(nil),         // 40: entity.cluster.v1.GetChunkRequest
+	(*Chunk)(nil),                   // 41: entity.cluster.v1.Chunk
+	(*GetManifestRequest)(nil),      // 42: entity.cluster.v1.GetManifestRequest
+	(*Manifest)(nil),                // 43: entity.cluster.v1.Manifest
+	(*BucketManifest)(nil),          // 44: entity.cluster.v1.BucketManifest
+	(*GetManifestRangeRequest)(nil), // 45: entity.cluster.v1.GetManifestRangeRequest
+	(*ManifestRange)(nil),           // 46: entity.cluster.v1.ManifestRange
+	(*ObjectChange)(nil),            // 47: entity.cluster.v1.ObjectChange
+	(*GetSnapshotRequest)(nil),      // 48: entity.cluster.v1.GetSnapshotRequest
+	(*Snapshot)(nil),                // 49: entity.cluster.v1.Snapshot
+	(*BucketSnapshot)(nil),          // 50: entity.cluster.v1.BucketSnapshot
+	(*Domain)(nil),                  // 51: entity.cluster.v1.Domain
+	(*Tombstone)(nil),               // 52: entity.cluster.v1.Tombstone
+}
+var file_internal_cluster_pb_replication_proto_depIdxs = []int32{
+	4,  // 0: entity.cluster.v1.MutateRequest.mutation:type_name -> entity.cluster.v1.Mutation
+	5,  // 1: entity.cluster.v1.Mutation.create_bucket:type_name -> entity.cluster.v1.CreateBucket
+	6,  // 2: entity.cluster.v1.Mutation.delete_bucket:type_name -> entity.cluster.v1.DeleteBucket
+	7,  // 3: entity.cluster.v1.Mutation.set_replication_paused:type_name -> entity.cluster.v1.SetReplicationPaused
+	8,  // 4: entity.cluster.v1.Mutation.set_bucket_trash:type_name -> entity.cluster.v1.SetBucketTrash
+	9,  // 5: entity.cluster.v1.Mutation.set_bucket_copies:type_name -> entity.cluster.v1.SetBucketCopies
+	10, // 6: entity.cluster.v1.Mutation.set_federation:type_name -> entity.cluster.v1.SetFederation
+	11, // 7: entity.cluster.v1.Mutation.set_federation_cursor:type_name -> entity.cluster.v1.SetFederationCursor
+	12, // 8: entity.cluster.v1.Mutation.set_bucket_encryption:type_name -> entity.cluster.v1.SetBucketEncryption
+	17, // 9: entity.cluster.v1.Mutation.put_object:type_name -> entity.cluster.v1.PutObject
+	18, // 10: entity.cluster.v1.Mutation.delete_object:type_name -> entity.cluster.v1.DeleteObject
+	20, // 11: entity.cluster.v1.Mutation.put_remote_object:type_name -> entity.cluster.v1.PutRemoteObject
+	21, // 12: entity.cluster.v1.Mutation.restore_trashed:type_name -> entity.cluster.v1.RestoreTrashed
+	22, // 13: entity.cluster.v1.Mutation.restore_object:type_name -> entity.cluster.v1.RestoreObject
+	23, // 14: entity.cluster.v1.Mutation.set_object_expiry:type_name -> entity.cluster.v1.SetObjectExpiry
+	25, // 15: entity.cluster.v1.Mutation.put_access:type_name -> entity.cluster.v1.PutAccess
+	26, // 16: entity.cluster.v1.Mutation.delete_access:type_name -> entity.cluster.v1.DeleteAccess
+	27, // 17: entity.cluster.v1.Mutation.put_domain:type_name -> entity.cluster.v1.PutDomain
+	28, // 18: entity.cluster.v1.Mutation.delete_domain:type_name -> entity.cluster.v1.DeleteDomain
+	29, // 19: entity.cluster.v1.Mutation.promote:type_name -> entity.cluster.v1.Promote
+	15, // 20: entity.cluster.v1.Mutation.set_bucket_consistency:type_name -> entity.cluster.v1.SetBucketConsistency
+	14, // 21: entity.cluster.v1.Mutation.rename_bucket:type_name -> entity.cluster.v1.RenameBucket
+	13, // 22: entity.cluster.v1.Mutation.set_bucket_config:type_name -> entity.cluster.v1.SetBucketConfig
+	19, // 23: entity.cluster.v1.Mutation.delete_object_version:type_name -> entity.cluster.v1.DeleteObjectVersion
+	16, // 24: entity.cluster.v1.PutObject.options:type_name -> entity.cluster.v1.ObjectOptions
+	16, // 25: entity.cluster.v1.PutRemoteObject.options:type_name -> entity.cluster.v1.ObjectOptions
+	24, // 26: entity.cluster.v1.PutAccess.access:type_name -> entity.cluster.v1.AccessKey
+	16, // 27: entity.cluster.v1.CommitRequest.options:type_name -> entity.cluster.v1.ObjectOptions
+	36, // 28: entity.cluster.v1.GetObjectResponse.header:type_name -> entity.cluster.v1.ObjectHeader
+	39, // 29: entity.cluster.v1.ChunkMap.chunks:type_name -> entity.cluster.v1.ChunkSum
+	44, // 30: entity.cluster.v1.Manifest.buckets:type_name -> entity.cluster.v1.BucketManifest
+	47, // 31: entity.cluster.v1.ManifestRange.changes:type_name -> entity.cluster.v1.ObjectChange
+	50, // 32: entity.cluster.v1.Snapshot.buckets:type_name -> entity.cluster.v1.BucketSnapshot
+	24, // 33: entity.cluster.v1.Snapshot.access:type_name -> entity.cluster.v1.AccessKey
+	51, // 34: entity.cluster.v1.Snapshot.domains:type_name -> entity.cluster.v1.Domain
+	52, // 35: entity.cluster.v1.Snapshot.deleted_buckets:type_name -> entity.cluster.v1.Tombstone
+	52, // 36: entity.cluster.v1.Snapshot.deleted_access:type_name -> entity.cluster.v1.Tombstone
+	0,  // 37: entity.cluster.v1.Replication.Health:input_type -> entity.cluster.v1.HealthRequest
+	2,  // 38: entity.cluster.v1.Replication.Mutate:input_type -> entity.cluster.v1.MutateRequest
+	30, // 39: entity.cluster.v1.Replication.Commit:input_type -> entity.cluster.v1.CommitRequest
+	32, // 40: entity.cluster.v1.Replication.Abort:input_type -> entity.cluster.v1.AbortRequest
+	34, // 41: entity.cluster.v1.Replication.GetObject:input_type -> entity.cluster.v1.GetObjectRequest
+	37, // 42: entity.cluster.v1.Replication.GetChunkMap:input_type -> entity.cluster.v1.GetChunkMapRequest
+	40, // 43: entity.cluster.v1.Replication.GetChunk:input_type -> entity.cluster.v1.GetChunkRequest
+	42, // 44: entity.cluster.v1.Replication.GetManifest:input_type -> entity.cluster.v1.GetManifestRequest
+	45, // 45: entity.cluster.v1.Replication.GetManifestRange:input_type -> entity.cluster.v1.GetManifestRangeRequest
+	48, // 46: entity.cluster.v1.Replication.GetSnapshot:input_type -> entity.cluster.v1.GetSnapshotRequest
+	1,  // 47: entity.cluster.v1.Replication.Health:output_type -> entity.cluster.v1.HealthResponse
+	3,  // 48: entity.cluster.v1.Replication.Mutate:output_type -> entity.cluster.v1.MutateResponse
+	31, // 49: entity.cluster.v1.Replication.Commit:output_type -> entity.cluster.v1.CommitResponse
+	33, // 50: entity.cluster.v1.Replication.Abort:output_type -> entity.cluster.v1.AbortResponse
+	35, // 51: entity.cluster.v1.Replication.GetObject:output_type -> entity.cluster.v1.GetObjectResponse
+	38, // 52: entity.cluster.v1.Replication.GetChunkMap:output_type -> entity.cluster.v1.ChunkMap
+	41, // 53: entity.cluster.v1.Replication.GetChunk:output_type -> entity.cluster.v1.Chunk
+	43, // 54: entity.cluster.v1.Replication.GetManifest:output_type -> entity.cluster.v1.Manifest
+	46, // 55: entity.cluster.v1.Replication.GetManifestRange:output_type -> entity.cluster.v1.ManifestRange
+	49, // 56: entity.cluster.v1.Replication.GetSnapshot:output_type -> entity.cluster.v1.Snapshot
+	47, // [47:57] is the sub-list for method output_type
+	37, // [37:47] is the sub-list for method input_type
+	37, // [37:37] is the sub-list for extension type_name
+	37, // [37:37] is the sub-list for extension extendee
+	0,  // [0:37] is the sub-list for field type_name
+}
+
+func init() { file_internal_cluster_pb_replication_proto_init() }
+func file_internal_cluster_pb_replication_proto_init() {
+	if File_internal_cluster_pb_replication_proto != nil {
+		return
+	}
+	file_internal_cluster_pb_replication_proto_msgTypes[2].OneofWrappers = []any{
+		(*MutateRequest_Mutation)(nil),
+		(*MutateRequest_Data)(nil),
+	}
+	file_internal_cluster_pb_replication_proto_msgTypes[4].OneofWrappers = []any{
+		(*Mutation_CreateBucket)(nil),
+		(*Mutation_DeleteBucket)(nil),
+		(*Mutation_SetReplicationPaused)(nil),
+		(*Mutation_SetBucketTrash)(nil),
+		(*Mutation_SetBucketCopies)(nil),
+		(*Mutation_SetFederation)(nil),
+		(*Mutation_SetFederationCursor)(nil),
+		(*Mutation_SetBucketEncryption)(nil),
+		(*Mutation_PutObject)(nil),
+		(*Mutation_DeleteObject)(nil),
+		(*Mutation_PutRemoteObject)(nil),
+		(*Mutation_RestoreTrashed)(nil),
+		(*Mutation_RestoreObject)(nil),
+		(*Mutation_SetObjectExpiry)(nil),
+		(*Mutation_PutAccess)(nil),
+		(*Mutation_DeleteAccess)(nil),
+		(*Mutation_PutDomain)(nil),
+		(*Mutation_DeleteDomain)(nil),
+		(*Mutation_Promote)(nil),
+		(*Mutation_SetBucketConsistency)(nil),
+		(*Mutation_RenameBucket)(nil),
+		(*Mutation_SetBucketConfig)(nil),
+		(*Mutation_DeleteObjectVersion)(nil),
+	}
+	file_internal_cluster_pb_replication_proto_msgTypes[35].OneofWrappers = []any{
+		(*GetObjectResponse_Header)(nil),
+		(*GetObjectResponse_Data)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_cluster_pb_replication_proto_rawDesc), len(file_internal_cluster_pb_replication_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   53,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_internal_cluster_pb_replication_proto_goTypes,
+		DependencyIndexes: file_internal_cluster_pb_replication_proto_depIdxs,
+		MessageInfos:      file_internal_cluster_pb_replication_proto_msgTypes,
+	}.Build()
+	File_internal_cluster_pb_replication_proto = out.File
+	file_internal_cluster_pb_replication_proto_goTypes = nil
+	file_internal_cluster_pb_replication_proto_depIdxs = nil
+}
@@ -0,0 +1,497 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: internal/cluster/pb/replication.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Replication_Health_FullMethodName           = "/entity.cluster.v1.Replication/Health"
+	Replication_Mutate_FullMethodName           = "/entity.cluster.v1.Replication/Mutate"
+	Replication_Commit_FullMethodName           = "/entity.cluster.v1.Replication/Commit"
+	Replication_Abort_FullMethodName            = "/entity.cluster.v1.Replication/Abort"
+	Replication_GetObject_FullMethodName        = "/entity.cluster.v1.Replication/GetObject"
+	Replication_GetChunkMap_FullMethodName      = "/entity.cluster.v1.Replication/GetChunkMap"
+	Replication_GetChunk_FullMethodName         = "/entity.cluster.v1.Replication/GetChunk"
+	Replication_GetManifest_FullMethodName      = "/entity.cluster.v1.Replication/GetManifest"
+	Replication_GetManifestRange_FullMethodName = "/entity.cluster.v1.Replication/GetManifestRange"
+	Replication_GetSnapshot_FullMethodName      = "/entity.cluster.v1.Replication/GetSnapshot"
+)
+
+// ReplicationClient is the client API for Replication service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Replication is served by every replica on its admin port, over the peer
+// mTLS. Fields can be added to its messages without breaking older peers;
+// removing a field or changing what it means needs a v2 service.
+type ReplicationClient interface {
+	// Health reports the state of a replica to a peer probing it.
+	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+	// Mutate applies a replicated change. The first message carries the
+	// mutation; an object write is followed by messages carrying its body.
+	Mutate(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[MutateRequest, MutateResponse], error)
+	// Commit asks the leader to commit an object whose body is staged on the
+	// caller, and returns the sequence number the leader assigned.
+	Commit(ctx context.Context, in *CommitRequest, opts ...grpc.CallOption) (*CommitResponse, error)
+	// Abort asks the leader to take back a commit whose body the caller
+	// failed to keep.
+	Abort(ctx context.Context, in *AbortRequest, opts ...grpc.CallOption) (*AbortResponse, error)
+	// GetObject streams the header and then the body of a committed object.
+	GetObject(ctx context.Context, in *GetObjectRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GetObjectResponse], error)
+	// GetChunkMap returns how the body of an object is stored in chunks.
+	GetChunkMap(ctx context.Context, in *GetChunkMapRequest, opts ...grpc.CallOption) (*ChunkMap, error)
+	// GetChunk streams one stored chunk of a body for a delta fetch.
+	GetChunk(ctx context.Context, in *GetChunkRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Chunk], error)
+	// GetManifest returns the digests anti-entropy compares.
+	GetManifest(ctx context.Context, in *GetManifestRequest, opts ...grpc.CallOption) (*Manifest, error)
+	// GetManifestRange returns the objects in one range of a bucket.
+	GetManifestRange(ctx context.Context, in *GetManifestRangeRequest, opts ...grpc.CallOption) (*ManifestRange, error)
+	// GetSnapshot returns the metadata an empty replica copies to bootstrap.
+	GetSnapshot(ctx context.Context, in *GetSnapshotRequest, opts ...grpc.CallOption) (*Snapshot, error)
+}
+
+type replicationClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewReplicationClient(cc grpc.ClientConnInterface) ReplicationClient {
+	return &replicationClient{cc}
+}
+
+func (c *replicationClient) Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HealthResponse)
+	err := c.cc.Invoke(ctx, Replication_Health_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicationClient) Mutate(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[MutateRequest, MutateResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Replication_ServiceDesc.Streams[0], Replication_Mutate_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[MutateRequest, MutateResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Replication_MutateClient = grpc.ClientStreamingClient[MutateRequest, MutateResponse]
+
+func (c *replicationClient) Commit(ctx context.Context, in *CommitRequest, opts ...grpc.CallOption) (*CommitResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommitResponse)
+	err := c.cc.Invoke(ctx, Replication_Commit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicationClient) Abort(ctx context.Context, in *AbortRequest, opts ...grpc.CallOption) (*AbortResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AbortResponse)
+	err := c.cc.Invoke(ctx, Replication_Abort_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicationClient) GetObject(ctx context.Context, in *GetObjectRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GetObjectResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Replication_ServiceDesc.Streams[1], Replication_GetObject_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetObjectRequest, GetObjectResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Replication_GetObjectClient = grpc.ServerStreamingClient[GetObjectResponse]
+
+func (c *replicationClient) GetChunkMap(ctx context.Context, in *GetChunkMapRequest, opts ...grpc.CallOption) (*ChunkMap, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChunkMap)
+	err := c.cc.Invoke(ctx, Replication_GetChunkMap_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicationClient) GetChunk(ctx context.Context, in *GetChunkRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Chunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Replication_ServiceDesc.Streams[2], Replication_GetChunk_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetChunkRequest, Chunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Replication_GetChunkClient = grpc.ServerStreamingClient[Chunk]
+
+func (c *replicationClient) GetManifest(ctx context.Context, in *GetManifestRequest, opts ...grpc.CallOption) (*Manifest, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Manifest)
+	err := c.cc.Invoke(ctx, Replication_GetManifest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicationClient) GetManifestRange(ctx context.Context, in *GetManifestRangeRequest, opts ...grpc.CallOption) (*ManifestRange, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ManifestRange)
+	err := c.cc.Invoke(ctx, Replication_GetManifestRange_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicationClient) GetSnapshot(ctx context.Context, in *GetSnapshotRequest, opts ...grpc.CallOption) (*Snapshot, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Snapshot)
+	err := c.cc.Invoke(ctx, Replication_GetSnapshot_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReplicationServer is the server API for Replication service.
+// All implementations must embed UnimplementedReplicationServer
+// for forward compatibility.
+//
+// Replication is served by every replica on its admin port, over the peer
+// mTLS. Fields can be added to its messages without breaking older peers;
+// removing a field or changing what it means needs a v2 service.
+type ReplicationServer interface {
+	// Health reports the state of a replica to a peer probing it.
+	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+	// Mutate applies a replicated change. The first message carries the
+	// mutation; an object write is followed by messages carrying its body.
+	Mutate(grpc.ClientStreamingServer[MutateRequest, MutateResponse]) error
+	// Commit asks the leader to commit an object whose body is staged on the
+	// caller, and returns the sequence number the leader assigned.
+	Commit(context.Context, *CommitRequest) (*CommitResponse, error)
+	// Abort asks the leader to take back a commit whose body the caller
+	// failed to keep.
+	Abort(context.Context, *AbortRequest) (*AbortResponse, error)
+	// GetObject streams the header and then the body of a committed object.
+	GetObject(*GetObjectRequest, grpc.ServerStreamingServer[GetObjectResponse]) error
+	// GetChunkMap returns how the body of an object is stored in chunks.
+	GetChunkMap(context.Context, *GetChunkMapRequest) (*ChunkMap, error)
+	// GetChunk streams one stored chunk of a body for a delta fetch.
+	GetChunk(*GetChunkRequest, grpc.ServerStreamingServer[Chunk]) error
+	// GetManifest returns the digests anti-entropy compares.
+	GetManifest(context.Context, *GetManifestRequest) (*Manifest, error)
+	// GetManifestRange returns the objects in one range of a bucket.
+	GetManifestRange(context.Context, *GetManifestRangeRequest) (*ManifestRange, error)
+	// GetSnapshot returns the metadata an empty replica copies to bootstrap.
+	GetSnapshot(context.Context, *GetSnapshotRequest) (*Snapshot, error)
+	mustEmbedUnimplementedReplicationServer()
+}
+
+// UnimplementedReplicationServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedReplicationServer struct{}
+
+func (UnimplementedReplicationServer) Health(context.Context, *HealthRequest) (*HealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
+func (UnimplementedReplicationServer) Mutate(grpc.ClientStreamingServer[MutateRequest, MutateResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Mutate not implemented")
+}
+func (UnimplementedReplicationServer) Commit(context.Context, *CommitRequest) (*CommitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Commit not implemented")
+}
+func (UnimplementedReplicationServer) Abort(context.Context, *AbortRequest) (*AbortResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Abort not implemented")
+}
+func (UnimplementedReplicationServer) GetObject(*GetObjectRequest, grpc.ServerStreamingServer[GetObjectResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method GetObject not implemented")
+}
+func (UnimplementedReplicationServer) GetChunkMap(context.Context, *GetChunkMapRequest) (*ChunkMap, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetChunkMap not implemented")
+}
+func (UnimplementedReplicationServer) GetChunk(*GetChunkRequest, grpc.ServerStreamingServer[Chunk]) error {
+	return status.Errorf(codes.Unimplemented, "method GetChunk not implemented")
+}
+func (UnimplementedReplicationServer) GetManifest(context.Context, *GetManifestRequest) (*Manifest, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetManifest not implemented")
+}
+func (UnimplementedReplicationServer) GetManifestRange(context.Context, *GetManifestRangeRequest) (*ManifestRange, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetManifestRange not implemented")
+}
+func (UnimplementedReplicationServer) GetSnapshot(context.Context, *GetSnapshotRequest) (*Snapshot, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSnapshot not implemented")
+}
+func (UnimplementedReplicationServer) mustEmbedUnimplementedReplicationServer() {}
+func (UnimplementedReplicationServer) testEmbeddedByValue()                     {}
+
+// UnsafeReplicationServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ReplicationServer will
+// result in compilation errors.
+type UnsafeReplicationServer interface {
+	mustEmbedUnimplementedReplicationServer()
+}
+
+func RegisterReplicationServer(s grpc.ServiceRegistrar, srv ReplicationServer) {
+	// If the following call pancis, it indicates UnimplementedReplicationServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Replication_ServiceDesc, srv)
+}
+
+func _Replication_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Replication_Health_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).Health(ctx, req.(*HealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replication_Mutate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ReplicationServer).Mutate(&grpc.GenericServerStream[MutateRequest, MutateResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Replication_MutateServer = grpc.ClientStreamingServer[MutateRequest, MutateResponse]
+
+func _Replication_Commit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).Commit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Replication_Commit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).Commit(ctx, req.(*CommitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replication_Abort_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AbortRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).Abort(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Replication_Abort_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).Abort(ctx, req.(*AbortRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replication_GetObject_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetObjectRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ReplicationServer).GetObject(m, &grpc.GenericServerStream[GetObjectRequest, GetObjectResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Replication_GetObjectServer = grpc.ServerStreamingServer[GetObjectResponse]
+
+func _Replication_GetChunkMap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetChunkMapRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).GetChunkMap(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Replication_GetChunkMap_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).GetChunkMap(ctx, req.(*GetChunkMapRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replication_GetChunk_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetChunkRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ReplicationServer).GetChunk(m, &grpc.GenericServerStream[GetChunkRequest, Chunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Replication_GetChunkServer = grpc.ServerStreamingServer[Chunk]
+
+func _Replication_GetManifest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetManifestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).GetManifest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Replication_GetManifest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).GetManifest(ctx, req.(*GetManifestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replication_GetManifestRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetManifestRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).GetManifestRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Replication_GetManifestRange_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).GetManifestRange(ctx, req.(*GetManifestRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replication_GetSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).GetSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Replication_GetSnapshot_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).GetSnapshot(ctx, req.(*GetSnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Replication_ServiceDesc is the grpc.ServiceDesc for Replication service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Replication_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "entity.cluster.v1.Replication",
+	HandlerType: (*ReplicationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Health",
+			Handler:    _Replication_Health_Handler,
+		},
+		{
+			MethodName: "Commit",
+			Handler:    _Replication_Commit_Handler,
+		},
+		{
+			MethodName: "Abort",
+			Handler:    _Replication_Abort_Handler,
+		},
+		{
+			MethodName: "GetChunkMap",
+			Handler:    _Replication_GetChunkMap_Handler,
+		},
+		{
+			MethodName: "GetManifest",
+			Handler:    _Replication_GetManifest_Handler,
+		},
+		{
+			MethodName: "GetManifestRange",
+			Handler:    _Replication_GetManifestRange_Handler,
+		},
+		{
+			MethodName: "GetSnapshot",
+			Handler:    _Replication_GetSnapshot_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Mutate",
+			Handler:       _Replication_Mutate_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetObject",
+			Handler:       _Replication_GetObject_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetChunk",
+			Handler:       _Replication_GetChunk_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "internal/cluster/pb/replication.proto",
+}
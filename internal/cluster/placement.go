@@ -0,0 +1,164 @@
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// In partitioned mode the body of an object is kept by Copies of the
+// replicas, picked by consistent hashing of bucket/key, instead of by every
+// replica. The metadata is still replicated everywhere, so listings and
+// HEAD work on any pod; the other pods record the object as held elsewhere
+// and forward reads to its holders. Each replica has placementVnodes points
+// on the ring, so changing the replica count only moves the objects whose
+// owners changed, and new owners pull those bodies in the background.
+// A bucket can set its own replication factor, which replaces Copies for
+// its objects; a bucket with one copy per replica is not partitioned even
+// if the cluster is. With zones known, the owners are spread over as many
+// zones as there are (see zones.go).
+
+const placementVnodes = 128
+
+type ringPoint struct {
+	hash    uint64
+	ordinal int
+}
+
+func ringHash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func newRing(ordinals []int) []ringPoint {
+	points := make([]ringPoint, 0, len(ordinals)*placementVnodes)
+	for _, i := range ordinals {
+		for v := 0; v < placementVnodes; v++ {
+			points = append(points, ringPoint{hash: ringHash(strconv.Itoa(i) + "#" + strconv.Itoa(v)), ordinal: i})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+	return points
+}
+
+// UseBucketCopies sets the lookup of per-bucket replication factors. A
+// bucket for which it returns zero keeps Copies.
+func (c *Cluster) UseBucketCopies(f func(bucket string) int) { c.bucketCopies = f }
+
+// copies returns how many replicas keep the bodies of bucket's objects, or
+// zero for every replica.
+func (c *Cluster) copies(bucket string) int {
+	if c.bucketCopies != nil {
+		if n := c.bucketCopies(bucket); n > 0 {
+			return n
+		}
+	}
+	return c.cfg.Copies
+}
+
+// Partitioned reports whether the bodies of bucket's objects are kept by
+// only some replicas.
+func (c *Cluster) Partitioned(bucket string) bool {
+	n := c.copies(bucket)
+	return c.Enabled() && n > 0 && n < c.Replicas()
+}
+
+// Owners returns the replicas that keep the body of bucket/key, in ring
+// order. Without partitioning every replica is an owner.
+func (c *Cluster) Owners(bucket, key string) []int {
+	members := c.ordinals()
+	c.mu.Lock()
+	ring := c.ring
+	c.mu.Unlock()
+	return c.ownersOn(ring, members, bucket, key)
+}
+
+// ownersOn returns the owners of bucket/key among members, placed on ring.
+func (c *Cluster) ownersOn(ring []ringPoint, members []int, bucket, key string) []int {
+	n := c.copies(bucket)
+	if n <= 0 || n >= len(members) {
+		return members
+	}
+	h := ringHash(bucket + "/" + key)
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+	out := make([]int, 0, n)
+	seen := map[int]bool{}
+	// The first walk takes one member per zone, in ring order; members of
+	// unknown zone count as zones of their own. The second fills the rest.
+	zones := c.zoneMap()
+	used := map[string]bool{}
+	for pass := 0; pass < 2; pass++ {
+		if pass == 0 && len(zones) == 0 {
+			continue
+		}
+		for i := 0; len(out) < n && i < len(ring); i++ {
+			p := ring[(start+i)%len(ring)]
+			if seen[p.ordinal] {
+				continue
+			}
+			if z := zones[p.ordinal]; pass == 0 && z != "" {
+				if used[z] {
+					continue
+				}
+				used[z] = true
+			}
+			seen[p.ordinal] = true
+			out = append(out, p.ordinal)
+		}
+	}
+	return out
+}
+
+// Owns reports whether this replica keeps the body of bucket/key.
+func (c *Cluster) Owns(bucket, key string) bool {
+	for _, o := range c.Owners(bucket, key) {
+		if o == c.ordinal {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyToOwner forwards an upload to the first healthy owner of bucket/key.
+func (c *Cluster) ProxyToOwner(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	for _, o := range c.Owners(bucket, key) {
+		if o != c.ordinal && c.up(r.Context(), o) {
+			return c.ProxyToPeer(w, r, o)
+		}
+	}
+	return fmt.Errorf("no owner of %s/%s is available", bucket, key)
+}
+
+// ProxyToHolder forwards a read of an object whose body is not here to
+// origin, or failing that to another owner. Reads carry no body, so a peer
+// that cannot be reached is simply skipped.
+func (c *Cluster) ProxyToHolder(w http.ResponseWriter, r *http.Request, bucket, key string, origin int) error {
+	lastErr := fmt.Errorf("no holder of %s/%s is available", bucket, key)
+	tried := map[int]bool{c.ordinal: true}
+	for _, o := range append([]int{origin}, c.Owners(bucket, key)...) {
+		if tried[o] {
+			continue
+		}
+		tried[o] = true
+		if lastErr = c.ProxyToPeer(w, r, o); lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+// FetchObject pulls the body of a pending object right away instead of
+// waiting for the fetcher, for requests that need it here.
+func (c *Cluster) FetchObject(ctx context.Context, store *objectd.Store, bucket, key string) error {
+	p, ok := store.PendingFetchOf(ctx, bucket, key)
+	if !ok {
+		return nil
+	}
+	return c.fetch(ctx, store, p)
+}
@@ -0,0 +1,342 @@
+package cluster
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// In asynchronous mode Replicate does not wait for the peers. A mutation is
+// appended to an on-disk queue per peer and acknowledged once it is synced
+// there; a delivery loop per peer sends the queue in order, retrying with
+// backoff while the peer is unreachable or failing. Writes are then only as
+// durable as the disk of the replica that took them until they are
+// delivered. Each queue is a log of records, a big-endian header length, a
+// JSON header and the body, plus a file holding the offset of the first
+// record not yet delivered. A drained log is truncated.
+
+const (
+	queueMinBackoff = time.Second
+	queueMaxBackoff = time.Minute
+)
+
+type queueHeader struct {
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Size     int64             `json:"size"`
+	QueuedAt time.Time         `json:"queuedAt"`
+}
+
+// peerQueue is the replication queue of one peer.
+type peerQueue struct {
+	path   string
+	notify chan struct{}
+
+	mu      sync.Mutex
+	f       *os.File
+	offset  int64
+	end     int64
+	count   int
+	bytes   int64
+	lastErr string
+}
+
+// OpenReplicationQueue switches the cluster to asynchronous replication,
+// with the queues kept under dir. It must be called before the cluster
+// replicates anything.
+func (c *Cluster) OpenReplicationQueue(dir string) error {
+	if c.Gossip() {
+		return errors.New("asynchronous replication needs a fixed membership and cannot be combined with gossip")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	queues := map[int]*peerQueue{}
+	for i := 0; i < c.cfg.Replicas; i++ {
+		if i == c.ordinal {
+			continue
+		}
+		q, err := openPeerQueue(filepath.Join(dir, "peer-"+strconv.Itoa(i)+".log"))
+		if err != nil {
+			return err
+		}
+		if q.count > 0 {
+			log.Printf("replication queue for peer %d holds %d mutations", i, q.count)
+		}
+		queues[i] = q
+	}
+	c.queues = queues
+	return nil
+}
+
+// Async reports whether replication is asynchronous.
+func (c *Cluster) Async() bool { return c.queues != nil }
+
+func openPeerQueue(path string) (*peerQueue, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	q := &peerQueue{path: path, f: f, notify: make(chan struct{}, 1)}
+	if data, err := os.ReadFile(path + ".offset"); err == nil {
+		q.offset, _ = strconv.ParseInt(string(data), 10, 64)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if q.offset > st.Size() {
+		q.offset = st.Size()
+	}
+	// Count what is left and cut off a record torn by a crash.
+	q.end = q.offset
+	for {
+		hdr, next, err := q.readHeader(q.end)
+		if err != nil {
+			break
+		}
+		q.count++
+		q.bytes += hdr.Size
+		q.end = next
+	}
+	if q.end < st.Size() {
+		log.Printf("replication queue %s: dropping %d torn bytes", path, st.Size()-q.end)
+		if err := f.Truncate(q.end); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// readHeader reads the header of the record at off and returns it with the
+// offset of the next record.
+func (q *peerQueue) readHeader(off int64) (queueHeader, int64, error) {
+	var hdr queueHeader
+	var n [4]byte
+	if _, err := q.f.ReadAt(n[:], off); err != nil {
+		return hdr, 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(n[:]))
+	buf := make([]byte, size)
+	if _, err := q.f.ReadAt(buf, off+4); err != nil {
+		return hdr, 0, err
+	}
+	if err := json.Unmarshal(buf, &hdr); err != nil {
+		return hdr, 0, err
+	}
+	next := off + 4 + size + hdr.Size
+	st, err := q.f.Stat()
+	if err != nil {
+		return hdr, 0, err
+	}
+	if next > st.Size() {
+		return hdr, 0, io.ErrUnexpectedEOF
+	}
+	return hdr, next, nil
+}
+
+// append writes a mutation to the end of the log, streaming its payload.
+func (q *peerQueue) append(h hint) error {
+	size := h.payload.Size
+	hdr, err := json.Marshal(queueHeader{Method: h.method, Path: h.path, Headers: h.headers, Size: size, QueuedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	rec := make([]byte, 4, 4+len(hdr))
+	binary.BigEndian.PutUint32(rec, uint32(len(hdr)))
+	rec = append(rec, hdr...)
+	body, err := h.payload.reader()
+	if err != nil {
+		return err
+	}
+	if rc, ok := body.(io.Closer); ok {
+		defer rc.Close()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.f.WriteAt(rec, q.end); err != nil {
+		return err
+	}
+	if body != nil {
+		n, err := io.CopyN(io.NewOffsetWriter(q.f, q.end+int64(len(rec))), body, size)
+		if err != nil {
+			return fmt.Errorf("queue %d of %d payload bytes: %w", n, size, err)
+		}
+	}
+	if err := q.f.Sync(); err != nil {
+		return err
+	}
+	q.end += int64(len(rec)) + size
+	q.count++
+	q.bytes += size
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// peek returns the oldest undelivered mutation and the offset after it. Its
+// payload is streamed from the log, which stays in place until advance.
+func (q *peerQueue) peek() (hint, int64, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.offset >= q.end {
+		return hint{}, 0, false, nil
+	}
+	hdr, next, err := q.readHeader(q.offset)
+	if err != nil {
+		return hint{}, 0, false, err
+	}
+	h := hint{method: hdr.Method, path: hdr.Path, headers: hdr.Headers}
+	if hdr.Size > 0 {
+		section := io.NewSectionReader(q.f, next-hdr.Size, hdr.Size)
+		h.payload = Payload{Size: hdr.Size, Open: func() (io.ReadCloser, error) { return io.NopCloser(section), nil }}
+	}
+	return h, next, true, nil
+}
+
+// advance marks the mutations before next as delivered.
+func (q *peerQueue) advance(next int64, size int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.offset = next
+	q.count--
+	q.bytes -= size
+	q.lastErr = ""
+	if q.offset == q.end {
+		if err := q.f.Truncate(0); err != nil {
+			return err
+		}
+		q.offset, q.end = 0, 0
+	}
+	tmp := q.path + ".offset.tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(q.offset, 10)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path+".offset")
+}
+
+func (q *peerQueue) setError(err error) {
+	q.mu.Lock()
+	q.lastErr = err.Error()
+	q.mu.Unlock()
+}
+
+// status fills in the queue fields of a peer's status.
+func (q *peerQueue) status(p *PeerStatus) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	p.Queued, p.QueuedBytes, p.QueueError = q.count, q.bytes, q.lastErr
+	if q.offset < q.end {
+		if hdr, _, err := q.readHeader(q.offset); err == nil {
+			p.OldestQueuedAt = hdr.QueuedAt
+		}
+	}
+}
+
+// enqueue appends a mutation to the queue of every peer. A payload that was
+// superseded before it was queued is not needed.
+func (c *Cluster) enqueue(h hint) error {
+	for i, q := range c.queues {
+		err := q.append(h)
+		if errors.Is(err, ErrSuperseded) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("queue replication to peer %d: %w", i, err)
+		}
+		c.queueMetrics(i, q)
+	}
+	return nil
+}
+
+// RunAsyncReplication delivers the replication queues until ctx is
+// cancelled.
+func (c *Cluster) RunAsyncReplication(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i, q := range c.queues {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.deliverQueue(ctx, i, q)
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *Cluster) deliverQueue(ctx context.Context, ordinal int, q *peerQueue) {
+	backoff := time.Duration(0)
+	for {
+		h, next, ok, err := q.peek()
+		if err == nil && !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.notify:
+			}
+			continue
+		}
+		if err == nil {
+			err = c.deliverQueued(ctx, ordinal, q, h, next)
+		}
+		if err == nil {
+			backoff = 0
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		q.setError(err)
+		backoff = min(max(2*backoff, queueMinBackoff), queueMaxBackoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// deliverQueued sends the oldest queued mutation. A mutation the peer
+// rejects outright is dropped, since sending it again would not change the
+// answer.
+func (c *Cluster) deliverQueued(ctx context.Context, ordinal int, q *peerQueue, h hint, next int64) error {
+	status, err := c.send(ctx, ordinal, h)
+	if err != nil {
+		return err
+	}
+	if status >= 500 {
+		return fmt.Errorf("%s %s: status %d", h.method, h.path, status)
+	}
+	if status < 200 || status >= 300 {
+		log.Printf("peer %d rejected queued %s %s: status %d", ordinal, h.method, h.path, status)
+	}
+	if err := q.advance(next, h.payload.Size); err != nil {
+		return err
+	}
+	c.queueMetrics(ordinal, q)
+	return nil
+}
+
+func (c *Cluster) queueMetrics(ordinal int, q *peerQueue) {
+	q.mu.Lock()
+	count, bytes := q.count, q.bytes
+	q.mu.Unlock()
+	labels := map[string]string{"peer": strconv.Itoa(ordinal)}
+	metrics.SetGauge("entity_cluster_replication_queue", labels, float64(count))
+	metrics.SetGauge("entity_cluster_replication_queue_bytes", labels, float64(bytes))
+}
@@ -0,0 +1,112 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// Each replica probes its peers every interval and counts how many answer.
+// While fewer replicas than a write needs can be reached, the cluster is
+// degraded: writes are refused before anything is applied locally, and
+// reads are served as usual. In asynchronous mode writes never wait for
+// peers, so the cluster is never degraded.
+
+const (
+	DefaultQuorumCheckInterval = 2 * time.Second
+
+	DegradedHeader = "X-ENTITY-Degraded"
+)
+
+// ErrNoQuorum is returned for writes refused while too few replicas are
+// reachable.
+var ErrNoQuorum = errors.New("too few replicas are reachable to accept writes; the cluster is read-only until they return")
+
+// RunQuorumMonitor probes the peers every interval until ctx is cancelled.
+func (c *Cluster) RunQuorumMonitor(ctx context.Context, interval time.Duration) {
+	if !c.Enabled() || c.Async() {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		c.checkQuorum(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Cluster) checkQuorum(parent context.Context) {
+	ctx, cancel := context.WithTimeout(parent, c.cfg.PeerTimeout)
+	defer cancel()
+	ordinals := c.ordinals()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	up := 1
+	for _, i := range ordinals {
+		if i == c.ordinal {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if c.health(ctx, i) {
+				mu.Lock()
+				up++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if parent.Err() != nil {
+		return
+	}
+	required := c.required(context.Background(), len(ordinals))
+	c.mu.Lock()
+	was := c.degraded
+	c.reachable, c.quorumChecked = up, true
+	c.degraded = up < required
+	degraded := c.degraded
+	c.mu.Unlock()
+	if degraded != was {
+		if degraded {
+			log.Printf("cluster degraded: %d of %d replicas reachable, %d needed for writes; refusing writes", up, len(ordinals), required)
+		} else {
+			log.Printf("cluster recovered: %d of %d replicas reachable; accepting writes", up, len(ordinals))
+		}
+	}
+	v := 0.0
+	if degraded {
+		v = 1
+	}
+	metrics.SetGauge("entity_cluster_degraded", nil, v)
+	metrics.SetGauge("entity_cluster_reachable_replicas", nil, float64(up))
+}
+
+// Degraded reports whether too few replicas were reachable at the last
+// check to write at the configured consistency level.
+func (c *Cluster) Degraded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.degraded
+}
+
+// Writable reports whether enough replicas were reachable at the last check
+// to write at the consistency level of ctx. It is true until the first
+// check has run.
+func (c *Cluster) Writable(ctx context.Context) bool {
+	if !c.Enabled() || c.consistency(ctx) == ConsistencyAsync {
+		return true
+	}
+	c.mu.Lock()
+	up, checked := c.reachable, c.quorumChecked
+	c.mu.Unlock()
+	return !checked || up >= c.required(ctx, len(c.ordinals()))
+}
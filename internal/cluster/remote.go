@@ -0,0 +1,257 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/cluster/pb"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+const (
+	OriginHeader = "X-ENTITY-Origin"
+	SizeHeader   = "X-ENTITY-Size"
+	ETagHeader   = "X-ENTITY-ETag"
+	// ContentTypeHeader carries the client's Content-Type, since the
+	// replication request's own Content-Type describes the transfer.
+	ContentTypeHeader = "X-ENTITY-Content-Type"
+	// ExpiresHeader carries the expiry time of an object.
+	ExpiresHeader = "X-ENTITY-Expires"
+)
+
+// CommitRemote asks the leader to commit the metadata of a body this node
+// has staged locally. The leader assigns the sequence number and replicates
+// the metadata to a quorum; peers pull the body afterwards.
+func (c *Cluster) CommitRemote(ctx context.Context, bucket, key string, blob objectd.Blob, opts objectd.PutOptions) (uint64, error) {
+	leader, admin := c.Leader(ctx)
+	commit := &pb.CommitRequest{
+		Bucket: bucket, Key: key, Origin: int32(c.ordinal), Size: blob.Size, Etag: blob.ETag,
+		Options: &pb.ObjectOptions{StorageClass: opts.StorageClass, ContentType: opts.ContentType, ExpiresAtUnixNano: unixNano(opts.ExpiresAt)},
+	}
+	if l, ok := ctx.Value(consistencyKey{}).(Consistency); ok {
+		commit.Consistency = string(l)
+	}
+	commit.Epoch = c.Epoch()
+	resp, err := call(c, ctx, leader, func(ctx context.Context, client pb.ReplicationClient) (*pb.CommitResponse, error) {
+		return client.Commit(ctx, commit)
+	})
+	if err == nil {
+		return resp.Seq, nil
+	}
+	if !errors.Is(err, errNoRPC) {
+		return 0, fmt.Errorf("leader commit failed: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, admin+"/_cluster/commit/objects/"+bucket+"/"+key, nil)
+	if err != nil {
+		return 0, err
+	}
+	c.setInternalHeaders(req)
+	req.Header.Set(OriginHeader, strconv.Itoa(c.ordinal))
+	req.Header.Set(SizeHeader, strconv.FormatInt(blob.Size, 10))
+	req.Header.Set(ETagHeader, blob.ETag)
+	if l, ok := ctx.Value(consistencyKey{}).(Consistency); ok {
+		req.Header.Set(ConsistencyHeader, string(l))
+	}
+	if opts.StorageClass != "" {
+		req.Header.Set("X-Amz-Storage-Class", opts.StorageClass)
+	}
+	if opts.ContentType != "" {
+		req.Header.Set(ContentTypeHeader, opts.ContentType)
+	}
+	if !opts.ExpiresAt.IsZero() {
+		req.Header.Set(ExpiresHeader, opts.ExpiresAt.UTC().Format(time.RFC3339Nano))
+	}
+	hresp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer hresp.Body.Close()
+	if hresp.StatusCode < 200 || hresp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(hresp.Body, 1024))
+		return 0, fmt.Errorf("leader commit failed: %s: %s", hresp.Status, strings.TrimSpace(string(msg)))
+	}
+	seq, ok := requestSeqHeader(hresp.Header)
+	if !ok {
+		return 0, fmt.Errorf("leader commit returned no sequence number")
+	}
+	return seq, nil
+}
+
+// AbortRemote asks the leader to take back a commit made by CommitRemote
+// under seq, after this replica failed to keep the body.
+func (c *Cluster) AbortRemote(ctx context.Context, bucket, key string, seq uint64) error {
+	leader, admin := c.Leader(ctx)
+	abort := &pb.AbortRequest{Bucket: bucket, Key: key, Origin: int32(c.ordinal), Seq: seq, Epoch: c.Epoch()}
+	_, err := call(c, ctx, leader, func(ctx context.Context, client pb.ReplicationClient) (*pb.AbortResponse, error) {
+		return client.Abort(ctx, abort)
+	})
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, errNoRPC) {
+		return fmt.Errorf("leader abort failed: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, admin+"/_cluster/abort/objects/"+bucket+"/"+key, nil)
+	if err != nil {
+		return err
+	}
+	c.setInternalHeaders(req)
+	req.Header.Set(OriginHeader, strconv.Itoa(c.ordinal))
+	req.Header.Set(SeqHeader, strconv.FormatUint(seq, 10))
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("leader abort failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// RemoteHeaders returns the headers that replicate the metadata of an object
+// whose body is held by its origin peer.
+func RemoteHeaders(m objectd.ObjectMeta) map[string]string {
+	headers := map[string]string{
+		SeqHeader:    strconv.FormatUint(m.Seq, 10),
+		OriginHeader: strconv.Itoa(m.Origin),
+		SizeHeader:   strconv.FormatInt(m.Size, 10),
+		ETagHeader:   m.ETag,
+	}
+	if m.IsArchived() {
+		headers["X-Amz-Storage-Class"] = m.StorageClass
+	}
+	if m.ContentType != "" {
+		headers[ContentTypeHeader] = m.ContentType
+	}
+	if !m.ExpiresAt.IsZero() {
+		headers[ExpiresHeader] = m.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	return headers
+}
+
+// ProxyToPeer forwards a client request to the S3 port of another replica.
+func (c *Cluster) ProxyToPeer(w http.ResponseWriter, r *http.Request, ordinal int) error {
+	base := strings.Replace(c.adminURL(ordinal), fmt.Sprintf(":%d", c.cfg.AdminPort), fmt.Sprintf(":%d", c.cfg.S3Port), 1)
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, base+r.URL.RequestURI(), r.Body)
+	if err != nil {
+		return err
+	}
+	req.Header = r.Header.Clone()
+	req.Host = r.Host
+	resp, err := c.bulkClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	copyHeader(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+	return nil
+}
+
+// RunFetcher pulls the bodies of objects committed by other replicas until
+// ctx is cancelled. The origin is tried first, then every other peer. In
+// partitioned mode only the bodies this replica owns are pulled.
+func (c *Cluster) RunFetcher(ctx context.Context, store *objectd.Store, interval time.Duration) {
+	if !c.Enabled() {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		for _, p := range store.PendingFetches(ctx) {
+			if ctx.Err() != nil {
+				return
+			}
+			if !c.Owns(p.Bucket, p.Key) {
+				continue
+			}
+			if err := c.fetch(ctx, store, p); err != nil {
+				log.Printf("fetch %s/%s seq=%d: %v", p.Bucket, p.Key, p.Seq, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Cluster) fetch(ctx context.Context, store *objectd.Store, p objectd.PendingFetch) error {
+	order := []int{p.Origin}
+	for _, i := range c.ordinals() {
+		if i != p.Origin && i != c.ordinal {
+			order = append(order, i)
+		}
+	}
+	var lastErr error
+	for _, ordinal := range order {
+		if store.HasFetchBasis(p.Bucket, p.Key) {
+			err := c.fetchDelta(ctx, store, p, ordinal)
+			if err == nil {
+				return nil
+			}
+			log.Printf("delta fetch %s/%s seq=%d from peer %d: %v; fetching it in full", p.Bucket, p.Key, p.Seq, ordinal, err)
+		}
+		seq, body, err := c.peerObject(ctx, ordinal, p.Bucket, p.Key, false)
+		if err != nil {
+			lastErr = fmt.Errorf("peer %d: %w", ordinal, err)
+			continue
+		}
+		if seq != p.Seq {
+			_ = body.Close()
+			lastErr = fmt.Errorf("peer %d: seq %d", ordinal, seq)
+			continue
+		}
+		err = store.CompleteFetch(ctx, p.Bucket, p.Key, p.Seq, c.throttled(ctx, body))
+		_ = body.Close()
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+func (c *Cluster) setInternalHeaders(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+c.token())
+	req.Header.Set("X-ENTITY-Internal-Replication", "true")
+	if epoch := c.Epoch(); epoch > 0 {
+		req.Header.Set(EpochHeader, strconv.FormatUint(epoch, 10))
+	}
+}
+
+func requestSeqHeader(h http.Header) (uint64, bool) {
+	v := h.Get(SeqHeader)
+	if v == "" {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(v, 10, 64)
+	return seq, err == nil
+}
+
+func remoteBlob(header http.Header) (objectd.Blob, int, bool) {
+	origin, err := strconv.Atoi(header.Get(OriginHeader))
+	if err != nil {
+		return objectd.Blob{}, 0, false
+	}
+	size, err := strconv.ParseInt(header.Get(SizeHeader), 10, 64)
+	if err != nil {
+		return objectd.Blob{}, 0, false
+	}
+	etag := header.Get(ETagHeader)
+	if etag == "" {
+		return objectd.Blob{}, 0, false
+	}
+	return objectd.Blob{Size: size, ETag: etag}, origin, true
+}
@@ -1,104 +1,170 @@
 package cluster
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/mchenetz/entity/internal/cluster/pb"
+	"github.com/mchenetz/entity/internal/metering"
 	"github.com/mchenetz/entity/internal/objectd"
+	"github.com/mchenetz/entity/internal/tokens"
 )
 
 type ReplicationHandler struct {
-	Store *objectd.Store
-	Token string
+	Store   *objectd.Store
+	Tokens  *tokens.Set
+	Cluster *Cluster
+	// Meter serves this replica's usage to the peer building a report.
+	Meter *metering.Meter
+
+	rpc *grpc.Server
 }
 
-func NewReplicationHandler(store *objectd.Store, token string) *ReplicationHandler {
-	return &ReplicationHandler{Store: store, Token: token}
+func NewReplicationHandler(store *objectd.Store, t *tokens.Set) *ReplicationHandler {
+	h := &ReplicationHandler{Store: store, Tokens: t, rpc: grpc.NewServer()}
+	pb.RegisterReplicationServer(h.rpc, &rpcServer{h: h})
+	return h
 }
 
 func (h *ReplicationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Authorization") != "Bearer "+h.Token {
+	if !h.Tokens.Authorized(r, tokens.RoleClusterAdmin) {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	if r.URL.Path == "/_cluster/health" {
+		if h.Cluster != nil && h.Cluster.Bootstrapping() {
+			http.Error(w, "bootstrapping", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set(TimeHeader, time.Now().UTC().Format(time.RFC3339Nano))
+		if h.Store.ReadOnly() {
+			w.Header().Set(ReadOnlyHeader, "true")
+		}
+		// gRPC needs HTTP/2, which the admin port only negotiates over TLS.
+		if r.TLS != nil {
+			w.Header().Set(ProtocolsHeader, ReplicationService)
+		}
+		if h.Cluster != nil && h.Cluster.Degraded() {
+			w.Header().Set(DegradedHeader, "true")
+		}
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 		return
 	}
-	if r.Header.Get("X-ENTITY-Internal-Replication") != "true" {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	rpc := strings.HasPrefix(r.URL.Path, "/"+ReplicationService+"/")
+	// The Health call, like the health endpoint, only needs the token.
+	if r.URL.Path != "/"+ReplicationService+"/Health" {
+		if r.Header.Get("X-ENTITY-Internal-Replication") != "true" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if !hasPeerClientCert(r) {
+			http.Error(w, "mTLS required", http.StatusForbidden)
+			return
+		}
+	}
+	if rpc {
+		h.rpc.ServeHTTP(w, r)
+		return
+	}
+	if !h.checkEpoch(w, r) {
+		return
+	}
+	m, body, err := parseMutation(r.Method, r.URL, r.Header, r.Body)
+	if err == nil {
+		h.serveMutation(w, r, m, body)
 		return
 	}
-	if !hasPeerClientCert(r) {
-		http.Error(w, "mTLS required", http.StatusForbidden)
+	if !errors.Is(err, errNoMutation) {
+		st := status.Convert(err)
+		http.Error(w, st.Message(), httpStatus(st.Code()))
 		return
 	}
 
 	switch {
-	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/_cluster/replicate/buckets/"):
-		name := strings.TrimPrefix(r.URL.Path, "/_cluster/replicate/buckets/")
-		if err := h.Store.CreateBucket(r.Context(), name); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		w.WriteHeader(http.StatusNoContent)
-	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/_cluster/replicate/buckets/"):
-		name := strings.TrimPrefix(r.URL.Path, "/_cluster/replicate/buckets/")
-		if err := h.Store.DeleteBucket(r.Context(), name); err != nil && err != objectd.ErrNotFound {
-			http.Error(w, err.Error(), http.StatusConflict)
-			return
-		}
-		w.WriteHeader(http.StatusNoContent)
-	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_cluster/replicate/objects/"):
-		rest := strings.TrimPrefix(r.URL.Path, "/_cluster/replicate/objects/")
-		parts := strings.SplitN(rest, "/", 2)
-		if len(parts) != 2 {
-			http.Error(w, "invalid path", http.StatusBadRequest)
-			return
-		}
-		if _, err := h.Store.PutObject(r.Context(), parts[0], parts[1], r.Body); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		w.WriteHeader(http.StatusNoContent)
-	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/_cluster/replicate/objects/"):
-		rest := strings.TrimPrefix(r.URL.Path, "/_cluster/replicate/objects/")
-		parts := strings.SplitN(rest, "/", 2)
-		if len(parts) != 2 {
-			http.Error(w, "invalid path", http.StatusBadRequest)
-			return
-		}
-		if err := h.Store.DeleteObject(r.Context(), parts[0], parts[1]); err != nil && err != objectd.ErrNotFound {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/_cluster/commit/objects/"):
+		h.commitRemote(w, r, strings.TrimPrefix(r.URL.Path, "/_cluster/commit/objects/"))
+	case r.Method == http.MethodPost && r.URL.Path == "/_cluster/gossip":
+		if h.Cluster == nil || !h.Cluster.Gossip() {
+			http.Error(w, "gossip is not enabled", http.StatusNotFound)
 			return
 		}
-		w.WriteHeader(http.StatusNoContent)
-	case r.Method == http.MethodPost && r.URL.Path == "/_cluster/replicate/access":
-		var a objectd.AccessKey
-		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		var members []Member
+		if err := json.NewDecoder(r.Body).Decode(&members); err != nil {
 			http.Error(w, "invalid body", http.StatusBadRequest)
 			return
 		}
-		if err := h.Store.PutAccess(r.Context(), a); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.Cluster.MergeMembers(members))
+	case r.Method == http.MethodGet && r.URL.Path == "/_cluster/usage":
+		h.serveUsage(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/_cluster/access/last-used":
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.Store.AccessLastUsed())
+	case r.Method == http.MethodGet && r.URL.Path == "/_cluster/snapshot":
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.Store.Snapshot(r.Context()))
+	case r.Method == http.MethodGet && r.URL.Path == "/_cluster/manifest":
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.Store.Manifest(r.Context()))
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/_cluster/manifest/"):
+		rng, err := strconv.Atoi(r.URL.Query().Get("range"))
+		if err != nil || rng < 0 || rng >= objectd.ManifestRanges {
+			http.Error(w, "invalid range", http.StatusBadRequest)
 			return
 		}
-		w.WriteHeader(http.StatusNoContent)
-	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/_cluster/replicate/access/"):
-		ak := strings.TrimPrefix(r.URL.Path, "/_cluster/replicate/access/")
-		if err := h.Store.DeleteAccess(r.Context(), ak); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		changes, err := h.Store.ManifestRange(r.Context(), strings.TrimPrefix(r.URL.Path, "/_cluster/manifest/"), rng)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		w.WriteHeader(http.StatusNoContent)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(changes)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/_cluster/chunks/"):
+		h.serveChunks(w, r, strings.TrimPrefix(r.URL.Path, "/_cluster/chunks/"))
+	case (r.Method == http.MethodGet || r.Method == http.MethodHead) && strings.HasPrefix(r.URL.Path, "/_cluster/objects/"):
+		h.serveObject(w, r, strings.TrimPrefix(r.URL.Path, "/_cluster/objects/"))
 	default:
 		http.NotFound(w, r)
 	}
 }
 
+// ObjectHeaders returns the headers that carry an object's replicated
+// attributes alongside its payload.
+func ObjectHeaders(m objectd.ObjectMeta) map[string]string {
+	headers := map[string]string{
+		"Content-Type": "application/octet-stream",
+		SeqHeader:      strconv.FormatUint(m.Seq, 10),
+		SizeHeader:     strconv.FormatInt(m.Size, 10),
+		ETagHeader:     m.ETag,
+	}
+	if m.IsArchived() {
+		headers["X-Amz-Storage-Class"] = m.StorageClass
+	}
+	if m.ContentType != "" {
+		headers[ContentTypeHeader] = m.ContentType
+	}
+	if !m.ExpiresAt.IsZero() {
+		headers[ExpiresHeader] = m.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	return headers
+}
+
+func DeleteHeaders(seq uint64) map[string]string {
+	return map[string]string{SeqHeader: strconv.FormatUint(seq, 10)}
+}
+
 func hasPeerClientCert(r *http.Request) bool {
 	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
 		return false
@@ -118,3 +184,113 @@ func hasClientAuthUsage(cert *x509.Certificate) bool {
 	}
 	return false
 }
+
+// commit runs on the leader. It allocates a sequence number for a body
+// staged on a follower and replicates the metadata to a quorum.
+func (h *ReplicationHandler) commit(ctx context.Context, req *pb.CommitRequest) (uint64, error) {
+	if h.Cluster == nil || !h.Cluster.IsLeader(ctx) {
+		return 0, status.Error(codes.FailedPrecondition, "not leader")
+	}
+	if req.Consistency != "" {
+		level, err := ParseConsistency(req.Consistency)
+		if err != nil {
+			return 0, status.Error(codes.InvalidArgument, err.Error())
+		}
+		ctx = WithConsistency(ctx, level)
+	}
+	blob := objectd.Blob{Size: req.Size, ETag: req.Etag}
+	m, _, err := h.Store.RecordRemoteObject(ctx, req.Bucket, req.Key, blob, int(req.Origin), 0, putOptionsFromPB(req.Options))
+	if err != nil {
+		return 0, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := h.Cluster.Replicate(ctx, http.MethodPut, "/_cluster/replicate/refs/"+req.Bucket+"/"+req.Key, RemoteHeaders(m), nil); err != nil {
+		return 0, status.Error(codes.Unavailable, err.Error())
+	}
+	return m.Seq, nil
+}
+
+// commitRemote serves commit over HTTP.
+func (h *ReplicationHandler) commitRemote(w http.ResponseWriter, r *http.Request, rest string) {
+	bucket, key, ok := splitObject(rest)
+	blob, origin, hasBlob := remoteBlob(r.Header)
+	if !ok || !hasBlob {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	seq, err := h.commit(r.Context(), &pb.CommitRequest{
+		Bucket: bucket, Key: key, Origin: int32(origin), Size: blob.Size, Etag: blob.ETag,
+		Options: objectOptions(r.Header), Consistency: r.Header.Get(ConsistencyHeader),
+	})
+	if err != nil {
+		st := status.Convert(err)
+		code := httpStatus(st.Code())
+		if st.Code() == codes.FailedPrecondition {
+			code = http.StatusMisdirectedRequest
+		}
+		http.Error(w, st.Message(), code)
+		return
+	}
+	w.Header().Set(SeqHeader, strconv.FormatUint(seq, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// abort runs on the leader. It deletes an object committed by commit whose
+// origin could not keep the body, unless the key has been written again
+// since, and replicates the delete.
+func (h *ReplicationHandler) abort(ctx context.Context, req *pb.AbortRequest) error {
+	if h.Cluster == nil || !h.Cluster.IsLeader(ctx) {
+		return status.Error(codes.FailedPrecondition, "not leader")
+	}
+	del, ok, err := h.Store.AbortRemoteObject(ctx, req.Bucket, req.Key, int(req.Origin), req.Seq)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if ok {
+		if err := h.Cluster.Replicate(ctx, http.MethodDelete, "/_cluster/replicate/objects/"+req.Bucket+"/"+req.Key, DeleteHeaders(del), nil); err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+	}
+	return nil
+}
+
+// abortRemote serves abort over HTTP.
+func (h *ReplicationHandler) abortRemote(w http.ResponseWriter, r *http.Request, rest string) {
+	bucket, key, ok := splitObject(rest)
+	origin, err := strconv.Atoi(r.Header.Get(OriginHeader))
+	seq, hasSeq := requestSeqHeader(r.Header)
+	if !ok || err != nil || !hasSeq {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := h.abort(r.Context(), &pb.AbortRequest{Bucket: bucket, Key: key, Origin: int32(origin), Seq: seq}); err != nil {
+		st := status.Convert(err)
+		code := httpStatus(st.Code())
+		if st.Code() == codes.FailedPrecondition {
+			code = http.StatusMisdirectedRequest
+		}
+		http.Error(w, st.Message(), code)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveObject hands a committed body to a peer that is pulling it.
+func (h *ReplicationHandler) serveObject(w http.ResponseWriter, r *http.Request, rest string) {
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	m, f, err := h.Store.OpenObject(r.Context(), parts[0], parts[1])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	w.Header().Set(SeqHeader, strconv.FormatUint(m.Seq, 10))
+	w.Header().Set("Content-Length", strconv.FormatInt(m.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = io.Copy(w, f)
+	}
+}
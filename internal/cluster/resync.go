@@ -0,0 +1,121 @@
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// ErrResyncing is returned while a requested resync is still queued or
+// running.
+var ErrResyncing = errors.New("resync already running")
+
+// maxResyncJobs bounds how many finished resyncs are remembered.
+const maxResyncJobs = 20
+
+// States of a resync.
+const (
+	ResyncQueued    = "queued"
+	ResyncRunning   = "running"
+	ResyncSucceeded = "succeeded"
+	ResyncFailed    = "failed"
+)
+
+// ResyncJob is an anti-entropy pass requested through the admin API. It is
+// queued while a scheduled pass is running.
+type ResyncJob struct {
+	ID string `json:"id"`
+	// Bucket limits the pass to one bucket; empty compares every bucket.
+	Bucket      string    `json:"bucket,omitempty"`
+	State       string    `json:"state"`
+	RequestedAt time.Time `json:"requestedAt"`
+	// PeersTotal is how many peers the pass compares with; Peers counts
+	// those done so far.
+	PeersTotal int `json:"peersTotal"`
+	AntiEntropyStatus
+}
+
+// Resync starts an anti-entropy pass against every peer in the background,
+// only for bucket if it is not empty, and returns the queued job.
+func (c *Cluster) Resync(ctx context.Context, store *objectd.Store, bucket string) (ResyncJob, error) {
+	if !c.Enabled() {
+		return ResyncJob{}, fmt.Errorf("clustering is not enabled")
+	}
+	if bucket != "" {
+		if _, err := store.GetBucket(ctx, bucket); err != nil {
+			return ResyncJob{}, err
+		}
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return ResyncJob{}, err
+	}
+	job := &ResyncJob{ID: hex.EncodeToString(id), Bucket: bucket, State: ResyncQueued, RequestedAt: time.Now().UTC(), PeersTotal: len(c.ordinals()) - 1}
+	c.mu.Lock()
+	for _, j := range c.resyncs {
+		if j.State == ResyncQueued || j.State == ResyncRunning {
+			c.mu.Unlock()
+			return ResyncJob{}, fmt.Errorf("%w: %s", ErrResyncing, j.ID)
+		}
+	}
+	c.resyncs = append(c.resyncs, job)
+	if n := len(c.resyncs) - maxResyncJobs; n > 0 {
+		c.resyncs = append([]*ResyncJob(nil), c.resyncs[n:]...)
+	}
+	out := *job
+	c.mu.Unlock()
+	go c.resync(context.WithoutCancel(ctx), store, job)
+	return out, nil
+}
+
+func (c *Cluster) resync(ctx context.Context, store *objectd.Store, job *ResyncJob) {
+	st := c.antiEntropyPass(ctx, store, job.Bucket, func(st AntiEntropyStatus) {
+		c.mu.Lock()
+		job.State, job.AntiEntropyStatus = ResyncRunning, st
+		c.mu.Unlock()
+		// A full pass is as good as a scheduled one.
+		if job.Bucket == "" {
+			c.setAntiEntropy(st)
+		}
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job.State = ResyncSucceeded
+	// Unlike a scheduled pass, a requested one is expected to cover every
+	// peer.
+	if len(st.Unreachable) > 0 && st.LastError == "" {
+		job.LastError = fmt.Sprintf("peers %v did not answer", st.Unreachable)
+	}
+	if job.LastError != "" {
+		job.State = ResyncFailed
+	}
+}
+
+// ResyncJob returns the requested resync id, and false if it is unknown.
+func (c *Cluster) ResyncJob(id string) (ResyncJob, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, j := range c.resyncs {
+		if j.ID == id {
+			return *j, true
+		}
+	}
+	return ResyncJob{}, false
+}
+
+// ResyncJobs returns the requested resyncs this replica remembers, oldest
+// first.
+func (c *Cluster) ResyncJobs() []ResyncJob {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]ResyncJob, len(c.resyncs))
+	for i, j := range c.resyncs {
+		out[i] = *j
+	}
+	return out
+}
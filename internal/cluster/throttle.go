@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"context"
+	"io"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// Object bodies sent to or pulled from peers share one bandwidth limit per
+// replica, so that bulk ingest leaves room for client traffic. Mutations
+// that cannot be delivered pile up as hints or, in asynchronous mode, in the
+// replication queues; once they exceed the backlog limit the S3 handler
+// turns away uploads until the peers catch up.
+
+// throttled paces reads from rc to the replication bandwidth limit.
+func (c *Cluster) throttled(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	return c.throttle.Reader(ctx, "replication", float64(c.bandwidth.Load()), rc)
+}
+
+// SetReplicationLimits changes the replication bandwidth and backlog limits
+// while the replica runs. Transfers already started keep their pace.
+func (c *Cluster) SetReplicationLimits(bandwidth, maxBacklog int64) {
+	c.bandwidth.Store(bandwidth)
+	c.maxBacklog.Store(maxBacklog)
+}
+
+// Backlog returns the bytes of object data waiting to be delivered to peers,
+// in hints and replication queues.
+func (c *Cluster) Backlog() int64 {
+	var n int64
+	c.mu.Lock()
+	for _, q := range c.hints {
+		n += q.bytes
+	}
+	c.mu.Unlock()
+	for _, q := range c.queues {
+		q.mu.Lock()
+		n += q.bytes
+		q.mu.Unlock()
+	}
+	metrics.SetGauge("entity_cluster_replication_backlog_bytes", nil, float64(n))
+	return n
+}
+
+// Backlogged reports whether the backlog exceeds its limit, in which case
+// new writes should be refused.
+func (c *Cluster) Backlogged() bool {
+	limit := c.maxBacklog.Load()
+	if limit <= 0 || !c.Enabled() {
+		return false
+	}
+	return c.Backlog() > limit
+}
@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metering"
+)
+
+// Usage returns the usage metered by m on this replica merged with that of
+// every peer, and the ordinals of the peers that did not answer. Each
+// replica meters the client requests it received itself.
+func (c *Cluster) Usage(ctx context.Context, m *metering.Meter, from, to time.Time) (metering.Report, []int) {
+	report := m.Report(from, to)
+	if !c.Enabled() {
+		return report, nil
+	}
+	q := url.Values{"from": {from.Format(time.RFC3339)}, "to": {to.Format(time.RFC3339)}}
+	var missing []int
+	for _, i := range c.ordinals() {
+		if i == c.ordinal {
+			continue
+		}
+		pctx, cancel := context.WithTimeout(ctx, c.cfg.PeerTimeout)
+		var peer metering.Report
+		err := c.getJSON(pctx, i, "/_cluster/usage?"+q.Encode(), &peer)
+		cancel()
+		if err != nil {
+			missing = append(missing, i)
+			continue
+		}
+		report.Merge(peer)
+	}
+	return report, missing
+}
+
+// ParseUsageWindow reads the from and to query parameters, RFC 3339 times
+// that default to the last day.
+func ParseUsageWindow(r *http.Request) (from, to time.Time, err error) {
+	to = time.Now().UTC()
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, err
+		}
+	}
+	from = to.Add(-24 * time.Hour)
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, err
+		}
+	}
+	return from, to, nil
+}
+
+func (h *ReplicationHandler) serveUsage(w http.ResponseWriter, r *http.Request) {
+	if h.Meter == nil {
+		http.NotFound(w, r)
+		return
+	}
+	from, to, err := ParseUsageWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Meter.Report(from, to))
+}
@@ -0,0 +1,78 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// Every mutating request asks which replica leads, and uploads routed to an
+// owner ask which owners are up. Rather than probing peers on each request,
+// a background loop probes every replica each interval and routing reads
+// the results. An answer older than two intervals is probed again on
+// demand, so routing never relies on a loop that has stalled. Every other
+// health probe refreshes the view too.
+
+const DefaultHealthCheckInterval = time.Second
+
+type viewEntry struct {
+	up bool
+	at time.Time
+}
+
+// RunHealthView probes every replica each interval until ctx is cancelled.
+// A zero interval leaves routing probing peers on every request.
+func (c *Cluster) RunHealthView(ctx context.Context, interval time.Duration) {
+	if !c.Enabled() || interval <= 0 {
+		return
+	}
+	c.mu.Lock()
+	c.viewTTL = 2 * interval
+	c.mu.Unlock()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		c.refreshView(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Cluster) refreshView(parent context.Context) {
+	ctx, cancel := context.WithTimeout(parent, c.cfg.PeerTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, i := range c.ordinals() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.health(ctx, i)
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *Cluster) recordHealth(ordinal int, up bool) {
+	c.mu.Lock()
+	c.view[ordinal] = viewEntry{up: up, at: time.Now()}
+	c.mu.Unlock()
+}
+
+// up reports whether ordinal answered its last health probe, probing it
+// now if that answer is too old to route on.
+func (c *Cluster) up(ctx context.Context, ordinal int) bool {
+	c.mu.Lock()
+	e, ok := c.view[ordinal]
+	fresh := ok && time.Since(e.at) < c.viewTTL
+	c.mu.Unlock()
+	if fresh {
+		return e.up
+	}
+	metrics.AddCounter("entity_cluster_health_view_misses_total", nil, 1)
+	return c.health(ctx, ordinal)
+}
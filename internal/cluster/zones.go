@@ -0,0 +1,96 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Replicas can be told the zone of every member through ZonesFile, which
+// holds one ordinal=zone line per member; the operator keeps it up to date
+// from the nodes the pods run on. Partitioned placement then spreads the
+// owners of each object over as many zones as it can, so that losing a
+// zone does not lose every copy. The file is reread periodically, and all
+// replicas read the same file, so they agree on the owners once it has
+// reached them; owners that change pull the bodies in the background as
+// they do when the replica count changes.
+
+// DefaultZonesInterval is how often ZonesFile is reread.
+const DefaultZonesInterval = 30 * time.Second
+
+// parseZones parses the ordinal=zone lines of a zones file.
+func parseZones(b []byte) (map[int]string, error) {
+	zones := map[int]string{}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		o, zone, ok := strings.Cut(line, "=")
+		ordinal, err := strconv.Atoi(strings.TrimSpace(o))
+		if !ok || err != nil || ordinal < 0 {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		if zone = strings.TrimSpace(zone); zone != "" {
+			zones[ordinal] = zone
+		}
+	}
+	return zones, sc.Err()
+}
+
+// LoadZones reads ZonesFile. A file that is missing or invalid leaves the
+// zones as they are.
+func (c *Cluster) LoadZones() error {
+	if c.cfg.ZonesFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(c.cfg.ZonesFile)
+	if err != nil {
+		return err
+	}
+	zones, err := parseZones(b)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.cfg.ZonesFile, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !maps.Equal(zones, c.zones) {
+		log.Printf("cluster: zones of %d members loaded", len(zones))
+		c.zones = zones
+	}
+	return nil
+}
+
+// RunZones rereads ZonesFile every interval until ctx is cancelled.
+func (c *Cluster) RunZones(ctx context.Context, interval time.Duration) {
+	if c.cfg.ZonesFile == "" {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := c.LoadZones(); err != nil && !os.IsNotExist(err) {
+			log.Printf("cluster: reading zones: %v", err)
+		}
+	}
+}
+
+// zoneMap returns the zones of the members, by ordinal.
+func (c *Cluster) zoneMap() map[int]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.zones
+}
@@ -0,0 +1,218 @@
+// Package config reads settings from a file of KEY=value lines, named like
+// the environment variables they override, and re-applies the ones that can
+// change while the replica runs.
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var keyPattern = regexp.MustCompile(`^ENTITY_[A-Z0-9_]+$`)
+
+// parse reads the settings of a file. Blank lines and lines starting with #
+// are ignored; values may be quoted.
+func parse(data []byte) (map[string]string, error) {
+	out := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(text, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || !keyPattern.MatchString(k) {
+			return nil, fmt.Errorf("line %d: want ENTITY_NAME=value", line)
+		}
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		out[k] = v
+	}
+	return out, sc.Err()
+}
+
+// Status is the outcome of the last reload.
+type Status struct {
+	File     string    `json:"file"`
+	LoadedAt time.Time `json:"loadedAt"`
+	// Applied are the settings the last successful reload changed.
+	Applied []string `json:"applied,omitempty"`
+	// RestartRequired are the settings whose file value differs from the
+	// one the replica started with and that only a restart applies.
+	RestartRequired []string `json:"restartRequired,omitempty"`
+	LastError       string   `json:"lastError,omitempty"`
+}
+
+// Reloader keeps a replica's settings in step with File. A setting is taken
+// from the file when it is there and from the environment otherwise.
+type Reloader struct {
+	File string
+	// Hot names the settings Apply can change while the replica runs.
+	Hot []string
+	// Apply validates the hot settings, read with get, and applies them.
+	// It must change nothing when it returns an error, so that a reload
+	// takes effect entirely or not at all.
+	Apply func(get func(key string) string) error
+
+	env     map[string]string
+	started map[string]string
+
+	mu      sync.Mutex
+	current map[string]string
+	sum     [32]byte
+	status  Status
+}
+
+// Open reads file and exports its settings to the environment, so that
+// the replica starts with them.
+func Open(file string, hot []string) (*Reloader, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	r := &Reloader{File: file, Hot: hot, env: map[string]string{}, current: settings, sum: sha256.Sum256(data)}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			r.env[k] = v
+		}
+	}
+	for k, v := range settings {
+		if err := os.Setenv(k, v); err != nil {
+			return nil, err
+		}
+	}
+	r.started = r.effective(settings)
+	r.status = Status{File: file, LoadedAt: time.Now().UTC()}
+	return r, nil
+}
+
+// effective returns the value of every setting in settings or the
+// environment.
+func (r *Reloader) effective(settings map[string]string) map[string]string {
+	out := map[string]string{}
+	for k, v := range r.env {
+		if keyPattern.MatchString(k) {
+			out[k] = v
+		}
+	}
+	for k, v := range settings {
+		out[k] = v
+	}
+	return out
+}
+
+// Reload rereads File and applies the hot settings that changed. Nothing
+// is applied when the file cannot be read or a value is invalid.
+func (r *Reloader) Reload() (Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, err := os.ReadFile(r.File)
+	if err == nil {
+		err = r.reloadLocked(data)
+	}
+	if err != nil {
+		r.status.LastError = err.Error()
+		return r.status, err
+	}
+	return r.status, nil
+}
+
+func (r *Reloader) reloadLocked(data []byte) error {
+	settings, err := parse(data)
+	if err != nil {
+		return err
+	}
+	before, after := r.effective(r.current), r.effective(settings)
+	var applied []string
+	for _, k := range r.Hot {
+		if before[k] != after[k] {
+			applied = append(applied, k)
+		}
+	}
+	if len(applied) > 0 && r.Apply != nil {
+		if err := r.Apply(func(key string) string { return after[key] }); err != nil {
+			return err
+		}
+	}
+	var restart []string
+	for k := range keys(r.started, after) {
+		if r.started[k] != after[k] && !slices.Contains(r.Hot, k) {
+			restart = append(restart, k)
+		}
+	}
+	sort.Strings(restart)
+	r.current, r.sum = settings, sha256.Sum256(data)
+	r.status = Status{File: r.File, LoadedAt: time.Now().UTC(), Applied: applied, RestartRequired: restart}
+	if len(applied) > 0 {
+		log.Printf("configuration reloaded: %s changed", strings.Join(applied, ", "))
+	}
+	if len(restart) > 0 {
+		log.Printf("configuration: %s only change on restart", strings.Join(restart, ", "))
+	}
+	return nil
+}
+
+// Status returns the outcome of the last reload.
+func (r *Reloader) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Watch reloads File whenever its content changes. Mounted ConfigMaps are
+// replaced by a symlink swap, which this notices as well.
+func (r *Reloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// failed is the content that last failed to apply, which is not tried
+	// again until it changes.
+	var failed [32]byte
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			data, err := os.ReadFile(r.File)
+			if err != nil {
+				continue
+			}
+			sum := sha256.Sum256(data)
+			r.mu.Lock()
+			changed := sum != r.sum && sum != failed
+			r.mu.Unlock()
+			if !changed {
+				continue
+			}
+			if _, err := r.Reload(); err != nil {
+				failed = sum
+				log.Printf("configuration reload failed: %v", err)
+			}
+		}
+	}
+}
+
+func keys(maps ...map[string]string) map[string]bool {
+	out := map[string]bool{}
+	for _, m := range maps {
+		for k := range m {
+			out[k] = true
+		}
+	}
+	return out
+}
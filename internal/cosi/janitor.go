@@ -0,0 +1,197 @@
+package cosi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/pkg/adminclient"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	objv1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+)
+
+// Janitor periodically reclaims what the listeners leave behind when a
+// delete event is missed, for example while the driver was down: Buckets
+// whose BucketClaim is gone, credentials secrets whose BucketAccess is gone
+// and backend access keys no BucketAccess refers to. A resource is only
+// removed after it was found orphaned on two consecutive sweeps, so objects
+// that are still being provisioned are left alone.
+type Janitor struct {
+	Listener *Listener
+	Interval time.Duration
+
+	suspects map[string]bool
+}
+
+func NewJanitor(l *Listener, interval time.Duration) *Janitor {
+	return &Janitor{Listener: l, Interval: interval}
+}
+
+// Run sweeps every Interval until ctx is done. A zero interval disables the
+// janitor.
+func (j *Janitor) Run(ctx context.Context) {
+	if j.Interval <= 0 {
+		return
+	}
+	t := time.NewTicker(j.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := j.Sweep(ctx); err != nil {
+				log.Printf("cosi janitor: %v", err)
+			}
+		}
+	}
+}
+
+// Sweep runs one pass over buckets, secrets and access keys.
+func (j *Janitor) Sweep(ctx context.Context) error {
+	l := j.Listener
+	if l.Kube == nil || l.Bucket == nil {
+		// The controller has not handed out its clients yet.
+		return nil
+	}
+	seen := map[string]bool{}
+	err := errors.Join(
+		j.sweepBuckets(ctx, seen),
+		j.sweepSecrets(ctx, seen),
+		j.sweepAccessKeys(ctx, seen),
+	)
+	j.suspects = seen
+	return err
+}
+
+// confirm records id as orphaned in this sweep and reports whether it was
+// already orphaned in the previous one.
+func (j *Janitor) confirm(seen map[string]bool, id string) bool {
+	seen[id] = true
+	return j.suspects[id]
+}
+
+func reclaimed(kind string) {
+	metrics.AddCounter("entity_cosi_reclaimed_total", map[string]string{"kind": kind}, 1)
+}
+
+// sweepBuckets deletes Buckets of this driver whose BucketClaim no longer
+// exists. Buckets with the Retain policy are kept along with their data.
+func (j *Janitor) sweepBuckets(ctx context.Context, seen map[string]bool) error {
+	l := j.Listener
+	list, err := l.Bucket.ObjectstorageV1alpha1().Buckets().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := range list.Items {
+		b := &list.Items[i]
+		ref := b.Spec.BucketClaim
+		if b.Spec.DriverName != l.DriverName || b.DeletionTimestamp != nil || ref == nil || ref.Name == "" || ref.Namespace == "" {
+			continue
+		}
+		bc, err := l.Bucket.ObjectstorageV1alpha1().BucketClaims(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err == nil && (ref.UID == "" || bc.UID == ref.UID) {
+			continue
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		if b.Spec.DeletionPolicy != objv1.DeletionPolicyDelete {
+			continue
+		}
+		if !j.confirm(seen, "bucket/"+b.Name) {
+			continue
+		}
+		if err := l.Delete(ctx, b); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = l.Bucket.ObjectstorageV1alpha1().Buckets().Delete(ctx, b.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("cosi janitor: deleted bucket %s of missing claim %s/%s", b.Name, ref.Namespace, ref.Name)
+		reclaimed("bucket")
+	}
+	return errors.Join(errs...)
+}
+
+// sweepSecrets deletes credentials secrets written by the driver whose
+// BucketAccess is gone or no longer points at them.
+func (j *Janitor) sweepSecrets(ctx context.Context, seen map[string]bool) error {
+	l := j.Listener
+	list, err := l.Kube.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: managedByLabel + "=" + managedByValue})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := range list.Items {
+		s := &list.Items[i]
+		name := s.Annotations[bucketAccessAnnotation]
+		if name == "" || s.DeletionTimestamp != nil {
+			continue
+		}
+		ba, err := l.Bucket.ObjectstorageV1alpha1().BucketAccesses(s.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil && ba.Spec.CredentialsSecretName == s.Name {
+			continue
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		if !j.confirm(seen, "secret/"+s.Namespace+"/"+s.Name) {
+			continue
+		}
+		err = l.Kube.CoreV1().Secrets(s.Namespace).Delete(ctx, s.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("cosi janitor: deleted secret %s/%s of missing bucket access %s", s.Namespace, s.Name, name)
+		reclaimed("secret")
+	}
+	return errors.Join(errs...)
+}
+
+// sweepAccessKeys deletes backend keys issued for a BucketAccess that no
+// longer exists or was granted a different key. Keys without a COSI owner
+// were created by hand and are never touched.
+func (j *Janitor) sweepAccessKeys(ctx context.Context, seen map[string]bool) error {
+	l := j.Listener
+	keys, err := l.Admin.ListAccess(ctx, "")
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, k := range keys {
+		ns, name, ok := strings.Cut(strings.TrimPrefix(k.Owner, "cosi:"), "/")
+		if !strings.HasPrefix(k.Owner, "cosi:") || !ok {
+			continue
+		}
+		ba, err := l.Bucket.ObjectstorageV1alpha1().BucketAccesses(ns).Get(ctx, name, metav1.GetOptions{})
+		if err == nil && (ba.Status.AccountID == "" || ba.Status.AccountID == k.AccessKey) {
+			continue
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		if !j.confirm(seen, "access/"+k.AccessKey) {
+			continue
+		}
+		if err := l.Admin.DeleteAccess(ctx, k.AccessKey); err != nil && !adminclient.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("cosi janitor: deleted access key %s of bucket access %s/%s", k.AccessKey, ns, name)
+		reclaimed("accessKey")
+	}
+	return errors.Join(errs...)
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/mchenetz/entity/pkg/adminclient"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -16,17 +17,30 @@ import (
 	bucketclientset "sigs.k8s.io/container-object-storage-interface-api/client/clientset/versioned"
 )
 
+// Labels and annotations put on the credentials secrets the driver writes,
+// so the janitor can find them again.
+const (
+	managedByLabel         = "app.kubernetes.io/managed-by"
+	managedByValue         = "entity-cosi"
+	bucketAccessAnnotation = "entity.io/bucket-access"
+)
+
+// accessOwner is the owner tag of the access key issued for a BucketAccess.
+func accessOwner(ns, name string) string {
+	return "cosi:" + ns + "/" + name
+}
+
 type Listener struct {
 	DriverName string
 	Endpoint   string
 	Region     string
 	CABundle   string
-	Admin      *AdminClient
+	Admin      *adminclient.Client
 	Kube       kubeclientset.Interface
 	Bucket     bucketclientset.Interface
 }
 
-func NewListener(driverName, endpoint, region, caBundle string, admin *AdminClient) *Listener {
+func NewListener(driverName, endpoint, region, caBundle string, admin *adminclient.Client) *Listener {
 	return &Listener{DriverName: driverName, Endpoint: endpoint, Region: region, CABundle: caBundle, Admin: admin}
 }
 
@@ -41,9 +55,26 @@ func (l *Listener) Add(ctx context.Context, b *objv1.Bucket) error {
 	if b.Spec.ExistingBucketID != "" {
 		bucketName = b.Spec.ExistingBucketID
 	} else {
-		if err := l.Admin.CreateBucket(ctx, bucketName); err != nil {
+		replicationFactor := 0
+		if v, ok := b.Spec.Parameters["replicationFactor"]; ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid replicationFactor parameter %q", v)
+			}
+			replicationFactor = n
+		}
+		cfg, err := bucketConfig(b.Spec.Parameters)
+		if err != nil {
 			return err
 		}
+		if err := l.Admin.CreateBucket(ctx, adminclient.CreateBucketRequest{Name: bucketName, ReplicationFactor: replicationFactor}); err != nil {
+			return err
+		}
+		if cfg != (adminclient.BucketConfig{}) {
+			if _, err := l.Admin.PutBucketConfig(ctx, bucketName, cfg); err != nil {
+				return err
+			}
+		}
 	}
 	copy := b.DeepCopy()
 	copy.Status.BucketReady = true
@@ -55,6 +86,29 @@ func (l *Listener) Add(ctx context.Context, b *objv1.Bucket) error {
 	return l.syncClaimReadyFromBucket(ctx, updated)
 }
 
+// bucketConfig reads the versioning, quotaBytes, publicRead and encryption
+// parameters of a BucketClass.
+func bucketConfig(params map[string]string) (adminclient.BucketConfig, error) {
+	var cfg adminclient.BucketConfig
+	if v, ok := params["quotaBytes"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("invalid quotaBytes parameter %q", v)
+		}
+		cfg.QuotaBytes = n
+	}
+	if v, ok := params["publicRead"]; ok {
+		p, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid publicRead parameter %q", v)
+		}
+		cfg.PublicRead = p
+	}
+	cfg.Encryption = params["encryption"]
+	cfg.Versioning = params["versioning"]
+	return cfg, nil
+}
+
 func (l *Listener) Update(ctx context.Context, old *objv1.Bucket, new *objv1.Bucket) error {
 	if err := l.Add(ctx, new); err != nil {
 		return err
@@ -91,7 +145,12 @@ func (l *Listener) Delete(ctx context.Context, b *objv1.Bucket) error {
 		if id == "" {
 			id = b.Name
 		}
-		return l.Admin.DeleteBucket(ctx, id)
+		// The claim is gone, so are the objects: purge them rather than
+		// leave the bucket behind. A purge cut short by the client timeout
+		// is resumed when the delete is retried.
+		if err := l.Admin.DeleteBucket(ctx, id, true); err != nil && !adminclient.IsNotFound(err) {
+			return err
+		}
 	}
 	return nil
 }
@@ -217,11 +276,17 @@ func (l *Listener) AddBucketAccess(ctx context.Context, b *objv1.BucketAccess) e
 		parsed, _ := strconv.ParseBool(v)
 		readOnly = parsed
 	}
-	creds, err := l.Admin.CreateAccess(ctx, bucket.Status.BucketID, readOnly)
+	var allowedCIDRs []string
+	for _, c := range strings.Split(bac.Parameters["allowedCIDRs"], ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			allowedCIDRs = append(allowedCIDRs, c)
+		}
+	}
+	creds, err := l.Admin.CreateAccess(ctx, adminclient.CreateAccessRequest{Bucket: bucket.Status.BucketID, ReadOnly: readOnly, AllowedCIDRs: allowedCIDRs, Owner: accessOwner(b.Namespace, b.Name)})
 	if err != nil {
 		return err
 	}
-	if err := l.ensureSecret(ctx, b.Namespace, b.Spec.CredentialsSecretName, bucket.Status.BucketID, creds); err != nil {
+	if err := l.ensureSecret(ctx, b.Namespace, b.Spec.CredentialsSecretName, b.Name, bucket.Status.BucketID, creds); err != nil {
 		return err
 	}
 	copy := b.DeepCopy()
@@ -237,7 +302,7 @@ func (l *Listener) UpdateBucketAccess(ctx context.Context, old *objv1.BucketAcce
 
 func (l *Listener) DeleteBucketAccess(ctx context.Context, b *objv1.BucketAccess) error {
 	if b.Status.AccountID != "" {
-		if err := l.Admin.DeleteAccess(ctx, b.Status.AccountID); err != nil {
+		if err := l.Admin.DeleteAccess(ctx, b.Status.AccountID); err != nil && !adminclient.IsNotFound(err) {
 			return err
 		}
 	}
@@ -247,7 +312,7 @@ func (l *Listener) DeleteBucketAccess(ctx context.Context, b *objv1.BucketAccess
 	return nil
 }
 
-func (l *Listener) ensureSecret(ctx context.Context, ns, name, bucketName string, creds AccessKey) error {
+func (l *Listener) ensureSecret(ctx context.Context, ns, name, accessName, bucketName string, creds adminclient.AccessKey) error {
 	if name == "" {
 		return fmt.Errorf("credentialsSecretName is required")
 	}
@@ -284,6 +349,8 @@ func (l *Listener) ensureSecret(ctx context.Context, ns, name, bucketName string
 		s := &corev1.Secret{}
 		s.Namespace = ns
 		s.Name = name
+		s.Labels = map[string]string{managedByLabel: managedByValue}
+		s.Annotations = map[string]string{bucketAccessAnnotation: accessName}
 		s.StringData = data
 		_, err = l.Kube.CoreV1().Secrets(ns).Create(ctx, s, metav1.CreateOptions{})
 		return err
@@ -291,6 +358,14 @@ func (l *Listener) ensureSecret(ctx context.Context, ns, name, bucketName string
 	if err != nil {
 		return err
 	}
+	if existing.Labels == nil {
+		existing.Labels = map[string]string{}
+	}
+	existing.Labels[managedByLabel] = managedByValue
+	if existing.Annotations == nil {
+		existing.Annotations = map[string]string{}
+	}
+	existing.Annotations[bucketAccessAnnotation] = accessName
 	existing.StringData = data
 	_, err = l.Kube.CoreV1().Secrets(ns).Update(ctx, existing, metav1.UpdateOptions{})
 	return err
@@ -0,0 +1,337 @@
+package csi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errNotFound = errors.New("not found in the bucket")
+	// errPastEnd answers a read that starts at or past the end of an object.
+	errPastEnd = errors.New("range past the end of the object")
+)
+
+// Credentials are what a COSI credentials secret holds.
+type Credentials struct {
+	// Endpoint is the S3 host and port, or a URL. A bare host is reached
+	// over HTTPS when CABundle is set and over HTTP otherwise.
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	CABundle  string
+}
+
+// CredentialsFromSecret reads the keys the COSI driver writes.
+func CredentialsFromSecret(data map[string][]byte) (Credentials, error) {
+	c := Credentials{
+		Endpoint:  string(data["BUCKET_HOST"]),
+		Bucket:    string(data["BUCKET_NAME"]),
+		Region:    string(data["AWS_REGION"]),
+		AccessKey: string(data["AWS_ACCESS_KEY_ID"]),
+		SecretKey: string(data["AWS_SECRET_ACCESS_KEY"]),
+		CABundle:  string(data["AWS_CA_BUNDLE_PEM"]),
+	}
+	if c.Endpoint == "" || c.Bucket == "" || c.AccessKey == "" || c.SecretKey == "" {
+		return Credentials{}, fmt.Errorf("BUCKET_HOST, BUCKET_NAME, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required")
+	}
+	return c, nil
+}
+
+// Entry is an object in a listing.
+type Entry struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Bucket is a SigV4 client for one bucket, addressed path-style.
+type Bucket struct {
+	creds Credentials
+	base  *url.URL
+	http  *http.Client
+}
+
+func NewBucket(c Credentials) (*Bucket, error) {
+	endpoint := c.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		scheme := "http://"
+		if c.CABundle != "" {
+			scheme = "https://"
+		}
+		endpoint = scheme + endpoint
+	}
+	base, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", c.Endpoint)
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if c.CABundle != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.CABundle)) {
+			return nil, fmt.Errorf("AWS_CA_BUNDLE_PEM holds no certificate")
+		}
+		tr.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}
+	}
+	return &Bucket{creds: c, base: base, http: &http.Client{Transport: tr}}, nil
+}
+
+// Name returns the name of the bucket.
+func (b *Bucket) Name() string { return b.creds.Bucket }
+
+type listResult struct {
+	Contents []struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the objects under prefix, at most max of them if max is
+// positive.
+func (b *Bucket) List(ctx context.Context, prefix string, max int) ([]Entry, error) {
+	var out []Entry
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		if max > 0 {
+			q.Set("max-keys", strconv.Itoa(max-len(out)))
+		}
+		req, err := b.request(ctx, http.MethodGet, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		// SigV4 encodes spaces as %20, not as the + of form encoding.
+		req.URL.RawQuery = strings.ReplaceAll(q.Encode(), "+", "%20")
+		resp, err := b.do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page listResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, err)
+		}
+		for _, c := range page.Contents {
+			mod, _ := time.Parse(time.RFC3339, c.LastModified)
+			out = append(out, Entry{Key: c.Key, Size: c.Size, ModTime: mod})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" || max > 0 && len(out) >= max {
+			return out, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// Stat returns the size and modification time of key.
+func (b *Bucket) Stat(ctx context.Context, key string) (Entry, error) {
+	req, err := b.request(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return Entry{}, err
+	}
+	resp, err := b.do(req)
+	if err != nil {
+		return Entry{}, err
+	}
+	resp.Body.Close()
+	mod, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return Entry{Key: key, Size: resp.ContentLength, ModTime: mod}, nil
+}
+
+// ReadAt reads len(p) bytes of key from off, or fewer at the end of the
+// object.
+func (b *Bucket) ReadAt(ctx context.Context, key string, p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	req, err := b.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+	resp, err := b.do(req)
+	if errors.Is(err, errPastEnd) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		// The server ignored the range and sent the whole object.
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err == io.EOF {
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	n, err := io.ReadFull(resp.Body, p)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Get opens key for reading.
+func (b *Bucket) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := b.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Put stores size bytes of body as key.
+func (b *Bucket) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	req, err := b.request(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := b.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Copy copies src to dst within the bucket, through this client.
+func (b *Bucket) Copy(ctx context.Context, src, dst string) error {
+	req, err := b.request(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := b.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return b.Put(ctx, dst, resp.Body, resp.ContentLength)
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (b *Bucket) Delete(ctx context.Context, key string) error {
+	req, err := b.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := b.do(req)
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (b *Bucket) request(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	u := *b.base
+	u.Path = strings.TrimSuffix(b.base.Path, "/") + "/" + b.creds.Bucket + "/" + key
+	u.RawPath = escapePath(u.Path)
+	return http.NewRequestWithContext(ctx, method, u.String(), body)
+}
+
+// do signs and sends req. Responses other than 2xx are returned as errors.
+func (b *Bucket) do(req *http.Request) (*http.Response, error) {
+	b.sign(req, time.Now())
+	resp, err := b.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, errNotFound
+	case http.StatusRequestedRangeNotSatisfiable:
+		return nil, errPastEnd
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// sign signs req with an unsigned payload; TLS protects the body.
+func (b *Bucket) sign(req *http.Request, now time.Time) {
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	const signed = "host;x-amz-content-sha256;x-amz-date"
+	canon := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signed,
+		payloadHash,
+	}, "\n")
+	h := sha256.Sum256([]byte(canon))
+	scope := date + "/" + b.creds.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(h[:])
+	key := hmacSHA256([]byte("AWS4"+b.creds.SecretKey), date)
+	key = hmacSHA256(key, b.creds.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", b.creds.AccessKey, scope, signed, sig))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// escapePath percent-encodes p the way SigV4 expects: everything except
+// unreserved characters and the separators.
+func escapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package csi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mchenetz/entity/internal/objectd"
+	"github.com/mchenetz/entity/internal/s3"
+)
+
+// newBucket serves a fresh store over S3 and returns a client for one of
+// its buckets.
+func newBucket(t *testing.T) *Bucket {
+	t.Helper()
+	ctx := context.Background()
+	store, err := objectd.OpenStoreWithOptions(t.TempDir(), objectd.StoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	if err := store.CreateBucket(ctx, "photos"); err != nil {
+		t.Fatal(err)
+	}
+	key, err := store.CreateAccess(ctx, "photos", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s3.NewHandler(store, nil))
+	t.Cleanup(srv.Close)
+	creds, err := CredentialsFromSecret(map[string][]byte{
+		"BUCKET_HOST":           []byte(strings.TrimPrefix(srv.URL, "http://")),
+		"BUCKET_NAME":           []byte("photos"),
+		"AWS_ACCESS_KEY_ID":     []byte(key.AccessKey),
+		"AWS_SECRET_ACCESS_KEY": []byte(key.SecretKey),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBucket(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBucketObjects(t *testing.T) {
+	ctx := context.Background()
+	b := newBucket(t)
+	for _, key := range []string{"a.txt", "dir/b c.txt", "dir/sub/"} {
+		if err := b.Put(ctx, key, strings.NewReader(key), int64(len(key))); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+
+	all, err := b.List(ctx, "", 0)
+	if err != nil || len(all) != 3 {
+		t.Fatalf("list: %+v %v", all, err)
+	}
+	dir, err := b.List(ctx, "dir/", 1)
+	if err != nil || len(dir) != 1 || dir[0].Key != "dir/b c.txt" {
+		t.Fatalf("list dir/: %+v %v", dir, err)
+	}
+
+	e, err := b.Stat(ctx, "dir/b c.txt")
+	if err != nil || e.Size != int64(len("dir/b c.txt")) {
+		t.Fatalf("stat: %+v %v", e, err)
+	}
+	if _, err := b.Stat(ctx, "missing"); !errors.Is(err, errNotFound) {
+		t.Fatalf("stat missing: %v", err)
+	}
+
+	p := make([]byte, 4)
+	n, err := b.ReadAt(ctx, "dir/b c.txt", p, 4)
+	if err != nil || string(p[:n]) != "b c." {
+		t.Fatalf("read at 4: %q %v", p[:n], err)
+	}
+	n, err = b.ReadAt(ctx, "dir/b c.txt", p, 9)
+	if err != nil || string(p[:n]) != "xt" {
+		t.Fatalf("read the tail: %q %v", p[:n], err)
+	}
+	if n, err := b.ReadAt(ctx, "dir/b c.txt", p, 100); err != nil || n != 0 {
+		t.Fatalf("read past the end: %d %v", n, err)
+	}
+
+	if err := b.Copy(ctx, "dir/b c.txt", "moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := b.Get(ctx, "moved.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	_ = r.Close()
+	if err != nil || string(got) != "dir/b c.txt" {
+		t.Fatalf("copied %q %v", got, err)
+	}
+
+	if err := b.Delete(ctx, "moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Delete(ctx, "moved.txt"); err != nil {
+		t.Fatalf("delete missing: %v", err)
+	}
+	if _, err := b.Stat(ctx, "moved.txt"); !errors.Is(err, errNotFound) {
+		t.Fatalf("stat deleted: %v", err)
+	}
+}
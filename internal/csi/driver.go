@@ -0,0 +1,148 @@
+// Package csi is a CSI node plugin that mounts an entity bucket as a
+// filesystem in a pod, through an inline ephemeral volume that names the
+// credentials secret the COSI driver wrote for the pod's BucketAccess.
+// Volumes are read-only unless they ask for writes, which are served
+// through FUSE as described in fs.go.
+package csi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclientset "k8s.io/client-go/kubernetes"
+)
+
+// Volume attributes an inline volume sets, and those kubelet adds.
+const (
+	SecretAttribute    = "credentialsSecretName"
+	ReadWriteAttribute = "readWrite"
+
+	ephemeralAttribute    = "csi.storage.k8s.io/ephemeral"
+	podNamespaceAttribute = "csi.storage.k8s.io/pod.namespace"
+)
+
+type Driver struct {
+	Name    string
+	Version string
+	NodeID  string
+	Kube    kubeclientset.Interface
+	// SpoolDir holds the local copies of files open for writing.
+	SpoolDir string
+
+	mu     sync.Mutex
+	mounts map[string]*fuse.Server
+
+	csi.UnimplementedIdentityServer
+	csi.UnimplementedNodeServer
+}
+
+func NewDriver(name, version, nodeID string, kube kubeclientset.Interface, spoolDir string) *Driver {
+	return &Driver{Name: name, Version: version, NodeID: nodeID, Kube: kube, SpoolDir: spoolDir, mounts: map[string]*fuse.Server{}}
+}
+
+func (d *Driver) GetPluginInfo(context.Context, *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
+	return &csi.GetPluginInfoResponse{Name: d.Name, VendorVersion: d.Version}, nil
+}
+
+// GetPluginCapabilities reports none: inline volumes need no controller.
+func (d *Driver) GetPluginCapabilities(context.Context, *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) {
+	return &csi.GetPluginCapabilitiesResponse{}, nil
+}
+
+func (d *Driver) Probe(context.Context, *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	return &csi.ProbeResponse{}, nil
+}
+
+func (d *Driver) NodeGetCapabilities(context.Context, *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
+	return &csi.NodeGetCapabilitiesResponse{}, nil
+}
+
+func (d *Driver) NodeGetInfo(context.Context, *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+	return &csi.NodeGetInfoResponse{NodeId: d.NodeID}, nil
+}
+
+// NodePublishVolume mounts the bucket of the credentials secret named by
+// the volume at the target path. Publishing a mounted path again is a
+// no-op.
+func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	target := req.GetTargetPath()
+	if req.GetVolumeId() == "" || target == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume id and target path are required")
+	}
+	if req.GetVolumeCapability().GetMount() == nil {
+		return nil, status.Error(codes.InvalidArgument, "only filesystem volumes are supported")
+	}
+	attrs := req.GetVolumeContext()
+	if attrs[ephemeralAttribute] != "true" {
+		return nil, status.Error(codes.InvalidArgument, "only inline ephemeral volumes are supported")
+	}
+	secret, ns := attrs[SecretAttribute], attrs[podNamespaceAttribute]
+	if secret == "" || ns == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "volume attribute %s is required", SecretAttribute)
+	}
+	readOnly := req.GetReadonly() || attrs[ReadWriteAttribute] != "true"
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.mounts[target] != nil {
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+	s, err := d.Kube.CoreV1().Secrets(ns).Get(ctx, secret, metav1.GetOptions{})
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "credentials secret %s/%s: %v", ns, secret, err)
+	}
+	creds, err := CredentialsFromSecret(s.Data)
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "credentials secret %s/%s: %v", ns, secret, err)
+	}
+	b, err := NewBucket(creds)
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "credentials secret %s/%s: %v", ns, secret, err)
+	}
+	if err := os.MkdirAll(target, 0o750); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	srv, err := Mount(target, b, readOnly, d.SpoolDir)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "mount %s: %v", target, err)
+	}
+	d.mounts[target] = srv
+	log.Printf("csi: mounted bucket %s at %s for volume %s (read-only %t)", b.Name(), target, req.GetVolumeId(), readOnly)
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// NodeUnpublishVolume unmounts the target path and removes it. A path
+// mounted before the plugin restarted is unmounted too.
+func (d *Driver) NodeUnpublishVolume(_ context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+	target := req.GetTargetPath()
+	if req.GetVolumeId() == "" || target == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume id and target path are required")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var err error
+	if srv := d.mounts[target]; srv != nil {
+		err = srv.Unmount()
+	} else if err = syscall.Unmount(target, 0); errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOENT) {
+		// Not mounted.
+		err = nil
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unmount %s: %v", target, err)
+	}
+	delete(d.mounts, target)
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	log.Printf("csi: unmounted volume %s from %s", req.GetVolumeId(), target)
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
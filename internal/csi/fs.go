@@ -0,0 +1,478 @@
+package csi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// The filesystem maps keys to paths at "/": the key a/b/c.txt is the file
+// c.txt in the directory a/b. A directory exists while keys lie under it;
+// mkdir stores an empty "a/b/" marker so that an empty directory survives.
+// Files are read with ranged GETs. With writes allowed, a file opened for
+// writing is spooled to a local file and stored with one PUT when it is
+// closed, and renaming a file copies it and deletes the original.
+// Directories cannot be renamed; mv falls back to copying them.
+
+// readAhead is the least a read of a file fetches.
+const readAhead = 1 << 20
+
+type fsys struct {
+	bucket   *Bucket
+	readOnly bool
+	// spool holds the local copies of files open for writing.
+	spool string
+}
+
+func (f *fsys) mode(dir bool) uint32 {
+	switch {
+	case dir && f.readOnly:
+		return fuse.S_IFDIR | 0o555
+	case dir:
+		return fuse.S_IFDIR | 0o777
+	case f.readOnly:
+		return fuse.S_IFREG | 0o444
+	default:
+		return fuse.S_IFREG | 0o666
+	}
+}
+
+// Mount serves b at dir until the returned server is unmounted.
+func Mount(dir string, b *Bucket, readOnly bool, spool string) (*fuse.Server, error) {
+	root := &dirNode{fsys: &fsys{bucket: b, readOnly: readOnly, spool: spool}}
+	ttl := time.Second
+	opts := &fs.Options{
+		EntryTimeout:    &ttl,
+		AttrTimeout:     &ttl,
+		NegativeTimeout: &ttl,
+		MountOptions: fuse.MountOptions{
+			AllowOther: true,
+			FsName:     "entity:" + b.Name(),
+			Name:       "entity",
+			// The plugin runs as root; there is no fusermount in its image.
+			DirectMount: true,
+		},
+	}
+	if readOnly {
+		opts.MountOptions.Options = append(opts.MountOptions.Options, "ro")
+	}
+	return fs.Mount(dir, root, opts)
+}
+
+// errno maps a bucket error to the error number of a file operation.
+func errno(op string, err error) syscall.Errno {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errNotFound):
+		return syscall.ENOENT
+	case errors.Is(err, context.Canceled):
+		return syscall.EINTR
+	}
+	log.Printf("csi: %s: %v", op, err)
+	return syscall.EIO
+}
+
+type dirNode struct {
+	fs.Inode
+	fsys *fsys
+	// prefix is "" for the root and ends in "/" otherwise.
+	prefix string
+}
+
+var (
+	_ fs.NodeGetattrer = (*dirNode)(nil)
+	_ fs.NodeLookuper  = (*dirNode)(nil)
+	_ fs.NodeReaddirer = (*dirNode)(nil)
+	_ fs.NodeMkdirer   = (*dirNode)(nil)
+	_ fs.NodeCreater   = (*dirNode)(nil)
+	_ fs.NodeUnlinker  = (*dirNode)(nil)
+	_ fs.NodeRmdirer   = (*dirNode)(nil)
+	_ fs.NodeRenamer   = (*dirNode)(nil)
+)
+
+func (d *dirNode) Getattr(_ context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = d.fsys.mode(true)
+	return 0
+}
+
+func (d *dirNode) child(ctx context.Context, name string, out *fuse.EntryOut) *fs.Inode {
+	out.Mode = d.fsys.mode(true)
+	return d.NewInode(ctx, &dirNode{fsys: d.fsys, prefix: d.prefix + name + "/"}, fs.StableAttr{Mode: fuse.S_IFDIR})
+}
+
+func (d *dirNode) file(ctx context.Context, e Entry, out *fuse.EntryOut) *fs.Inode {
+	n := &fileNode{fsys: d.fsys, key: e.Key, size: e.Size, mtime: e.ModTime}
+	n.attr(&out.Attr)
+	return d.NewInode(ctx, n, fs.StableAttr{Mode: fuse.S_IFREG})
+}
+
+// Lookup finds name as an object first and as a prefix second.
+func (d *dirNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	e, err := d.fsys.bucket.Stat(ctx, d.prefix+name)
+	if err == nil {
+		return d.file(ctx, e, out), 0
+	}
+	if !errors.Is(err, errNotFound) {
+		return nil, errno("lookup", err)
+	}
+	under, err := d.fsys.bucket.List(ctx, d.prefix+name+"/", 1)
+	if err != nil {
+		return nil, errno("lookup", err)
+	}
+	if len(under) == 0 {
+		return nil, syscall.ENOENT
+	}
+	return d.child(ctx, name, out), 0
+}
+
+func (d *dirNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	entries, err := d.fsys.bucket.List(ctx, d.prefix, 0)
+	if err != nil {
+		return nil, errno("readdir", err)
+	}
+	seen := map[string]uint32{}
+	for _, e := range entries {
+		rest := strings.TrimPrefix(e.Key, d.prefix)
+		name, _, dir := strings.Cut(rest, "/")
+		if name == "" {
+			continue
+		}
+		if dir {
+			seen[name] = fuse.S_IFDIR
+		} else if _, ok := seen[name]; !ok {
+			seen[name] = fuse.S_IFREG
+		}
+	}
+	list := make([]fuse.DirEntry, 0, len(seen))
+	for name, mode := range seen {
+		list = append(list, fuse.DirEntry{Name: name, Mode: mode})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return fs.NewListDirStream(list), 0
+}
+
+func (d *dirNode) Mkdir(ctx context.Context, name string, _ uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if d.fsys.readOnly {
+		return nil, syscall.EROFS
+	}
+	if err := d.fsys.bucket.Put(ctx, d.prefix+name+"/", bytes.NewReader(nil), 0); err != nil {
+		return nil, errno("mkdir", err)
+	}
+	return d.child(ctx, name, out), 0
+}
+
+func (d *dirNode) Create(ctx context.Context, name string, _, _ uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	if d.fsys.readOnly {
+		return nil, nil, 0, syscall.EROFS
+	}
+	n := &fileNode{fsys: d.fsys, key: d.prefix + name, mtime: time.Now()}
+	h, err := n.spool(ctx, true)
+	if err != nil {
+		return nil, nil, 0, errno("create", err)
+	}
+	// An empty file is stored even if nothing is written to it.
+	h.dirty = true
+	n.attr(&out.Attr)
+	return d.NewInode(ctx, n, fs.StableAttr{Mode: fuse.S_IFREG}), h, 0, 0
+}
+
+func (d *dirNode) Unlink(ctx context.Context, name string) syscall.Errno {
+	if d.fsys.readOnly {
+		return syscall.EROFS
+	}
+	return errno("unlink", d.fsys.bucket.Delete(ctx, d.prefix+name))
+}
+
+func (d *dirNode) Rmdir(ctx context.Context, name string) syscall.Errno {
+	if d.fsys.readOnly {
+		return syscall.EROFS
+	}
+	marker := d.prefix + name + "/"
+	under, err := d.fsys.bucket.List(ctx, marker, 2)
+	if err != nil {
+		return errno("rmdir", err)
+	}
+	for _, e := range under {
+		if e.Key != marker {
+			return syscall.ENOTEMPTY
+		}
+	}
+	return errno("rmdir", d.fsys.bucket.Delete(ctx, marker))
+}
+
+// Rename moves a file. Directories are answered with EXDEV, which makes
+// mv copy them instead.
+func (d *dirNode) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	if d.fsys.readOnly {
+		return syscall.EROFS
+	}
+	to, ok := newParent.(*dirNode)
+	if !ok || flags != 0 {
+		return syscall.ENOTSUP
+	}
+	src, dst := d.prefix+name, to.prefix+newName
+	if _, err := d.fsys.bucket.Stat(ctx, src); errors.Is(err, errNotFound) {
+		return syscall.EXDEV
+	} else if err != nil {
+		return errno("rename", err)
+	}
+	if err := d.fsys.bucket.Copy(ctx, src, dst); err != nil {
+		return errno("rename", err)
+	}
+	if err := d.fsys.bucket.Delete(ctx, src); err != nil {
+		return errno("rename", err)
+	}
+	if ch := d.GetChild(name); ch != nil {
+		if n, ok := ch.Operations().(*fileNode); ok {
+			n.mu.Lock()
+			n.key = dst
+			n.mu.Unlock()
+		}
+	}
+	return 0
+}
+
+type fileNode struct {
+	fs.Inode
+	fsys *fsys
+
+	mu    sync.Mutex
+	key   string
+	size  int64
+	mtime time.Time
+}
+
+var (
+	_ fs.NodeGetattrer = (*fileNode)(nil)
+	_ fs.NodeSetattrer = (*fileNode)(nil)
+	_ fs.NodeOpener    = (*fileNode)(nil)
+)
+
+func (n *fileNode) attr(out *fuse.Attr) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	out.Mode = n.fsys.mode(false)
+	out.Size = uint64(n.size)
+	out.SetTimes(nil, &n.mtime, &n.mtime)
+}
+
+func (n *fileNode) objectKey() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.key
+}
+
+func (n *fileNode) setSize(size int64) {
+	n.mu.Lock()
+	n.size, n.mtime = size, time.Now()
+	n.mu.Unlock()
+}
+
+func (n *fileNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if h, ok := f.(*writeHandle); ok {
+		return h.Getattr(ctx, out)
+	}
+	n.attr(&out.Attr)
+	return 0
+}
+
+// Setattr truncates; modes, owners and times are not kept.
+func (n *fileNode) Setattr(ctx context.Context, f fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	size, ok := in.GetSize()
+	if !ok {
+		return n.Getattr(ctx, f, out)
+	}
+	if n.fsys.readOnly {
+		return syscall.EROFS
+	}
+	h, isWrite := f.(*writeHandle)
+	if !isWrite {
+		var err error
+		if h, err = n.spool(ctx, size == 0); err != nil {
+			return errno("truncate", err)
+		}
+		defer h.Release(ctx)
+	}
+	if err := h.truncate(int64(size)); err != 0 {
+		return err
+	}
+	if !isWrite {
+		if err := h.Flush(ctx); err != 0 {
+			return err
+		}
+	}
+	return n.Getattr(ctx, h, out)
+}
+
+func (n *fileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&syscall.O_ACCMODE == syscall.O_RDONLY {
+		return &readHandle{node: n}, 0, 0
+	}
+	if n.fsys.readOnly {
+		return nil, 0, syscall.EROFS
+	}
+	h, err := n.spool(ctx, flags&syscall.O_TRUNC != 0)
+	if err != nil {
+		return nil, 0, errno("open", err)
+	}
+	return h, 0, 0
+}
+
+// spool copies the object to a local file for writing, or starts the file
+// empty if truncate is set.
+func (n *fileNode) spool(ctx context.Context, truncate bool) (*writeHandle, error) {
+	f, err := os.CreateTemp(n.fsys.spool, "write-*")
+	if err != nil {
+		return nil, err
+	}
+	h := &writeHandle{node: n, f: f}
+	if truncate {
+		h.dirty = true
+		return h, nil
+	}
+	body, err := n.fsys.bucket.Get(ctx, n.objectKey())
+	if errors.Is(err, errNotFound) {
+		return h, nil
+	}
+	if err == nil {
+		_, err = io.Copy(f, body)
+		body.Close()
+	}
+	if err != nil {
+		h.Release(ctx)
+		return nil, err
+	}
+	return h, nil
+}
+
+// readHandle reads a file with ranged GETs of at least readAhead bytes,
+// and keeps the last one for the reads that follow.
+type readHandle struct {
+	node *fileNode
+
+	mu  sync.Mutex
+	off int64
+	buf []byte
+}
+
+var _ fs.FileReader = (*readHandle)(nil)
+
+func (h *readHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	end := off + int64(len(dest))
+	if off < h.off || end > h.off+int64(len(h.buf)) {
+		buf := make([]byte, max(len(dest), readAhead))
+		n, err := h.node.fsys.bucket.ReadAt(ctx, h.node.objectKey(), buf, off)
+		if err != nil {
+			return nil, errno("read", err)
+		}
+		h.off, h.buf = off, buf[:n]
+	}
+	start := off - h.off
+	return fuse.ReadResultData(h.buf[start:min(end-h.off, int64(len(h.buf)))]), 0
+}
+
+// writeHandle is a file open for writing, spooled to a local file.
+type writeHandle struct {
+	node *fileNode
+
+	mu    sync.Mutex
+	f     *os.File
+	dirty bool
+}
+
+var (
+	_ fs.FileReader    = (*writeHandle)(nil)
+	_ fs.FileWriter    = (*writeHandle)(nil)
+	_ fs.FileGetattrer = (*writeHandle)(nil)
+	_ fs.FileFlusher   = (*writeHandle)(nil)
+	_ fs.FileFsyncer   = (*writeHandle)(nil)
+	_ fs.FileReleaser  = (*writeHandle)(nil)
+)
+
+func (h *writeHandle) Read(_ context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n, err := h.f.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, errno("read", err)
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (h *writeHandle) Write(_ context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n, err := h.f.WriteAt(data, off)
+	h.dirty = true
+	if err != nil {
+		return uint32(n), errno("write", err)
+	}
+	return uint32(n), 0
+}
+
+func (h *writeHandle) Getattr(_ context.Context, out *fuse.AttrOut) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st, err := h.f.Stat()
+	if err != nil {
+		return errno("getattr", err)
+	}
+	h.node.attr(&out.Attr)
+	out.Size = uint64(st.Size())
+	return 0
+}
+
+func (h *writeHandle) truncate(size int64) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.f.Truncate(size); err != nil {
+		return errno("truncate", err)
+	}
+	h.dirty = true
+	return 0
+}
+
+// Flush stores the file if it changed since it was opened or last stored.
+func (h *writeHandle) Flush(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.dirty {
+		return 0
+	}
+	st, err := h.f.Stat()
+	if err != nil {
+		return errno("flush", err)
+	}
+	if err := h.node.fsys.bucket.Put(ctx, h.node.objectKey(), io.NewSectionReader(h.f, 0, st.Size()), st.Size()); err != nil {
+		return errno("flush", err)
+	}
+	h.dirty = false
+	h.node.setSize(st.Size())
+	return 0
+}
+
+func (h *writeHandle) Fsync(ctx context.Context, _ uint32) syscall.Errno {
+	return h.Flush(ctx)
+}
+
+func (h *writeHandle) Release(context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_ = h.f.Close()
+	_ = os.Remove(h.f.Name())
+	return 0
+}
@@ -0,0 +1,202 @@
+// Package erasure implements systematic Reed-Solomon coding over GF(2^8).
+// A Coder turns k data shards into m parity shards, and any k of the k+m
+// shards are enough to recover the others. The parity rows form a Cauchy
+// matrix, so every k×k submatrix of the encoding matrix is invertible.
+package erasure
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTooFewShards = errors.New("erasure: too few shards to reconstruct")
+	ErrShardSize    = errors.New("erasure: shards differ in size")
+)
+
+var (
+	expTable [510]byte
+	logTable [256]byte
+	mulTable [256][256]byte
+)
+
+func init() {
+	// Generator 2 with the primitive polynomial x^8+x^4+x^3+x^2+1.
+	x := 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			mulTable[a][b] = expTable[int(logTable[a])+int(logTable[b])]
+		}
+	}
+}
+
+func inv(a byte) byte { return expTable[255-int(logTable[a])] }
+
+type Coder struct {
+	data, parity int
+	// matrix has data+parity rows of data columns; the first data rows are
+	// the identity.
+	matrix [][]byte
+}
+
+func New(data, parity int) (*Coder, error) {
+	if data < 1 || parity < 0 || data+parity > 256 {
+		return nil, fmt.Errorf("erasure: invalid layout %d+%d", data, parity)
+	}
+	c := &Coder{data: data, parity: parity, matrix: make([][]byte, data+parity)}
+	for r := range c.matrix {
+		c.matrix[r] = make([]byte, data)
+		if r < data {
+			c.matrix[r][r] = 1
+			continue
+		}
+		for col := 0; col < data; col++ {
+			// x = r and y = col are distinct, so x^y is never zero.
+			c.matrix[r][col] = inv(byte(r) ^ byte(col))
+		}
+	}
+	return c, nil
+}
+
+func (c *Coder) DataShards() int   { return c.data }
+func (c *Coder) ParityShards() int { return c.parity }
+
+// Encode computes the parity shards from the data shards. shards holds
+// data+parity slices of equal length; the parity slices are overwritten.
+func (c *Coder) Encode(shards [][]byte) error {
+	if len(shards) != c.data+c.parity {
+		return fmt.Errorf("erasure: want %d shards, got %d", c.data+c.parity, len(shards))
+	}
+	size := len(shards[0])
+	for _, s := range shards {
+		if len(s) != size {
+			return ErrShardSize
+		}
+	}
+	for r := c.data; r < c.data+c.parity; r++ {
+		c.combine(shards[r], c.matrix[r], shards[:c.data])
+	}
+	return nil
+}
+
+// combine sets out to the linear combination of in with coefficients coef.
+func (c *Coder) combine(out []byte, coef []byte, in [][]byte) {
+	for i := range out {
+		out[i] = 0
+	}
+	for j, src := range in {
+		row := &mulTable[coef[j]]
+		for i, b := range src {
+			out[i] ^= row[b]
+		}
+	}
+}
+
+// Reconstruct fills in the nil entries of shards from the others. At least
+// data shards must be present.
+func (c *Coder) Reconstruct(shards [][]byte) error {
+	if len(shards) != c.data+c.parity {
+		return fmt.Errorf("erasure: want %d shards, got %d", c.data+c.parity, len(shards))
+	}
+	size := -1
+	var rows []int
+	for i, s := range shards {
+		if s == nil {
+			continue
+		}
+		if size >= 0 && len(s) != size {
+			return ErrShardSize
+		}
+		size = len(s)
+		if len(rows) < c.data {
+			rows = append(rows, i)
+		}
+	}
+	if len(rows) < c.data {
+		return ErrTooFewShards
+	}
+	missingData := false
+	for i := 0; i < c.data; i++ {
+		if shards[i] == nil {
+			missingData = true
+			break
+		}
+	}
+	if missingData {
+		sub := make([][]byte, c.data)
+		in := make([][]byte, c.data)
+		for i, r := range rows {
+			sub[i] = append([]byte(nil), c.matrix[r]...)
+			in[i] = shards[r]
+		}
+		decode, err := invert(sub)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < c.data; i++ {
+			if shards[i] == nil {
+				shards[i] = make([]byte, size)
+				c.combine(shards[i], decode[i], in)
+			}
+		}
+	}
+	for r := c.data; r < c.data+c.parity; r++ {
+		if shards[r] == nil {
+			shards[r] = make([]byte, size)
+			c.combine(shards[r], c.matrix[r], shards[:c.data])
+		}
+	}
+	return nil
+}
+
+// invert returns the inverse of the square matrix m by Gauss-Jordan
+// elimination; m is destroyed.
+func invert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	out := make([][]byte, n)
+	for i := range out {
+		out[i] = make([]byte, n)
+		out[i][i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for r := col; r < n; r++ {
+			if m[r][col] != 0 {
+				pivot = r
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, errors.New("erasure: singular matrix")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		out[col], out[pivot] = out[pivot], out[col]
+		if f := m[col][col]; f != 1 {
+			row := &mulTable[inv(f)]
+			for j := 0; j < n; j++ {
+				m[col][j] = row[m[col][j]]
+				out[col][j] = row[out[col][j]]
+			}
+		}
+		for r := 0; r < n; r++ {
+			if r == col || m[r][col] == 0 {
+				continue
+			}
+			row := &mulTable[m[r][col]]
+			for j := 0; j < n; j++ {
+				m[r][j] ^= row[m[col][j]]
+				out[r][j] ^= row[out[col][j]]
+			}
+		}
+	}
+	return out, nil
+}
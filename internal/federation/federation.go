@@ -0,0 +1,266 @@
+// Package federation replicates selected buckets to the admin endpoint of
+// a remote cluster, for disaster recovery across Kubernetes clusters. The
+// leader walks each federated bucket's changes in sequence order and pushes
+// them one at a time over mutual TLS, so the remote copy is always a prefix
+// of the local history. Replication is asynchronous; how far each bucket
+// lags behind is reported in its status and in metrics.
+package federation
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/internal/objectd"
+	"github.com/mchenetz/entity/internal/outbound"
+)
+
+// SourceSeqHeader carries the sequence number of a pushed change in the
+// source cluster.
+const SourceSeqHeader = "X-ENTITY-Federation-Seq"
+
+type Config struct {
+	// RemoteURL is the admin endpoint of the remote cluster.
+	RemoteURL string
+	Token     string
+	CAFile    string
+	// CertFile and KeyFile hold the client certificate presented to the
+	// remote cluster.
+	CertFile string
+	KeyFile  string
+	Interval time.Duration
+}
+
+type BucketStatus struct {
+	Bucket    string    `json:"bucket"`
+	Cursor    uint64    `json:"cursor"`
+	LagSeq    uint64    `json:"lagSeq"`
+	LastSync  time.Time `json:"lastSync,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+type Status struct {
+	RemoteURL string         `json:"remoteURL"`
+	Buckets   []BucketStatus `json:"buckets"`
+}
+
+// Replicator pushes the changes of federated buckets to the remote cluster.
+// On a replicated cluster only the leader pushes, and it shares its progress
+// with its peers.
+type Replicator struct {
+	Store   *objectd.Store
+	Cluster *cluster.Cluster
+	cfg     Config
+	client  *http.Client
+
+	mu      sync.Mutex
+	buckets map[string]BucketStatus
+}
+
+func New(cfg Config, store *objectd.Store, c *cluster.Cluster) (*Replicator, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if _, err := url.Parse(cfg.RemoteURL); err != nil {
+		return nil, err
+	}
+	tr, err := outbound.NewTransport(cfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	return &Replicator{Store: store, Cluster: c, cfg: cfg, client: &http.Client{Transport: tr}, buckets: map[string]BucketStatus{}}, nil
+}
+
+func (r *Replicator) Status(ctx context.Context) Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := Status{RemoteURL: r.cfg.RemoteURL, Buckets: []BucketStatus{}}
+	for _, b := range r.Store.FederatedBuckets(ctx) {
+		st := r.buckets[b.Name]
+		st.Bucket, st.Cursor = b.Name, b.Cursor
+		out.Buckets = append(out.Buckets, st)
+	}
+	return out
+}
+
+// Run pushes changes every interval until ctx is cancelled.
+func (r *Replicator) Run(ctx context.Context) {
+	t := time.NewTicker(r.cfg.Interval)
+	defer t.Stop()
+	for {
+		if r.Cluster == nil || !r.Cluster.Enabled() || r.Cluster.IsLeader(ctx) {
+			for _, b := range r.Store.FederatedBuckets(ctx) {
+				err := r.syncBucket(ctx, b)
+				if err != nil {
+					log.Printf("federation of bucket %s to %s: %v", b.Name, r.cfg.RemoteURL, err)
+				}
+				r.setError(b.Name, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// syncBucket pushes the changes of a bucket until the remote copy has
+// caught up. A cursor behind the retained deletes starts a full copy, which
+// cannot remove objects deleted in the meantime.
+func (r *Replicator) syncBucket(ctx context.Context, b objectd.FederatedBucket) error {
+	if err := r.do(ctx, http.MethodPost, "/admin/federation/buckets/"+b.Name, nil, nil, 0); err != nil {
+		return err
+	}
+	cursor := b.Cursor
+	for {
+		feed, err := r.Store.BucketChangesSince(ctx, b.Name, cursor, 0)
+		if err != nil {
+			return err
+		}
+		if feed.Truncated {
+			log.Printf("federation of bucket %s fell behind the retained deletes; copying it in full", b.Name)
+			cursor = 0
+			continue
+		}
+		for _, ch := range feed.Changes {
+			if err := r.push(ctx, ch); err != nil {
+				r.setLag(b.Name, cursor, feed.Clock)
+				return err
+			}
+			cursor = ch.Seq
+		}
+		if err := r.saveCursor(ctx, b.Name, feed.Next); err != nil {
+			return err
+		}
+		cursor = feed.Next
+		r.setLag(b.Name, cursor, feed.Clock)
+		if !feed.More {
+			return nil
+		}
+	}
+}
+
+// push sends one change. Puts of objects that changed again since are
+// skipped; the newer change follows later in the feed.
+func (r *Replicator) push(ctx context.Context, ch objectd.ObjectChange) error {
+	path := "/admin/federation/objects/" + ch.Bucket + "/" + ch.Key
+	headers := map[string]string{SourceSeqHeader: strconv.FormatUint(ch.Seq, 10)}
+	if ch.Deleted {
+		return r.do(ctx, http.MethodDelete, path, headers, nil, 0)
+	}
+	if r.Cluster != nil {
+		if err := r.Cluster.FetchObject(ctx, r.Store, ch.Bucket, ch.Key); err != nil {
+			return err
+		}
+	}
+	m, body, err := r.Store.OpenStoredObject(ctx, ch.Bucket, ch.Key)
+	if errors.Is(err, objectd.ErrNotFound) {
+		return nil
+	}
+	if errors.Is(err, objectd.ErrObjectOffloaded) {
+		log.Printf("federation: skipping %s/%s, its body is only in the cold tier", ch.Bucket, ch.Key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if m.Seq != ch.Seq {
+		return nil
+	}
+	if m.IsArchived() {
+		headers["X-Amz-Storage-Class"] = m.StorageClass
+	}
+	if m.ContentType != "" {
+		headers[cluster.ContentTypeHeader] = m.ContentType
+	}
+	if !m.ExpiresAt.IsZero() {
+		headers[cluster.ExpiresHeader] = m.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	return r.do(ctx, http.MethodPut, path, headers, body, m.Size)
+}
+
+func (r *Replicator) do(ctx context.Context, method, path string, headers map[string]string, body io.Reader, size int64) error {
+	req, err := http.NewRequestWithContext(ctx, method, r.cfg.RemoteURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Authorization", "Bearer "+r.cfg.Token)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// saveCursor records the progress of a bucket here and on every peer.
+func (r *Replicator) saveCursor(ctx context.Context, bucket string, cursor uint64) error {
+	if err := r.Store.SetFederationCursor(ctx, bucket, cursor); err != nil {
+		return err
+	}
+	if r.Cluster == nil || !r.Cluster.Enabled() {
+		return nil
+	}
+	payload, _ := json.Marshal(map[string]uint64{"cursor": cursor})
+	return r.Cluster.Replicate(ctx, http.MethodPost, "/_cluster/replicate/buckets/"+bucket+"/federation", map[string]string{"Content-Type": "application/json"}, payload)
+}
+
+func (r *Replicator) setLag(bucket string, cursor, clock uint64) {
+	lag := uint64(0)
+	if clock > cursor {
+		lag = clock - cursor
+	}
+	r.mu.Lock()
+	st := r.buckets[bucket]
+	st.LagSeq = lag
+	if lag == 0 {
+		st.LastSync = time.Now().UTC()
+	}
+	r.buckets[bucket] = st
+	r.mu.Unlock()
+	labels := map[string]string{"bucket": bucket}
+	metrics.SetGauge("entity_federation_lag_seq", labels, float64(lag))
+	if lag == 0 {
+		metrics.SetGauge("entity_federation_last_sync_timestamp_seconds", labels, float64(time.Now().Unix()))
+	}
+}
+
+func (r *Replicator) setError(bucket string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.buckets[bucket]
+	st.LastError = ""
+	if err != nil {
+		st.LastError = err.Error()
+	}
+	r.buckets[bucket] = st
+}
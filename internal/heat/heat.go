@@ -0,0 +1,185 @@
+package heat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	sketchDepth = 4
+	sketchWidth = 4096
+)
+
+type Entry struct {
+	Bucket     string    `json:"bucket"`
+	Key        string    `json:"key"`
+	Count      uint32    `json:"count"`
+	LastAccess time.Time `json:"lastAccess"`
+}
+
+// Tracker estimates object access frequency with a count-min sketch and keeps
+// a bounded set of the hottest keys. Counts decay periodically so the ranking
+// reflects recent traffic.
+type Tracker struct {
+	mu       sync.Mutex
+	sketch   [sketchDepth][sketchWidth]uint32
+	top      map[string]*Entry
+	capacity int
+}
+
+func New(capacity int) *Tracker {
+	if capacity <= 0 {
+		capacity = 128
+	}
+	return &Tracker{top: map[string]*Entry{}, capacity: capacity}
+}
+
+func (t *Tracker) Record(bucket, key string) {
+	id := bucket + "/" + key
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	est := t.addLocked(id, 1)
+	now := time.Now().UTC()
+	if e, ok := t.top[id]; ok {
+		e.Count = est
+		e.LastAccess = now
+		return
+	}
+	if len(t.top) >= t.capacity {
+		minID, minCount := "", uint32(0)
+		for k, e := range t.top {
+			if minID == "" || e.Count < minCount {
+				minID, minCount = k, e.Count
+			}
+		}
+		if est <= minCount {
+			return
+		}
+		delete(t.top, minID)
+	}
+	t.top[id] = &Entry{Bucket: bucket, Key: key, Count: est, LastAccess: now}
+}
+
+// Forget drops the key from the ranking, for objects that were deleted or
+// moved, so that it is neither listed nor prewarmed.
+func (t *Tracker) Forget(bucket, key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.top, bucket+"/"+key)
+}
+
+func (t *Tracker) Hot(limit int) []Entry {
+	t.mu.Lock()
+	out := make([]Entry, 0, len(t.top))
+	for _, e := range t.top {
+		out = append(out, *e)
+	}
+	t.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count == out[j].Count {
+			return out[i].LastAccess.After(out[j].LastAccess)
+		}
+		return out[i].Count > out[j].Count
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// Decay halves every counter so old traffic ages out of the ranking.
+func (t *Tracker) Decay() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for d := range t.sketch {
+		for w := range t.sketch[d] {
+			t.sketch[d][w] >>= 1
+		}
+	}
+	for id, e := range t.top {
+		e.Count >>= 1
+		if e.Count == 0 {
+			delete(t.top, id)
+		}
+	}
+}
+
+// Run decays counters and saves heat data to path on every interval until ctx
+// is cancelled.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration, path string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = t.Save(path)
+			t.Decay()
+		}
+	}
+}
+
+func (t *Tracker) Save(path string) error {
+	b, err := json.Marshal(t.Hot(0))
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load seeds the tracker with heat data saved by a previous run.
+func (t *Tracker) Load(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range entries {
+		if len(t.top) >= t.capacity {
+			break
+		}
+		id := e.Bucket + "/" + e.Key
+		t.addLocked(id, e.Count)
+		entry := e
+		t.top[id] = &entry
+	}
+	return nil
+}
+
+func (t *Tracker) addLocked(id string, n uint32) uint32 {
+	est := uint32(0)
+	for d := 0; d < sketchDepth; d++ {
+		i := index(id, d)
+		t.sketch[d][i] += n
+		if d == 0 || t.sketch[d][i] < est {
+			est = t.sketch[d][i]
+		}
+	}
+	return est
+}
+
+func index(id string, seed int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte{byte(seed)})
+	_, _ = h.Write([]byte(id))
+	return int(h.Sum64() % sketchWidth)
+}
@@ -0,0 +1,126 @@
+// Package kv is the record store objectd keeps its metadata in. The default
+// DB is a bbolt database, so a write costs the records it changes rather than
+// the size of the database, and every batch is a single durable transaction.
+package kv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	opPut    = 1
+	opDelete = 2
+)
+
+// recordsBucket is the bbolt bucket holding every record.
+var recordsBucket = []byte("records")
+
+// ErrLocked is returned by Open when another process has the database open.
+var ErrLocked = errors.New("kv: database is in use by another process")
+
+// DB keeps records in a single bbolt bucket.
+type DB struct {
+	db *bolt.DB
+}
+
+// Batch collects puts and deletes that are written atomically by Update.
+type Batch struct {
+	ops []op
+}
+
+type op struct {
+	kind  byte
+	key   string
+	value []byte
+}
+
+// Put stores value under key. The database keeps value, so the caller must
+// not modify it afterwards.
+func (b *Batch) Put(key string, value []byte) {
+	b.ops = append(b.ops, op{kind: opPut, key: key, value: value})
+}
+
+func (b *Batch) Delete(key string) {
+	b.ops = append(b.ops, op{kind: opDelete, key: key})
+}
+
+func (b *Batch) Len() int { return len(b.ops) }
+
+// Open opens or creates the database at path. It fails with ErrLocked rather
+// than waiting when another process holds the database.
+func Open(path string) (*DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%w: %s", ErrLocked, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(recordsBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return &DB{db: db}, nil
+}
+
+// Get returns a copy of the value stored under key.
+func (d *DB) Get(key string) ([]byte, bool) {
+	var out []byte
+	_ = d.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(recordsBucket).Get([]byte(key)); v != nil {
+			out = append([]byte{}, v...)
+		}
+		return nil
+	})
+	return out, out != nil
+}
+
+// ForEach calls fn for every key with the given prefix in key order, inside
+// one read transaction. The value must not be modified or retained.
+func (d *DB) ForEach(prefix string, fn func(key string, value []byte) error) error {
+	p := []byte(prefix)
+	return d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(recordsBucket).Cursor()
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			if err := fn(string(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Update writes the batch in one transaction: after a crash either all or
+// none of its operations are visible.
+func (d *DB) Update(b *Batch) error {
+	if b.Len() == 0 {
+		return nil
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		records := tx.Bucket(recordsBucket)
+		for _, o := range b.ops {
+			var err error
+			switch o.kind {
+			case opPut:
+				err = records.Put([]byte(o.key), o.value)
+			case opDelete:
+				err = records.Delete([]byte(o.key))
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", o.key, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (d *DB) Close() error { return d.db.Close() }
@@ -0,0 +1,152 @@
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openTestDB(t *testing.T, path string) *DB {
+	t.Helper()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func keys(t *testing.T, db Backend, prefix string) string {
+	t.Helper()
+	var out []string
+	err := db.ForEach(prefix, func(k string, v []byte) error {
+		out = append(out, k+"="+string(v))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestUpdateAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.db")
+	db := openTestDB(t, path)
+	var b Batch
+	b.Put("object/b/2", []byte("two"))
+	b.Put("object/b/1", []byte("one"))
+	b.Put("bucket/b", []byte("bucket"))
+	b.Put("object/c/1", []byte("other"))
+	if err := db.Update(&b); err != nil {
+		t.Fatal(err)
+	}
+	b = Batch{}
+	b.Delete("object/b/2")
+	b.Put("object/b/3", []byte("three"))
+	if err := db.Update(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := "object/b/1=one,object/b/3=three"
+	if got := keys(t, db, "object/b/"); got != want {
+		t.Fatalf("ForEach returned %s, want %s", got, want)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, path)
+	defer db.Close()
+	if got := keys(t, db, "object/b/"); got != want {
+		t.Fatalf("after reopening, ForEach returned %s, want %s", got, want)
+	}
+	if v, ok := db.Get("bucket/b"); !ok || string(v) != "bucket" {
+		t.Fatalf("Get returned %q, %v", v, ok)
+	}
+	if _, ok := db.Get("object/b/2"); ok {
+		t.Fatal("deleted key is still present")
+	}
+}
+
+func TestUpdateIsAtomic(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "metadata.db"))
+	defer db.Close()
+	var b Batch
+	b.Put("a", []byte("1"))
+	if err := db.Update(&b); err != nil {
+		t.Fatal(err)
+	}
+	// bbolt refuses the empty key, which fails the whole batch.
+	b = Batch{}
+	b.Delete("a")
+	b.Put("b", []byte("2"))
+	b.Put("", []byte("bad"))
+	if err := db.Update(&b); err == nil {
+		t.Fatal("batch with an empty key succeeded")
+	}
+	if got := keys(t, db, ""); got != "a=1" {
+		t.Fatalf("failed batch was partly applied: %s", got)
+	}
+}
+
+func TestGetReturnsCopy(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "metadata.db"))
+	defer db.Close()
+	var b Batch
+	b.Put("k", []byte("value"))
+	if err := db.Update(&b); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := db.Get("k")
+	v[0] = 'X'
+	if v, _ := db.Get("k"); string(v) != "value" {
+		t.Fatalf("modifying a returned value changed the record to %q", v)
+	}
+}
+
+func TestForEachStops(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "metadata.db"))
+	defer db.Close()
+	var b Batch
+	for i := 0; i < 10; i++ {
+		b.Put(fmt.Sprintf("k/%02d", i), []byte("v"))
+	}
+	if err := db.Update(&b); err != nil {
+		t.Fatal(err)
+	}
+	stop := errors.New("stop")
+	n := 0
+	err := db.ForEach("k/", func(string, []byte) error {
+		if n++; n == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || n != 3 {
+		t.Fatalf("ForEach returned %v after %d keys", err, n)
+	}
+}
+
+func TestOpenLocked(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the lock timeout")
+	}
+	path := filepath.Join(t.TempDir(), "metadata.db")
+	db := openTestDB(t, path)
+	defer db.Close()
+	if _, err := Open(path); !errors.Is(err, ErrLocked) {
+		t.Fatalf("opening a database in use: got %v, want ErrLocked", err)
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	for prefix, want := range map[string]string{
+		"object/": "object0",
+		"a\xff":   "b",
+		"\xff":    "",
+	} {
+		if got, _ := prefixEnd(prefix); got != want {
+			t.Errorf("prefixEnd(%q) = %q, want %q", prefix, got, want)
+		}
+	}
+}
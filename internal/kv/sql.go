@@ -0,0 +1,129 @@
+package kv
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Backend is the record store objectd keeps its metadata in. DB and SQLDB
+// both implement it.
+type Backend interface {
+	Get(key string) ([]byte, bool)
+	ForEach(prefix string, fn func(key string, value []byte) error) error
+	Update(b *Batch) error
+	Close() error
+}
+
+// sqliteDriver is registered by modernc.org/sqlite, which is only linked in
+// with the sqlite build tag.
+const sqliteDriver = "sqlite"
+
+// SQLDB keeps records in a single SQL table, which makes the metadata
+// queryable with ordinary SQL tools. The database/sql driver has to be linked
+// into the binary; see sqlite.go.
+type SQLDB struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens or creates the SQLite database at path.
+func OpenSQLite(path string) (*SQLDB, error) {
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite metadata (is objectd built with -tags sqlite?): %w", err)
+	}
+	// A single connection serializes writers, which SQLite requires anyway.
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{
+		`PRAGMA journal_mode=WAL`,
+		`PRAGMA synchronous=FULL`,
+		`CREATE TABLE IF NOT EXISTS records (key TEXT PRIMARY KEY, value BLOB NOT NULL)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	return &SQLDB{db: db}, nil
+}
+
+// Empty reports whether the database holds no records.
+func (d *SQLDB) Empty() (bool, error) {
+	var n int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM (SELECT 1 FROM records LIMIT 1)`).Scan(&n)
+	return n == 0, err
+}
+
+func (d *SQLDB) Get(key string) ([]byte, bool) {
+	var v []byte
+	if err := d.db.QueryRow(`SELECT value FROM records WHERE key = ?`, key).Scan(&v); err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+func (d *SQLDB) ForEach(prefix string, fn func(key string, value []byte) error) error {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if end, ok := prefixEnd(prefix); ok {
+		rows, err = d.db.Query(`SELECT key, value FROM records WHERE key >= ? AND key < ? ORDER BY key`, prefix, end)
+	} else {
+		rows, err = d.db.Query(`SELECT key, value FROM records WHERE key >= ? ORDER BY key`, prefix)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			k string
+			v []byte
+		)
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// prefixEnd returns the smallest key greater than every key with prefix.
+func prefixEnd(prefix string) (string, bool) {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1]), true
+		}
+	}
+	return "", false
+}
+
+func (d *SQLDB) Update(b *Batch) error {
+	if b.Len() == 0 {
+		return nil
+	}
+	tx, err := d.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, o := range b.ops {
+		switch o.kind {
+		case opPut:
+			_, err = tx.Exec(`INSERT INTO records (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value`, o.key, o.value)
+		case opDelete:
+			_, err = tx.Exec(`DELETE FROM records WHERE key = ?`, o.key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (d *SQLDB) Close() error { return d.db.Close() }
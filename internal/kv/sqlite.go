@@ -0,0 +1,6 @@
+//go:build sqlite
+
+package kv
+
+// The driver registers itself as sqliteDriver.
+import _ "modernc.org/sqlite"
@@ -0,0 +1,133 @@
+// Package logbuf keeps recent log output and errors in memory so they can be
+// read through the admin API when pod logs are not accessible.
+package logbuf
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Source  string    `json:"source,omitempty"`
+	Message string    `json:"message"`
+}
+
+// Buffer is an io.Writer for the standard logger. Every line becomes an entry
+// in a bounded ring; lines that look like failures are also kept in a
+// separate error ring so they are not pushed out by routine output.
+type Buffer struct {
+	mu      sync.Mutex
+	lines   []Entry
+	errors  []Entry
+	size    int
+	partial []byte
+	subs    map[chan Entry]struct{}
+}
+
+var Default = New(1000)
+
+func New(size int) *Buffer {
+	if size <= 0 {
+		size = 1000
+	}
+	return &Buffer{size: size, subs: map[chan Entry]struct{}{}}
+}
+
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.partial = append(b.partial, p...)
+	for {
+		i := bytes.IndexByte(b.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(b.partial[:i])
+		b.partial = b.partial[i+1:]
+		b.addLocked(Entry{Time: time.Now().UTC(), Level: levelOf(line), Message: line})
+	}
+	return len(p), nil
+}
+
+// RecordError adds an error that was reported to a client rather than logged,
+// such as a 5xx S3 response.
+func RecordError(source, msg string) { Default.RecordError(source, msg) }
+
+func (b *Buffer) RecordError(source, msg string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.addLocked(Entry{Time: time.Now().UTC(), Level: "error", Source: source, Message: msg})
+}
+
+func (b *Buffer) addLocked(e Entry) {
+	b.lines = appendRing(b.lines, e, b.size)
+	if e.Level == "error" {
+		b.errors = appendRing(b.errors, e, b.size)
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Tail returns the last n lines, oldest first.
+func (b *Buffer) Tail(n int) []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return last(b.lines, n)
+}
+
+// Errors returns the last n errors, oldest first.
+func (b *Buffer) Errors(n int) []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return last(b.errors, n)
+}
+
+// Subscribe delivers new entries until cancel is called. Entries are dropped
+// for subscribers that do not keep up.
+func (b *Buffer) Subscribe() (<-chan Entry, func()) {
+	ch := make(chan Entry, 256)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
+
+func appendRing(ring []Entry, e Entry, size int) []Entry {
+	ring = append(ring, e)
+	if len(ring) > size {
+		ring = append(ring[:0:0], ring[len(ring)-size:]...)
+	}
+	return ring
+}
+
+func last(ring []Entry, n int) []Entry {
+	if n <= 0 || n > len(ring) {
+		n = len(ring)
+	}
+	return append([]Entry(nil), ring[len(ring)-n:]...)
+}
+
+func levelOf(line string) string {
+	l := strings.ToLower(line)
+	for _, w := range []string{"error", "failed", "panic", "fatal"} {
+		if strings.Contains(l, w) {
+			return "error"
+		}
+	}
+	if strings.Contains(l, "warn") {
+		return "warning"
+	}
+	return "info"
+}
@@ -0,0 +1,228 @@
+package metering
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultRetention is how long hourly usage is kept.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// Counters is the traffic of a bucket or access key.
+type Counters struct {
+	Requests int64 `json:"requests"`
+	BytesIn  int64 `json:"bytesIn"`
+	BytesOut int64 `json:"bytesOut"`
+}
+
+func (c *Counters) add(o Counters) {
+	c.Requests += o.Requests
+	c.BytesIn += o.BytesIn
+	c.BytesOut += o.BytesOut
+}
+
+// BucketUsage is the traffic of a bucket with its stored bytes.
+// StorageBytes is the last sample in the window and StorageByteHours the
+// sum of the hourly samples, the usual basis for billing storage.
+type BucketUsage struct {
+	Counters
+	StorageBytes     int64 `json:"storageBytes"`
+	StorageByteHours int64 `json:"storageByteHours"`
+}
+
+// Report is the usage between From and To, rounded out to whole hours.
+type Report struct {
+	From       time.Time               `json:"from"`
+	To         time.Time               `json:"to"`
+	Buckets    map[string]*BucketUsage `json:"buckets"`
+	AccessKeys map[string]*Counters    `json:"accessKeys"`
+}
+
+// Merge adds the traffic of o, such as a peer's report for the same
+// window. Storage is not added, since every replica stores the same
+// buckets.
+func (r *Report) Merge(o Report) {
+	for name, u := range o.Buckets {
+		r.bucket(name).add(u.Counters)
+	}
+	for ak, c := range o.AccessKeys {
+		r.accessKey(ak).add(*c)
+	}
+}
+
+func (r *Report) bucket(name string) *BucketUsage {
+	u, ok := r.Buckets[name]
+	if !ok {
+		u = &BucketUsage{}
+		r.Buckets[name] = u
+	}
+	return u
+}
+
+func (r *Report) accessKey(ak string) *Counters {
+	c, ok := r.AccessKeys[ak]
+	if !ok {
+		c = &Counters{}
+		r.AccessKeys[ak] = c
+	}
+	return c
+}
+
+type hour struct {
+	Start      time.Time            `json:"start"`
+	Buckets    map[string]*Counters `json:"buckets,omitempty"`
+	AccessKeys map[string]*Counters `json:"accessKeys,omitempty"`
+	// Storage is the stored bytes of each bucket, sampled during the hour.
+	Storage map[string]int64 `json:"storage,omitempty"`
+}
+
+// Meter counts the requests and bytes that clients send to and receive from
+// this replica, per bucket and access key, in hourly intervals.
+type Meter struct {
+	retention time.Duration
+
+	mu    sync.Mutex
+	hours []*hour
+}
+
+func New(retention time.Duration) *Meter {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &Meter{retention: retention}
+}
+
+// Record counts one request. Either bucket or accessKey may be empty.
+func (m *Meter) Record(bucket, accessKey string, bytesIn, bytesOut int64) {
+	c := Counters{Requests: 1, BytesIn: bytesIn, BytesOut: bytesOut}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.currentLocked(time.Now())
+	if bucket != "" {
+		counter(h.Buckets, bucket).add(c)
+	}
+	if accessKey != "" {
+		counter(h.AccessKeys, accessKey).add(c)
+	}
+}
+
+// SampleStorage records the stored bytes of every bucket for the current
+// hour.
+func (m *Meter) SampleStorage(bytes map[string]int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.currentLocked(time.Now())
+	h.Storage = bytes
+}
+
+func (m *Meter) currentLocked(now time.Time) *hour {
+	start := now.UTC().Truncate(time.Hour)
+	if n := len(m.hours); n > 0 && m.hours[n-1].Start.Equal(start) {
+		return m.hours[n-1]
+	}
+	h := &hour{Start: start, Buckets: map[string]*Counters{}, AccessKeys: map[string]*Counters{}}
+	m.hours = append(m.hours, h)
+	cutoff := start.Add(-m.retention)
+	i := 0
+	for i < len(m.hours) && m.hours[i].Start.Before(cutoff) {
+		i++
+	}
+	m.hours = m.hours[i:]
+	return h
+}
+
+// Report returns the usage of the hours that overlap [from, to).
+func (m *Meter) Report(from, to time.Time) Report {
+	from, to = from.UTC().Truncate(time.Hour), to.UTC()
+	out := Report{From: from, To: to, Buckets: map[string]*BucketUsage{}, AccessKeys: map[string]*Counters{}}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, h := range m.hours {
+		if h.Start.Before(from) || !h.Start.Before(to) {
+			continue
+		}
+		for name, c := range h.Buckets {
+			out.bucket(name).add(*c)
+		}
+		for ak, c := range h.AccessKeys {
+			out.accessKey(ak).add(*c)
+		}
+		for name, n := range h.Storage {
+			u := out.bucket(name)
+			u.StorageBytes = n
+			u.StorageByteHours += n
+		}
+	}
+	return out
+}
+
+func counter(m map[string]*Counters, name string) *Counters {
+	c, ok := m[name]
+	if !ok {
+		c = &Counters{}
+		m[name] = c
+	}
+	return c
+}
+
+// Run samples storage with sample and saves the meter to path on every
+// interval until ctx is cancelled.
+func (m *Meter) Run(ctx context.Context, interval time.Duration, path string, sample func() map[string]int64) {
+	m.SampleStorage(sample())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.SampleStorage(sample())
+			_ = m.Save(path)
+		}
+	}
+}
+
+func (m *Meter) Save(path string) error {
+	m.mu.Lock()
+	b, err := json.Marshal(m.hours)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load restores the usage saved by a previous run.
+func (m *Meter) Load(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var hours []*hour
+	if err := json.Unmarshal(b, &hours); err != nil {
+		return err
+	}
+	for _, h := range hours {
+		if h.Buckets == nil {
+			h.Buckets = map[string]*Counters{}
+		}
+		if h.AccessKeys == nil {
+			h.AccessKeys = map[string]*Counters{}
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hours = hours
+	return nil
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry holds gauges and counters and renders them in the Prometheus text
+// exposition format.
+type Registry struct {
+	mu     sync.Mutex
+	values map[string]float64
+	types  map[string]string
+}
+
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{values: map[string]float64{}, types: map[string]string{}}
+}
+
+func SetGauge(name string, labels map[string]string, v float64) {
+	Default.SetGauge(name, labels, v)
+}
+
+func AddCounter(name string, labels map[string]string, v float64) {
+	Default.AddCounter(name, labels, v)
+}
+
+func DeleteGauge(name string) {
+	Default.DeleteGauge(name)
+}
+
+func (r *Registry) SetGauge(name string, labels map[string]string, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[name] = "gauge"
+	r.values[series(name, labels)] = v
+}
+
+// DeleteGauge drops every series of the gauge name.
+func (r *Registry) DeleteGauge(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k := range r.values {
+		if k == name || strings.HasPrefix(k, name+"{") {
+			delete(r.values, k)
+		}
+	}
+	delete(r.types, name)
+}
+
+func (r *Registry) AddCounter(name string, labels map[string]string, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[name] = "counter"
+	r.values[series(name, labels)] += v
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.mu.Lock()
+	keys := make([]string, 0, len(r.values))
+	for k := range r.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	typed := map[string]bool{}
+	for _, k := range keys {
+		name := k
+		if i := strings.IndexByte(k, '{'); i >= 0 {
+			name = k[:i]
+		}
+		if !typed[name] {
+			fmt.Fprintf(&b, "# TYPE %s %s\n", name, r.types[name])
+			typed[name] = true
+		}
+		fmt.Fprintf(&b, "%s %g\n", k, r.values[k])
+	}
+	r.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+func series(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	return name + "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,76 @@
+package objectd
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Access keys are stored with their bucket and deleted with it, leaving
+// tombstones so that a peer that missed the delete cannot hand them to a
+// new bucket of the same name. CollectDanglingAccess finds the keys that
+// were left behind anyway.
+
+// Reasons an access key is dangling.
+const (
+	// DanglingOrphaned is a record of a bucket that no longer exists. It
+	// does not resolve, but would come back with a bucket of that name.
+	DanglingOrphaned = "orphaned"
+	// DanglingDeleted is a key that resolves although it was deleted, as
+	// the keys of a deleted bucket could be before they were tombstoned.
+	DanglingDeleted = "deleted"
+)
+
+// DanglingAccess is an access key bound to a bucket it no longer belongs to.
+type DanglingAccess struct {
+	AccessKey string `json:"accessKey"`
+	Bucket    string `json:"bucket"`
+	Reason    string `json:"reason"`
+}
+
+// CollectDanglingAccess returns the dangling access keys of this replica
+// and removes them unless dryRun is set. Removed keys that still resolved
+// are returned with DanglingDeleted; the caller replicates their deletion.
+func (s *Store) CollectDanglingAccess(_ context.Context, dryRun bool) ([]DanglingAccess, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []DanglingAccess
+	err := s.db.ForEach(accessPrefix, func(k string, _ []byte) error {
+		bucket, ak, _ := splitRecordKey(strings.TrimPrefix(k, accessPrefix))
+		if _, ok := s.state.Buckets[bucket]; !ok {
+			out = append(out, DanglingAccess{AccessKey: ak, Bucket: bucket, Reason: DanglingOrphaned})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, b := range s.state.Buckets {
+		for ak := range b.Access {
+			if _, ok := s.state.DeletedAccess[ak]; ok {
+				out = append(out, DanglingAccess{AccessKey: ak, Bucket: name, Reason: DanglingDeleted})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AccessKey < out[j].AccessKey })
+	if dryRun || len(out) == 0 {
+		return out, nil
+	}
+	for _, d := range out {
+		if d.Reason == DanglingOrphaned {
+			s.queueDelete(accessRecordKey(d.Bucket, d.AccessKey))
+			continue
+		}
+		delete(s.state.Buckets[d.Bucket].Access, d.AccessKey)
+		s.markAccess(d.Bucket, d.AccessKey)
+	}
+	return out, s.persistLocked()
+}
+
+// accessDeleted reports whether accessKey was deleted here.
+func (s *Store) accessDeleted(accessKey string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.state.DeletedAccess[accessKey]
+	return ok
+}
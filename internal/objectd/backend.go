@@ -0,0 +1,205 @@
+package objectd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend stores object bodies. A body is named by the path its object
+// record holds, under the data directory; backends other than the local
+// filesystem treat that name as an opaque key. Bodies are written once and
+// then only read, renamed or deleted.
+//
+// Bodies are staged in a local file first, since their name depends on a
+// checksum of the content, so Put takes the staged file rather than a
+// stream. Erasure coding stripes bodies over local directories itself and
+// cannot be combined with another backend.
+type Backend interface {
+	// Put moves the complete, synced local file src into the backend as
+	// name, replacing any body of that name. src is gone once Put returns
+	// without error.
+	Put(name, src string) error
+	// Get opens name for reading. A missing body is ErrNotFound.
+	Get(name string) (io.ReadSeekCloser, error)
+	// Stat describes name. A missing body is ErrNotFound.
+	Stat(name string) (BlobInfo, error)
+	// Delete removes name. Deleting a missing body is not an error.
+	Delete(name string) error
+	// Rename moves name to newName, for setting bodies aside.
+	Rename(name, newName string) error
+	// List calls fn for every body under dir.
+	List(ctx context.Context, dir string, fn func(BlobInfo) error) error
+}
+
+type BlobInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// NewPosixBackend returns the default backend, which keeps every body in a
+// file of its own at the path it is named by.
+func NewPosixBackend() Backend { return posixBackend{} }
+
+type posixBackend struct{}
+
+func (posixBackend) Put(name, src string) error {
+	if src == name {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		return err
+	}
+	return os.Rename(src, name)
+}
+
+func (posixBackend) Get(name string) (io.ReadSeekCloser, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (posixBackend) Stat(name string) (BlobInfo, error) {
+	fi, err := os.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return BlobInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return BlobInfo{Name: name, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+func (posixBackend) Delete(name string) error {
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (posixBackend) Rename(name, newName string) error {
+	if err := os.MkdirAll(filepath.Dir(newName), 0o750); err != nil {
+		return err
+	}
+	return os.Rename(name, newName)
+}
+
+func (posixBackend) List(ctx context.Context, dir string, fn func(BlobInfo) error) error {
+	var fnErr error
+	err := walkFiles(ctx, dir, func(p string, fi fs.FileInfo) {
+		if fnErr == nil {
+			fnErr = fn(BlobInfo{Name: p, Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// NewMemoryBackend returns a backend that keeps bodies in memory, for tests
+// and throwaway stores. Its bodies do not survive a restart while the
+// metadata does, so a reopened store finds them missing.
+func NewMemoryBackend() Backend {
+	return &memoryBackend{blobs: map[string]memoryBlob{}}
+}
+
+type memoryBackend struct {
+	mu    sync.RWMutex
+	blobs map[string]memoryBlob
+}
+
+type memoryBlob struct {
+	data    []byte
+	modTime time.Time
+}
+
+type memoryReader struct{ *bytes.Reader }
+
+func (memoryReader) Close() error { return nil }
+
+func (m *memoryBackend) Put(name, src string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.blobs[name] = memoryBlob{data: data, modTime: time.Now()}
+	m.mu.Unlock()
+	return os.Remove(src)
+}
+
+func (m *memoryBackend) Get(name string) (io.ReadSeekCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.blobs[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return memoryReader{bytes.NewReader(b.data)}, nil
+}
+
+func (m *memoryBackend) Stat(name string) (BlobInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.blobs[name]
+	if !ok {
+		return BlobInfo{}, ErrNotFound
+	}
+	return BlobInfo{Name: name, Size: int64(len(b.data)), ModTime: b.modTime}, nil
+}
+
+func (m *memoryBackend) Delete(name string) error {
+	m.mu.Lock()
+	delete(m.blobs, name)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *memoryBackend) Rename(name, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.blobs[name]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.blobs, name)
+	m.blobs[newName] = b
+	return nil
+}
+
+func (m *memoryBackend) List(ctx context.Context, dir string, fn func(BlobInfo) error) error {
+	prefix := dir + string(filepath.Separator)
+	m.mu.RLock()
+	var out []BlobInfo
+	for name, b := range m.blobs {
+		if strings.HasPrefix(name, prefix) {
+			out = append(out, BlobInfo{Name: name, Size: int64(len(b.data)), ModTime: b.modTime})
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	for _, b := range out {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
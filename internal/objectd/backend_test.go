@@ -0,0 +1,234 @@
+package objectd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openMemoryStore(t *testing.T, opts StoreOptions) (*Store, Backend) {
+	t.Helper()
+	if opts.Backend == nil {
+		opts.Backend = NewMemoryBackend()
+	}
+	store, err := OpenStoreWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	if err := store.CreateBucket(context.Background(), "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	return store, opts.Backend
+}
+
+func readObject(t *testing.T, store *Store, bucket, key string) []byte {
+	t.Helper()
+	_, r, err := store.OpenObject(context.Background(), bucket, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// localFiles returns the regular files under dir, which a store on the
+// memory backend must not leave any bodies in.
+func localFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var out []string
+	err := walkFiles(context.Background(), dir, func(p string, _ os.FileInfo) { out = append(out, p) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestMemoryBackendObjects(t *testing.T) {
+	ctx := context.Background()
+	store, backend := openMemoryStore(t, StoreOptions{})
+	body := []byte("hello, memory backend")
+	m, err := store.PutObject(ctx, "bucket", "a", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readObject(t, store, "bucket", "a"); !bytes.Equal(got, body) {
+		t.Fatalf("read %q, want %q", got, body)
+	}
+	if _, err := backend.Stat(m.Path); err != nil {
+		t.Fatalf("body is not in the backend: %v", err)
+	}
+	if files := localFiles(t, filepath.Join(store.dataDir, "blobs")); len(files) > 0 {
+		t.Fatalf("bodies written to the data directory: %v", files)
+	}
+
+	// Range reads seek within the backend's reader.
+	_, r, err := store.OpenObject(ctx, "bucket", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(7, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	tail, _ := io.ReadAll(r)
+	r.Close()
+	if string(tail) != "memory backend" {
+		t.Fatalf("read %q after seeking, want %q", tail, "memory backend")
+	}
+
+	// Identical content shares one body until the last copy is gone.
+	if _, err := store.PutObject(ctx, "bucket", "b", bytes.NewReader(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.DeleteObject(ctx, "bucket", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Stat(m.Path); err != nil {
+		t.Fatalf("shared body removed with its first copy: %v", err)
+	}
+	if _, err := store.DeleteObject(ctx, "bucket", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Stat(m.Path); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("body of deleted objects: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryBackendChunks(t *testing.T) {
+	store, backend := openMemoryStore(t, StoreOptions{ChunkSize: 1024})
+	body := bytes.Repeat([]byte("0123456789"), 500)
+	m, err := store.PutObject(context.Background(), "bucket", "chunked", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	err = backend.List(context.Background(), m.Path, func(BlobInfo) error { n++; return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("body stored in %d chunks, want 5", n)
+	}
+	if got := readObject(t, store, "bucket", "chunked"); !bytes.Equal(got, body) {
+		t.Fatal("chunked body does not read back")
+	}
+}
+
+func TestMemoryBackendMultipart(t *testing.T) {
+	ctx := context.Background()
+	store, backend := openMemoryStore(t, StoreOptions{})
+	id, err := store.CreateMultipartUpload(ctx, "bucket", "big", PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := bytes.Repeat([]byte("p"), MinPartSize)
+	var parts []CompletedPart
+	for i, data := range [][]byte{first, []byte("end")} {
+		p, err := store.UploadPart(ctx, "bucket", "big", id, i+1, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, CompletedPart{Number: p.Number, ETag: p.ETag})
+	}
+	var stored []string
+	err = backend.List(ctx, store.uploadDir(id), func(b BlobInfo) error { stored = append(stored, b.Name); return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("backend holds parts %v, want 2", stored)
+	}
+	if files := localFiles(t, filepath.Join(store.dataDir, "uploads")); len(files) > 0 {
+		t.Fatalf("parts written to the data directory: %v", files)
+	}
+	if _, _, err := store.CompleteMultipartUpload(ctx, "bucket", "big", id, parts); err != nil {
+		t.Fatal(err)
+	}
+	if got := readObject(t, store, "bucket", "big"); !bytes.Equal(got, append(first, "end"...)) {
+		t.Fatal("assembled object does not read back")
+	}
+	for _, name := range stored {
+		if _, err := backend.Stat(name); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("part %s left after completion: %v", name, err)
+		}
+	}
+}
+
+func TestMemoryBackendGarbageCollection(t *testing.T) {
+	ctx := context.Background()
+	store, backend := openMemoryStore(t, StoreOptions{})
+	if _, err := store.PutObject(ctx, "bucket", "kept", bytes.NewReader([]byte("kept"))); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		filepath.Join(store.dataDir, "blobs", "ab", "orphan"),
+		filepath.Join(store.uploadDir("gone"), "00001-part"),
+	} {
+		src := filepath.Join(t.TempDir(), "orphan")
+		if err := os.WriteFile(src, []byte("orphan"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := backend.Put(name, src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	report, err := store.CollectGarbage(ctx, GCOptions{MinAge: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Removed != 2 {
+		t.Fatalf("removed %d orphans, want 2: %+v", report.Removed, report)
+	}
+	if got := readObject(t, store, "bucket", "kept"); string(got) != "kept" {
+		t.Fatalf("live object reads %q after collection", got)
+	}
+}
+
+func TestMemoryBackendReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	backend := NewMemoryBackend()
+	store, err := OpenStoreWithOptions(dir, StoreOptions{Backend: backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateBucket(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.PutObject(ctx, "bucket", "k", bytes.NewReader([]byte("survives"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store, err = OpenStoreWithOptions(dir, StoreOptions{Backend: backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if got := readObject(t, store, "bucket", "k"); string(got) != "survives" {
+		t.Fatalf("read %q after reopening", got)
+	}
+}
+
+func TestBackendExcludesErasure(t *testing.T) {
+	_, err := OpenStoreWithOptions(t.TempDir(), StoreOptions{
+		Backend:             NewMemoryBackend(),
+		ErasureDirs:         []string{t.TempDir(), t.TempDir(), t.TempDir()},
+		ErasureDataShards:   2,
+		ErasureParityShards: 1,
+	})
+	if err == nil {
+		t.Fatal("opened a store with both a backend and erasure coding")
+	}
+}
@@ -0,0 +1,151 @@
+package objectd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Unencrypted object bodies are stored once per content and codec under
+// blobs/<aa>/<sha256>[.<codec>], so identical uploads share a file. Object records
+// point at their body by path and the store counts the records per path in
+// memory; a body is removed once no persisted record refers to it. Bodies of
+// encrypted buckets are encrypted under a per-object IV and cannot be
+// shared between uploads, so they keep a file of their own under
+// objects/<bucket>/, as do objects written by earlier releases.
+
+// blobPath names the body of content sum stored with the given codec.
+func (s *Store) blobPath(sum, compression string) string {
+	name := sum
+	if compression != CompressionNone {
+		name += "." + compression
+	}
+	return filepath.Join(s.dataDir, "blobs", sum[:2], name)
+}
+
+// placeBlobLocked moves a fully written and synced plaintext body into the
+// content-addressed store and returns its final path and erasure layout. If
+// the content is already stored, the new copy is dropped.
+func (s *Store) placeBlobLocked(tmp, sum, compression string, size int64) (string, string, error) {
+	path := s.blobPath(sum, compression)
+	if s.erasure != nil {
+		if sz, n := s.erasure.available(path); sz == size && n >= s.erasure.coder.DataShards() {
+			_ = os.Remove(tmp)
+			return path, s.erasure.layout, nil
+		}
+	} else if bi, err := s.backend.Stat(path); err == nil && bi.Size == size {
+		_ = os.Remove(tmp)
+		return path, "", nil
+	}
+	layout, err := s.storeBodyLocked(tmp, path)
+	if err != nil {
+		return "", "", err
+	}
+	return path, layout, nil
+}
+
+func (s *Store) countRefsLocked() {
+	s.refs = map[string]int{}
+	for _, b := range s.state.Buckets {
+		for _, rec := range b.Objects {
+			s.retainLocked(rec.Path)
+		}
+		for _, t := range b.trash {
+			s.retainLocked(t.Object.Path)
+		}
+		for _, vs := range b.versions {
+			for _, v := range vs {
+				s.retainLocked(v.Object.Path)
+			}
+		}
+	}
+}
+
+func (s *Store) retainLocked(path string) {
+	if path != "" {
+		s.refs[path]++
+	}
+}
+
+// releaseLocked drops a reference to a body. The last reference schedules
+// the body for removal after the next successful persist.
+func (s *Store) releaseLocked(path string) {
+	if path == "" {
+		return
+	}
+	s.refs[path]--
+	if s.refs[path] <= 0 {
+		delete(s.refs, path)
+		s.obsolete = append(s.obsolete, path)
+	}
+}
+
+// CopyObject copies src to dst. The copy shares the source body, so only
+// metadata is written, unless a plaintext source is copied into an encrypted
+// bucket and has to be encrypted.
+func (s *Store) CopyObject(_ context.Context, srcBucket, srcKey, dstBucket, dstKey string, opts PutOptions) (ObjectMeta, error) {
+	if dstKey == "" {
+		return ObjectMeta{}, fmt.Errorf("empty key")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sb, ok := s.state.Buckets[srcBucket]
+	if !ok {
+		return ObjectMeta{}, ErrNotFound
+	}
+	src, ok := sb.Objects[srcKey]
+	if !ok {
+		return ObjectMeta{}, ErrNotFound
+	}
+	if src.Pending {
+		return ObjectMeta{}, ErrObjectPending
+	}
+	if src.offloaded() {
+		return ObjectMeta{}, ErrObjectOffloaded
+	}
+	db, ok := s.state.Buckets[dstBucket]
+	if !ok {
+		return ObjectMeta{}, ErrNotFound
+	}
+	storageClass := src.StorageClass
+	if opts.StorageClass != "" {
+		sc, err := normalizeStorageClass(opts.StorageClass)
+		if err != nil {
+			return ObjectMeta{}, err
+		}
+		storageClass = sc
+	}
+	if src.Encryption == "" && db.Encryption != nil {
+		f, err := s.openStoredLocked(src.meta(srcBucket, srcKey))
+		if err != nil {
+			return ObjectMeta{}, err
+		}
+		body, err := s.bodyReaderLocked(f, src.meta(srcBucket, srcKey))
+		if err != nil {
+			_ = f.Close()
+			return ObjectMeta{}, err
+		}
+		defer body.Close()
+		m, err := s.writeObjectLocked(dstBucket, dstKey, body, 0, PutOptions{StorageClass: storageClass, ContentType: src.ContentType, ExpiresAt: opts.ExpiresAt})
+		if err != nil {
+			return ObjectMeta{}, err
+		}
+		return m, s.persistLocked()
+	}
+	rec := src
+	rec.ModTime = time.Now().UTC().Format(time.RFC3339Nano)
+	rec.Seq = s.tickLocked()
+	rec.StorageClass = storageClass
+	rec.RestoreExpiry = ""
+	// A copy expires only if asked to.
+	rec.ExpiresAt = formatExpiry(opts.ExpiresAt)
+	// The copy is a local object of its own; the tier copy stays with src.
+	rec.Tier = ""
+	rec.Versioned = db.versioned(dstKey, rec.Seq)
+	if err := s.setObjectLocked(dstBucket, db, dstKey, rec); err != nil {
+		return ObjectMeta{}, err
+	}
+	return rec.meta(dstBucket, dstKey), s.persistLocked()
+}
@@ -0,0 +1,100 @@
+package objectd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrQuotaExceeded is returned by CheckQuota for a write that would take a
+// bucket past its quota.
+var ErrQuotaExceeded = errors.New("bucket quota exceeded")
+
+// BucketConfig is the configuration of a bucket that is set as a whole.
+type BucketConfig struct {
+	// Versioning is VersioningEnabled, VersioningSuspended or
+	// VersioningDisabled; empty leaves it as it is. A bucket that had
+	// versioning enabled cannot be disabled again, only suspended.
+	Versioning string `json:"versioning"`
+	// QuotaBytes caps the bytes the bucket stores; zero means no quota.
+	QuotaBytes int64 `json:"quotaBytes"`
+	// PublicRead lets anyone read the bucket's objects without credentials.
+	PublicRead bool `json:"publicRead"`
+	// Encryption is the default server-side encryption of new objects,
+	// SSEAlgorithmAES256 or empty.
+	Encryption string `json:"encryption"`
+}
+
+// GetBucketConfig returns the configuration of bucket.
+func (s *Store) GetBucketConfig(_ context.Context, bucket string) (BucketConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return BucketConfig{}, ErrNotFound
+	}
+	cfg := BucketConfig{Versioning: b.versioning(), QuotaBytes: b.QuotaBytes, PublicRead: b.PublicRead}
+	if b.Encryption != nil {
+		cfg.Encryption = b.Encryption.Algorithm
+	}
+	return cfg, nil
+}
+
+// PutBucketConfig replaces the configuration of bucket. Nothing changes if
+// any setting is invalid.
+func (s *Store) PutBucketConfig(_ context.Context, bucket string, cfg BucketConfig) error {
+	switch {
+	case cfg.Versioning != "" && cfg.Versioning != VersioningDisabled && cfg.Versioning != VersioningEnabled && cfg.Versioning != VersioningSuspended:
+		return fmt.Errorf("unknown versioning state %q", cfg.Versioning)
+	case cfg.QuotaBytes < 0:
+		return fmt.Errorf("quota must not be negative")
+	case cfg.Encryption != "" && cfg.Encryption != SSEAlgorithmAES256:
+		return fmt.Errorf("unsupported encryption algorithm %q", cfg.Encryption)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	if cfg.Versioning == VersioningDisabled && b.Versioning != "" {
+		return fmt.Errorf("versioning cannot be disabled once enabled; suspend it instead")
+	}
+	var enc *encryptionConfig
+	if cfg.Encryption != "" {
+		if s.masterKey == nil {
+			return ErrEncryptionNotConfigured
+		}
+		enc = &encryptionConfig{Algorithm: cfg.Encryption}
+	}
+	b.QuotaBytes, b.PublicRead, b.Encryption = cfg.QuotaBytes, cfg.PublicRead, enc
+	if cfg.Versioning != "" && cfg.Versioning != VersioningDisabled {
+		b.Versioning = cfg.Versioning
+	}
+	s.markBucket(bucket)
+	return s.persistLocked()
+}
+
+// CheckQuota returns ErrQuotaExceeded if storing size more bytes would
+// take bucket past its quota. Writes running at the same time are not
+// counted, so they can together overshoot it.
+func (s *Store) CheckQuota(bucket string, size int64) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok || b.QuotaBytes == 0 {
+		return nil
+	}
+	if b.usage.Bytes+b.versionBytes+max(size, 0) > b.QuotaBytes {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// BucketPublicRead reports whether anyone may read the objects of bucket.
+func (s *Store) BucketPublicRead(bucket string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	return ok && b.PublicRead
+}
@@ -0,0 +1,127 @@
+package objectd
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"sync"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// The store can keep the plaintext bodies of small objects it recently
+// served in memory, so repeated reads neither touch the disk nor decrypt and
+// decompress again. Metadata is always in memory already. Entries are
+// dropped when their object is overwritten or deleted, locally or by
+// replication, and are only served for the exact version they were read
+// from.
+
+// bodyCache is an LRU of object bodies bounded by their total size.
+type bodyCache struct {
+	mu        sync.Mutex
+	max       int64
+	maxObject int64
+	size      int64
+	order     *list.List
+	entries   map[string]*list.Element
+}
+
+type cacheEntry struct {
+	id   string
+	seq  uint64
+	etag string
+	data []byte
+}
+
+func newBodyCache(max, maxObject int64) *bodyCache {
+	if maxObject <= 0 || maxObject > max {
+		maxObject = max
+	}
+	return &bodyCache{max: max, maxObject: maxObject, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func cacheID(bucket, key string) string { return bucket + "\x00" + key }
+
+// cacheable reports whether the body of m fits the cache.
+func (c *bodyCache) cacheable(m ObjectMeta) bool {
+	return c != nil && m.Size <= c.maxObject
+}
+
+// get returns the cached body of m, if it is of the same version.
+func (c *bodyCache) get(m ObjectMeta) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[cacheID(m.Bucket, m.Key)]
+	if !ok {
+		metrics.AddCounter("entity_cache_misses_total", nil, 1)
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if e.seq != m.Seq || e.etag != m.ETag {
+		c.removeLocked(el)
+		metrics.AddCounter("entity_cache_misses_total", nil, 1)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	metrics.AddCounter("entity_cache_hits_total", nil, 1)
+	return e.data, true
+}
+
+func (c *bodyCache) put(m ObjectMeta, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := cacheID(m.Bucket, m.Key)
+	if el, ok := c.entries[id]; ok {
+		c.removeLocked(el)
+	}
+	c.entries[id] = c.order.PushFront(&cacheEntry{id: id, seq: m.Seq, etag: m.ETag, data: data})
+	c.size += int64(len(data))
+	for c.size > c.max {
+		c.removeLocked(c.order.Back())
+	}
+	metrics.SetGauge("entity_cache_bytes", nil, float64(c.size))
+}
+
+// forget drops the cached body of key.
+func (c *bodyCache) forget(bucket, key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[cacheID(bucket, key)]; ok {
+		c.removeLocked(el)
+		metrics.SetGauge("entity_cache_bytes", nil, float64(c.size))
+	}
+}
+
+func (c *bodyCache) removeLocked(el *list.Element) {
+	e := el.Value.(*cacheEntry)
+	c.order.Remove(el)
+	delete(c.entries, e.id)
+	c.size -= int64(len(e.data))
+}
+
+// openCachedLocked returns the plaintext body of m from the cache, reading
+// and caching it on a miss.
+func (s *Store) openCachedLocked(m ObjectMeta) (io.ReadSeekCloser, error) {
+	if data, ok := s.cache.get(m); ok {
+		return memoryReader{bytes.NewReader(data)}, nil
+	}
+	f, err := s.openStoredLocked(m)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.bodyReaderLocked(f, m)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	defer body.Close()
+	data := make([]byte, m.Size)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return nil, err
+	}
+	s.cache.put(m, data)
+	return memoryReader{bytes.NewReader(data)}, nil
+}
@@ -0,0 +1,184 @@
+package objectd
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// maxTombstones bounds how many object deletions are remembered for peers
+// and standby clusters, on top of the retention window. A standby that falls
+// further behind has to resync.
+const maxTombstones = 100000
+
+type tombstone struct {
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	Seq       uint64 `json:"seq"`
+	DeletedAt string `json:"deletedAt,omitempty"`
+}
+
+type standbyState struct {
+	Cursor   uint64 `json:"cursor,omitempty"`
+	Promoted bool   `json:"promoted,omitempty"`
+}
+
+// ChangeFeed is a page of the object changelog served to standby clusters.
+// Buckets and access keys are always sent in full.
+type ChangeFeed struct {
+	Clock     uint64         `json:"clock"`
+	Next      uint64         `json:"next"`
+	More      bool           `json:"more,omitempty"`
+	Truncated bool           `json:"truncated,omitempty"`
+	Buckets   []FeedBucket   `json:"buckets"`
+	Access    []AccessKey    `json:"access"`
+	Changes   []ObjectChange `json:"changes"`
+}
+
+type FeedBucket struct {
+	Name        string `json:"name"`
+	Encryption  string `json:"encryption,omitempty"`
+	RenamedFrom string `json:"renamedFrom,omitempty"`
+	QuotaBytes  int64  `json:"quotaBytes,omitempty"`
+	PublicRead  bool   `json:"publicRead,omitempty"`
+	Versioning  string `json:"versioning,omitempty"`
+}
+
+type ObjectChange struct {
+	Bucket       string `json:"bucket"`
+	Key          string `json:"key"`
+	Seq          uint64 `json:"seq"`
+	Deleted      bool   `json:"deleted,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	StorageClass string `json:"storageClass,omitempty"`
+	ContentType  string `json:"contentType,omitempty"`
+	ExpiresAt    string `json:"expiresAt,omitempty"`
+}
+
+func (s *Store) recordTombstoneLocked(bucket, key string, seq uint64) {
+	t := tombstone{Bucket: bucket, Key: key, Seq: seq, DeletedAt: time.Now().UTC().Format(time.RFC3339Nano)}
+	s.state.Tombstones = append(s.state.Tombstones, t)
+	s.queuePut(tombstoneRecordKey(t), t)
+	if n := len(s.state.Tombstones) - maxTombstones; n > 0 {
+		for _, old := range s.state.Tombstones[:n] {
+			s.queueDelete(tombstoneRecordKey(old))
+		}
+		s.state.TombstoneFloor = s.state.Tombstones[n-1].Seq
+		s.state.Tombstones = append([]tombstone(nil), s.state.Tombstones[n:]...)
+		s.markMeta()
+	}
+}
+
+// ChangesSince returns up to limit object puts and deletes with a sequence
+// number above since, oldest first. Truncated is set when deletions after
+// since are no longer retained.
+func (s *Store) ChangesSince(_ context.Context, since uint64, limit int) ChangeFeed {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	feed := ChangeFeed{Clock: s.state.Clock, Buckets: []FeedBucket{}, Access: []AccessKey{}, Changes: []ObjectChange{}}
+	if since < s.state.TombstoneFloor {
+		feed.Truncated = true
+		return feed
+	}
+	for name, b := range s.state.Buckets {
+		fb := FeedBucket{Name: name, RenamedFrom: b.RenamedFrom, QuotaBytes: b.QuotaBytes, PublicRead: b.PublicRead, Versioning: b.versioning()}
+		if b.Encryption != nil {
+			fb.Encryption = b.Encryption.Algorithm
+		}
+		feed.Buckets = append(feed.Buckets, fb)
+		for ak, rec := range b.Access {
+			feed.Access = append(feed.Access, rec.accessKey(ak, name))
+		}
+		for key, rec := range b.Objects {
+			if rec.Seq > since {
+				m := rec.meta(name, key)
+				feed.Changes = append(feed.Changes, ObjectChange{Bucket: name, Key: key, Seq: rec.Seq, ETag: rec.ETag, Size: rec.Size, StorageClass: m.StorageClass, ContentType: m.ContentType, ExpiresAt: rec.ExpiresAt})
+			}
+		}
+	}
+	for _, t := range s.state.Tombstones {
+		if t.Seq > since {
+			feed.Changes = append(feed.Changes, ObjectChange{Bucket: t.Bucket, Key: t.Key, Seq: t.Seq, Deleted: true})
+		}
+	}
+	sort.Slice(feed.Buckets, func(i, j int) bool { return feed.Buckets[i].Name < feed.Buckets[j].Name })
+	sort.Slice(feed.Access, func(i, j int) bool { return feed.Access[i].AccessKey < feed.Access[j].AccessKey })
+	sort.Slice(feed.Changes, func(i, j int) bool { return feed.Changes[i].Seq < feed.Changes[j].Seq })
+	feed.Next = feed.Clock
+	if len(feed.Changes) > limit {
+		feed.Changes = feed.Changes[:limit]
+		feed.More = true
+		feed.Next = feed.Changes[limit-1].Seq
+	}
+	return feed
+}
+
+func (s *Store) ListAccess(_ context.Context) []AccessKey {
+	used := s.AccessLastUsed()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []AccessKey{}
+	for name, b := range s.state.Buckets {
+		for ak, rec := range b.Access {
+			a := rec.accessKey(ak, name)
+			if u, ok := used[ak]; ok {
+				a.LastUsed = &u
+			}
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AccessKey < out[j].AccessKey })
+	return out
+}
+
+// SetStandby marks the store as an asynchronous replica of another cluster.
+// It has no effect once the store has been promoted.
+func (s *Store) SetStandby(standby bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.standby = standby && !s.state.Standby.Promoted
+}
+
+func (s *Store) Standby() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.standby
+}
+
+// Promote turns a standby into a primary permanently; the promotion survives
+// restarts even while the standby configuration is still present.
+func (s *Store) Promote(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.standby = false
+	if s.state.Standby.Promoted {
+		return nil
+	}
+	s.state.Standby.Promoted = true
+	s.markMeta()
+	return s.persistLocked()
+}
+
+func (s *Store) Promoted() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.Standby.Promoted
+}
+
+func (s *Store) StandbyCursor() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.Standby.Cursor
+}
+
+func (s *Store) SetStandbyCursor(_ context.Context, cursor uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Standby.Cursor = cursor
+	s.markMeta()
+	return s.persistLocked()
+}
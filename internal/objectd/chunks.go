@@ -0,0 +1,241 @@
+package objectd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Bodies with more stored bytes than the configured chunk size are split
+// into chunks of that size, each stored as a body of its own under a
+// directory named like the whole body would be, with a ".<chunk size>.chunks"
+// suffix. The record keeps the chunk map, the stored size and checksum of
+// every chunk, so a range is read from the chunks it covers and a damaged
+// chunk can be told apart from the rest. The directory is the unit of
+// reference counting and removal, like a plain body. Erasure coding stripes
+// bodies itself and is not combined with chunking.
+
+const chunkDirSuffix = ".chunks"
+
+type chunkRecord struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// chunkedBody reports whether body names a chunk directory.
+func chunkedBody(body string) bool { return strings.HasSuffix(body, chunkDirSuffix) }
+
+// chunkDir names the chunk directory of a body that would otherwise be
+// stored as body.
+func (s *Store) chunkDir(body string) string {
+	return fmt.Sprintf("%s.%d%s", body, s.chunkSize, chunkDirSuffix)
+}
+
+func chunkPath(dir string, i int) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d", i))
+}
+
+// storeChunksLocked splits the fully written and synced file tmp into chunks
+// under dir and returns the chunk map. Chunks that are already stored with
+// the same size are kept, which deduplicates identical bodies. tmp is
+// removed on success.
+func (s *Store) storeChunksLocked(tmp, dir string) ([]chunkRecord, error) {
+	src, err := os.Open(tmp)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	var chunks []chunkRecord
+	for i := 0; ; i++ {
+		c, part, err := s.stageChunk(src, filepath.Dir(tmp))
+		if err != nil {
+			return nil, err
+		}
+		if c.Size == 0 {
+			_ = os.Remove(part)
+			break
+		}
+		chunks = append(chunks, c)
+		name := chunkPath(dir, i)
+		if bi, err := s.backend.Stat(name); err == nil && bi.Size == c.Size {
+			_ = os.Remove(part)
+		} else if err := s.backend.Put(name, part); err != nil {
+			_ = os.Remove(part)
+			return nil, err
+		}
+		if c.Size < s.chunkSize {
+			break
+		}
+	}
+	_ = os.Remove(tmp)
+	return chunks, nil
+}
+
+// stageChunk copies the next chunk of src into a synced file in dir.
+func (s *Store) stageChunk(src io.Reader, dir string) (chunkRecord, string, error) {
+	f, err := os.CreateTemp(dir, "chunk-")
+	if err != nil {
+		return chunkRecord{}, "", err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(src, s.chunkSize))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return chunkRecord{}, "", err
+	}
+	return chunkRecord{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, f.Name(), nil
+}
+
+// chunksExist checks that every chunk of dir is stored in full.
+func (s *Store) chunksExist(dir string, chunks []chunkRecord) error {
+	for i, c := range chunks {
+		bi, err := s.backend.Stat(chunkPath(dir, i))
+		if err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+		if bi.Size != c.Size {
+			return fmt.Errorf("chunk %d: stored %d bytes, want %d", i, bi.Size, c.Size)
+		}
+	}
+	return nil
+}
+
+// verifyChunks compares every chunk of dir with its checksum and returns
+// an error naming the first damaged one.
+func (s *Store) verifyChunks(dir string, chunks []chunkRecord) error {
+	for i, c := range chunks {
+		f, err := s.backend.Get(chunkPath(dir, i))
+		if err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != c.SHA256 {
+			return fmt.Errorf("chunk %d: checksum %s, want %s", i, sum, c.SHA256)
+		}
+	}
+	return nil
+}
+
+// removeChunks removes the chunk directory dir and everything in it.
+func (s *Store) removeChunks(dir string) {
+	_ = s.backend.List(context.Background(), dir, func(b BlobInfo) error {
+		return s.backend.Delete(b.Name)
+	})
+	_ = s.backend.Delete(dir)
+}
+
+// chunkReader reads the stored bytes of a chunked body, opening one chunk
+// at a time.
+type chunkReader struct {
+	backend Backend
+	dir     string
+	chunks  []chunkRecord
+	size    int64
+
+	off int64
+	cur int
+	f   io.ReadSeekCloser
+}
+
+func newChunkReader(backend Backend, dir string, chunks []chunkRecord) *chunkReader {
+	r := &chunkReader{backend: backend, dir: dir, chunks: chunks, cur: -1}
+	for _, c := range chunks {
+		r.size += c.Size
+	}
+	return r
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for r.off < r.size {
+		i, start := r.locate(r.off)
+		if i != r.cur {
+			if err := r.open(i); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := r.f.Seek(r.off-start, io.SeekStart); err != nil {
+			return 0, err
+		}
+		n, err := r.f.Read(p)
+		r.off += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err == io.EOF {
+			return 0, fmt.Errorf("chunk %d of %s is short", i, r.dir)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return 0, io.EOF
+}
+
+// locate returns the chunk holding offset off and the offset it starts at.
+func (r *chunkReader) locate(off int64) (int, int64) {
+	var start int64
+	for i, c := range r.chunks {
+		if off < start+c.Size {
+			return i, start
+		}
+		start += c.Size
+	}
+	return len(r.chunks), start
+}
+
+func (r *chunkReader) open(i int) error {
+	if r.f != nil {
+		_ = r.f.Close()
+		r.f, r.cur = nil, -1
+	}
+	f, err := r.backend.Get(chunkPath(r.dir, i))
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("chunk %d of %s: %w", i, r.dir, err)
+	}
+	if err != nil {
+		return err
+	}
+	r.f, r.cur = f, i
+	return nil
+}
+
+func (r *chunkReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+func (r *chunkReader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Close()
+}
@@ -0,0 +1,48 @@
+package objectd
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// NormalizeCIDRs validates an allowlist and returns it in canonical form.
+// Bare addresses are accepted as single-host prefixes.
+func NormalizeCIDRs(in []string) ([]string, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	out := make([]string, 0, len(in))
+	for _, v := range in {
+		p, err := ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p.String())
+	}
+	return out, nil
+}
+
+func ParsePrefix(v string) (netip.Prefix, error) {
+	if p, err := netip.ParsePrefix(v); err == nil {
+		return p.Masked(), nil
+	}
+	a, err := netip.ParseAddr(v)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", v)
+	}
+	return netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen()), nil
+}
+
+// AllowsAddr reports whether addr may use the key.
+func (a AccessKey) AllowsAddr(addr netip.Addr) bool {
+	if len(a.AllowedCIDRs) == 0 {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, c := range a.AllowedCIDRs {
+		if p, err := netip.ParsePrefix(c); err == nil && p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package objectd
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Compression codecs for object bodies, selected with
+// StoreOptions.Compression. The codec is recorded per object, so changing
+// the setting only affects new writes.
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// DefaultCompressionSkipTypes lists content types that are compressed
+// already and are stored as they are.
+var DefaultCompressionSkipTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-xz",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/vnd.oci.image.layer.v1.tar+gzip",
+	"application/vnd.oci.image.layer.v1.tar+zstd",
+	"application/vnd.docker.image.rootfs.diff.tar.gzip",
+}
+
+type codec struct {
+	newWriter func(io.Writer) (io.WriteCloser, error)
+	newReader func(io.Reader) (io.ReadCloser, error)
+}
+
+// codecs holds the linked codecs; zstd registers itself when objectd is
+// built with the zstd tag.
+var codecs = map[string]codec{
+	CompressionGzip: {
+		newWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, gzip.BestSpeed) },
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	},
+}
+
+func checkCompression(name string) error {
+	if name == CompressionNone {
+		return nil
+	}
+	if _, ok := codecs[name]; !ok {
+		if name == CompressionZstd {
+			return fmt.Errorf("compression %q is not available (is objectd built with -tags zstd?)", name)
+		}
+		return fmt.Errorf("unknown compression %q", name)
+	}
+	return nil
+}
+
+// compressionFor returns the codec for a new body of the given content type.
+func (s *Store) compressionFor(contentType string) string {
+	if s.compression == CompressionNone {
+		return CompressionNone
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, skip := range s.compressionSkip {
+		if skip != "" && strings.HasPrefix(contentType, strings.ToLower(skip)) {
+			return CompressionNone
+		}
+	}
+	return s.compression
+}
+
+// decompressReader inflates a stored body. Seeking restarts decompression
+// and skips forward, which is slow but keeps range reads working.
+type decompressReader struct {
+	src    io.ReadSeekCloser
+	codec  codec
+	r      io.ReadCloser
+	offset int64
+	size   int64
+}
+
+func newDecompressReader(src io.ReadSeekCloser, name string, size int64) (*decompressReader, error) {
+	c, ok := codecs[name]
+	if !ok {
+		return nil, checkCompression(name)
+	}
+	r, err := c.newReader(src)
+	if err != nil {
+		return nil, err
+	}
+	return &decompressReader{src: src, codec: c, r: r, size: size}, nil
+}
+
+func (d *decompressReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.offset += int64(n)
+	return n, err
+}
+
+func (d *decompressReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += d.offset
+	case io.SeekEnd:
+		offset += d.size
+	}
+	if offset < 0 {
+		return d.offset, errors.New("seek before start of object")
+	}
+	if offset < d.offset {
+		if _, err := d.src.Seek(0, io.SeekStart); err != nil {
+			return d.offset, err
+		}
+		_ = d.r.Close()
+		r, err := d.codec.newReader(d.src)
+		if err != nil {
+			return d.offset, err
+		}
+		d.r, d.offset = r, 0
+	}
+	if _, err := io.CopyN(io.Discard, d, offset-d.offset); err != nil && !errors.Is(err, io.EOF) {
+		return d.offset, err
+	}
+	return d.offset, nil
+}
+
+func (d *decompressReader) Close() error {
+	_ = d.r.Close()
+	return d.src.Close()
+}
@@ -0,0 +1,45 @@
+package objectd
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// maxConflicts bounds the conflict log kept in memory.
+const maxConflicts = 1000
+
+// Conflict records a replicated change that was discarded because the
+// local copy of the key was written later, such as a write taken by a
+// former leader during a failover.
+type Conflict struct {
+	Bucket string    `json:"bucket"`
+	Key    string    `json:"key"`
+	Op     string    `json:"op"`
+	Kept   uint64    `json:"keptSeq"`
+	Lost   uint64    `json:"lostSeq"`
+	At     time.Time `json:"at"`
+}
+
+func (s *Store) conflictLocked(bucket, key string, kept, lost uint64, op string) {
+	c := Conflict{Bucket: bucket, Key: key, Op: op, Kept: kept, Lost: lost, At: time.Now().UTC()}
+	if len(s.conflicts) == maxConflicts {
+		s.conflicts = append(s.conflicts[:0], s.conflicts[1:]...)
+	}
+	s.conflicts = append(s.conflicts, c)
+	log.Printf("conflict on %s/%s: kept seq=%d, discarded %s seq=%d", bucket, key, kept, op, lost)
+	metrics.AddCounter("entity_replication_conflicts_total", map[string]string{"bucket": bucket}, 1)
+}
+
+// Conflicts returns the most recent conflicts resolved here, newest first.
+func (s *Store) Conflicts(_ context.Context) []Conflict {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Conflict, len(s.conflicts))
+	for i, c := range s.conflicts {
+		out[len(out)-1-i] = c
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package objectd
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetBucketCopies sets how many replicas keep the bodies of the objects in
+// bucket. Zero goes back to the cluster default.
+func (s *Store) SetBucketCopies(_ context.Context, bucket string, copies int) error {
+	if copies < 0 {
+		return fmt.Errorf("replication factor must not be negative")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	if b.Copies == copies {
+		return nil
+	}
+	b.Copies = copies
+	s.markBucket(bucket)
+	return s.persistLocked()
+}
+
+// BucketCopies returns the replication factor of bucket, or zero if it uses
+// the cluster default or does not exist.
+func (s *Store) BucketCopies(bucket string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if b, ok := s.state.Buckets[bucket]; ok {
+		return b.Copies
+	}
+	return 0
+}
+
+// SetBucketConsistency sets the default write consistency of requests to
+// bucket. Empty goes back to the cluster default. The level is not checked
+// here.
+func (s *Store) SetBucketConsistency(_ context.Context, bucket, level string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	if b.Consistency == level {
+		return nil
+	}
+	b.Consistency = level
+	s.markBucket(bucket)
+	return s.persistLocked()
+}
+
+// BucketConsistency returns the default write consistency of bucket, or ""
+// if it uses the cluster default or does not exist.
+func (s *Store) BucketConsistency(bucket string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if b, ok := s.state.Buckets[bucket]; ok {
+		return b.Consistency
+	}
+	return ""
+}
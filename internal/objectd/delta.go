@@ -0,0 +1,259 @@
+package objectd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// A chunked body that has to be pulled again, because a newer version
+// replaced it or because it failed verification, rarely differs from the
+// version this replica already had in every chunk. While such an object is
+// pending, the body it replaced is kept as the basis of a delta fetch: the
+// peer sends its chunk map, chunks whose checksum matches a basis chunk are
+// read locally, and only the others are transferred. Basis chunks are
+// verified before use, so a damaged one is fetched like a changed one. The
+// basis lives in memory only; after a restart the fetch is a full one and
+// the basis body is left to garbage collection. Encrypted bodies are stored
+// with an IV of their own and never match.
+
+// ErrNoChunkMap is returned for objects whose body is not stored in chunks.
+var ErrNoChunkMap = errors.New("object body is not stored in chunks")
+
+// ChunkSum describes one stored chunk of a body.
+type ChunkSum struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ChunkMap describes how the body of an object is stored in chunks.
+// Checksums cover the stored bytes, so they only match between replicas that
+// store the body with the same compression and chunk size.
+type ChunkMap struct {
+	Seq         uint64     `json:"seq"`
+	ETag        string     `json:"etag"`
+	Compression string     `json:"compression,omitempty"`
+	Chunks      []ChunkSum `json:"chunks"`
+}
+
+// DeltaResult counts the stored bytes of a delta fetch by where they came
+// from.
+type DeltaResult struct {
+	Reused  int64 `json:"reused"`
+	Fetched int64 `json:"fetched"`
+}
+
+func basisID(bucket, key string) string { return bucket + "/" + key }
+
+// updateBasisLocked keeps the body a pending record replaces as the basis of
+// its delta fetch, and drops the basis once key has a body again.
+func (s *Store) updateBasisLocked(bucket, key string, prev objectRecord, hadPrev bool, rec objectRecord) {
+	id := basisID(bucket, key)
+	if !rec.Pending {
+		s.dropBasisLocked(id)
+		return
+	}
+	if !hadPrev || prev.Pending || len(prev.Chunks) == 0 || prev.Encryption != "" || prev.Path == "" {
+		return
+	}
+	s.dropBasisLocked(id)
+	if s.bases == nil {
+		s.bases = map[string]objectRecord{}
+	}
+	s.retainLocked(prev.Path)
+	s.bases[id] = prev
+}
+
+func (s *Store) dropBasisLocked(id string) {
+	if b, ok := s.bases[id]; ok {
+		delete(s.bases, id)
+		s.releaseLocked(b.Path)
+	}
+}
+
+// HasFetchBasis reports whether a delta fetch of key is possible.
+func (s *Store) HasFetchBasis(bucket, key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.bases[basisID(bucket, key)]
+	return ok
+}
+
+// ObjectChunkMap returns the chunk map of the body of key.
+func (s *Store) ObjectChunkMap(_ context.Context, bucket, key string) (ChunkMap, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, err := s.chunkedRecordLocked(bucket, key)
+	if err != nil {
+		return ChunkMap{}, err
+	}
+	out := ChunkMap{Seq: rec.Seq, ETag: rec.ETag, Compression: rec.Compression, Chunks: make([]ChunkSum, len(rec.Chunks))}
+	for i, c := range rec.Chunks {
+		out.Chunks[i] = ChunkSum{Size: c.Size, SHA256: c.SHA256}
+	}
+	return out, nil
+}
+
+// OpenChunk opens the stored bytes of chunk i of the body of key, which must
+// still be at seq.
+func (s *Store) OpenChunk(_ context.Context, bucket, key string, seq uint64, i int) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, err := s.chunkedRecordLocked(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Seq != seq || i < 0 || i >= len(rec.Chunks) {
+		return nil, ErrNotFound
+	}
+	return s.backend.Get(chunkPath(rec.Path, i))
+}
+
+func (s *Store) chunkedRecordLocked(bucket, key string) (objectRecord, error) {
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return objectRecord{}, ErrNotFound
+	}
+	rec, ok := b.Objects[key]
+	switch {
+	case !ok:
+		return objectRecord{}, ErrNotFound
+	case rec.Pending:
+		return objectRecord{}, ErrObjectPending
+	case len(rec.Chunks) == 0 || rec.Path == "" || rec.Encryption != "":
+		return objectRecord{}, ErrNoChunkMap
+	}
+	return rec, nil
+}
+
+// CompleteFetchDelta is CompleteFetch for a body described by remote, the
+// chunk map of a peer's copy. Chunks found in the basis are read locally,
+// the others through fetch.
+func (s *Store) CompleteFetchDelta(ctx context.Context, bucket, key string, remote ChunkMap, fetch func(i int) (io.ReadCloser, error)) (DeltaResult, error) {
+	s.mu.RLock()
+	basis, ok := s.bases[basisID(bucket, key)]
+	s.mu.RUnlock()
+	if !ok {
+		return DeltaResult{}, fmt.Errorf("no basis for a delta fetch of %s/%s", bucket, key)
+	}
+	local := map[string]int{}
+	for i, c := range basis.Chunks {
+		local[c.SHA256] = i
+	}
+	d := &deltaReader{s: s, basis: basis, local: local, remote: remote.Chunks, fetch: fetch, cur: -1}
+	var body io.ReadSeekCloser = d
+	if remote.Compression != CompressionNone {
+		dr, err := newDecompressReader(d, remote.Compression, 0)
+		if err != nil {
+			return DeltaResult{}, err
+		}
+		body = dr
+	}
+	defer body.Close()
+	if err := s.CompleteFetch(ctx, bucket, key, remote.Seq, body); err != nil {
+		return d.res, err
+	}
+	return d.res, d.err
+}
+
+// deltaReader reads the stored bytes of a body chunk by chunk, each from
+// the basis if it holds an intact copy and from the peer otherwise.
+type deltaReader struct {
+	s      *Store
+	basis  objectRecord
+	local  map[string]int
+	remote []ChunkSum
+	fetch  func(i int) (io.ReadCloser, error)
+	res    DeltaResult
+
+	cur int
+	r   io.ReadCloser
+	h   hash.Hash
+	n   int64
+	err error
+}
+
+func (d *deltaReader) Read(p []byte) (int, error) {
+	for {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.r == nil {
+			if d.cur+1 >= len(d.remote) {
+				return 0, io.EOF
+			}
+			d.cur++
+			if d.err = d.open(d.remote[d.cur]); d.err != nil {
+				return 0, d.err
+			}
+		}
+		n, err := d.r.Read(p)
+		d.h.Write(p[:n])
+		d.n += int64(n)
+		if err == io.EOF {
+			_ = d.r.Close()
+			d.r = nil
+			want := d.remote[d.cur]
+			if sum := hex.EncodeToString(d.h.Sum(nil)); d.n != want.Size || sum != want.SHA256 {
+				d.err = fmt.Errorf("chunk %d: got %d bytes with checksum %s, want %d with %s", d.cur, d.n, sum, want.Size, want.SHA256)
+			}
+		} else if err != nil {
+			d.err = err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// open starts reading chunk c, from the basis if it holds an intact copy.
+func (d *deltaReader) open(c ChunkSum) error {
+	d.h, d.n = sha256.New(), 0
+	if i, ok := d.local[c.SHA256]; ok && d.intact(i) {
+		f, err := d.s.backend.Get(chunkPath(d.basis.Path, i))
+		if err == nil {
+			d.r = f
+			d.res.Reused += c.Size
+			return nil
+		}
+	}
+	r, err := d.fetch(d.cur)
+	if err != nil {
+		return fmt.Errorf("chunk %d: %w", d.cur, err)
+	}
+	d.r = r
+	d.res.Fetched += c.Size
+	return nil
+}
+
+// intact reports whether chunk i of the basis still matches its checksum.
+func (d *deltaReader) intact(i int) bool {
+	f, err := d.s.backend.Get(chunkPath(d.basis.Path, i))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	c := d.basis.Chunks[i]
+	return err == nil && n == c.Size && hex.EncodeToString(h.Sum(nil)) == c.SHA256
+}
+
+// Seek only reports the position; the body is read once, front to back.
+func (d *deltaReader) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return d.res.Reused + d.res.Fetched, nil
+	}
+	return 0, errors.New("a delta fetch cannot seek")
+}
+
+func (d *deltaReader) Close() error {
+	if d.r == nil {
+		return nil
+	}
+	return d.r.Close()
+}
@@ -0,0 +1,121 @@
+package objectd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// The store turns read-only once the fullest of its filesystems is used
+// above a high watermark, instead of failing writes halfway through a body,
+// and turns writable again once usage dropped below a low watermark. Reads
+// and deletes keep working, so space can be freed.
+
+var ErrReadOnly = errors.New("store is read-only: the disk is nearly full")
+
+// DiskStatus describes the fullest filesystem the store writes to.
+type DiskStatus struct {
+	ReadOnly    bool    `json:"readOnly"`
+	UsedPercent float64 `json:"usedPercent"`
+	FreeBytes   uint64  `json:"freeBytes"`
+	TotalBytes  uint64  `json:"totalBytes"`
+}
+
+// ReadOnly reports whether writes are refused for lack of space.
+func (s *Store) ReadOnly() bool { return s.readOnly.Load() }
+
+// DiskStatus returns the result of the last disk check.
+func (s *Store) DiskStatus() DiskStatus {
+	s.diskMu.Lock()
+	defer s.diskMu.Unlock()
+	st := s.disk
+	st.ReadOnly = s.readOnly.Load()
+	return st
+}
+
+// CheckDisk measures the filesystems of the data directory and the erasure
+// directories and updates the read-only mode: it is entered at high percent
+// used and left below low.
+func (s *Store) CheckDisk(high, low float64) (DiskStatus, error) {
+	dirs := []string{s.dataDir}
+	if s.erasure != nil {
+		dirs = append(dirs, s.erasure.dirs...)
+	}
+	var worst DiskStatus
+	for _, d := range dirs {
+		st, err := statDisk(d)
+		if err != nil {
+			return DiskStatus{}, err
+		}
+		if st.TotalBytes > 0 && st.UsedPercent >= worst.UsedPercent {
+			worst = st
+		}
+	}
+	s.diskMu.Lock()
+	s.disk = worst
+	s.diskMu.Unlock()
+	switch {
+	case worst.UsedPercent >= high && !s.readOnly.Load():
+		s.readOnly.Store(true)
+		log.Printf("disk %.1f%% used, at or above %.1f%%: refusing writes", worst.UsedPercent, high)
+	case worst.UsedPercent < low && s.readOnly.Load():
+		s.readOnly.Store(false)
+		log.Printf("disk %.1f%% used, below %.1f%%: accepting writes again", worst.UsedPercent, low)
+	}
+	worst.ReadOnly = s.readOnly.Load()
+	readOnly := 0.0
+	if worst.ReadOnly {
+		readOnly = 1
+	}
+	metrics.SetGauge("entity_disk_used_percent", nil, worst.UsedPercent)
+	metrics.SetGauge("entity_disk_free_bytes", nil, float64(worst.FreeBytes))
+	metrics.SetGauge("entity_store_read_only", nil, readOnly)
+	return worst, nil
+}
+
+// Healthy reports whether the data directory and the erasure directories
+// can be read. A hung filesystem makes it hang too.
+func (s *Store) Healthy() error {
+	dirs := []string{filepath.Join(s.dataDir, "objects")}
+	if s.erasure != nil {
+		dirs = append(dirs, s.erasure.dirs...)
+	}
+	for _, d := range dirs {
+		if _, err := os.ReadDir(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunDiskWatch checks the disk right away and then every interval until ctx
+// is done.
+func (s *Store) RunDiskWatch(ctx context.Context, interval time.Duration, high, low float64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.CheckDisk(high, low); err != nil {
+			log.Printf("disk check: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// diskFull reports a write that ran out of space before the watermark
+// caught it as ErrReadOnly.
+func diskFull(err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return ErrReadOnly
+	}
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package objectd
+
+// statDisk reports nothing on platforms without statfs, which leaves the
+// write watermark disabled.
+func statDisk(dir string) (DiskStatus, error) {
+	return DiskStatus{}, nil
+}
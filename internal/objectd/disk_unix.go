@@ -0,0 +1,20 @@
+//go:build unix
+
+package objectd
+
+import "syscall"
+
+// statDisk measures the filesystem of dir.
+func statDisk(dir string) (DiskStatus, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return DiskStatus{}, err
+	}
+	total := fs.Blocks * uint64(fs.Bsize)
+	if total == 0 {
+		return DiskStatus{}, nil
+	}
+	// Blocks reserved for root are not available to objectd.
+	free := fs.Bavail * uint64(fs.Bsize)
+	return DiskStatus{UsedPercent: 100 * float64(total-free) / float64(total), FreeBytes: free, TotalBytes: total}, nil
+}
@@ -0,0 +1,71 @@
+package objectd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Domain struct {
+	Host   string `json:"host"`
+	Bucket string `json:"bucket"`
+}
+
+// PutDomain maps a custom hostname to a bucket so requests addressed to that
+// host are served from the bucket without a bucket path segment.
+func (s *Store) PutDomain(_ context.Context, host, bucket string) error {
+	host = normalizeHost(host)
+	if host == "" {
+		return fmt.Errorf("invalid host")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.state.Buckets[bucket]; !ok {
+		return ErrNotFound
+	}
+	if s.state.Domains == nil {
+		s.state.Domains = map[string]string{}
+	}
+	s.state.Domains[host] = bucket
+	s.markMeta()
+	return s.persistLocked()
+}
+
+func (s *Store) DeleteDomain(_ context.Context, host string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	host = normalizeHost(host)
+	if _, ok := s.state.Domains[host]; !ok {
+		return nil
+	}
+	delete(s.state.Domains, host)
+	s.markMeta()
+	return s.persistLocked()
+}
+
+func (s *Store) ListDomains(_ context.Context) []Domain {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Domain, 0, len(s.state.Domains))
+	for host, bucket := range s.state.Domains {
+		out = append(out, Domain{Host: host, Bucket: bucket})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out
+}
+
+func (s *Store) BucketForHost(_ context.Context, host string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bucket, ok := s.state.Domains[normalizeHost(host)]
+	return bucket, ok
+}
+
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	return strings.TrimSuffix(host, ".")
+}
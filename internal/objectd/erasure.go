@@ -0,0 +1,564 @@
+package objectd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mchenetz/entity/internal/erasure"
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// With StoreOptions.ErasureDirs set, object bodies are striped across those
+// directories with Reed-Solomon parity instead of being kept as one file.
+// The stored bytes (after compression and encryption) are cut into stripes of
+// erasureBlockSize per data shard; shard i of a body lives in ErasureDirs[i]
+// under shards/<path of the body relative to the data dir>.<i>. Each shard
+// starts with a header carrying the stored size and each block carries a
+// CRC, so a missing disk and a corrupt block are both treated as a lost
+// shard. Reads reconstruct lost shards on the fly and schedule a rebuild
+// that rewrites them.
+//
+// Records keep the path a plain body would have, so reference counting and
+// the journal are unaffected, and name their layout so a store can read its
+// bodies only while the directories and shard counts stay the same.
+const (
+	erasureBlockSize  = 64 << 10
+	erasureHeaderSize = 16
+)
+
+var erasureMagic = [4]byte{'E', 'S', 'H', '1'}
+
+type erasureSet struct {
+	dataDir string
+	dirs    []string
+	coder   *erasure.Coder
+	layout  string
+}
+
+func newErasureSet(dataDir string, dirs []string, data, parity int) (*erasureSet, error) {
+	if parity < 1 {
+		return nil, fmt.Errorf("erasure coding needs at least one parity shard")
+	}
+	if len(dirs) != data+parity {
+		return nil, fmt.Errorf("erasure coding %d+%d needs %d directories, got %d", data, parity, data+parity, len(dirs))
+	}
+	coder, err := erasure.New(data, parity)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, d := range dirs {
+		if seen[filepath.Clean(d)] {
+			return nil, fmt.Errorf("erasure directory %s listed twice", d)
+		}
+		seen[filepath.Clean(d)] = true
+		if err := os.MkdirAll(filepath.Join(d, "shards"), 0o750); err != nil {
+			return nil, err
+		}
+	}
+	return &erasureSet{dataDir: dataDir, dirs: dirs, coder: coder, layout: fmt.Sprintf("%d+%d", data, parity)}, nil
+}
+
+func (e *erasureSet) shards() int { return len(e.dirs) }
+
+func (e *erasureSet) shardPath(body string, i int) string {
+	rel, err := filepath.Rel(e.dataDir, body)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(body)
+	}
+	return filepath.Join(e.dirs[i], "shards", rel) + "." + strconv.Itoa(i)
+}
+
+func (e *erasureSet) stripeSize() int64 {
+	return int64(e.coder.DataShards()) * erasureBlockSize
+}
+
+// encode stripes the file src into the shards of body. The shards are
+// written next to their final names and renamed into place once all of them
+// are synced.
+func (e *erasureSet) encode(src, body string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	files := make([]*os.File, e.shards())
+	cleanup := func() {
+		for i, f := range files {
+			if f != nil {
+				_ = f.Close()
+				_ = os.Remove(e.shardPath(body, i) + ".tmp")
+			}
+		}
+	}
+	var hdr [erasureHeaderSize]byte
+	copy(hdr[:4], erasureMagic[:])
+	binary.LittleEndian.PutUint64(hdr[4:12], uint64(fi.Size()))
+	binary.LittleEndian.PutUint32(hdr[12:16], erasureBlockSize)
+	for i := range files {
+		p := e.shardPath(body, i)
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			cleanup()
+			return err
+		}
+		f, err := os.Create(p + ".tmp")
+		if err != nil {
+			cleanup()
+			return err
+		}
+		files[i] = f
+		if _, err := f.Write(hdr[:]); err != nil {
+			cleanup()
+			return err
+		}
+	}
+	stripe := make([]byte, e.stripeSize())
+	parity := make([]byte, int64(e.coder.ParityShards())*erasureBlockSize)
+	shards := make([][]byte, e.shards())
+	for off := int64(0); off < fi.Size(); off += e.stripeSize() {
+		n, err := io.ReadFull(in, stripe)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			cleanup()
+			return err
+		}
+		clear(stripe[n:])
+		for i := range shards {
+			if i < e.coder.DataShards() {
+				shards[i] = stripe[i*erasureBlockSize : (i+1)*erasureBlockSize]
+			} else {
+				j := i - e.coder.DataShards()
+				shards[i] = parity[j*erasureBlockSize : (j+1)*erasureBlockSize]
+			}
+		}
+		if err := e.coder.Encode(shards); err != nil {
+			cleanup()
+			return err
+		}
+		for i, f := range files {
+			if err := writeShardBlock(f, shards[i]); err != nil {
+				cleanup()
+				return err
+			}
+		}
+	}
+	for _, f := range files {
+		if err := f.Sync(); err != nil {
+			cleanup()
+			return err
+		}
+	}
+	for i, f := range files {
+		_ = f.Close()
+		if err := os.Rename(e.shardPath(body, i)+".tmp", e.shardPath(body, i)); err != nil {
+			files[i] = nil
+			cleanup()
+			e.remove(body)
+			return err
+		}
+		files[i] = nil
+	}
+	return nil
+}
+
+func writeShardBlock(w io.Writer, block []byte) error {
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(block))
+	if _, err := w.Write(sum[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(block)
+	return err
+}
+
+// available reports the stored size of body and how many of its shards have
+// an intact header.
+func (e *erasureSet) available(body string) (int64, int) {
+	size, count := int64(-1), 0
+	for i := range e.dirs {
+		f, sz, err := e.openShard(body, i)
+		if err != nil {
+			continue
+		}
+		_ = f.Close()
+		if size < 0 {
+			size = sz
+		}
+		if sz == size {
+			count++
+		}
+	}
+	return size, count
+}
+
+func (e *erasureSet) openShard(body string, i int) (*os.File, int64, error) {
+	f, err := os.Open(e.shardPath(body, i))
+	if err != nil {
+		return nil, 0, err
+	}
+	var hdr [erasureHeaderSize]byte
+	if _, err := io.ReadFull(f, hdr[:]); err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+	if [4]byte(hdr[:4]) != erasureMagic || binary.LittleEndian.Uint32(hdr[12:16]) != erasureBlockSize {
+		_ = f.Close()
+		return nil, 0, fmt.Errorf("%s: not a shard", f.Name())
+	}
+	return f, int64(binary.LittleEndian.Uint64(hdr[4:12])), nil
+}
+
+func (e *erasureSet) remove(body string) {
+	for i := range e.dirs {
+		_ = os.Remove(e.shardPath(body, i))
+	}
+}
+
+// erasureReader reads the stored bytes of a body from its shards, one
+// stripe at a time.
+type erasureReader struct {
+	set    *erasureSet
+	files  []*os.File
+	size   int64
+	offset int64
+	stripe int64
+	buf    []byte
+	// lost is set once a shard turned out to be missing or corrupt.
+	lost   bool
+	onLost func()
+}
+
+func (e *erasureSet) open(body string) (*erasureReader, error) {
+	r := &erasureReader{set: e, files: make([]*os.File, e.shards()), size: -1, stripe: -1}
+	present := 0
+	for i := range r.files {
+		f, size, err := e.openShard(body, i)
+		if err != nil {
+			r.lost = true
+			continue
+		}
+		switch {
+		case r.size < 0:
+			r.size = size
+		case size != r.size:
+			_ = f.Close()
+			r.lost = true
+			continue
+		}
+		r.files[i] = f
+		present++
+	}
+	if present == 0 {
+		return nil, ErrNotFound
+	}
+	if present < e.coder.DataShards() {
+		_ = r.closeFiles()
+		return nil, fmt.Errorf("%s: %w", body, erasure.ErrTooFewShards)
+	}
+	return r, nil
+}
+
+// readStripe returns the shards of stripe n, reconstructing lost ones. With
+// all set every shard is read and verified, parity included.
+func (r *erasureReader) readStripe(n int64, all bool) ([][]byte, error) {
+	data := r.set.coder.DataShards()
+	shards := make([][]byte, r.set.shards())
+	block := make([]byte, 4+erasureBlockSize)
+	off := erasureHeaderSize + n*int64(len(block))
+	have := 0
+	for i, f := range r.files {
+		if f == nil || (!all && i >= data && have >= data) {
+			continue
+		}
+		if _, err := f.ReadAt(block, off); err != nil || crc32.ChecksumIEEE(block[4:]) != binary.LittleEndian.Uint32(block[:4]) {
+			_ = f.Close()
+			r.files[i] = nil
+			r.lost = true
+			continue
+		}
+		shards[i] = append([]byte(nil), block[4:]...)
+		have++
+	}
+	if have < data {
+		return nil, erasure.ErrTooFewShards
+	}
+	for i, sh := range shards {
+		if sh == nil && (all || i < data) {
+			if err := r.set.coder.Reconstruct(shards); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return shards, nil
+}
+
+func (r *erasureReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	stripeSize := r.set.stripeSize()
+	if n := r.offset / stripeSize; n != r.stripe {
+		shards, err := r.readStripe(n, false)
+		if err != nil {
+			return 0, err
+		}
+		if r.buf == nil {
+			r.buf = make([]byte, stripeSize)
+		}
+		for i := 0; i < r.set.coder.DataShards(); i++ {
+			copy(r.buf[i*erasureBlockSize:], shards[i])
+		}
+		r.stripe = n
+	}
+	start := r.offset - r.stripe*stripeSize
+	end := min(stripeSize, r.size-r.stripe*stripeSize)
+	n := copy(p, r.buf[start:end])
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *erasureReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return r.offset, errors.New("seek before start of object")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *erasureReader) Close() error {
+	err := r.closeFiles()
+	if r.lost && r.onLost != nil {
+		r.onLost()
+	}
+	return err
+}
+
+func (r *erasureReader) closeFiles() error {
+	for i, f := range r.files {
+		if f != nil {
+			_ = f.Close()
+			r.files[i] = nil
+		}
+	}
+	return nil
+}
+
+// rebuild rewrites the lost shards of body from the others and returns the
+// temporary files holding them, keyed by shard index, for the caller to
+// rename into place.
+func (e *erasureSet) rebuild(body string) (map[int]string, error) {
+	r, err := e.open(body)
+	if err != nil {
+		return nil, err
+	}
+	defer r.closeFiles()
+	stripes := (r.size + e.stripeSize() - 1) / e.stripeSize()
+	// Verify every block first; a shard is rebuilt if any of its blocks is
+	// bad.
+	for n := int64(0); n < stripes; n++ {
+		if _, err := r.readStripe(n, true); err != nil {
+			return nil, err
+		}
+	}
+	out := map[int]string{}
+	files := map[int]*os.File{}
+	fail := func(err error) (map[int]string, error) {
+		for i, f := range files {
+			_ = f.Close()
+			_ = os.Remove(out[i])
+		}
+		return nil, err
+	}
+	var hdr [erasureHeaderSize]byte
+	copy(hdr[:4], erasureMagic[:])
+	binary.LittleEndian.PutUint64(hdr[4:12], uint64(r.size))
+	binary.LittleEndian.PutUint32(hdr[12:16], erasureBlockSize)
+	for i, f := range r.files {
+		if f != nil {
+			continue
+		}
+		p := e.shardPath(body, i)
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			return fail(err)
+		}
+		nf, err := os.Create(p + ".rebuild")
+		if err != nil {
+			return fail(err)
+		}
+		out[i], files[i] = nf.Name(), nf
+		if _, err := nf.Write(hdr[:]); err != nil {
+			return fail(err)
+		}
+	}
+	for n := int64(0); n < stripes; n++ {
+		shards, err := r.readStripe(n, true)
+		if err != nil {
+			return fail(err)
+		}
+		for i, f := range files {
+			if err := writeShardBlock(f, shards[i]); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	for _, f := range files {
+		if err := f.Sync(); err != nil {
+			return fail(err)
+		}
+	}
+	for i, f := range files {
+		_ = f.Close()
+		delete(files, i)
+	}
+	return out, nil
+}
+
+// openStoredLocked opens the stored bytes of m, before decryption and
+// decompression.
+func (s *Store) openStoredLocked(m ObjectMeta) (io.ReadSeekCloser, error) {
+	if m.inline != nil {
+		return memoryReader{bytes.NewReader(m.inline)}, nil
+	}
+	if m.chunks != nil {
+		return newChunkReader(s.backend, m.Path, m.chunks), nil
+	}
+	if m.erasure == "" {
+		return s.backend.Get(m.Path)
+	}
+	if s.erasure == nil || s.erasure.layout != m.erasure {
+		return nil, fmt.Errorf("object is erasure coded %s but the store is not configured for that layout", m.erasure)
+	}
+	r, err := s.erasure.open(m.Path)
+	if err != nil {
+		return nil, err
+	}
+	body := m.Path
+	r.onLost = func() { go s.repairBody(body) }
+	return r, nil
+}
+
+// storeBodyLocked moves the fully written and synced file tmp to body,
+// striping it when erasure coding is configured, and returns the layout it
+// was stored with.
+func (s *Store) storeBodyLocked(tmp, body string) (string, error) {
+	if s.erasure == nil {
+		return "", s.backend.Put(body, tmp)
+	}
+	if err := s.erasure.encode(tmp, body); err != nil {
+		return "", err
+	}
+	_ = os.Remove(tmp)
+	return s.erasure.layout, nil
+}
+
+// bodyExists reports whether the body of rec is on disk and readable.
+func (s *Store) bodyExists(rec objectRecord) bool {
+	if rec.Path == "" {
+		// Inline, or offloaded to the cold tier.
+		return rec.Inline != nil || rec.Tier != ""
+	}
+	if rec.Chunks != nil {
+		return s.chunksExist(rec.Path, rec.Chunks) == nil
+	}
+	if rec.Erasure == "" {
+		_, err := s.backend.Stat(rec.Path)
+		return err == nil
+	}
+	if s.erasure == nil {
+		return false
+	}
+	_, n := s.erasure.available(rec.Path)
+	return n >= s.erasure.coder.DataShards()
+}
+
+// removeBody removes a body in whichever form it is stored.
+func (s *Store) removeBody(body string) {
+	if chunkedBody(body) {
+		s.removeChunks(body)
+		return
+	}
+	_ = s.backend.Delete(body)
+	if s.erasure != nil {
+		s.erasure.remove(body)
+	}
+}
+
+// repairBody rebuilds the lost shards of body in the background of a read
+// that had to reconstruct them.
+func (s *Store) repairBody(body string) {
+	s.mu.Lock()
+	if s.repairing[body] || s.refs[body] == 0 {
+		s.mu.Unlock()
+		return
+	}
+	s.repairing[body] = true
+	s.mu.Unlock()
+
+	tmps, err := s.erasure.rebuild(body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.repairing, body)
+	if err != nil {
+		log.Printf("erasure: rebuild %s: %v", body, err)
+		metrics.AddCounter("entity_erasure_rebuild_failures_total", nil, 1)
+		return
+	}
+	for i, tmp := range tmps {
+		// The body may have been removed while its shards were rebuilt.
+		if s.refs[body] == 0 {
+			_ = os.Remove(tmp)
+			continue
+		}
+		if err := os.Rename(tmp, s.erasure.shardPath(body, i)); err != nil {
+			_ = os.Remove(tmp)
+			log.Printf("erasure: rebuild %s: %v", body, err)
+			continue
+		}
+		metrics.AddCounter("entity_erasure_shards_rebuilt_total", nil, 1)
+	}
+}
+
+// removeErasureDirLocked removes the unreferenced shards of the bodies
+// under dir, a directory of the data dir.
+func (s *Store) removeErasureDirLocked(dir string) {
+	rel, err := filepath.Rel(s.dataDir, dir)
+	if err != nil || s.erasure == nil {
+		return
+	}
+	for i, d := range s.erasure.dirs {
+		sdir := filepath.Join(d, "shards", rel)
+		entries, _ := os.ReadDir(sdir)
+		suffix := "." + strconv.Itoa(i)
+		for _, e := range entries {
+			name, ok := strings.CutSuffix(e.Name(), suffix)
+			if !ok {
+				_ = os.Remove(filepath.Join(sdir, e.Name()))
+				continue
+			}
+			if body := filepath.Join(dir, name); s.refs[body] == 0 {
+				_ = os.Remove(filepath.Join(sdir, e.Name()))
+			}
+		}
+		_ = os.Remove(sdir)
+	}
+}
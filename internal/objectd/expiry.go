@@ -0,0 +1,89 @@
+package objectd
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Objects can carry an expiry time, set when they are written or later. A
+// sweeper on every replica deletes the objects whose time has come. The
+// delete is stamped with the sequence number of the expired version itself
+// rather than a new one, so replicas that sweep at different moments agree
+// on it, and a newer version written meanwhile, which no longer expires or
+// expires later, always wins.
+
+func formatExpiry(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseExpiry(v string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, v)
+	return t
+}
+
+// SetObjectExpiry makes the current version of key expire at at, or never if
+// at is zero.
+func (s *Store) SetObjectExpiry(_ context.Context, bucket, key string, at time.Time) (ObjectMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ObjectMeta{}, ErrNotFound
+	}
+	rec, ok := b.Objects[key]
+	if !ok {
+		return ObjectMeta{}, ErrNotFound
+	}
+	rec.ExpiresAt = formatExpiry(at)
+	b.putRecord(key, rec)
+	s.markObject(bucket, key)
+	return rec.meta(bucket, key), s.persistLocked()
+}
+
+// ExpireObjects deletes the objects that expired by now and returns how many
+// it deleted.
+func (s *Store) ExpireObjects(_ context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for name, b := range s.state.Buckets {
+		for key, rec := range b.Objects {
+			if rec.ExpiresAt == "" || now.Before(parseExpiry(rec.ExpiresAt)) {
+				continue
+			}
+			if err := s.deleteObjectLocked(name, b, key, rec.Seq); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.persistLocked()
+}
+
+// RunExpirySweep deletes expired objects every interval until ctx is done.
+func (s *Store) RunExpirySweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := s.ExpireObjects(ctx, now)
+			if err != nil {
+				log.Printf("expiry: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("expiry: deleted %d expired objects", n)
+			}
+		}
+	}
+}
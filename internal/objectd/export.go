@@ -0,0 +1,163 @@
+package objectd
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// A bucket export is a tar archive, optionally compressed with one of the
+// body codecs. It starts with bucket.json, the bucket summary, followed by
+// one entry per object under objects/<key> whose PAX records carry the
+// object metadata, and ends with export.json, which counts what was
+// exported and lists the objects that had to be skipped. Objects are read
+// one at a time, so the export sees every object as of the moment it got to
+// it rather than a snapshot of the whole bucket.
+
+// PAX record names of the object metadata in an export.
+const (
+	ExportETagRecord         = "ENTITY.etag"
+	ExportContentTypeRecord  = "ENTITY.content-type"
+	ExportStorageClassRecord = "ENTITY.storage-class"
+	ExportSeqRecord          = "ENTITY.seq"
+)
+
+// ExportSummary is the last entry of a bucket export.
+type ExportSummary struct {
+	Bucket     string          `json:"bucket"`
+	ExportedAt time.Time       `json:"exportedAt"`
+	Objects    int             `json:"objects"`
+	Bytes      int64           `json:"bytes"`
+	Skipped    []SkippedObject `json:"skipped,omitempty"`
+}
+
+// SkippedObject names an object an export could not read.
+type SkippedObject struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// ExportBucket writes the objects of bucket to w as a tar archive,
+// compressed with compression unless it is CompressionNone. Objects whose
+// body is not on this replica or is offloaded are skipped and listed in the
+// summary; other read errors end the export.
+func (s *Store) ExportBucket(ctx context.Context, bucket string, w io.Writer, compression string) (ExportSummary, error) {
+	if err := checkCompression(compression); err != nil {
+		return ExportSummary{}, err
+	}
+	b, err := s.GetBucket(ctx, bucket)
+	if err != nil {
+		return ExportSummary{}, err
+	}
+	keys, err := s.objectKeys(bucket)
+	if err != nil {
+		return ExportSummary{}, err
+	}
+	out := w
+	var zw io.WriteCloser
+	if compression != CompressionNone {
+		if zw, err = codecs[compression].newWriter(w); err != nil {
+			return ExportSummary{}, err
+		}
+		out = zw
+	}
+	tw := tar.NewWriter(out)
+	now := time.Now().UTC()
+	if err := writeJSONEntry(tw, "bucket.json", now, b); err != nil {
+		return ExportSummary{}, err
+	}
+	summary := ExportSummary{Bucket: bucket, ExportedAt: now}
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		n, err := s.exportObject(ctx, tw, bucket, key)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			// Deleted since the export started.
+		case errors.Is(err, ErrObjectPending), errors.Is(err, ErrObjectOffloaded):
+			summary.Skipped = append(summary.Skipped, SkippedObject{Key: key, Reason: err.Error()})
+		case err != nil:
+			return summary, fmt.Errorf("export %s: %w", key, err)
+		default:
+			summary.Objects++
+			summary.Bytes += n
+		}
+	}
+	if err := writeJSONEntry(tw, "export.json", now, summary); err != nil {
+		return summary, err
+	}
+	if err := tw.Close(); err != nil {
+		return summary, err
+	}
+	if zw != nil {
+		return summary, zw.Close()
+	}
+	return summary, nil
+}
+
+// objectKeys returns the keys of bucket in order.
+func (s *Store) objectKeys(bucket string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	keys := make([]string, 0, b.keys.len())
+	b.keys.ascend("", func(k string) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys, nil
+}
+
+// exportObject writes one object to tw, bypassing the read cache.
+func (s *Store) exportObject(ctx context.Context, tw *tar.Writer, bucket, key string) (int64, error) {
+	m, f, err := s.OpenStoredObject(ctx, bucket, key)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	records := map[string]string{
+		ExportETagRecord: m.ETag,
+		ExportSeqRecord:  strconv.FormatUint(m.Seq, 10),
+	}
+	if m.ContentType != "" {
+		records[ExportContentTypeRecord] = m.ContentType
+	}
+	if m.StorageClass != "" {
+		records[ExportStorageClassRecord] = m.StorageClass
+	}
+	hdr := &tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       "objects/" + key,
+		Size:       m.Size,
+		Mode:       0o644,
+		ModTime:    m.ModTime,
+		Format:     tar.FormatPAX,
+		PAXRecords: records,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return 0, err
+	}
+	return io.Copy(tw, f)
+}
+
+func writeJSONEntry(tw *tar.Writer, name string, modTime time.Time, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: int64(len(data)), Mode: 0o644, ModTime: modTime}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
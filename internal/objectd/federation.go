@@ -0,0 +1,108 @@
+package objectd
+
+import (
+	"context"
+	"sort"
+)
+
+// federationState records whether a bucket is replicated to a remote
+// cluster and how far. Cursor is the sequence number up to which the
+// bucket's changes have been delivered; it is shared by all replicas, so a
+// new leader carries on where the old one stopped.
+type federationState struct {
+	Enabled bool   `json:"enabled,omitempty"`
+	Cursor  uint64 `json:"cursor,omitempty"`
+}
+
+// FederatedBucket is a bucket replicated to the remote cluster.
+type FederatedBucket struct {
+	Name   string `json:"name"`
+	Cursor uint64 `json:"cursor"`
+}
+
+// SetFederation enables or disables replication of a bucket to the remote
+// cluster. Enabling it again starts over with a full copy.
+func (s *Store) SetFederation(_ context.Context, bucket string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	if b.Federation.Enabled == enabled {
+		return nil
+	}
+	b.Federation = federationState{Enabled: enabled}
+	s.markBucket(bucket)
+	return s.persistLocked()
+}
+
+// SetFederationCursor records that the changes of a bucket up to cursor
+// have been delivered. A cursor behind the recorded one is ignored.
+func (s *Store) SetFederationCursor(_ context.Context, bucket string, cursor uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	if !b.Federation.Enabled || cursor <= b.Federation.Cursor {
+		return nil
+	}
+	b.Federation.Cursor = cursor
+	s.markBucket(bucket)
+	return s.persistLocked()
+}
+
+// FederatedBuckets returns the buckets replicated to the remote cluster.
+func (s *Store) FederatedBuckets(_ context.Context) []FederatedBucket {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []FederatedBucket{}
+	for name, b := range s.state.Buckets {
+		if b.Federation.Enabled {
+			out = append(out, FederatedBucket{Name: name, Cursor: b.Federation.Cursor})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// BucketChangesSince is ChangesSince for the objects of one bucket; the
+// feed carries no buckets or access keys. A since of zero lists the whole
+// bucket and is never truncated.
+func (s *Store) BucketChangesSince(_ context.Context, bucket string, since uint64, limit int) (ChangeFeed, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ChangeFeed{}, ErrNotFound
+	}
+	feed := ChangeFeed{Clock: s.state.Clock, Buckets: []FeedBucket{}, Access: []AccessKey{}, Changes: []ObjectChange{}}
+	if since > 0 && since < s.state.TombstoneFloor {
+		feed.Truncated = true
+		return feed, nil
+	}
+	for key, rec := range b.Objects {
+		if rec.Seq > since {
+			m := rec.meta(bucket, key)
+			feed.Changes = append(feed.Changes, ObjectChange{Bucket: bucket, Key: key, Seq: rec.Seq, ETag: rec.ETag, Size: rec.Size, StorageClass: m.StorageClass, ContentType: m.ContentType, ExpiresAt: rec.ExpiresAt})
+		}
+	}
+	for _, t := range s.state.Tombstones {
+		if t.Bucket == bucket && t.Seq > since {
+			feed.Changes = append(feed.Changes, ObjectChange{Bucket: t.Bucket, Key: t.Key, Seq: t.Seq, Deleted: true})
+		}
+	}
+	sort.Slice(feed.Changes, func(i, j int) bool { return feed.Changes[i].Seq < feed.Changes[j].Seq })
+	feed.Next = feed.Clock
+	if len(feed.Changes) > limit {
+		feed.Changes = feed.Changes[:limit]
+		feed.More = true
+		feed.Next = feed.Changes[limit-1].Seq
+	}
+	return feed, nil
+}
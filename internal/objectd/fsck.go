@@ -0,0 +1,319 @@
+package objectd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fsck checks that every object record has a readable body of the recorded
+// size and that every stored file belongs to a record. It is meant to run
+// offline, before the server starts, on a store nothing else is using.
+
+// LostAndFoundBucket receives orphaned bodies that Fsck could identify.
+// Content-addressed bodies carry their checksum in their name, so they are
+// recovered under that checksum as key; the original bucket and key are
+// lost.
+const LostAndFoundBucket = "lost-and-found"
+
+// Fsck issue kinds.
+const (
+	FsckMissingBody      = "missing-body"
+	FsckSizeMismatch     = "size-mismatch"
+	FsckChecksumMismatch = "checksum-mismatch"
+	FsckOrphan           = "orphan"
+)
+
+type FsckOptions struct {
+	// Repair fixes what it can. Records whose body is missing are deleted,
+	// or refetched with Refetch. Orphaned content-addressed bodies are
+	// recovered into LostAndFoundBucket and other orphans are quarantined.
+	// Damaged bodies are only replaced with Refetch.
+	Repair bool
+	// VerifyChecksums reads every body and compares its SHA-256 with the
+	// ETag.
+	VerifyChecksums bool
+	// Refetch marks objects with a missing or damaged body as pending on
+	// Origin, for stores in a cluster whose peers hold healthy copies.
+	Refetch bool
+	Origin  int
+}
+
+type FsckIssue struct {
+	Kind   string `json:"kind"`
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	// Action is what Repair did: "deleted", "refetch", "recovered" or
+	// "quarantined".
+	Action string `json:"action,omitempty"`
+}
+
+type FsckReport struct {
+	Objects int `json:"objects"`
+	Files   int `json:"files"`
+	// Unverified counts bodies whose checksum could not be checked because
+	// no SSE master key is configured.
+	Unverified int         `json:"unverified,omitempty"`
+	Issues     []FsckIssue `json:"issues"`
+}
+
+// Unresolved returns the number of issues left as they were found.
+func (r FsckReport) Unresolved() int {
+	n := 0
+	for _, i := range r.Issues {
+		if i.Action == "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Store) Fsck(ctx context.Context, opts FsckOptions) (FsckReport, error) {
+	report := FsckReport{Issues: []FsckIssue{}}
+	type object struct {
+		bucket, key string
+		rec         objectRecord
+	}
+	var objects []object
+	s.mu.RLock()
+	for name, b := range s.state.Buckets {
+		for key, rec := range b.Objects {
+			if !rec.Pending {
+				objects = append(objects, object{name, key, rec})
+			}
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].bucket != objects[j].bucket {
+			return objects[i].bucket < objects[j].bucket
+		}
+		return objects[i].key < objects[j].key
+	})
+	report.Objects = len(objects)
+
+	for _, o := range objects {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		// A repair of an earlier object may have covered this one.
+		if cur, err := s.GetObjectMeta(ctx, o.bucket, o.key); err != nil || cur.Pending || cur.Seq != o.rec.Seq {
+			continue
+		}
+		kind, err := s.fsckObject(o.rec, opts.VerifyChecksums)
+		if errors.Is(err, ErrEncryptionNotConfigured) {
+			report.Unverified++
+			continue
+		}
+		if kind == "" {
+			continue
+		}
+		issue := FsckIssue{Kind: kind, Bucket: o.bucket, Key: o.key, Path: o.rec.Path, Detail: err.Error()}
+		if opts.Repair {
+			switch {
+			case opts.Refetch:
+				if err := s.RefetchObject(ctx, o.bucket, o.key, o.rec.Seq, opts.Origin); err != nil {
+					return report, err
+				}
+				issue.Action = "refetch"
+			case kind == FsckMissingBody:
+				if _, err := s.DeleteObject(ctx, o.bucket, o.key); err != nil {
+					return report, err
+				}
+				issue.Action = "deleted"
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	candidates, scanned, err := s.gcCandidates(ctx, time.Now())
+	report.Files = scanned
+	if err != nil {
+		return report, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parts := s.uploadPartsLocked()
+	recovered := false
+	for _, c := range candidates {
+		if !s.orphanLocked(c, parts) {
+			continue
+		}
+		issue := FsckIssue{Kind: FsckOrphan, Path: c.path}
+		if opts.Repair {
+			if key, err := s.recoverBodyLocked(c); err == nil {
+				issue.Bucket, issue.Key, issue.Action = LostAndFoundBucket, key, "recovered"
+				recovered = true
+			} else if err := s.quarantine(c); err == nil {
+				issue.Action = "quarantined"
+			} else {
+				issue.Detail = err.Error()
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+	if opts.Repair {
+		s.removeUploadDirsLocked(candidates, parts)
+	}
+	if recovered {
+		if err := s.persistLocked(); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// fsckObject checks the body of rec and returns the kind of problem found,
+// if any, with details.
+func (s *Store) fsckObject(rec objectRecord, verify bool) (string, error) {
+	if rec.offloaded() {
+		// Offloaded bodies are not checked.
+		return "", nil
+	}
+	if rec.Chunks != nil {
+		// Chunks are checked one by one, so the damaged ones are named.
+		for i, c := range rec.Chunks {
+			bi, err := s.backend.Stat(chunkPath(rec.Path, i))
+			if err != nil {
+				return FsckMissingBody, fmt.Errorf("chunk %d: %w", i, err)
+			}
+			if bi.Size != c.Size {
+				return FsckSizeMismatch, fmt.Errorf("chunk %d: stored %d bytes, want %d", i, bi.Size, c.Size)
+			}
+		}
+		if verify {
+			if err := s.verifyChunks(rec.Path, rec.Chunks); err != nil {
+				return FsckChecksumMismatch, err
+			}
+		}
+	} else if !s.bodyExists(rec) {
+		return FsckMissingBody, errors.New("body is missing")
+	}
+	// Without compression the stored size equals the object size; CTR
+	// encryption does not change it.
+	if rec.Compression == CompressionNone {
+		var size int64
+		switch {
+		case rec.Inline != nil:
+			size = int64(len(rec.Inline))
+		case rec.Chunks != nil:
+			for _, c := range rec.Chunks {
+				size += c.Size
+			}
+		case rec.Erasure == "":
+			bi, err := s.backend.Stat(rec.Path)
+			if err != nil {
+				return FsckMissingBody, err
+			}
+			size = bi.Size
+		default:
+			size, _ = s.erasure.available(rec.Path)
+		}
+		if size != rec.Size {
+			return FsckSizeMismatch, fmt.Errorf("stored %d bytes, want %d", size, rec.Size)
+		}
+	}
+	if !verify {
+		return "", nil
+	}
+	n, sum, err := s.hashBody(rec.meta("", ""))
+	switch {
+	case errors.Is(err, ErrEncryptionNotConfigured):
+		return "", err
+	case err != nil:
+		return FsckChecksumMismatch, err
+	case n != rec.Size:
+		return FsckSizeMismatch, fmt.Errorf("read %d bytes, want %d", n, rec.Size)
+	case sum != rec.ETag:
+		return FsckChecksumMismatch, fmt.Errorf("checksum %s, want %s", sum, rec.ETag)
+	}
+	return "", nil
+}
+
+// hashBody reads the body of m as plaintext and returns its length and
+// SHA-256.
+func (s *Store) hashBody(m ObjectMeta) (int64, string, error) {
+	s.mu.RLock()
+	f, err := s.openStoredLocked(m)
+	if err != nil {
+		s.mu.RUnlock()
+		return 0, "", err
+	}
+	body, err := s.bodyReaderLocked(f, m)
+	s.mu.RUnlock()
+	if err != nil {
+		_ = f.Close()
+		return 0, "", err
+	}
+	defer body.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, body)
+	if err != nil {
+		return n, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// recoverBodyLocked adds an orphaned content-addressed body to
+// LostAndFoundBucket under its checksum, after checking that the content
+// matches it, and returns the key.
+func (s *Store) recoverBodyLocked(c gcCandidate) (string, error) {
+	blobs := filepath.Join(s.dataDir, "blobs") + string(filepath.Separator)
+	if c.temp || !strings.HasPrefix(c.body, blobs) {
+		return "", errors.New("not a content-addressed body")
+	}
+	sum, compression, _ := strings.Cut(filepath.Base(c.body), ".")
+	if len(sum) != sha256.Size*2 || checkCompression(compression) != nil {
+		return "", errors.New("not a content-addressed body")
+	}
+	rec := objectRecord{Path: c.body, ETag: sum, Compression: compression}
+	if !c.blob {
+		if s.erasure == nil {
+			return "", errors.New("erasure coding is not configured")
+		}
+		rec.Erasure = s.erasure.layout
+	}
+	m := rec.meta("", "")
+	f, err := s.openStoredLocked(m)
+	if err != nil {
+		return "", err
+	}
+	body, err := s.bodyReaderLocked(f, m)
+	if err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, body)
+	_ = body.Close()
+	if err != nil {
+		return "", err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != sum {
+		return "", errors.New("content does not match its name")
+	}
+	b, ok := s.state.Buckets[LostAndFoundBucket]
+	if !ok {
+		if err := s.createBucketLocked(LostAndFoundBucket); err != nil {
+			return "", err
+		}
+		b = s.state.Buckets[LostAndFoundBucket]
+	}
+	rec.Size = n
+	rec.ModTime = time.Now().UTC().Format(time.RFC3339Nano)
+	rec.Seq = s.tickLocked()
+	rec.Versioned = b.versioned(sum, rec.Seq)
+	if err := s.setObjectLocked(LostAndFoundBucket, b, sum, rec); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
@@ -0,0 +1,300 @@
+package objectd
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// The journal keeps bodies and metadata consistent across crashes, but files
+// can still leak: a crash while a replaced body or an aborted upload is being
+// removed, a failed removal, or a store that ran before the journal existed.
+// CollectGarbage walks the body trees and removes the files no record refers
+// to.
+
+// DefaultGCMinAge is how old a file must be before garbage collection may
+// touch it.
+const DefaultGCMinAge = time.Hour
+
+// gcReportPaths caps the orphan paths listed in a GCReport.
+const gcReportPaths = 1000
+
+type GCOptions struct {
+	// MinAge protects files modified more recently, which may belong to a
+	// write in progress. Zero means DefaultGCMinAge.
+	MinAge time.Duration
+	// Quarantine moves orphans to quarantine/ under the directory they were
+	// found in instead of removing them.
+	Quarantine bool
+	// DryRun only reports the orphans.
+	DryRun bool
+}
+
+type GCReport struct {
+	Scanned     int      `json:"scanned"`
+	Orphans     int      `json:"orphans"`
+	Bytes       int64    `json:"bytes"`
+	Removed     int      `json:"removed"`
+	Quarantined int      `json:"quarantined"`
+	Paths       []string `json:"paths,omitempty"`
+}
+
+type gcCandidate struct {
+	path string
+	root string
+	size int64
+	// body is the body the file belongs to, or empty for upload files.
+	body string
+	// blob marks files kept by the storage backend: bodies, chunks and
+	// upload parts.
+	blob bool
+	// upload and temp mark multipart files and interrupted shard writes.
+	upload string
+	temp   bool
+}
+
+// CollectGarbage removes or quarantines object bodies, erasure-coded shards
+// and multipart upload files that no record refers to. The trees are walked
+// without the store lock; the candidates are checked again and removed under
+// it, so a concurrent write that reuses a stored body keeps it.
+func (s *Store) CollectGarbage(ctx context.Context, opts GCOptions) (GCReport, error) {
+	if opts.MinAge <= 0 {
+		opts.MinAge = DefaultGCMinAge
+	}
+	var report GCReport
+	candidates, scanned, err := s.gcCandidates(ctx, time.Now().Add(-opts.MinAge))
+	report.Scanned = scanned
+	if err != nil {
+		return report, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parts := s.uploadPartsLocked()
+	for _, c := range candidates {
+		if !s.orphanLocked(c, parts) {
+			continue
+		}
+		report.Orphans++
+		report.Bytes += c.size
+		if len(report.Paths) < gcReportPaths {
+			report.Paths = append(report.Paths, c.path)
+		}
+		if opts.DryRun {
+			continue
+		}
+		if opts.Quarantine {
+			if err := s.quarantine(c); err != nil {
+				log.Printf("gc: quarantine %s: %v", c.path, err)
+				continue
+			}
+			report.Quarantined++
+		} else {
+			if err := s.removeCandidate(c); err != nil {
+				log.Printf("gc: remove %s: %v", c.path, err)
+				continue
+			}
+			report.Removed++
+		}
+		metrics.AddCounter("entity_gc_reclaimed_bytes_total", nil, float64(c.size))
+	}
+	if !opts.DryRun {
+		s.removeUploadDirsLocked(candidates, parts)
+		metrics.AddCounter("entity_gc_orphans_total", nil, float64(report.Orphans))
+	}
+	return report, nil
+}
+
+// gcCandidates walks the body trees and returns the files last modified
+// before cutoff, along with the number of files seen.
+func (s *Store) gcCandidates(ctx context.Context, cutoff time.Time) ([]gcCandidate, int, error) {
+	var candidates []gcCandidate
+	scanned := 0
+	add := func(c gcCandidate, size int64, modTime time.Time) {
+		scanned++
+		if modTime.Before(cutoff) {
+			c.size = size
+			candidates = append(candidates, c)
+		}
+	}
+	for _, tree := range []string{"objects", "blobs"} {
+		err := s.backend.List(ctx, filepath.Join(s.dataDir, tree), func(b BlobInfo) error {
+			if tree == "blobs" && strings.HasPrefix(b.Name, filepath.Join(s.dataDir, "blobs", "tmp")+string(filepath.Separator)) {
+				return nil
+			}
+			c := gcCandidate{path: b.Name, root: s.dataDir, body: b.Name, blob: true}
+			if dir := filepath.Dir(b.Name); chunkedBody(dir) {
+				c.body = dir
+			}
+			add(c, b.Size, b.ModTime)
+			return nil
+		})
+		if err != nil {
+			return nil, scanned, err
+		}
+	}
+	uploads := filepath.Join(s.dataDir, "uploads")
+	err := s.backend.List(ctx, uploads, func(b BlobInfo) error {
+		rel, _ := filepath.Rel(uploads, b.Name)
+		id, _, _ := strings.Cut(rel, string(filepath.Separator))
+		add(gcCandidate{path: b.Name, root: s.dataDir, blob: true, upload: id}, b.Size, b.ModTime)
+		return nil
+	})
+	if err != nil {
+		return nil, scanned, err
+	}
+	if s.erasure != nil {
+		for i, d := range s.erasure.dirs {
+			shards := filepath.Join(d, "shards")
+			suffix := "." + strconv.Itoa(i)
+			err := walkFiles(ctx, shards, func(p string, fi fs.FileInfo) {
+				rel, _ := filepath.Rel(shards, p)
+				c := gcCandidate{path: p, root: d}
+				switch {
+				case strings.HasSuffix(rel, suffix):
+					c.body = filepath.Join(s.dataDir, strings.TrimSuffix(rel, suffix))
+				case strings.HasSuffix(rel, suffix+".tmp"), strings.HasSuffix(rel, suffix+".rebuild"):
+					c.temp = true
+					c.body = filepath.Join(s.dataDir, strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(rel, ".tmp"), ".rebuild"), suffix))
+				}
+				add(c, fi.Size(), fi.ModTime())
+			})
+			if err != nil {
+				return nil, scanned, err
+			}
+		}
+	}
+	return candidates, scanned, nil
+}
+
+// orphanLocked reports whether nothing refers to the file c.
+func (s *Store) orphanLocked(c gcCandidate, parts map[string]map[string]bool) bool {
+	switch {
+	case c.upload != "":
+		inUse, ok := parts[c.upload]
+		return !ok || !inUse[c.path]
+	case c.temp:
+		return !s.repairing[c.body]
+	case c.body != "":
+		return s.refs[c.body] == 0
+	}
+	return true
+}
+
+// removeUploadDirsLocked removes the directories of uploads no bucket knows
+// about once their files are gone.
+func (s *Store) removeUploadDirsLocked(candidates []gcCandidate, parts map[string]map[string]bool) {
+	for _, c := range candidates {
+		if _, ok := parts[c.upload]; c.upload != "" && !ok {
+			// Only succeeds once the directory is empty.
+			_ = s.backend.Delete(s.uploadDir(c.upload))
+		}
+	}
+}
+
+// uploadPartsLocked returns the part files of every upload in progress,
+// keyed by upload ID. Uploads that no bucket knows about are absent, so all
+// of their files are orphans.
+func (s *Store) uploadPartsLocked() map[string]map[string]bool {
+	out := map[string]map[string]bool{}
+	for _, b := range s.state.Buckets {
+		for id, u := range b.Uploads {
+			files := map[string]bool{}
+			for _, p := range u.Parts {
+				files[p.Path] = true
+			}
+			out[id] = files
+		}
+	}
+	return out
+}
+
+// walkFiles calls fn for every regular file under root. A missing root is
+// not an error.
+func walkFiles(ctx context.Context, root string, fn func(string, fs.FileInfo)) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fn(p, fi)
+		return nil
+	})
+}
+
+// quarantine moves the file c under c.root/quarantine, keeping its path
+// relative to c.root. Bodies and upload files are moved within the storage
+// backend; shards are always local.
+func (s *Store) quarantine(c gcCandidate) error {
+	rel, err := filepath.Rel(c.root, c.path)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(c.root, "quarantine", rel)
+	if c.blob {
+		return s.backend.Rename(c.path, dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+	return os.Rename(c.path, dst)
+}
+
+// removeCandidate removes the file c from wherever it is stored.
+func (s *Store) removeCandidate(c gcCandidate) error {
+	if c.blob {
+		if err := s.backend.Delete(c.path); err != nil {
+			return err
+		}
+		if c.body != "" && c.body != c.path {
+			// Only succeeds once the chunk directory is empty.
+			_ = s.backend.Delete(c.body)
+		}
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// RunGC collects garbage every interval until ctx is done.
+func (s *Store) RunGC(ctx context.Context, interval time.Duration, opts GCOptions) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.CollectGarbage(ctx, opts)
+			if err != nil {
+				log.Printf("gc: %v", err)
+				continue
+			}
+			if report.Orphans > 0 {
+				log.Printf("gc: %d orphaned files (%d bytes), %d removed, %d quarantined", report.Orphans, report.Bytes, report.Removed, report.Quarantined)
+			}
+		}
+	}
+}
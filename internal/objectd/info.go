@@ -0,0 +1,59 @@
+package objectd
+
+import (
+	"github.com/mchenetz/entity/internal/kv"
+)
+
+// StoreInfo describes how a store keeps its data and how much it holds.
+type StoreInfo struct {
+	DataDir     string `json:"dataDir"`
+	MetaBackend string `json:"metaBackend"`
+	Compression string `json:"compression,omitempty"`
+	// Encryption is set when an SSE master key is configured.
+	Encryption bool `json:"encryption"`
+	// Erasure is the data+parity layout new bodies are coded with.
+	Erasure    string `json:"erasure,omitempty"`
+	ChunkSize  int64  `json:"chunkSize,omitempty"`
+	CacheBytes int64  `json:"cacheBytes,omitempty"`
+	Buckets    int    `json:"buckets"`
+	Objects    int    `json:"objects"`
+	// Bytes sums the object sizes, before compression and deduplication.
+	Bytes int64 `json:"bytes"`
+	// Disk is the filesystem of the data directory, measured now.
+	Disk DiskStatus `json:"disk"`
+}
+
+// Info describes the store. The disk is measured on every call, whether or
+// not the disk watch runs.
+func (s *Store) Info() (StoreInfo, error) {
+	disk, err := statDisk(s.dataDir)
+	if err != nil {
+		return StoreInfo{}, err
+	}
+	disk.ReadOnly = s.readOnly.Load()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	info := StoreInfo{
+		DataDir:     s.dataDir,
+		MetaBackend: MetaBackendBolt,
+		Compression: s.compression,
+		Encryption:  s.masterKey != nil,
+		ChunkSize:   s.chunkSize,
+		Buckets:     len(s.state.Buckets),
+		Disk:        disk,
+	}
+	if _, ok := s.db.(*kv.SQLDB); ok {
+		info.MetaBackend = MetaBackendSQLite
+	}
+	if s.erasure != nil {
+		info.Erasure = s.erasure.layout
+	}
+	if s.cache != nil {
+		info.CacheBytes = s.cache.max
+	}
+	for _, b := range s.state.Buckets {
+		info.Objects += b.usage.Objects
+		info.Bytes += b.usage.Bytes
+	}
+	return info, nil
+}
@@ -0,0 +1,290 @@
+package objectd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+)
+
+// The journal is a write-ahead log of object writes and deletes. An entry is
+// appended and synced after the object body is on disk but before the
+// metadata change is applied, so a crash in between is replayed on the next
+// start instead of leaving a body nobody refers to or a record pointing at a
+// removed body. Once the entries are covered by persisted metadata the
+// journal is checkpointed, which truncates it.
+const (
+	journalPut    = "put"
+	journalDelete = "delete"
+
+	// journalCheckpointEntries is how many entries accumulate before the
+	// journal is truncated.
+	journalCheckpointEntries = 256
+)
+
+type journalEntry struct {
+	Op     string       `json:"op"`
+	Bucket string       `json:"bucket"`
+	Key    string       `json:"key"`
+	Object objectRecord `json:"object"`
+	// Replaces is the body of the version a put replaces. It is removed
+	// once the put is persisted.
+	Replaces string `json:"replaces,omitempty"`
+	// Purge marks the delete of a single version, which versioning does
+	// not keep.
+	Purge bool `json:"purge,omitempty"`
+}
+
+type journal struct {
+	f       *os.File
+	entries int
+}
+
+// openJournal opens the journal at path and returns the complete entries it
+// holds. A torn entry at the end, left by a crash during an append, is
+// dropped.
+func openJournal(path string) (*journal, []journalEntry, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []journalEntry
+	var valid int64
+	r := bufio.NewReader(f)
+	for {
+		e, n, err := readJournalEntry(r)
+		if err != nil {
+			break
+		}
+		entries = append(entries, e)
+		valid += n
+	}
+	if fi, err := f.Stat(); err == nil && fi.Size() > valid {
+		log.Printf("recovery: dropped %d bytes of a torn journal entry", fi.Size()-valid)
+	}
+	if err := f.Truncate(valid); err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return &journal{f: f, entries: len(entries)}, entries, nil
+}
+
+func readJournalEntry(r io.Reader) (journalEntry, int64, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return journalEntry{}, 0, err
+	}
+	payload := make([]byte, binary.LittleEndian.Uint32(hdr[0:4]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return journalEntry{}, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(hdr[4:8]) {
+		return journalEntry{}, 0, errors.New("journal: checksum mismatch")
+	}
+	var e journalEntry
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return journalEntry{}, 0, err
+	}
+	return e, int64(len(hdr) + len(payload)), nil
+}
+
+// append writes e and syncs it to disk.
+func (j *journal) append(e journalEntry) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	rec := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(rec[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(payload))
+	rec = append(rec, payload...)
+	off, err := j.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := j.f.Write(rec); err != nil {
+		_ = j.f.Truncate(off)
+		_, _ = j.f.Seek(off, io.SeekStart)
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.entries++
+	return nil
+}
+
+// checkpoint discards all entries. Callers must have persisted the metadata
+// the entries describe.
+func (j *journal) checkpoint() error {
+	if j.entries == 0 {
+		return nil
+	}
+	if err := j.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := j.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.entries = 0
+	return nil
+}
+
+func (j *journal) close() error { return j.f.Close() }
+
+// setObjectLocked journals and applies a new version of key. The replaced
+// body, if nothing else refers to it, is removed by persistLocked once the new
+// record is durable.
+func (s *Store) setObjectLocked(bucket string, b *bucketState, key string, rec objectRecord) error {
+	e := journalEntry{Op: journalPut, Bucket: bucket, Key: key, Object: rec}
+	if prev, ok := b.Objects[key]; ok && prev.Path != "" && prev.Path != rec.Path {
+		e.Replaces = prev.Path
+	}
+	prev, hadPrev := b.Objects[key]
+	if err := s.journal.append(e); err != nil {
+		return err
+	}
+	b.putRecord(key, rec)
+	s.markObject(bucket, key)
+	s.cache.forget(bucket, key)
+	s.retainLocked(rec.Path)
+	s.updateBasisLocked(bucket, key, prev, hadPrev, rec)
+	s.supersedeLocked(bucket, b, key, prev, hadPrev, rec)
+	return nil
+}
+
+// deleteObjectLocked journals and applies the removal of key, which must
+// exist, under the delete's sequence number.
+func (s *Store) deleteObjectLocked(bucket string, b *bucketState, key string, seq uint64) error {
+	prev := b.Objects[key]
+	if err := s.removeObjectLocked(bucket, b, key, seq, false); err != nil {
+		return err
+	}
+	s.retireLocked(bucket, b, key, prev, seq)
+	return nil
+}
+
+// removeObjectLocked journals and applies the removal of key, which must
+// exist, under the delete's sequence number. The removed record keeps its
+// body reference; purge marks the entry as the delete of a single version.
+func (s *Store) removeObjectLocked(bucket string, b *bucketState, key string, seq uint64, purge bool) error {
+	rec := b.Objects[key]
+	rec.Seq = seq
+	if err := s.journal.append(journalEntry{Op: journalDelete, Bucket: bucket, Key: key, Object: rec, Purge: purge}); err != nil {
+		return err
+	}
+	b.deleteRecord(key)
+	s.markObject(bucket, key)
+	s.cache.forget(bucket, key)
+	s.forgetLocked(bucket, key)
+	s.dropBasisLocked(basisID(bucket, key))
+	s.recordTombstoneLocked(bucket, key, seq)
+	return nil
+}
+
+// afterPersistLocked removes the bodies no record refers to any more and
+// checkpoints the journal when enough entries have accumulated.
+func (s *Store) afterPersistLocked() error {
+	for _, p := range s.obsolete {
+		if s.refs[p] == 0 {
+			s.removeBody(p)
+		}
+	}
+	s.obsolete = nil
+	if s.journal.entries < journalCheckpointEntries {
+		return nil
+	}
+	return s.journal.checkpoint()
+}
+
+// replayJournalLocked reapplies the journal entries that did not make it into
+// the persisted metadata before the last shutdown, then checkpoints.
+func (s *Store) replayJournalLocked(entries []journalEntry) error {
+	for _, e := range entries {
+		b, ok := s.state.Buckets[e.Bucket]
+		if !ok {
+			if e.Object.Path != "" {
+				s.removeBody(e.Object.Path)
+			}
+			continue
+		}
+		cur, exists := b.Objects[e.Key]
+		switch e.Op {
+		case journalPut:
+			switch {
+			case exists && cur.Path == e.Object.Path && cur.Seq == e.Object.Seq:
+				// Applied; only the replaced body may be left over.
+				if e.Replaces != "" {
+					s.obsolete = append(s.obsolete, e.Replaces)
+				}
+			case !exists && s.deletedSinceLocked(e.Bucket, e.Key, e.Object.Seq),
+				exists && cur.Seq == e.Object.Seq && cur.Pending && cur.ETag != e.Object.ETag:
+				// Deleted later, or a fetched body that failed verification.
+				if e.Object.Path != "" {
+					s.obsolete = append(s.obsolete, e.Object.Path)
+				}
+			case !exists || cur.Seq < e.Object.Seq || (cur.Seq == e.Object.Seq && cur.Pending):
+				if !e.Object.Pending {
+					if !s.bodyExists(e.Object) {
+						// The body was discarded after the entry was written.
+						continue
+					}
+				}
+				s.observeLocked(e.Object.Seq)
+				b.putRecord(e.Key, e.Object)
+				s.markObject(e.Bucket, e.Key)
+				s.retainLocked(e.Object.Path)
+				s.supersedeLocked(e.Bucket, b, e.Key, cur, exists, e.Object)
+			default:
+				// Superseded by a later write.
+				if e.Object.Path != "" && e.Object.Path != cur.Path {
+					s.obsolete = append(s.obsolete, e.Object.Path)
+				}
+			}
+		case journalDelete:
+			// The current version a purge promoted is older than the purge.
+			applied := e.Purge && (e.Object.Seq <= s.state.TombstoneFloor || s.deletedSinceLocked(e.Bucket, e.Key, e.Object.Seq-1))
+			if exists && cur.Seq <= e.Object.Seq && !applied {
+				s.observeLocked(e.Object.Seq)
+				b.deleteRecord(e.Key)
+				s.markObject(e.Bucket, e.Key)
+				s.recordTombstoneLocked(e.Bucket, e.Key, e.Object.Seq)
+				if e.Purge {
+					s.releaseLocked(cur.Path)
+					s.releaseTierLocked(cur, nil)
+					s.promoteLocked(e.Bucket, b, e.Key)
+				} else {
+					s.retireLocked(e.Bucket, b, e.Key, cur, e.Object.Seq)
+				}
+			} else if e.Object.Path != "" && (!exists || cur.Path != e.Object.Path) {
+				s.obsolete = append(s.obsolete, e.Object.Path)
+			}
+		}
+	}
+	if err := s.persistLocked(); err != nil {
+		return err
+	}
+	return s.journal.checkpoint()
+}
+
+// deletedSinceLocked reports whether a tombstone records a delete of key
+// after seq.
+func (s *Store) deletedSinceLocked(bucket, key string, seq uint64) bool {
+	for _, t := range s.state.Tombstones {
+		if t.Bucket == bucket && t.Key == key && t.Seq > seq {
+			return true
+		}
+	}
+	return false
+}
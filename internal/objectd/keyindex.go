@@ -0,0 +1,130 @@
+package objectd
+
+import (
+	"sort"
+)
+
+// keyIndex keeps the keys of a bucket in order so listings can start at a
+// prefix or continuation token without sorting the whole bucket. It is a
+// two-level B-tree: the keys live in sorted leaves of at most
+// keyIndexLeafMax keys, and the leaves are ordered by their first key. A
+// lookup binary-searches the leaves and then the leaf, and an insert or
+// delete moves at most one leaf's worth of keys plus one leaf pointer per
+// leaf, which stays cheap well beyond millions of keys.
+type keyIndex struct {
+	leaves [][]string
+	n      int
+}
+
+const keyIndexLeafMax = 512
+
+func (x *keyIndex) len() int { return x.n }
+
+// leafFor returns the leaf that holds key or would hold it.
+func (x *keyIndex) leafFor(key string) int {
+	// The first leaf whose first key is greater than key, minus one.
+	i := sort.Search(len(x.leaves), func(i int) bool { return x.leaves[i][0] > key })
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+// insert adds key unless it is present.
+func (x *keyIndex) insert(key string) {
+	if len(x.leaves) == 0 {
+		x.leaves = [][]string{{key}}
+		x.n = 1
+		return
+	}
+	li := x.leafFor(key)
+	leaf := x.leaves[li]
+	j := sort.SearchStrings(leaf, key)
+	if j < len(leaf) && leaf[j] == key {
+		return
+	}
+	leaf = append(leaf, "")
+	copy(leaf[j+1:], leaf[j:])
+	leaf[j] = key
+	x.n++
+	if len(leaf) <= keyIndexLeafMax {
+		x.leaves[li] = leaf
+		return
+	}
+	// Split the full leaf in two, copying the upper half so the halves do
+	// not share an array.
+	half := len(leaf) / 2
+	upper := append([]string(nil), leaf[half:]...)
+	x.leaves[li] = leaf[:half:half]
+	x.leaves = append(x.leaves, nil)
+	copy(x.leaves[li+2:], x.leaves[li+1:])
+	x.leaves[li+1] = upper
+}
+
+// remove deletes key if it is present.
+func (x *keyIndex) remove(key string) {
+	if len(x.leaves) == 0 {
+		return
+	}
+	li := x.leafFor(key)
+	leaf := x.leaves[li]
+	j := sort.SearchStrings(leaf, key)
+	if j == len(leaf) || leaf[j] != key {
+		return
+	}
+	copy(leaf[j:], leaf[j+1:])
+	leaf[len(leaf)-1] = ""
+	leaf = leaf[:len(leaf)-1]
+	x.n--
+	switch {
+	case len(leaf) == 0:
+		x.leaves = append(x.leaves[:li], x.leaves[li+1:]...)
+	case li+1 < len(x.leaves) && len(leaf)+len(x.leaves[li+1]) <= keyIndexLeafMax/2:
+		// Merge sparse neighbours so deletes do not leave many tiny leaves.
+		x.leaves[li] = append(leaf, x.leaves[li+1]...)
+		x.leaves = append(x.leaves[:li+1], x.leaves[li+2:]...)
+	default:
+		x.leaves[li] = leaf
+	}
+}
+
+// ascend calls fn for the keys from the first one at or after from, in
+// order, until fn returns false.
+func (x *keyIndex) ascend(from string, fn func(key string) bool) {
+	if len(x.leaves) == 0 {
+		return
+	}
+	li := x.leafFor(from)
+	j := sort.SearchStrings(x.leaves[li], from)
+	for ; li < len(x.leaves); li, j = li+1, 0 {
+		for _, k := range x.leaves[li][j:] {
+			if !fn(k) {
+				return
+			}
+		}
+	}
+}
+
+// build replaces the contents with keys, which are sorted in place.
+func (x *keyIndex) build(keys []string) {
+	sort.Strings(keys)
+	x.leaves = nil
+	x.n = len(keys)
+	for len(keys) > 0 {
+		n := min(len(keys), keyIndexLeafMax/2)
+		x.leaves = append(x.leaves, append([]string(nil), keys[:n]...))
+		keys = keys[n:]
+	}
+}
+
+// indexKeysLocked builds the key index of every bucket. It runs once after
+// loading; afterwards putRecord and deleteRecord maintain it.
+func (s *Store) indexKeysLocked() {
+	for _, b := range s.state.Buckets {
+		keys := make([]string, 0, len(b.Objects))
+		for k := range b.Objects {
+			keys = append(keys, k)
+		}
+		b.keys.build(keys)
+	}
+}
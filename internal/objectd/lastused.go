@@ -0,0 +1,108 @@
+package objectd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Each replica remembers when every access key last authenticated a request
+// it served, in memory, and saves it to the data directory now and then and
+// on close rather than on every request.
+
+// LastUsed is the last successful authentication of an access key.
+type LastUsed struct {
+	Time time.Time `json:"time"`
+	// SourceIP is the client address the request came from.
+	SourceIP string `json:"sourceIP,omitempty"`
+}
+
+func (s *Store) lastUsedPath() string { return filepath.Join(s.dataDir, "access-last-used.json") }
+
+func (s *Store) loadLastUsed() error {
+	s.lastUsed = map[string]LastUsed{}
+	b, err := os.ReadFile(s.lastUsedPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &s.lastUsed)
+}
+
+// RecordAccessUse notes that accessKey authenticated a request from ip.
+func (s *Store) RecordAccessUse(accessKey, ip string) {
+	s.lastUsedMu.Lock()
+	defer s.lastUsedMu.Unlock()
+	s.lastUsed[accessKey] = LastUsed{Time: time.Now().UTC(), SourceIP: ip}
+	s.lastUsedDirty = true
+}
+
+// AccessLastUsed returns the last use of every access key this replica
+// served, by access key.
+func (s *Store) AccessLastUsed() map[string]LastUsed {
+	s.lastUsedMu.Lock()
+	defer s.lastUsedMu.Unlock()
+	out := make(map[string]LastUsed, len(s.lastUsed))
+	for k, v := range s.lastUsed {
+		out[k] = v
+	}
+	return out
+}
+
+// saveLastUsed writes the last uses if they changed, dropping the keys that
+// no longer exist.
+func (s *Store) saveLastUsed() error {
+	live := map[string]bool{}
+	s.mu.RLock()
+	for _, b := range s.state.Buckets {
+		for k := range b.Access {
+			live[k] = true
+		}
+	}
+	s.mu.RUnlock()
+	s.lastUsedMu.Lock()
+	defer s.lastUsedMu.Unlock()
+	if !s.lastUsedDirty {
+		return nil
+	}
+	for k := range s.lastUsed {
+		if !live[k] {
+			delete(s.lastUsed, k)
+		}
+	}
+	b, err := json.Marshal(s.lastUsed)
+	if err != nil {
+		return err
+	}
+	tmp := s.lastUsedPath() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.lastUsedPath()); err != nil {
+		return err
+	}
+	s.lastUsedDirty = false
+	return nil
+}
+
+// RunLastUsedSave saves the last uses of access keys every interval.
+func (s *Store) RunLastUsedSave(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.saveLastUsed(); err != nil {
+				log.Printf("failed to save access key last use: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package objectd
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+)
+
+// Replicas find out where they diverge by exchanging manifests, a two-level
+// hash tree per bucket. The keys of a bucket are spread over ManifestRanges
+// ranges by their hash; a range's digest folds the key and sequence number
+// of every object in it, and the bucket's root folds the ranges. Only the
+// ranges whose digests differ are listed and compared object by object, and
+// a replica only ever takes what is newer on its peer, so a peer that is
+// behind catches up when it runs its own comparison. Deletes are only known
+// while their tombstones are retained (see tombstones.go).
+
+// ManifestRanges is the number of key ranges of a bucket manifest.
+const ManifestRanges = 64
+
+// Manifest summarizes the objects of every bucket whose replication is not
+// paused.
+type Manifest struct {
+	Clock   uint64           `json:"clock"`
+	Buckets []BucketManifest `json:"buckets"`
+}
+
+type BucketManifest struct {
+	Name   string   `json:"name"`
+	Root   uint64   `json:"root"`
+	Ranges []uint64 `json:"ranges"`
+}
+
+// ReconcileResult counts what a reconciliation changed.
+type ReconcileResult struct {
+	Pulled  int `json:"pulled"`
+	Deleted int `json:"deleted"`
+}
+
+func manifestRange(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % ManifestRanges)
+}
+
+func manifestDigest(key string, seq uint64) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	var buf [9]byte
+	binary.BigEndian.PutUint64(buf[1:], seq)
+	_, _ = h.Write(buf[:])
+	return h.Sum64()
+}
+
+// Manifest returns the manifest of the local store.
+func (s *Store) Manifest(_ context.Context) Manifest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := Manifest{Clock: s.state.Clock, Buckets: []BucketManifest{}}
+	for name, b := range s.state.Buckets {
+		if b.Replication.Paused {
+			continue
+		}
+		bm := BucketManifest{Name: name, Ranges: make([]uint64, ManifestRanges)}
+		for key, rec := range b.Objects {
+			d := manifestDigest(key, rec.Seq)
+			bm.Ranges[manifestRange(key)] ^= d
+			bm.Root ^= d
+		}
+		out.Buckets = append(out.Buckets, bm)
+	}
+	sort.Slice(out.Buckets, func(i, j int) bool { return out.Buckets[i].Name < out.Buckets[j].Name })
+	return out
+}
+
+// ManifestRange lists the objects and retained deletes of one range of a
+// bucket manifest.
+func (s *Store) ManifestRange(_ context.Context, bucket string, rng int) ([]ObjectChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	out := []ObjectChange{}
+	for key, rec := range b.Objects {
+		if manifestRange(key) != rng {
+			continue
+		}
+		m := rec.meta(bucket, key)
+		out = append(out, ObjectChange{Bucket: bucket, Key: key, Seq: rec.Seq, ETag: rec.ETag, Size: rec.Size, StorageClass: m.StorageClass, ContentType: m.ContentType, ExpiresAt: rec.ExpiresAt})
+	}
+	for _, t := range s.state.Tombstones {
+		if t.Bucket == bucket && manifestRange(t.Key) == rng {
+			out = append(out, ObjectChange{Bucket: bucket, Key: t.Key, Seq: t.Seq, Deleted: true})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Seq < out[j].Seq })
+	return out, nil
+}
+
+// ReconcileObjects applies what a peer's manifest range has that is newer
+// than the local copy. Deletes are applied directly; newer objects are
+// recorded as pending on origin, so the fetcher pulls their bodies from it
+// or any other peer.
+func (s *Store) ReconcileObjects(_ context.Context, bucket string, origin int, changes []ObjectChange) (ReconcileResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res ReconcileResult
+	b, ok := s.state.Buckets[bucket]
+	if !ok || b.Replication.Paused {
+		return res, nil
+	}
+	for _, ch := range changes {
+		s.observeLocked(ch.Seq)
+		rec, ok := b.Objects[ch.Key]
+		if ok && rec.Seq >= ch.Seq {
+			continue
+		}
+		if ch.Deleted {
+			if !ok {
+				// Remember the delete, so that the object is not taken
+				// back from a peer that missed it.
+				if !s.deletedSinceLocked(bucket, ch.Key, ch.Seq-1) {
+					s.recordTombstoneLocked(bucket, ch.Key, ch.Seq)
+				}
+				continue
+			}
+			if err := s.deleteObjectLocked(bucket, b, ch.Key, ch.Seq); err != nil {
+				return res, err
+			}
+			res.Deleted++
+			continue
+		}
+		if s.deletedSinceLocked(bucket, ch.Key, ch.Seq) {
+			continue
+		}
+		opts := PutOptions{StorageClass: ch.StorageClass, ContentType: ch.ContentType, ExpiresAt: parseExpiry(ch.ExpiresAt)}
+		if _, _, err := s.recordRemoteLocked(bucket, b, ch.Key, Blob{Size: ch.Size, ETag: ch.ETag}, origin, ch.Seq, opts); err != nil {
+			return res, err
+		}
+		res.Pulled++
+	}
+	return res, s.persistLocked()
+}
@@ -0,0 +1,490 @@
+package objectd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/kv"
+)
+
+// Metadata lives in a kv.Backend, one record per bucket, object, access key,
+// deferred change and tombstone, so a mutation only writes the records it
+// touched. Mutations mark their records dirty and persistLocked writes them
+// as one atomic batch.
+const (
+	metaRecord      = "meta"
+	bucketPrefix    = "bucket/"
+	objectPrefix    = "object/"
+	accessPrefix    = "access/"
+	changePrefix    = "change/"
+	uploadPrefix    = "upload/"
+	tombstonePrefix = "tombstone/"
+	trashPrefix     = "trash/"
+	versionPrefix   = "version/"
+)
+
+type metaHeader struct {
+	Clock          uint64            `json:"clock,omitempty"`
+	Domains        map[string]string `json:"domains,omitempty"`
+	TombstoneFloor uint64            `json:"tombstoneFloor,omitempty"`
+	Standby        standbyState      `json:"standby,omitempty"`
+	TierDeletes    []string          `json:"tierDeletes,omitempty"`
+	DeletedBuckets map[string]string `json:"deletedBuckets,omitempty"`
+	DeletedAccess  map[string]string `json:"deletedAccess,omitempty"`
+}
+
+type bucketHeader struct {
+	CreatedAt  string            `json:"createdAt"`
+	Paused     bool              `json:"paused,omitempty"`
+	PausedAt   string            `json:"pausedAt,omitempty"`
+	Encryption *encryptionConfig `json:"encryption,omitempty"`
+	TrashDays  int               `json:"trashDays,omitempty"`
+	Federation federationState   `json:"federation,omitempty"`
+	Copies     int               `json:"copies,omitempty"`
+	// Consistency is the bucket's default write consistency.
+	Consistency string `json:"consistency,omitempty"`
+	RenamedFrom string `json:"renamedFrom,omitempty"`
+	QuotaBytes  int64  `json:"quotaBytes,omitempty"`
+	PublicRead  bool   `json:"publicRead,omitempty"`
+	Versioning  string `json:"versioning,omitempty"`
+}
+
+func objectRecordKey(bucket, key string) string { return objectPrefix + bucket + "/" + key }
+
+func accessRecordKey(bucket, accessKey string) string {
+	return accessPrefix + bucket + "/" + accessKey
+}
+
+func uploadRecordKey(bucket, id string) string { return uploadPrefix + bucket + "/" + id }
+
+func changeRecordKey(bucket string, i uint64) string {
+	return fmt.Sprintf("%s%s/%020d", changePrefix, bucket, i)
+}
+
+func tombstoneRecordKey(t tombstone) string {
+	return fmt.Sprintf("%s%020d/%s/%s", tombstonePrefix, t.Seq, t.Bucket, t.Key)
+}
+
+// splitRecordKey splits "<bucket>/<rest>"; bucket names never contain '/'.
+func splitRecordKey(k string) (string, string, bool) {
+	return strings.Cut(k, "/")
+}
+
+func (s *Store) markMeta() { s.dirty[metaRecord] = true }
+
+func (s *Store) markBucket(name string) { s.dirty[bucketPrefix+name] = true }
+
+func (s *Store) markObject(bucket, key string) { s.dirty[objectRecordKey(bucket, key)] = true }
+
+func (s *Store) markAccess(bucket, accessKey string) {
+	s.dirty[accessRecordKey(bucket, accessKey)] = true
+}
+
+func (s *Store) markUpload(bucket, id string) { s.dirty[uploadRecordKey(bucket, id)] = true }
+
+// queuePut and queueDelete add records that are never rewritten in place,
+// such as changelog entries and tombstones, to the next batch.
+func (s *Store) queuePut(k string, v any) {
+	b, _ := json.Marshal(v)
+	s.queued.Put(k, b)
+}
+
+func (s *Store) queueDelete(k string) { s.queued.Delete(k) }
+
+func (s *Store) resetDirtyLocked() {
+	s.dirty = map[string]bool{}
+	s.queued = kv.Batch{}
+}
+
+// encodeLocked returns the current value of a record, or false if the record
+// no longer exists.
+func (s *Store) encodeLocked(k string) ([]byte, bool) {
+	var v any
+	switch {
+	case k == metaRecord:
+		v = metaHeader{Clock: s.state.Clock, Domains: s.state.Domains, TombstoneFloor: s.state.TombstoneFloor, Standby: s.state.Standby, TierDeletes: s.state.TierDeletes, DeletedBuckets: s.state.DeletedBuckets, DeletedAccess: s.state.DeletedAccess}
+	case strings.HasPrefix(k, bucketPrefix):
+		b, ok := s.state.Buckets[strings.TrimPrefix(k, bucketPrefix)]
+		if !ok {
+			return nil, false
+		}
+		v = bucketHeader{CreatedAt: b.CreatedAt, Paused: b.Replication.Paused, PausedAt: b.Replication.PausedAt, Encryption: b.Encryption, TrashDays: b.TrashDays, Federation: b.Federation, Copies: b.Copies, Consistency: b.Consistency, RenamedFrom: b.RenamedFrom,
+			QuotaBytes: b.QuotaBytes, PublicRead: b.PublicRead, Versioning: b.Versioning}
+	case strings.HasPrefix(k, objectPrefix):
+		bucket, key, _ := splitRecordKey(strings.TrimPrefix(k, objectPrefix))
+		b, ok := s.state.Buckets[bucket]
+		if !ok {
+			return nil, false
+		}
+		rec, ok := b.Objects[key]
+		if !ok {
+			return nil, false
+		}
+		v = rec
+	case strings.HasPrefix(k, accessPrefix):
+		bucket, ak, _ := splitRecordKey(strings.TrimPrefix(k, accessPrefix))
+		b, ok := s.state.Buckets[bucket]
+		if !ok {
+			return nil, false
+		}
+		rec, ok := b.Access[ak]
+		if !ok {
+			return nil, false
+		}
+		v = rec
+	case strings.HasPrefix(k, uploadPrefix):
+		bucket, id, _ := splitRecordKey(strings.TrimPrefix(k, uploadPrefix))
+		b, ok := s.state.Buckets[bucket]
+		if !ok {
+			return nil, false
+		}
+		u, ok := b.Uploads[id]
+		if !ok {
+			return nil, false
+		}
+		v = u
+	case strings.HasPrefix(k, trashPrefix):
+		bucket, idx, _ := splitRecordKey(strings.TrimPrefix(k, trashPrefix))
+		b, ok := s.state.Buckets[bucket]
+		if !ok {
+			return nil, false
+		}
+		id, _ := strconv.ParseUint(idx, 10, 64)
+		t, ok := b.trash[id]
+		if !ok {
+			return nil, false
+		}
+		v = t
+	case strings.HasPrefix(k, versionPrefix):
+		bucket, key, seq, _ := splitVersionRecordKey(strings.TrimPrefix(k, versionPrefix))
+		b, ok := s.state.Buckets[bucket]
+		if !ok {
+			return nil, false
+		}
+		var found bool
+		for _, ver := range b.versions[key] {
+			if ver.Object.Seq == seq {
+				v, found = ver, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+func (s *Store) persistLocked() error {
+	if len(s.dirty) > 0 || s.queued.Len() > 0 {
+		batch := s.queued
+		for k := range s.dirty {
+			if v, ok := s.encodeLocked(k); ok {
+				batch.Put(k, v)
+			} else {
+				batch.Delete(k)
+			}
+		}
+		if err := s.db.Update(&batch); err != nil {
+			return err
+		}
+		s.resetDirtyLocked()
+	}
+	if s.journal == nil {
+		// Still loading; the journal is replayed afterwards.
+		return nil
+	}
+	return s.afterPersistLocked()
+}
+
+func (s *Store) load(backend string) error {
+	if err := s.openBackend(backend); err != nil {
+		return err
+	}
+	s.resetDirtyLocked()
+	if err := s.loadDB(); err != nil {
+		return err
+	}
+	if err := s.migrateJSON(); err != nil {
+		return err
+	}
+	s.countRefsLocked()
+	s.countUsageLocked()
+	s.indexKeysLocked()
+	return nil
+}
+
+func (s *Store) openBackend(backend string) error {
+	boltPath := filepath.Join(s.dataDir, "metadata.db")
+	switch backend {
+	case "", MetaBackendBolt:
+		db, err := kv.Open(boltPath)
+		if err != nil {
+			return err
+		}
+		s.db = db
+		return nil
+	case MetaBackendSQLite:
+		db, err := kv.OpenSQLite(filepath.Join(s.dataDir, "metadata.sqlite"))
+		if err != nil {
+			return err
+		}
+		s.db = db
+		empty, err := db.Empty()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(boltPath); err != nil || !empty {
+			return nil
+		}
+		return s.importBolt(boltPath)
+	default:
+		return fmt.Errorf("unknown metadata backend %q", backend)
+	}
+}
+
+// importBolt copies the records of the default backend into the freshly
+// created backend in one batch and renames the bolt database out of the way.
+func (s *Store) importBolt(path string) error {
+	src, err := kv.Open(path)
+	if err != nil {
+		return err
+	}
+	var batch kv.Batch
+	err = src.ForEach("", func(k string, v []byte) error {
+		batch.Put(k, append([]byte(nil), v...))
+		return nil
+	})
+	_ = src.Close()
+	if err != nil {
+		return err
+	}
+	if err := s.db.Update(&batch); err != nil {
+		return fmt.Errorf("import %s: %w", path, err)
+	}
+	return os.Rename(path, path+".migrated")
+}
+
+func (s *Store) loadDB() error {
+	err := s.db.ForEach(bucketPrefix, func(k string, v []byte) error {
+		var h bucketHeader
+		if err := json.Unmarshal(v, &h); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		s.state.Buckets[strings.TrimPrefix(k, bucketPrefix)] = &bucketState{
+			CreatedAt:   h.CreatedAt,
+			Objects:     map[string]objectRecord{},
+			Access:      map[string]accessRecord{},
+			Uploads:     map[string]*uploadRecord{},
+			Replication: replicationState{Paused: h.Paused, PausedAt: h.PausedAt},
+			Encryption:  h.Encryption,
+			TrashDays:   h.TrashDays,
+			Federation:  h.Federation,
+			Copies:      h.Copies,
+			Consistency: h.Consistency,
+			RenamedFrom: h.RenamedFrom,
+			QuotaBytes:  h.QuotaBytes,
+			PublicRead:  h.PublicRead,
+			Versioning:  h.Versioning,
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if v, ok := s.db.Get(metaRecord); ok {
+		var h metaHeader
+		if err := json.Unmarshal(v, &h); err != nil {
+			return fmt.Errorf("%s: %w", metaRecord, err)
+		}
+		s.state.Clock, s.state.Domains, s.state.TombstoneFloor, s.state.Standby = h.Clock, h.Domains, h.TombstoneFloor, h.Standby
+		s.state.TierDeletes = h.TierDeletes
+		s.state.DeletedBuckets, s.state.DeletedAccess = h.DeletedBuckets, h.DeletedAccess
+	}
+	err = s.db.ForEach(objectPrefix, func(k string, v []byte) error {
+		bucket, key, _ := splitRecordKey(strings.TrimPrefix(k, objectPrefix))
+		b, ok := s.state.Buckets[bucket]
+		if !ok {
+			return nil
+		}
+		var rec objectRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		b.Objects[key] = rec
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = s.db.ForEach(accessPrefix, func(k string, v []byte) error {
+		bucket, ak, _ := splitRecordKey(strings.TrimPrefix(k, accessPrefix))
+		b, ok := s.state.Buckets[bucket]
+		if !ok {
+			return nil
+		}
+		var rec accessRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		b.Access[ak] = rec
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = s.db.ForEach(uploadPrefix, func(k string, v []byte) error {
+		bucket, id, _ := splitRecordKey(strings.TrimPrefix(k, uploadPrefix))
+		b, ok := s.state.Buckets[bucket]
+		if !ok {
+			return nil
+		}
+		var u uploadRecord
+		if err := json.Unmarshal(v, &u); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		b.Uploads[id] = &u
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = s.db.ForEach(changePrefix, func(k string, v []byte) error {
+		bucket, idx, _ := splitRecordKey(strings.TrimPrefix(k, changePrefix))
+		b, ok := s.state.Buckets[bucket]
+		if !ok {
+			return nil
+		}
+		i, err := strconv.ParseUint(idx, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		var c changeRecord
+		if err := json.Unmarshal(v, &c); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		if len(b.Replication.Pending) == 0 {
+			b.Replication.base = i
+		}
+		b.Replication.Pending = append(b.Replication.Pending, c)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = s.db.ForEach(tombstonePrefix, func(k string, v []byte) error {
+		var t tombstone
+		if err := json.Unmarshal(v, &t); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		if t.DeletedAt == "" {
+			// Written before tombstones were dated; they age from now.
+			t.DeletedAt = time.Now().UTC().Format(time.RFC3339Nano)
+			s.queuePut(k, t)
+		}
+		s.state.Tombstones = append(s.state.Tombstones, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = s.db.ForEach(trashPrefix, func(k string, v []byte) error {
+		bucket, idx, _ := splitRecordKey(strings.TrimPrefix(k, trashPrefix))
+		b, ok := s.state.Buckets[bucket]
+		if !ok {
+			return nil
+		}
+		id, err := strconv.ParseUint(idx, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		var t trashRecord
+		if err := json.Unmarshal(v, &t); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		if b.trash == nil {
+			b.trash = map[uint64]trashRecord{}
+		}
+		b.trash[id] = t
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Versions come in key and sequence order, oldest first.
+	return s.db.ForEach(versionPrefix, func(k string, v []byte) error {
+		bucket, key, _, ok := splitVersionRecordKey(strings.TrimPrefix(k, versionPrefix))
+		if !ok {
+			return fmt.Errorf("%s: malformed version record key", k)
+		}
+		b, ok := s.state.Buckets[bucket]
+		if !ok {
+			return nil
+		}
+		var ver versionRecord
+		if err := json.Unmarshal(v, &ver); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		if b.versions == nil {
+			b.versions = map[string][]versionRecord{}
+		}
+		b.versions[key] = append(b.versions[key], ver)
+		return nil
+	})
+}
+
+// migrateJSON imports a metadata.json written by earlier releases into an
+// empty database and renames it out of the way. The import is a single batch,
+// so a crash leaves either the old file or a complete database.
+func (s *Store) migrateJSON() error {
+	path := filepath.Join(s.dataDir, "metadata.json")
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(s.state.Buckets) == 0 && s.state.Clock == 0 && len(raw) > 0 {
+		var legacy metaState
+		if err := json.Unmarshal(raw, &legacy); err != nil {
+			return fmt.Errorf("migrate %s: %w", path, err)
+		}
+		if legacy.Buckets == nil {
+			legacy.Buckets = map[string]*bucketState{}
+		}
+		s.state = legacy
+		s.markMeta()
+		for name, b := range s.state.Buckets {
+			s.markBucket(name)
+			for key := range b.Objects {
+				s.markObject(name, key)
+			}
+			for ak := range b.Access {
+				s.markAccess(name, ak)
+			}
+			for i, c := range b.Replication.Pending {
+				s.queuePut(changeRecordKey(name, uint64(i)), c)
+			}
+		}
+		for _, t := range s.state.Tombstones {
+			s.queuePut(tombstoneRecordKey(t), t)
+		}
+		if err := s.persistLocked(); err != nil {
+			return fmt.Errorf("migrate %s: %w", path, err)
+		}
+	}
+	return os.Rename(path, path+".migrated")
+}
@@ -0,0 +1,479 @@
+package objectd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinPartSize is the smallest size of every part but the last, as in S3.
+const MinPartSize = 5 << 20
+
+// completedUploadRetention is how long a completed upload is remembered so
+// that retried CompleteMultipartUpload calls get the original result.
+const completedUploadRetention = 24 * time.Hour
+
+var (
+	ErrNoSuchUpload     = errors.New("the specified multipart upload does not exist")
+	ErrInvalidPart      = errors.New("one or more of the specified parts could not be found or its etag did not match")
+	ErrInvalidPartOrder = errors.New("the list of parts was not in ascending order")
+	ErrEntityTooSmall   = errors.New("a part other than the last is smaller than the minimum allowed size")
+)
+
+type uploadRecord struct {
+	Key          string             `json:"key"`
+	Initiated    string             `json:"initiated"`
+	StorageClass string             `json:"storageClass,omitempty"`
+	ContentType  string             `json:"contentType,omitempty"`
+	ExpiresAt    string             `json:"expiresAt,omitempty"`
+	Parts        map[int]partRecord `json:"parts,omitempty"`
+	// Completed is set once the parts have become an object. The upload is
+	// kept for a while so retried completions are answered idempotently.
+	Completed *completedUpload `json:"completed,omitempty"`
+}
+
+type partRecord struct {
+	Size       int64  `json:"size"`
+	ETag       string `json:"etag"`
+	Path       string `json:"path"`
+	Encryption string `json:"encryption,omitempty"`
+	IV         string `json:"iv,omitempty"`
+}
+
+type completedUpload struct {
+	At        string `json:"at"`
+	PartsHash string `json:"partsHash"`
+	ETag      string `json:"etag"`
+	Size      int64  `json:"size"`
+	Seq       uint64 `json:"seq"`
+}
+
+type Part struct {
+	Number int
+	Size   int64
+	ETag   string
+}
+
+// CompletedPart is one entry of a CompleteMultipartUpload request.
+type CompletedPart struct {
+	Number int
+	ETag   string
+}
+
+// Upload is a multipart upload in progress.
+type Upload struct {
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key"`
+	UploadID  string    `json:"uploadId"`
+	Initiated time.Time `json:"initiated"`
+	Parts     int       `json:"parts"`
+	Size      int64     `json:"size"`
+}
+
+// ListUploads returns the uploads in progress in bucket, or in every bucket
+// if bucket is empty, oldest first and then by upload ID.
+func (s *Store) ListUploads(_ context.Context, bucket string) ([]Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.state.Buckets[bucket]; bucket != "" && !ok {
+		return nil, ErrNotFound
+	}
+	out := []Upload{}
+	for name, b := range s.state.Buckets {
+		if bucket != "" && name != bucket {
+			continue
+		}
+		for id, u := range b.Uploads {
+			if u.Completed != nil {
+				continue
+			}
+			up := Upload{Bucket: name, Key: u.Key, UploadID: id, Parts: len(u.Parts)}
+			up.Initiated, _ = time.Parse(time.RFC3339Nano, u.Initiated)
+			for _, p := range u.Parts {
+				up.Size += p.Size
+			}
+			out = append(out, up)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Initiated.Equal(out[j].Initiated) {
+			return out[i].Initiated.Before(out[j].Initiated)
+		}
+		return out[i].UploadID < out[j].UploadID
+	})
+	return out, nil
+}
+
+// uploadDir names the directory the part files of upload id are stored
+// under, in the storage backend like object bodies.
+func (s *Store) uploadDir(id string) string {
+	return filepath.Join(s.dataDir, "uploads", id)
+}
+
+// removeUploadFiles removes the part files of upload id. Files it misses
+// are left to garbage collection.
+func (s *Store) removeUploadFiles(id string) {
+	dir := s.uploadDir(id)
+	err := s.backend.List(context.Background(), dir, func(b BlobInfo) error {
+		return s.backend.Delete(b.Name)
+	})
+	if err != nil {
+		log.Printf("remove upload %s: %v", id, err)
+	}
+	// Only succeeds once the directory is empty.
+	_ = s.backend.Delete(dir)
+}
+
+func (s *Store) CreateMultipartUpload(_ context.Context, bucket, key string, opts PutOptions) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("empty key")
+	}
+	storageClass, err := normalizeStorageClass(opts.StorageClass)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return "", ErrNotFound
+	}
+	id, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	if b.Uploads == nil {
+		b.Uploads = map[string]*uploadRecord{}
+	}
+	s.pruneUploadsLocked(bucket, b, time.Now().UTC())
+	b.Uploads[id] = &uploadRecord{Key: key, Initiated: time.Now().UTC().Format(time.RFC3339Nano), StorageClass: storageClass, ContentType: opts.ContentType, ExpiresAt: formatExpiry(opts.ExpiresAt)}
+	s.markUpload(bucket, id)
+	return id, s.persistLocked()
+}
+
+// pruneUploadsLocked forgets completed uploads past the retention window.
+func (s *Store) pruneUploadsLocked(bucket string, b *bucketState, now time.Time) {
+	for id, u := range b.Uploads {
+		if u.Completed == nil {
+			continue
+		}
+		at, _ := time.Parse(time.RFC3339Nano, u.Completed.At)
+		if now.Sub(at) > completedUploadRetention {
+			delete(b.Uploads, id)
+			s.markUpload(bucket, id)
+		}
+	}
+}
+
+// activeUploadLocked returns the upload if it exists for key and has not
+// been completed.
+func (s *Store) activeUploadLocked(bucket, key, id string) (*bucketState, *uploadRecord, error) {
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	u, ok := b.Uploads[id]
+	if !ok || u.Key != key || u.Completed != nil {
+		return nil, nil, ErrNoSuchUpload
+	}
+	return b, u, nil
+}
+
+// UploadPart stores one part of an upload, replacing an earlier upload of
+// the same part number.
+func (s *Store) UploadPart(_ context.Context, bucket, key, id string, number int, body io.Reader) (Part, error) {
+	if number < 1 {
+		return Part{}, fmt.Errorf("invalid part number %d", number)
+	}
+	unlock := s.lockUpload(id)
+	defer unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, u, err := s.activeUploadLocked(bucket, key, id)
+	if err != nil {
+		return Part{}, err
+	}
+	if s.readOnly.Load() {
+		return Part{}, ErrReadOnly
+	}
+	suffix, err := randomHex(8)
+	if err != nil {
+		return Part{}, err
+	}
+	dir := filepath.Join(s.dataDir, "blobs", "tmp")
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return Part{}, err
+	}
+	tmp := filepath.Join(dir, "part-"+suffix)
+	f, err := os.Create(tmp)
+	if err != nil {
+		return Part{}, err
+	}
+	var dst io.Writer = f
+	rec := partRecord{Path: filepath.Join(s.uploadDir(id), fmt.Sprintf("%05d-%s", number, suffix))}
+	if b.Encryption != nil {
+		w, iv, err := s.newEncryptWriterLocked(f)
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+			return Part{}, err
+		}
+		dst = w
+		rec.Encryption = b.Encryption.Algorithm
+		rec.IV = iv
+	}
+	h := sha256.New()
+	n, cpErr := io.Copy(io.MultiWriter(dst, h), body)
+	if cpErr == nil {
+		cpErr = f.Sync()
+	}
+	closeErr := f.Close()
+	if cpErr == nil {
+		cpErr = closeErr
+	}
+	if cpErr != nil {
+		_ = os.Remove(tmp)
+		return Part{}, diskFull(cpErr)
+	}
+	if err := s.backend.Put(rec.Path, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return Part{}, diskFull(err)
+	}
+	rec.Size = n
+	rec.ETag = hex.EncodeToString(h.Sum(nil))
+	prev, hadPrev := u.Parts[number]
+	if u.Parts == nil {
+		u.Parts = map[int]partRecord{}
+	}
+	u.Parts[number] = rec
+	s.markUpload(bucket, id)
+	if err := s.persistLocked(); err != nil {
+		return Part{}, err
+	}
+	if hadPrev {
+		_ = s.backend.Delete(prev.Path)
+	}
+	return Part{Number: number, Size: rec.Size, ETag: rec.ETag}, nil
+}
+
+func (s *Store) ListParts(_ context.Context, bucket, key, id string) ([]Part, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, u, err := s.activeUploadLocked(bucket, key, id)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Part, 0, len(u.Parts))
+	for n, p := range u.Parts {
+		out = append(out, Part{Number: n, Size: p.Size, ETag: p.ETag})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Number < out[j].Number })
+	return out, nil
+}
+
+func partsHash(parts []CompletedPart) string {
+	h := sha256.New()
+	for _, p := range parts {
+		fmt.Fprintf(h, "%d:%s\n", p.Number, strings.Trim(p.ETag, `"`))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type uploadLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockUpload takes the lock of upload id and returns the function releasing
+// it. It must not be called with the store lock held: a completion holds the
+// upload lock while it waits for the store lock.
+func (s *Store) lockUpload(id string) func() {
+	s.uploadLocksMu.Lock()
+	l, ok := s.uploadLocks[id]
+	if !ok {
+		l = &uploadLock{}
+		s.uploadLocks[id] = l
+	}
+	l.refs++
+	s.uploadLocksMu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		s.uploadLocksMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(s.uploadLocks, id)
+		}
+		s.uploadLocksMu.Unlock()
+	}
+}
+
+// completion is a CompleteMultipartUpload between checking the upload and
+// committing the assembled object.
+type completion struct {
+	// done is set if the upload was completed before; meta and current are
+	// the result to return then.
+	done    bool
+	meta    ObjectMeta
+	current bool
+
+	body    *stagedBody
+	files   []io.Closer
+	readers []io.Reader
+	opts    PutOptions
+}
+
+func (c *completion) closeParts() {
+	for _, f := range c.files {
+		_ = f.Close()
+	}
+	c.files = nil
+}
+
+// CompleteMultipartUpload concatenates the listed parts into the object.
+// Completions, part uploads and aborts of one upload are serialized on the
+// upload's own lock, so concurrent completions cannot interleave: the first
+// one assembles the object and the others, like later retries with the same
+// part list, get its result. The object is assembled without the store
+// lock, which is only taken to check the upload and to commit the result.
+// The boolean reports whether the returned object is still the current
+// version of the key and therefore has to be replicated.
+func (s *Store) CompleteMultipartUpload(_ context.Context, bucket, key, id string, parts []CompletedPart) (ObjectMeta, bool, error) {
+	hash := partsHash(parts)
+	unlock := s.lockUpload(id)
+	defer unlock()
+
+	s.mu.Lock()
+	c, err := s.beginCompletionLocked(bucket, key, id, hash, parts)
+	s.mu.Unlock()
+	if err != nil || c.done {
+		return c.meta, c.current, err
+	}
+	err = c.body.write(io.MultiReader(c.readers...))
+	c.closeParts()
+	if err != nil {
+		return ObjectMeta{}, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Nothing else touches the upload while its lock is held, but the
+	// bucket may have been deleted in the meantime.
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		c.body.discard()
+		return ObjectMeta{}, false, ErrNotFound
+	}
+	u, ok := b.Uploads[id]
+	if !ok {
+		c.body.discard()
+		return ObjectMeta{}, false, ErrNoSuchUpload
+	}
+	m, err := s.commitBodyLocked(bucket, b, key, c.body, 0, c.opts)
+	if err != nil {
+		return ObjectMeta{}, false, err
+	}
+	u.Parts = nil
+	u.Completed = &completedUpload{At: time.Now().UTC().Format(time.RFC3339Nano), PartsHash: hash, ETag: m.ETag, Size: m.Size, Seq: m.Seq}
+	s.markUpload(bucket, id)
+	if err := s.persistLocked(); err != nil {
+		return ObjectMeta{}, false, err
+	}
+	s.removeUploadFiles(id)
+	return m, true, nil
+}
+
+// beginCompletionLocked answers a completion of an upload completed before,
+// or checks the part list, opens the parts and stages the object's body.
+func (s *Store) beginCompletionLocked(bucket, key, id, hash string, parts []CompletedPart) (*completion, error) {
+	c := &completion{}
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return c, ErrNotFound
+	}
+	u, ok := b.Uploads[id]
+	if !ok || u.Key != key {
+		return c, ErrNoSuchUpload
+	}
+	if done := u.Completed; done != nil {
+		if done.PartsHash != hash {
+			return c, ErrNoSuchUpload
+		}
+		c.done = true
+		if rec, ok := b.Objects[key]; ok && rec.Seq == done.Seq {
+			c.meta, c.current = rec.meta(bucket, key), true
+			return c, nil
+		}
+		c.meta = objectRecord{Size: done.Size, ETag: done.ETag, ModTime: done.At, Seq: done.Seq, StorageClass: u.StorageClass}.meta(bucket, key)
+		return c, nil
+	}
+	if len(parts) == 0 {
+		return c, ErrInvalidPart
+	}
+	for i, p := range parts {
+		if i > 0 && p.Number <= parts[i-1].Number {
+			c.closeParts()
+			return c, ErrInvalidPartOrder
+		}
+		rec, ok := u.Parts[p.Number]
+		if !ok || rec.ETag != strings.Trim(p.ETag, `"`) {
+			c.closeParts()
+			return c, ErrInvalidPart
+		}
+		if i < len(parts)-1 && rec.Size < MinPartSize {
+			c.closeParts()
+			return c, ErrEntityTooSmall
+		}
+		f, err := s.backend.Get(rec.Path)
+		if err != nil {
+			c.closeParts()
+			return c, err
+		}
+		c.files = append(c.files, f)
+		if rec.Encryption == "" {
+			c.readers = append(c.readers, f)
+			continue
+		}
+		stream, err := s.ctrStream(rec.IV, 0)
+		if err != nil {
+			c.closeParts()
+			return c, err
+		}
+		c.readers = append(c.readers, &decryptReader{s: s, f: f, iv: rec.IV, stream: stream})
+	}
+	c.opts = PutOptions{StorageClass: u.StorageClass, ContentType: u.ContentType, ExpiresAt: parseExpiry(u.ExpiresAt)}
+	body, err := s.stageBodyLocked(b, key, c.opts)
+	if err != nil {
+		c.closeParts()
+		return c, err
+	}
+	c.body = body
+	return c, nil
+}
+
+func (s *Store) AbortMultipartUpload(_ context.Context, bucket, key, id string) error {
+	unlock := s.lockUpload(id)
+	defer unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, _, err := s.activeUploadLocked(bucket, key, id)
+	if err != nil {
+		return err
+	}
+	delete(b.Uploads, id)
+	s.markUpload(bucket, id)
+	if err := s.persistLocked(); err != nil {
+		return err
+	}
+	s.removeUploadFiles(id)
+	return nil
+}
@@ -0,0 +1,252 @@
+package objectd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// multipartFixture is an upload of two parts, a full-size first part and a
+// short last one.
+type multipartFixture struct {
+	store  *Store
+	bucket string
+	key    string
+	id     string
+	parts  [][]byte
+	etags  []string
+}
+
+func newMultipartFixture(t *testing.T) *multipartFixture {
+	t.Helper()
+	ctx := context.Background()
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	f := &multipartFixture{store: store, bucket: "uploads", key: "big/object"}
+	if err := store.CreateBucket(ctx, f.bucket); err != nil {
+		t.Fatal(err)
+	}
+	f.id, err = store.CreateMultipartUpload(ctx, f.bucket, f.key, PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.parts = [][]byte{
+		bytes.Repeat([]byte("a"), MinPartSize),
+		[]byte("the last part"),
+	}
+	for i, data := range f.parts {
+		p, err := store.UploadPart(ctx, f.bucket, f.key, f.id, i+1, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.etags = append(f.etags, p.ETag)
+	}
+	return f
+}
+
+// list returns the completion list of the given part numbers.
+func (f *multipartFixture) list(numbers ...int) []CompletedPart {
+	out := make([]CompletedPart, 0, len(numbers))
+	for _, n := range numbers {
+		out = append(out, CompletedPart{Number: n, ETag: `"` + f.etags[n-1] + `"`})
+	}
+	return out
+}
+
+// body returns the object the given part numbers assemble into.
+func (f *multipartFixture) body(numbers ...int) []byte {
+	var out []byte
+	for _, n := range numbers {
+		out = append(out, f.parts[n-1]...)
+	}
+	return out
+}
+
+func (f *multipartFixture) checkObject(t *testing.T, want []byte) ObjectMeta {
+	t.Helper()
+	m, r, err := f.store.OpenObject(context.Background(), f.bucket, f.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("object has %d bytes, want %d", len(got), len(want))
+	}
+	sum := sha256.Sum256(want)
+	if m.ETag != hex.EncodeToString(sum[:]) {
+		t.Fatalf("object ETag is %s, want the checksum of the assembled parts", m.ETag)
+	}
+	return m
+}
+
+func TestCompleteMultipartUploadRetries(t *testing.T) {
+	ctx := context.Background()
+	f := newMultipartFixture(t)
+	first, current, err := f.store.CompleteMultipartUpload(ctx, f.bucket, f.key, f.id, f.list(1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !current {
+		t.Fatal("first completion is not the current version")
+	}
+	f.checkObject(t, f.body(1, 2))
+
+	// SDKs retry a completion whose response was lost.
+	for i := 0; i < 5; i++ {
+		m, current, err := f.store.CompleteMultipartUpload(ctx, f.bucket, f.key, f.id, f.list(1, 2))
+		if err != nil {
+			t.Fatalf("retry %d: %v", i, err)
+		}
+		if !current || m.ETag != first.ETag || m.Seq != first.Seq || m.Size != first.Size {
+			t.Fatalf("retry %d returned %+v (current %v), want %+v", i, m, current, first)
+		}
+	}
+
+	// A retry with another part list is not the same request.
+	if _, _, err := f.store.CompleteMultipartUpload(ctx, f.bucket, f.key, f.id, f.list(1)); !errors.Is(err, ErrNoSuchUpload) {
+		t.Fatalf("completing with a different part list: got %v, want ErrNoSuchUpload", err)
+	}
+
+	// Once the key is overwritten, a retry still gets the upload's result
+	// but must not be replicated.
+	if _, err := f.store.PutObject(ctx, f.bucket, f.key, bytes.NewReader([]byte("newer"))); err != nil {
+		t.Fatal(err)
+	}
+	m, current, err := f.store.CompleteMultipartUpload(ctx, f.bucket, f.key, f.id, f.list(1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current || m.ETag != first.ETag || m.Seq != first.Seq {
+		t.Fatalf("retry after overwrite returned %+v (current %v), want %+v and not current", m, current, first)
+	}
+	f.checkObject(t, []byte("newer"))
+}
+
+func TestCompleteMultipartUploadConcurrent(t *testing.T) {
+	ctx := context.Background()
+	f := newMultipartFixture(t)
+	lists := [][]int{{1, 2}, {1}}
+
+	type result struct {
+		list    int
+		meta    ObjectMeta
+		current bool
+		err     error
+	}
+	const callers = 16
+	results := make([]result, callers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			l := i % len(lists)
+			m, current, err := f.store.CompleteMultipartUpload(ctx, f.bucket, f.key, f.id, f.list(lists[l]...))
+			results[i] = result{list: l, meta: m, current: current, err: err}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	// Exactly one part list wins; every caller with it gets the same
+	// object and every caller with the other is turned away.
+	winner := -1
+	var won ObjectMeta
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		if winner == -1 {
+			winner, won = r.list, r.meta
+		}
+		if r.list != winner {
+			t.Fatalf("both part lists completed the upload")
+		}
+		if !r.current || r.meta.ETag != won.ETag || r.meta.Seq != won.Seq || r.meta.Size != won.Size {
+			t.Fatalf("completions disagree: %+v (current %v) and %+v", r.meta, r.current, won)
+		}
+	}
+	if winner == -1 {
+		t.Fatal("no completion succeeded")
+	}
+	for i, r := range results {
+		if r.list == winner && r.err != nil {
+			t.Fatalf("caller %d with the winning part list failed: %v", i, r.err)
+		}
+		if r.list != winner && !errors.Is(r.err, ErrNoSuchUpload) {
+			t.Fatalf("caller %d with the losing part list: got %v, want ErrNoSuchUpload", i, r.err)
+		}
+	}
+	m := f.checkObject(t, f.body(lists[winner]...))
+	if m.ETag != won.ETag || m.Seq != won.Seq {
+		t.Fatalf("stored object %+v is not the one the completions returned, %+v", m, won)
+	}
+	uploads, err := f.store.ListUploads(ctx, f.bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads) != 0 {
+		t.Fatalf("completed upload is still listed: %+v", uploads)
+	}
+}
+
+func TestCompleteMultipartUploadDoesNotBlockStore(t *testing.T) {
+	ctx := context.Background()
+	f := newMultipartFixture(t)
+
+	// Hold the upload's lock, as a completion assembling a large object
+	// would, and check the rest of the store keeps serving.
+	unlock := f.store.lockUpload(f.id)
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := f.store.CompleteMultipartUpload(ctx, f.bucket, f.key, f.id, f.list(1, 2))
+		done <- err
+	}()
+	if _, err := f.store.PutObject(ctx, f.bucket, "other", bytes.NewReader([]byte("x"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := f.store.ListObjectsV2(ctx, f.bucket, "", "", 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.store.GetObjectMeta(ctx, f.bucket, "other"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("completion finished while its upload was locked: %v", err)
+	default:
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	f.checkObject(t, f.body(1, 2))
+}
+
+func TestCompleteMultipartUploadAfterAbort(t *testing.T) {
+	ctx := context.Background()
+	f := newMultipartFixture(t)
+	if err := f.store.AbortMultipartUpload(ctx, f.bucket, f.key, f.id); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.store.CompleteMultipartUpload(ctx, f.bucket, f.key, f.id, f.list(1, 2)); !errors.Is(err, ErrNoSuchUpload) {
+		t.Fatalf("completing an aborted upload: got %v, want ErrNoSuchUpload", err)
+	}
+	if _, err := f.store.GetObjectMeta(ctx, f.bucket, f.key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("aborted upload left an object: %v", err)
+	}
+}
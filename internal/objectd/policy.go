@@ -0,0 +1,253 @@
+package objectd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Policy is an IAM-style policy attached to an access key. When a key has
+// one, it decides what the key may do instead of the key's bucket and
+// read-only flag. A request is allowed if a statement allows it and none
+// denies it.
+type Policy struct {
+	Version   string            `json:"Version,omitempty"`
+	Statement []PolicyStatement `json:"Statement"`
+}
+
+// PolicyStatement matches requests by action, resource and conditions.
+// Actions and resources may contain * and ? wildcards. Resources are bucket
+// and object ARNs such as arn:aws:s3:::photos and arn:aws:s3:::photos/2024/*.
+type PolicyStatement struct {
+	Sid      string     `json:"Sid,omitempty"`
+	Effect   string     `json:"Effect"`
+	Action   StringList `json:"Action"`
+	Resource StringList `json:"Resource"`
+	// Condition maps an operator to condition keys and the values they are
+	// compared with.
+	Condition map[string]map[string]StringList `json:"Condition,omitempty"`
+}
+
+// StringList is a JSON string or array of strings.
+type StringList []string
+
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*l = StringList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("want a string or an array of strings")
+	}
+	*l = many
+	return nil
+}
+
+const (
+	PolicyEffectAllow = "Allow"
+	PolicyEffectDeny  = "Deny"
+
+	// ResourcePrefix starts every bucket and object ARN.
+	ResourcePrefix = "arn:aws:s3:::"
+)
+
+// PolicyActions are the actions the S3 API checks.
+var PolicyActions = []string{
+	"s3:ListAllMyBuckets",
+	"s3:CreateBucket",
+	"s3:DeleteBucket",
+	"s3:ListBucket",
+	"s3:GetEncryptionConfiguration",
+	"s3:PutEncryptionConfiguration",
+	"s3:GetBucketVersioning",
+	"s3:PutBucketVersioning",
+	"s3:ListBucketVersions",
+	"s3:GetObject",
+	"s3:GetObjectVersion",
+	"s3:PutObject",
+	"s3:DeleteObject",
+	"s3:DeleteObjectVersion",
+	"s3:RestoreObject",
+	"s3:ListMultipartUploadParts",
+	"s3:AbortMultipartUpload",
+}
+
+// Condition keys set by the S3 API.
+const (
+	ConditionPrefix          = "s3:prefix"
+	ConditionDelimiter       = "s3:delimiter"
+	ConditionSourceIP        = "aws:SourceIp"
+	ConditionSecureTransport = "aws:SecureTransport"
+)
+
+var policyConditionKeys = map[string]bool{ConditionPrefix: true, ConditionDelimiter: true, ConditionSourceIP: true, ConditionSecureTransport: true}
+
+var policyOperators = map[string]func(value string, want []string) bool{
+	"StringEquals":    stringEquals,
+	"StringNotEquals": not(stringEquals),
+	"StringLike":      stringLike,
+	"StringNotLike":   not(stringLike),
+	"Bool":            boolEquals,
+	"IpAddress":       inPrefixes,
+	"NotIpAddress":    not(inPrefixes),
+}
+
+// ParsePolicy decodes and validates a policy document.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate rejects statements that name unknown effects, actions,
+// operators or condition keys, so that a typo cannot silently widen or
+// narrow a key's access.
+func (p *Policy) Validate() error {
+	if len(p.Statement) == 0 {
+		return fmt.Errorf("invalid policy: no statements")
+	}
+	for i, st := range p.Statement {
+		if st.Effect != PolicyEffectAllow && st.Effect != PolicyEffectDeny {
+			return fmt.Errorf("invalid policy: statement %d: effect must be Allow or Deny", i)
+		}
+		if len(st.Action) == 0 || len(st.Resource) == 0 {
+			return fmt.Errorf("invalid policy: statement %d: needs an action and a resource", i)
+		}
+		for _, a := range st.Action {
+			if !anyOf(PolicyActions, func(known string) bool { return wildcardMatch(a, known) }) {
+				return fmt.Errorf("invalid policy: statement %d: action %q matches no S3 action", i, a)
+			}
+		}
+		for _, res := range st.Resource {
+			if res != "*" && !strings.HasPrefix(res, ResourcePrefix) {
+				return fmt.Errorf("invalid policy: statement %d: resource %q is not * or an %s ARN", i, res, ResourcePrefix)
+			}
+		}
+		for op, conds := range st.Condition {
+			if policyOperators[op] == nil {
+				return fmt.Errorf("invalid policy: statement %d: unsupported condition operator %q", i, op)
+			}
+			for key, values := range conds {
+				if !policyConditionKeys[key] {
+					return fmt.Errorf("invalid policy: statement %d: unsupported condition key %q", i, key)
+				}
+				if op == "IpAddress" || op == "NotIpAddress" {
+					if _, err := NormalizeCIDRs(values); err != nil {
+						return fmt.Errorf("invalid policy: statement %d: %w", i, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Allows reports whether the policy allows action on resource, given the
+// condition values of the request. A condition key the request has no value
+// for compares as the empty string.
+func (p *Policy) Allows(action, resource string, values map[string]string) bool {
+	allowed := false
+	for _, st := range p.Statement {
+		if !st.matches(action, resource, values) {
+			continue
+		}
+		if st.Effect == PolicyEffectDeny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+func (st PolicyStatement) matches(action, resource string, values map[string]string) bool {
+	if !anyOf(st.Action, func(a string) bool { return wildcardMatch(a, action) }) {
+		return false
+	}
+	if !anyOf(st.Resource, func(res string) bool { return wildcardMatch(res, resource) }) {
+		return false
+	}
+	for op, conds := range st.Condition {
+		for key, want := range conds {
+			if !policyOperators[op](values[key], want) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// BucketResource and ObjectResource return the ARNs policies match.
+func BucketResource(bucket string) string { return ResourcePrefix + bucket }
+
+func ObjectResource(bucket, key string) string { return ResourcePrefix + bucket + "/" + key }
+
+func anyOf(list []string, f func(string) bool) bool {
+	for _, v := range list {
+		if f(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringEquals(v string, want []string) bool {
+	return anyOf(want, func(w string) bool { return v == w })
+}
+
+func stringLike(v string, want []string) bool {
+	return anyOf(want, func(w string) bool { return wildcardMatch(w, v) })
+}
+
+func boolEquals(v string, want []string) bool {
+	return anyOf(want, func(w string) bool { return strings.EqualFold(v, w) })
+}
+
+func not(op func(string, []string) bool) func(string, []string) bool {
+	return func(v string, want []string) bool { return !op(v, want) }
+}
+
+func inPrefixes(v string, prefixes []string) bool {
+	addr, err := netip.ParseAddr(v)
+	if err != nil {
+		return false
+	}
+	return anyOf(prefixes, func(c string) bool {
+		p, err := ParsePrefix(c)
+		return err == nil && p.Contains(addr.Unmap())
+	})
+}
+
+// wildcardMatch matches s against pattern, where * matches any run of
+// characters, including none, and ? matches one character.
+func wildcardMatch(pattern, s string) bool {
+	star, mark := -1, 0
+	p, i := 0, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, i
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case star >= 0:
+			p = star + 1
+			mark++
+			i = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
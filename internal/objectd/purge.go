@@ -0,0 +1,103 @@
+package objectd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Purging empties a bucket in batches. Each batch deletes its records under
+// the store lock like single deletes do, then removes the bodies that lost
+// their last reference with a bounded number of concurrent workers before
+// the lock is released, so a body is never removed while a concurrent write
+// of the same content takes a new reference to it. Other requests get the
+// lock between batches. The trash and the noncurrent versions of the bucket
+// are emptied too, including what the purge's own deletes left there.
+
+const purgeBatchSize = 1000
+
+// DefaultPurgeWorkers is the number of concurrent body removals of a purge
+// unless StoreOptions.PurgeWorkers says otherwise.
+const DefaultPurgeWorkers = 16
+
+// PurgeBucket deletes every object, version and trash entry of bucket and
+// returns how many objects it deleted. Objects written while the purge runs
+// may survive it.
+func (s *Store) PurgeBucket(ctx context.Context, bucket string) (int, error) {
+	workers := s.purgeWorkers
+	if workers <= 0 {
+		workers = DefaultPurgeWorkers
+	}
+	n := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		deleted, done, err := s.purgeBatch(bucket, workers)
+		n += deleted
+		if err != nil || done {
+			return n, err
+		}
+	}
+}
+
+// purgeBatch deletes up to purgeBatchSize objects of bucket and reports
+// whether the bucket is empty afterwards.
+func (s *Store) purgeBatch(bucket string, workers int) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return 0, false, ErrNotFound
+	}
+	if b.Replication.Paused || len(b.Replication.Pending) > 0 {
+		return 0, false, fmt.Errorf("bucket replication is paused")
+	}
+	n := 0
+	for key := range b.Objects {
+		if n == purgeBatchSize {
+			break
+		}
+		if err := s.deleteObjectLocked(bucket, b, key, s.tickLocked()); err != nil {
+			return n, false, err
+		}
+		n++
+	}
+	// Objects the deletes moved to the trash go with the rest of it.
+	for id := range b.trash {
+		s.dropTrashLocked(bucket, b, id)
+	}
+	// So do the versions and delete markers they left in a versioned bucket.
+	s.dropVersionsLocked(bucket, b)
+	bodies := s.obsolete
+	s.obsolete = nil
+	if err := s.persistLocked(); err != nil {
+		s.obsolete = append(s.obsolete, bodies...)
+		return n, false, err
+	}
+	s.removeBodiesLocked(bodies, workers)
+	return n, len(b.Objects) == 0, nil
+}
+
+// removeBodiesLocked removes the bodies that are still unreferenced with up
+// to workers concurrent removals.
+func (s *Store) removeBodiesLocked(bodies []string, workers int) {
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(bodies); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for body := range work {
+				s.removeBody(body)
+			}
+		}()
+	}
+	for _, body := range bodies {
+		if s.refs[body] == 0 {
+			work <- body
+		}
+	}
+	close(work)
+	wg.Wait()
+}
@@ -0,0 +1,110 @@
+package objectd
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A crash can leave files behind that the journal does not know about:
+// staged and temporary bodies, half-written erasure shards, and bodies that
+// were written but never journaled. Every body that makes it into the store is journaled right
+// after it is written, so a body modified after the journal was last written
+// and still unreferenced once the journal is replayed belongs to a write
+// that never completed. Recovery runs before the store serves requests and
+// removes those files; older orphans are left to garbage collection.
+
+// recoverFiles removes the leftovers of an interrupted run. journalMod is
+// when the journal was last written before this start, zero if there was
+// none.
+func (s *Store) recoverFiles(journalMod time.Time) {
+	n := 0
+	for _, dir := range []string{filepath.Join(s.dataDir, "staging"), filepath.Join(s.dataDir, "blobs", "tmp")} {
+		n += countFiles(dir)
+		_ = os.RemoveAll(dir)
+	}
+	if n > 0 {
+		log.Printf("recovery: removed %d staged or temporary bodies", n)
+	}
+	if s.erasure != nil {
+		if n := s.removeShardTemps(); n > 0 {
+			log.Printf("recovery: removed %d partially written shards", n)
+		}
+	}
+	if journalMod.IsZero() {
+		return
+	}
+	n, bytes, err := s.removeUnjournaled(journalMod)
+	if err != nil {
+		log.Printf("recovery: %v", err)
+	}
+	if n > 0 {
+		log.Printf("recovery: removed %d bodies (%d bytes) written after %s that were never committed", n, bytes, journalMod.UTC().Format(time.RFC3339))
+	}
+}
+
+// removeShardTemps removes the temporary shard files of interrupted writes
+// and repairs. Nothing writes shards before the store is open.
+func (s *Store) removeShardTemps() int {
+	n := 0
+	for _, d := range s.erasure.dirs {
+		_ = walkFiles(context.Background(), filepath.Join(d, "shards"), func(p string, _ fs.FileInfo) {
+			if strings.HasSuffix(p, ".tmp") || strings.HasSuffix(p, ".rebuild") {
+				if os.Remove(p) == nil {
+					n++
+				}
+			}
+		})
+	}
+	return n
+}
+
+// removeUnjournaled removes the bodies modified after since that no record
+// refers to.
+func (s *Store) removeUnjournaled(since time.Time) (int, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	var bytes int64
+	for _, tree := range []string{"objects", "blobs"} {
+		var found []gcCandidate
+		err := s.backend.List(context.Background(), filepath.Join(s.dataDir, tree), func(b BlobInfo) error {
+			if !b.ModTime.After(since) {
+				return nil
+			}
+			c := gcCandidate{path: b.Name, root: s.dataDir, body: b.Name, blob: true, size: b.Size}
+			if dir := filepath.Dir(b.Name); chunkedBody(dir) {
+				c.body = dir
+			}
+			found = append(found, c)
+			return nil
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return n, bytes, err
+		}
+		for _, c := range found {
+			if !s.orphanLocked(c, nil) {
+				continue
+			}
+			if err := s.removeCandidate(c); err != nil {
+				log.Printf("recovery: remove %s: %v", c.path, err)
+				continue
+			}
+			n++
+			bytes += c.size
+		}
+	}
+	return n, bytes, nil
+}
+
+// countFiles returns the number of regular files under root.
+func countFiles(root string) int {
+	n := 0
+	_ = walkFiles(context.Background(), root, func(string, fs.FileInfo) { n++ })
+	return n
+}
@@ -0,0 +1,305 @@
+package objectd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrObjectPending is returned when an object's metadata has been committed
+// but its body has not yet been pulled from the peer that received it.
+var ErrObjectPending = errors.New("object body not yet replicated to this node")
+
+// Blob is an object body written to the staging area of the receiving node
+// before its metadata has been committed by the leader.
+type Blob struct {
+	ID   string
+	Size int64
+	ETag string
+}
+
+// PendingFetch describes an object whose body has to be pulled from a peer.
+type PendingFetch struct {
+	Bucket string
+	Key    string
+	ETag   string
+	Seq    uint64
+	Origin int
+}
+
+func (s *Store) stagingPath(id string) string {
+	return filepath.Join(s.dataDir, "staging", id)
+}
+
+// StageBlob streams body to the staging area without holding the store lock.
+func (s *Store) StageBlob(_ context.Context, body io.Reader) (Blob, error) {
+	if s.ReadOnly() {
+		return Blob{}, ErrReadOnly
+	}
+	if err := os.MkdirAll(filepath.Join(s.dataDir, "staging"), 0o750); err != nil {
+		return Blob{}, err
+	}
+	id, err := randomHex(24)
+	if err != nil {
+		return Blob{}, err
+	}
+	path := s.stagingPath(id)
+	f, err := os.Create(path)
+	if err != nil {
+		return Blob{}, err
+	}
+	h := sha256.New()
+	n, cpErr := io.Copy(io.MultiWriter(f, h), body)
+	closeErr := f.Close()
+	if cpErr == nil {
+		cpErr = closeErr
+	}
+	if cpErr != nil {
+		_ = os.Remove(path)
+		return Blob{}, diskFull(cpErr)
+	}
+	return Blob{ID: id, Size: n, ETag: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func (s *Store) DiscardBlob(_ context.Context, blob Blob) {
+	_ = os.Remove(s.stagingPath(blob.ID))
+}
+
+// CommitBlob moves a staged body into place under the sequence number
+// assigned by the leader. The staged file is removed either way.
+func (s *Store) CommitBlob(_ context.Context, bucket, key string, blob Blob, seq uint64, opts PutOptions) (ObjectMeta, bool, error) {
+	path := s.stagingPath(blob.ID)
+	defer os.Remove(path)
+	f, err := os.Open(path)
+	if err != nil {
+		return ObjectMeta{}, false, err
+	}
+	defer f.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.state.Buckets[bucket]; ok {
+		if prev, ok := b.Objects[key]; ok && prev.Seq > seq {
+			s.observeLocked(seq)
+			return prev.meta(bucket, key), false, nil
+		}
+	}
+	m, err := s.putObjectLocked(bucket, key, f, seq, opts)
+	if err != nil {
+		return ObjectMeta{}, false, err
+	}
+	return m, true, nil
+}
+
+// RecordRemoteObject commits the metadata of an object whose body is held by
+// the origin peer. A zero seq allocates the next sequence number, which is how
+// the leader orders commits from followers.
+func (s *Store) RecordRemoteObject(_ context.Context, bucket, key string, blob Blob, origin int, seq uint64, opts PutOptions) (ObjectMeta, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ObjectMeta{}, false, ErrNotFound
+	}
+	m, applied, err := s.recordRemoteLocked(bucket, b, key, blob, origin, seq, opts)
+	if err != nil || !applied {
+		return m, applied, err
+	}
+	if err := s.persistLocked(); err != nil {
+		return ObjectMeta{}, false, err
+	}
+	return m, true, nil
+}
+
+func (s *Store) recordRemoteLocked(bucket string, b *bucketState, key string, blob Blob, origin int, seq uint64, opts PutOptions) (ObjectMeta, bool, error) {
+	if key == "" {
+		return ObjectMeta{}, false, fmt.Errorf("empty key")
+	}
+	storageClass, err := normalizeStorageClass(opts.StorageClass)
+	if err != nil {
+		return ObjectMeta{}, false, err
+	}
+	prev, hadPrev := b.Objects[key]
+	if hadPrev && seq != 0 && prev.Seq >= seq {
+		s.observeLocked(seq)
+		if prev.Seq > seq {
+			s.conflictLocked(bucket, key, prev.Seq, seq, ChangePutObject)
+		}
+		return prev.meta(bucket, key), false, nil
+	}
+	if seq == 0 {
+		seq = s.tickLocked()
+	} else {
+		s.observeLocked(seq)
+	}
+	rec := objectRecord{
+		Size:         blob.Size,
+		ETag:         blob.ETag,
+		ModTime:      time.Now().UTC().Format(time.RFC3339Nano),
+		Seq:          seq,
+		StorageClass: storageClass,
+		Pending:      true,
+		Origin:       origin,
+		ContentType:  opts.ContentType,
+		ExpiresAt:    formatExpiry(opts.ExpiresAt),
+		Versioned:    b.versioned(key, seq),
+	}
+	if err := s.setObjectLocked(bucket, b, key, rec); err != nil {
+		return ObjectMeta{}, false, err
+	}
+	return rec.meta(bucket, key), true, nil
+}
+
+// AbortRemoteObject deletes the pending record of bucket/key that the
+// leader committed with seq for origin, whose body origin then failed to
+// keep, and returns the sequence number of the delete. A newer write of the
+// key is left alone and reported with ok false.
+func (s *Store) AbortRemoteObject(_ context.Context, bucket, key string, origin int, seq uint64) (uint64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return 0, false, ErrNotFound
+	}
+	rec, ok := b.Objects[key]
+	if !ok || rec.Seq != seq || !rec.Pending || rec.Origin != origin {
+		return 0, false, nil
+	}
+	del := s.tickLocked()
+	if err := s.deleteObjectLocked(bucket, b, key, del); err != nil {
+		return 0, false, err
+	}
+	return del, true, s.persistLocked()
+}
+
+// PendingFetches lists objects whose bodies still have to be pulled, oldest
+// sequence first.
+func (s *Store) PendingFetches(_ context.Context) []PendingFetch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []PendingFetch{}
+	for name, b := range s.state.Buckets {
+		for key, rec := range b.Objects {
+			if rec.Pending {
+				out = append(out, PendingFetch{Bucket: name, Key: key, ETag: rec.ETag, Seq: rec.Seq, Origin: rec.Origin})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Seq < out[j].Seq })
+	return out
+}
+
+// HeldObjects returns the objects whose bodies are stored here, oldest
+// first.
+func (s *Store) HeldObjects(_ context.Context) []ObjectMeta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []ObjectMeta{}
+	for name, b := range s.state.Buckets {
+		for key, rec := range b.Objects {
+			if !rec.Pending {
+				out = append(out, rec.meta(name, key))
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Seq < out[j].Seq })
+	return out
+}
+
+// PendingFetchOf returns the pending fetch of key, if its body still has to
+// be pulled.
+func (s *Store) PendingFetchOf(_ context.Context, bucket, key string) (PendingFetch, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return PendingFetch{}, false
+	}
+	rec, ok := b.Objects[key]
+	if !ok || !rec.Pending {
+		return PendingFetch{}, false
+	}
+	return PendingFetch{Bucket: bucket, Key: key, ETag: rec.ETag, Seq: rec.Seq, Origin: rec.Origin}, true
+}
+
+// CompleteFetch stores a pulled body for a pending object. The body is only
+// accepted if the object is still pending at seq and its checksum matches
+// the committed ETag.
+func (s *Store) CompleteFetch(_ context.Context, bucket, key string, seq uint64, body io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	prev, ok := b.Objects[key]
+	if !ok || !prev.Pending || prev.Seq != seq {
+		_, _ = io.Copy(io.Discard, body)
+		return nil
+	}
+	m, err := s.putObjectLocked(bucket, key, body, seq, PutOptions{StorageClass: prev.StorageClass, ContentType: prev.ContentType, ExpiresAt: parseExpiry(prev.ExpiresAt)})
+	if err != nil {
+		return err
+	}
+	if m.ETag != prev.ETag {
+		s.releaseLocked(m.Path)
+		b.putRecord(key, prev)
+		s.markObject(bucket, key)
+		if err := s.persistLocked(); err != nil {
+			return err
+		}
+		return fmt.Errorf("fetched body for %s/%s does not match etag %s", bucket, key, prev.ETag)
+	}
+	return nil
+}
+
+// RefetchObject drops the local body of key at seq, which failed
+// verification, and marks the object pending on origin so the fetcher pulls
+// a healthy copy; reads are served by origin meanwhile. Other objects sharing
+// the body are marked as well, so the new copy is not deduplicated against
+// the damaged one. Nothing happens if the object has changed since seq.
+func (s *Store) RefetchObject(_ context.Context, bucket, key string, seq uint64, origin int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	rec, ok := b.Objects[key]
+	if !ok || rec.Seq != seq || rec.Pending {
+		return nil
+	}
+	path := rec.Path
+	for name, b := range s.state.Buckets {
+		for k, rec := range b.Objects {
+			// Inline bodies are not shared.
+			if rec.Path != path || rec.Pending || path == "" && (name != bucket || k != key) {
+				continue
+			}
+			pending := objectRecord{
+				Size:          rec.Size,
+				ETag:          rec.ETag,
+				ModTime:       rec.ModTime,
+				Seq:           rec.Seq,
+				StorageClass:  rec.StorageClass,
+				RestoreExpiry: rec.RestoreExpiry,
+				ContentType:   rec.ContentType,
+				ExpiresAt:     rec.ExpiresAt,
+				Pending:       true,
+				Origin:        origin,
+				Versioned:     rec.Versioned,
+			}
+			if err := s.setObjectLocked(name, b, k, pending); err != nil {
+				return err
+			}
+		}
+	}
+	return s.persistLocked()
+}
@@ -0,0 +1,92 @@
+package objectd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RenameBucket gives the bucket old the name name. Only metadata moves:
+// object bodies stay where they were written, so a rename takes as long as
+// rewriting the bucket's records, whatever the size of its objects. Access
+// keys, uploads in progress, the trash, noncurrent versions and custom
+// domains move with the bucket; policies naming the old bucket are not rewritten.
+//
+// The bucket remembers its old name, so that a replica or standby that
+// missed the rename repeats it instead of copying the objects, and renaming
+// again to the same name succeeds.
+func (s *Store) RenameBucket(_ context.Context, old, name string) error {
+	if !validBucket(name) {
+		return fmt.Errorf("invalid bucket name")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[old]
+	if !ok {
+		if cur, ok := s.state.Buckets[name]; ok && cur.RenamedFrom == old {
+			return nil
+		}
+		return ErrNotFound
+	}
+	if _, ok := s.state.Buckets[name]; ok {
+		return ErrBucketExists
+	}
+	if b.Replication.Paused || len(b.Replication.Pending) > 0 {
+		return fmt.Errorf("bucket replication is paused")
+	}
+	if b.Federation.Enabled {
+		return fmt.Errorf("bucket is replicated to a remote cluster; disable federation first")
+	}
+	// New bodies are written under the new name.
+	if err := os.MkdirAll(filepath.Join(s.dataDir, "objects", name), 0o750); err != nil {
+		return err
+	}
+	delete(s.state.Buckets, old)
+	s.state.Buckets[name] = b
+	b.RenamedFrom = old
+	s.markBucket(old)
+	s.markBucket(name)
+	for key := range b.Objects {
+		s.markObject(old, key)
+		s.markObject(name, key)
+		s.cache.forget(old, key)
+		s.forgetLocked(old, key)
+		if basis, ok := s.bases[basisID(old, key)]; ok {
+			delete(s.bases, basisID(old, key))
+			s.bases[basisID(name, key)] = basis
+		}
+	}
+	for ak := range b.Access {
+		s.markAccess(old, ak)
+		s.markAccess(name, ak)
+	}
+	for id := range b.Uploads {
+		s.markUpload(old, id)
+		s.markUpload(name, id)
+	}
+	for id := range b.trash {
+		s.markTrash(old, id)
+		s.markTrash(name, id)
+	}
+	for key, vs := range b.versions {
+		for _, v := range vs {
+			s.markVersion(old, key, v.Object.Seq)
+			s.markVersion(name, key, v.Object.Seq)
+		}
+	}
+	for host, bucket := range s.state.Domains {
+		if bucket == old {
+			s.state.Domains[host] = name
+			s.markMeta()
+		}
+	}
+	s.state.DeletedBuckets = s.recordDeletionLocked(s.state.DeletedBuckets, old)
+	s.clearTombstoneLocked(s.state.DeletedBuckets, name)
+	if err := s.persistLocked(); err != nil {
+		return err
+	}
+	// Replaying a journal entry of the old name would find no bucket and
+	// remove the body the renamed bucket still refers to.
+	return s.journal.checkpoint()
+}
@@ -0,0 +1,162 @@
+package objectd
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+const (
+	ChangePutObject    = "put-object"
+	ChangeDeleteObject = "delete-object"
+)
+
+type replicationState struct {
+	Paused   bool           `json:"paused,omitempty"`
+	PausedAt string         `json:"pausedAt,omitempty"`
+	Pending  []changeRecord `json:"pending,omitempty"`
+
+	// base is the record index of Pending[0] in the metadata database.
+	base uint64
+}
+
+type changeRecord struct {
+	Op  string `json:"op"`
+	Key string `json:"key"`
+	At  string `json:"at"`
+}
+
+type Change struct {
+	Op  string
+	Key string
+	At  time.Time
+}
+
+type ReplicationStatus struct {
+	Bucket   string    `json:"bucket"`
+	Paused   bool      `json:"paused"`
+	PausedAt time.Time `json:"pausedAt,omitempty"`
+	Pending  int       `json:"pending"`
+}
+
+func (s *Store) SetReplicationPaused(_ context.Context, bucket string, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	if b.Replication.Paused == paused {
+		return nil
+	}
+	b.Replication.Paused = paused
+	b.Replication.PausedAt = ""
+	if paused {
+		b.Replication.PausedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	s.markBucket(bucket)
+	return s.persistLocked()
+}
+
+// DeferReplication records a mutation in the bucket changelog instead of
+// replicating it when replication for the bucket is paused.
+func (s *Store) DeferReplication(_ context.Context, bucket, op, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok || !b.Replication.Paused {
+		return false, nil
+	}
+	c := changeRecord{
+		Op:  op,
+		Key: key,
+		At:  time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	s.queuePut(changeRecordKey(bucket, b.Replication.base+uint64(len(b.Replication.Pending))), c)
+	b.Replication.Pending = append(b.Replication.Pending, c)
+	return true, s.persistLocked()
+}
+
+// PendingChanges returns the deferred changelog for a bucket, collapsed to the
+// latest change per key in the order the keys were last touched.
+func (s *Store) PendingChanges(_ context.Context, bucket string) ([]Change, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	latest := map[string]int{}
+	for i, c := range b.Replication.Pending {
+		latest[c.Key] = i
+	}
+	out := make([]Change, 0, len(latest))
+	for i, c := range b.Replication.Pending {
+		if latest[c.Key] != i {
+			continue
+		}
+		t, _ := time.Parse(time.RFC3339Nano, c.At)
+		out = append(out, Change{Op: c.Op, Key: c.Key, At: t})
+	}
+	return out, nil
+}
+
+// AckPendingChanges drops the first n entries of the raw changelog once they
+// have been delivered to peers.
+func (s *Store) AckPendingChanges(_ context.Context, bucket string, n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	if n > len(b.Replication.Pending) {
+		n = len(b.Replication.Pending)
+	}
+	for i := 0; i < n; i++ {
+		s.queueDelete(changeRecordKey(bucket, b.Replication.base+uint64(i)))
+	}
+	b.Replication.base += uint64(n)
+	if n == len(b.Replication.Pending) {
+		b.Replication.Pending = nil
+	} else {
+		b.Replication.Pending = append([]changeRecord(nil), b.Replication.Pending[n:]...)
+	}
+	return s.persistLocked()
+}
+
+func (s *Store) ReplicationPaused(_ context.Context, bucket string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	return ok && b.Replication.Paused
+}
+
+func (s *Store) PendingChangeCount(_ context.Context, bucket string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return 0
+	}
+	return len(b.Replication.Pending)
+}
+
+func (b *bucketState) replicationStatus(name string) ReplicationStatus {
+	t, _ := time.Parse(time.RFC3339Nano, b.Replication.PausedAt)
+	return ReplicationStatus{Bucket: name, Paused: b.Replication.Paused, PausedAt: t, Pending: len(b.Replication.Pending)}
+}
+
+func (s *Store) ReplicationStatuses(_ context.Context) []ReplicationStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []ReplicationStatus{}
+	for name, b := range s.state.Buckets {
+		if !b.Replication.Paused && len(b.Replication.Pending) == 0 {
+			continue
+		}
+		out = append(out, b.replicationStatus(name))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Bucket < out[j].Bucket })
+	return out
+}
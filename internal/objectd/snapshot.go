@@ -0,0 +1,244 @@
+package objectd
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// Snapshot is the metadata a new replica copies from a peer before it
+// serves traffic: buckets with their settings, access keys and custom
+// domains, and the tombstones of deleted buckets and access keys. Objects
+// are listed through the manifest.
+type Snapshot struct {
+	Clock          uint64            `json:"clock"`
+	Buckets        []BucketSnapshot  `json:"buckets"`
+	Access         []AccessKey       `json:"access"`
+	Domains        []Domain          `json:"domains"`
+	DeletedBuckets map[string]string `json:"deletedBuckets,omitempty"`
+	DeletedAccess  map[string]string `json:"deletedAccess,omitempty"`
+}
+
+// CatalogResult counts what MergeCatalog added.
+type CatalogResult struct {
+	Buckets    int `json:"buckets"`
+	AccessKeys int `json:"accessKeys"`
+	// Deleted counts buckets and access keys removed because snap holds
+	// their tombstones.
+	Deleted int `json:"deleted"`
+}
+
+type BucketSnapshot struct {
+	Name              string `json:"name"`
+	CreatedAt         string `json:"createdAt,omitempty"`
+	Encryption        string `json:"encryption,omitempty"`
+	TrashDays         int    `json:"trashDays,omitempty"`
+	Copies            int    `json:"copies,omitempty"`
+	Consistency       string `json:"consistency,omitempty"`
+	Federation        bool   `json:"federation,omitempty"`
+	ReplicationPaused bool   `json:"replicationPaused,omitempty"`
+	RenamedFrom       string `json:"renamedFrom,omitempty"`
+	QuotaBytes        int64  `json:"quotaBytes,omitempty"`
+	PublicRead        bool   `json:"publicRead,omitempty"`
+	Versioning        string `json:"versioning,omitempty"`
+}
+
+// Empty reports whether the store holds no buckets.
+func (s *Store) Empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.state.Buckets) == 0
+}
+
+func (s *Store) Snapshot(ctx context.Context) Snapshot {
+	s.mu.RLock()
+	out := Snapshot{Clock: s.state.Clock, Buckets: []BucketSnapshot{}, Access: []AccessKey{}}
+	for name, b := range s.state.Buckets {
+		bs := BucketSnapshot{Name: name, CreatedAt: b.CreatedAt, TrashDays: b.TrashDays, Copies: b.Copies, Consistency: b.Consistency, Federation: b.Federation.Enabled, ReplicationPaused: b.Replication.Paused, RenamedFrom: b.RenamedFrom,
+			QuotaBytes: b.QuotaBytes, PublicRead: b.PublicRead, Versioning: b.Versioning}
+		if b.Encryption != nil {
+			bs.Encryption = b.Encryption.Algorithm
+		}
+		out.Buckets = append(out.Buckets, bs)
+		for ak, rec := range b.Access {
+			out.Access = append(out.Access, rec.accessKey(ak, name))
+		}
+	}
+	out.DeletedBuckets = copyStrings(s.state.DeletedBuckets)
+	out.DeletedAccess = copyStrings(s.state.DeletedAccess)
+	s.mu.RUnlock()
+	sort.Slice(out.Buckets, func(i, j int) bool { return out.Buckets[i].Name < out.Buckets[j].Name })
+	sort.Slice(out.Access, func(i, j int) bool { return out.Access[i].AccessKey < out.Access[j].AccessKey })
+	out.Domains = s.ListDomains(ctx)
+	return out
+}
+
+// ApplySnapshot creates the buckets, access keys and domains of snap. The
+// replication of a bucket is not paused here, so that its objects can still
+// be reconciled; the caller pauses it afterwards.
+func (s *Store) ApplySnapshot(ctx context.Context, snap Snapshot) error {
+	for _, b := range snap.Buckets {
+		if err := s.applyBucketSnapshot(ctx, b); err != nil {
+			return err
+		}
+	}
+	for _, a := range snap.Access {
+		if err := s.PutAccess(ctx, a); err != nil {
+			return err
+		}
+	}
+	for _, d := range snap.Domains {
+		if err := s.PutDomain(ctx, d.Host, d.Bucket); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.DeletedBuckets = adoptTombstones(s.state.DeletedBuckets, snap.DeletedBuckets)
+	s.state.DeletedAccess = adoptTombstones(s.state.DeletedAccess, snap.DeletedAccess)
+	s.markMeta()
+	return s.persistLocked()
+}
+
+// adoptTombstones adds the tombstones of from that m lacks.
+func adoptTombstones(m, from map[string]string) map[string]string {
+	for name, at := range from {
+		if _, ok := m[name]; ok {
+			continue
+		}
+		if m == nil {
+			m = map[string]string{}
+		}
+		m[name] = at
+	}
+	return m
+}
+
+// MergeCatalog adds the buckets, access keys and domains of snap that the
+// store lacks, and removes those that snap holds tombstones for. Existing
+// ones keep their settings. A bucket deleted here is not taken back from a
+// snap in which it was created before the delete, and a bucket is only
+// removed while it is empty. A bucket renamed in snap is renamed here too.
+// An access key deleted here is never taken back.
+func (s *Store) MergeCatalog(ctx context.Context, snap Snapshot) (CatalogResult, error) {
+	var res CatalogResult
+	live := map[string]bool{}
+	for _, b := range snap.Buckets {
+		live[b.Name] = true
+	}
+	for _, a := range snap.Access {
+		live[a.AccessKey] = true
+	}
+	for _, b := range snap.Buckets {
+		if _, err := s.GetBucket(ctx, b.Name); err == nil {
+			continue
+		}
+		if s.deletedAfter(b.Name, b.CreatedAt) {
+			continue
+		}
+		if b.RenamedFrom != "" && !live[b.RenamedFrom] {
+			switch err := s.RenameBucket(ctx, b.RenamedFrom, b.Name); err {
+			case nil:
+				res.Buckets++
+				continue
+			case ErrNotFound:
+			default:
+				// Retried on the next merge rather than copying the objects.
+				log.Printf("bucket %s was renamed to %s on a peer but keeps its name here: %v", b.RenamedFrom, b.Name, err)
+				continue
+			}
+		}
+		if err := s.applyBucketSnapshot(ctx, b); err != nil {
+			return res, err
+		}
+		if err := s.SetReplicationPaused(ctx, b.Name, b.ReplicationPaused); err != nil {
+			return res, err
+		}
+		res.Buckets++
+	}
+	for _, a := range snap.Access {
+		if _, err := s.LookupAccessKey(ctx, a.AccessKey); err == nil || s.accessDeleted(a.AccessKey) {
+			continue
+		}
+		switch err := s.PutAccess(ctx, a); err {
+		case nil:
+			res.AccessKeys++
+		case ErrNotFound:
+		default:
+			return res, err
+		}
+	}
+	for _, d := range snap.Domains {
+		if _, ok := s.BucketForHost(ctx, d.Host); ok {
+			continue
+		}
+		if err := s.PutDomain(ctx, d.Host, d.Bucket); err != nil && err != ErrNotFound {
+			return res, err
+		}
+	}
+	for name, at := range snap.DeletedBuckets {
+		cur, err := s.GetBucket(ctx, name)
+		deleted, perr := time.Parse(time.RFC3339Nano, at)
+		if live[name] || err != nil || perr != nil || !cur.CreatedAt.Before(deleted) {
+			continue
+		}
+		if err := s.DeleteBucket(ctx, name); err != nil {
+			log.Printf("bucket %s was deleted on a peer but stays here: %v", name, err)
+			continue
+		}
+		res.Deleted++
+	}
+	for ak := range snap.DeletedAccess {
+		if live[ak] {
+			continue
+		}
+		if _, err := s.LookupAccessKey(ctx, ak); err != nil {
+			continue
+		}
+		if err := s.DeleteAccess(ctx, ak); err != nil {
+			return res, err
+		}
+		res.Deleted++
+	}
+	return res, nil
+}
+
+// deletedAfter reports whether bucket was deleted here after createdAt.
+func (s *Store) deletedAfter(bucket, createdAt string) bool {
+	s.mu.RLock()
+	at, ok := s.state.DeletedBuckets[bucket]
+	s.mu.RUnlock()
+	deleted, err := time.Parse(time.RFC3339Nano, at)
+	return ok && err == nil && deletedBefore(createdAt, deleted)
+}
+
+func copyStrings(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *Store) applyBucketSnapshot(ctx context.Context, b BucketSnapshot) error {
+	if err := s.CreateBucket(ctx, b.Name); err != nil {
+		return err
+	}
+	if err := s.PutBucketConfig(ctx, b.Name, BucketConfig{Versioning: b.Versioning, QuotaBytes: b.QuotaBytes, PublicRead: b.PublicRead, Encryption: b.Encryption}); err != nil {
+		return err
+	}
+	if err := s.SetBucketTrash(ctx, b.Name, b.TrashDays); err != nil {
+		return err
+	}
+	if err := s.SetBucketCopies(ctx, b.Name, b.Copies); err != nil {
+		return err
+	}
+	if err := s.SetBucketConsistency(ctx, b.Name, b.Consistency); err != nil {
+		return err
+	}
+	return s.SetFederation(ctx, b.Name, b.Federation)
+}
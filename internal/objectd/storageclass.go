@@ -0,0 +1,68 @@
+package objectd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	StorageClassStandard    = "STANDARD"
+	StorageClassGlacier     = "GLACIER"
+	StorageClassDeepArchive = "DEEP_ARCHIVE"
+)
+
+var ErrInvalidObjectState = errors.New("object is archived and must be restored before it can be read")
+
+func normalizeStorageClass(class string) (string, error) {
+	switch class {
+	case "", StorageClassStandard:
+		return "", nil
+	case StorageClassGlacier, StorageClassDeepArchive:
+		return class, nil
+	default:
+		return "", fmt.Errorf("invalid storage class %q", class)
+	}
+}
+
+// IsArchived reports whether the object lives in a cold storage class.
+func (m ObjectMeta) IsArchived() bool {
+	return m.StorageClass == StorageClassGlacier || m.StorageClass == StorageClassDeepArchive
+}
+
+// Readable reports whether the payload can be served: standard objects always,
+// archived objects only while a restored copy is available.
+func (m ObjectMeta) Readable(now time.Time) bool {
+	return !m.IsArchived() || now.Before(m.RestoreExpiry)
+}
+
+// RestoreObject makes an archived or offloaded object readable for the given
+// number of days. It reports whether a restored copy was already available.
+// Offloaded objects become readable once the tierer has brought their body
+// back.
+func (s *Store) RestoreObject(_ context.Context, bucket, key string, days int) (bool, error) {
+	if days < 1 {
+		return false, fmt.Errorf("days must be at least 1")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return false, ErrNotFound
+	}
+	rec, ok := b.Objects[key]
+	if !ok {
+		return false, ErrNotFound
+	}
+	m := rec.meta(bucket, key)
+	if !m.IsArchived() && m.TierKey == "" {
+		return false, ErrInvalidObjectState
+	}
+	now := time.Now().UTC()
+	already := now.Before(m.RestoreExpiry) && !m.Offloaded()
+	rec.RestoreExpiry = now.Add(time.Duration(days) * 24 * time.Hour).Format(time.RFC3339Nano)
+	b.putRecord(key, rec)
+	s.markObject(bucket, key)
+	return already, s.persistLocked()
+}
@@ -5,64 +5,282 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/mchenetz/entity/internal/kv"
 )
 
 var (
 	ErrNotFound  = errors.New("not found")
 	ErrForbidden = errors.New("forbidden")
+	// ErrChecksumMismatch is returned when a body does not match the size
+	// and ETag it was sent with.
+	ErrChecksumMismatch = errors.New("body does not match its expected size and ETag")
+	// ErrBucketExists is returned when a bucket is renamed to a name in use.
+	ErrBucketExists = errors.New("bucket already exists")
 )
 
 type Store struct {
-	mu       sync.RWMutex
-	dataDir  string
-	metaPath string
-	state    metaState
+	mu      sync.RWMutex
+	dataDir string
+	db      kv.Backend
+	state   metaState
+	dirty   map[string]bool
+	queued  kv.Batch
+	journal *journal
+	refs    map[string]int
+	// obsolete lists bodies to remove once the pending changes are persisted.
+	obsolete []string
+
+	masterKey []byte
+	standby   bool
+	readOnly  atomic.Bool
+	diskMu    sync.Mutex
+	disk      DiskStatus
+
+	maintenanceMu sync.Mutex
+	maintenance   atomic.Pointer[Maintenance]
+	writes        atomic.Int64
+
+	lastUsedMu    sync.Mutex
+	lastUsed      map[string]LastUsed
+	lastUsedDirty bool
+
+	compression     string
+	compressionSkip []string
+	inlineThreshold int64
+	chunkSize       int64
+	purgeWorkers    int
+	cache           *bodyCache
+
+	backend   Backend
+	erasure   *erasureSet
+	repairing map[string]bool
+
+	// uploadLocks serializes the operations on each multipart upload, so
+	// that a completion can assemble its object without the store lock.
+	uploadLocksMu sync.Mutex
+	uploadLocks   map[string]*uploadLock
+
+	clockNode uint64
+	conflicts []Conflict
+	// bases holds the bodies kept for delta fetches, by bucket/key.
+	bases map[string]objectRecord
+	// forget is told about objects that are deleted or renamed away.
+	forget func(bucket, key string)
 }
 
 type metaState struct {
 	Buckets map[string]*bucketState `json:"buckets"`
+	Clock   uint64                  `json:"clock,omitempty"`
+	Domains map[string]string       `json:"domains,omitempty"`
+
+	Tombstones     []tombstone `json:"tombstones,omitempty"`
+	TombstoneFloor uint64      `json:"tombstoneFloor,omitempty"`
+	// DeletedBuckets and DeletedAccess map deleted bucket names and access
+	// keys to when they were deleted, until the tombstones are purged.
+	DeletedBuckets map[string]string `json:"deletedBuckets,omitempty"`
+	DeletedAccess  map[string]string `json:"deletedAccess,omitempty"`
+	Standby        standbyState      `json:"standby,omitempty"`
+	TierDeletes    []string          `json:"tierDeletes,omitempty"`
 }
 
 type bucketState struct {
 	CreatedAt string                  `json:"createdAt"`
 	Objects   map[string]objectRecord `json:"objects"`
 	Access    map[string]accessRecord `json:"access"`
+
+	Replication replicationState         `json:"replication,omitempty"`
+	Encryption  *encryptionConfig        `json:"encryption,omitempty"`
+	Uploads     map[string]*uploadRecord `json:"uploads,omitempty"`
+	TrashDays   int                      `json:"trashDays,omitempty"`
+	Federation  federationState          `json:"federation,omitempty"`
+	Copies      int                      `json:"copies,omitempty"`
+	Consistency string                   `json:"consistency,omitempty"`
+	RenamedFrom string                   `json:"renamedFrom,omitempty"`
+	QuotaBytes  int64                    `json:"quotaBytes,omitempty"`
+	PublicRead  bool                     `json:"publicRead,omitempty"`
+	// Versioning is empty until versioning is first enabled or suspended.
+	Versioning string `json:"versioning,omitempty"`
+
+	usage Usage
+	trash map[uint64]trashRecord
+	keys  keyIndex
+	// versions holds the noncurrent versions of each key, oldest first,
+	// and versionBytes their size.
+	versions     map[string][]versionRecord
+	versionBytes int64
 }
 
 type objectRecord struct {
-	Size    int64  `json:"size"`
-	ETag    string `json:"etag"`
-	ModTime string `json:"modTime"`
-	Path    string `json:"path"`
+	Size       int64  `json:"size"`
+	ETag       string `json:"etag"`
+	ModTime    string `json:"modTime"`
+	Path       string `json:"path"`
+	Encryption string `json:"encryption,omitempty"`
+	IV         string `json:"iv,omitempty"`
+	Seq        uint64 `json:"seq,omitempty"`
+	// Compression is the codec the body is stored with; Size is always the
+	// uncompressed size.
+	Compression string `json:"compression,omitempty"`
+	// Erasure is the data+parity layout of an erasure-coded body.
+	Erasure string `json:"erasure,omitempty"`
+	// Tier is the key of the object's copy in the cold tier. While Path is
+	// empty, the body is only there.
+	Tier string `json:"tier,omitempty"`
+	// Inline holds the stored bytes of a small body kept in the record
+	// itself; Path is empty then.
+	Inline []byte `json:"inline,omitempty"`
+	// Chunks is the chunk map of a body stored in chunks under Path.
+	Chunks []chunkRecord `json:"chunks,omitempty"`
+
+	StorageClass  string `json:"storageClass,omitempty"`
+	RestoreExpiry string `json:"restoreExpiry,omitempty"`
+	ContentType   string `json:"contentType,omitempty"`
+	// ExpiresAt is when the sweeper deletes the object; empty keeps it.
+	ExpiresAt string `json:"expiresAt,omitempty"`
+
+	Pending bool `json:"pending,omitempty"`
+	Origin  int  `json:"origin,omitempty"`
+	// Versioned is set on versions written while versioning was enabled;
+	// their sequence number is their version ID. Others are the null
+	// version.
+	Versioned bool `json:"versioned,omitempty"`
+}
+
+func (rec objectRecord) meta(bucket, key string) ObjectMeta {
+	t, _ := time.Parse(time.RFC3339Nano, rec.ModTime)
+	restore, _ := time.Parse(time.RFC3339Nano, rec.RestoreExpiry)
+	expires, _ := time.Parse(time.RFC3339Nano, rec.ExpiresAt)
+	sc := rec.StorageClass
+	if sc == "" {
+		sc = StorageClassStandard
+	}
+	return ObjectMeta{Bucket: bucket, Key: key, VersionID: rec.versionID(), Size: rec.Size, ETag: rec.ETag, ModTime: t, Path: rec.Path, Encryption: rec.Encryption, Seq: rec.Seq, StorageClass: sc, RestoreExpiry: restore, Pending: rec.Pending, Origin: rec.Origin, iv: rec.IV, compression: rec.Compression, erasure: rec.Erasure, ContentType: rec.ContentType, TierKey: rec.Tier, ExpiresAt: expires, inline: rec.Inline, chunks: rec.Chunks}
 }
 
 type accessRecord struct {
-	SecretKey string `json:"secretKey"`
-	ReadOnly  bool   `json:"readOnly"`
+	SecretKey    string   `json:"secretKey"`
+	ReadOnly     bool     `json:"readOnly"`
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty"`
+	Owner        string   `json:"owner,omitempty"`
+	CreatedAt    string   `json:"createdAt,omitempty"`
+	ExpiresAt    string   `json:"expiresAt,omitempty"`
+	Policy       *Policy  `json:"policy,omitempty"`
+	RateLimit
+}
+
+func (rec accessRecord) accessKey(accessKey, bucket string) AccessKey {
+	a := AccessKey{AccessKey: accessKey, SecretKey: rec.SecretKey, Bucket: bucket, ReadOnly: rec.ReadOnly, AllowedCIDRs: rec.AllowedCIDRs, Owner: rec.Owner, Policy: rec.Policy, RateLimit: rec.RateLimit}
+	a.CreatedAt, _ = time.Parse(time.RFC3339Nano, rec.CreatedAt)
+	a.ExpiresAt, _ = time.Parse(time.RFC3339Nano, rec.ExpiresAt)
+	return a
 }
 
+// RateLimit caps the request rate and bandwidth of a single access key. Zero
+// values mean unlimited.
+type RateLimit struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond,omitempty"`
+	BytesPerSecond    int64   `json:"bytesPerSecond,omitempty"`
+}
+
+// Versioning states of a bucket. A bucket that never had versioning enabled
+// reports VersioningDisabled; once enabled, versioning can only be
+// suspended.
+const (
+	VersioningDisabled  = "Disabled"
+	VersioningEnabled   = "Enabled"
+	VersioningSuspended = "Suspended"
+)
+
 type Bucket struct {
-	Name      string
-	CreatedAt time.Time
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	Objects    int    `json:"objects"`
+	Size       int64  `json:"size"`
+	Encryption string `json:"encryption,omitempty"`
+	// QuotaBytes caps the bytes the bucket stores; zero means no quota.
+	QuotaBytes int64 `json:"quotaBytes"`
+	// Versioning is the bucket's versioning state. ObjectLock reports false
+	// until the store supports it, so summaries keep a stable shape.
+	Versioning  string            `json:"versioning"`
+	ObjectLock  bool              `json:"objectLock"`
+	Replication ReplicationStatus `json:"replication"`
+	// TrashDays is how long deleted objects stay restorable; zero means
+	// they are deleted right away.
+	TrashDays int `json:"trashDays"`
+	// Federated is set while the bucket is replicated to a remote cluster.
+	Federated bool `json:"federated,omitempty"`
+	// ReplicationFactor is how many replicas keep the bodies of the
+	// bucket's objects; zero means the cluster default.
+	ReplicationFactor int `json:"replicationFactor,omitempty"`
+	// WriteConsistency is the default write consistency of requests to
+	// the bucket; empty means the cluster default.
+	WriteConsistency string `json:"writeConsistency,omitempty"`
+	// RenamedFrom is the name the bucket had before its last rename.
+	RenamedFrom string `json:"renamedFrom,omitempty"`
+	// PublicRead is set when anyone may read the bucket's objects without
+	// credentials.
+	PublicRead bool `json:"publicRead,omitempty"`
+}
+
+func (b *bucketState) bucket(name string) Bucket {
+	t, _ := time.Parse(time.RFC3339Nano, b.CreatedAt)
+	out := Bucket{Name: name, CreatedAt: t, Objects: b.usage.Objects, Size: b.usage.Bytes, Versioning: b.versioning()}
+	if b.Encryption != nil {
+		out.Encryption = b.Encryption.Algorithm
+	}
+	out.Replication = b.replicationStatus(name)
+	out.TrashDays = b.TrashDays
+	out.Federated = b.Federation.Enabled
+	out.ReplicationFactor = b.Copies
+	out.WriteConsistency = b.Consistency
+	out.RenamedFrom = b.RenamedFrom
+	out.QuotaBytes = b.QuotaBytes
+	out.PublicRead = b.PublicRead
+	return out
 }
 
 type ObjectMeta struct {
-	Bucket  string
-	Key     string
-	Size    int64
-	ETag    string
-	ModTime time.Time
-	Path    string
+	Bucket string
+	Key    string
+	// VersionID is empty for the null version.
+	VersionID  string
+	Size       int64
+	ETag       string
+	ModTime    time.Time
+	Path       string
+	Encryption string
+	Seq        uint64
+
+	StorageClass  string
+	RestoreExpiry time.Time
+	ContentType   string
+	// ExpiresAt is when the object expires; zero if it does not.
+	ExpiresAt time.Time
+
+	// Pending is set while the body still lives only on the Origin peer.
+	Pending bool
+	Origin  int
+	// TierKey names the object's copy in the cold tier, if it has one.
+	TierKey string
+
+	iv          string
+	compression string
+	erasure     string
+	inline      []byte
+	chunks      []chunkRecord
 }
 
 type AccessKey struct {
@@ -70,24 +288,160 @@ type AccessKey struct {
 	SecretKey string `json:"secretKey"`
 	Bucket    string `json:"bucket"`
 	ReadOnly  bool   `json:"readOnly"`
+	// AllowedCIDRs restricts the client addresses the key may be used from.
+	// An empty list allows any address.
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty"`
+	// Owner is an opaque tag naming whoever created the key, such as the
+	// COSI BucketAccess it was issued for.
+	Owner string `json:"owner,omitempty"`
+	// CreatedAt is zero for keys created before it was recorded.
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+	// ExpiresAt is when the key stops being accepted; zero if it does not
+	// expire.
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+	// Policy, when set, decides what the key may do in place of Bucket and
+	// ReadOnly; Bucket then only says which bucket the key is deleted with.
+	Policy *Policy `json:"policy,omitempty"`
+	RateLimit
+	// LastUsed is the last request the key authenticated; nil if it was
+	// never used.
+	LastUsed *LastUsed `json:"lastUsed,omitempty"`
+}
+
+// Expired reports whether the key is past its expiry at now.
+func (a AccessKey) Expired(now time.Time) bool {
+	return !a.ExpiresAt.IsZero() && !now.Before(a.ExpiresAt)
+}
+
+// AccessOptions are the optional attributes of a new access key.
+type AccessOptions struct {
+	ReadOnly     bool
+	AllowedCIDRs []string
+	RateLimit    RateLimit
+	Owner        string
+	ExpiresAt    time.Time
+	Policy       *Policy
+}
+
+// Metadata backends selectable with StoreOptions.MetaBackend.
+const (
+	MetaBackendBolt   = "bolt"
+	MetaBackendSQLite = "sqlite"
+)
+
+type StoreOptions struct {
+	// MetaBackend selects where metadata is kept; empty means MetaBackendBolt.
+	MetaBackend string
+	// Compression is the codec new object bodies are stored with, except for
+	// content types matching a prefix in CompressionSkipTypes.
+	Compression          string
+	CompressionSkipTypes []string
+	// ErasureDirs, when set, stripes object bodies across these directories
+	// with ErasureDataShards data and ErasureParityShards parity shards. It
+	// needs one directory per shard, ideally each on its own disk.
+	ErasureDirs         []string
+	ErasureDataShards   int
+	ErasureParityShards int
+	// Backend stores object bodies; nil means NewPosixBackend. It cannot be
+	// combined with ErasureDirs.
+	Backend Backend
+	// InlineThreshold keeps bodies of up to this many stored bytes in the
+	// object record instead of a file. Zero disables inlining.
+	InlineThreshold int64
+	// CacheSize bounds the memory used for caching the bodies of recently
+	// read objects of up to CacheMaxObject bytes. Zero disables the cache.
+	CacheSize      int64
+	CacheMaxObject int64
+	// ChunkSize splits bodies of more stored bytes than this into chunks of
+	// this size. Zero stores every body whole. It is ignored with
+	// ErasureDirs.
+	ChunkSize int64
+	// PurgeWorkers bounds the concurrent body removals of a bucket purge.
+	// Zero uses DefaultPurgeWorkers.
+	PurgeWorkers int
 }
 
 func OpenStore(dataDir string) (*Store, error) {
+	return OpenStoreWithOptions(dataDir, StoreOptions{})
+}
+
+func OpenStoreWithOptions(dataDir string, opts StoreOptions) (*Store, error) {
+	if err := checkCompression(opts.Compression); err != nil {
+		return nil, err
+	}
 	if err := os.MkdirAll(filepath.Join(dataDir, "objects"), 0o750); err != nil {
 		return nil, err
 	}
 	s := &Store{
-		dataDir:  dataDir,
-		metaPath: filepath.Join(dataDir, "metadata.json"),
-		state:    metaState{Buckets: map[string]*bucketState{}},
+		dataDir: dataDir,
+		state:   metaState{Buckets: map[string]*bucketState{}},
+
+		compression:     opts.Compression,
+		compressionSkip: opts.CompressionSkipTypes,
+		inlineThreshold: opts.InlineThreshold,
+		chunkSize:       opts.ChunkSize,
+		purgeWorkers:    opts.PurgeWorkers,
+		backend:         opts.Backend,
+		repairing:       map[string]bool{},
+		uploadLocks:     map[string]*uploadLock{},
+	}
+	if opts.CacheSize > 0 {
+		s.cache = newBodyCache(opts.CacheSize, opts.CacheMaxObject)
+	}
+	if s.backend == nil {
+		s.backend = NewPosixBackend()
+	} else if len(opts.ErasureDirs) > 0 {
+		return nil, fmt.Errorf("erasure coding cannot be combined with a custom storage backend")
+	}
+	if len(opts.ErasureDirs) > 0 {
+		set, err := newErasureSet(dataDir, opts.ErasureDirs, opts.ErasureDataShards, opts.ErasureParityShards)
+		if err != nil {
+			return nil, err
+		}
+		s.erasure = set
+	}
+	if err := s.loadMaintenance(); err != nil {
+		return nil, fmt.Errorf("maintenance mode: %w", err)
+	}
+	if err := s.loadLastUsed(); err != nil {
+		log.Printf("failed to load access key last use: %v", err)
 	}
-	if err := s.load(); err != nil {
+	if err := s.load(opts.MetaBackend); err != nil {
+		if s.db != nil {
+			_ = s.db.Close()
+		}
+		return nil, err
+	}
+	var journalMod time.Time
+	if fi, err := os.Stat(filepath.Join(dataDir, "journal")); err == nil {
+		journalMod = fi.ModTime()
+	}
+	j, entries, err := openJournal(filepath.Join(dataDir, "journal"))
+	if err != nil {
+		_ = s.db.Close()
 		return nil, err
 	}
+	s.journal = j
+	if len(entries) > 0 {
+		log.Printf("recovery: replaying %d journal entries", len(entries))
+	}
+	if err := s.replayJournalLocked(entries); err != nil {
+		_ = s.Close()
+		return nil, fmt.Errorf("replay journal: %w", err)
+	}
+	s.recoverFiles(journalMod)
 	return s, nil
 }
 
-func (s *Store) Close() error { return nil }
+func (s *Store) Close() error {
+	if err := s.saveLastUsed(); err != nil {
+		log.Printf("failed to save access key last use: %v", err)
+	}
+	if s.journal != nil {
+		_ = s.journal.close()
+	}
+	return s.db.Close()
+}
 
 func (s *Store) CreateBucket(_ context.Context, name string) error {
 	if !validBucket(name) {
@@ -98,32 +452,76 @@ func (s *Store) CreateBucket(_ context.Context, name string) error {
 	if _, ok := s.state.Buckets[name]; ok {
 		return nil
 	}
+	if err := s.createBucketLocked(name); err != nil {
+		return err
+	}
+	s.clearTombstoneLocked(s.state.DeletedBuckets, name)
+	return s.persistLocked()
+}
+
+func (s *Store) createBucketLocked(name string) error {
 	s.state.Buckets[name] = &bucketState{
 		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
 		Objects:   map[string]objectRecord{},
 		Access:    map[string]accessRecord{},
+		Uploads:   map[string]*uploadRecord{},
 	}
-	if err := os.MkdirAll(filepath.Join(s.dataDir, "objects", name), 0o750); err != nil {
-		return err
-	}
-	return s.persistLocked()
+	s.markBucket(name)
+	return os.MkdirAll(filepath.Join(s.dataDir, "objects", name), 0o750)
 }
 
-func (s *Store) DeleteBucket(_ context.Context, name string) error {
+func (s *Store) DeleteBucket(ctx context.Context, name string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	b, ok := s.state.Buckets[name]
 	if !ok {
 		return ErrNotFound
 	}
-	if len(b.Objects) > 0 {
+	if len(b.Objects) > 0 || len(b.versions) > 0 {
 		return fmt.Errorf("bucket not empty")
 	}
+	if b.Replication.Paused || len(b.Replication.Pending) > 0 {
+		return fmt.Errorf("bucket replication is paused")
+	}
+	// The keys go with the bucket, and are tombstoned so that a peer that
+	// missed the delete does not bind them to a new bucket of this name.
+	for ak := range b.Access {
+		s.markAccess(name, ak)
+		s.state.DeletedAccess = s.recordDeletionLocked(s.state.DeletedAccess, ak)
+	}
+	for id := range b.Uploads {
+		s.markUpload(name, id)
+		s.removeUploadFiles(id)
+	}
+	for id := range b.trash {
+		s.dropTrashLocked(name, b, id)
+	}
 	delete(s.state.Buckets, name)
+	s.markBucket(name)
+	s.state.DeletedBuckets = s.recordDeletionLocked(s.state.DeletedBuckets, name)
+	for host, bucket := range s.state.Domains {
+		if bucket == name {
+			delete(s.state.Domains, host)
+			s.markMeta()
+		}
+	}
 	if err := s.persistLocked(); err != nil {
 		return err
 	}
-	return os.RemoveAll(filepath.Join(s.dataDir, "objects", name))
+	// Bodies copied into other buckets stay until their last copy is gone.
+	dir := filepath.Join(s.dataDir, "objects", name)
+	err := s.backend.List(ctx, dir, func(b BlobInfo) error {
+		if s.refs[b.Name] == 0 {
+			return s.backend.Delete(b.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_ = os.Remove(dir)
+	s.removeErasureDirLocked(dir)
+	return nil
 }
 
 func (s *Store) ListBuckets(_ context.Context) ([]Bucket, error) {
@@ -131,57 +529,235 @@ func (s *Store) ListBuckets(_ context.Context) ([]Bucket, error) {
 	defer s.mu.RUnlock()
 	out := make([]Bucket, 0, len(s.state.Buckets))
 	for name, b := range s.state.Buckets {
-		t, _ := time.Parse(time.RFC3339Nano, b.CreatedAt)
-		out = append(out, Bucket{Name: name, CreatedAt: t})
+		out = append(out, b.bucket(name))
 	}
 	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
 	return out, nil
 }
 
-func (s *Store) PutObject(_ context.Context, bucket, key string, body io.Reader) (ObjectMeta, error) {
+func (s *Store) GetBucket(_ context.Context, name string) (Bucket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[name]
+	if !ok {
+		return Bucket{}, ErrNotFound
+	}
+	return b.bucket(name), nil
+}
+
+type PutOptions struct {
+	StorageClass string
+	// ContentType is stored with the object and decides whether the body is
+	// compressed.
+	ContentType string
+	// ExpiresAt makes the object expire at that time.
+	ExpiresAt time.Time
+	// ExpectETag, when set, rejects the write with ErrChecksumMismatch
+	// unless the body has this ETag and ExpectSize bytes.
+	ExpectETag string
+	ExpectSize int64
+}
+
+// UseForget sets a function called with the bucket and key of every object
+// that is deleted or leaves with its bucket's old name, so that trackers
+// keyed by object drop it. It runs under the store lock and must not call
+// back into the store.
+func (s *Store) UseForget(f func(bucket, key string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forget = f
+}
+
+func (s *Store) forgetLocked(bucket, key string) {
+	if s.forget != nil {
+		s.forget(bucket, key)
+	}
+}
+
+func (s *Store) PutObject(ctx context.Context, bucket, key string, body io.Reader) (ObjectMeta, error) {
+	return s.PutObjectWithOptions(ctx, bucket, key, body, PutOptions{})
+}
+
+func (s *Store) PutObjectWithOptions(_ context.Context, bucket, key string, body io.Reader, opts PutOptions) (ObjectMeta, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.putObjectLocked(bucket, key, body, 0, opts)
+}
+
+// putObjectLocked stores the payload under key. A zero seq stamps the object
+// with the next value of the store's logical clock.
+func (s *Store) putObjectLocked(bucket, key string, body io.Reader, seq uint64, opts PutOptions) (ObjectMeta, error) {
+	m, err := s.writeObjectLocked(bucket, key, body, seq, opts)
+	if err != nil {
+		return ObjectMeta{}, err
+	}
+	if err := s.persistLocked(); err != nil {
+		return ObjectMeta{}, err
+	}
+	return m, nil
+}
+
+// writeObjectLocked is putObjectLocked without persisting, for callers that
+// commit further records in the same batch.
+func (s *Store) writeObjectLocked(bucket, key string, body io.Reader, seq uint64, opts PutOptions) (ObjectMeta, error) {
 	b, ok := s.state.Buckets[bucket]
 	if !ok {
 		return ObjectMeta{}, ErrNotFound
 	}
-	if key == "" {
-		return ObjectMeta{}, fmt.Errorf("empty key")
+	st, err := s.stageBodyLocked(b, key, opts)
+	if err != nil {
+		return ObjectMeta{}, err
 	}
-	if err := os.MkdirAll(filepath.Join(s.dataDir, "objects", bucket), 0o750); err != nil {
+	if err := st.write(body); err != nil {
 		return ObjectMeta{}, err
 	}
+	return s.commitBodyLocked(bucket, b, key, st, seq, opts)
+}
+
+// stagedBody is an object body being written to a temporary file under
+// blobs/tmp before it is moved into place. Only creating it needs the store
+// lock; the body can be written without it.
+type stagedBody struct {
+	id     string
+	path   string
+	f      *os.File
+	dst    io.Writer
+	zw     io.WriteCloser
+	stored int64
+	rec    objectRecord
+}
+
+// stageBodyLocked creates the temporary file of a new body of key in b,
+// encrypted and compressed as the bucket and opts ask.
+func (s *Store) stageBodyLocked(b *bucketState, key string, opts PutOptions) (*stagedBody, error) {
+	if key == "" {
+		return nil, fmt.Errorf("empty key")
+	}
+	if s.readOnly.Load() {
+		return nil, ErrReadOnly
+	}
+	storageClass, err := normalizeStorageClass(opts.StorageClass)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(s.dataDir, "blobs", "tmp")
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
 	id, err := randomHex(24)
 	if err != nil {
-		return ObjectMeta{}, err
+		return nil, err
 	}
-	path := filepath.Join(s.dataDir, "objects", bucket, id)
+	path := filepath.Join(dir, id)
 	f, err := os.Create(path)
 	if err != nil {
-		return ObjectMeta{}, err
+		return nil, err
+	}
+	st := &stagedBody{id: id, path: path, f: f, dst: f}
+	st.rec = objectRecord{Path: path, StorageClass: storageClass, ContentType: opts.ContentType, ExpiresAt: formatExpiry(opts.ExpiresAt)}
+	if b.Encryption != nil {
+		w, iv, err := s.newEncryptWriterLocked(f)
+		if err != nil {
+			st.discard()
+			return nil, err
+		}
+		st.dst = w
+		st.rec.Encryption = b.Encryption.Algorithm
+		st.rec.IV = iv
+	}
+	if st.rec.Compression = s.compressionFor(opts.ContentType); st.rec.Compression != CompressionNone {
+		if st.zw, err = codecs[st.rec.Compression].newWriter(st.dst); err != nil {
+			st.discard()
+			return nil, err
+		}
+		st.dst = st.zw
 	}
+	return st, nil
+}
+
+// write copies body into the staged file and syncs it. The file is removed
+// if that fails.
+func (st *stagedBody) write(body io.Reader) error {
 	h := sha256.New()
-	n, cpErr := io.Copy(io.MultiWriter(f, h), body)
-	closeErr := f.Close()
+	n, cpErr := io.Copy(io.MultiWriter(st.dst, h), body)
+	if cpErr == nil && st.zw != nil {
+		cpErr = st.zw.Close()
+	}
+	if cpErr == nil {
+		st.stored, cpErr = st.f.Seek(0, io.SeekCurrent)
+	}
+	if cpErr == nil {
+		// The body must be durable before the journal refers to it.
+		cpErr = st.f.Sync()
+	}
+	closeErr := st.f.Close()
+	st.f = nil
+	if cpErr == nil {
+		cpErr = closeErr
+	}
 	if cpErr != nil {
+		_ = os.Remove(st.path)
+		return diskFull(cpErr)
+	}
+	st.rec.Size = n
+	st.rec.ETag = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// discard removes the staged file.
+func (st *stagedBody) discard() {
+	if st.f != nil {
+		_ = st.f.Close()
+		st.f = nil
+	}
+	_ = os.Remove(st.path)
+}
+
+// commitBodyLocked moves the written body st into place and records it as
+// key in b. The staged file is gone afterwards either way.
+func (s *Store) commitBodyLocked(bucket string, b *bucketState, key string, st *stagedBody, seq uint64, opts PutOptions) (ObjectMeta, error) {
+	rec, path := st.rec, st.path
+	if opts.ExpectETag != "" && (rec.Size != opts.ExpectSize || rec.ETag != opts.ExpectETag) {
 		_ = os.Remove(path)
-		return ObjectMeta{}, cpErr
+		return ObjectMeta{}, fmt.Errorf("%w: got %d bytes with ETag %s, want %d bytes with ETag %s", ErrChecksumMismatch, rec.Size, rec.ETag, opts.ExpectSize, opts.ExpectETag)
 	}
-	if closeErr != nil {
+	var err error
+	if st.stored > 0 && st.stored <= s.inlineThreshold {
+		rec.Path = ""
+		rec.Inline, err = os.ReadFile(path)
 		_ = os.Remove(path)
-		return ObjectMeta{}, closeErr
+	} else if s.chunkSize > 0 && st.stored > s.chunkSize && s.erasure == nil {
+		if rec.Encryption == "" {
+			rec.Path = s.chunkDir(s.blobPath(rec.ETag, rec.Compression))
+		} else {
+			rec.Path = s.chunkDir(filepath.Join(s.dataDir, "objects", bucket, st.id))
+		}
+		rec.Chunks, err = s.storeChunksLocked(path, rec.Path)
+	} else if rec.Encryption == "" {
+		rec.Path, rec.Erasure, err = s.placeBlobLocked(path, rec.ETag, rec.Compression, st.stored)
+	} else {
+		rec.Path = filepath.Join(s.dataDir, "objects", bucket, st.id)
+		rec.Erasure, err = s.storeBodyLocked(path, rec.Path)
 	}
-	etag := hex.EncodeToString(h.Sum(nil))
-	now := time.Now().UTC()
-
-	if prev, ok := b.Objects[key]; ok && prev.Path != path {
-		_ = os.Remove(prev.Path)
+	if err != nil {
+		_ = os.Remove(path)
+		return ObjectMeta{}, err
 	}
-	b.Objects[key] = objectRecord{Size: n, ETag: etag, ModTime: now.Format(time.RFC3339Nano), Path: path}
-	if err := s.persistLocked(); err != nil {
+	rec.ModTime = time.Now().UTC().Format(time.RFC3339Nano)
+	if seq == 0 {
+		rec.Seq = s.tickLocked()
+	} else {
+		rec.Seq = seq
+		s.observeLocked(seq)
+	}
+	rec.Versioned = b.versioned(key, rec.Seq)
+	if err := s.setObjectLocked(bucket, b, key, rec); err != nil {
+		if rec.Path != "" && s.refs[rec.Path] == 0 {
+			s.removeBody(rec.Path)
+		}
 		return ObjectMeta{}, err
 	}
-	return ObjectMeta{Bucket: bucket, Key: key, Size: n, ETag: etag, ModTime: now, Path: path}, nil
+	return rec.meta(bucket, key), nil
 }
 
 func (s *Store) GetObjectMeta(_ context.Context, bucket, key string) (ObjectMeta, error) {
@@ -195,39 +771,105 @@ func (s *Store) GetObjectMeta(_ context.Context, bucket, key string) (ObjectMeta
 	if !ok {
 		return ObjectMeta{}, ErrNotFound
 	}
-	t, _ := time.Parse(time.RFC3339Nano, rec.ModTime)
-	return ObjectMeta{Bucket: bucket, Key: key, Size: rec.Size, ETag: rec.ETag, ModTime: t, Path: rec.Path}, nil
+	return rec.meta(bucket, key), nil
+}
+
+// GetObjectMetaOrClock is GetObjectMeta, but also returns the clock when
+// the key does not exist, to replicate its absence with. Any later write of
+// the key exceeds it.
+func (s *Store) GetObjectMetaOrClock(_ context.Context, bucket, key string) (ObjectMeta, uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ObjectMeta{}, s.state.Clock, ErrNotFound
+	}
+	rec, ok := b.Objects[key]
+	if !ok {
+		return ObjectMeta{}, s.state.Clock, ErrNotFound
+	}
+	return rec.meta(bucket, key), 0, nil
+}
+
+func (s *Store) OpenObject(ctx context.Context, bucket, key string) (ObjectMeta, io.ReadSeekCloser, error) {
+	return s.openObject(ctx, bucket, key, true)
+}
+
+// OpenStoredObject is OpenObject, but always reads the body from storage
+// instead of the read cache.
+func (s *Store) OpenStoredObject(ctx context.Context, bucket, key string) (ObjectMeta, io.ReadSeekCloser, error) {
+	return s.openObject(ctx, bucket, key, false)
 }
 
-func (s *Store) OpenObject(ctx context.Context, bucket, key string) (ObjectMeta, *os.File, error) {
+func (s *Store) openObject(ctx context.Context, bucket, key string, cached bool) (ObjectMeta, io.ReadSeekCloser, error) {
 	m, err := s.GetObjectMeta(ctx, bucket, key)
 	if err != nil {
 		return ObjectMeta{}, nil, err
 	}
-	f, err := os.Open(m.Path)
-	if errors.Is(err, os.ErrNotExist) {
-		return ObjectMeta{}, nil, ErrNotFound
+	if m.Pending {
+		return m, nil, ErrObjectPending
+	}
+	if m.Offloaded() {
+		return m, nil, ErrObjectOffloaded
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if cached && s.cache.cacheable(m) {
+		body, err := s.openCachedLocked(m)
+		if err != nil {
+			return ObjectMeta{}, nil, err
+		}
+		return m, body, nil
+	}
+	f, err := s.openStoredLocked(m)
+	if err != nil {
+		return ObjectMeta{}, nil, err
+	}
+	body, err := s.bodyReaderLocked(f, m)
+	if err != nil {
+		_ = f.Close()
+		return ObjectMeta{}, nil, err
 	}
-	return m, f, err
+	return m, body, nil
 }
 
-func (s *Store) DeleteObject(_ context.Context, bucket, key string) error {
+// bodyReaderLocked wraps the stored body f of m so it reads as plaintext.
+func (s *Store) bodyReaderLocked(f io.ReadSeekCloser, m ObjectMeta) (io.ReadSeekCloser, error) {
+	var body io.ReadSeekCloser = f
+	if m.Encryption != "" {
+		if s.masterKey == nil {
+			return nil, ErrEncryptionNotConfigured
+		}
+		stream, err := s.ctrStream(m.iv, 0)
+		if err != nil {
+			return nil, err
+		}
+		body = &decryptReader{s: s, f: f, iv: m.iv, stream: stream}
+	}
+	if m.compression == CompressionNone {
+		return body, nil
+	}
+	return newDecompressReader(body, m.compression, m.Size)
+}
+
+// DeleteObject deletes bucket/key and returns the sequence number to
+// replicate the delete with. If the key does not exist, it is the clock at
+// the time, which any later write of the key exceeds.
+func (s *Store) DeleteObject(_ context.Context, bucket, key string) (uint64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	b, ok := s.state.Buckets[bucket]
 	if !ok {
-		return ErrNotFound
+		return 0, ErrNotFound
 	}
-	rec, ok := b.Objects[key]
-	if !ok {
-		return nil
+	if _, ok := b.Objects[key]; !ok {
+		return s.state.Clock, nil
 	}
-	delete(b.Objects, key)
-	if err := s.persistLocked(); err != nil {
-		return err
+	seq := s.tickLocked()
+	if err := s.deleteObjectLocked(bucket, b, key, seq); err != nil {
+		return 0, err
 	}
-	_ = os.Remove(rec.Path)
-	return nil
+	return seq, s.persistLocked()
 }
 
 func (s *Store) ListObjectsV2(_ context.Context, bucket, prefix, token string, maxKeys int) ([]ObjectMeta, string, bool, error) {
@@ -240,22 +882,19 @@ func (s *Store) ListObjectsV2(_ context.Context, bucket, prefix, token string, m
 	if maxKeys <= 0 || maxKeys > 1000 {
 		maxKeys = 1000
 	}
-	keys := make([]string, 0, len(b.Objects))
-	for k := range b.Objects {
-		if strings.HasPrefix(k, prefix) {
-			keys = append(keys, k)
-		}
+	from := prefix
+	if token >= from {
+		// The first key after the token.
+		from = token + "\x00"
 	}
-	sort.Strings(keys)
-	start := 0
-	if token != "" {
-		for i, k := range keys {
-			if k <= token {
-				start = i + 1
-			}
+	keys := make([]string, 0, min(maxKeys+1, b.keys.len()))
+	b.keys.ascend(from, func(k string) bool {
+		if !strings.HasPrefix(k, prefix) {
+			return false
 		}
-	}
-	keys = keys[start:]
+		keys = append(keys, k)
+		return len(keys) <= maxKeys
+	})
 	truncated := false
 	next := ""
 	if len(keys) > maxKeys {
@@ -265,14 +904,20 @@ func (s *Store) ListObjectsV2(_ context.Context, bucket, prefix, token string, m
 	}
 	out := make([]ObjectMeta, 0, len(keys))
 	for _, k := range keys {
-		rec := b.Objects[k]
-		t, _ := time.Parse(time.RFC3339Nano, rec.ModTime)
-		out = append(out, ObjectMeta{Bucket: bucket, Key: k, Size: rec.Size, ETag: rec.ETag, ModTime: t, Path: rec.Path})
+		out = append(out, b.Objects[k].meta(bucket, k))
 	}
 	return out, next, truncated, nil
 }
 
-func (s *Store) CreateAccess(_ context.Context, bucket string, readOnly bool) (AccessKey, error) {
+func (s *Store) CreateAccess(ctx context.Context, bucket string, readOnly bool) (AccessKey, error) {
+	return s.CreateAccessWithOptions(ctx, bucket, AccessOptions{ReadOnly: readOnly})
+}
+
+func (s *Store) CreateAccessWithOptions(_ context.Context, bucket string, opts AccessOptions) (AccessKey, error) {
+	cidrs, err := NormalizeCIDRs(opts.AllowedCIDRs)
+	if err != nil {
+		return AccessKey{}, err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.state.Buckets[bucket]; !ok {
@@ -287,7 +932,7 @@ func (s *Store) CreateAccess(_ context.Context, bucket string, readOnly bool) (A
 		return AccessKey{}, err
 	}
 	ak := "PX" + strings.ToUpper(akRaw)
-	a := AccessKey{AccessKey: ak, SecretKey: sk, Bucket: bucket, ReadOnly: readOnly}
+	a := AccessKey{AccessKey: ak, SecretKey: sk, Bucket: bucket, ReadOnly: opts.ReadOnly, AllowedCIDRs: cidrs, Owner: opts.Owner, RateLimit: opts.RateLimit, CreatedAt: time.Now().UTC(), ExpiresAt: opts.ExpiresAt.UTC(), Policy: opts.Policy}
 	if err := s.putAccessLocked(a); err != nil {
 		return AccessKey{}, err
 	}
@@ -305,16 +950,27 @@ func (s *Store) putAccessLocked(a AccessKey) error {
 	if !ok {
 		return ErrNotFound
 	}
-	b.Access[a.AccessKey] = accessRecord{SecretKey: a.SecretKey, ReadOnly: a.ReadOnly}
+	rec := accessRecord{SecretKey: a.SecretKey, ReadOnly: a.ReadOnly, AllowedCIDRs: a.AllowedCIDRs, Owner: a.Owner, Policy: a.Policy, RateLimit: a.RateLimit}
+	if !a.CreatedAt.IsZero() {
+		rec.CreatedAt = a.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if !a.ExpiresAt.IsZero() {
+		rec.ExpiresAt = a.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	b.Access[a.AccessKey] = rec
+	s.markAccess(a.Bucket, a.AccessKey)
+	s.clearTombstoneLocked(s.state.DeletedAccess, a.AccessKey)
 	return s.persistLocked()
 }
 
 func (s *Store) DeleteAccess(_ context.Context, accessKey string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	for _, b := range s.state.Buckets {
+	for name, b := range s.state.Buckets {
 		if _, ok := b.Access[accessKey]; ok {
 			delete(b.Access, accessKey)
+			s.markAccess(name, accessKey)
+			s.state.DeletedAccess = s.recordDeletionLocked(s.state.DeletedAccess, accessKey)
 			return s.persistLocked()
 		}
 	}
@@ -326,38 +982,12 @@ func (s *Store) LookupAccessKey(_ context.Context, accessKey string) (AccessKey,
 	defer s.mu.RUnlock()
 	for bucket, b := range s.state.Buckets {
 		if rec, ok := b.Access[accessKey]; ok {
-			return AccessKey{AccessKey: accessKey, SecretKey: rec.SecretKey, Bucket: bucket, ReadOnly: rec.ReadOnly}, nil
+			return rec.accessKey(accessKey, bucket), nil
 		}
 	}
 	return AccessKey{}, ErrNotFound
 }
 
-func (s *Store) load() error {
-	b, err := os.ReadFile(s.metaPath)
-	if errors.Is(err, os.ErrNotExist) {
-		return nil
-	}
-	if err != nil {
-		return err
-	}
-	if len(b) == 0 {
-		return nil
-	}
-	return json.Unmarshal(b, &s.state)
-}
-
-func (s *Store) persistLocked() error {
-	tmp := s.metaPath + ".tmp"
-	b, err := json.MarshalIndent(s.state, "", "  ")
-	if err != nil {
-		return err
-	}
-	if err := os.WriteFile(tmp, b, 0o600); err != nil {
-		return err
-	}
-	return os.Rename(tmp, s.metaPath)
-}
-
 func validBucket(name string) bool {
 	if len(name) < 3 || len(name) > 63 {
 		return false
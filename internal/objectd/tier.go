@@ -0,0 +1,129 @@
+package objectd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Objects can be offloaded to a cold tier outside the cluster. An offloaded
+// object keeps its record, with an empty Path and the key of its copy in the
+// tier, so listings and HEAD are unchanged. A restore brings a local copy
+// back for a while; the record then has both a Path and a tier key, and the
+// copy is dropped again once the restore expires. Tier copies of objects
+// that are overwritten or deleted are queued in the metadata until the
+// tierer has removed them.
+
+var ErrObjectOffloaded = errors.New("object body is in the cold tier")
+
+// Offloaded reports whether the body of the object is only in the cold tier.
+func (m ObjectMeta) Offloaded() bool {
+	return m.TierKey != "" && m.Path == "" && m.inline == nil
+}
+
+func (rec objectRecord) offloaded() bool {
+	return rec.Tier != "" && rec.Path == "" && rec.Inline == nil
+}
+
+// OffloadObject drops the local body of key at seq, whose copy in the cold
+// tier is tierKey. Nothing happens if the object changed since seq, is
+// pending or has no local body.
+func (s *Store) OffloadObject(_ context.Context, bucket, key string, seq uint64, tierKey string) error {
+	if tierKey == "" {
+		return fmt.Errorf("empty tier key")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	rec, ok := b.Objects[key]
+	if !ok || rec.Seq != seq || rec.Pending || rec.offloaded() {
+		return nil
+	}
+	if rec.Encryption != "" {
+		return fmt.Errorf("encrypted objects are not offloaded")
+	}
+	rec.Tier = tierKey
+	rec.Path, rec.Compression, rec.Erasure, rec.Inline, rec.Chunks = "", "", "", nil, nil
+	if err := s.setObjectLocked(bucket, b, key, rec); err != nil {
+		return err
+	}
+	return s.persistLocked()
+}
+
+// RestoreOffloaded stores body as the local copy of the offloaded object key
+// at seq. The copy is only kept if its checksum matches the ETag; the object
+// keeps its tier key and modification time.
+func (s *Store) RestoreOffloaded(_ context.Context, bucket, key string, seq uint64, body io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	prev, ok := b.Objects[key]
+	if !ok || prev.Seq != seq || !prev.offloaded() {
+		return nil
+	}
+	m, err := s.writeObjectLocked(bucket, key, body, seq, PutOptions{StorageClass: prev.StorageClass, ContentType: prev.ContentType, ExpiresAt: parseExpiry(prev.ExpiresAt)})
+	if err != nil {
+		return err
+	}
+	if m.ETag != prev.ETag {
+		if err := s.setObjectLocked(bucket, b, key, prev); err != nil {
+			return err
+		}
+		if err := s.persistLocked(); err != nil {
+			return err
+		}
+		return fmt.Errorf("restored body for %s/%s does not match etag %s", bucket, key, prev.ETag)
+	}
+	rec := b.Objects[key]
+	rec.Tier, rec.ModTime, rec.RestoreExpiry = prev.Tier, prev.ModTime, prev.RestoreExpiry
+	if err := s.setObjectLocked(bucket, b, key, rec); err != nil {
+		return err
+	}
+	return s.persistLocked()
+}
+
+// releaseTierLocked queues the tier copy of prev for removal, unless next,
+// which replaces it, is the same version. next is nil for a delete.
+func (s *Store) releaseTierLocked(prev objectRecord, next *objectRecord) {
+	if prev.Tier == "" || next != nil && (next.Tier == prev.Tier || next.Seq == prev.Seq) {
+		return
+	}
+	s.state.TierDeletes = append(s.state.TierDeletes, prev.Tier)
+	s.markMeta()
+}
+
+// PendingTierDeletes returns the tier copies waiting to be removed.
+func (s *Store) PendingTierDeletes(_ context.Context) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.state.TierDeletes...)
+}
+
+// CompleteTierDeletes forgets tier copies that were removed.
+func (s *Store) CompleteTierDeletes(_ context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	done := map[string]bool{}
+	for _, k := range keys {
+		done[k] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.state.TierDeletes[:0]
+	for _, k := range s.state.TierDeletes {
+		if !done[k] {
+			kept = append(kept, k)
+		}
+	}
+	s.state.TierDeletes = kept
+	s.markMeta()
+	return s.persistLocked()
+}
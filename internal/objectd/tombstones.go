@@ -0,0 +1,95 @@
+package objectd
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// A delete that reaches only some replicas must not be undone by one that
+// missed it. Deleted objects, buckets and access keys leave tombstones that
+// anti-entropy hands to the replicas that still have them, and that keep a
+// replica from taking the deleted entry back from a peer. Tombstones are
+// purged once they are older than the retention window; a replica that was
+// away for longer can bring a deleted entry back.
+
+// DefaultTombstoneRetention is how long deletes are remembered.
+const DefaultTombstoneRetention = 7 * 24 * time.Hour
+
+func (s *Store) recordDeletionLocked(m map[string]string, name string) map[string]string {
+	if m == nil {
+		m = map[string]string{}
+	}
+	m[name] = time.Now().UTC().Format(time.RFC3339Nano)
+	s.markMeta()
+	return m
+}
+
+func (s *Store) clearTombstoneLocked(m map[string]string, name string) {
+	if _, ok := m[name]; ok {
+		delete(m, name)
+		s.markMeta()
+	}
+}
+
+// RunTombstonePurge purges tombstones older than retention every interval
+// until ctx is cancelled.
+func (s *Store) RunTombstonePurge(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := s.PurgeTombstones(ctx, now.Add(-retention))
+			if err != nil {
+				log.Printf("tombstones: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("tombstones: purged %d older than %s", n, retention)
+			}
+		}
+	}
+}
+
+// PurgeTombstones drops the tombstones of deletes made before cutoff and
+// returns how many it dropped.
+func (s *Store) PurgeTombstones(_ context.Context, cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	kept := s.state.Tombstones[:0]
+	for _, t := range s.state.Tombstones {
+		if !deletedBefore(t.DeletedAt, cutoff) {
+			kept = append(kept, t)
+			continue
+		}
+		s.queueDelete(tombstoneRecordKey(t))
+		if t.Seq > s.state.TombstoneFloor {
+			s.state.TombstoneFloor = t.Seq
+			s.markMeta()
+		}
+		n++
+	}
+	s.state.Tombstones = kept
+	for _, m := range []map[string]string{s.state.DeletedBuckets, s.state.DeletedAccess} {
+		for name, at := range m {
+			if deletedBefore(at, cutoff) {
+				delete(m, name)
+				s.markMeta()
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.persistLocked()
+}
+
+func deletedBefore(at string, cutoff time.Time) bool {
+	t, err := time.Parse(time.RFC3339Nano, at)
+	return err == nil && t.Before(cutoff)
+}
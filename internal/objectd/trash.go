@@ -0,0 +1,200 @@
+package objectd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Buckets can keep deleted objects in a trash for a number of days. A
+// trashed object keeps its record, and with it the reference to its body, in
+// a record of its own keyed by the sequence number of the delete, which is
+// the same on every replica. Restoring puts the record back as a new version
+// of the key; expired entries are purged and only then release their body.
+
+var ErrObjectExists = errors.New("an object with that key exists")
+
+type trashRecord struct {
+	Key       string       `json:"key"`
+	DeletedAt string       `json:"deletedAt"`
+	ExpiresAt string       `json:"expiresAt"`
+	Object    objectRecord `json:"object"`
+}
+
+// TrashedObject describes a deleted object that can still be restored.
+type TrashedObject struct {
+	ID        uint64    `json:"id"`
+	Key       string    `json:"key"`
+	Size      int64     `json:"size"`
+	ETag      string    `json:"etag"`
+	DeletedAt time.Time `json:"deletedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func trashRecordKey(bucket string, id uint64) string {
+	return fmt.Sprintf("%s%s/%020d", trashPrefix, bucket, id)
+}
+
+func (s *Store) markTrash(bucket string, id uint64) { s.dirty[trashRecordKey(bucket, id)] = true }
+
+// SetBucketTrash keeps objects deleted from bucket for days days. Zero
+// deletes objects right away again. Objects already in the trash keep the
+// expiry they were deleted with.
+func (s *Store) SetBucketTrash(_ context.Context, bucket string, days int) error {
+	if days < 0 {
+		return fmt.Errorf("trash retention must not be negative")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ErrNotFound
+	}
+	if b.TrashDays == days {
+		return nil
+	}
+	b.TrashDays = days
+	s.markBucket(bucket)
+	return s.persistLocked()
+}
+
+// trashLocked moves the record rec of a deleted key into the trash under
+// the sequence number of the delete, if the bucket keeps a trash. It reports
+// whether it did; the record keeps its body and tier copy then.
+func (s *Store) trashLocked(bucket string, b *bucketState, key string, rec objectRecord, seq uint64) bool {
+	if b.TrashDays <= 0 || rec.Pending {
+		return false
+	}
+	if b.trash == nil {
+		b.trash = map[uint64]trashRecord{}
+	}
+	now := time.Now().UTC()
+	b.trash[seq] = trashRecord{
+		Key:       key,
+		DeletedAt: now.Format(time.RFC3339Nano),
+		ExpiresAt: now.AddDate(0, 0, b.TrashDays).Format(time.RFC3339Nano),
+		Object:    rec,
+	}
+	s.markTrash(bucket, seq)
+	return true
+}
+
+// ListTrash returns the objects in the trash of bucket, most recently
+// deleted first.
+func (s *Store) ListTrash(_ context.Context, bucket string) ([]TrashedObject, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	out := make([]TrashedObject, 0, len(b.trash))
+	for id, t := range b.trash {
+		deleted, _ := time.Parse(time.RFC3339Nano, t.DeletedAt)
+		expires, _ := time.Parse(time.RFC3339Nano, t.ExpiresAt)
+		out = append(out, TrashedObject{
+			ID:        id,
+			Key:       t.Key,
+			Size:      t.Object.Size,
+			ETag:      t.Object.ETag,
+			DeletedAt: deleted,
+			ExpiresAt: expires,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out, nil
+}
+
+// RestoreTrashed puts the trashed object id back under its key, stamped with
+// seq, or with the next value of the logical clock if seq is zero. A key
+// that exists again is not overwritten.
+func (s *Store) RestoreTrashed(_ context.Context, bucket string, id, seq uint64) (ObjectMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ObjectMeta{}, ErrNotFound
+	}
+	t, ok := b.trash[id]
+	if !ok {
+		return ObjectMeta{}, ErrNotFound
+	}
+	if _, exists := b.Objects[t.Key]; exists {
+		return ObjectMeta{}, ErrObjectExists
+	}
+	rec := t.Object
+	if seq == 0 {
+		rec.Seq = s.tickLocked()
+	} else {
+		rec.Seq = seq
+		s.observeLocked(seq)
+	}
+	rec.Versioned = b.versioned(t.Key, rec.Seq)
+	if err := s.setObjectLocked(bucket, b, t.Key, rec); err != nil {
+		return ObjectMeta{}, err
+	}
+	// The restored record took its own reference to the body.
+	delete(b.trash, id)
+	s.markTrash(bucket, id)
+	s.releaseLocked(t.Object.Path)
+	if err := s.persistLocked(); err != nil {
+		return ObjectMeta{}, err
+	}
+	return rec.meta(bucket, t.Key), nil
+}
+
+// PurgeTrash removes the trash entries that expired by now and returns how
+// many it removed.
+func (s *Store) PurgeTrash(_ context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for name, b := range s.state.Buckets {
+		for id, t := range b.trash {
+			expires, _ := time.Parse(time.RFC3339Nano, t.ExpiresAt)
+			if now.Before(expires) {
+				continue
+			}
+			s.dropTrashLocked(name, b, id)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.persistLocked()
+}
+
+// dropTrashLocked forgets a trash entry and releases its body.
+func (s *Store) dropTrashLocked(bucket string, b *bucketState, id uint64) {
+	t := b.trash[id]
+	delete(b.trash, id)
+	s.markTrash(bucket, id)
+	s.releaseLocked(t.Object.Path)
+	s.releaseTierLocked(t.Object, nil)
+}
+
+// RunTrashPurge purges expired trash entries every interval until ctx is
+// done.
+func (s *Store) RunTrashPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := s.PurgeTrash(ctx, now)
+			if err != nil {
+				log.Printf("trash: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("trash: purged %d expired objects", n)
+			}
+		}
+	}
+}
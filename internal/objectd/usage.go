@@ -0,0 +1,101 @@
+package objectd
+
+import (
+	"context"
+	"time"
+)
+
+// Usage is the number and total size of the objects in a bucket. It is kept
+// up to date as objects are written and deleted, so reading it does not scan
+// the bucket.
+type Usage struct {
+	Objects int   `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+}
+
+func (u *Usage) add(rec objectRecord) {
+	u.Objects++
+	u.Bytes += rec.Size
+}
+
+func (u *Usage) remove(rec objectRecord) {
+	u.Objects--
+	u.Bytes -= rec.Size
+}
+
+// putRecord sets key to rec and accounts for it in the bucket's usage.
+func (b *bucketState) putRecord(key string, rec objectRecord) {
+	if prev, ok := b.Objects[key]; ok {
+		b.usage.remove(prev)
+	} else {
+		b.keys.insert(key)
+	}
+	b.Objects[key] = rec
+	b.usage.add(rec)
+}
+
+// deleteRecord removes key and its share of the bucket's usage.
+func (b *bucketState) deleteRecord(key string) {
+	if prev, ok := b.Objects[key]; ok {
+		b.usage.remove(prev)
+		delete(b.Objects, key)
+		b.keys.remove(key)
+	}
+}
+
+// countUsageLocked recomputes the usage of every bucket from its records.
+// It runs once after loading; afterwards usage is maintained incrementally.
+func (s *Store) countUsageLocked() {
+	for _, b := range s.state.Buckets {
+		b.usage = Usage{}
+		for _, rec := range b.Objects {
+			b.usage.add(rec)
+		}
+		b.versionBytes = 0
+		for _, vs := range b.versions {
+			for _, v := range vs {
+				b.versionBytes += v.Object.Size
+			}
+		}
+	}
+}
+
+// Usage returns the usage of every bucket.
+func (s *Store) Usage(_ context.Context) map[string]Usage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]Usage, len(s.state.Buckets))
+	for name, b := range s.state.Buckets {
+		out[name] = b.usage
+	}
+	return out
+}
+
+// BucketStats is the usage of one bucket with its newest object, access key
+// count and replication state.
+type BucketStats struct {
+	Bucket       string            `json:"bucket"`
+	Objects      int               `json:"objects"`
+	Bytes        int64             `json:"bytes"`
+	LastModified time.Time         `json:"lastModified,omitempty"`
+	AccessKeys   int               `json:"accessKeys"`
+	Replication  ReplicationStatus `json:"replication"`
+}
+
+// BucketStats returns the stats of bucket. Finding the newest object scans
+// the bucket's records.
+func (s *Store) BucketStats(_ context.Context, bucket string) (BucketStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return BucketStats{}, ErrNotFound
+	}
+	out := BucketStats{Bucket: bucket, Objects: b.usage.Objects, Bytes: b.usage.Bytes, AccessKeys: len(b.Access), Replication: b.replicationStatus(bucket)}
+	for _, rec := range b.Objects {
+		if t, err := time.Parse(time.RFC3339Nano, rec.ModTime); err == nil && t.After(out.LastModified) {
+			out.LastModified = t
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,407 @@
+package objectd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Buckets can keep every version of their objects. While versioning is
+// enabled, a write or delete moves the current version of the key into a
+// record of its own, keyed by the key and the version's sequence number,
+// which is the same on every replica and doubles as the version ID. A delete
+// also leaves a delete marker there. Suspending versioning makes new writes
+// and delete markers the null version of the key, which replaces the
+// previous null version, while the versions already kept stay. A noncurrent
+// version keeps its body until it is deleted by its ID.
+
+// ErrDeleteMarker is returned when a delete marker is read by its version ID.
+var ErrDeleteMarker = errors.New("the version is a delete marker")
+
+// NullVersionID is the ID of the version written while versioning was not
+// enabled.
+const NullVersionID = "null"
+
+type versionRecord struct {
+	DeleteMarker bool `json:"deleteMarker,omitempty"`
+	// Object is the version; a delete marker only has its sequence number,
+	// time and Versioned flag.
+	Object objectRecord `json:"object"`
+}
+
+// ObjectVersion is one version of a key, or a delete marker.
+type ObjectVersion struct {
+	ObjectMeta
+	IsLatest     bool
+	DeleteMarker bool
+}
+
+func versionRecordKey(bucket, key string, seq uint64) string {
+	return fmt.Sprintf("%s%s/%s/%020d", versionPrefix, bucket, key, seq)
+}
+
+// splitVersionRecordKey splits "<bucket>/<key>/<seq>".
+func splitVersionRecordKey(k string) (string, string, uint64, bool) {
+	bucket, rest, ok := splitRecordKey(k)
+	if !ok || len(rest) < 22 || rest[len(rest)-21] != '/' {
+		return "", "", 0, false
+	}
+	seq, err := strconv.ParseUint(rest[len(rest)-20:], 10, 64)
+	return bucket, rest[:len(rest)-21], seq, err == nil
+}
+
+func (s *Store) markVersion(bucket, key string, seq uint64) {
+	s.dirty[versionRecordKey(bucket, key, seq)] = true
+}
+
+// versionID returns the version ID of rec, empty for the null version.
+func (rec objectRecord) versionID() string {
+	if !rec.Versioned {
+		return ""
+	}
+	return strconv.FormatUint(rec.Seq, 10)
+}
+
+func matchesVersion(rec objectRecord, id string) bool {
+	if id == NullVersionID {
+		id = ""
+	}
+	return rec.versionID() == id
+}
+
+// versioning returns the versioning state the bucket reports.
+func (b *bucketState) versioning() string {
+	if b.Versioning == "" {
+		return VersioningDisabled
+	}
+	return b.Versioning
+}
+
+// versioned reports whether a write of key at seq gets a version ID of its
+// own. Rewriting the body of the current version keeps its ID; new writes
+// get one while versioning is enabled.
+func (b *bucketState) versioned(key string, seq uint64) bool {
+	if prev, ok := b.Objects[key]; ok && prev.Seq == seq {
+		return prev.Versioned
+	}
+	return b.Versioning == VersioningEnabled
+}
+
+// versionLocked returns the noncurrent version of key with the given ID and
+// its index.
+func (b *bucketState) versionLocked(key, id string) (versionRecord, int, bool) {
+	for i, v := range b.versions[key] {
+		if matchesVersion(v.Object, id) {
+			return v, i, true
+		}
+	}
+	return versionRecord{}, 0, false
+}
+
+// supersedeLocked settles prev, the current version of key that rec
+// replaces: a new version keeps it as a noncurrent version if the bucket's
+// versioning asks for it, and it is released otherwise.
+func (s *Store) supersedeLocked(bucket string, b *bucketState, key string, prev objectRecord, hadPrev bool, rec objectRecord) {
+	if hadPrev && prev.Seq == rec.Seq {
+		s.releaseLocked(prev.Path)
+		s.releaseTierLocked(prev, &rec)
+		return
+	}
+	if hadPrev && !s.keepVersionLocked(bucket, b, key, prev) {
+		s.releaseLocked(prev.Path)
+		s.releaseTierLocked(prev, &rec)
+	}
+	if !rec.Versioned {
+		s.dropNullVersionLocked(bucket, b, key)
+	}
+}
+
+// retireLocked settles prev, the current version of key deleted at seq. A
+// versioned bucket keeps it and places a delete marker; otherwise it goes
+// to the trash, or is released.
+func (s *Store) retireLocked(bucket string, b *bucketState, key string, prev objectRecord, seq uint64) {
+	if b.Versioning != "" {
+		kept := s.keepVersionLocked(bucket, b, key, prev)
+		s.addVersionLocked(bucket, b, key, versionRecord{DeleteMarker: true, Object: objectRecord{
+			Seq:       seq,
+			ModTime:   time.Now().UTC().Format(time.RFC3339Nano),
+			Versioned: b.Versioning == VersioningEnabled,
+		}})
+		if kept {
+			return
+		}
+	} else if s.trashLocked(bucket, b, key, prev, seq) {
+		return
+	}
+	s.releaseLocked(prev.Path)
+	s.releaseTierLocked(prev, nil)
+}
+
+// keepVersionLocked keeps prev as a noncurrent version of key if the bucket
+// is versioned and reports whether it did; the version holds prev's body
+// and tier copy then. While versioning is suspended the null version is not
+// kept: the write or delete replaces it. A version whose body was never
+// fetched here is not kept either.
+func (s *Store) keepVersionLocked(bucket string, b *bucketState, key string, prev objectRecord) bool {
+	if b.Versioning == "" || prev.Pending || b.Versioning == VersioningSuspended && !prev.Versioned {
+		return false
+	}
+	s.addVersionLocked(bucket, b, key, versionRecord{Object: prev})
+	return true
+}
+
+// addVersionLocked adds v to the noncurrent versions of key. A null version
+// replaces the one kept before.
+func (s *Store) addVersionLocked(bucket string, b *bucketState, key string, v versionRecord) {
+	if !v.Object.Versioned {
+		s.dropNullVersionLocked(bucket, b, key)
+	}
+	if b.versions == nil {
+		b.versions = map[string][]versionRecord{}
+	}
+	vs := append(b.versions[key], v)
+	// Replicated writes can arrive out of order.
+	sort.SliceStable(vs, func(i, j int) bool { return vs[i].Object.Seq < vs[j].Object.Seq })
+	b.versions[key] = vs
+	b.versionBytes += v.Object.Size
+	s.markVersion(bucket, key, v.Object.Seq)
+}
+
+// removeVersionLocked forgets the noncurrent version i of key, leaving its
+// body reference to the caller.
+func (s *Store) removeVersionLocked(bucket string, b *bucketState, key string, i int) versionRecord {
+	vs := b.versions[key]
+	v := vs[i]
+	vs = append(vs[:i:i], vs[i+1:]...)
+	if len(vs) == 0 {
+		delete(b.versions, key)
+	} else {
+		b.versions[key] = vs
+	}
+	b.versionBytes -= v.Object.Size
+	s.markVersion(bucket, key, v.Object.Seq)
+	return v
+}
+
+// dropVersionLocked forgets the noncurrent version i of key and releases
+// its body.
+func (s *Store) dropVersionLocked(bucket string, b *bucketState, key string, i int) {
+	v := s.removeVersionLocked(bucket, b, key, i)
+	if !v.DeleteMarker {
+		s.releaseLocked(v.Object.Path)
+		s.releaseTierLocked(v.Object, nil)
+	}
+}
+
+func (s *Store) dropNullVersionLocked(bucket string, b *bucketState, key string) {
+	if _, i, ok := b.versionLocked(key, NullVersionID); ok {
+		s.dropVersionLocked(bucket, b, key, i)
+	}
+}
+
+// dropVersionsLocked forgets every noncurrent version and delete marker of
+// the bucket.
+func (s *Store) dropVersionsLocked(bucket string, b *bucketState) {
+	for key, vs := range b.versions {
+		for i := len(vs) - 1; i >= 0; i-- {
+			s.dropVersionLocked(bucket, b, key, i)
+		}
+	}
+}
+
+// promoteLocked makes the newest noncurrent version of key, which has no
+// current version, current again, unless it is a delete marker. The record
+// takes over the version's body reference. Nothing is journaled: replaying
+// the delete that removed the current version promotes again.
+func (s *Store) promoteLocked(bucket string, b *bucketState, key string) {
+	vs := b.versions[key]
+	if len(vs) == 0 || vs[len(vs)-1].DeleteMarker {
+		return
+	}
+	v := s.removeVersionLocked(bucket, b, key, len(vs)-1)
+	b.putRecord(key, v.Object)
+	s.markObject(bucket, key)
+	s.cache.forget(bucket, key)
+}
+
+func (v versionRecord) version(bucket, key string) ObjectVersion {
+	return ObjectVersion{ObjectMeta: v.Object.meta(bucket, key), DeleteMarker: v.DeleteMarker}
+}
+
+// versionsOfLocked returns the versions of key, newest first.
+func (b *bucketState) versionsOfLocked(bucket, key string) []ObjectVersion {
+	vs := b.versions[key]
+	out := make([]ObjectVersion, 0, len(vs)+1)
+	if rec, ok := b.Objects[key]; ok {
+		out = append(out, ObjectVersion{ObjectMeta: rec.meta(bucket, key)})
+	}
+	for i := len(vs) - 1; i >= 0; i-- {
+		out = append(out, vs[i].version(bucket, key))
+	}
+	if len(out) > 0 {
+		out[0].IsLatest = true
+	}
+	return out
+}
+
+// ListObjectVersions returns up to maxKeys versions and delete markers of
+// the keys with prefix, by key and newest first, starting after the version
+// versionMarker of keyMarker, or after keyMarker if versionMarker is empty.
+// It also returns the markers to continue with and whether it stopped short.
+func (s *Store) ListObjectVersions(_ context.Context, bucket, prefix, keyMarker, versionMarker string, maxKeys int) ([]ObjectVersion, string, string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return nil, "", "", false, ErrNotFound
+	}
+	if maxKeys <= 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+	from := max(prefix, keyMarker)
+	keys := []string{}
+	b.keys.ascend(from, func(k string) bool {
+		if !strings.HasPrefix(k, prefix) {
+			return false
+		}
+		if _, ok := b.versions[k]; !ok {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	for k := range b.versions {
+		if strings.HasPrefix(k, prefix) && k >= from {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	out := []ObjectVersion{}
+	for _, k := range keys {
+		versions := b.versionsOfLocked(bucket, k)
+		if k == keyMarker {
+			i := len(versions)
+			if versionMarker != "" {
+				for j, v := range versions {
+					if matchesVersion(objectRecord{Seq: v.Seq, Versioned: v.VersionID != ""}, versionMarker) {
+						i = j + 1
+						break
+					}
+				}
+			}
+			versions = versions[i:]
+		}
+		for _, v := range versions {
+			if len(out) == maxKeys {
+				last := out[len(out)-1]
+				id := last.VersionID
+				if id == "" {
+					id = NullVersionID
+				}
+				return out, last.Key, id, true, nil
+			}
+			out = append(out, v)
+		}
+	}
+	return out, "", "", false, nil
+}
+
+// GetObjectVersion returns the version of key with the given ID, which may
+// be the current one or a delete marker.
+func (s *Store) GetObjectVersion(_ context.Context, bucket, key, versionID string) (ObjectVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ObjectVersion{}, ErrNotFound
+	}
+	return b.objectVersionLocked(bucket, key, versionID)
+}
+
+func (b *bucketState) objectVersionLocked(bucket, key, versionID string) (ObjectVersion, error) {
+	for _, v := range b.versionsOfLocked(bucket, key) {
+		if matchesVersion(objectRecord{Seq: v.Seq, Versioned: v.VersionID != ""}, versionID) {
+			return v, nil
+		}
+	}
+	return ObjectVersion{}, ErrNotFound
+}
+
+// OpenObjectVersion opens the version of key with the given ID. Reading a
+// delete marker fails with ErrDeleteMarker.
+func (s *Store) OpenObjectVersion(_ context.Context, bucket, key, versionID string) (ObjectVersion, io.ReadSeekCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ObjectVersion{}, nil, ErrNotFound
+	}
+	v, err := b.objectVersionLocked(bucket, key, versionID)
+	switch {
+	case err != nil:
+		return ObjectVersion{}, nil, err
+	case v.DeleteMarker:
+		return v, nil, ErrDeleteMarker
+	case v.Pending:
+		return v, nil, ErrObjectPending
+	case v.Offloaded():
+		return v, nil, ErrObjectOffloaded
+	}
+	f, err := s.openStoredLocked(v.ObjectMeta)
+	if err != nil {
+		return ObjectVersion{}, nil, err
+	}
+	body, err := s.bodyReaderLocked(f, v.ObjectMeta)
+	if err != nil {
+		_ = f.Close()
+		return ObjectVersion{}, nil, err
+	}
+	return v, body, nil
+}
+
+// DeleteObjectVersion removes the version of key with the given ID for
+// good and returns it. Deleting the current version, or the delete marker
+// that hides the key, makes the next newest version current. Removing the
+// current version is a delete stamped with seq, or with the next value of
+// the logical clock if seq is zero; the sequence number used is returned,
+// zero if the current version stayed.
+func (s *Store) DeleteObjectVersion(_ context.Context, bucket, key, versionID string, seq uint64) (ObjectVersion, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.state.Buckets[bucket]
+	if !ok {
+		return ObjectVersion{}, 0, ErrNotFound
+	}
+	if cur, ok := b.Objects[key]; ok && matchesVersion(cur, versionID) {
+		if seq == 0 {
+			seq = s.tickLocked()
+		} else {
+			s.observeLocked(seq)
+		}
+		out := ObjectVersion{ObjectMeta: cur.meta(bucket, key), IsLatest: true}
+		if err := s.removeObjectLocked(bucket, b, key, seq, true); err != nil {
+			return ObjectVersion{}, 0, err
+		}
+		s.releaseLocked(cur.Path)
+		s.releaseTierLocked(cur, nil)
+		s.promoteLocked(bucket, b, key)
+		return out, seq, s.persistLocked()
+	}
+	v, i, ok := b.versionLocked(key, versionID)
+	if !ok {
+		return ObjectVersion{}, 0, ErrNotFound
+	}
+	_, hasCurrent := b.Objects[key]
+	latest := !hasCurrent && i == len(b.versions[key])-1
+	out := v.version(bucket, key)
+	out.IsLatest = latest
+	s.dropVersionLocked(bucket, b, key, i)
+	if latest {
+		s.promoteLocked(bucket, b, key)
+	}
+	return out, 0, s.persistLocked()
+}
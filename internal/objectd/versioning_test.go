@@ -0,0 +1,262 @@
+package objectd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func setVersioning(t *testing.T, store *Store, bucket, state string) {
+	t.Helper()
+	ctx := context.Background()
+	cfg, err := store.GetBucketConfig(ctx, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Versioning = state
+	if err := store.PutBucketConfig(ctx, bucket, cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listVersions returns the versions of bucket as "key:body" or "key:marker",
+// newest first per key, with the latest one starred.
+func listVersions(t *testing.T, store *Store, bucket string) string {
+	t.Helper()
+	ctx := context.Background()
+	versions, _, _, truncated, err := store.ListObjectVersions(ctx, bucket, "", "", "", 0)
+	if err != nil || truncated {
+		t.Fatalf("ListObjectVersions: truncated %v, %v", truncated, err)
+	}
+	var out []string
+	for _, v := range versions {
+		s := v.Key + ":marker"
+		if !v.DeleteMarker {
+			s = v.Key + ":" + string(readVersion(t, store, bucket, v.Key, versionIDOf(v)))
+		}
+		if v.IsLatest {
+			s += "*"
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, ",")
+}
+
+func versionIDOf(v ObjectVersion) string {
+	if v.VersionID == "" {
+		return NullVersionID
+	}
+	return v.VersionID
+}
+
+func readVersion(t *testing.T, store *Store, bucket, key, id string) []byte {
+	t.Helper()
+	_, r, err := store.OpenObjectVersion(context.Background(), bucket, key, id)
+	if err != nil {
+		t.Fatalf("OpenObjectVersion %s %s: %v", key, id, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func putString(t *testing.T, store *Store, key, body string) ObjectMeta {
+	t.Helper()
+	m, err := store.PutObject(context.Background(), "bucket", key, bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestVersioningKeepsVersions(t *testing.T) {
+	ctx := context.Background()
+	store, backend := openMemoryStore(t, StoreOptions{})
+	setVersioning(t, store, "bucket", VersioningEnabled)
+	v1 := putString(t, store, "k", "first")
+	v2 := putString(t, store, "k", "second")
+	if v1.VersionID == "" || v2.VersionID == "" || v1.VersionID == v2.VersionID {
+		t.Fatalf("version IDs %q and %q", v1.VersionID, v2.VersionID)
+	}
+	if got := listVersions(t, store, "bucket"); got != "k:second*,k:first" {
+		t.Fatalf("versions after overwriting: %s", got)
+	}
+
+	seq, err := store.DeleteObject(ctx, "bucket", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.OpenObject(ctx, "bucket", "k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("OpenObject after the delete: %v", err)
+	}
+	if got := listVersions(t, store, "bucket"); got != "k:marker*,k:second,k:first" {
+		t.Fatalf("versions after deleting: %s", got)
+	}
+	kept, err := store.GetObjectVersion(ctx, "bucket", "k", v2.VersionID)
+	if err != nil || kept.DeleteMarker || kept.ETag != v2.ETag {
+		t.Fatalf("GetObjectVersion of a kept version: %+v, %v", kept, err)
+	}
+	markerID := strconv.FormatUint(seq, 10)
+	if _, _, err := store.OpenObjectVersion(ctx, "bucket", "k", markerID); !errors.Is(err, ErrDeleteMarker) {
+		t.Fatalf("reading the delete marker: %v", err)
+	}
+
+	// Deleting the marker brings the newest version back.
+	if _, _, err := store.DeleteObjectVersion(ctx, "bucket", "k", markerID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(readObject(t, store, "bucket", "k")); got != "second" {
+		t.Fatalf("current version after removing the marker: %q", got)
+	}
+	// Deleting the current version by its ID makes the previous one current
+	// and removes its body.
+	if _, _, err := store.DeleteObjectVersion(ctx, "bucket", "k", v2.VersionID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := listVersions(t, store, "bucket"); got != "k:first*" {
+		t.Fatalf("versions after deleting the current one: %s", got)
+	}
+	if _, err := backend.Stat(v2.Path); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("body of the deleted version: %v", err)
+	}
+	if _, _, err := store.DeleteObjectVersion(ctx, "bucket", "k", v2.VersionID, 0); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("deleting a removed version: %v", err)
+	}
+}
+
+func TestVersioningSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	backend := NewMemoryBackend()
+	store, err := OpenStoreWithOptions(dir, StoreOptions{Backend: backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateBucket(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	setVersioning(t, store, "bucket", VersioningEnabled)
+	putString(t, store, "k", "old")
+	current := putString(t, store, "k", "new")
+	seq, err := store.DeleteObject(ctx, "bucket", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := listVersions(t, store, "bucket")
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store, err = OpenStoreWithOptions(dir, StoreOptions{Backend: backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := listVersions(t, store, "bucket"); got != want {
+		t.Fatalf("versions after reopening: %s, want %s", got, want)
+	}
+	if cfg, _ := store.GetBucketConfig(ctx, "bucket"); cfg.Versioning != VersioningEnabled {
+		t.Fatalf("versioning after reopening: %q", cfg.Versioning)
+	}
+
+	// Replaying the removal of the current version must not remove the
+	// version it promoted as well.
+	if _, _, err := store.DeleteObjectVersion(ctx, "bucket", "k", strconv.FormatUint(seq, 10), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.DeleteObjectVersion(ctx, "bucket", "k", current.VersionID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store, err = OpenStoreWithOptions(dir, StoreOptions{Backend: backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if got := listVersions(t, store, "bucket"); got != "k:old*" {
+		t.Fatalf("versions after removing the current one and reopening: %s", got)
+	}
+}
+
+func TestVersioningSuspended(t *testing.T) {
+	store, backend := openMemoryStore(t, StoreOptions{})
+	unversioned := putString(t, store, "k", "before")
+	if unversioned.VersionID != "" {
+		t.Fatalf("version ID %q without versioning", unversioned.VersionID)
+	}
+	setVersioning(t, store, "bucket", VersioningEnabled)
+	putString(t, store, "k", "enabled")
+	if got := listVersions(t, store, "bucket"); got != "k:enabled*,k:before" {
+		t.Fatalf("versions after enabling: %s", got)
+	}
+	// While suspended a write becomes the null version, replacing the one
+	// written before versioning was enabled.
+	setVersioning(t, store, "bucket", VersioningSuspended)
+	putString(t, store, "k", "suspended")
+	putString(t, store, "k", "again")
+	if got := listVersions(t, store, "bucket"); got != "k:again*,k:enabled" {
+		t.Fatalf("versions while suspended: %s", got)
+	}
+	if _, err := backend.Stat(unversioned.Path); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("body of the replaced null version: %v", err)
+	}
+}
+
+func TestVersioningConfig(t *testing.T) {
+	ctx := context.Background()
+	store, _ := openMemoryStore(t, StoreOptions{})
+	if cfg, _ := store.GetBucketConfig(ctx, "bucket"); cfg.Versioning != VersioningDisabled {
+		t.Fatalf("versioning of a new bucket: %q", cfg.Versioning)
+	}
+	if err := store.PutBucketConfig(ctx, "bucket", BucketConfig{Versioning: "On"}); err == nil {
+		t.Fatal("accepted an unknown versioning state")
+	}
+	setVersioning(t, store, "bucket", VersioningEnabled)
+	if err := store.PutBucketConfig(ctx, "bucket", BucketConfig{Versioning: VersioningDisabled}); err == nil {
+		t.Fatal("disabled versioning after it was enabled")
+	}
+	// Leaving versioning out keeps it.
+	if err := store.PutBucketConfig(ctx, "bucket", BucketConfig{QuotaBytes: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _ := store.GetBucketConfig(ctx, "bucket"); cfg.Versioning != VersioningEnabled {
+		t.Fatalf("versioning after a config without it: %q", cfg.Versioning)
+	}
+}
+
+func TestVersioningQuotaAndBucketDelete(t *testing.T) {
+	ctx := context.Background()
+	store, _ := openMemoryStore(t, StoreOptions{})
+	setVersioning(t, store, "bucket", VersioningEnabled)
+	putString(t, store, "k", "12345")
+	putString(t, store, "k", "67890")
+	if err := store.PutBucketConfig(ctx, "bucket", BucketConfig{QuotaBytes: 12}); err != nil {
+		t.Fatal(err)
+	}
+	// The noncurrent version still takes up space.
+	if err := store.CheckQuota("bucket", 3); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("CheckQuota counting noncurrent versions: %v", err)
+	}
+	if _, err := store.DeleteObject(ctx, "bucket", "k"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteBucket(ctx, "bucket"); err == nil {
+		t.Fatal("deleted a bucket that still has versions")
+	}
+	if _, err := store.PurgeBucket(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if got := listVersions(t, store, "bucket"); got != "" {
+		t.Fatalf("versions after purging: %s", got)
+	}
+	if err := store.DeleteBucket(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+}
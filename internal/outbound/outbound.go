@@ -0,0 +1,45 @@
+// Package outbound builds HTTP transports for connections that leave the
+// cluster, such as a standby tailing its primary. They honour HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY and trust the system roots plus any configured CA
+// bundles. Traffic between replicas of one cluster does not use them.
+package outbound
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// CABundleEnv names a PEM bundle trusted in addition to the system roots,
+// typically the CA of a TLS-intercepting proxy.
+const CABundleEnv = "ENTITY_OUTBOUND_CA_FILE"
+
+// NewTransport returns a proxy-aware transport that trusts the system roots,
+// the bundle in ENTITY_OUTBOUND_CA_FILE and the given extra CA files.
+func NewTransport(extraCAFiles ...string) (*http.Transport, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	files := append([]string{os.Getenv(CABundleEnv)}, extraCAFiles...)
+	for _, f := range files {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates in %s", f)
+		}
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = http.ProxyFromEnvironment
+	tr.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}
+	return tr, nil
+}
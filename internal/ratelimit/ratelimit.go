@@ -0,0 +1,173 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps one token bucket per key. The rate is passed on every call so
+// limits changed on an access key take effect without resetting state.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func New() *Limiter {
+	return &Limiter{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// take refills the bucket for key and removes n tokens. The balance may go
+// negative; the returned duration is how long the caller must wait for it to
+// be paid back. The burst is one second worth of tokens.
+func (l *Limiter) take(key string, rate, n float64, allowDebt bool) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rate, last: now}
+		l.buckets[key] = b
+	}
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens < n && !allowDebt {
+		return 0, false
+	}
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0, true
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second)), true
+}
+
+// Allow reports whether one more request fits within rate requests per
+// second. A rate of zero or less is unlimited.
+func (l *Limiter) Allow(key string, rate float64) bool {
+	if rate <= 0 {
+		return true
+	}
+	_, ok := l.take(key, rate, 1, false)
+	return ok
+}
+
+// Wait blocks until n bytes fit within rate bytes per second.
+func (l *Limiter) Wait(ctx context.Context, key string, rate float64, n int) error {
+	if rate <= 0 || n <= 0 {
+		return nil
+	}
+	d, _ := l.take(key, rate, float64(n), true)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Reader throttles reads from r to rate bytes per second.
+func (l *Limiter) Reader(ctx context.Context, key string, rate float64, r io.ReadCloser) io.ReadCloser {
+	if rate <= 0 {
+		return r
+	}
+	return &reader{ReadCloser: r, ctx: ctx, l: l, key: key, rate: rate}
+}
+
+// ResponseWriter throttles the body written to w to rate bytes per second.
+func (l *Limiter) ResponseWriter(ctx context.Context, key string, rate float64, w http.ResponseWriter) http.ResponseWriter {
+	if rate <= 0 {
+		return w
+	}
+	return &writer{ResponseWriter: w, ctx: ctx, l: l, key: key, rate: rate}
+}
+
+type reader struct {
+	io.ReadCloser
+	ctx  context.Context
+	l    *Limiter
+	key  string
+	rate float64
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := r.l.Wait(r.ctx, r.key, r.rate, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+type writer struct {
+	http.ResponseWriter
+	ctx  context.Context
+	l    *Limiter
+	key  string
+	rate float64
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if err := w.l.Wait(w.ctx, w.key, w.rate, len(p)); err != nil {
+		return 0, err
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// ReadFrom copies r in chunks of up to a second's worth of bytes, waiting
+// for each before it is sent like Write does, so the wrapped writer keeps
+// its own ReadFrom, and with it sendfile, while the rate still holds. The
+// chunks of an io.LimitedReader, which is what http.ServeContent passes,
+// stop at its limit; otherwise the last chunk is paid in full even when r
+// ends before it.
+func (w *writer) ReadFrom(r io.Reader) (int64, error) {
+	chunk := min(max(int64(w.rate), 32<<10), 1<<20)
+	var total int64
+	for {
+		size := chunk
+		if lr, ok := r.(*io.LimitedReader); ok {
+			if lr.N <= 0 {
+				return total, nil
+			}
+			size = min(size, lr.N)
+		}
+		if err := w.l.Wait(w.ctx, w.key, w.rate, int(size)); err != nil {
+			return total, err
+		}
+		n, err := io.CopyN(w.ResponseWriter, r, size)
+		total += n
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+func (w *writer) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer.
+func (w *writer) Unwrap() http.ResponseWriter { return w.ResponseWriter }
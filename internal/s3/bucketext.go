@@ -0,0 +1,29 @@
+package s3
+
+import "github.com/mchenetz/entity/internal/objectd"
+
+// bucketExtension is the per-bucket configuration summary added to
+// ListBuckets entries in its own namespace, which S3 SDKs skip.
+type bucketExtension struct {
+	Objects           int    `xml:"Objects"`
+	Size              int64  `xml:"Size"`
+	QuotaBytes        int64  `xml:"QuotaBytes"`
+	Versioning        string `xml:"Versioning"`
+	ObjectLock        bool   `xml:"ObjectLock"`
+	Encryption        string `xml:"Encryption,omitempty"`
+	ReplicationPaused bool   `xml:"ReplicationPaused"`
+	PendingChanges    int    `xml:"PendingChanges"`
+}
+
+func newBucketExtension(b objectd.Bucket) bucketExtension {
+	return bucketExtension{
+		Objects:           b.Objects,
+		Size:              b.Size,
+		QuotaBytes:        b.QuotaBytes,
+		Versioning:        b.Versioning,
+		ObjectLock:        b.ObjectLock,
+		Encryption:        b.Encryption,
+		ReplicationPaused: b.Replication.Paused,
+		PendingChanges:    b.Replication.Pending,
+	}
+}
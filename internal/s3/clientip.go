@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// clientAddr resolves the address of the client that sent r. X-Forwarded-For
+// is only honoured when the direct peer is a trusted proxy, and is walked from
+// the right so a client cannot prepend addresses of its own.
+func (h *Handler) clientAddr(r *http.Request) (netip.Addr, bool) {
+	if h.Cluster != nil {
+		if v, ok := h.Cluster.ClientAddr(r); ok {
+			a, err := netip.ParseAddr(v)
+			return a, err == nil
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+	if !h.trustedProxy(addr) {
+		return addr, true
+	}
+	hops := []string{}
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		a, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return addr, true
+		}
+		addr = a.Unmap()
+		if !h.trustedProxy(addr) {
+			break
+		}
+	}
+	return addr, true
+}
+
+func (h *Handler) trustedProxy(addr netip.Addr) bool {
+	for _, p := range h.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a comma separated list of CIDRs or addresses.
+func ParseTrustedProxies(v string) ([]netip.Prefix, error) {
+	out := []netip.Prefix{}
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		p, err := objectd.ParsePrefix(f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
@@ -0,0 +1,102 @@
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// parseCopySource splits an x-amz-copy-source header ("bucket/key" or
+// "/bucket/key", URL encoded) into bucket and key.
+func parseCopySource(v string) (string, string, bool) {
+	if i := strings.Index(v, "?"); i >= 0 {
+		v = v[:i]
+	}
+	v, err := url.PathUnescape(v)
+	if err != nil {
+		return "", "", false
+	}
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(v, "/"), "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", false
+	}
+	return bucket, key, true
+}
+
+// copyObject serves PUT with x-amz-copy-source. The copy shares the source
+// body in the store; peers receive it like a regular upload.
+func (h *Handler) copyObject(w http.ResponseWriter, r *http.Request, auth AuthResult, bucket, key string) {
+	srcBucket, srcKey, ok := parseCopySource(r.Header.Get("X-Amz-Copy-Source"))
+	if !ok {
+		writeError(w, "InvalidArgument", "invalid x-amz-copy-source", http.StatusBadRequest)
+		return
+	}
+	if !auth.allowsObject("s3:GetObject", srcBucket, srcKey) {
+		writeError(w, "AccessDenied", "bucket not allowed", http.StatusForbidden)
+		return
+	}
+	opts := objectd.PutOptions{StorageClass: r.Header.Get("X-Amz-Storage-Class")}
+	switch opts.StorageClass {
+	case "", objectd.StorageClassStandard, objectd.StorageClassGlacier, objectd.StorageClassDeepArchive:
+	default:
+		writeError(w, "InvalidStorageClass", "the storage class you specified is not valid", http.StatusBadRequest)
+		return
+	}
+	expires, err := expiresAfter(r)
+	if err != nil {
+		writeError(w, "InvalidArgument", err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.ExpiresAt = expires
+	src, err := h.Store.GetObjectMeta(r.Context(), srcBucket, srcKey)
+	if err != nil {
+		writeError(w, "NoSuchKey", "object not found", http.StatusNotFound)
+		return
+	}
+	if !src.Readable(time.Now()) {
+		writeError(w, "InvalidObjectState", objectd.ErrInvalidObjectState.Error(), http.StatusForbidden)
+		return
+	}
+	obj, err := h.Store.CopyObject(r.Context(), srcBucket, srcKey, bucket, key, opts)
+	if errors.Is(err, objectd.ErrObjectPending) && h.Cluster != nil {
+		// The source body is held by a peer, always so in partitioned mode
+		// when this replica does not own it; pull it and copy again.
+		if h.Cluster.FetchObject(r.Context(), h.Store, srcBucket, srcKey) == nil {
+			obj, err = h.Store.CopyObject(r.Context(), srcBucket, srcKey, bucket, key, opts)
+		}
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, objectd.ErrNotFound):
+			writeError(w, "NoSuchKey", "object not found", http.StatusNotFound)
+		case errors.Is(err, objectd.ErrObjectPending), errors.Is(err, objectd.ErrReadOnly):
+			writeError(w, "ServiceUnavailable", err.Error(), http.StatusServiceUnavailable)
+		case errors.Is(err, objectd.ErrObjectOffloaded):
+			writeError(w, "InvalidObjectState", "the source object is offloaded and must be restored before it can be copied", http.StatusForbidden)
+		default:
+			writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		if err := h.replicatePut(r.Context(), obj); err != nil {
+			writeError(w, "InternalError", err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	if obj.Encryption != "" {
+		w.Header().Set("x-amz-server-side-encryption", obj.Encryption)
+	}
+	writeXML(w, http.StatusOK, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		Xmlns        string   `xml:"xmlns,attr"`
+		ETag         string   `xml:"ETag"`
+		LastModified string   `xml:"LastModified"`
+	}{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/", ETag: fmt.Sprintf("\"%s\"", obj.ETag), LastModified: obj.ModTime.UTC().Format(time.RFC3339)})
+}
@@ -0,0 +1,80 @@
+package s3
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+type serverSideEncryptionConfiguration struct {
+	XMLName xml.Name  `xml:"ServerSideEncryptionConfiguration"`
+	Xmlns   string    `xml:"xmlns,attr,omitempty"`
+	Rules   []sseRule `xml:"Rule"`
+}
+
+type sseRule struct {
+	ApplyServerSideEncryptionByDefault struct {
+		SSEAlgorithm   string `xml:"SSEAlgorithm"`
+		KMSMasterKeyID string `xml:"KMSMasterKeyID,omitempty"`
+	} `xml:"ApplyServerSideEncryptionByDefault"`
+}
+
+func (h *Handler) getBucketEncryption(w http.ResponseWriter, r *http.Request, bucket string) {
+	cfg, err := h.Store.GetBucketEncryption(r.Context(), bucket)
+	if err != nil {
+		if errors.Is(err, objectd.ErrNotFound) {
+			writeError(w, "ServerSideEncryptionConfigurationNotFoundError", "the server side encryption configuration was not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := serverSideEncryptionConfiguration{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/"}
+	var rule sseRule
+	rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm = cfg.Algorithm
+	resp.Rules = []sseRule{rule}
+	writeXML(w, http.StatusOK, resp)
+}
+
+func (h *Handler) putBucketEncryption(w http.ResponseWriter, r *http.Request, bucket string) {
+	var req serverSideEncryptionConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Rules) != 1 {
+		writeError(w, "MalformedXML", "invalid server side encryption configuration", http.StatusBadRequest)
+		return
+	}
+	cfg := objectd.EncryptionConfig{Algorithm: req.Rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm}
+	if cfg.Algorithm == "" {
+		writeError(w, "MalformedXML", "SSEAlgorithm is required", http.StatusBadRequest)
+		return
+	}
+	h.setBucketEncryption(w, r, bucket, cfg, http.StatusOK)
+}
+
+func (h *Handler) deleteBucketEncryption(w http.ResponseWriter, r *http.Request, bucket string) {
+	h.setBucketEncryption(w, r, bucket, objectd.EncryptionConfig{}, http.StatusNoContent)
+}
+
+func (h *Handler) setBucketEncryption(w http.ResponseWriter, r *http.Request, bucket string, cfg objectd.EncryptionConfig, status int) {
+	if err := h.Store.PutBucketEncryption(r.Context(), bucket, cfg); err != nil {
+		switch {
+		case errors.Is(err, objectd.ErrNotFound):
+			writeError(w, "NoSuchBucket", "bucket does not exist", http.StatusNotFound)
+		case errors.Is(err, objectd.ErrEncryptionNotConfigured):
+			writeError(w, "NotImplemented", err.Error(), http.StatusNotImplemented)
+		default:
+			writeError(w, "InvalidArgument", err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		payload, _ := json.Marshal(cfg)
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/buckets/"+bucket+"/encryption", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+			writeError(w, "InternalError", err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(status)
+}
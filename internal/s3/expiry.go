@@ -0,0 +1,36 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// ExpiresAfterHeader on a put, copy or multipart upload makes the new
+	// object expire after the given number of seconds or Go duration.
+	ExpiresAfterHeader = "X-ENTITY-Expires-After"
+	// ExpiresAtHeader reports when an object expires.
+	ExpiresAtHeader = "X-ENTITY-Expires-At"
+)
+
+// expiresAfter returns the expiry time requested by r, zero if there is none.
+func expiresAfter(r *http.Request) (time.Time, error) {
+	v := r.Header.Get(ExpiresAfterHeader)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, serr := strconv.ParseInt(v, 10, 64)
+		if serr != nil {
+			return time.Time{}, fmt.Errorf("invalid %s: %q", ExpiresAfterHeader, v)
+		}
+		d = time.Duration(secs) * time.Second
+	}
+	if d <= 0 {
+		return time.Time{}, fmt.Errorf("invalid %s: %q", ExpiresAfterHeader, v)
+	}
+	return time.Now().Add(d).UTC(), nil
+}
@@ -1,21 +1,28 @@
 package s3
 
 import (
-	"bytes"
 	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/logbuf"
+	"github.com/mchenetz/entity/internal/metering"
+	"github.com/mchenetz/entity/internal/metrics"
 	"github.com/mchenetz/entity/internal/objectd"
+	"github.com/mchenetz/entity/internal/ratelimit"
+	"github.com/mchenetz/entity/internal/tier"
 )
 
+var errAccessKeyExpired = errors.New("access key expired")
+
 type Resolver struct{ Store *objectd.Store }
 
 func (r Resolver) Lookup(accessKey string) (secret string, bucket string, readOnly bool, err error) {
@@ -23,37 +30,196 @@ func (r Resolver) Lookup(accessKey string) (secret string, bucket string, readOn
 	if err != nil {
 		return "", "", false, err
 	}
+	if a.Expired(time.Now()) {
+		return "", "", false, errAccessKeyExpired
+	}
 	return a.SecretKey, a.Bucket, a.ReadOnly, nil
 }
 
+// AccessRecorder observes object reads, e.g. to track object temperature.
+type AccessRecorder interface {
+	Record(bucket, key string)
+}
+
 type Handler struct {
 	Store    *objectd.Store
 	Resolver Resolver
 	Cluster  *cluster.Cluster
+	Access   AccessRecorder
+	Auth     SigV4Policy
+	// limits is read by every request and replaced by SetLimits.
+	limits atomic.Pointer[Limits]
+
+	RateLimiter *ratelimit.Limiter
+	// Tier serves the bodies of offloaded objects; without it they cannot
+	// be read until they are restored.
+	Tier *tier.Tierer
+	// TrustedProxies are the peers whose X-Forwarded-For header is believed.
+	TrustedProxies []netip.Prefix
+
+	LocalWriteThreshold int64
+	// RedirectToLeader makes followers answer requests meant for the
+	// leader with a redirect to it instead of proxying them.
+	RedirectToLeader bool
+	// LeaderRedirectURL is the base URL redirects point at, with
+	// {ordinal} standing for the leader's ordinal; empty uses the
+	// leader's headless-service name.
+	LeaderRedirectURL string
+	// Meter counts client traffic for usage reports.
+	Meter *metering.Meter
+	// ListConsistency is where listings are served unless a request asks
+	// otherwise: ListConsistencyLocal or ListConsistencyLeader.
+	ListConsistency string
 }
 
 func NewHandler(s *objectd.Store, c *cluster.Cluster) *Handler {
-	return &Handler{Store: s, Resolver: Resolver{Store: s}, Cluster: c}
+	h := &Handler{Store: s, Resolver: Resolver{Store: s}, Cluster: c, Auth: SigV4Policy{MaxSkew: DefaultMaxRequestSkew}}
+	h.SetLimits(DefaultLimits())
+	return h
 }
 
+// Limits returns the limits requests are checked against.
+func (h *Handler) Limits() Limits { return *h.limits.Load() }
+
+// SetLimits replaces the limits from the next request on.
+func (h *Handler) SetLimits(l Limits) { h.limits.Store(&l) }
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	auth, err := VerifySigV4(r, h.Resolver)
+	if h.Cluster != nil && h.Cluster.Bootstrapping() {
+		w.Header().Set("Retry-After", "5")
+		writeError(w, "ServiceUnavailable", "this replica is still copying its data from a peer", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Header.Get("Authorization") == "" {
+		h.serveAnonymous(w, r)
+		return
+	}
+	auth, err := VerifySigV4WithPolicy(r, h.Resolver, h.Auth)
+	if errors.Is(err, ErrRequestTimeTooSkewed) {
+		writeError(w, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.", http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		writeError(w, "AccessDenied", err.Error(), http.StatusForbidden)
 		return
 	}
+	access, err := h.Store.LookupAccessKey(r.Context(), auth.AccessKey)
+	if err != nil {
+		writeError(w, "AccessDenied", "invalid access key", http.StatusForbidden)
+		return
+	}
+	if access.Expired(time.Now()) {
+		writeError(w, "AccessDenied", errAccessKeyExpired.Error(), http.StatusForbidden)
+		return
+	}
+	addr, ok := h.clientAddr(r)
+	if !ok || !access.AllowsAddr(addr) {
+		writeError(w, "AccessDenied", "access key not allowed from this address", http.StatusForbidden)
+		return
+	}
+	// A request a peer forwarded was metered by that peer.
+	fromPeer := false
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		_, fromPeer = h.Cluster.ClientAddr(r)
+		fromPeer = fromPeer || h.Cluster.IsInternalReplication(r)
+		h.Cluster.SetClientAddr(r, addr.String())
+	}
+	if !fromPeer {
+		h.Store.RecordAccessUse(access.AccessKey, addr.String())
+	}
+	auth.Policy = access.Policy
+	auth.Conditions = conditionValues(r, addr)
+	if h.RateLimiter != nil {
+		if w, ok = h.applyRateLimit(w, r, access); !ok {
+			return
+		}
+	}
+	if !h.Limits().checkRequest(w, r) {
+		return
+	}
+	level, err := cluster.RequestConsistency(r)
+	if err != nil {
+		writeError(w, "InvalidArgument", err.Error(), http.StatusBadRequest)
+		return
+	}
 	bucket, key := splitPath(r.URL.Path)
+	mapped, hostMapped := h.Store.BucketForHost(r.Context(), r.Host)
+	if hostMapped {
+		bucket, key = mapped, strings.TrimPrefix(r.URL.Path, "/")
+	}
+	if level == "" && bucket != "" {
+		// A bucket's level was checked when it was set.
+		level = cluster.Consistency(h.Store.BucketConsistency(bucket))
+	}
+	r = r.WithContext(cluster.WithConsistency(r.Context(), level))
+	if h.Meter != nil && !fromPeer {
+		var done func()
+		w, done = h.meterRequest(w, r, bucket, auth.AccessKey)
+		defer done()
+	}
 
-	if bucket != "" && auth.Bucket != bucket {
-		writeError(w, "AccessDenied", "bucket not allowed", http.StatusForbidden)
+	if err := authorize(r, auth, bucket, key); err != nil {
+		writeError(w, "AccessDenied", err.Error(), http.StatusForbidden)
 		return
 	}
-	if auth.ReadOnly && (r.Method == http.MethodPut || r.Method == http.MethodPost || r.Method == http.MethodDelete) {
-		writeError(w, "AccessDenied", "read-only credentials", http.StatusForbidden)
+
+	if h.Store.Standby() && isMutatingS3(r.Method, bucket, key) {
+		writeError(w, "ServiceUnavailable", "this cluster is a read-only standby", http.StatusServiceUnavailable)
 		return
 	}
-
-	if h.shouldProxyToLeader(r, bucket, key) {
+	if isMutatingS3(r.Method, bucket, key) {
+		// Writes forwarded by peers are still served, so that a leader in
+		// maintenance does not stop the others from writing.
+		if h.Store.InMaintenance() && !fromPeer {
+			w.Header().Set("Retry-After", "5")
+			writeError(w, "ServiceUnavailable", "this replica is in maintenance; retry on another one", http.StatusServiceUnavailable)
+			return
+		}
+		defer h.Store.TrackWrite()()
+	}
+	if h.Cluster != nil && isMutatingS3(r.Method, bucket, key) && !h.Cluster.Writable(r.Context()) {
+		writeError(w, "ServiceUnavailable", cluster.ErrNoQuorum.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if h.Store.ReadOnly() && writesData(r, bucket, key) {
+		writeError(w, "ServiceUnavailable", objectd.ErrReadOnly.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if h.Cluster != nil && writesData(r, bucket, key) && h.Cluster.Backlogged() {
+		metrics.AddCounter("entity_s3_replication_backpressure_total", nil, 1)
+		w.Header().Set("Retry-After", "1")
+		writeError(w, "SlowDown", "replication is behind; please reduce your request rate", http.StatusServiceUnavailable)
+		return
+	}
+	if writesData(r, bucket, key) {
+		if err := h.Store.CheckQuota(bucket, h.writeSize(r)); err != nil {
+			metrics.AddCounter("entity_s3_quota_rejections_total", nil, 1)
+			writeError(w, "QuotaExceeded", err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	if h.writesLocally(r, bucket, key) {
+		if h.Cluster.Owns(bucket, key) {
+			h.putObjectLocal(w, r, bucket, key)
+			return
+		}
+		if err := h.Cluster.ProxyToOwner(w, r, bucket, key); err != nil {
+			writeError(w, "ServiceUnavailable", err.Error(), http.StatusServiceUnavailable)
+		}
+		return
+	}
+	toLeader, err := h.shouldProxyToLeader(r, bucket, key)
+	if err != nil {
+		writeError(w, "InvalidArgument", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if toLeader {
+		// A bucket addressed by host name would lose its mapping on the
+		// leader's host, so those requests are still proxied.
+		if h.RedirectToLeader && !hostMapped {
+			h.redirectToLeader(w, r)
+			return
+		}
 		if err := h.Cluster.ProxyToLeader(w, r, "s3"); err != nil {
 			writeError(w, "InternalError", err.Error(), http.StatusServiceUnavailable)
 		}
@@ -61,14 +227,44 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	switch {
+	case r.Method == http.MethodGet && bucket != "" && key == "" && r.URL.Query().Has("encryption"):
+		h.getBucketEncryption(w, r, bucket)
+	case r.Method == http.MethodPut && bucket != "" && key == "" && r.URL.Query().Has("encryption"):
+		h.putBucketEncryption(w, r, bucket)
+	case r.Method == http.MethodDelete && bucket != "" && key == "" && r.URL.Query().Has("encryption"):
+		h.deleteBucketEncryption(w, r, bucket)
+	case r.Method == http.MethodGet && bucket != "" && key == "" && r.URL.Query().Has("versioning"):
+		h.getBucketVersioning(w, r, bucket)
+	case r.Method == http.MethodPut && bucket != "" && key == "" && r.URL.Query().Has("versioning"):
+		h.putBucketVersioning(w, r, bucket)
+	case r.Method == http.MethodGet && bucket != "" && key == "" && r.URL.Query().Has("versions"):
+		h.listObjectVersions(w, r, bucket)
+	case r.Method == http.MethodGet && bucket != "" && key != "" && r.URL.Query().Has("versionId"):
+		h.getObjectVersion(w, r, bucket, key, r.URL.Query().Get("versionId"))
+	case r.Method == http.MethodHead && bucket != "" && key != "" && r.URL.Query().Has("versionId"):
+		h.headObjectVersion(w, r, bucket, key, r.URL.Query().Get("versionId"))
+	case r.Method == http.MethodDelete && bucket != "" && key != "" && r.URL.Query().Has("versionId"):
+		h.deleteObjectVersion(w, r, bucket, key, r.URL.Query().Get("versionId"))
+	case r.Method == http.MethodPost && bucket != "" && key != "" && r.URL.Query().Has("uploads"):
+		h.createMultipartUpload(w, r, bucket, key)
+	case r.Method == http.MethodPut && bucket != "" && key != "" && r.URL.Query().Has("uploadId"):
+		h.uploadPart(w, r, bucket, key)
+	case r.Method == http.MethodGet && bucket != "" && key != "" && r.URL.Query().Has("uploadId"):
+		h.listParts(w, r, bucket, key)
+	case r.Method == http.MethodPost && bucket != "" && key != "" && r.URL.Query().Has("uploadId"):
+		h.completeMultipartUpload(w, r, bucket, key)
+	case r.Method == http.MethodDelete && bucket != "" && key != "" && r.URL.Query().Has("uploadId"):
+		h.abortMultipartUpload(w, r, bucket, key)
 	case r.Method == http.MethodGet && bucket == "" && key == "":
-		h.listBuckets(w, r, auth.Bucket)
+		h.listBuckets(w, r, auth)
 	case r.Method == http.MethodPut && bucket != "" && key == "":
 		h.createBucket(w, r, bucket)
 	case r.Method == http.MethodDelete && bucket != "" && key == "":
 		h.deleteBucket(w, r, bucket)
 	case r.Method == http.MethodGet && bucket != "" && key == "" && r.URL.Query().Get("list-type") == "2":
 		h.listObjectsV2(w, r, bucket)
+	case r.Method == http.MethodPut && bucket != "" && key != "" && r.Header.Get("X-Amz-Copy-Source") != "":
+		h.copyObject(w, r, auth, bucket, key)
 	case r.Method == http.MethodPut && bucket != "" && key != "":
 		h.putObject(w, r, bucket, key)
 	case r.Method == http.MethodGet && bucket != "" && key != "":
@@ -77,19 +273,26 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.headObject(w, r, bucket, key)
 	case r.Method == http.MethodDelete && bucket != "" && key != "":
 		h.deleteObject(w, r, bucket, key)
+	case r.Method == http.MethodPost && bucket != "" && key != "" && r.URL.Query().Has("restore"):
+		h.restoreObject(w, r, bucket, key)
 	default:
 		writeError(w, "NotImplemented", "operation not implemented", http.StatusNotImplemented)
 	}
 }
 
-func (h *Handler) shouldProxyToLeader(r *http.Request, bucket, key string) bool {
+func (h *Handler) shouldProxyToLeader(r *http.Request, bucket, key string) (bool, error) {
 	if h.Cluster == nil || !h.Cluster.Enabled() || h.Cluster.IsInternalReplication(r) {
-		return false
+		return false, nil
 	}
-	if !isMutatingS3(r.Method, bucket, key) {
-		return false
+	listing, err := h.listsFromLeader(r, bucket, key)
+	if err != nil {
+		return false, err
+	}
+	// Upload parts only exist on the leader, so listing them goes there too.
+	if !isMutatingS3(r.Method, bucket, key) && !r.URL.Query().Has("uploadId") && !listing {
+		return false, nil
 	}
-	return !h.Cluster.IsLeader(r.Context())
+	return !h.Cluster.IsLeader(r.Context()), nil
 }
 
 func isMutatingS3(method, bucket, key string) bool {
@@ -99,31 +302,71 @@ func isMutatingS3(method, bucket, key string) bool {
 	if method == http.MethodDelete && bucket != "" {
 		return true
 	}
+	if method == http.MethodPost && bucket != "" {
+		return true
+	}
 	return false
 }
 
-func (h *Handler) listBuckets(w http.ResponseWriter, r *http.Request, allowedBucket string) {
+// writesData reports whether r stores object data: puts, part uploads,
+// copies and completions. Deletes and bucket calls free space or need none.
+func writesData(r *http.Request, bucket, key string) bool {
+	if bucket == "" || key == "" {
+		return false
+	}
+	return r.Method == http.MethodPut || r.Method == http.MethodPost && r.URL.Query().Has("uploadId")
+}
+
+func (h *Handler) listBuckets(w http.ResponseWriter, r *http.Request, auth AuthResult) {
+	q := r.URL.Query()
+	prefix := q.Get("prefix")
+	token := q.Get("continuation-token")
+	maxBuckets := 1000
+	if mb := q.Get("max-buckets"); mb != "" {
+		v, err := strconv.Atoi(mb)
+		if err != nil || v < 1 || v > 10000 {
+			writeError(w, "InvalidArgument", "max-buckets must be between 1 and 10000", http.StatusBadRequest)
+			return
+		}
+		maxBuckets = v
+	}
 	buckets, err := h.Store.ListBuckets(r.Context())
 	if err != nil {
 		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
 		return
 	}
 	type bucketEntry struct {
-		Name         string `xml:"Name"`
-		CreationDate string `xml:"CreationDate"`
+		Name         string          `xml:"Name"`
+		CreationDate string          `xml:"CreationDate"`
+		Extension    bucketExtension `xml:"https://entity.io/s3/extensions Entity"`
 	}
 	resp := struct {
 		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
 		Xmlns   string   `xml:"xmlns,attr"`
+		Owner   struct {
+			ID          string `xml:"ID"`
+			DisplayName string `xml:"DisplayName"`
+		} `xml:"Owner"`
 		Buckets struct {
 			Bucket []bucketEntry `xml:"Bucket"`
 		} `xml:"Buckets"`
-	}{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/"}
+		ContinuationToken string `xml:"ContinuationToken,omitempty"`
+		Prefix            string `xml:"Prefix,omitempty"`
+	}{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/", Prefix: prefix}
+	resp.Owner.ID = auth.AccessKey
+	resp.Owner.DisplayName = auth.AccessKey
 	for _, b := range buckets {
-		if allowedBucket != "" && b.Name != allowedBucket {
+		if !auth.listsBucket(b.Name) {
+			continue
+		}
+		if !strings.HasPrefix(b.Name, prefix) || (token != "" && b.Name <= token) {
 			continue
 		}
-		resp.Buckets.Bucket = append(resp.Buckets.Bucket, bucketEntry{Name: b.Name, CreationDate: b.CreatedAt.Format(time.RFC3339)})
+		if len(resp.Buckets.Bucket) == maxBuckets {
+			resp.ContinuationToken = resp.Buckets.Bucket[maxBuckets-1].Name
+			break
+		}
+		resp.Buckets.Bucket = append(resp.Buckets.Bucket, bucketEntry{Name: b.Name, CreationDate: b.CreatedAt.Format(time.RFC3339), Extension: newBucketExtension(b)})
 	}
 	writeXML(w, http.StatusOK, resp)
 }
@@ -142,7 +385,21 @@ func (h *Handler) createBucket(w http.ResponseWriter, r *http.Request, bucket st
 	w.WriteHeader(http.StatusOK)
 }
 
+// ForceDeleteHeader on DeleteBucket purges the objects of the bucket first.
+const ForceDeleteHeader = "X-ENTITY-Force-Delete"
+
 func (h *Handler) deleteBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	force := r.Header.Get(ForceDeleteHeader) == "true"
+	if force {
+		if _, err := h.Store.PurgeBucket(r.Context(), bucket); err != nil {
+			if errors.Is(err, objectd.ErrNotFound) {
+				writeError(w, "NoSuchBucket", "bucket does not exist", http.StatusNotFound)
+				return
+			}
+			writeError(w, "InternalError", err.Error(), http.StatusConflict)
+			return
+		}
+	}
 	if err := h.Store.DeleteBucket(r.Context(), bucket); err != nil {
 		if errors.Is(err, objectd.ErrNotFound) {
 			writeError(w, "NoSuchBucket", "bucket does not exist", http.StatusNotFound)
@@ -152,7 +409,11 @@ func (h *Handler) deleteBucket(w http.ResponseWriter, r *http.Request, bucket st
 		return
 	}
 	if h.Cluster != nil && h.Cluster.Enabled() {
-		if err := h.Cluster.Replicate(r.Context(), http.MethodDelete, "/_cluster/replicate/buckets/"+bucket, nil, nil); err != nil {
+		path := "/_cluster/replicate/buckets/" + bucket
+		if force {
+			path += "?force=true"
+		}
+		if err := h.Cluster.Replicate(r.Context(), http.MethodDelete, path, nil, nil); err != nil {
 			writeError(w, "InternalError", err.Error(), http.StatusServiceUnavailable)
 			return
 		}
@@ -200,38 +461,69 @@ func (h *Handler) listObjectsV2(w http.ResponseWriter, r *http.Request, bucket s
 		NextContinuationToken: next,
 	}
 	for _, o := range objects {
-		resp.Contents = append(resp.Contents, contents{Key: o.Key, LastModified: o.ModTime.Format(time.RFC3339), ETag: fmt.Sprintf("\"%s\"", o.ETag), Size: o.Size, StorageClass: "STANDARD"})
+		resp.Contents = append(resp.Contents, contents{Key: o.Key, LastModified: o.ModTime.Format(time.RFC3339), ETag: fmt.Sprintf("\"%s\"", o.ETag), Size: o.Size, StorageClass: o.StorageClass})
 	}
 	writeXML(w, http.StatusOK, resp)
 }
 
 func (h *Handler) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
-	payload, err := io.ReadAll(r.Body)
+	opts := objectd.PutOptions{StorageClass: r.Header.Get("X-Amz-Storage-Class"), ContentType: r.Header.Get("Content-Type")}
+	switch opts.StorageClass {
+	case "", objectd.StorageClassStandard, objectd.StorageClassGlacier, objectd.StorageClassDeepArchive:
+	default:
+		writeError(w, "InvalidStorageClass", "the storage class you specified is not valid", http.StatusBadRequest)
+		return
+	}
+	expires, err := expiresAfter(r)
 	if err != nil {
-		writeError(w, "InternalError", err.Error(), http.StatusBadRequest)
+		writeError(w, "InvalidArgument", err.Error(), http.StatusBadRequest)
 		return
 	}
-	obj, err := h.Store.PutObject(r.Context(), bucket, key, bytes.NewReader(payload))
+	opts.ExpiresAt = expires
+	body := r.Body
+	if h.Limits().MaxObjectSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.Limits().MaxObjectSize)
+	}
+	obj, err := h.Store.PutObjectWithOptions(r.Context(), bucket, key, body, opts)
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, "EntityTooLarge", "your proposed upload exceeds the maximum allowed object size", http.StatusBadRequest)
+			return
+		}
 		if errors.Is(err, objectd.ErrNotFound) {
 			writeError(w, "NoSuchBucket", err.Error(), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, objectd.ErrReadOnly) {
+			writeError(w, "ServiceUnavailable", err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
 		return
 	}
 	if h.Cluster != nil && h.Cluster.Enabled() {
-		if err := h.Cluster.Replicate(r.Context(), http.MethodPut, "/_cluster/replicate/objects/"+bucket+"/"+key, map[string]string{"Content-Type": "application/octet-stream"}, payload); err != nil {
+		if err := h.replicatePut(r.Context(), obj); err != nil {
 			writeError(w, "InternalError", err.Error(), http.StatusServiceUnavailable)
 			return
 		}
 	}
-	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", obj.ETag))
+	setObjectHeaders(w, obj, false)
 	w.WriteHeader(http.StatusOK)
 }
 
 func (h *Handler) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
 	meta, f, err := h.Store.OpenObject(r.Context(), bucket, key)
+	if errors.Is(err, objectd.ErrObjectPending) && h.Cluster != nil {
+		if err := h.Cluster.ProxyToHolder(w, r, bucket, key, meta.Origin); err != nil {
+			writeError(w, "ServiceUnavailable", err.Error(), http.StatusServiceUnavailable)
+		}
+		return
+	}
+	if errors.Is(err, objectd.ErrObjectOffloaded) {
+		h.getOffloaded(w, r, meta)
+		return
+	}
 	if err != nil {
 		if errors.Is(err, objectd.ErrNotFound) {
 			writeError(w, "NoSuchKey", "object not found", http.StatusNotFound)
@@ -241,11 +533,23 @@ func (h *Handler) getObject(w http.ResponseWriter, r *http.Request, bucket, key
 		return
 	}
 	defer f.Close()
-	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", meta.ETag))
-	w.Header().Set("Content-Length", strconv.FormatInt(meta.Size, 10))
-	w.Header().Set("Last-Modified", meta.ModTime.UTC().Format(http.TimeFormat))
-	w.WriteHeader(http.StatusOK)
-	_, _ = io.Copy(w, f)
+	if !meta.Readable(time.Now()) {
+		writeError(w, "InvalidObjectState", objectd.ErrInvalidObjectState.Error(), http.StatusForbidden)
+		return
+	}
+	if h.Access != nil {
+		h.Access.Record(bucket, key)
+	}
+	setObjectHeaders(w, meta, true)
+	// ServeContent answers Range and conditional requests and sets the
+	// length itself. Plain stored bodies are *os.File, which the server
+	// sends with sendfile.
+	w.Header().Del("Content-Length")
+	if meta.ContentType == "" {
+		// Keep ServeContent from sniffing a type.
+		w.Header()["Content-Type"] = nil
+	}
+	http.ServeContent(w, r, "", meta.ModTime, f)
 }
 
 func (h *Handler) headObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
@@ -258,26 +562,75 @@ func (h *Handler) headObject(w http.ResponseWriter, r *http.Request, bucket, key
 		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", meta.ETag))
-	w.Header().Set("Content-Length", strconv.FormatInt(meta.Size, 10))
-	w.Header().Set("Last-Modified", meta.ModTime.UTC().Format(http.TimeFormat))
+	setObjectHeaders(w, meta, true)
 	w.WriteHeader(http.StatusOK)
 }
 
 func (h *Handler) deleteObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
-	if err := h.Store.DeleteObject(r.Context(), bucket, key); err != nil && !errors.Is(err, objectd.ErrNotFound) {
+	seq, err := h.Store.DeleteObject(r.Context(), bucket, key)
+	if err != nil && !errors.Is(err, objectd.ErrNotFound) {
 		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
 		return
 	}
 	if h.Cluster != nil && h.Cluster.Enabled() {
-		if err := h.Cluster.Replicate(r.Context(), http.MethodDelete, "/_cluster/replicate/objects/"+bucket+"/"+key, nil, nil); err != nil {
+		if err := h.replicateDelete(r.Context(), bucket, key, seq); err != nil {
 			writeError(w, "InternalError", err.Error(), http.StatusServiceUnavailable)
 			return
 		}
 	}
+	h.setDeleteMarkerHeaders(w, r, bucket, key, seq)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// replicatePut fans a stored object out to peers, streaming its body from
+// the store to each of them, or records it in the bucket changelog while
+// replication for the bucket is paused.
+func (h *Handler) replicatePut(ctx context.Context, obj objectd.ObjectMeta) error {
+	if deferred, err := h.Store.DeferReplication(ctx, obj.Bucket, objectd.ChangePutObject, obj.Key); err != nil || deferred {
+		return err
+	}
+	return h.Cluster.ReplicatePayload(ctx, http.MethodPut, "/_cluster/replicate/objects/"+obj.Bucket+"/"+obj.Key, cluster.ObjectHeaders(obj), cluster.ObjectPayload(ctx, h.Store, obj))
+}
+
+// replicateDelete sends a delete to peers with the sequence number the
+// local delete returned, so that it cannot overtake a later write.
+func (h *Handler) replicateDelete(ctx context.Context, bucket, key string, seq uint64) error {
+	if deferred, err := h.Store.DeferReplication(ctx, bucket, objectd.ChangeDeleteObject, key); err != nil || deferred {
+		return err
+	}
+	return h.Cluster.Replicate(ctx, http.MethodDelete, "/_cluster/replicate/objects/"+bucket+"/"+key, cluster.DeleteHeaders(seq), nil)
+}
+
+func setObjectHeaders(w http.ResponseWriter, meta objectd.ObjectMeta, withBody bool) {
+	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", meta.ETag))
+	if withBody {
+		w.Header().Set("Content-Length", strconv.FormatInt(meta.Size, 10))
+		w.Header().Set("Last-Modified", meta.ModTime.UTC().Format(http.TimeFormat))
+		if meta.ContentType != "" {
+			w.Header().Set("Content-Type", meta.ContentType)
+		}
+	}
+	if meta.VersionID != "" {
+		w.Header().Set("x-amz-version-id", meta.VersionID)
+	}
+	if meta.Encryption != "" {
+		w.Header().Set("x-amz-server-side-encryption", meta.Encryption)
+	}
+	if meta.StorageClass != objectd.StorageClassStandard {
+		w.Header().Set("x-amz-storage-class", meta.StorageClass)
+	}
+	if !meta.ExpiresAt.IsZero() {
+		w.Header().Set(ExpiresAtHeader, meta.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	if time.Now().Before(meta.RestoreExpiry) {
+		// An offloaded object is still being brought back. A restore that
+		// has expired is not reported, so clients treat the object as
+		// archived again.
+		ongoing := meta.Offloaded()
+		w.Header().Set("x-amz-restore", fmt.Sprintf("ongoing-request=\"%t\", expiry-date=\"%s\"", ongoing, meta.RestoreExpiry.UTC().Format(http.TimeFormat)))
+	}
+}
+
 func splitPath(p string) (bucket, key string) {
 	p = strings.TrimPrefix(p, "/")
 	if p == "" {
@@ -303,5 +656,8 @@ func writeError(w http.ResponseWriter, code, msg string, status int) {
 		Code    string   `xml:"Code"`
 		Message string   `xml:"Message"`
 	}
+	if status >= http.StatusInternalServerError {
+		logbuf.RecordError("s3", code+": "+msg)
+	}
 	writeXML(w, status, errResp{Code: code, Message: msg})
 }
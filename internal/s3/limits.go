@@ -0,0 +1,64 @@
+package s3
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultMaxObjectSize   = 1 << 30
+	DefaultMaxMetadataSize = 2 << 10
+	DefaultMaxParts        = 10000
+)
+
+// Limits bounds what a single request may ask of the server. Zero values
+// disable the corresponding check.
+type Limits struct {
+	MaxObjectSize   int64
+	MaxMetadataSize int
+	MaxParts        int
+}
+
+func DefaultLimits() Limits {
+	return Limits{MaxObjectSize: DefaultMaxObjectSize, MaxMetadataSize: DefaultMaxMetadataSize, MaxParts: DefaultMaxParts}
+}
+
+// metadataSize sums the length of user metadata keys and values the way S3
+// counts them against its 2 KB limit.
+func metadataSize(h http.Header) int {
+	n := 0
+	for k, vs := range h {
+		lk := strings.ToLower(k)
+		if !strings.HasPrefix(lk, "x-amz-meta-") {
+			continue
+		}
+		for _, v := range vs {
+			n += len(lk) - len("x-amz-meta-") + len(v)
+		}
+	}
+	return n
+}
+
+// checkRequest rejects requests that exceed the configured limits before
+// any of the body is read. It reports whether the request may proceed.
+func (l Limits) checkRequest(w http.ResponseWriter, r *http.Request) bool {
+	if l.MaxMetadataSize > 0 && metadataSize(r.Header) > l.MaxMetadataSize {
+		writeError(w, "MetadataTooLarge", "your metadata headers exceed the maximum allowed metadata size", http.StatusBadRequest)
+		return false
+	}
+	if l.MaxParts > 0 {
+		if v := r.URL.Query().Get("partNumber"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > l.MaxParts {
+				writeError(w, "InvalidArgument", "part number must be an integer between 1 and "+strconv.Itoa(l.MaxParts), http.StatusBadRequest)
+				return false
+			}
+		}
+	}
+	if l.MaxObjectSize > 0 && r.ContentLength > l.MaxObjectSize {
+		writeError(w, "EntityTooLarge", "your proposed upload exceeds the maximum allowed object size", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
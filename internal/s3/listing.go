@@ -0,0 +1,45 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// A follower lists buckets and objects from its own metadata, which can lag
+// the leader by the writes still being replicated. A client that must see
+// its latest writes, for example right after failing over to another pod,
+// asks for a leader listing, and the request is served by the leader.
+
+const (
+	ListConsistencyLocal  = "local"
+	ListConsistencyLeader = "leader"
+
+	// ListConsistencyHeader selects where a listing is served.
+	ListConsistencyHeader = "X-ENTITY-List-Consistency"
+)
+
+// ParseListConsistency parses a listing consistency, ignoring case.
+func ParseListConsistency(s string) (string, error) {
+	switch l := strings.ToLower(strings.TrimSpace(s)); l {
+	case ListConsistencyLocal, ListConsistencyLeader:
+		return l, nil
+	}
+	return "", fmt.Errorf("invalid list consistency %q; use local or leader", s)
+}
+
+// listsFromLeader reports whether r is a listing that has to be served by
+// the leader.
+func (h *Handler) listsFromLeader(r *http.Request, bucket, key string) (bool, error) {
+	if r.Method != http.MethodGet || key != "" || bucket != "" && r.URL.Query().Get("list-type") != "2" && !r.URL.Query().Has("versions") {
+		return false, nil
+	}
+	level := h.ListConsistency
+	if v := r.Header.Get(ListConsistencyHeader); v != "" {
+		var err error
+		if level, err = ParseListConsistency(v); err != nil {
+			return false, err
+		}
+	}
+	return level == ListConsistencyLeader, nil
+}
@@ -0,0 +1,103 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+const DefaultLocalWriteThreshold = 8 << 20
+
+// writesLocally reports whether a follower should keep an upload's body
+// instead of proxying it to the leader. Only the metadata commit then goes
+// through the leader, and peers pull the body from this node. In partitioned
+// mode every eligible upload takes this path, on one of the key's owners.
+func (h *Handler) writesLocally(r *http.Request, bucket, key string) bool {
+	if h.Cluster == nil || !h.Cluster.Enabled() || h.Cluster.IsInternalReplication(r) {
+		return false
+	}
+	if r.Method != http.MethodPut || bucket == "" || key == "" || r.Header.Get("X-Amz-Copy-Source") != "" {
+		return false
+	}
+	// Upload parts are kept by the leader until the upload is completed.
+	if r.URL.Query().Has("uploadId") {
+		return false
+	}
+	// Staged bodies are plaintext, and paused buckets are replayed from the
+	// leader's changelog, so both keep using the leader write path.
+	if _, err := h.Store.GetBucketEncryption(r.Context(), bucket); err == nil {
+		return false
+	}
+	if h.Store.ReplicationPaused(r.Context(), bucket) {
+		return false
+	}
+	if h.Cluster.Partitioned(bucket) {
+		return true
+	}
+	if h.LocalWriteThreshold <= 0 || r.ContentLength < h.LocalWriteThreshold {
+		return false
+	}
+	return !h.Cluster.IsLeader(r.Context())
+}
+
+func (h *Handler) putObjectLocal(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	opts := objectd.PutOptions{StorageClass: r.Header.Get("X-Amz-Storage-Class"), ContentType: r.Header.Get("Content-Type")}
+	switch opts.StorageClass {
+	case "", objectd.StorageClassStandard, objectd.StorageClassGlacier, objectd.StorageClassDeepArchive:
+	default:
+		writeError(w, "InvalidStorageClass", "the storage class you specified is not valid", http.StatusBadRequest)
+		return
+	}
+	expires, err := expiresAfter(r)
+	if err != nil {
+		writeError(w, "InvalidArgument", err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.ExpiresAt = expires
+	body := r.Body
+	if h.Limits().MaxObjectSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.Limits().MaxObjectSize)
+	}
+	blob, err := h.Store.StageBlob(r.Context(), body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, "EntityTooLarge", "your proposed upload exceeds the maximum allowed object size", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, objectd.ErrReadOnly) {
+			writeError(w, "ServiceUnavailable", err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	seq, err := h.Cluster.CommitRemote(r.Context(), bucket, key, blob, opts)
+	if err != nil {
+		h.Store.DiscardBlob(r.Context(), blob)
+		writeError(w, "InternalError", err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	obj, _, err := h.Store.CommitBlob(r.Context(), bucket, key, blob, seq, opts)
+	if err != nil {
+		// The peers already point at this replica for a body it does not
+		// have; have the leader take the commit back so they stop waiting.
+		h.Store.DiscardBlob(r.Context(), blob)
+		if aerr := h.Cluster.AbortRemote(context.WithoutCancel(r.Context()), bucket, key, seq); aerr != nil {
+			log.Printf("s3: aborting the commit of %s/%s: %v", bucket, key, aerr)
+		}
+	}
+	if errors.Is(err, objectd.ErrReadOnly) {
+		writeError(w, "ServiceUnavailable", err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setObjectHeaders(w, obj, false)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,53 @@
+package s3
+
+import (
+	"io"
+	"net/http"
+)
+
+// meterRequest counts the body bytes of r and of its response, and returns
+// the writer to respond through and a function that records them once the
+// request is done.
+func (h *Handler) meterRequest(w http.ResponseWriter, r *http.Request, bucket, accessKey string) (http.ResponseWriter, func()) {
+	in := &countingBody{ReadCloser: r.Body}
+	r.Body = in
+	out := &countingWriter{ResponseWriter: w}
+	return out, func() { h.Meter.Record(bucket, accessKey, in.n, out.n) }
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps the server's sendfile path for object bodies: io.Copy
+// hands the file to the wrapped writer's ReadFrom.
+func (w *countingWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(w.ResponseWriter, r)
+	w.n += n
+	return n, err
+}
+
+func (w *countingWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer.
+func (w *countingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,175 @@
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// writeMultipartError maps store errors of the multipart calls to S3 errors.
+func writeMultipartError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, objectd.ErrNotFound):
+		writeError(w, "NoSuchBucket", "bucket does not exist", http.StatusNotFound)
+	case errors.Is(err, objectd.ErrNoSuchUpload):
+		writeError(w, "NoSuchUpload", err.Error(), http.StatusNotFound)
+	case errors.Is(err, objectd.ErrInvalidPart):
+		writeError(w, "InvalidPart", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, objectd.ErrInvalidPartOrder):
+		writeError(w, "InvalidPartOrder", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, objectd.ErrEntityTooSmall):
+		writeError(w, "EntityTooSmall", err.Error(), http.StatusBadRequest)
+	case errors.Is(err, objectd.ErrReadOnly):
+		writeError(w, "ServiceUnavailable", err.Error(), http.StatusServiceUnavailable)
+	default:
+		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	opts := objectd.PutOptions{StorageClass: r.Header.Get("X-Amz-Storage-Class"), ContentType: r.Header.Get("Content-Type")}
+	switch opts.StorageClass {
+	case "", objectd.StorageClassStandard, objectd.StorageClassGlacier, objectd.StorageClassDeepArchive:
+	default:
+		writeError(w, "InvalidStorageClass", "the storage class you specified is not valid", http.StatusBadRequest)
+		return
+	}
+	expires, err := expiresAfter(r)
+	if err != nil {
+		writeError(w, "InvalidArgument", err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.ExpiresAt = expires
+	id, err := h.Store.CreateMultipartUpload(r.Context(), bucket, key, opts)
+	if err != nil {
+		writeMultipartError(w, err)
+		return
+	}
+	writeXML(w, http.StatusOK, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/", Bucket: bucket, Key: key, UploadID: id})
+}
+
+func (h *Handler) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	q := r.URL.Query()
+	number, err := strconv.Atoi(q.Get("partNumber"))
+	if err != nil || number < 1 {
+		writeError(w, "InvalidArgument", "invalid part number", http.StatusBadRequest)
+		return
+	}
+	body := r.Body
+	if h.Limits().MaxObjectSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.Limits().MaxObjectSize)
+	}
+	part, err := h.Store.UploadPart(r.Context(), bucket, key, q.Get("uploadId"), number, body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, "EntityTooLarge", "your proposed upload exceeds the maximum allowed object size", http.StatusBadRequest)
+			return
+		}
+		writeMultipartError(w, err)
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", part.ETag))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) listParts(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	id := r.URL.Query().Get("uploadId")
+	parts, err := h.Store.ListParts(r.Context(), bucket, key, id)
+	if err != nil {
+		writeMultipartError(w, err)
+		return
+	}
+	type partEntry struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+		Size       int64  `xml:"Size"`
+	}
+	resp := struct {
+		XMLName  xml.Name    `xml:"ListPartsResult"`
+		Xmlns    string      `xml:"xmlns,attr"`
+		Bucket   string      `xml:"Bucket"`
+		Key      string      `xml:"Key"`
+		UploadID string      `xml:"UploadId"`
+		Parts    []partEntry `xml:"Part"`
+	}{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/", Bucket: bucket, Key: key, UploadID: id}
+	for _, p := range parts {
+		resp.Parts = append(resp.Parts, partEntry{PartNumber: p.Number, ETag: fmt.Sprintf("\"%s\"", p.ETag), Size: p.Size})
+	}
+	writeXML(w, http.StatusOK, resp)
+}
+
+// completeMultipartUpload is safe to retry: a repeated request with the same
+// part list returns the original result, and the object is replicated again
+// in case the first attempt failed after assembling it.
+func (h *Handler) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	var req struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, "MalformedXML", "the XML you provided was not well-formed", http.StatusBadRequest)
+		return
+	}
+	id := r.URL.Query().Get("uploadId")
+	parts := make([]objectd.CompletedPart, 0, len(req.Parts))
+	for _, p := range req.Parts {
+		parts = append(parts, objectd.CompletedPart{Number: p.PartNumber, ETag: p.ETag})
+	}
+	if maxSize := h.Limits().MaxObjectSize; maxSize > 0 {
+		// A retried completion has no parts left; the store answers it.
+		if uploaded, err := h.Store.ListParts(r.Context(), bucket, key, id); err == nil {
+			sizes := map[int]int64{}
+			for _, p := range uploaded {
+				sizes[p.Number] = p.Size
+			}
+			var total int64
+			for _, p := range parts {
+				total += sizes[p.Number]
+			}
+			if total > maxSize {
+				writeError(w, "EntityTooLarge", "your proposed upload exceeds the maximum allowed object size", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	obj, current, err := h.Store.CompleteMultipartUpload(r.Context(), bucket, key, id, parts)
+	if err != nil {
+		writeMultipartError(w, err)
+		return
+	}
+	if current && h.Cluster != nil && h.Cluster.Enabled() {
+		if err := h.replicatePut(r.Context(), obj); err != nil {
+			writeError(w, "InternalError", err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	writeXML(w, http.StatusOK, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Bucket  string   `xml:"Bucket"`
+		Key     string   `xml:"Key"`
+		ETag    string   `xml:"ETag"`
+	}{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/", Bucket: bucket, Key: key, ETag: fmt.Sprintf("\"%s\"", obj.ETag)})
+}
+
+func (h *Handler) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	if err := h.Store.AbortMultipartUpload(r.Context(), bucket, key, r.URL.Query().Get("uploadId")); err != nil {
+		writeMultipartError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
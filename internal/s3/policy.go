@@ -0,0 +1,116 @@
+package s3
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// authorize checks r against the key's policy if it has one, and otherwise
+// against the key's bucket and read-only flag.
+func authorize(r *http.Request, auth AuthResult, bucket, key string) error {
+	if auth.Policy == nil {
+		if bucket != "" && auth.Bucket != bucket {
+			return errors.New("bucket not allowed")
+		}
+		if auth.ReadOnly && (r.Method == http.MethodPut || r.Method == http.MethodPost || r.Method == http.MethodDelete) {
+			return errors.New("read-only credentials")
+		}
+		return nil
+	}
+	action, resource := requestAction(r, bucket, key)
+	if action == "" {
+		// Not an operation the handler serves; it answers NotImplemented.
+		return nil
+	}
+	if !auth.Policy.Allows(action, resource, auth.Conditions) {
+		return errors.New("access key policy does not allow " + action + " on " + resource)
+	}
+	return nil
+}
+
+// allowsObject reports whether auth may perform action on an object, such
+// as reading the source of a copy.
+func (auth AuthResult) allowsObject(action, bucket, key string) bool {
+	if auth.Policy == nil {
+		return bucket == auth.Bucket
+	}
+	return auth.Policy.Allows(action, objectd.ObjectResource(bucket, key), auth.Conditions)
+}
+
+// listsBucket reports whether bucket is shown to auth in ListBuckets.
+func (auth AuthResult) listsBucket(bucket string) bool {
+	if auth.Policy == nil {
+		return auth.Bucket == "" || bucket == auth.Bucket
+	}
+	return auth.Policy.Allows("s3:ListBucket", objectd.BucketResource(bucket), auth.Conditions)
+}
+
+// requestAction returns the policy action and resource of r, following the
+// routing of ServeHTTP.
+func requestAction(r *http.Request, bucket, key string) (action, resource string) {
+	q := r.URL.Query()
+	obj := objectd.ObjectResource(bucket, key)
+	b := objectd.BucketResource(bucket)
+	switch {
+	case bucket == "":
+		if r.Method == http.MethodGet {
+			return "s3:ListAllMyBuckets", objectd.ResourcePrefix + "*"
+		}
+	case key == "" && q.Has("encryption"):
+		if r.Method == http.MethodGet {
+			return "s3:GetEncryptionConfiguration", b
+		}
+		return "s3:PutEncryptionConfiguration", b
+	case key == "" && q.Has("versioning"):
+		if r.Method == http.MethodGet {
+			return "s3:GetBucketVersioning", b
+		}
+		return "s3:PutBucketVersioning", b
+	case key == "" && q.Has("versions") && r.Method == http.MethodGet:
+		return "s3:ListBucketVersions", b
+	case key == "":
+		switch r.Method {
+		case http.MethodPut:
+			return "s3:CreateBucket", b
+		case http.MethodDelete:
+			return "s3:DeleteBucket", b
+		case http.MethodGet, http.MethodHead:
+			return "s3:ListBucket", b
+		}
+	case q.Has("uploadId") && r.Method == http.MethodGet:
+		return "s3:ListMultipartUploadParts", obj
+	case q.Has("uploadId") && r.Method == http.MethodDelete:
+		return "s3:AbortMultipartUpload", obj
+	case q.Has("restore") && r.Method == http.MethodPost:
+		return "s3:RestoreObject", obj
+	case q.Has("versionId") && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		return "s3:GetObjectVersion", obj
+	case q.Has("versionId") && r.Method == http.MethodDelete:
+		return "s3:DeleteObjectVersion", obj
+	default:
+		switch r.Method {
+		case http.MethodPut, http.MethodPost:
+			return "s3:PutObject", obj
+		case http.MethodGet, http.MethodHead:
+			return "s3:GetObject", obj
+		case http.MethodDelete:
+			return "s3:DeleteObject", obj
+		}
+	}
+	return "", ""
+}
+
+// conditionValues returns the policy condition keys of r.
+func conditionValues(r *http.Request, addr netip.Addr) map[string]string {
+	q := r.URL.Query()
+	return map[string]string{
+		objectd.ConditionPrefix:          q.Get("prefix"),
+		objectd.ConditionDelimiter:       q.Get("delimiter"),
+		objectd.ConditionSourceIP:        addr.String(),
+		objectd.ConditionSecureTransport: strconv.FormatBool(r.TLS != nil),
+	}
+}
@@ -0,0 +1,61 @@
+package s3
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mchenetz/entity/internal/metrics"
+)
+
+// serveAnonymous serves a request without credentials. Only the objects of
+// buckets with public read can be read this way; listings and writes always
+// need a key.
+func (h *Handler) serveAnonymous(w http.ResponseWriter, r *http.Request) {
+	bucket, key := splitPath(r.URL.Path)
+	if mapped, ok := h.Store.BucketForHost(r.Context(), r.Host); ok {
+		bucket, key = mapped, strings.TrimPrefix(r.URL.Path, "/")
+	}
+	if key == "" || r.Method != http.MethodGet && r.Method != http.MethodHead || !h.Store.BucketPublicRead(bucket) {
+		writeError(w, "AccessDenied", "missing auth", http.StatusForbidden)
+		return
+	}
+	metrics.AddCounter("entity_s3_anonymous_reads_total", nil, 1)
+	if h.Meter != nil {
+		var done func()
+		w, done = h.meterRequest(w, r, bucket, "")
+		defer done()
+	}
+	if r.Method == http.MethodHead {
+		h.headObject(w, r, bucket, key)
+		return
+	}
+	h.getObject(w, r, bucket, key)
+}
+
+// writeSize returns the bytes a data write adds to its bucket, as far as
+// they are known before it runs: the length of a put or part, or the size
+// of a copy's source. A completion adds its parts, which were counted as
+// they were uploaded.
+func (h *Handler) writeSize(r *http.Request) int64 {
+	if r.Method == http.MethodPost {
+		return 0
+	}
+	if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+		b, k, ok := parseCopySource(src)
+		if !ok {
+			return 0
+		}
+		m, err := h.Store.GetObjectMeta(r.Context(), b, k)
+		if err != nil {
+			return 0
+		}
+		return m.Size
+	}
+	// Streaming uploads declare the length of the payload without its
+	// chunk signatures.
+	if n, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64); err == nil && n >= 0 {
+		return n
+	}
+	return max(r.ContentLength, 0)
+}
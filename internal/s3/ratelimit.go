@@ -0,0 +1,27 @@
+package s3
+
+import (
+	"net/http"
+
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// applyRateLimit enforces the access key's request rate and wraps the body
+// and response so transfers are paced to its bandwidth limit. It reports
+// whether the request may proceed.
+func (h *Handler) applyRateLimit(w http.ResponseWriter, r *http.Request, a objectd.AccessKey) (http.ResponseWriter, bool) {
+	accessKey := a.AccessKey
+	if !h.RateLimiter.Allow(accessKey+"/requests", a.RequestsPerSecond) {
+		metrics.AddCounter("entity_s3_throttled_requests_total", map[string]string{"access_key": accessKey}, 1)
+		w.Header().Set("Retry-After", "1")
+		writeError(w, "SlowDown", "please reduce your request rate", http.StatusServiceUnavailable)
+		return w, false
+	}
+	if a.BytesPerSecond > 0 {
+		rate := float64(a.BytesPerSecond)
+		r.Body = h.RateLimiter.Reader(r.Context(), accessKey+"/bytes", rate, r.Body)
+		w = h.RateLimiter.ResponseWriter(r.Context(), accessKey+"/bytes", rate, w)
+	}
+	return w, true
+}
@@ -0,0 +1,36 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// redirectToLeader answers with 307 Temporary Redirect to the same request
+// on the leader, the way S3 points clients at another regional endpoint.
+// The client re-sends the request, body included, and has to sign it again
+// for the leader's host.
+func (h *Handler) redirectToLeader(w http.ResponseWriter, r *http.Request) {
+	ordinal, base := h.Cluster.LeaderS3URL(r.Context())
+	if h.LeaderRedirectURL != "" {
+		base = strings.TrimRight(strings.ReplaceAll(h.LeaderRedirectURL, "{ordinal}", strconv.Itoa(ordinal)), "/")
+	}
+	endpoint := base
+	if u, err := url.Parse(base); err == nil && u.Host != "" {
+		endpoint = u.Host
+	}
+	type redirectResp struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string   `xml:"Code"`
+		Message  string   `xml:"Message"`
+		Endpoint string   `xml:"Endpoint"`
+	}
+	w.Header().Set("Location", base+r.URL.RequestURI())
+	writeXML(w, http.StatusTemporaryRedirect, redirectResp{
+		Code:     "TemporaryRedirect",
+		Message:  "Please re-send this request to the specified temporary endpoint.",
+		Endpoint: endpoint,
+	})
+}
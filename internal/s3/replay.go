@@ -0,0 +1,40 @@
+package s3
+
+import (
+	"sync"
+	"time"
+)
+
+// ReplayCache remembers request signatures for the length of the skew window
+// so that a captured request cannot be submitted a second time.
+type ReplayCache struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]time.Time
+	pruned time.Time
+}
+
+func NewReplayCache(window time.Duration) *ReplayCache {
+	return &ReplayCache{window: window, seen: map[string]time.Time{}}
+}
+
+// Remember records sig and reports whether it had not been seen before.
+// Entries expire once the signing time falls outside the window, after which
+// the clock-skew check rejects the request anyway.
+func (c *ReplayCache) Remember(sig string, signedAt, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.pruned) > c.window/4 {
+		for k, exp := range c.seen {
+			if now.After(exp) {
+				delete(c.seen, k)
+			}
+		}
+		c.pruned = now
+	}
+	if exp, ok := c.seen[sig]; ok && !now.After(exp) {
+		return false
+	}
+	c.seen[sig] = signedAt.Add(c.window)
+	return true
+}
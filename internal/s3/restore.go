@@ -0,0 +1,45 @@
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+func (h *Handler) restoreObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	var req struct {
+		XMLName xml.Name `xml:"RestoreRequest"`
+		Days    int      `xml:"Days"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || req.Days < 1 {
+		writeError(w, "MalformedXML", "RestoreRequest with Days is required", http.StatusBadRequest)
+		return
+	}
+	already, err := h.Store.RestoreObject(r.Context(), bucket, key, req.Days)
+	if err != nil {
+		switch {
+		case errors.Is(err, objectd.ErrNotFound):
+			writeError(w, "NoSuchKey", "object not found", http.StatusNotFound)
+		case errors.Is(err, objectd.ErrInvalidObjectState):
+			writeError(w, "InvalidObjectState", "restore is not allowed for the object's current storage class", http.StatusForbidden)
+		default:
+			writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		path := "/_cluster/replicate/restore/" + bucket + "/" + key + "?days=" + strconv.Itoa(req.Days)
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, path, nil, nil); err != nil {
+			writeError(w, "InternalError", err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	if already {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
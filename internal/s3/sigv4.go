@@ -5,11 +5,25 @@ import (
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"sort"
 	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+const (
+	amzDateFormat         = "20060102T150405Z"
+	DefaultMaxRequestSkew = 15 * time.Minute
+)
+
+var (
+	ErrRequestTimeTooSkewed = errors.New("request time too skewed")
+	ErrRequestReplayed      = errors.New("request signature already used")
 )
 
 type CredentialsResolver interface {
@@ -20,9 +34,26 @@ type AuthResult struct {
 	AccessKey string
 	Bucket    string
 	ReadOnly  bool
+	// Policy and Conditions are filled in by the handler once the key and
+	// client address are known.
+	Policy     *objectd.Policy
+	Conditions map[string]string
+}
+
+// SigV4Policy controls the freshness checks applied to signed requests.
+// A zero MaxSkew disables the clock check; a nil Replay disables the nonce
+// cache.
+type SigV4Policy struct {
+	MaxSkew time.Duration
+	Replay  *ReplayCache
+	Now     func() time.Time
 }
 
 func VerifySigV4(r *http.Request, resolver CredentialsResolver) (AuthResult, error) {
+	return VerifySigV4WithPolicy(r, resolver, SigV4Policy{MaxSkew: DefaultMaxRequestSkew})
+}
+
+func VerifySigV4WithPolicy(r *http.Request, resolver CredentialsResolver, policy SigV4Policy) (AuthResult, error) {
 	a := r.Header.Get("Authorization")
 	if !strings.HasPrefix(a, "AWS4-HMAC-SHA256 ") {
 		return AuthResult{}, fmt.Errorf("missing auth")
@@ -49,6 +80,26 @@ func VerifySigV4(r *http.Request, resolver CredentialsResolver) (AuthResult, err
 	if amzDate == "" {
 		return AuthResult{}, fmt.Errorf("missing x-amz-date")
 	}
+	signedAt, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil {
+		return AuthResult{}, fmt.Errorf("malformed x-amz-date")
+	}
+	if signedAt.Format("20060102") != date {
+		return AuthResult{}, fmt.Errorf("credential date does not match x-amz-date")
+	}
+	now := time.Now()
+	if policy.Now != nil {
+		now = policy.Now()
+	}
+	if policy.MaxSkew > 0 {
+		skew := now.Sub(signedAt)
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > policy.MaxSkew {
+			return AuthResult{}, ErrRequestTimeTooSkewed
+		}
+	}
 	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
 	if payloadHash == "" {
 		payloadHash = "UNSIGNED-PAYLOAD"
@@ -72,6 +123,9 @@ func VerifySigV4(r *http.Request, resolver CredentialsResolver) (AuthResult, err
 	if subtle.ConstantTimeCompare([]byte(expected), []byte(sig)) != 1 {
 		return AuthResult{}, fmt.Errorf("signature mismatch")
 	}
+	if policy.Replay != nil && !policy.Replay.Remember(sig, signedAt, now) {
+		return AuthResult{}, ErrRequestReplayed
+	}
 	return AuthResult{AccessKey: accessKey, Bucket: bucket, ReadOnly: readOnly}, nil
 }
 
@@ -0,0 +1,30 @@
+package s3
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// getOffloaded serves an object whose body is only in the cold tier by
+// reading it from the tier target, unless restores are required.
+func (h *Handler) getOffloaded(w http.ResponseWriter, r *http.Request, meta objectd.ObjectMeta) {
+	if h.Tier == nil || h.Tier.RequireRestore() || !meta.Readable(time.Now()) {
+		writeError(w, "InvalidObjectState", "the object is offloaded and must be restored before it can be read", http.StatusForbidden)
+		return
+	}
+	body, err := h.Tier.Open(r.Context(), meta)
+	if err != nil {
+		writeError(w, "ServiceUnavailable", err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer body.Close()
+	if h.Access != nil {
+		h.Access.Record(meta.Bucket, meta.Key)
+	}
+	setObjectHeaders(w, meta, true)
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, body)
+}
@@ -0,0 +1,240 @@
+package s3
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+type versioningConfiguration struct {
+	XMLName xml.Name `xml:"VersioningConfiguration"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	// Status is empty for a bucket that never had versioning enabled.
+	Status string `xml:"Status,omitempty"`
+}
+
+func (h *Handler) getBucketVersioning(w http.ResponseWriter, r *http.Request, bucket string) {
+	cfg, err := h.Store.GetBucketConfig(r.Context(), bucket)
+	if err != nil {
+		if errors.Is(err, objectd.ErrNotFound) {
+			writeError(w, "NoSuchBucket", "bucket does not exist", http.StatusNotFound)
+			return
+		}
+		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := versioningConfiguration{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/"}
+	if cfg.Versioning != objectd.VersioningDisabled {
+		resp.Status = cfg.Versioning
+	}
+	writeXML(w, http.StatusOK, resp)
+}
+
+// putBucketVersioning enables or suspends versioning, keeping the rest of
+// the bucket's configuration.
+func (h *Handler) putBucketVersioning(w http.ResponseWriter, r *http.Request, bucket string) {
+	var req versioningConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "MalformedXML", "invalid versioning configuration", http.StatusBadRequest)
+		return
+	}
+	if req.Status != objectd.VersioningEnabled && req.Status != objectd.VersioningSuspended {
+		writeError(w, "MalformedXML", "Status must be Enabled or Suspended", http.StatusBadRequest)
+		return
+	}
+	cfg, err := h.Store.GetBucketConfig(r.Context(), bucket)
+	if err != nil {
+		if errors.Is(err, objectd.ErrNotFound) {
+			writeError(w, "NoSuchBucket", "bucket does not exist", http.StatusNotFound)
+			return
+		}
+		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cfg.Versioning = req.Status
+	if err := h.Store.PutBucketConfig(r.Context(), bucket, cfg); err != nil {
+		writeError(w, "InvalidArgument", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		payload, _ := json.Marshal(cfg)
+		if err := h.Cluster.Replicate(r.Context(), http.MethodPost, "/_cluster/replicate/buckets/"+bucket+"/config", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+			writeError(w, "InternalError", err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) listObjectVersions(w http.ResponseWriter, r *http.Request, bucket string) {
+	q := r.URL.Query()
+	prefix := q.Get("prefix")
+	maxKeys := 1000
+	if mk := q.Get("max-keys"); mk != "" {
+		if v, err := strconv.Atoi(mk); err == nil {
+			maxKeys = v
+		}
+	}
+	versions, nextKey, nextVersion, truncated, err := h.Store.ListObjectVersions(r.Context(), bucket, prefix, q.Get("key-marker"), q.Get("version-id-marker"), maxKeys)
+	if err != nil {
+		if errors.Is(err, objectd.ErrNotFound) {
+			writeError(w, "NoSuchBucket", "bucket does not exist", http.StatusNotFound)
+			return
+		}
+		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	type version struct {
+		Key          string `xml:"Key"`
+		VersionID    string `xml:"VersionId"`
+		IsLatest     bool   `xml:"IsLatest"`
+		LastModified string `xml:"LastModified"`
+		ETag         string `xml:"ETag,omitempty"`
+		Size         int64  `xml:"Size,omitempty"`
+		StorageClass string `xml:"StorageClass,omitempty"`
+	}
+	resp := struct {
+		XMLName             xml.Name  `xml:"ListVersionsResult"`
+		Xmlns               string    `xml:"xmlns,attr"`
+		Name                string    `xml:"Name"`
+		Prefix              string    `xml:"Prefix"`
+		KeyMarker           string    `xml:"KeyMarker"`
+		VersionIDMarker     string    `xml:"VersionIdMarker"`
+		NextKeyMarker       string    `xml:"NextKeyMarker,omitempty"`
+		NextVersionIDMarker string    `xml:"NextVersionIdMarker,omitempty"`
+		MaxKeys             int       `xml:"MaxKeys"`
+		IsTruncated         bool      `xml:"IsTruncated"`
+		Versions            []version `xml:"Version"`
+		DeleteMarkers       []version `xml:"DeleteMarker"`
+	}{
+		Xmlns:               "http://s3.amazonaws.com/doc/2006-03-01/",
+		Name:                bucket,
+		Prefix:              prefix,
+		KeyMarker:           q.Get("key-marker"),
+		VersionIDMarker:     q.Get("version-id-marker"),
+		NextKeyMarker:       nextKey,
+		NextVersionIDMarker: nextVersion,
+		MaxKeys:             maxKeys,
+		IsTruncated:         truncated,
+	}
+	for _, v := range versions {
+		out := version{Key: v.Key, VersionID: versionID(v.ObjectMeta), IsLatest: v.IsLatest, LastModified: v.ModTime.Format(time.RFC3339)}
+		if v.DeleteMarker {
+			resp.DeleteMarkers = append(resp.DeleteMarkers, out)
+			continue
+		}
+		out.ETag, out.Size, out.StorageClass = fmt.Sprintf("\"%s\"", v.ETag), v.Size, v.StorageClass
+		resp.Versions = append(resp.Versions, out)
+	}
+	writeXML(w, http.StatusOK, resp)
+}
+
+// versionID returns the version ID S3 reports for meta.
+func versionID(meta objectd.ObjectMeta) string {
+	if meta.VersionID == "" {
+		return objectd.NullVersionID
+	}
+	return meta.VersionID
+}
+
+// writeVersionError answers a request for a version that cannot be served.
+func writeVersionError(w http.ResponseWriter, v objectd.ObjectVersion, err error) {
+	switch {
+	case errors.Is(err, objectd.ErrDeleteMarker):
+		w.Header().Set("x-amz-delete-marker", "true")
+		w.Header().Set("x-amz-version-id", versionID(v.ObjectMeta))
+		writeError(w, "MethodNotAllowed", "the specified method is not allowed against a delete marker", http.StatusMethodNotAllowed)
+	case errors.Is(err, objectd.ErrNotFound):
+		writeError(w, "NoSuchVersion", "the specified version does not exist", http.StatusNotFound)
+	default:
+		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) getObjectVersion(w http.ResponseWriter, r *http.Request, bucket, key, id string) {
+	v, f, err := h.Store.OpenObjectVersion(r.Context(), bucket, key, id)
+	if errors.Is(err, objectd.ErrObjectPending) && h.Cluster != nil {
+		if err := h.Cluster.ProxyToHolder(w, r, bucket, key, v.Origin); err != nil {
+			writeError(w, "ServiceUnavailable", err.Error(), http.StatusServiceUnavailable)
+		}
+		return
+	}
+	if errors.Is(err, objectd.ErrObjectOffloaded) {
+		h.getOffloaded(w, r, v.ObjectMeta)
+		return
+	}
+	if err != nil {
+		writeVersionError(w, v, err)
+		return
+	}
+	defer f.Close()
+	if !v.Readable(time.Now()) {
+		writeError(w, "InvalidObjectState", objectd.ErrInvalidObjectState.Error(), http.StatusForbidden)
+		return
+	}
+	setObjectHeaders(w, v.ObjectMeta, true)
+	w.Header().Del("Content-Length")
+	if v.ContentType == "" {
+		w.Header()["Content-Type"] = nil
+	}
+	http.ServeContent(w, r, "", v.ModTime, f)
+}
+
+func (h *Handler) headObjectVersion(w http.ResponseWriter, r *http.Request, bucket, key, id string) {
+	v, err := h.Store.GetObjectVersion(r.Context(), bucket, key, id)
+	if err == nil && v.DeleteMarker {
+		err = objectd.ErrDeleteMarker
+	}
+	if err != nil {
+		writeVersionError(w, v, err)
+		return
+	}
+	setObjectHeaders(w, v.ObjectMeta, true)
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteObjectVersion removes a version for good and replicates the delete
+// with the sequence number it was stamped with, if it removed the current
+// version.
+func (h *Handler) deleteObjectVersion(w http.ResponseWriter, r *http.Request, bucket, key, id string) {
+	v, seq, err := h.Store.DeleteObjectVersion(r.Context(), bucket, key, id, 0)
+	if err != nil && !errors.Is(err, objectd.ErrNotFound) {
+		writeError(w, "InternalError", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.Cluster != nil && h.Cluster.Enabled() {
+		var headers map[string]string
+		if seq != 0 {
+			headers = cluster.DeleteHeaders(seq)
+		}
+		if err := h.Cluster.Replicate(r.Context(), http.MethodDelete, "/_cluster/replicate/versions/"+bucket+"/"+id+"/"+key, headers, nil); err != nil {
+			writeError(w, "InternalError", err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.Header().Set("x-amz-version-id", id)
+	if v.DeleteMarker {
+		w.Header().Set("x-amz-delete-marker", "true")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setDeleteMarkerHeaders reports the delete marker a delete at seq placed
+// in a versioned bucket.
+func (h *Handler) setDeleteMarkerHeaders(w http.ResponseWriter, r *http.Request, bucket, key string, seq uint64) {
+	for _, id := range []string{strconv.FormatUint(seq, 10), objectd.NullVersionID} {
+		v, err := h.Store.GetObjectVersion(r.Context(), bucket, key, id)
+		if err == nil && v.DeleteMarker && v.Seq == seq {
+			w.Header().Set("x-amz-delete-marker", "true")
+			w.Header().Set("x-amz-version-id", versionID(v.ObjectMeta))
+			return
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package scrub re-reads stored objects in the background and checks them
+// against their recorded checksum, so bitrot is found before a client reads
+// the damaged copy. In a cluster, corrupt objects are fetched again from a
+// healthy replica.
+package scrub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/internal/objectd"
+	"github.com/mchenetz/entity/internal/ratelimit"
+)
+
+// maxFindings caps the corrupt objects kept in Status.
+const maxFindings = 1000
+
+type Config struct {
+	// Interval is the pause before the first pass and between the end of
+	// one pass and the start of the next.
+	Interval time.Duration
+	// BytesPerSecond caps the read rate. Zero means unlimited.
+	BytesPerSecond int64
+}
+
+// Finding is an object whose body did not match its checksum.
+type Finding struct {
+	Bucket     string    `json:"bucket"`
+	Key        string    `json:"key"`
+	Seq        uint64    `json:"seq"`
+	DetectedAt time.Time `json:"detectedAt"`
+	Error      string    `json:"error"`
+	// Repair is "refetching" once a healthy copy was requested from a
+	// peer, "repaired" once the object verified again, and empty when no
+	// repair is possible.
+	Repair string `json:"repair,omitempty"`
+}
+
+type Status struct {
+	PassStartedAt  time.Time `json:"passStartedAt"`
+	LastPassAt     time.Time `json:"lastPassAt"`
+	LastPassError  string    `json:"lastPassError,omitempty"`
+	ObjectsChecked int       `json:"objectsChecked"`
+	BytesChecked   int64     `json:"bytesChecked"`
+	Findings       []Finding `json:"findings"`
+}
+
+type Scrubber struct {
+	cfg     Config
+	store   *objectd.Store
+	cluster *cluster.Cluster
+	limiter *ratelimit.Limiter
+	// rate starts as BytesPerSecond and follows SetBytesPerSecond.
+	rate atomic.Int64
+
+	mu     sync.Mutex
+	status Status
+}
+
+func New(cfg Config, store *objectd.Store, c *cluster.Cluster) *Scrubber {
+	s := &Scrubber{cfg: cfg, store: store, cluster: c, limiter: ratelimit.New()}
+	s.rate.Store(cfg.BytesPerSecond)
+	return s
+}
+
+// SetBytesPerSecond changes the read rate cap from the next object on.
+func (s *Scrubber) SetBytesPerSecond(n int64) { s.rate.Store(n) }
+
+func (s *Scrubber) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := s.status
+	out.Findings = append([]Finding{}, s.status.Findings...)
+	return out
+}
+
+// Run scrubs the store until ctx is done, waiting Interval before the first
+// pass so restarts do not trigger a full read each time.
+func (s *Scrubber) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.cfg.Interval):
+		}
+		if err := s.Pass(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("scrub: %v", err)
+		}
+	}
+}
+
+// Pass verifies every object once.
+func (s *Scrubber) Pass(ctx context.Context) error {
+	s.mu.Lock()
+	s.status.PassStartedAt = time.Now().UTC()
+	s.status.ObjectsChecked, s.status.BytesChecked = 0, 0
+	s.mu.Unlock()
+	err := s.pass(ctx)
+	s.mu.Lock()
+	s.status.LastPassAt = time.Now().UTC()
+	s.status.LastPassError = ""
+	if err != nil {
+		s.status.LastPassError = err.Error()
+	}
+	s.mu.Unlock()
+	return err
+}
+
+func (s *Scrubber) pass(ctx context.Context) error {
+	buckets, err := s.store.ListBuckets(ctx)
+	if err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		token := ""
+		for {
+			objs, next, truncated, err := s.store.ListObjectsV2(ctx, b.Name, "", token, 1000)
+			if errors.Is(err, objectd.ErrNotFound) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			for _, m := range objs {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if !m.Pending && !m.Offloaded() {
+					s.check(ctx, m)
+				}
+			}
+			if !truncated {
+				break
+			}
+			token = next
+		}
+	}
+	return nil
+}
+
+// check verifies one object and records the outcome.
+func (s *Scrubber) check(ctx context.Context, m objectd.ObjectMeta) {
+	n, err := s.verify(ctx, m)
+	if ctx.Err() != nil || errors.Is(err, objectd.ErrEncryptionNotConfigured) {
+		return
+	}
+	if err != nil {
+		// The object may have been replaced or deleted while it was read.
+		cur, cerr := s.store.GetObjectMeta(ctx, m.Bucket, m.Key)
+		if cerr != nil || cur.Seq != m.Seq || cur.Pending {
+			return
+		}
+	}
+	metrics.AddCounter("entity_scrub_objects_total", nil, 1)
+	metrics.AddCounter("entity_scrub_bytes_total", nil, float64(n))
+	s.mu.Lock()
+	s.status.ObjectsChecked++
+	s.status.BytesChecked += n
+	s.mu.Unlock()
+	if err == nil {
+		s.resolve(m)
+		return
+	}
+	log.Printf("scrub: %s/%s: %v", m.Bucket, m.Key, err)
+	metrics.AddCounter("entity_scrub_corrupt_total", nil, 1)
+	f := Finding{Bucket: m.Bucket, Key: m.Key, Seq: m.Seq, DetectedAt: time.Now().UTC(), Error: err.Error()}
+	if s.cluster != nil && s.cluster.Enabled() {
+		origin := s.cluster.NextOrdinal()
+		if rerr := s.store.RefetchObject(ctx, m.Bucket, m.Key, m.Seq, origin); rerr != nil {
+			log.Printf("scrub: %s/%s: refetch: %v", m.Bucket, m.Key, rerr)
+		} else {
+			f.Repair = "refetching"
+		}
+	}
+	s.record(f)
+}
+
+// verify reads the object and compares its SHA-256 with the ETag. It
+// returns the bytes read.
+func (s *Scrubber) verify(ctx context.Context, m objectd.ObjectMeta) (int64, error) {
+	_, body, err := s.store.OpenStoredObject(ctx, m.Bucket, m.Key)
+	if errors.Is(err, objectd.ErrNotFound) {
+		return 0, errors.New("body is missing")
+	}
+	if err != nil {
+		return 0, err
+	}
+	r := s.limiter.Reader(ctx, "scrub", float64(s.rate.Load()), body)
+	defer r.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return n, fmt.Errorf("read: %w", err)
+	}
+	if n != m.Size {
+		return n, fmt.Errorf("size %d, want %d", n, m.Size)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != m.ETag {
+		return n, fmt.Errorf("checksum %s, want %s", sum, m.ETag)
+	}
+	return n, nil
+}
+
+func (s *Scrubber) record(f Finding) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, old := range s.status.Findings {
+		if old.Bucket == f.Bucket && old.Key == f.Key {
+			s.status.Findings = append(s.status.Findings[:i], s.status.Findings[i+1:]...)
+			break
+		}
+	}
+	s.status.Findings = append(s.status.Findings, f)
+	if len(s.status.Findings) > maxFindings {
+		s.status.Findings = s.status.Findings[len(s.status.Findings)-maxFindings:]
+	}
+}
+
+// resolve marks an earlier finding for m as repaired.
+func (s *Scrubber) resolve(m objectd.ObjectMeta) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.status.Findings {
+		if f.Bucket == m.Bucket && f.Key == m.Key && f.Repair != "repaired" {
+			s.status.Findings[i].Repair = "repaired"
+		}
+	}
+}
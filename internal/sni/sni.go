@@ -0,0 +1,94 @@
+package sni
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Certificates serves per-domain certificates found under Dir. Every
+// subdirectory holding a tls.crt/tls.key pair (for example a mounted Secret)
+// contributes one certificate, selected by the TLS SNI server name.
+type Certificates struct {
+	Dir string
+
+	mu     sync.RWMutex
+	byName map[string]*tls.Certificate
+}
+
+func New(dir string) *Certificates {
+	c := &Certificates{Dir: dir, byName: map[string]*tls.Certificate{}}
+	c.Reload()
+	return c
+}
+
+func (c *Certificates) Reload() {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("failed to read domain certificates: %v", err)
+		}
+		return
+	}
+	byName := map[string]*tls.Certificate{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(c.Dir, e.Name())
+		cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+		if err != nil {
+			log.Printf("skipping domain certificate %s: %v", e.Name(), err)
+			continue
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			continue
+		}
+		cert.Leaf = leaf
+		for _, name := range leaf.DNSNames {
+			byName[strings.ToLower(name)] = &cert
+		}
+	}
+	c.mu.Lock()
+	c.byName = byName
+	c.mu.Unlock()
+}
+
+func (c *Certificates) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.Reload()
+		}
+	}
+}
+
+// GetCertificate implements tls.Config.GetCertificate. It returns nil when no
+// domain certificate matches so the server's default certificate is used.
+func (c *Certificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(hello.ServerName)
+	if name == "" {
+		return nil, nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if cert, ok := c.byName[name]; ok {
+		return cert, nil
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := c.byName["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,377 @@
+package standby
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/objectd"
+	"github.com/mchenetz/entity/internal/outbound"
+)
+
+type Config struct {
+	PrimaryURL string
+	Token      string
+	CAFile     string
+	Interval   time.Duration
+}
+
+type Status struct {
+	Standby    bool      `json:"standby"`
+	Promoted   bool      `json:"promoted"`
+	PrimaryURL string    `json:"primaryURL,omitempty"`
+	Cursor     uint64    `json:"cursor"`
+	LastSync   time.Time `json:"lastSync,omitempty"`
+	LagSeq     uint64    `json:"lagSeq"`
+	LastError  string    `json:"lastError,omitempty"`
+}
+
+// Follower tails the changelog of a primary cluster and applies it to the
+// local store. On a replicated standby only the leader tails the primary and
+// forwards what it applies to its own peers.
+type Follower struct {
+	Store   *objectd.Store
+	Cluster *cluster.Cluster
+	cfg     Config
+	client  *http.Client
+
+	mu        sync.Mutex
+	lastSync  time.Time
+	lagSeq    uint64
+	lastError string
+}
+
+func New(cfg Config, store *objectd.Store, c *cluster.Cluster) (*Follower, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	tr, err := outbound.NewTransport(cfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Follower{Store: store, Cluster: c, cfg: cfg, client: &http.Client{Transport: tr}}, nil
+}
+
+func (f *Follower) Status() Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return Status{
+		Standby:    f.Store.Standby(),
+		Promoted:   f.Store.Promoted(),
+		PrimaryURL: f.cfg.PrimaryURL,
+		Cursor:     f.Store.StandbyCursor(),
+		LastSync:   f.lastSync,
+		LagSeq:     f.lagSeq,
+		LastError:  f.lastError,
+	}
+}
+
+// Run polls the primary until ctx is cancelled or the store is promoted.
+func (f *Follower) Run(ctx context.Context) {
+	t := time.NewTicker(f.cfg.Interval)
+	defer t.Stop()
+	for {
+		if !f.Store.Standby() {
+			return
+		}
+		if f.Cluster == nil || !f.Cluster.Enabled() || f.Cluster.IsLeader(ctx) {
+			err := f.sync(ctx)
+			f.mu.Lock()
+			f.lastError = ""
+			if err != nil {
+				f.lastError = err.Error()
+				log.Printf("standby sync from %s: %v", f.cfg.PrimaryURL, err)
+			}
+			f.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// sync applies changes until the standby has caught up with the primary. A
+// cursor of zero lists every object on the primary; afterwards anything
+// that was not listed is removed locally.
+func (f *Follower) sync(ctx context.Context) error {
+	cursor := f.Store.StandbyCursor()
+	var seen map[string]bool
+	if cursor == 0 {
+		seen = map[string]bool{}
+	}
+	for {
+		if !f.Store.Standby() {
+			return nil
+		}
+		feed, err := f.changes(ctx, cursor)
+		if err != nil {
+			return err
+		}
+		if feed.Truncated {
+			log.Printf("standby fell behind the primary changelog; resyncing")
+			cursor, seen = 0, map[string]bool{}
+			continue
+		}
+		if err := f.applyBuckets(ctx, feed.Buckets); err != nil {
+			return err
+		}
+		if err := f.applyAccess(ctx, feed.Access); err != nil {
+			return err
+		}
+		for _, ch := range feed.Changes {
+			if err := f.apply(ctx, ch); err != nil {
+				return err
+			}
+			if seen != nil && !ch.Deleted {
+				seen[ch.Bucket+"/"+ch.Key] = true
+			}
+		}
+		cursor = feed.Next
+		f.mu.Lock()
+		f.lagSeq = feed.Clock - cursor
+		f.mu.Unlock()
+		if feed.More {
+			// During a full resync the cursor is only persisted once every
+			// object has been listed, so an interrupted resync starts over.
+			if seen == nil {
+				if err := f.Store.SetStandbyCursor(ctx, cursor); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if seen != nil {
+			if err := f.prune(ctx, seen); err != nil {
+				return err
+			}
+		}
+		if err := f.removeBuckets(ctx, feed.Buckets); err != nil {
+			return err
+		}
+		if err := f.Store.SetStandbyCursor(ctx, cursor); err != nil {
+			return err
+		}
+		f.mu.Lock()
+		f.lastSync = time.Now().UTC()
+		f.mu.Unlock()
+		return nil
+	}
+}
+
+func (f *Follower) changes(ctx context.Context, since uint64) (objectd.ChangeFeed, error) {
+	var feed objectd.ChangeFeed
+	resp, err := f.get(ctx, "/admin/standby/changes?since="+strconv.FormatUint(since, 10))
+	if err != nil {
+		return feed, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return feed, fmt.Errorf("changes: %s", resp.Status)
+	}
+	return feed, json.NewDecoder(resp.Body).Decode(&feed)
+}
+
+func (f *Follower) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.cfg.PrimaryURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+f.cfg.Token)
+	return f.client.Do(req)
+}
+
+func (f *Follower) apply(ctx context.Context, ch objectd.ObjectChange) error {
+	if ch.Deleted {
+		applied, err := f.Store.ApplyReplicatedDelete(ctx, ch.Bucket, ch.Key, ch.Seq)
+		if err != nil && err != objectd.ErrNotFound {
+			return err
+		}
+		if applied {
+			return f.replicate(ctx, http.MethodDelete, "/_cluster/replicate/objects/"+ch.Bucket+"/"+ch.Key, cluster.DeleteHeaders(ch.Seq), nil)
+		}
+		return nil
+	}
+	if m, err := f.Store.GetObjectMeta(ctx, ch.Bucket, ch.Key); err == nil && m.Seq >= ch.Seq {
+		return nil
+	}
+	resp, err := f.get(ctx, "/admin/standby/objects/"+ch.Bucket+"/"+ch.Key)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch %s/%s: %s", ch.Bucket, ch.Key, resp.Status)
+	}
+	if resp.Header.Get(cluster.SeqHeader) != strconv.FormatUint(ch.Seq, 10) {
+		// The object changed again on the primary; the newer version is
+		// further along in the changelog.
+		return nil
+	}
+	expires, _ := time.Parse(time.RFC3339Nano, ch.ExpiresAt)
+	m, applied, err := f.Store.ApplyReplicatedObject(ctx, ch.Bucket, ch.Key, resp.Body, ch.Seq, objectd.PutOptions{StorageClass: ch.StorageClass, ContentType: ch.ContentType, ExpiresAt: expires})
+	if err != nil {
+		return err
+	}
+	if m.ETag != ch.ETag {
+		return fmt.Errorf("fetch %s/%s: etag mismatch", ch.Bucket, ch.Key)
+	}
+	if applied && f.Cluster != nil && f.Cluster.Enabled() {
+		return f.Cluster.ReplicatePayload(ctx, http.MethodPut, "/_cluster/replicate/objects/"+ch.Bucket+"/"+ch.Key, cluster.ObjectHeaders(m), cluster.ObjectPayload(ctx, f.Store, m))
+	}
+	return nil
+}
+
+func (f *Follower) applyBuckets(ctx context.Context, buckets []objectd.FeedBucket) error {
+	local, err := f.Store.ListBuckets(ctx)
+	if err != nil {
+		return err
+	}
+	have := map[string]bool{}
+	for _, b := range local {
+		have[b.Name] = true
+	}
+	primary := map[string]bool{}
+	for _, b := range buckets {
+		primary[b.Name] = true
+	}
+	for _, b := range buckets {
+		if !have[b.Name] && b.RenamedFrom != "" && have[b.RenamedFrom] && !primary[b.RenamedFrom] {
+			// Renamed on the primary: rename here too rather than fetch the
+			// objects again under the new name.
+			if err := f.Store.RenameBucket(ctx, b.RenamedFrom, b.Name); err != nil {
+				return err
+			}
+			payload, _ := json.Marshal(map[string]string{"name": b.Name})
+			if err := f.replicate(ctx, http.MethodPost, "/_cluster/replicate/buckets/"+b.RenamedFrom+"/rename", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+				return err
+			}
+			delete(have, b.RenamedFrom)
+			have[b.Name] = true
+		}
+		if !have[b.Name] {
+			if err := f.Store.CreateBucket(ctx, b.Name); err != nil {
+				return err
+			}
+			if err := f.replicate(ctx, http.MethodPost, "/_cluster/replicate/buckets/"+b.Name, nil, nil); err != nil {
+				return err
+			}
+		}
+		cfg := objectd.BucketConfig{Versioning: b.Versioning, QuotaBytes: b.QuotaBytes, PublicRead: b.PublicRead, Encryption: b.Encryption}
+		if cur, _ := f.Store.GetBucketConfig(ctx, b.Name); cur == cfg {
+			continue
+		}
+		if err := f.Store.PutBucketConfig(ctx, b.Name, cfg); err != nil {
+			return err
+		}
+		payload, _ := json.Marshal(cfg)
+		if err := f.replicate(ctx, http.MethodPost, "/_cluster/replicate/buckets/"+b.Name+"/config", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Follower) applyAccess(ctx context.Context, keys []objectd.AccessKey) error {
+	want := map[string]bool{}
+	for _, a := range keys {
+		want[a.AccessKey] = true
+		if cur, err := f.Store.LookupAccessKey(ctx, a.AccessKey); err == nil && reflect.DeepEqual(cur, a) {
+			continue
+		}
+		if err := f.Store.PutAccess(ctx, a); err != nil {
+			return err
+		}
+		payload, _ := json.Marshal(a)
+		if err := f.replicate(ctx, http.MethodPost, "/_cluster/replicate/access", map[string]string{"Content-Type": "application/json"}, payload); err != nil {
+			return err
+		}
+	}
+	for _, a := range f.Store.ListAccess(ctx) {
+		if want[a.AccessKey] {
+			continue
+		}
+		if err := f.Store.DeleteAccess(ctx, a.AccessKey); err != nil {
+			return err
+		}
+		if err := f.replicate(ctx, http.MethodDelete, "/_cluster/replicate/access/"+a.AccessKey, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune deletes local objects that a full listing of the primary did not
+// contain.
+func (f *Follower) prune(ctx context.Context, seen map[string]bool) error {
+	local, err := f.Store.ListBuckets(ctx)
+	if err != nil {
+		return err
+	}
+	for _, b := range local {
+		token := ""
+		for {
+			objs, next, truncated, err := f.Store.ListObjectsV2(ctx, b.Name, "", token, 1000)
+			if err != nil {
+				return err
+			}
+			for _, o := range objs {
+				if seen[b.Name+"/"+o.Key] {
+					continue
+				}
+				seq, err := f.Store.DeleteObject(ctx, b.Name, o.Key)
+				if err != nil {
+					return err
+				}
+				if err := f.replicate(ctx, http.MethodDelete, "/_cluster/replicate/objects/"+b.Name+"/"+o.Key, cluster.DeleteHeaders(seq), nil); err != nil {
+					return err
+				}
+			}
+			if !truncated {
+				break
+			}
+			token = next
+		}
+	}
+	return nil
+}
+
+// removeBuckets drops local buckets that no longer exist on the primary.
+func (f *Follower) removeBuckets(ctx context.Context, buckets []objectd.FeedBucket) error {
+	want := map[string]bool{}
+	for _, b := range buckets {
+		want[b.Name] = true
+	}
+	local, err := f.Store.ListBuckets(ctx)
+	if err != nil {
+		return err
+	}
+	for _, b := range local {
+		if want[b.Name] {
+			continue
+		}
+		if err := f.Store.DeleteBucket(ctx, b.Name); err != nil {
+			log.Printf("standby: bucket %s was removed on the primary but cannot be removed here: %v", b.Name, err)
+			continue
+		}
+		if err := f.replicate(ctx, http.MethodDelete, "/_cluster/replicate/buckets/"+b.Name, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Follower) replicate(ctx context.Context, method, path string, headers map[string]string, body []byte) error {
+	if f.Cluster == nil || !f.Cluster.Enabled() {
+		return nil
+	}
+	return f.Cluster.Replicate(ctx, method, path, headers, body)
+}
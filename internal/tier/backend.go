@@ -0,0 +1,228 @@
+package tier
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// Backend keeps the object bodies of a store in an S3 or S3-compatible
+// bucket instead of the data volume, so objectd passes bodies through to the
+// target while it keeps the metadata itself. Bodies are named by their path
+// under the data directory, which becomes the key below the prefix.
+type Backend struct {
+	client *client
+	root   string
+	prefix string
+}
+
+var _ objectd.Backend = (*Backend)(nil)
+
+// NewBackend returns a backend storing the bodies of the store in dataDir
+// under prefix in the target bucket. rt carries the requests to the target;
+// nil means http.DefaultTransport.
+func NewBackend(target Target, prefix, dataDir string, rt http.RoundTripper) (*Backend, error) {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	c, err := newClient(target, rt)
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{client: c, root: filepath.Clean(dataDir), prefix: prefix}, nil
+}
+
+// key maps a body name to its key in the target.
+func (b *Backend) key(name string) (string, error) {
+	rel, err := filepath.Rel(b.root, name)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("tier backend: %s is outside %s", name, b.root)
+	}
+	return b.prefix + filepath.ToSlash(rel), nil
+}
+
+// name maps a key in the target back to a body name.
+func (b *Backend) name(key string) string {
+	return filepath.Join(b.root, filepath.FromSlash(strings.TrimPrefix(key, b.prefix)))
+}
+
+func notFound(err error) error {
+	if errors.Is(err, errNotFound) {
+		return objectd.ErrNotFound
+	}
+	return err
+}
+
+func (b *Backend) Put(name, src string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := b.client.put(context.Background(), key, f, size, hex.EncodeToString(h.Sum(nil))); err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(src)
+}
+
+func (b *Backend) Get(name string) (io.ReadSeekCloser, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+	size, _, err := b.client.head(context.Background(), key)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &rangeReader{client: b.client, key: key, size: size}, nil
+}
+
+func (b *Backend) Stat(name string) (objectd.BlobInfo, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return objectd.BlobInfo{}, err
+	}
+	size, modTime, err := b.client.head(context.Background(), key)
+	if err != nil {
+		return objectd.BlobInfo{}, notFound(err)
+	}
+	return objectd.BlobInfo{Name: name, Size: size, ModTime: modTime}, nil
+}
+
+func (b *Backend) Delete(name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+	return b.client.remove(context.Background(), key)
+}
+
+// Rename downloads name, uploads it as newName and deletes name. Renames
+// only set bodies aside, so they are rare enough not to need server-side
+// copies.
+func (b *Backend) Rename(name, newName string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+	newKey, err := b.key(newName)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	size, _, err := b.client.head(ctx, key)
+	if err != nil {
+		return notFound(err)
+	}
+	body, err := b.client.get(ctx, key)
+	if err != nil {
+		return notFound(err)
+	}
+	err = b.client.put(ctx, newKey, body, size, "")
+	body.Close()
+	if err != nil {
+		return err
+	}
+	return b.client.remove(ctx, key)
+}
+
+func (b *Backend) List(ctx context.Context, dir string, fn func(objectd.BlobInfo) error) error {
+	prefix, err := b.key(dir)
+	if err != nil {
+		return err
+	}
+	prefix += "/"
+	token := ""
+	for {
+		page, err := b.client.list(ctx, prefix, token)
+		if err != nil {
+			return err
+		}
+		for _, e := range page.Contents {
+			if err := fn(objectd.BlobInfo{Name: b.name(e.Key), Size: e.Size, ModTime: e.LastModified}); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// rangeReader reads a body with ranged GETs, reopening it after a seek.
+type rangeReader struct {
+	client *client
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.client.getFrom(context.Background(), r.key, r.offset)
+		if err != nil {
+			return 0, notFound(err)
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if errors.Is(err, io.EOF) && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return r.offset, errors.New("seek before start of body")
+	}
+	if offset != r.offset && r.body != nil {
+		_ = r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *rangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,202 @@
+package tier
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+// fakeS3 serves one path-style bucket from memory, with ranged GETs and
+// ListObjectsV2 pages of two keys.
+type fakeS3 struct {
+	bucket string
+	mu     sync.Mutex
+	data   map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, r)
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.data[key] = body
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		body, ok := f.data[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, key, time.Now(), bytes.NewReader(body))
+	case r.Method == http.MethodDelete:
+		delete(f.data, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var keys []string
+	for k := range f.data {
+		if strings.HasPrefix(k, q.Get("prefix")) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	start, _ := strconv.Atoi(q.Get("continuation-token"))
+	var out listResult
+	for i := start; i < len(keys) && i < start+2; i++ {
+		out.Contents = append(out.Contents, listEntry{Key: keys[i], Size: int64(len(f.data[keys[i]])), LastModified: time.Now()})
+	}
+	if start+2 < len(keys) {
+		out.IsTruncated = true
+		out.NextContinuationToken = strconv.Itoa(start + 2)
+	}
+	_ = xml.NewEncoder(w).Encode(out)
+}
+
+func newTestBackend(t *testing.T, dataDir string) (*Backend, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{bucket: "bodies", data: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	b, err := NewBackend(Target{Endpoint: srv.URL, Bucket: "bodies", AccessKey: "key", SecretKey: "secret"}, "pod-0/", dataDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, fake
+}
+
+func TestBackendBlobs(t *testing.T) {
+	dir := t.TempDir()
+	b, fake := newTestBackend(t, dir)
+	var names []string
+	for i, body := range []string{"first body", "second", "third one"} {
+		src := filepath.Join(t.TempDir(), "src")
+		if err := os.WriteFile(src, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join(dir, "blobs", "ab", "blob"+strconv.Itoa(i))
+		if err := b.Put(name, src); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(src); !os.IsNotExist(err) {
+			t.Fatalf("Put left its source behind: %v", err)
+		}
+		names = append(names, name)
+	}
+	if _, ok := fake.data["pod-0/blobs/ab/blob0"]; !ok {
+		t.Fatalf("body not stored under the prefix: %v", fake.data)
+	}
+
+	r, err := b.Get(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(6, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(got) != "body" {
+		t.Fatalf("ranged read returned %q, %v", got, err)
+	}
+
+	info, err := b.Stat(names[2])
+	if err != nil || info.Size != int64(len("third one")) {
+		t.Fatalf("Stat returned %+v, %v", info, err)
+	}
+
+	// Three keys take two list pages.
+	var listed []string
+	err = b.List(context.Background(), filepath.Join(dir, "blobs"), func(bi objectd.BlobInfo) error {
+		listed = append(listed, bi.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(listed, ",") != strings.Join(names, ",") {
+		t.Fatalf("listed %v, want %v", listed, names)
+	}
+
+	renamed := filepath.Join(dir, "blobs", "ab", "renamed")
+	if err := b.Rename(names[1], renamed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Stat(names[1]); !errors.Is(err, objectd.ErrNotFound) {
+		t.Fatalf("renamed body still present: %v", err)
+	}
+	if err := b.Delete(renamed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get(renamed); !errors.Is(err, objectd.ErrNotFound) {
+		t.Fatalf("Get of a deleted body: got %v, want ErrNotFound", err)
+	}
+	if err := b.Put(filepath.Join(t.TempDir(), "elsewhere"), names[0]); err == nil {
+		t.Fatal("stored a body outside the data directory")
+	}
+}
+
+func TestBackendStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	b, fake := newTestBackend(t, dir)
+	store, err := objectd.OpenStoreWithOptions(dir, objectd.StoreOptions{Backend: b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.CreateBucket(ctx, "bucket"); err != nil {
+		t.Fatal(err)
+	}
+	body := bytes.Repeat([]byte("remote "), 1000)
+	if _, err := store.PutObject(ctx, "bucket", "key", bytes.NewReader(body)); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.data) == 0 {
+		t.Fatal("the store wrote no body to the target")
+	}
+	_, r, err := store.OpenObject(ctx, "bucket", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(got, body) {
+		t.Fatalf("object read back %d bytes, %v", len(got), err)
+	}
+	if _, err := store.DeleteObject(ctx, "bucket", "key"); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.data) != 0 {
+		t.Fatalf("deleting the object left bodies in the target: %v", len(fake.data))
+	}
+}
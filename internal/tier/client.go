@@ -0,0 +1,236 @@
+package tier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var errNotFound = errors.New("not found in the tier target")
+
+// Target is an S3 or S3-compatible bucket, addressed path-style.
+type Target struct {
+	// Endpoint is the base URL, such as https://s3.eu-west-1.amazonaws.com.
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// client signs requests with SigV4. Payloads are signed with their SHA-256
+// when it is known, so the target rejects a body damaged in transit.
+type client struct {
+	target Target
+	base   *url.URL
+	http   *http.Client
+}
+
+func newClient(t Target, rt http.RoundTripper) (*client, error) {
+	base, err := url.Parse(strings.TrimSuffix(t.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, fmt.Errorf("invalid tier endpoint %q", t.Endpoint)
+	}
+	if t.Bucket == "" {
+		return nil, fmt.Errorf("tier bucket is required")
+	}
+	if t.Region == "" {
+		t.Region = "us-east-1"
+	}
+	return &client{target: t, base: base, http: &http.Client{Transport: rt}}, nil
+}
+
+// put uploads size bytes of body as key. sum is the hex SHA-256 of the body,
+// or empty if unknown.
+func (c *client) put(ctx context.Context, key string, body io.Reader, size int64, sum string) error {
+	req, err := c.request(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := c.do(req, sum)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// get opens key for reading.
+func (c *client) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return c.getFrom(ctx, key, 0)
+}
+
+// getFrom opens key for reading from byte offset on.
+func (c *client) getFrom(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	req, err := c.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := c.do(req, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// head returns the size and modification time of key.
+func (c *client) head(ctx context.Context, key string) (int64, time.Time, error) {
+	req, err := c.request(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	resp, err := c.do(req, "")
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	resp.Body.Close()
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.ContentLength, modTime, nil
+}
+
+type listEntry struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+type listResult struct {
+	Contents              []listEntry `xml:"Contents"`
+	IsTruncated           bool        `xml:"IsTruncated"`
+	NextContinuationToken string      `xml:"NextContinuationToken"`
+}
+
+// list returns one page of the keys with prefix, continuing after the
+// continuation token of the previous page.
+func (c *client) list(ctx context.Context, prefix, token string) (listResult, error) {
+	q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if token != "" {
+		q.Set("continuation-token", token)
+	}
+	req, err := c.request(ctx, http.MethodGet, "", nil)
+	if err != nil {
+		return listResult{}, err
+	}
+	// SigV4 encodes spaces as %20, not as the + of form encoding.
+	req.URL.RawQuery = strings.ReplaceAll(q.Encode(), "+", "%20")
+	resp, err := c.do(req, "")
+	if err != nil {
+		return listResult{}, err
+	}
+	defer resp.Body.Close()
+	var out listResult
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return listResult{}, fmt.Errorf("tier list %s: %w", prefix, err)
+	}
+	return out, nil
+}
+
+// remove deletes key. Deleting a missing key is not an error.
+func (c *client) remove(ctx context.Context, key string) error {
+	req, err := c.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, "")
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *client) request(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	u := *c.base
+	u.Path = strings.TrimSuffix(c.base.Path, "/") + "/" + c.target.Bucket + "/" + key
+	u.RawPath = escapePath(u.Path)
+	return http.NewRequestWithContext(ctx, method, u.String(), body)
+}
+
+// do signs and sends req. Responses other than 2xx are returned as errors.
+func (c *client) do(req *http.Request, sum string) (*http.Response, error) {
+	if sum == "" {
+		sum = "UNSIGNED-PAYLOAD"
+	}
+	c.sign(req, sum, time.Now())
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("tier %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func (c *client) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	const signed = "host;x-amz-content-sha256;x-amz-date"
+	canon := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signed,
+		payloadHash,
+	}, "\n")
+	h := sha256.Sum256([]byte(canon))
+	scope := date + "/" + c.target.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(h[:])
+	key := hmacSHA256([]byte("AWS4"+c.target.SecretKey), date)
+	key = hmacSHA256(key, c.target.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.target.AccessKey, scope, signed, sig))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// escapePath percent-encodes p the way SigV4 expects: everything except
+// unreserved characters and the separators.
+func escapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,229 @@
+// Package tier offloads the bodies of objects matching age and size rules to
+// an external S3-compatible bucket, leaving their metadata in place. An
+// offloaded object is read from the target on access or, when restores are
+// required, only after RestoreObject brought a local copy back.
+package tier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mchenetz/entity/internal/metrics"
+	"github.com/mchenetz/entity/internal/objectd"
+)
+
+type Config struct {
+	Target Target
+	// Prefix is prepended to the keys in the target bucket, so several
+	// services can share it.
+	Prefix string
+	// Objects are offloaded once they are at least MinAge old and MinSize
+	// bytes large. Buckets limits offloading to the named buckets; empty
+	// means every bucket.
+	MinAge  time.Duration
+	MinSize int64
+	Buckets []string
+	// Interval is the pause between passes.
+	Interval time.Duration
+	// RequireRestore makes offloaded objects unreadable until RestoreObject
+	// brought them back, instead of reading them from the target.
+	RequireRestore bool
+}
+
+type Tierer struct {
+	cfg    Config
+	store  *objectd.Store
+	client *client
+
+	// mu guards the rules: MinAge, MinSize and buckets.
+	mu      sync.RWMutex
+	buckets map[string]bool
+}
+
+// New returns a tierer for store. rt carries the requests to the target; nil
+// means http.DefaultTransport.
+func New(cfg Config, store *objectd.Store, rt http.RoundTripper) (*Tierer, error) {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	c, err := newClient(cfg.Target, rt)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tierer{cfg: cfg, store: store, client: c}
+	t.SetRules(cfg.MinAge, cfg.MinSize, cfg.Buckets)
+	return t, nil
+}
+
+// SetRules changes which objects are offloaded from the next pass on.
+// Objects already offloaded stay in the target.
+func (t *Tierer) SetRules(minAge time.Duration, minSize int64, buckets []string) {
+	var set map[string]bool
+	if len(buckets) > 0 {
+		set = map[string]bool{}
+		for _, b := range buckets {
+			set[b] = true
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cfg.MinAge, t.cfg.MinSize, t.cfg.Buckets, t.buckets = minAge, minSize, buckets, set
+}
+
+// RequireRestore reports whether offloaded objects must be restored before
+// they can be read.
+func (t *Tierer) RequireRestore() bool { return t.cfg.RequireRestore }
+
+// Open reads the body of an offloaded object from the target.
+func (t *Tierer) Open(ctx context.Context, m objectd.ObjectMeta) (io.ReadCloser, error) {
+	if m.TierKey == "" {
+		return nil, fmt.Errorf("%s/%s is not offloaded", m.Bucket, m.Key)
+	}
+	body, err := t.client.get(ctx, m.TierKey)
+	if err != nil {
+		return nil, err
+	}
+	metrics.AddCounter("entity_tier_reads_total", nil, 1)
+	return body, nil
+}
+
+// Run offloads, restores and cleans up every Interval until ctx is done.
+func (t *Tierer) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Pass(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("tier: %v", err)
+			}
+		}
+	}
+}
+
+// Pass removes the target copies of deleted objects, then walks every
+// object once: matching objects are offloaded, offloaded objects with a
+// pending restore are brought back and expired restores are dropped again.
+func (t *Tierer) Pass(ctx context.Context) error {
+	t.removeDeleted(ctx)
+	buckets, err := t.store.ListBuckets(ctx)
+	if err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		token := ""
+		for {
+			objs, next, truncated, err := t.store.ListObjectsV2(ctx, b.Name, "", token, 1000)
+			if errors.Is(err, objectd.ErrNotFound) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			for _, m := range objs {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if err := t.visit(ctx, m); err != nil {
+					log.Printf("tier: %s/%s: %v", m.Bucket, m.Key, err)
+				}
+			}
+			if !truncated {
+				break
+			}
+			token = next
+		}
+	}
+	return nil
+}
+
+func (t *Tierer) visit(ctx context.Context, m objectd.ObjectMeta) error {
+	if m.Pending || m.Encryption != "" {
+		return nil
+	}
+	now := time.Now()
+	restoring := now.Before(m.RestoreExpiry)
+	switch {
+	case m.Offloaded() && restoring:
+		return t.restore(ctx, m)
+	case m.TierKey != "" && !m.Offloaded() && !restoring:
+		// The restore expired; the target still has the body.
+		return t.store.OffloadObject(ctx, m.Bucket, m.Key, m.Seq, m.TierKey)
+	case m.TierKey == "" && !restoring && t.matches(m, now):
+		return t.offload(ctx, m)
+	}
+	return nil
+}
+
+func (t *Tierer) matches(m objectd.ObjectMeta, now time.Time) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.buckets != nil && !t.buckets[m.Bucket] {
+		return false
+	}
+	return m.Size >= t.cfg.MinSize && now.Sub(m.ModTime) >= t.cfg.MinAge
+}
+
+// key names the target copy of m. It is the same on every replica, so a
+// replica finds the copy another one uploaded.
+func (t *Tierer) key(m objectd.ObjectMeta) string {
+	return fmt.Sprintf("%s%s/%016x/%s", t.cfg.Prefix, m.Bucket, m.Seq, m.Key)
+}
+
+func (t *Tierer) offload(ctx context.Context, m objectd.ObjectMeta) error {
+	key := t.key(m)
+	if size, _, err := t.client.head(ctx, key); err != nil || size != m.Size {
+		_, body, err := t.store.OpenObject(ctx, m.Bucket, m.Key)
+		if err != nil {
+			return err
+		}
+		err = t.client.put(ctx, key, body, m.Size, m.ETag)
+		body.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := t.store.OffloadObject(ctx, m.Bucket, m.Key, m.Seq, key); err != nil {
+		return err
+	}
+	metrics.AddCounter("entity_tier_offloaded_objects_total", nil, 1)
+	metrics.AddCounter("entity_tier_offloaded_bytes_total", nil, float64(m.Size))
+	return nil
+}
+
+func (t *Tierer) restore(ctx context.Context, m objectd.ObjectMeta) error {
+	body, err := t.client.get(ctx, m.TierKey)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := t.store.RestoreOffloaded(ctx, m.Bucket, m.Key, m.Seq, body); err != nil {
+		return err
+	}
+	metrics.AddCounter("entity_tier_restored_objects_total", nil, 1)
+	return nil
+}
+
+// removeDeleted deletes the target copies of objects that were overwritten
+// or deleted.
+func (t *Tierer) removeDeleted(ctx context.Context) {
+	var done []string
+	for _, key := range t.store.PendingTierDeletes(ctx) {
+		if err := t.client.remove(ctx, key); err != nil {
+			log.Printf("tier: remove %s: %v", key, err)
+			continue
+		}
+		done = append(done, key)
+	}
+	if err := t.store.CompleteTierDeletes(ctx, done); err != nil {
+		log.Printf("tier: %v", err)
+	}
+}
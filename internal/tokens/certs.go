@@ -0,0 +1,87 @@
+package tokens
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// IdentityHeader names the client certificate identity of a request that a
+// replica forwards to the leader. The leader cannot see the certificate, so
+// the replica sends its own cluster admin token along with it.
+const IdentityHeader = "X-ENTITY-Client-Identity"
+
+// AllowCertificates lets clients without a token authenticate with a
+// verified client certificate. spec is a comma-separated list of subject
+// alternative names, each optionally followed by = and its role; names
+// without a role are cluster admins. DNS names, URIs and email addresses
+// are matched exactly.
+func (s *Set) AllowCertificates(spec string) error {
+	certs := map[string]Role{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, role := item, RoleClusterAdmin
+		if i := strings.LastIndex(item, "="); i >= 0 {
+			name, role = item[:i], Role(item[i+1:])
+		}
+		if _, ok := roleRank[role]; !ok || name == "" {
+			return fmt.Errorf("invalid client certificate identity %q: want a name and one of read-only, bucket-admin or cluster-admin", item)
+		}
+		certs[name] = role
+	}
+	s.mu.Lock()
+	s.certs = certs
+	s.mu.Unlock()
+	return nil
+}
+
+// Identify returns who made r and its role, and false if r is not
+// authorized. A request with a bearer token is identified by the token's
+// fingerprint. One without is identified by the subject alternative name
+// of its verified client certificate that has the highest role. A cluster
+// admin token with IdentityHeader stands for the identity it names.
+func (s *Set) Identify(r *http.Request) (actor string, role Role, ok bool) {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		role, ok := s.Role(token)
+		if id := r.Header.Get(IdentityHeader); ok && role == RoleClusterAdmin && id != "" {
+			role, ok = s.identityRole(id)
+			return id, role, ok
+		}
+		if token != "" {
+			actor = Fingerprint(token)
+		}
+		return actor, role, ok
+	}
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", "", false
+	}
+	return s.certRole(r.TLS.VerifiedChains[0][0])
+}
+
+func (s *Set) identityRole(id string) (Role, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	role, ok := s.certs[id]
+	return role, ok
+}
+
+func (s *Set) certRole(cert *x509.Certificate) (string, Role, bool) {
+	names := append(append([]string{}, cert.DNSNames...), cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var id string
+	var role Role
+	for _, n := range names {
+		if r, ok := s.certs[n]; ok && roleRank[r] > roleRank[role] {
+			id, role = n, r
+		}
+	}
+	return id, role, role != ""
+}
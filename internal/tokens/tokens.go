@@ -0,0 +1,195 @@
+package tokens
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role is what a token may do through the admin API. Each role includes
+// the ones before it.
+type Role string
+
+const (
+	// RoleReadOnly may read status, stats and configuration.
+	RoleReadOnly Role = "read-only"
+	// RoleBucketAdmin may also change buckets, access keys and domains.
+	RoleBucketAdmin Role = "bucket-admin"
+	// RoleClusterAdmin may do anything, including replicating between
+	// peers.
+	RoleClusterAdmin Role = "cluster-admin"
+)
+
+var roleRank = map[Role]int{RoleReadOnly: 1, RoleBucketAdmin: 2, RoleClusterAdmin: 3}
+
+// Allows reports whether r includes need.
+func (r Role) Allows(need Role) bool {
+	return roleRank[r] >= roleRank[need]
+}
+
+type entry struct {
+	token string
+	role  Role
+}
+
+// Set is the admin tokens a replica accepts. They are read from File, one
+// per line as the token optionally followed by its role, with blank lines
+// and lines starting with # ignored. A fixed token such as the one from the
+// environment follows them. Tokens without a role are cluster admins. The
+// first cluster admin token is the one the replica sends to its peers.
+// Rotating a token is therefore done in three file updates: append the new
+// token, move it to the first line once every replica has picked it up, and
+// remove the old one.
+type Set struct {
+	File  string
+	Fixed string
+
+	mu      sync.RWMutex
+	entries []entry
+	// certs are the roles of client certificate identities.
+	certs map[string]Role
+}
+
+func New(fixed, file string) *Set {
+	s := &Set{File: file, Fixed: fixed}
+	s.Reload()
+	return s
+}
+
+// Reload rereads File. The previous tokens are kept if File cannot be read
+// or the result would be empty, so that a half-written update never locks
+// everyone out.
+func (s *Set) Reload() {
+	var entries []entry
+	if s.File != "" {
+		data, err := os.ReadFile(s.File)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to read admin tokens: %v", err)
+			return
+		}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; sc.Scan(); line++ {
+			fields := strings.Fields(sc.Text())
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			e := entry{token: fields[0], role: RoleClusterAdmin}
+			if len(fields) > 1 {
+				e.role = Role(fields[1])
+			}
+			if _, ok := roleRank[e.role]; !ok || len(fields) > 2 {
+				log.Printf("skipping admin token line %d: want a token and one of read-only, bucket-admin or cluster-admin", line)
+				continue
+			}
+			entries = append(entries, e)
+		}
+	}
+	if s.Fixed != "" && !contains(entries, s.Fixed) {
+		entries = append(entries, entry{token: s.Fixed, role: RoleClusterAdmin})
+	}
+	if len(entries) == 0 {
+		return
+	}
+	s.mu.Lock()
+	if len(s.entries) > 0 && len(entries) != len(s.entries) {
+		log.Printf("admin tokens reloaded: %d accepted", len(entries))
+	}
+	s.entries = entries
+	s.mu.Unlock()
+}
+
+func (s *Set) Watch(interval time.Duration, stop <-chan struct{}) {
+	if s.File == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.Reload()
+		}
+	}
+}
+
+// Empty reports whether no token is configured.
+func (s *Set) Empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries) == 0
+}
+
+// Primary returns the token to send to peers.
+func (s *Set) Primary() string {
+	if peer := s.Peer(); len(peer) > 0 {
+		return peer[0]
+	}
+	return ""
+}
+
+// Peer returns the cluster admin tokens, the primary first.
+func (s *Set) Peer() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []string
+	for _, e := range s.entries {
+		if e.role == RoleClusterAdmin {
+			out = append(out, e.token)
+		}
+	}
+	return out
+}
+
+// Role returns the role of token, and false if it is not accepted.
+func (s *Set) Role(token string) (Role, bool) {
+	if token == "" {
+		return "", false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var role Role
+	for _, e := range s.entries {
+		if subtle.ConstantTimeCompare([]byte(e.token), []byte(token)) == 1 && role == "" {
+			role = e.role
+		}
+	}
+	return role, role != ""
+}
+
+// RequestRole returns the role r is authorized with, by its bearer token or
+// its client certificate (see Identify), and false if it has none.
+func (s *Set) RequestRole(r *http.Request) (Role, bool) {
+	_, role, ok := s.Identify(r)
+	return role, ok
+}
+
+// Authorized reports whether r is authorized with at least role need.
+func (s *Set) Authorized(r *http.Request, need Role) bool {
+	role, ok := s.RequestRole(r)
+	return ok && role.Allows(need)
+}
+
+// Fingerprint identifies token in logs without revealing it.
+func Fingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:6])
+}
+
+func contains(entries []entry, token string) bool {
+	for _, e := range entries {
+		if e.token == token {
+			return true
+		}
+	}
+	return false
+}
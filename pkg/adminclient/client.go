@@ -0,0 +1,654 @@
+// Package adminclient is a Go client for the objectd admin API, the API
+// described by the OpenAPI document served at /admin/openapi.json.
+//
+// Listings that grow with the deployment are paged by the API with the limit
+// and marker query parameters and answer with truncated and nextMarker, the
+// names the bucket and object listings used first, rather than with a
+// NextToken. The List methods follow the pages and return every entry.
+package adminclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mchenetz/entity/internal/admin"
+	"github.com/mchenetz/entity/internal/audit"
+	"github.com/mchenetz/entity/internal/cluster"
+	"github.com/mchenetz/entity/internal/config"
+	"github.com/mchenetz/entity/internal/metering"
+	"github.com/mchenetz/entity/internal/objectd"
+	"github.com/mchenetz/entity/internal/standby"
+)
+
+// The types the API returns are those objectd encodes, so that the client
+// cannot drift from the server.
+type (
+	Bucket             = objectd.Bucket
+	BucketStats        = objectd.BucketStats
+	BucketConfig       = objectd.BucketConfig
+	AccessKey          = objectd.AccessKey
+	LastUsed           = objectd.LastUsed
+	Policy             = objectd.Policy
+	RateLimit          = objectd.RateLimit
+	Domain             = objectd.Domain
+	Upload             = objectd.Upload
+	ClusterStatus      = admin.ClusterStatus
+	ResyncJob          = cluster.ResyncJob
+	Maintenance        = objectd.Maintenance
+	ConfigStatus       = config.Status
+	Info               = admin.Info
+	ObjectInfo         = admin.ObjectInfo
+	ObjectPage         = admin.ObjectPage
+	CopyResult         = admin.CopyResult
+	CopyFailure        = admin.CopyFailure
+	AccessExport       = admin.AccessExport
+	ExportedAccess     = admin.ExportedAccess
+	AccessImportResult = admin.AccessImportResult
+	StoreInfo          = objectd.StoreInfo
+	StandbyStatus      = standby.Status
+	AuditEntry         = audit.Entry
+	AuditQuery         = audit.Query
+)
+
+// Client calls the admin API at BaseURL, such as
+// https://objects.storage.svc.cluster.local:19000, with Token or, if it is
+// empty, a client certificate (see UseClientCertificate).
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New returns a client that trusts the certificates of caPEM, or the system
+// roots if caPEM is empty.
+func New(baseURL, token, caPEM string) *Client {
+	tr := &http.Transport{}
+	if caPEM != "" {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM([]byte(caPEM))
+		tr.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token, HTTPClient: &http.Client{Timeout: 15 * time.Second, Transport: tr}}
+}
+
+// UseClientCertificate makes c present the certificate and key in these
+// PEM files, which objectd accepts instead of a token for the identities
+// in ENTITY_ADMIN_CLIENT_CERTS. The files are read at every TLS handshake,
+// so renewed certificates are picked up. c must have been made by New.
+func (c *Client) UseClientCertificate(certFile, keyFile string) error {
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		return err
+	}
+	tr, ok := c.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		return errors.New("client certificates need the transport made by New")
+	}
+	if tr.TLSClientConfig == nil {
+		tr.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	tr.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		return &cert, err
+	}
+	return nil
+}
+
+// Error is a response with a status of 300 or above.
+type Error struct {
+	StatusCode int
+	// Message is the body of the response.
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound reports whether err is a 404 response.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// do sends in, if not nil, as JSON and decodes the response into out, if
+// not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	resp, err := c.send(ctx, method, path, query, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// listAll returns the entries of every page of the listing at path, which
+// are under field in each page.
+func listAll[T any](ctx context.Context, c *Client, path, field string, query url.Values) ([]T, error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	var out []T
+	for {
+		var page map[string]json.RawMessage
+		if err := c.do(ctx, http.MethodGet, path, q, nil, &page); err != nil {
+			return nil, err
+		}
+		var entries []T
+		if err := json.Unmarshal(page[field], &entries); err != nil {
+			return nil, err
+		}
+		out = append(out, entries...)
+		var truncated bool
+		var next string
+		_ = json.Unmarshal(page["truncated"], &truncated)
+		_ = json.Unmarshal(page["nextMarker"], &next)
+		if !truncated || next == "" {
+			return out, nil
+		}
+		q.Set("marker", next)
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in any) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return hc.Do(req)
+}
+
+func responseError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+}
+
+// CreateBucketRequest creates a bucket. ReplicationFactor zero means the
+// cluster default.
+type CreateBucketRequest struct {
+	Name              string `json:"name"`
+	ReplicationFactor int    `json:"replicationFactor,omitempty"`
+}
+
+func (c *Client) CreateBucket(ctx context.Context, req CreateBucketRequest) error {
+	return c.do(ctx, http.MethodPost, "/admin/buckets", nil, req, nil)
+}
+
+// DeleteBucket deletes an empty bucket, or purges it first if force is set.
+func (c *Client) DeleteBucket(ctx context.Context, name string, force bool) error {
+	var q url.Values
+	if force {
+		q = url.Values{"force": {"true"}}
+	}
+	return c.do(ctx, http.MethodDelete, "/admin/buckets/"+url.PathEscape(name), q, nil, nil)
+}
+
+// RenameBucket gives bucket the name name without copying its objects.
+func (c *Client) RenameBucket(ctx context.Context, bucket, name string) error {
+	return c.do(ctx, http.MethodPost, "/admin/buckets/"+url.PathEscape(bucket)+"/rename", nil, map[string]string{"name": name}, nil)
+}
+
+func (c *Client) GetBucket(ctx context.Context, name string) (Bucket, error) {
+	var out Bucket
+	err := c.do(ctx, http.MethodGet, "/admin/buckets/"+url.PathEscape(name), nil, nil, &out)
+	return out, err
+}
+
+// ListBuckets returns every bucket, following the pages of the listing.
+func (c *Client) ListBuckets(ctx context.Context) ([]Bucket, error) {
+	return listAll[Bucket](ctx, c, "/admin/buckets", "buckets", nil)
+}
+
+// ListObjects returns a page of the objects of bucket after marker, filtered
+// by prefix and rolled up at delimiter if they are not empty. The next page
+// starts at the returned NextMarker.
+func (c *Client) ListObjects(ctx context.Context, bucket, prefix, delimiter, marker string) (ObjectPage, error) {
+	q := url.Values{}
+	for k, v := range map[string]string{"prefix": prefix, "delimiter": delimiter, "marker": marker} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	var out ObjectPage
+	err := c.do(ctx, http.MethodGet, "/admin/buckets/"+url.PathEscape(bucket)+"/objects", q, nil, &out)
+	return out, err
+}
+
+// HeadObject returns the metadata of an object.
+func (c *Client) HeadObject(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	var out ObjectInfo
+	err := c.do(ctx, http.MethodGet, "/admin/buckets/"+url.PathEscape(bucket)+"/objects/"+url.PathEscape(key), nil, nil, &out)
+	return out, err
+}
+
+// CopyRequest copies SourceKey, or every key under SourcePrefix after
+// Marker, from SourceBucket to DestBucket. DestKey renames a single key;
+// DestPrefix, when not nil, replaces SourcePrefix in the copied keys.
+type CopyRequest struct {
+	SourceBucket string  `json:"sourceBucket"`
+	SourceKey    string  `json:"sourceKey,omitempty"`
+	SourcePrefix string  `json:"sourcePrefix,omitempty"`
+	DestBucket   string  `json:"destBucket"`
+	DestKey      string  `json:"destKey,omitempty"`
+	DestPrefix   *string `json:"destPrefix,omitempty"`
+	Marker       string  `json:"marker,omitempty"`
+}
+
+// Copy copies objects between buckets on the server. A prefix is copied
+// up to 1000 keys per call; while the result is truncated, call again with
+// its NextMarker as the marker, or use CopyAll.
+func (c *Client) Copy(ctx context.Context, req CopyRequest) (CopyResult, error) {
+	var out CopyResult
+	err := c.do(ctx, http.MethodPost, "/admin/copy", nil, req, &out)
+	return out, err
+}
+
+// CopyAll copies every key under req.SourcePrefix, summing the results of
+// the calls it takes.
+func (c *Client) CopyAll(ctx context.Context, req CopyRequest) (CopyResult, error) {
+	var total CopyResult
+	for {
+		res, err := c.Copy(ctx, req)
+		if err != nil {
+			return total, err
+		}
+		total.Copied += res.Copied
+		total.Bytes += res.Bytes
+		total.Failed = append(total.Failed, res.Failed...)
+		if !res.Truncated {
+			return total, nil
+		}
+		req.Marker = res.NextMarker
+	}
+}
+
+// DeleteObject deletes an object as an S3 DELETE would, moving it to the
+// bucket's trash if it has one.
+func (c *Client) DeleteObject(ctx context.Context, bucket, key string) error {
+	return c.do(ctx, http.MethodDelete, "/admin/buckets/"+url.PathEscape(bucket)+"/objects/"+url.PathEscape(key), nil, nil, nil)
+}
+
+func (c *Client) BucketStats(ctx context.Context, name string) (BucketStats, error) {
+	var out BucketStats
+	err := c.do(ctx, http.MethodGet, "/admin/buckets/"+url.PathEscape(name)+"/stats", nil, nil, &out)
+	return out, err
+}
+
+func (c *Client) GetBucketConfig(ctx context.Context, bucket string) (BucketConfig, error) {
+	var out BucketConfig
+	err := c.do(ctx, http.MethodGet, "/admin/buckets/"+url.PathEscape(bucket)+"/config", nil, nil, &out)
+	return out, err
+}
+
+// PutBucketConfig replaces the versioning, quota, public read and default
+// encryption settings of bucket and returns them. Fields left at their zero
+// value are reset, except versioning, so read the configuration first to
+// change one setting.
+func (c *Client) PutBucketConfig(ctx context.Context, bucket string, cfg BucketConfig) (BucketConfig, error) {
+	var out BucketConfig
+	err := c.do(ctx, http.MethodPut, "/admin/buckets/"+url.PathEscape(bucket)+"/config", nil, cfg, &out)
+	return out, err
+}
+
+// SetReplicationFactor sets how many replicas keep the bucket's object
+// bodies; zero means the cluster default.
+func (c *Client) SetReplicationFactor(ctx context.Context, bucket string, factor int) error {
+	return c.do(ctx, http.MethodPost, "/admin/buckets/"+url.PathEscape(bucket)+"/replication-factor", nil, map[string]int{"replicationFactor": factor}, nil)
+}
+
+// SetReplicationPaused pauses or resumes replication of the bucket.
+func (c *Client) SetReplicationPaused(ctx context.Context, bucket string, paused bool) error {
+	action := "resume"
+	if paused {
+		action = "pause"
+	}
+	return c.do(ctx, http.MethodPost, "/admin/buckets/"+url.PathEscape(bucket)+"/replication/"+action, nil, nil, nil)
+}
+
+// CreateAccessRequest creates an access key for Bucket. A zero ExpiresAt
+// never expires.
+type CreateAccessRequest struct {
+	Bucket       string     `json:"bucket"`
+	ReadOnly     bool       `json:"readOnly,omitempty"`
+	AllowedCIDRs []string   `json:"allowedCIDRs,omitempty"`
+	Owner        string     `json:"owner,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	Policy       *Policy    `json:"policy,omitempty"`
+	RateLimit
+}
+
+// CreateAccess returns the new key with its secret, which is not returned
+// again.
+func (c *Client) CreateAccess(ctx context.Context, req CreateAccessRequest) (AccessKey, error) {
+	var out AccessKey
+	err := c.do(ctx, http.MethodPost, "/admin/access", nil, req, &out)
+	return out, err
+}
+
+// ListAccess returns the access keys without their secrets, only those of
+// bucket if it is not empty.
+func (c *Client) ListAccess(ctx context.Context, bucket string) ([]AccessKey, error) {
+	var q url.Values
+	if bucket != "" {
+		q = url.Values{"bucket": {bucket}}
+	}
+	return listAll[AccessKey](ctx, c, "/admin/access", "accessKeys", q)
+}
+
+// ListUnusedAccess returns the access keys not used on any replica for at
+// least d, including those created before that and never used.
+func (c *Client) ListUnusedAccess(ctx context.Context, d time.Duration) ([]AccessKey, error) {
+	return listAll[AccessKey](ctx, c, "/admin/access", "accessKeys", url.Values{"unusedFor": {d.String()}})
+}
+
+func (c *Client) DeleteAccess(ctx context.Context, accessKey string) error {
+	return c.do(ctx, http.MethodDelete, "/admin/access/"+url.PathEscape(accessKey), nil, nil, nil)
+}
+
+// ExportAccess returns the access keys, only those of bucket if it is not
+// empty, with their secrets sealed under key, 32 bytes in hex.
+func (c *Client) ExportAccess(ctx context.Context, key, bucket string) (AccessExport, error) {
+	var out AccessExport
+	err := c.do(ctx, http.MethodPost, "/admin/access/export", nil, map[string]string{"key": key, "bucket": bucket}, &out)
+	return out, err
+}
+
+// ImportAccess adds the keys of an export made with ExportAccess and the
+// same key. Keys that already exist are skipped.
+func (c *Client) ImportAccess(ctx context.Context, key string, export AccessExport) (AccessImportResult, error) {
+	in := struct {
+		Key    string       `json:"key"`
+		Export AccessExport `json:"export"`
+	}{key, export}
+	var out AccessImportResult
+	err := c.do(ctx, http.MethodPost, "/admin/access/import", nil, in, &out)
+	return out, err
+}
+
+// Operations of a batch.
+const (
+	BatchCreateBucket = "createBucket"
+	BatchDeleteBucket = "deleteBucket"
+	BatchCreateAccess = "createAccess"
+	BatchDeleteAccess = "deleteAccess"
+)
+
+// BatchOperation is one change of a batch. Name is the bucket of
+// BatchCreateBucket and BatchDeleteBucket, AccessKey the key of
+// BatchDeleteAccess, and the access request fields describe the key of
+// BatchCreateAccess.
+type BatchOperation struct {
+	Op                string `json:"op"`
+	Name              string `json:"name,omitempty"`
+	ReplicationFactor int    `json:"replicationFactor,omitempty"`
+	Force             bool   `json:"force,omitempty"`
+	AccessKey         string `json:"accessKey,omitempty"`
+	CreateAccessRequest
+}
+
+// BatchResult is the outcome of one operation of a batch.
+type BatchResult struct {
+	Op     string `json:"op"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Access is the key created by BatchCreateAccess, with its secret.
+	Access *AccessKey `json:"access,omitempty"`
+	// RolledBack is set on operations of an atomic batch that were undone
+	// because a later one failed.
+	RolledBack bool `json:"rolledBack,omitempty"`
+}
+
+// Batch applies ops in order. With atomic, only creations are allowed and
+// a failure undoes those applied before it. The results are returned, one
+// per operation, along with an *Error when the batch was rejected or an
+// atomic batch failed.
+func (c *Client) Batch(ctx context.Context, atomic bool, ops []BatchOperation) ([]BatchResult, error) {
+	in := struct {
+		Atomic     bool             `json:"atomic"`
+		Operations []BatchOperation `json:"operations"`
+	}{atomic, ops}
+	resp, err := c.send(ctx, http.MethodPost, "/admin/batch", nil, in)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return nil, responseError(resp)
+	}
+	var out struct {
+		Results []BatchResult `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return out.Results, &Error{StatusCode: resp.StatusCode, Message: batchFailure(out.Results)}
+	}
+	return out.Results, nil
+}
+
+// batchFailure describes the first failed operation.
+func batchFailure(results []BatchResult) string {
+	for i, r := range results {
+		if r.Status >= 300 {
+			return fmt.Sprintf("operation %d (%s): %s", i, r.Op, r.Error)
+		}
+	}
+	return ""
+}
+
+func (c *Client) ListDomains(ctx context.Context) ([]Domain, error) {
+	return listAll[Domain](ctx, c, "/admin/domains", "domains", nil)
+}
+
+func (c *Client) PutDomain(ctx context.Context, d Domain) error {
+	return c.do(ctx, http.MethodPost, "/admin/domains", nil, d, nil)
+}
+
+func (c *Client) DeleteDomain(ctx context.Context, host string) error {
+	return c.do(ctx, http.MethodDelete, "/admin/domains/"+url.PathEscape(host), nil, nil, nil)
+}
+
+// ListUploads returns the multipart uploads in progress that started at
+// least olderThan ago, in bucket or in every bucket if bucket is empty.
+func (c *Client) ListUploads(ctx context.Context, bucket string, olderThan time.Duration) ([]Upload, error) {
+	return listAll[Upload](ctx, c, "/admin/uploads", "uploads", uploadsQuery(bucket, olderThan))
+}
+
+// AbortedUploads is the result of AbortUploads.
+type AbortedUploads struct {
+	Aborted    []Upload `json:"aborted"`
+	FreedBytes int64    `json:"freedBytes"`
+}
+
+// AbortUploads aborts the multipart uploads ListUploads would return.
+// olderThan must be positive.
+func (c *Client) AbortUploads(ctx context.Context, bucket string, olderThan time.Duration) (AbortedUploads, error) {
+	var out AbortedUploads
+	if olderThan <= 0 {
+		return out, fmt.Errorf("olderThan must be positive")
+	}
+	err := c.do(ctx, http.MethodDelete, "/admin/uploads", uploadsQuery(bucket, olderThan), nil, &out)
+	return out, err
+}
+
+func (c *Client) AbortUpload(ctx context.Context, bucket, uploadID string) error {
+	return c.do(ctx, http.MethodDelete, "/admin/uploads/"+url.PathEscape(bucket)+"/"+url.PathEscape(uploadID), nil, nil, nil)
+}
+
+func uploadsQuery(bucket string, olderThan time.Duration) url.Values {
+	q := url.Values{}
+	if bucket != "" {
+		q.Set("bucket", bucket)
+	}
+	if olderThan > 0 {
+		q.Set("olderThan", olderThan.String())
+	}
+	return q
+}
+
+// Audit returns the newest audit entries of the pod that answers, oldest
+// first. Setting query.Before to the time of the first entry returned gets
+// the entries before them.
+func (c *Client) Audit(ctx context.Context, query AuditQuery) ([]AuditEntry, error) {
+	q := url.Values{}
+	if !query.Since.IsZero() {
+		q.Set("since", query.Since.Format(time.RFC3339))
+	}
+	if !query.Before.IsZero() {
+		q.Set("marker", query.Before.Format(time.RFC3339Nano))
+	}
+	if query.Action != "" {
+		q.Set("action", query.Action)
+	}
+	if query.Actor != "" {
+		q.Set("actor", query.Actor)
+	}
+	if query.Limit > 0 {
+		q.Set("limit", strconv.Itoa(query.Limit))
+	}
+	var out struct {
+		Entries []AuditEntry `json:"entries"`
+	}
+	err := c.do(ctx, http.MethodGet, "/admin/audit", q, nil, &out)
+	return out.Entries, err
+}
+
+// Usage is the traffic and storage between two times, merged across the
+// replicas.
+type Usage struct {
+	metering.Report
+	// MissingPeers did not answer; their traffic is not included.
+	MissingPeers []int `json:"missingPeers,omitempty"`
+}
+
+func (c *Client) Usage(ctx context.Context, from, to time.Time) (Usage, error) {
+	var out Usage
+	q := url.Values{"from": {from.Format(time.RFC3339)}, "to": {to.Format(time.RFC3339)}}
+	err := c.do(ctx, http.MethodGet, "/admin/usage", q, nil, &out)
+	return out, err
+}
+
+func (c *Client) ClusterStatus(ctx context.Context) (ClusterStatus, error) {
+	var out ClusterStatus
+	err := c.do(ctx, http.MethodGet, "/admin/cluster/status", nil, nil, &out)
+	return out, err
+}
+
+// Resync starts an anti-entropy pass of the pod that answers against its
+// peers, only for bucket if it is not empty. Poll its progress with
+// GetResync.
+func (c *Client) Resync(ctx context.Context, bucket string) (ResyncJob, error) {
+	var q url.Values
+	if bucket != "" {
+		q = url.Values{"bucket": {bucket}}
+	}
+	var out ResyncJob
+	err := c.do(ctx, http.MethodPost, "/admin/cluster/resync", q, nil, &out)
+	return out, err
+}
+
+// ListResyncs returns the resyncs the pod that answers remembers, oldest
+// first.
+func (c *Client) ListResyncs(ctx context.Context) ([]ResyncJob, error) {
+	return listAll[ResyncJob](ctx, c, "/admin/cluster/resync", "jobs", nil)
+}
+
+// GetResync returns a resync requested from the pod that answers.
+func (c *Client) GetResync(ctx context.Context, id string) (ResyncJob, error) {
+	var out ResyncJob
+	err := c.do(ctx, http.MethodGet, "/admin/cluster/resync/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// Info returns the build, the cluster position and the features of the pod
+// that answers.
+func (c *Client) Info(ctx context.Context) (Info, error) {
+	var out Info
+	err := c.do(ctx, http.MethodGet, "/admin/info", nil, nil, &out)
+	return out, err
+}
+
+// ConfigStatus returns the outcome of the last configuration reload of the
+// pod that answers.
+func (c *Client) ConfigStatus(ctx context.Context) (ConfigStatus, error) {
+	var out ConfigStatus
+	err := c.do(ctx, http.MethodGet, "/admin/config", nil, nil, &out)
+	return out, err
+}
+
+// ReloadConfig makes the pod that answers reread its configuration file.
+func (c *Client) ReloadConfig(ctx context.Context) (ConfigStatus, error) {
+	var out ConfigStatus
+	err := c.do(ctx, http.MethodPost, "/admin/config/reload", nil, nil, &out)
+	return out, err
+}
+
+// GetMaintenance returns the maintenance mode of the pod that answers.
+func (c *Client) GetMaintenance(ctx context.Context) (Maintenance, error) {
+	var out Maintenance
+	err := c.do(ctx, http.MethodGet, "/admin/maintenance", nil, nil, &out)
+	return out, err
+}
+
+// SetMaintenance turns the maintenance mode of the pod that answers on or
+// off.
+func (c *Client) SetMaintenance(ctx context.Context, enabled bool, reason string) (Maintenance, error) {
+	var out Maintenance
+	in := map[string]any{"enabled": enabled, "reason": reason}
+	err := c.do(ctx, http.MethodPut, "/admin/maintenance", nil, in, &out)
+	return out, err
+}
+
+func (c *Client) StandbyStatus(ctx context.Context) (StandbyStatus, error) {
+	var out StandbyStatus
+	err := c.do(ctx, http.MethodGet, "/admin/standby/status", nil, nil, &out)
+	return out, err
+}
+
+// PromoteStandby turns a standby cluster into a primary.
+func (c *Client) PromoteStandby(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/admin/standby/promote", nil, nil, nil)
+}